@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"knative.dev/pkg/signals"
+
+	"github.com/zakisk/secret-service/pkg/agent"
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+func main() {
+	zapLogger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+	logger := zapLogger.Sugar().Named("secret-syncer-agent")
+	defer func() { _ = logger.Sync() }()
+	logger.Infof("Starting secret-syncer-agent %s", version.String())
+
+	opts, err := agent.OptionsFromEnv()
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Failed to get the in-cluster config: %v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create Kubernetes client: %v", err)
+	}
+	tektonClient, err := tektonversioned.NewForConfig(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create Tekton client: %v", err)
+	}
+
+	a, err := agent.New(logger, opts, kubeClient, tektonClient)
+	if err != nil {
+		logger.Fatalf("Failed to create agent: %v", err)
+	}
+	if err := a.Run(signals.NewContext()); err != nil {
+		logger.Fatalf("Agent failed: %v", err)
+	}
+}
@@ -1,11 +1,180 @@
 package main
 
 import (
-	"github.com/zakisk/secret-service/pkg/reconciler"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	"knative.dev/pkg/injection/sharedmain"
+	"knative.dev/pkg/signals"
+
+	"github.com/zakisk/secret-service/pkg/reconciler"
+	"github.com/zakisk/secret-service/pkg/redact"
+	"github.com/zakisk/secret-service/pkg/version"
 )
 
 func main() {
-	sharedmain.Main("syncer-service", reconciler.NewController())
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// flagEnv names the environment variable each flag overrides. The controller reads its
+// configuration from the environment, so an unset flag falls back to the variable.
+var flagEnv = map[string]string{
+	"kueue-namespace": "KUEUE_NAMESPACE",
+	"namespaces":      "WATCH_NAMESPACES",
+	"dry-run":         "DRY_RUN",
+	"workers":         "WORKER_THREADS",
+}
+
+// Execution modes of the controller selected with --mode.
+const (
+	// modeController runs the controllers until the process is stopped
+	modeController = "controller"
+	// modeGCOnce reconciles the Workloads against the hub and sweeps the spoke clusters for orphaned
+	// secrets once, then exits, for a CronJob complementing the controller
+	modeGCOnce = "gc-once"
+)
+
+func newRootCommand() *cobra.Command {
+	var (
+		kubeconfig     string
+		kubeContext    string
+		metricsAddress string
+		mode           string
+	)
+	cmd := &cobra.Command{
+		Use:   "secret-service",
+		Short: "Sync the secrets of the PipelineRuns dispatched by MultiKueue to their spoke clusters",
+		Long: `Sync the secrets of the PipelineRuns dispatched by MultiKueue to their spoke clusters.
+The flags override the environment variables of config/deployment.yaml, and of the
+SecretSyncerConfig of SECRET_SYNCER_CONFIG, which remain the fallback of the unset flags and
+configure everything else.`,
+		Version:      version.String(),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if mode != modeController && mode != modeGCOnce {
+				return fmt.Errorf("invalid --mode %q, must be %s or %s", mode, modeController, modeGCOnce)
+			}
+			if kubeContext == "" {
+				kubeContext = os.Getenv("HUB_KUBECONFIG_CONTEXT")
+			}
+			zapLogger, err := zap.NewProduction()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = zapLogger.Sync() }()
+			// The startup logs may embed the kubeconfig errors, scrubbed like the controller logs
+			logger := redact.Logger(zapLogger.Sugar())
+			cfg, err := hubConfig(logger, kubeconfig, kubeContext)
+			if err != nil {
+				return err
+			}
+
+			// The SecretSyncerConfig replaces the environment, and the flags override both
+			applied, err := reconciler.ApplySecretSyncerConfig(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+			if applied != nil {
+				logger.Infof("Configured by SecretSyncerConfig %s: %s", applied.Name, strings.Join(applied.Settings, ", "))
+			}
+
+			cmd.Flags().Visit(func(f *pflag.Flag) {
+				if name, ok := flagEnv[f.Name]; ok && err == nil {
+					err = os.Setenv(name, f.Value.String())
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if mode == modeGCOnce {
+				return reconciler.GCOnce(signals.NewContext(), logger.Named(modeGCOnce), cfg)
+			}
+			if metricsAddress != "" {
+				if err := setMetricsAddress(metricsAddress); err != nil {
+					return err
+				}
+			}
+
+			// WithNamespaceScope reads WATCH_NAMESPACES, set from --namespaces above
+			ctx, cancel := context.WithCancel(reconciler.WithNamespaceScope(signals.NewContext()))
+			defer cancel()
+			// The settings are only read on startup, the controller exits on a change of the
+			// SecretSyncerConfig for its pod to be restarted with the new ones
+			if err := applied.Watch(ctx, cfg, func() {
+				logger.Infof("SecretSyncerConfig %s changed, restarting", applied.Name)
+				cancel()
+			}); err != nil {
+				return err
+			}
+			sharedmain.MainWithConfig(ctx, "syncer-service", cfg, reconciler.NewControllers()...)
+			return nil
+		},
+	}
+	cmd.SetVersionTemplate("secret-syncer controller {{.Version}}\n")
+
+	cmd.Flags().String("kueue-namespace", "", "namespace holding the MultiKueue kubeconfig secrets, overrides KUEUE_NAMESPACE (default kueue-system)")
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig of the hub cluster, KUBECONFIG or the in-cluster config when empty")
+	cmd.Flags().StringVar(&kubeContext, "context", "", "kubeconfig context of the hub cluster, overrides HUB_KUBECONFIG_CONTEXT (default the current context)")
+	cmd.Flags().String("namespaces", "", "comma separated hub namespaces the controller is restricted to, overrides WATCH_NAMESPACES (default all namespaces)")
+	cmd.Flags().Bool("dry-run", false, "send the writes to the spoke clusters as server-side dry-run requests, overrides DRY_RUN")
+	cmd.Flags().Int("workers", 2, "number of workers reconciling Workloads concurrently, overrides WORKER_THREADS")
+	cmd.Flags().StringVar(&mode, "mode", modeController, "controller runs the controllers, gc-once reconciles the Workloads against the hub and deletes the orphaned secrets of every active spoke cluster once, then exits")
+	cmd.Flags().StringVar(&metricsAddress, "metrics-address", "", "host:port serving the Prometheus metrics, overrides METRICS_PROMETHEUS_HOST and METRICS_PROMETHEUS_PORT (default :9090)")
+	return cmd
+}
+
+// hubConfig loads the REST config of the hub cluster from the kubeconfig and context, KUBECONFIG,
+// ~/.kube/config and the in-cluster config being the fallbacks of an empty kubeconfig. An
+// explicit context must exist, so a typo never falls back to the current context, and the
+// selected context is logged, so a shared hub is never synced by mistake.
+func hubConfig(logger *zap.SugaredLogger, kubeconfig, kubeContext string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig: %w", err)
+	}
+
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig: %w", err)
+	}
+	if kubeContext == "" {
+		kubeContext = raw.CurrentContext
+	}
+	if kubeContext == "" {
+		logger.Infof("Connecting to the hub cluster %s with the in-cluster config", cfg.Host)
+	} else {
+		logger.Infof("Connecting to the hub cluster %s with kubeconfig context %s", cfg.Host, kubeContext)
+	}
+	return cfg, nil
+}
+
+// setMetricsAddress sets the address of the Prometheus metrics endpoint, which knative reads
+// from the METRICS_PROMETHEUS_HOST and METRICS_PROMETHEUS_PORT environment variables.
+func setMetricsAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid --metrics-address: %w", err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid --metrics-address: invalid port %q", port)
+	}
+	if err := os.Setenv("METRICS_PROMETHEUS_HOST", host); err != nil {
+		return err
+	}
+	return os.Setenv("METRICS_PROMETHEUS_PORT", port)
 }
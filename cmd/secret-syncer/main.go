@@ -0,0 +1,187 @@
+// Command secret-syncer syncs and inspects the secrets of dispatched PipelineRuns by hand,
+// for operators debugging stuck dispatches. Installed as kubectl-secret_syncer, it also runs as
+// the `kubectl secret-syncer` plugin.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/tools/clientcmd"
+	"knative.dev/pkg/signals"
+
+	"github.com/zakisk/secret-service/pkg/reconciler"
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+func main() {
+	if err := newRootCommand().ExecuteContext(signals.NewContext()); err != nil {
+		os.Exit(1)
+	}
+}
+
+// globalFlags are the flags shared by every subcommand.
+type globalFlags struct {
+	kubeconfig string
+	context    string
+	verbose    bool
+}
+
+func newRootCommand() *cobra.Command {
+	flags := &globalFlags{}
+	cmd := &cobra.Command{
+		Use:   "secret-syncer",
+		Short: "Sync and inspect the secrets of PipelineRuns dispatched to spoke clusters",
+		Long: `Sync and inspect the secrets of PipelineRuns dispatched to spoke clusters, with the
+same code as the controller. The controller environment variables, e.g. KUEUE_NAMESPACE or
+SECRET_SOURCE, configure it the same way.`,
+		Version:      version.String(),
+		SilenceUsage: true,
+	}
+	cmd.PersistentFlags().StringVar(&flags.kubeconfig, "kubeconfig", "", "path to the kubeconfig of the hub cluster")
+	cmd.PersistentFlags().StringVar(&flags.context, "context", "", "kubeconfig context of the hub cluster")
+	cmd.PersistentFlags().BoolVarP(&flags.verbose, "verbose", "v", false, "log every step")
+
+	cmd.AddCommand(newSyncCommand(flags), newStatusCommand(flags), newGCCommand(flags), newCleanupClusterCommand(flags))
+	return cmd
+}
+
+// standalone returns the reconciler operations for the hub cluster of the flags.
+func (f *globalFlags) standalone(ctx context.Context) (*reconciler.Standalone, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = f.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: f.context}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig: %w", err)
+	}
+
+	level := zapcore.WarnLevel
+	if f.verbose {
+		level = zapcore.DebugLevel
+	}
+	loggerConfig := zap.NewDevelopmentConfig()
+	loggerConfig.Level = zap.NewAtomicLevelAt(level)
+	logger, err := loggerConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	return reconciler.NewStandalone(ctx, logger.Sugar(), cfg)
+}
+
+func newSyncCommand(flags *globalFlags) *cobra.Command {
+	var workload string
+	cmd := &cobra.Command{
+		Use:   "sync --workload <namespace>/<name>",
+		Short: "Sync the secret of a Workload to its spoke cluster now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			namespace, name, ok := strings.Cut(workload, "/")
+			if !ok || namespace == "" || name == "" {
+				return fmt.Errorf("--workload must be namespace/name, got %q", workload)
+			}
+			s, err := flags.standalone(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := s.Sync(cmd.Context(), namespace, name); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "workload %s synced\n", workload)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&workload, "workload", "", "namespace/name of the Workload")
+	_ = cmd.MarkFlagRequired("workload")
+	return cmd
+}
+
+func newStatusCommand(flags *globalFlags) *cobra.Command {
+	var namespace string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the sync status of the PipelineRun owned Workloads",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			s, err := flags.standalone(cmd.Context())
+			if err != nil {
+				return err
+			}
+			statuses, err := s.Status(cmd.Context(), namespace)
+			if err != nil {
+				return err
+			}
+			return printStatuses(cmd.OutOrStdout(), statuses)
+		},
+	}
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "namespace of the Workloads, all namespaces when empty")
+	return cmd
+}
+
+func printStatuses(out interface{ Write([]byte) (int, error) }, statuses []reconciler.WorkloadStatus) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKLOAD\tPIPELINERUN\tCLUSTER\tFINALIZER\tSYNCED SECRETS")
+	for _, status := range statuses {
+		cluster := status.Cluster
+		if cluster == "" {
+			cluster = "<pending>"
+		}
+		if status.Deleting {
+			cluster += " (deleting)"
+		}
+		secrets := strings.Join(status.SyncedSecrets, ",")
+		if secrets == "" {
+			secrets = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", status.Workload, status.PipelineRun, cluster, status.Finalizer, secrets)
+	}
+	return w.Flush()
+}
+
+func newGCCommand(flags *globalFlags) *cobra.Command {
+	var cluster string
+	cmd := &cobra.Command{
+		Use:   "gc --cluster <name>",
+		Short: "Delete the orphaned secrets of a spoke cluster now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			s, err := flags.standalone(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := s.GC(cmd.Context(), cluster); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "orphaned secrets of spoke cluster %s deleted\n", cluster)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&cluster, "cluster", "", "name of the MultiKueueCluster")
+	_ = cmd.MarkFlagRequired("cluster")
+	return cmd
+}
+
+func newCleanupClusterCommand(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cleanup-cluster <name>",
+		Short: "Delete all the secrets synced to a spoke cluster being decommissioned",
+		Long: `Delete all the secrets and ConfigMaps synced to a spoke cluster being decommissioned,
+found by their managed-by label, including the ones of PipelineRuns still running there. Run it
+before deleting the MultiKueueCluster, whose kubeconfig is used to connect to the spoke cluster.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := flags.standalone(cmd.Context())
+			if err != nil {
+				return err
+			}
+			deleted, err := s.CleanupCluster(cmd.Context(), args[0])
+			fmt.Fprintf(cmd.OutOrStdout(), "%d secrets of spoke cluster %s deleted\n", deleted, args[0])
+			return err
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"knative.dev/pkg/signals"
+
+	"github.com/zakisk/secret-service/pkg/spokewebhook"
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+func main() {
+	zapLogger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+	logger := zapLogger.Sugar().Named("secret-syncer-webhook")
+	defer func() { _ = logger.Sync() }()
+	logger.Infof("Starting secret-syncer-webhook %s", version.String())
+
+	opts, err := spokewebhook.OptionsFromEnv()
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Failed to get the in-cluster config: %v", err)
+	}
+	tektonClient, err := tektonversioned.NewForConfig(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create Tekton client: %v", err)
+	}
+
+	if err := spokewebhook.New(logger, opts, tektonClient).Run(signals.NewContext()); err != nil {
+		logger.Fatalf("Webhook failed: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+
+# Generates the knative injection client, informers and Workload reconciler of Kueue into
+# pkg/client/injection.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+REPO_ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+MODULE=github.com/zakisk/secret-service
+KNATIVE_VERSION=$(cd "${REPO_ROOT}" && go list -m -f '{{.Version}}' knative.dev/pkg)
+
+cd "${REPO_ROOT}"
+rm -rf pkg/client/injection
+go run "knative.dev/pkg/codegen/cmd/injection-gen@${KNATIVE_VERSION}" \
+  --input-dirs sigs.k8s.io/kueue/apis/kueue/v1beta1 \
+  --versioned-clientset-package sigs.k8s.io/kueue/client-go/clientset/versioned \
+  --external-versions-informers-package sigs.k8s.io/kueue/client-go/informers/externalversions \
+  --listers-package sigs.k8s.io/kueue/client-go/listers \
+  --force-genreconciler-kinds Workload \
+  --output-dir pkg/client/injection \
+  --output-package "${MODULE}/pkg/client/injection" \
+  --go-header-file /dev/null
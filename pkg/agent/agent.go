@@ -0,0 +1,169 @@
+// Package agent implements the spoke cluster agent of the pull mode: it watches the local
+// PipelineRuns and pulls their git credentials from the pull API of the hub controller, for
+// spoke clusters the hub can't reach.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/zakisk/secret-service/pkg/redact"
+)
+
+const (
+	// gitAuthSecret is the PipelineRun annotation naming the secret Pipelines-as-Code created
+	// on the hub for it.
+	gitAuthSecret = "pipelinesascode.tekton.dev/git-auth-secret"
+
+	// maxRetries is how many times a PipelineRun is retried before waiting for the next resync.
+	maxRetries = 5
+)
+
+// Agent pulls the secrets of the spoke PipelineRuns from the hub.
+type Agent struct {
+	logger       *zap.SugaredLogger
+	kubeClient   kubernetes.Interface
+	tektonClient tektonversioned.Interface
+	hub          *hubClient
+
+	resyncInterval time.Duration
+	workerThreads  int
+
+	// pipelineRuns is the informer store of the spoke PipelineRuns
+	pipelineRuns cache.Store
+	queue        workqueue.TypedRateLimitingInterface[string]
+}
+
+// New returns an agent for the spoke cluster of the clients.
+func New(logger *zap.SugaredLogger, opts *Options, kubeClient kubernetes.Interface, tektonClient tektonversioned.Interface) (*Agent, error) {
+	hub, err := newHubClient(opts.HubURL, opts.TokenFile, opts.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{
+		logger:         redact.Logger(logger),
+		kubeClient:     kubeClient,
+		tektonClient:   tektonClient,
+		hub:            hub,
+		resyncInterval: opts.ResyncInterval,
+		workerThreads:  opts.WorkerThreads,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "secret-syncer-agent"}),
+	}, nil
+}
+
+// Run watches the PipelineRuns and syncs their secrets until the context is done.
+func (a *Agent) Run(ctx context.Context) error {
+	defer a.queue.ShutDown()
+
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return a.tektonClient.TektonV1().PipelineRuns(metav1.NamespaceAll).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return a.tektonClient.TektonV1().PipelineRuns(metav1.NamespaceAll).Watch(ctx, options)
+		},
+	}, &v1.PipelineRun{}, a.resyncInterval, cache.Indexers{})
+	// Resyncs retry the PipelineRuns not dispatched yet on the hub, or which ran out of retries
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    a.enqueue,
+		UpdateFunc: func(_, obj any) { a.enqueue(obj) },
+	}); err != nil {
+		return fmt.Errorf("could not register PipelineRun event handler: %w", err)
+	}
+	a.pipelineRuns = informer.GetStore()
+
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("could not sync the PipelineRun informer cache")
+	}
+	a.logger.Infof("Pulling the secrets of PipelineRuns from %s", a.hub.url)
+
+	for range a.workerThreads {
+		go a.runWorker(ctx)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (a *Agent) enqueue(obj any) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		a.logger.Errorf("invalid PipelineRun: %v", err)
+		return
+	}
+	a.queue.Add(key)
+}
+
+func (a *Agent) runWorker(ctx context.Context) {
+	for {
+		key, shutdown := a.queue.Get()
+		if shutdown {
+			return
+		}
+		if err := a.sync(ctx, key); err != nil {
+			if a.queue.NumRequeues(key) < maxRetries {
+				a.logger.Errorf("error syncing the secret of PipelineRun %s, retrying: %v", key, err)
+				a.queue.AddRateLimited(key)
+			} else {
+				a.logger.Errorf("error syncing the secret of PipelineRun %s, waiting for the next resync: %v", key, err)
+				a.queue.Forget(key)
+			}
+		} else {
+			a.queue.Forget(key)
+		}
+		a.queue.Done(key)
+	}
+}
+
+// sync pulls the secret of a running PipelineRun from the hub, unless it already exists.
+func (a *Agent) sync(ctx context.Context, key string) error {
+	obj, exists, err := a.pipelineRuns.GetByKey(key)
+	if err != nil || !exists {
+		return err
+	}
+	pipelineRun := obj.(*v1.PipelineRun)
+	secretName := pipelineRun.GetAnnotations()[gitAuthSecret]
+	if secretName == "" || pipelineRun.IsDone() || pipelineRun.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	_, err = a.kubeClient.CoreV1().Secrets(pipelineRun.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("could not get secret %s/%s: %w", pipelineRun.Namespace, secretName, err)
+	}
+
+	secret, err := a.hub.pull(ctx, pipelineRun)
+	if err != nil {
+		return err
+	}
+	if secret.Namespace != pipelineRun.Namespace || secret.Name != secretName {
+		return fmt.Errorf("hub returned secret %s/%s, expected %s/%s", secret.Namespace, secret.Name, pipelineRun.Namespace, secretName)
+	}
+
+	_, err = a.kubeClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not create secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	a.logger.Infof("successfully pulled secret %s/%s for PipelineRun %s", secret.Namespace, secret.Name, pipelineRun.Name)
+	return nil
+}
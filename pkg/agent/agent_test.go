@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	var pulls int
+	hub := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		pulls++
+		assert.Equal(t, pullAPIPath, req.URL.Path)
+		assert.Equal(t, "Bearer agent-token", req.Header.Get("Authorization"))
+		pipelineRun := &v1.PipelineRun{}
+		assert.NilError(t, json.NewDecoder(req.Body).Decode(pipelineRun))
+		_ = json.NewEncoder(w).Encode(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            pipelineRun.Annotations[gitAuthSecret],
+				Namespace:       pipelineRun.Namespace,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: pipelineRun.Name, UID: pipelineRun.UID}},
+			},
+			Data: map[string][]byte{"git-provider-token": []byte("token")},
+		})
+	}))
+	defer hub.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NilError(t, os.WriteFile(tokenFile, []byte("agent-token\n"), 0o600))
+
+	done := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "done", Namespace: "test-namespace", Annotations: map[string]string{gitAuthSecret: "done-secret"}}}
+	done.Status.Status = duckv1.Status{Conditions: duckv1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue}}}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, pipelineRun := range []*v1.PipelineRun{
+		{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "test-namespace", UID: "spoke-uid", Annotations: map[string]string{gitAuthSecret: "git-auth"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "no-secret", Namespace: "test-namespace"}},
+		done,
+	} {
+		assert.NilError(t, store.Add(pipelineRun))
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	a := &Agent{
+		logger:       zap.NewNop().Sugar(),
+		kubeClient:   kubeClient,
+		hub:          &hubClient{url: hub.URL, tokenFile: tokenFile, client: hub.Client()},
+		pipelineRuns: store,
+	}
+
+	for _, key := range []string{"test-namespace/running", "test-namespace/no-secret", "test-namespace/done", "test-namespace/deleted"} {
+		assert.NilError(t, a.sync(ctx, key))
+	}
+	assert.Equal(t, 1, pulls)
+	secret, err := kubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "token", string(secret.Data["git-provider-token"]))
+	assert.Equal(t, "spoke-uid", string(secret.OwnerReferences[0].UID))
+
+	// Existing secrets are not pulled again
+	assert.NilError(t, a.sync(ctx, "test-namespace/running"))
+	assert.Equal(t, 1, pulls)
+}
+
+func TestSyncHubError(t *testing.T) {
+	hub := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "PipelineRun test-namespace/running is not dispatched to spoke cluster test-cluster", http.StatusForbidden)
+	}))
+	defer hub.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NilError(t, os.WriteFile(tokenFile, []byte("agent-token"), 0o600))
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NilError(t, store.Add(&v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "test-namespace", Annotations: map[string]string{gitAuthSecret: "git-auth"}}}))
+	a := &Agent{
+		logger:       zap.NewNop().Sugar(),
+		kubeClient:   fake.NewSimpleClientset(),
+		hub:          &hubClient{url: hub.URL, tokenFile: tokenFile, client: hub.Client()},
+		pipelineRuns: store,
+	}
+
+	err := a.sync(context.Background(), "test-namespace/running")
+	assert.ErrorContains(t, err, "hub answered 403 pulling the secret of PipelineRun test-namespace/running: PipelineRun test-namespace/running is not dispatched")
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectedError string
+	}{
+		{name: "defaults", env: map[string]string{"HUB_URL": "https://secret-syncer.example.com"}},
+		{name: "missing hub URL", expectedError: "invalid HUB_URL"},
+		{name: "plain http hub URL", env: map[string]string{"HUB_URL": "http://secret-syncer.example.com"}, expectedError: "must be an absolute https URL"},
+		{name: "invalid resync interval", env: map[string]string{"HUB_URL": "https://secret-syncer.example.com", "RESYNC_INTERVAL": "0s"}, expectedError: "invalid RESYNC_INTERVAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HUB_URL", "HUB_TOKEN_FILE", "HUB_CA_FILE", "RESYNC_INTERVAL", "WORKER_THREADS"} {
+				t.Setenv(name, tt.env[name])
+			}
+			o, err := OptionsFromEnv()
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, defaultTokenFile, o.TokenFile)
+			assert.Equal(t, defaultResyncInterval, o.ResyncInterval)
+			assert.Equal(t, 2, o.WorkerThreads)
+		})
+	}
+}
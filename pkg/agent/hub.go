@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pullAPIPath is where the hub controller serves the secrets of the PipelineRuns.
+const pullAPIPath = "/v1/secrets"
+
+// hubClient calls the pull API of the hub controller.
+type hubClient struct {
+	url string
+	// tokenFile holds the hub ServiceAccount token of the agent, read on every call as it is rotated
+	tokenFile string
+	client    *http.Client
+}
+
+func newHubClient(hubURL, tokenFile, caFile string) (*hubClient, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the hub CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in the hub CA file %s", caFile)
+		}
+	}
+	return &hubClient{
+		url:       strings.TrimSuffix(hubURL, "/"),
+		tokenFile: tokenFile,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// pull returns the secret to create for the PipelineRun. Only the metadata the hub needs is
+// sent, not the spec of the run.
+func (c *hubClient) pull(ctx context.Context, pipelineRun *v1.PipelineRun) (*corev1.Secret, error) {
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the hub token: %w", err)
+	}
+
+	body, err := json.Marshal(&v1.PipelineRun{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: "PipelineRun"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pipelineRun.Name,
+			Namespace:   pipelineRun.Namespace,
+			UID:         pipelineRun.UID,
+			Labels:      pipelineRun.Labels,
+			Annotations: pipelineRun.Annotations,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+pullAPIPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not call the hub: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("hub answered %d pulling the secret of PipelineRun %s/%s: %s", resp.StatusCode, pipelineRun.Namespace, pipelineRun.Name, strings.TrimSpace(string(message)))
+	}
+
+	secret := &corev1.Secret{}
+	if err := json.NewDecoder(resp.Body).Decode(secret); err != nil {
+		return nil, fmt.Errorf("could not decode the secret of PipelineRun %s/%s: %w", pipelineRun.Namespace, pipelineRun.Name, err)
+	}
+	return secret, nil
+}
+
+// validHubURL checks the hub URL is an absolute https URL, the secrets never transit in clear.
+func validHubURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be an absolute https URL, got %q", value)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTokenFile      = "/var/run/secrets/secret-syncer/token"
+	defaultResyncInterval = 5 * time.Minute
+)
+
+// Options holds the configuration of the agent, read from the environment variables set in
+// config/agent.yaml.
+type Options struct {
+	// HUB_URL: https URL of the pull API of the hub controller
+	HubURL string
+	// HUB_TOKEN_FILE: file holding the hub ServiceAccount token of the agent
+	TokenFile string
+	// HUB_CA_FILE: CA bundle verifying the hub certificate, the system roots when empty
+	CAFile string
+	// RESYNC_INTERVAL: how often every PipelineRun is checked again
+	ResyncInterval time.Duration
+	// WORKER_THREADS: number of PipelineRuns synced concurrently
+	WorkerThreads int
+}
+
+// OptionsFromEnv reads the options from the environment, falling back to the defaults for
+// unset variables.
+func OptionsFromEnv() (*Options, error) {
+	o := &Options{
+		HubURL:    os.Getenv("HUB_URL"),
+		TokenFile: os.Getenv("HUB_TOKEN_FILE"),
+		CAFile:    os.Getenv("HUB_CA_FILE"),
+	}
+	if o.TokenFile == "" {
+		o.TokenFile = defaultTokenFile
+	}
+	if err := validHubURL(o.HubURL); err != nil {
+		return nil, fmt.Errorf("invalid HUB_URL: %w", err)
+	}
+
+	o.ResyncInterval = defaultResyncInterval
+	if value := os.Getenv("RESYNC_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid RESYNC_INTERVAL: must be a positive duration, got %q", value)
+		}
+		o.ResyncInterval = interval
+	}
+
+	o.WorkerThreads = 2
+	if value := os.Getenv("WORKER_THREADS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return nil, fmt.Errorf("invalid WORKER_THREADS: must be at least 1, got %q", value)
+		}
+		o.WorkerThreads = workers
+	}
+	return o, nil
+}
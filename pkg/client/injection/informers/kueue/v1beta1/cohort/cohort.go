@@ -0,0 +1,36 @@
+// Code generated by injection-gen. DO NOT EDIT.
+
+package cohort
+
+import (
+	context "context"
+
+	factory "github.com/zakisk/secret-service/pkg/client/injection/informers/factory"
+	controller "knative.dev/pkg/controller"
+	injection "knative.dev/pkg/injection"
+	logging "knative.dev/pkg/logging"
+	v1beta1 "sigs.k8s.io/kueue/client-go/informers/externalversions/kueue/v1beta1"
+)
+
+func init() {
+	injection.Default.RegisterInformer(withInformer)
+}
+
+// Key is used for associating the Informer inside the context.Context.
+type Key struct{}
+
+func withInformer(ctx context.Context) (context.Context, controller.Informer) {
+	f := factory.Get(ctx)
+	inf := f.Kueue().V1beta1().Cohorts()
+	return context.WithValue(ctx, Key{}, inf), inf.Informer()
+}
+
+// Get extracts the typed informer from the context.
+func Get(ctx context.Context) v1beta1.CohortInformer {
+	untyped := ctx.Value(Key{})
+	if untyped == nil {
+		logging.FromContext(ctx).Panic(
+			"Unable to fetch sigs.k8s.io/kueue/client-go/informers/externalversions/kueue/v1beta1.CohortInformer from context.")
+	}
+	return untyped.(v1beta1.CohortInformer)
+}
@@ -0,0 +1,24 @@
+// Code generated by injection-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	context "context"
+
+	fake "github.com/zakisk/secret-service/pkg/client/injection/informers/factory/fake"
+	workloadpriorityclass "github.com/zakisk/secret-service/pkg/client/injection/informers/kueue/v1beta1/workloadpriorityclass"
+	controller "knative.dev/pkg/controller"
+	injection "knative.dev/pkg/injection"
+)
+
+var Get = workloadpriorityclass.Get
+
+func init() {
+	injection.Fake.RegisterInformer(withInformer)
+}
+
+func withInformer(ctx context.Context) (context.Context, controller.Informer) {
+	f := fake.Get(ctx)
+	inf := f.Kueue().V1beta1().WorkloadPriorityClasses()
+	return context.WithValue(ctx, workloadpriorityclass.Key{}, inf), inf.Informer()
+}
@@ -0,0 +1,165 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+// Audit actions and outcomes.
+const (
+	auditActionSync   = "sync"
+	auditActionDelete = "delete"
+	auditActionRetain = "retain"
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+	// auditOutcomeUnchanged is recorded when the secret already existed, or was already gone.
+	auditOutcomeUnchanged = "unchanged"
+)
+
+// auditEvent is a single sync decision. It is built only from object references, a content
+// hash and the secret type and size, never from a Secret, so secret data values can't reach the
+// audit stream.
+type auditEvent struct {
+	// Action is one of the audit actions.
+	Action string
+	// Outcome is one of the audit outcomes.
+	Outcome string
+	// Reason explains why the action was taken.
+	Reason string
+	// Cluster is the spoke cluster the secret lives on.
+	Cluster string
+	// Secret is the namespace/name of the secret on the spoke cluster.
+	Secret string
+	// Workload and PipelineRun are the namespace/name of the objects the secret is synced for.
+	Workload    string
+	PipelineRun string
+	// ContentHash is the secretContentHash of the synced data.
+	ContentHash string
+	// SecretType and Size are the type and secretDataSize of the synced secret, for the sync
+	// metrics.
+	SecretType corev1.SecretType
+	Size       int64
+	// SpokeUID and SpokeResourceVersion identify the spoke object written or deleted, so its
+	// copy can be traced in the audit logs of the spoke API server.
+	SpokeUID             types.UID
+	SpokeResourceVersion string
+	// SpokeIdentity is the user the controller authenticates as on the spoke cluster.
+	SpokeIdentity string
+	// Error is set when the outcome is a failure.
+	Error error
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, so the field names are stable for SIEM parsers.
+func (e auditEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("action", e.Action)
+	enc.AddString("outcome", e.Outcome)
+	addNonEmpty(enc, "reason", e.Reason)
+	enc.AddString("cluster", e.Cluster)
+	enc.AddString("secret", e.Secret)
+	addNonEmpty(enc, "workload", e.Workload)
+	addNonEmpty(enc, "pipelineRun", e.PipelineRun)
+	addNonEmpty(enc, "contentHash", e.ContentHash)
+	addNonEmpty(enc, "secretType", string(e.SecretType))
+	addNonEmpty(enc, "spokeUID", string(e.SpokeUID))
+	addNonEmpty(enc, "spokeResourceVersion", e.SpokeResourceVersion)
+	addNonEmpty(enc, "spokeIdentity", e.SpokeIdentity)
+	if e.Error != nil {
+		enc.AddString("error", e.Error.Error())
+	}
+	return nil
+}
+
+func addNonEmpty(enc zapcore.ObjectEncoder, key, value string) {
+	if value != "" {
+		enc.AddString(key, value)
+	}
+}
+
+// auditor writes the sync decisions to a dedicated JSON log stream, separate from the
+// controller's logs, so it can be routed to a SIEM on its own.
+type auditor struct {
+	logger *zap.Logger
+}
+
+// newAuditor returns an auditor writing one JSON line per event to the writer. The actor of
+// every event is the controller pod, running the controllerVersion.
+func newAuditor(w zapcore.WriteSyncer) *auditor {
+	config := zap.NewProductionEncoderConfig()
+	config.TimeKey = "timestamp"
+	config.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	config.CallerKey = zapcore.OmitKey
+	config.StacktraceKey = zapcore.OmitKey
+
+	actor, _ := os.Hostname()
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(config), w, zapcore.InfoLevel)).
+		Named("audit").
+		With(zap.String("actor", "secret-syncer/"+actor), zap.String("controllerVersion", version.Version))
+	return &auditor{logger: logger}
+}
+
+// record writes the event to the audit stream. It is a no-op when auditing is disabled.
+func (a *auditor) record(event auditEvent) {
+	if a == nil {
+		return
+	}
+	a.logger.Info("secret sync audit", zap.Object("event", event))
+}
+
+// withContent sets the content hash, type and size of the synced secret.
+func (e auditEvent) withContent(secret *corev1.Secret) auditEvent {
+	e.ContentHash = secretContentHash(secret)
+	e.SecretType = secret.Type
+	e.Size = secretDataSize(secret)
+	return e
+}
+
+// withSpokeObject sets the UID and resource version of the spoke object, as left by the write.
+func (e auditEvent) withSpokeObject(obj metav1.Object) auditEvent {
+	e.SpokeUID = obj.GetUID()
+	e.SpokeResourceVersion = obj.GetResourceVersion()
+	return e
+}
+
+// recordDecision writes the sync decision to the audit log and Tekton Results, emits the
+// matching CloudEvent and counts it in the sync metrics.
+func (r *Reconciler) recordDecision(event auditEvent) {
+	if event.SpokeIdentity == "" {
+		event.SpokeIdentity = r.spokeIdentities.get(event.Cluster)
+	}
+	recordSecretSync(context.Background(), event)
+	r.auditor.record(event)
+	r.cloudEvents.emit(event)
+	r.results.emit(event)
+}
+
+// secretContentHash returns a SHA-256 over the secret type and data, so audits can tell which
+// content was synced and correlate copies across clusters without revealing it.
+func secretContentHash(secret *corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Length prefixes keep distinct key/value splits from hashing the same
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s", len(secret.Type), secret.Type)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%d:%s%d:", len(key), key, len(secret.Data[key]))
+		h.Write(secret.Data[key])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+func decodeAuditEvents(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	events := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		assert.NilError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "audit", entry["logger"])
+		assert.Equal(t, version.Version, entry["controllerVersion"])
+		events = append(events, entry["event"].(map[string]any))
+	}
+	return events
+}
+
+func TestCreateSecretOnSpokeClusterAudit(t *testing.T) {
+	ctx := context.Background()
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"token": []byte("super-secret-token")},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	buf := &bytes.Buffer{}
+	identities := newSpokeIdentities()
+	identities.identities[testClusterName] = spokeIdentity{username: "system:serviceaccount:kube-system:secret-syncer", checkedAt: time.Now()}
+	r := &Reconciler{
+		logger:          zap.NewNop().Sugar(),
+		hubKubeClient:   fake.NewSimpleClientset(hubSecret),
+		auditor:         newAuditor(zapcore.AddSync(buf)),
+		spokeIdentities: identities,
+	}
+	spokeKubeClient := fake.NewSimpleClientset()
+	// The fake API server doesn't set the UID and resource version of the created objects
+	spokeKubeClient.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*corev1.Secret)
+		secret.UID, secret.ResourceVersion = "6f1e3a52-9c2b-4d57-8a7e-0b3c4d5e6f70", "42"
+		return false, nil, nil
+	})
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "missing-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.ErrorContains(t, err, "not found")
+
+	assert.Assert(t, !strings.Contains(buf.String(), "super-secret-token"), "secret data must never be audited")
+	events := decodeAuditEvents(t, buf)
+	assert.Equal(t, 3, len(events))
+	assert.DeepEqual(t, map[string]any{
+		"action":               auditActionSync,
+		"outcome":              auditOutcomeSuccess,
+		"reason":               "PipelineRun dispatched to spoke cluster",
+		"cluster":              testClusterName,
+		"secret":               "test-namespace/test-secret",
+		"workload":             "test-namespace/test-workload",
+		"pipelineRun":          "test-namespace/test-pipeline-run",
+		"contentHash":          secretContentHash(hubSecret),
+		"spokeUID":             "6f1e3a52-9c2b-4d57-8a7e-0b3c4d5e6f70",
+		"spokeResourceVersion": "42",
+		"spokeIdentity":        "system:serviceaccount:kube-system:secret-syncer",
+	}, events[0])
+	assert.Equal(t, auditOutcomeUnchanged, events[1]["outcome"])
+	assert.Equal(t, "6f1e3a52-9c2b-4d57-8a7e-0b3c4d5e6f70", events[1]["spokeUID"], "the existing spoke secret is audited")
+	assert.Equal(t, auditOutcomeFailure, events[2]["outcome"])
+	assert.Equal(t, nil, events[2]["spokeUID"])
+	assert.Equal(t, "system:serviceaccount:kube-system:secret-syncer", events[2]["spokeIdentity"])
+	assert.Assert(t, strings.Contains(events[2]["error"].(string), "not found"))
+}
+
+func TestSecretContentHash(t *testing.T) {
+	secret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{Type: corev1.SecretTypeOpaque, Data: data}
+	}
+
+	hash := secretContentHash(secret(map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+	assert.Assert(t, strings.HasPrefix(hash, "sha256:"))
+	assert.Equal(t, hash, secretContentHash(secret(map[string][]byte{"b": []byte("2"), "a": []byte("1")})))
+	assert.Assert(t, hash != secretContentHash(secret(map[string][]byte{"a": []byte("1"), "b": []byte("3")})))
+	assert.Assert(t, secretContentHash(secret(map[string][]byte{"ab": []byte("c")})) != secretContentHash(secret(map[string][]byte{"a": []byte("bc")})))
+}
+
+func TestNilAuditor(t *testing.T) {
+	var a *auditor
+	a.record(auditEvent{Action: auditActionDelete, Error: errors.New("ignored")})
+}
@@ -0,0 +1,254 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// awsSecretAnnotation records the AWS Secrets Manager secret a spoke Secret was read from.
+	awsSecretAnnotation = syncerGroupName + "/aws-secret-id"
+
+	defaultAWSSecretIDTemplate = "{namespace}/{name}"
+
+	// awsCredentialsRefreshMargin is how long before their expiry the assumed role credentials
+	// are refreshed.
+	awsCredentialsRefreshMargin = 5 * time.Minute
+	awsRequestTimeout           = 10 * time.Second
+)
+
+// awsOptions configures the AWS Secrets Manager secret source.
+type awsOptions struct {
+	// region of the Secrets Manager and STS endpoints
+	region string
+	// roleARN and webIdentityTokenFile are injected by IAM roles for service accounts (IRSA),
+	// the role is assumed with the projected service account token
+	roleARN              string
+	webIdentityTokenFile string
+	// secretIDTemplate derives the secret name or ARN of a PipelineRun's credentials, {namespace}
+	// and {name} are replaced by the PipelineRun namespace and the git-auth secret name.
+	secretIDTemplate string
+}
+
+// awsCredentials are short lived credentials of the assumed role.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	expiration      time.Time
+}
+
+// awsSecretSource reads the git credentials from AWS Secrets Manager, authenticating with the
+// controller's service account through IRSA, so no long lived AWS key is stored anywhere.
+type awsSecretSource struct {
+	opts   awsOptions
+	client *http.Client
+	// stsEndpoint and secretsManagerEndpoint are overridden in tests
+	stsEndpoint            string
+	secretsManagerEndpoint string
+	// now is overridden in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	credentials *awsCredentials
+}
+
+func newAWSSecretSource(opts awsOptions) *awsSecretSource {
+	return &awsSecretSource{
+		opts:                   opts,
+		client:                 &http.Client{Timeout: awsRequestTimeout},
+		stsEndpoint:            fmt.Sprintf("https://sts.%s.amazonaws.com", opts.region),
+		secretsManagerEndpoint: fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", opts.region),
+		now:                    time.Now,
+	}
+}
+
+func (*awsSecretSource) ephemeral() bool { return true }
+
+func (s *awsSecretSource) fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error) {
+	creds, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not assume AWS role %s: %w", s.opts.roleARN, err)
+	}
+
+	secretID, err := secretReference(s.opts.secretIDTemplate, secretIDAnnotation, pipelineRun, secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.secretsManagerEndpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, body, "secretsmanager", s.opts.region, creds, s.now())
+
+	var response struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := s.do(req, func(r io.Reader) error { return json.NewDecoder(r).Decode(&response) }); err != nil {
+		return nil, fmt.Errorf("could not read AWS secret %s: %w", secretID, err)
+	}
+
+	value := []byte(response.SecretString)
+	if response.SecretString == "" {
+		if value, err = base64.StdEncoding.DecodeString(response.SecretBinary); err != nil {
+			return nil, fmt.Errorf("could not decode AWS secret %s: %w", secretID, err)
+		}
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("AWS secret %s has no value", secretID)
+	}
+
+	data, err := secretDataFromValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode AWS secret %s: %w", secretID, err)
+	}
+	return ephemeralSecret(pipelineRun, secretName, awsSecretAnnotation, secretID, data), nil
+}
+
+// assumeRole returns credentials of the IRSA role, assuming it again shortly before they expire.
+func (s *awsSecretSource) assumeRole(ctx context.Context) (*awsCredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credentials != nil && s.now().Add(awsCredentialsRefreshMargin).Before(s.credentials.expiration) {
+		return s.credentials, nil
+	}
+
+	token, err := os.ReadFile(s.opts.webIdentityTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read web identity token: %w", err)
+	}
+
+	// AssumeRoleWithWebIdentity is authenticated by the token itself, it isn't signed
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {s.opts.roleARN},
+		"RoleSessionName":  {"secret-syncer"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.stsEndpoint+"/", strings.NewReader(query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := s.do(req, func(r io.Reader) error { return xml.NewDecoder(r).Decode(&response) }); err != nil {
+		return nil, err
+	}
+
+	s.credentials = &awsCredentials{
+		accessKeyID:     response.Credentials.AccessKeyID,
+		secretAccessKey: response.Credentials.SecretAccessKey,
+		sessionToken:    response.Credentials.SessionToken,
+		expiration:      response.Credentials.Expiration,
+	}
+	return s.credentials, nil
+}
+
+// do sends the request and decodes a successful answer. AWS error bodies only carry error
+// codes and messages, never secret values.
+func (s *awsSecretSource) do(req *http.Request, decode func(io.Reader) error) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("AWS answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return decode(resp.Body)
+}
+
+// signAWSRequest signs the request with AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, service, region string, creds *awsCredentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,279 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/pod"
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// defaultSecretSyncConcurrency is how many secrets of a Workload are synced at once.
+const defaultSecretSyncConcurrency = 4
+
+// Sources of the secrets a PipelineRun references on top of its git auth secret, see
+// PIPELINERUN_SECRET_SOURCES.
+const (
+	// pipelineRunSecretsAnnotation syncs the secrets listed in the syncSecretsAnnotation.
+	pipelineRunSecretsAnnotation = "annotation"
+	// pipelineRunSecretsWorkspaces syncs the secrets bound to the workspaces of the PipelineRun.
+	pipelineRunSecretsWorkspaces = "workspaces"
+	// pipelineRunSecretsServiceAccount syncs the image pull secrets of the pod templates and of the
+	// hub ServiceAccounts of the PipelineRun.
+	pipelineRunSecretsServiceAccount = "service-account"
+
+	// defaultPipelineRunSecretSources only syncs the secrets the PipelineRuns ask for explicitly.
+	defaultPipelineRunSecretSources = pipelineRunSecretsAnnotation
+
+	// syncSecretsAnnotation lists, comma separated, the hub secrets of its namespace a PipelineRun
+	// needs on the spoke cluster.
+	syncSecretsAnnotation = syncerGroupName + "/sync-secrets"
+)
+
+// parsePipelineRunSecretSources validates the PIPELINERUN_SECRET_SOURCES value, a comma
+// separated list of sources, "none" disables them all.
+func parsePipelineRunSecretSources(value string) (map[string]bool, error) {
+	sorted := []string{pipelineRunSecretsAnnotation, pipelineRunSecretsWorkspaces, pipelineRunSecretsServiceAccount}
+	sources := map[string]bool{}
+	for _, source := range strings.Split(value, ",") {
+		switch source = strings.TrimSpace(source); source {
+		case "", "none":
+		case pipelineRunSecretsAnnotation, pipelineRunSecretsWorkspaces, pipelineRunSecretsServiceAccount:
+			sources[source] = true
+		default:
+			return nil, fmt.Errorf("unsupported PipelineRun secret source %q, must be none or a list of %s", source, strings.Join(sorted, ", "))
+		}
+	}
+	return sources, nil
+}
+
+// secretSync is a single secret sync of a batch, returning the name of the spoke secret, empty
+// when it was skipped, and the expiry of its token, zero when unknown.
+type secretSync struct {
+	name string
+	sync func(ctx context.Context) (string, time.Time, error)
+}
+
+// syncErrors are the errors of the failed syncs of a batch, matching each of them with errors.Is.
+type syncErrors []error
+
+func (e syncErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e syncErrors) Unwrap() []error {
+	return e
+}
+
+// syncSecrets runs the syncs of a Workload, at most secretSyncConcurrency of them at once. It
+// returns the spoke secrets of the successful syncs in the order of the syncs, the earliest expiry
+// of their tokens, and the errors of the failed ones, so a single unreachable secret doesn't hide
+// the others.
+func (r *Reconciler) syncSecrets(ctx context.Context, clusterName, namespace string, syncs []secretSync) ([]syncedSecretRef, time.Time, error) {
+	names := make([]string, len(syncs))
+	expiries := make([]time.Time, len(syncs))
+	errs := make([]error, len(syncs))
+
+	slots := make(chan struct{}, max(r.secretSyncConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, s := range syncs {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			names[i], expiries[i], errs[i] = s.sync(ctx)
+			if errs[i] != nil {
+				r.logger.Errorf("error syncing secret %s/%s to spoke cluster %s: %v", namespace, s.name, clusterName, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		refs   []syncedSecretRef
+		expiry time.Time
+		failed syncErrors
+	)
+	for i := range syncs {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		if names[i] == "" {
+			continue
+		}
+		refs = append(refs, syncedSecretRef{Cluster: clusterName, Namespace: namespace, Name: names[i]})
+		if !expiries[i].IsZero() && (expiry.IsZero() || expiries[i].Before(expiry)) {
+			expiry = expiries[i]
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return refs, expiry, nil
+	case 1:
+		return refs, expiry, failed[0]
+	default:
+		return refs, expiry, failed
+	}
+}
+
+// pipelineRunSecretSyncs returns the syncs of the hub secrets the PipelineRun references through
+// the enabled sources, sorted by name, short of the excluded ones which are synced on their own.
+// The secrets listed in the syncSecretsAnnotation and the resolver credentials must exist on the
+// hub, the others may be provisioned on the spoke clusters directly.
+func (r *Reconciler) pipelineRunSecretSyncs(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, exclude map[string]bool) ([]secretSync, error) {
+	// required tells, by name, whether the secret must exist on the hub
+	required := map[string]bool{}
+	if r.pipelineRunSecretSources[pipelineRunSecretsAnnotation] {
+		for _, name := range strings.Split(pipelineRun.GetAnnotations()[syncSecretsAnnotation], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				required[name] = true
+			}
+		}
+	}
+	var optional []string
+	if r.pipelineRunSecretSources[pipelineRunSecretsWorkspaces] {
+		for _, workspace := range pipelineRun.Spec.Workspaces {
+			if workspace.Secret != nil {
+				optional = append(optional, workspace.Secret.SecretName)
+			}
+			if workspace.Projected != nil {
+				for _, source := range workspace.Projected.Sources {
+					if source.Secret != nil {
+						optional = append(optional, source.Secret.Name)
+					}
+				}
+			}
+		}
+	}
+	if r.pipelineRunSecretSources[pipelineRunSecretsServiceAccount] {
+		pullSecrets, err := r.imagePullSecretNames(ctx, pipelineRun)
+		if err != nil {
+			return nil, err
+		}
+		optional = append(optional, pullSecrets...)
+	}
+	// The remote resolutions fail without their credentials
+	resolverSecrets, _ := r.resolverSecretNames(pipelineRun)
+	for _, name := range resolverSecrets {
+		required[name] = true
+	}
+	for _, name := range optional {
+		if _, ok := required[name]; !ok {
+			required[name] = false
+		}
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		if name != "" && !exclude[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	syncs := make([]secretSync, 0, len(names))
+	for _, name := range names {
+		syncs = append(syncs, r.pipelineRunSecretSync(clusterName, spokeKubeClient, pipelineRun, workload, name, required[name]))
+	}
+	return syncs, nil
+}
+
+// imagePullSecretNames returns the image pull secrets of the pod templates of the PipelineRun
+// and of the hub ServiceAccounts its TaskRuns run as, default when none is set.
+func (r *Reconciler) imagePullSecretNames(ctx context.Context, pipelineRun *v1.PipelineRun) ([]string, error) {
+	serviceAccounts := map[string]bool{}
+	if name := pipelineRun.Spec.TaskRunTemplate.ServiceAccountName; name != "" {
+		serviceAccounts[name] = true
+	} else {
+		serviceAccounts["default"] = true
+	}
+	templates := []*pod.Template{pipelineRun.Spec.TaskRunTemplate.PodTemplate}
+	for _, spec := range pipelineRun.Spec.TaskRunSpecs {
+		if spec.ServiceAccountName != "" {
+			serviceAccounts[spec.ServiceAccountName] = true
+		}
+		templates = append(templates, spec.PodTemplate)
+	}
+
+	var names []string
+	for _, template := range templates {
+		if template != nil {
+			names = appendReferences(names, template.ImagePullSecrets)
+		}
+	}
+	for name := range serviceAccounts {
+		serviceAccount, err := r.hubKubeClient.CoreV1().ServiceAccounts(pipelineRun.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get ServiceAccount %s/%s: %w", pipelineRun.GetNamespace(), name, err)
+		}
+		names = appendReferences(names, serviceAccount.ImagePullSecrets)
+	}
+	return names, nil
+}
+
+func appendReferences(names []string, references []corev1.LocalObjectReference) []string {
+	for _, reference := range references {
+		names = append(names, reference.Name)
+	}
+	return names
+}
+
+// pipelineRunSecretSync returns the sync copying a hub secret the PipelineRun references as is to
+// the spoke cluster. A missing secret which isn't required is skipped, one which doesn't match
+// the admission secret selector fails like a disallowed git-auth secret.
+func (r *Reconciler) pipelineRunSecretSync(clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, name string, required bool) secretSync {
+	return secretSync{name: name, sync: func(ctx context.Context) (string, time.Time, error) {
+		event := auditEvent{
+			Action:      auditActionSync,
+			Reason:      "secret referenced by PipelineRun dispatched to spoke cluster",
+			Cluster:     clusterName,
+			Secret:      pipelineRun.GetNamespace() + "/" + name,
+			Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+			PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+		}
+
+		secret, err := r.hubKubeClient.CoreV1().Secrets(pipelineRun.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) && !required {
+			r.logger.Infof("secret %s/%s of PipelineRun %s does not exist on the hub, not syncing it", pipelineRun.GetNamespace(), name, pipelineRun.GetName())
+			return "", time.Time{}, nil
+		}
+		if err == nil {
+			err = revokedSecretError(secret)
+		} else {
+			err = fmt.Errorf("could not get secret %s/%s: %w", pipelineRun.GetNamespace(), name, err)
+		}
+		if err == nil {
+			// These are always hub Secrets, whatever the source of the git-auth secret
+			err = r.disallowedHubSecretError(secret, "PipelineRun "+pipelineRun.GetName())
+		}
+		syncConditionsFrom(ctx).fetched(pipelineRun, err)
+		if err != nil {
+			event.Outcome, event.Error = auditOutcomeFailure, err
+			r.recordDecision(event)
+			return "", time.Time{}, err
+		}
+		event = event.withContent(secret)
+		return r.writeSpokeSecret(ctx, clusterName, spokeKubeClient, workload.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload), event)
+	}}
+}
@@ -0,0 +1,223 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/pod"
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+func TestParsePipelineRunSecretSources(t *testing.T) {
+	for value, expected := range map[string]map[string]bool{
+		"":                         {},
+		"none":                     {},
+		"annotation":               {pipelineRunSecretsAnnotation: true},
+		" workspaces ,annotation,": {pipelineRunSecretsAnnotation: true, pipelineRunSecretsWorkspaces: true},
+		"service-account":          {pipelineRunSecretsServiceAccount: true},
+	} {
+		sources, err := parsePipelineRunSecretSources(value)
+		assert.NilError(t, err, value)
+		assert.DeepEqual(t, expected, sources)
+	}
+
+	_, err := parsePipelineRunSecretSources("params")
+	assert.Error(t, err, `unsupported PipelineRun secret source "params", must be none or a list of annotation, workspaces, service-account`)
+}
+
+func TestSyncSecrets(t *testing.T) {
+	var running, peak atomic.Int32
+	sync := func(name string, expiry time.Time, err error) secretSync {
+		return secretSync{name: name, sync: func(context.Context) (string, time.Time, error) {
+			n := running.Add(1)
+			for current := peak.Load(); n > current && !peak.CompareAndSwap(current, n); current = peak.Load() {
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			return name, expiry, nil
+		}}
+	}
+	soon, later := time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+	r := &Reconciler{logger: zap.NewNop().Sugar(), secretSyncConcurrency: 2}
+
+	refs, expiry, err := r.syncSecrets(context.Background(), testClusterName, "test-namespace", []secretSync{
+		sync("git-auth", later, nil),
+		sync("registry", time.Time{}, nil),
+		{name: "missing-ca", sync: func(context.Context) (string, time.Time, error) { return "", time.Time{}, nil }},
+		sync("webhook", soon, nil),
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []syncedSecretRef{
+		{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"},
+		{Cluster: testClusterName, Namespace: "test-namespace", Name: "registry"},
+		{Cluster: testClusterName, Namespace: "test-namespace", Name: "webhook"},
+	}, refs)
+	assert.Assert(t, soon.Equal(expiry))
+	assert.Equal(t, int32(2), peak.Load())
+
+	// Every failure is reported, the secrets synced in the meantime too
+	conflict := syncer.Classify(errors.New("secret test-namespace/registry was not created by secret-syncer"), ErrSecretConflict)
+	refs, _, err = r.syncSecrets(context.Background(), testClusterName, "test-namespace", []secretSync{
+		sync("git-auth", time.Time{}, nil),
+		sync("registry", time.Time{}, conflict),
+		sync("webhook", time.Time{}, errors.New("connection refused")),
+	})
+	assert.Error(t, err, "secret test-namespace/registry was not created by secret-syncer; connection refused")
+	assert.ErrorIs(t, err, ErrSecretConflict)
+	assert.DeepEqual(t, []syncedSecretRef{{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"}}, refs)
+}
+
+func TestRejectionErrorOfSyncErrors(t *testing.T) {
+	conflict := syncer.Classify(errors.New("conflict"), ErrSecretConflict)
+	quota := syncer.Classify(errors.New("quota"), ErrQuotaExceeded)
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	r := &Reconciler{}
+
+	err := r.rejectionError(workload, syncErrors{conflict, quota})
+	assert.Assert(t, controller.IsPermanentError(err), "expected permanent error, got %v", err)
+
+	// The transient failure is retried, along with the rejected ones
+	err = r.rejectionError(workload, syncErrors{conflict, errors.New("connection refused")})
+	assert.Assert(t, !controller.IsPermanentError(err), "unexpected permanent error %v", err)
+}
+
+func TestPipelineRunSecretSyncs(t *testing.T) {
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-pipeline-run",
+			Namespace:   "test-namespace",
+			Annotations: map[string]string{syncSecretsAnnotation: "signing-key, git-auth"},
+		},
+		Spec: v1.PipelineRunSpec{
+			Workspaces: []v1.WorkspaceBinding{
+				{Name: "docker-config", Secret: &corev1.SecretVolumeSource{SecretName: "docker-config"}},
+				{Name: "source", EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				{Name: "certs", Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "missing-ca"}}},
+				}}},
+			},
+			TaskRunTemplate: v1.PipelineTaskRunTemplate{
+				ServiceAccountName: "pipeline",
+				PodTemplate:        &pod.Template{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "quay-pull"}}},
+			},
+		},
+	}
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Data:       map[string][]byte{"key": []byte(name)},
+		}
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "pipeline", Namespace: "test-namespace"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-pull"}, {Name: "quay-pull"}},
+	}
+	hubObjects := []runtime.Object{secret("signing-key"), secret("docker-config"), secret("quay-pull"), secret("registry-pull"), serviceAccount}
+
+	tests := []struct {
+		name          string
+		sources       map[string]bool
+		annotations   map[string]string
+		allowed       string
+		expectedNames []string
+		expectedError string
+	}{
+		{
+			name: "no sources",
+		},
+		{
+			name:          "annotation",
+			sources:       map[string]bool{pipelineRunSecretsAnnotation: true},
+			expectedNames: []string{"signing-key"},
+		},
+		{
+			name:          "workspaces",
+			sources:       map[string]bool{pipelineRunSecretsWorkspaces: true},
+			expectedNames: []string{"docker-config"},
+		},
+		{
+			name:          "service account",
+			sources:       map[string]bool{pipelineRunSecretsServiceAccount: true},
+			expectedNames: []string{"quay-pull", "registry-pull"},
+		},
+		{
+			name:          "every source",
+			sources:       map[string]bool{pipelineRunSecretsAnnotation: true, pipelineRunSecretsWorkspaces: true, pipelineRunSecretsServiceAccount: true},
+			expectedNames: []string{"docker-config", "quay-pull", "registry-pull", "signing-key"},
+		},
+		{
+			name:          "missing annotation secret",
+			sources:       map[string]bool{pipelineRunSecretsAnnotation: true},
+			annotations:   map[string]string{syncSecretsAnnotation: "missing-ca"},
+			expectedError: `could not get secret test-namespace/missing-ca: secrets "missing-ca" not found`,
+		},
+		{
+			name:          "disallowed secret",
+			sources:       map[string]bool{pipelineRunSecretsAnnotation: true},
+			allowed:       managedByLabel + "=pipelinesascode.tekton.dev",
+			expectedError: "secret test-namespace/signing-key named by PipelineRun test-pipeline-run is not allowed, it must match app.kubernetes.io/managed-by=pipelinesascode.tekton.dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			pipelineRun := pipelineRun.DeepCopy()
+			if tt.annotations != nil {
+				pipelineRun.Annotations = tt.annotations
+			}
+			spokeKubeClient := fake.NewSimpleClientset()
+			r := &Reconciler{
+				logger:                   zap.NewNop().Sugar(),
+				hubKubeClient:            fake.NewSimpleClientset(hubObjects...),
+				pipelineRunSecretSources: tt.sources,
+				secretSyncConcurrency:    defaultSecretSyncConcurrency,
+			}
+			if tt.allowed != "" {
+				selector, err := labels.Parse(tt.allowed)
+				assert.NilError(t, err)
+				r.allowedSecrets = selector
+			}
+
+			syncs, err := r.pipelineRunSecretSyncs(ctx, testClusterName, spokeKubeClient, pipelineRun, workload, map[string]bool{"git-auth": true})
+			assert.NilError(t, err)
+			refs, _, err := r.syncSecrets(ctx, testClusterName, "test-namespace", syncs)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				for _, action := range spokeKubeClient.Actions() {
+					assert.Assert(t, action.GetVerb() == "get", "unexpected %s of the spoke secrets", action.GetVerb())
+				}
+				return
+			}
+			assert.NilError(t, err)
+
+			var names []string
+			for _, ref := range refs {
+				synced, err := spokeKubeClient.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.DeepEqual(t, []byte(ref.Name), synced.Data["key"])
+				assert.Equal(t, managedByValue, synced.Labels[managedByLabel])
+				names = append(names, ref.Name)
+			}
+			assert.DeepEqual(t, tt.expectedNames, names)
+		})
+	}
+}
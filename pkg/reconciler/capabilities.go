@@ -0,0 +1,232 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline"
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonversioned2 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// spokeCapabilitiesTTL is how long the APIs served by a spoke cluster are remembered.
+	spokeCapabilitiesTTL = 5 * time.Minute
+
+	// spokeMissingTektonReason and spokeMissingSecretsReason are the reasons of the Workloads
+	// dispatched to a spoke cluster missing one of the APIs the controller needs.
+	spokeMissingTektonReason  = "SpokeMissingTekton"
+	spokeMissingSecretsReason = "SpokeMissingSecrets"
+)
+
+// spokeCapabilities are the APIs the controller needs, as served by a spoke cluster.
+type spokeCapabilities struct {
+	// version is the Kubernetes version of the spoke API server.
+	version string
+	// pipelineRuns and secrets report whether the tekton.dev/v1 PipelineRuns and the core
+	// Secrets are served, v1beta1PipelineRuns whether the PipelineRuns of the older Tekton
+	// releases which haven't migrated to v1 are.
+	pipelineRuns        bool
+	v1beta1PipelineRuns bool
+	secrets             bool
+	checkedAt           time.Time
+}
+
+// spokeDiscovery remembers the capabilities of the spoke clusters, discovered on first contact.
+// A nil spokeDiscovery assumes every spoke cluster serves the needed APIs.
+type spokeDiscovery struct {
+	// discovering serializes the discoveries of each spoke cluster
+	discovering keyedMutex
+
+	mu           sync.Mutex
+	capabilities map[string]spokeCapabilities
+}
+
+func newSpokeDiscovery() *spokeDiscovery {
+	return &spokeDiscovery{capabilities: map[string]spokeCapabilities{}}
+}
+
+// checkSpokeCapabilities fails with ErrSpokeMissingTekton or ErrSpokeMissingSecrets when the
+// spoke cluster doesn't serve the APIs needed to sync the secrets of its PipelineRuns, so
+// Workloads dispatched there fail with a clear reason rather than with the NotFound errors of
+// every request.
+func (r *Reconciler) checkSpokeCapabilities(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) error {
+	if r.spokeDiscovery == nil {
+		return nil
+	}
+	discoveryCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+	capabilities, err := r.spokeDiscovery.discover(discoveryCtx, clusterName, spokeKubeClient.Discovery())
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !capabilities.pipelineRuns && !capabilities.v1beta1PipelineRuns:
+		return syncer.Classify(fmt.Errorf("spoke cluster %s (Kubernetes %s) doesn't serve the tekton.dev/v1 or tekton.dev/v1beta1 PipelineRuns, is Tekton Pipelines installed?", clusterName, capabilities.version), ErrSpokeMissingTekton)
+	case !capabilities.secrets:
+		return syncer.Classify(fmt.Errorf("spoke cluster %s (Kubernetes %s) doesn't serve the v1 Secrets", clusterName, capabilities.version), ErrSpokeMissingSecrets)
+	}
+	return nil
+}
+
+// discover returns the capabilities of the spoke cluster, discovering them again once they are
+// older than spokeCapabilitiesTTL. The discoveries of a cluster are serialized, so its workers
+// share a single one, while the other clusters are discovered concurrently. The discovery
+// client takes no context, the discovery is abandoned once the context is done.
+func (d *spokeDiscovery) discover(ctx context.Context, clusterName string, client discovery.DiscoveryInterface) (spokeCapabilities, error) {
+	if capabilities, ok := d.cached(clusterName); ok {
+		return capabilities, nil
+	}
+	unlock, err := d.discovering.lock(ctx, clusterName)
+	if err != nil {
+		return spokeCapabilities{}, fmt.Errorf("could not discover spoke cluster %s: %w", clusterName, err)
+	}
+	defer unlock()
+	// Another worker may have discovered the cluster meanwhile
+	if capabilities, ok := d.cached(clusterName); ok {
+		return capabilities, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return spokeCapabilities{}, err
+	}
+
+	capabilities, err := withContext(ctx, func() (spokeCapabilities, error) {
+		return discoverCapabilities(clusterName, client)
+	})
+	if err != nil {
+		return spokeCapabilities{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.capabilities[clusterName] = capabilities
+	return capabilities, nil
+}
+
+// cached returns the capabilities of the spoke cluster discovered within spokeCapabilitiesTTL.
+func (d *spokeDiscovery) cached(clusterName string) (spokeCapabilities, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	capabilities, ok := d.capabilities[clusterName]
+	return capabilities, ok && time.Since(capabilities.checkedAt) < spokeCapabilitiesTTL
+}
+
+// discoverCapabilities asks the spoke API server for its version and the APIs the controller needs.
+func discoverCapabilities(clusterName string, client discovery.DiscoveryInterface) (spokeCapabilities, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return spokeCapabilities{}, fmt.Errorf("could not get the version of spoke cluster %s: %w", clusterName, err)
+	}
+	capabilities := spokeCapabilities{version: info.GitVersion, checkedAt: time.Now()}
+	if capabilities.pipelineRuns, err = servesResource(client.ServerResourcesForGroupVersion, "tekton.dev/v1", "pipelineruns"); err != nil {
+		return spokeCapabilities{}, fmt.Errorf("could not discover tekton.dev/v1 on spoke cluster %s: %w", clusterName, err)
+	}
+	if !capabilities.pipelineRuns {
+		if capabilities.v1beta1PipelineRuns, err = servesResource(client.ServerResourcesForGroupVersion, "tekton.dev/v1beta1", "pipelineruns"); err != nil {
+			return spokeCapabilities{}, fmt.Errorf("could not discover tekton.dev/v1beta1 on spoke cluster %s: %w", clusterName, err)
+		}
+	}
+	if capabilities.secrets, err = servesResource(client.ServerResourcesForGroupVersion, "v1", "secrets"); err != nil {
+		return spokeCapabilities{}, fmt.Errorf("could not discover v1 on spoke cluster %s: %w", clusterName, err)
+	}
+	return capabilities, nil
+}
+
+// forget drops the capabilities of the spoke cluster, so its next check discovers them again.
+func (d *spokeDiscovery) forget(clusterName string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.capabilities, clusterName)
+}
+
+// servesResource reports whether the group version lists the resource, a group version that
+// isn't served at all lists none.
+func servesResource(resourcesFor func(string) (*metav1.APIResourceList, error), groupVersion, resource string) (bool, error) {
+	resources, err := resourcesFor(groupVersion)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getSpokePipelineRun returns the PipelineRun of the spoke cluster, nil when it is not created
+// yet. The PipelineRuns of spoke clusters only serving tekton.dev/v1beta1 are read with that API
+// and converted to v1.
+func (r *Reconciler) getSpokePipelineRun(ctx context.Context, clusterName string, spokeTektonClient tektonversioned2.Interface, namespace, name string) (*v1.PipelineRun, error) {
+	if r.spokeDiscovery == nil {
+		return syncer.SpokePipelineRun(ctx, spokeTektonClient, namespace, name)
+	}
+	discoveryCtx, cancel := r.spokeContext(ctx)
+	capabilities, err := r.spokeDiscovery.discover(discoveryCtx, clusterName, spokeTektonClient.Discovery())
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case capabilities.pipelineRuns:
+		return syncer.SpokePipelineRun(ctx, spokeTektonClient, namespace, name)
+	case !capabilities.v1beta1PipelineRuns:
+		return nil, syncer.Classify(fmt.Errorf("spoke cluster %s doesn't serve the tekton.dev/v1 or tekton.dev/v1beta1 PipelineRuns", clusterName), ErrSpokeMissingTekton)
+	}
+
+	v1beta1PipelineRun, err := spokeTektonClient.TektonV1beta1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pipelineRun := &v1.PipelineRun{}
+	if err := v1beta1PipelineRun.ConvertTo(ctx, pipelineRun); err != nil {
+		return nil, fmt.Errorf("could not convert the v1beta1 PipelineRun %s/%s of spoke cluster %s: %w", namespace, name, clusterName, err)
+	}
+	return pipelineRun, nil
+}
+
+// spokePipelineRunAPIVersion returns the apiVersion of the PipelineRuns of the spoke cluster,
+// tekton.dev/v1 unless it was discovered to only serve tekton.dev/v1beta1.
+func (r *Reconciler) spokePipelineRunAPIVersion(clusterName string) string {
+	if r.spokeDiscovery == nil {
+		return v1.SchemeGroupVersion.String()
+	}
+	r.spokeDiscovery.mu.Lock()
+	defer r.spokeDiscovery.mu.Unlock()
+	if capabilities := r.spokeDiscovery.capabilities[clusterName]; !capabilities.pipelineRuns && capabilities.v1beta1PipelineRuns {
+		return v1beta1.SchemeGroupVersion.String()
+	}
+	return v1.SchemeGroupVersion.String()
+}
+
+// withPipelineRunAPIVersion sets the apiVersion of the PipelineRun owner references, so the
+// garbage collector of the spoke cluster resolves them to the PipelineRuns it serves.
+func withPipelineRunAPIVersion(refs []metav1.OwnerReference, apiVersion string) []metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].Kind == "PipelineRun" && strings.HasPrefix(refs[i].APIVersion, pipeline.GroupName+"/") {
+			refs[i].APIVersion = apiVersion
+		}
+	}
+	return refs
+}
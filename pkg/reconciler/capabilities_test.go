@@ -0,0 +1,198 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var (
+	tektonResources        = &metav1.APIResourceList{GroupVersion: "tekton.dev/v1", APIResources: []metav1.APIResource{{Name: "pipelineruns"}, {Name: "taskruns"}}}
+	v1beta1TektonResources = &metav1.APIResourceList{GroupVersion: "tekton.dev/v1beta1", APIResources: []metav1.APIResource{{Name: "pipelineruns"}}}
+	coreResources          = &metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "secrets"}, {Name: "configmaps"}}}
+)
+
+func spokeClientServing(resources ...*metav1.APIResourceList) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.Resources = resources
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.33.4"}
+	return client
+}
+
+func TestCheckSpokeCapabilities(t *testing.T) {
+	tests := []struct {
+		name          string
+		resources     []*metav1.APIResourceList
+		discoveryErr  error
+		expectedClass error
+		expectedError string
+	}{
+		{
+			name:      "tekton and secrets served",
+			resources: []*metav1.APIResourceList{tektonResources, coreResources},
+		},
+		{
+			name:      "tekton serving only v1beta1",
+			resources: []*metav1.APIResourceList{v1beta1TektonResources, coreResources},
+		},
+		{
+			name:          "tekton not installed",
+			resources:     []*metav1.APIResourceList{coreResources},
+			expectedClass: ErrSpokeMissingTekton,
+			expectedError: "spoke cluster test-cluster (Kubernetes v1.33.4) doesn't serve the tekton.dev/v1 or tekton.dev/v1beta1 PipelineRuns, is Tekton Pipelines installed?",
+		},
+		{
+			name:          "tekton without v1 pipelineruns",
+			resources:     []*metav1.APIResourceList{{GroupVersion: "tekton.dev/v1", APIResources: []metav1.APIResource{{Name: "taskruns"}}}, coreResources},
+			expectedClass: ErrSpokeMissingTekton,
+		},
+		{
+			name:          "secrets not served",
+			resources:     []*metav1.APIResourceList{tektonResources, {GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "configmaps"}}}},
+			expectedClass: ErrSpokeMissingSecrets,
+		},
+		{
+			name:          "discovery fails",
+			discoveryErr:  errors.New("boom"),
+			expectedError: "could not discover tekton.dev/v1 on spoke cluster test-cluster: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := spokeClientServing(tt.resources...)
+			if tt.discoveryErr != nil {
+				client.PrependReactor("get", "resource", func(clienttesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.discoveryErr
+				})
+			}
+			r := &Reconciler{logger: zap.NewNop().Sugar(), spokeDiscovery: newSpokeDiscovery()}
+
+			err := r.checkSpokeCapabilities(context.Background(), testClusterName, client)
+			switch {
+			case tt.expectedClass != nil:
+				assert.ErrorIs(t, err, tt.expectedClass)
+			case tt.expectedError == "":
+				assert.NilError(t, err)
+			}
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+			}
+			if tt.discoveryErr != nil {
+				assert.Assert(t, !errors.Is(err, ErrSpokeMissingTekton))
+			}
+		})
+	}
+}
+
+func TestCheckSpokeCapabilitiesCached(t *testing.T) {
+	r := &Reconciler{logger: zap.NewNop().Sugar(), spokeDiscovery: newSpokeDiscovery()}
+	client := spokeClientServing(coreResources)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, r.checkSpokeCapabilities(ctx, testClusterName, client), ErrSpokeMissingTekton)
+
+	// Installing Tekton is only noticed once the capabilities expire
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.Resources = []*metav1.APIResourceList{tektonResources, coreResources}
+	discoveries := len(client.Actions())
+	assert.ErrorIs(t, r.checkSpokeCapabilities(ctx, testClusterName, client), ErrSpokeMissingTekton)
+	assert.Equal(t, discoveries, len(client.Actions()))
+
+	capabilities := r.spokeDiscovery.capabilities[testClusterName]
+	capabilities.checkedAt = capabilities.checkedAt.Add(-spokeCapabilitiesTTL)
+	r.spokeDiscovery.capabilities[testClusterName] = capabilities
+	assert.NilError(t, r.checkSpokeCapabilities(ctx, testClusterName, client))
+
+	// Without discovery every spoke cluster is assumed to serve the APIs
+	r.spokeDiscovery = nil
+	assert.NilError(t, r.checkSpokeCapabilities(ctx, testClusterName, spokeClientServing()))
+}
+
+func TestGetSpokePipelineRun(t *testing.T) {
+	ctx := context.Background()
+	objectMeta := metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid", Annotations: map[string]string{gitAuthSecret: "git-auth"}}
+
+	tests := []struct {
+		name               string
+		resources          []*metav1.APIResourceList
+		objects            []runtime.Object
+		expectedAPIVersion string
+		expectedNotFound   bool
+		expectedClass      error
+	}{
+		{
+			name:               "v1",
+			resources:          []*metav1.APIResourceList{tektonResources, v1beta1TektonResources, coreResources},
+			objects:            []runtime.Object{&v1.PipelineRun{ObjectMeta: objectMeta}},
+			expectedAPIVersion: "tekton.dev/v1",
+		},
+		{
+			name:               "v1beta1 fallback",
+			resources:          []*metav1.APIResourceList{v1beta1TektonResources, coreResources},
+			objects:            []runtime.Object{&v1beta1.PipelineRun{ObjectMeta: objectMeta}},
+			expectedAPIVersion: "tekton.dev/v1beta1",
+		},
+		{
+			name:               "v1beta1 not created yet",
+			resources:          []*metav1.APIResourceList{v1beta1TektonResources, coreResources},
+			expectedAPIVersion: "tekton.dev/v1beta1",
+			expectedNotFound:   true,
+		},
+		{
+			name:          "tekton not installed",
+			resources:     []*metav1.APIResourceList{coreResources},
+			expectedClass: ErrSpokeMissingTekton,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tektonfake.NewSimpleClientset(tt.objects...)
+			discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+			discovery.Resources = tt.resources
+			r := &Reconciler{logger: zap.NewNop().Sugar(), spokeDiscovery: newSpokeDiscovery()}
+
+			pipelineRun, err := r.getSpokePipelineRun(ctx, testClusterName, client, "test-namespace", "test-pipeline-run")
+			if tt.expectedClass != nil {
+				assert.ErrorIs(t, err, tt.expectedClass)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedAPIVersion, r.spokePipelineRunAPIVersion(testClusterName))
+			if tt.expectedNotFound {
+				assert.Assert(t, pipelineRun == nil)
+				return
+			}
+			assert.Equal(t, types.UID("spoke-uid"), pipelineRun.GetUID())
+			assert.Equal(t, "git-auth", pipelineRun.GetAnnotations()[gitAuthSecret])
+		})
+	}
+}
+
+func TestWithPipelineRunAPIVersion(t *testing.T) {
+	refs := withPipelineRunAPIVersion([]metav1.OwnerReference{
+		{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Name: "test-pipeline-run"},
+		{APIVersion: "example.com/v1", Kind: "PipelineRun", Name: "other"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "config"},
+	}, "tekton.dev/v1beta1")
+	assert.DeepEqual(t, []metav1.OwnerReference{
+		{APIVersion: "tekton.dev/v1beta1", Kind: "PipelineRun", Name: "test-pipeline-run"},
+		{APIVersion: "example.com/v1", Kind: "PipelineRun", Name: "other"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "config"},
+	}, refs)
+}
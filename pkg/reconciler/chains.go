@@ -0,0 +1,142 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+const (
+	// chainsSigningSecretName is the secret Tekton Chains reads its signing keys from. Chains
+	// installs it empty, so its presence tells a spoke cluster runs Chains.
+	chainsSigningSecretName = "signing-secrets"
+
+	defaultChainsNamespace         = "tekton-chains"
+	defaultChainsSigningSyncPeriod = 5 * time.Minute
+)
+
+// chainsOptions configure the sync of the Tekton Chains signing keys to the spoke clusters.
+type chainsOptions struct {
+	// enabled turns the sync on
+	enabled bool
+	// namespace is where Chains runs, on the hub and on the spoke clusters
+	namespace string
+	// interval is how often the signing keys are synced
+	interval time.Duration
+}
+
+// runChainsSigningSecretSync periodically syncs the Chains signing keys of the hub to all active
+// spoke clusters until the context is done.
+func (r *Reconciler) runChainsSigningSecretSync(ctx context.Context) {
+	wait.JitterUntilWithContext(ctx, r.syncChainsSigningSecrets, r.chains.interval, 0.1, false)
+}
+
+// syncChainsSigningSecrets copies the Chains signing keys of the hub to every active spoke
+// cluster running Chains, so the PipelineRuns dispatched there are signed with the same keys.
+func (r *Reconciler) syncChainsSigningSecrets(ctx context.Context) {
+	namespace := r.chains.namespace
+	hubSecret, err := r.hubKubeClient.CoreV1().Secrets(namespace).Get(ctx, chainsSigningSecretName, metav1.GetOptions{})
+	if err != nil {
+		r.logger.Errorf("error getting Chains signing secret %s/%s: %v", namespace, chainsSigningSecretName, err)
+		return
+	}
+	if len(hubSecret.Data) == 0 {
+		r.logger.Debugf("Chains signing secret %s/%s has no keys, skipping sync", namespace, chainsSigningSecretName)
+		return
+	}
+
+	clusters, err := r.kueueClient.KueueV1beta1().MultiKueueClusters().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters for Chains signing secret sync: %v", err)
+		return
+	}
+
+	for _, cluster := range clusters.Items {
+		if !meta.IsStatusConditionTrue(cluster.Status.Conditions, kueuev1beta1.MultiKueueClusterActive) {
+			r.logger.Debugf("MultiKueueCluster %s is not active, skipping Chains signing secret sync", cluster.Name)
+			continue
+		}
+		// Only the leader for the cluster key syncs, so replicas don't race on the same secret
+		if !r.isLeaderFor(types.NamespacedName{Namespace: namespace, Name: cluster.Name}) {
+			continue
+		}
+
+		spokeKubeClient, _, err := r.getSpokeClients(ctx, cluster.Name)
+		if err != nil {
+			r.logger.Errorf("error creating spoke clients for cluster %s: %v", cluster.Name, err)
+			continue
+		}
+
+		if err := r.syncChainsSigningSecret(ctx, cluster.Name, spokeKubeClient, hubSecret.Data); err != nil {
+			r.logger.Errorf("error syncing Chains signing secret to spoke cluster %s: %v", cluster.Name, err)
+		}
+	}
+}
+
+// syncChainsSigningSecret writes the signing keys into the Chains signing secret of a single
+// spoke cluster. Spoke clusters without the secret don't run Chains and are left alone.
+func (r *Reconciler) syncChainsSigningSecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, data map[string][]byte) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	ref := syncedSecretRef{Cluster: clusterName, Namespace: r.chains.namespace, Name: chainsSigningSecretName}
+	event := auditEvent{
+		Action:  auditActionSync,
+		Outcome: auditOutcomeSuccess,
+		Reason:  "Chains signing keys synced",
+		Cluster: clusterName,
+		Secret:  ref.Namespace + "/" + ref.Name,
+	}
+	var (
+		updated  *corev1.Secret
+		updating bool
+	)
+	// An update conflicting with Chains, or another writer of the secret, is decided again on a
+	// fresh copy
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := spokeKubeClient.CoreV1().Secrets(ref.Namespace).Get(spokeCtx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get secret %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+
+		// Unchanged keys aren't audited, they are compared on every sync
+		if reflect.DeepEqual(secret.Data, data) {
+			return nil
+		}
+
+		// Chains owns the secret, only its keys are replaced
+		secret = secret.DeepCopy()
+		secret.Data = data
+		event, updating = event.withContent(secret), true
+		if updated, err = spokeKubeClient.CoreV1().Secrets(ref.Namespace).Update(spokeCtx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update secret %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+		return nil
+	})
+	if errors.IsNotFound(err) {
+		r.logger.Debugf("spoke cluster %s has no Chains signing secret %s/%s, skipping sync", clusterName, ref.Namespace, ref.Name)
+		return nil
+	}
+	if err != nil && updating {
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+	}
+	if err != nil || updated == nil {
+		return err
+	}
+	r.recordDecision(event.withSpokeObject(updated))
+
+	r.logger.Infof("synced Chains signing secret %s/%s to spoke cluster %s", ref.Namespace, ref.Name, clusterName)
+	return nil
+}
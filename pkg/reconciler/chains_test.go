@@ -0,0 +1,75 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncChainsSigningSecret(t *testing.T) {
+	ctx := context.Background()
+	keys := map[string][]byte{"cosign.key": []byte("private"), "cosign.pub": []byte("public"), "cosign.password": []byte("password")}
+	chainsSecret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: chainsSigningSecretName, Namespace: defaultChainsNamespace, Labels: map[string]string{"app.kubernetes.io/part-of": "tekton-chains"}},
+			Data:       data,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		spokeSecrets   []runtime.Object
+		expectedUpdate bool
+	}{
+		{
+			name: "spoke without chains",
+		},
+		{
+			name:           "empty signing secret installed by chains",
+			spokeSecrets:   []runtime.Object{chainsSecret(nil)},
+			expectedUpdate: true,
+		},
+		{
+			name:           "outdated keys",
+			spokeSecrets:   []runtime.Object{chainsSecret(map[string][]byte{"cosign.pub": []byte("old")})},
+			expectedUpdate: true,
+		},
+		{
+			name:         "keys already synced",
+			spokeSecrets: []runtime.Object{chainsSecret(keys)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spokeKubeClient := fake.NewSimpleClientset(tt.spokeSecrets...)
+			r := &Reconciler{
+				logger: zap.NewNop().Sugar(),
+				chains: chainsOptions{enabled: true, namespace: defaultChainsNamespace},
+			}
+
+			assert.NilError(t, r.syncChainsSigningSecret(ctx, testClusterName, spokeKubeClient, keys))
+
+			updated := false
+			for _, action := range spokeKubeClient.Actions() {
+				assert.Assert(t, action.GetVerb() != "create", "the signing secret must never be created")
+				updated = updated || action.GetVerb() == "update"
+			}
+			assert.Equal(t, tt.expectedUpdate, updated)
+			if !tt.expectedUpdate {
+				return
+			}
+
+			secret, err := spokeKubeClient.CoreV1().Secrets(defaultChainsNamespace).Get(ctx, chainsSigningSecretName, metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, keys, secret.Data)
+			assert.Equal(t, "tekton-chains", secret.Labels["app.kubernetes.io/part-of"])
+		})
+	}
+}
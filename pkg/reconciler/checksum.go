@@ -0,0 +1,29 @@
+package reconciler
+
+import corev1 "k8s.io/api/core/v1"
+
+const (
+	// checksumAnnotation holds the secretContentHash of the data synced to a spoke secret, so the
+	// next reconciles can tell whether the hub secret changed since.
+	checksumAnnotation = syncerGroupName + "/checksum"
+)
+
+// Resync reasons, why an existing spoke secret was updated.
+const (
+	resyncReasonContentChanged = "content-changed"
+	resyncReasonExpiry         = "token-expiry"
+	resyncReasonRotation       = "rotation"
+	resyncReasonHubUpdate      = "hub-update"
+	resyncReasonAdopted        = "adopted"
+	resyncReasonRequested      = "requested"
+	resyncReasonRecreated      = "pipelinerun-recreated"
+	resyncReasonMetadata       = "metadata-changed"
+)
+
+// setChecksum records the checksum of the data of the secret to sync on it.
+func setChecksum(secret *corev1.Secret) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[checksumAnnotation] = secretContentHash(secret)
+}
@@ -0,0 +1,98 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/metrics"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestCreateSecretOnSpokeClusterVerifiesChecksum(t *testing.T) {
+	synced := map[string][]byte{"token": []byte("synced")}
+	syncedChecksum := secretContentHash(&corev1.Secret{Data: synced})
+
+	tests := []struct {
+		name             string
+		spokeSecret      *corev1.Secret
+		expectedData     map[string][]byte
+		expectedResyncs  int64
+		expectedChecksum string
+	}{
+		{
+			name:             "created with the checksum",
+			expectedData:     map[string][]byte{"token": []byte("hub")},
+			expectedChecksum: secretContentHash(&corev1.Secret{Data: map[string][]byte{"token": []byte("hub")}}),
+		},
+		{
+			name: "hub content changed",
+			spokeSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}, Annotations: map[string]string{checksumAnnotation: syncedChecksum}},
+				Data:       synced,
+			},
+			expectedData:     map[string][]byte{"token": []byte("hub")},
+			expectedResyncs:  1,
+			expectedChecksum: secretContentHash(&corev1.Secret{Data: map[string][]byte{"token": []byte("hub")}}),
+		},
+		{
+			name: "synced before the checksum was recorded",
+			spokeSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+				Data:       synced,
+			},
+			expectedData: synced,
+		},
+	}
+
+	metrics.InitForTesting()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			pipelineRun := &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+			}
+			workload := &kueuev1beta1.Workload{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+			}
+			hubSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+				Data:       map[string][]byte{"token": []byte("hub")},
+			}
+			spokeKubeClient := fake.NewSimpleClientset()
+			if tt.spokeSecret != nil {
+				spokeKubeClient = fake.NewSimpleClientset(tt.spokeSecret)
+			}
+			r := &Reconciler{logger: zap.NewNop().Sugar(), hubKubeClient: fake.NewSimpleClientset(hubSecret)}
+			resyncsBefore := resyncCount(t, resyncReasonContentChanged)
+
+			_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+			assert.NilError(t, err)
+			spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedData, spokeSecret.Data)
+			assert.Equal(t, tt.expectedChecksum, spokeSecret.Annotations[checksumAnnotation])
+
+			assert.Equal(t, resyncsBefore+tt.expectedResyncs, resyncCount(t, resyncReasonContentChanged))
+		})
+	}
+}
+
+// resyncCount returns the number of spoke secrets resynced for the reason so far.
+func resyncCount(t *testing.T, reason string) int64 {
+	t.Helper()
+	rows, err := view.RetrieveData(secretResyncsM.Name())
+	assert.NilError(t, err)
+	for _, row := range rows {
+		if row.Tags[0].Value == reason {
+			return row.Data.(*view.CountData).Value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package reconciler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+// needsCleanup reports whether the reconcile of the Workload cleans up its secrets rather than
+// syncing them: it is being deleted, or Kueue reports it finished.
+func needsCleanup(workload *kueuev1beta1.Workload) bool {
+	return !workload.GetDeletionTimestamp().IsZero() || meta.IsStatusConditionTrue(workload.Status.Conditions, kueuev1beta1.WorkloadFinished)
+}
+
+// cleanupFirstEnqueue returns the enqueue of the Workload events putting the cleanups and the
+// deleted Workloads in the fast lane of the workqueue and the other Workloads in its slow lane,
+// which is only drained while the fast one is empty. A dispatch storm filling the workqueue
+// then doesn't hold back the cleanups, so the secrets left on the spoke clusters stay bounded.
+func cleanupFirstEnqueue(enqueue, enqueueSlow func(any)) func(any) {
+	return func(obj any) {
+		if workload, ok := obj.(*kueuev1beta1.Workload); ok && !needsCleanup(workload) {
+			enqueueSlow(obj)
+			return
+		}
+		enqueue(obj)
+	}
+}
+
+// cleanupKey returns whether a key of the workqueue is the one of a Workload to clean up, as
+// cached by the lister. The Workloads gone from the cache are, their reconcile is a cleanup or
+// nothing at all.
+func cleanupKey(lister kueuev1beta1lister.WorkloadLister) func(item any) bool {
+	return func(item any) bool {
+		key, ok := item.(types.NamespacedName)
+		if !ok {
+			return false
+		}
+		workload, err := lister.Workloads(key.Namespace).Get(key.Name)
+		if errors.IsNotFound(err) {
+			return true
+		}
+		return err == nil && needsCleanup(workload)
+	}
+}
+
+// cleanupRateLimiter exempts the retries of the cleanups from the overall token bucket of the
+// workqueue, which the retries of the syncs of a dispatch storm would use up. They still back
+// off exponentially, sharing the failures counted for their key with the other retries.
+type cleanupRateLimiter struct {
+	workqueue.TypedRateLimiter[any]
+	failures workqueue.TypedRateLimiter[any]
+	cleanup  func(item any) bool
+	// retrying are the items whose retry cleanupFirstReconciler moved to the slow lane
+	retrying sync.Map
+}
+
+func (l *cleanupRateLimiter) When(item any) time.Duration {
+	if l.cleanup(item) {
+		return l.failures.When(item)
+	}
+	return l.TypedRateLimiter.When(item)
+}
+
+// Forget forgets the failures of the item, unless its retry was moved to the slow lane, whose
+// backoff then keeps growing with its failures.
+func (l *cleanupRateLimiter) Forget(item any) {
+	if _, ok := l.retrying.LoadAndDelete(item); ok {
+		return
+	}
+	l.TypedRateLimiter.Forget(item)
+}
+
+// slowLaner is the workqueue of the controller, whose slow lane is only drained while its fast
+// one is empty.
+type slowLaner interface {
+	SlowLane() workqueue.TypedRateLimitingInterface[any]
+}
+
+// cleanupFirstEnqueueAfter returns the delayed enqueue of the Workload events, putting the
+// cleanups and the deleted Workloads in the fast lane of the workqueue and the other Workloads
+// in its slow lane, as cleanupFirstEnqueue does.
+func cleanupFirstEnqueueAfter(enqueueAfter func(any, time.Duration), slowLane workqueue.TypedRateLimitingInterface[any]) func(any, time.Duration) {
+	return func(obj any, after time.Duration) {
+		if workload, ok := obj.(*kueuev1beta1.Workload); ok && !needsCleanup(workload) {
+			slowLane.AddAfter(types.NamespacedName{Namespace: workload.Namespace, Name: workload.Name}, after)
+			return
+		}
+		enqueueAfter(obj, after)
+	}
+}
+
+// cleanupFirstReconciler moves the requeues and the retries of the syncs to the slow lane of the
+// workqueue. The controller puts them back in its fast lane, where the retries of a dispatch
+// storm would hold back the cleanups as its events would.
+type cleanupFirstReconciler struct {
+	controller.Reconciler
+	cleanup func(item any) bool
+	limiter *cleanupRateLimiter
+	// slowLane is set once the controller is created, before it runs
+	slowLane workqueue.TypedRateLimitingInterface[any]
+}
+
+func (r *cleanupFirstReconciler) Reconcile(ctx context.Context, key string) error {
+	err := r.Reconciler.Reconcile(ctx, key)
+	if err == nil || controller.IsPermanentError(err) || controller.IsSkipKey(err) {
+		return err
+	}
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return err
+	}
+	item := types.NamespacedName{Namespace: namespace, Name: name}
+	if r.cleanup(item) {
+		return err
+	}
+
+	if ok, delay := controller.IsRequeueKey(err); ok {
+		r.slowLane.AddAfter(item, delay)
+	} else {
+		logging.FromContext(ctx).Errorw("Reconcile error", zap.Error(err))
+		// The controller forgets the skipped key, which would reset its backoff
+		r.limiter.retrying.Store(item, struct{}{})
+		r.slowLane.AddRateLimited(item)
+	}
+	return controller.NewSkipKey(key)
+}
@@ -0,0 +1,264 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func cleanupTestWorkload(name string, deleting, finished bool) *kueuev1beta1.Workload {
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		Status:     kueuev1beta1.WorkloadStatus{ClusterName: ptr.To(testClusterName)},
+	}
+	if deleting {
+		workload.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	}
+	if finished {
+		workload.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue}}
+	}
+	return workload
+}
+
+func TestCleanupFirstEnqueue(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          any
+		expectedFast bool
+	}{
+		{
+			name: "dispatched Workload",
+			obj:  cleanupTestWorkload("test-workload", false, false),
+		},
+		{
+			name:         "Workload being deleted",
+			obj:          cleanupTestWorkload("test-workload", true, false),
+			expectedFast: true,
+		},
+		{
+			name:         "finished Workload",
+			obj:          cleanupTestWorkload("test-workload", false, true),
+			expectedFast: true,
+		},
+		{
+			name:         "deleted Workload",
+			obj:          cache.DeletedFinalStateUnknown{Key: "test-namespace/test-workload", Obj: cleanupTestWorkload("test-workload", false, false)},
+			expectedFast: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fast, slow []any
+			enqueue := cleanupFirstEnqueue(func(obj any) { fast = append(fast, obj) }, func(obj any) { slow = append(slow, obj) })
+			enqueue(tt.obj)
+			if tt.expectedFast {
+				assert.DeepEqual(t, []any{tt.obj}, fast)
+				assert.Equal(t, 0, len(slow))
+			} else {
+				assert.DeepEqual(t, []any{tt.obj}, slow)
+				assert.Equal(t, 0, len(fast))
+			}
+		})
+	}
+}
+
+func TestCleanupRateLimiter(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(cleanupTestWorkload("syncing", false, false)))
+	assert.NilError(t, indexer.Add(cleanupTestWorkload("deleting", true, false)))
+	assert.NilError(t, indexer.Add(cleanupTestWorkload("finished", false, true)))
+	cleanup := cleanupKey(kueuev1beta1lister.NewWorkloadLister(indexer))
+
+	assert.Assert(t, !cleanup(types.NamespacedName{Namespace: "test-namespace", Name: "syncing"}))
+	assert.Assert(t, cleanup(types.NamespacedName{Namespace: "test-namespace", Name: "deleting"}))
+	assert.Assert(t, cleanup(types.NamespacedName{Namespace: "test-namespace", Name: "finished"}))
+	assert.Assert(t, cleanup(types.NamespacedName{Namespace: "test-namespace", Name: "gone"}))
+
+	// A single token a minute: once the syncs used it up, their retries wait for the next one
+	o := &options{
+		rateLimitBaseDelay: 10 * time.Millisecond,
+		rateLimitMaxDelay:  time.Second,
+		rateLimitQPS:       1.0 / 60,
+		rateLimitBurst:     1,
+		cleanupPriority:    true,
+	}
+	limiter := o.rateLimiter(cleanup)
+	syncing := types.NamespacedName{Namespace: "test-namespace", Name: "syncing"}
+	deleting := types.NamespacedName{Namespace: "test-namespace", Name: "deleting"}
+	assert.Equal(t, 10*time.Millisecond, limiter.When(syncing))
+	assert.Assert(t, limiter.When(syncing) > 30*time.Second)
+
+	// The retries of the cleanups only back off
+	assert.Equal(t, 10*time.Millisecond, limiter.When(deleting))
+	assert.Equal(t, 20*time.Millisecond, limiter.When(deleting))
+	assert.Equal(t, 2, limiter.NumRequeues(deleting))
+	limiter.Forget(deleting)
+	assert.Equal(t, 0, limiter.NumRequeues(deleting))
+
+	// Without CLEANUP_PRIORITY the cleanups wait for the tokens too
+	o.cleanupPriority = false
+	limiter = o.rateLimiter(cleanup)
+	assert.Equal(t, 10*time.Millisecond, limiter.When(syncing))
+	assert.Assert(t, limiter.When(deleting) > 30*time.Second)
+}
+
+// recordingLane records the keys added to the slow lane of the workqueue.
+type recordingLane struct {
+	workqueue.TypedRateLimitingInterface[any]
+	after       map[any]time.Duration
+	rateLimited []any
+}
+
+func (l *recordingLane) AddAfter(item any, duration time.Duration) {
+	l.after[item] = duration
+}
+
+func (l *recordingLane) AddRateLimited(item any) {
+	l.rateLimited = append(l.rateLimited, item)
+}
+
+func TestCleanupFirstEnqueueAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          any
+		expectedFast bool
+	}{
+		{
+			name: "dispatched Workload",
+			obj:  cleanupTestWorkload("test-workload", false, false),
+		},
+		{
+			name:         "Workload being deleted",
+			obj:          cleanupTestWorkload("test-workload", true, false),
+			expectedFast: true,
+		},
+		{
+			name:         "finished Workload",
+			obj:          cleanupTestWorkload("test-workload", false, true),
+			expectedFast: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fast := map[any]time.Duration{}
+			slow := &recordingLane{after: map[any]time.Duration{}}
+			enqueueAfter := cleanupFirstEnqueueAfter(func(obj any, after time.Duration) { fast[obj] = after }, slow)
+			enqueueAfter(tt.obj, time.Second)
+			if tt.expectedFast {
+				assert.DeepEqual(t, map[any]time.Duration{tt.obj: time.Second}, fast)
+				assert.Equal(t, 0, len(slow.after))
+			} else {
+				assert.DeepEqual(t, map[any]time.Duration{types.NamespacedName{Namespace: "test-namespace", Name: "test-workload"}: time.Second}, slow.after)
+				assert.Equal(t, 0, len(fast))
+			}
+		})
+	}
+}
+
+// reconcileResult is a controller.Reconciler returning err.
+type reconcileResult struct {
+	err error
+}
+
+func (r reconcileResult) Reconcile(context.Context, string) error {
+	return r.err
+}
+
+func TestCleanupFirstReconciler(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(cleanupTestWorkload("syncing", false, false)))
+	assert.NilError(t, indexer.Add(cleanupTestWorkload("deleting", true, false)))
+	cleanup := cleanupKey(kueuev1beta1lister.NewWorkloadLister(indexer))
+	syncing := types.NamespacedName{Namespace: "test-namespace", Name: "syncing"}
+
+	tests := []struct {
+		name                string
+		key                 string
+		err                 error
+		expectedSkip        bool
+		expectedAfter       map[any]time.Duration
+		expectedRateLimited []any
+	}{
+		{
+			name: "synced",
+			key:  "test-namespace/syncing",
+		},
+		{
+			name:                "sync retried in the slow lane",
+			key:                 "test-namespace/syncing",
+			err:                 errTestCall,
+			expectedSkip:        true,
+			expectedRateLimited: []any{syncing},
+		},
+		{
+			name:          "sync requeued in the slow lane",
+			key:           "test-namespace/syncing",
+			err:           controller.NewRequeueAfter(time.Minute),
+			expectedSkip:  true,
+			expectedAfter: map[any]time.Duration{syncing: time.Minute},
+		},
+		{
+			name: "permanent sync failure",
+			key:  "test-namespace/syncing",
+			err:  controller.NewPermanentError(errTestCall),
+		},
+		{
+			name: "cleanup retried in the fast lane",
+			key:  "test-namespace/deleting",
+			err:  errTestCall,
+		},
+		{
+			name: "cleanup requeued in the fast lane",
+			key:  "test-namespace/deleting",
+			err:  controller.NewRequeueAfter(time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &options{rateLimitBaseDelay: time.Millisecond, rateLimitMaxDelay: time.Second, rateLimitQPS: 10, rateLimitBurst: 100, cleanupPriority: true}
+			limiter := o.rateLimiter(cleanup).(*cleanupRateLimiter)
+			slow := &recordingLane{after: map[any]time.Duration{}}
+			r := &cleanupFirstReconciler{Reconciler: reconcileResult{tt.err}, cleanup: cleanup, limiter: limiter, slowLane: slow}
+
+			err := r.Reconcile(context.Background(), tt.key)
+			assert.Equal(t, tt.expectedSkip, controller.IsSkipKey(err))
+			if !tt.expectedSkip {
+				assert.Equal(t, tt.err, err)
+			}
+			if tt.expectedAfter == nil {
+				tt.expectedAfter = map[any]time.Duration{}
+			}
+			assert.DeepEqual(t, tt.expectedAfter, slow.after)
+			assert.DeepEqual(t, tt.expectedRateLimited, slow.rateLimited)
+		})
+	}
+}
+
+func TestCleanupRateLimiterKeepsSlowLaneRetries(t *testing.T) {
+	o := &options{rateLimitBaseDelay: 10 * time.Millisecond, rateLimitMaxDelay: time.Second, rateLimitQPS: 10, rateLimitBurst: 100, cleanupPriority: true}
+	limiter := o.rateLimiter(func(any) bool { return false }).(*cleanupRateLimiter)
+	syncing := types.NamespacedName{Namespace: "test-namespace", Name: "syncing"}
+
+	// The controller forgets the retries moved to the slow lane, their backoff keeps growing
+	assert.Equal(t, 10*time.Millisecond, limiter.When(syncing))
+	limiter.retrying.Store(syncing, struct{}{})
+	limiter.Forget(syncing)
+	assert.Equal(t, 20*time.Millisecond, limiter.When(syncing))
+
+	// Once reconciled, they are forgotten
+	limiter.Forget(syncing)
+	assert.Equal(t, 0, limiter.NumRequeues(syncing))
+}
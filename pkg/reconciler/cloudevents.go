@@ -0,0 +1,178 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// CloudEvent types emitted on the sync lifecycle.
+const (
+	cloudEventSecretSynced     = "dev.tekton.secret-syncer.secret.synced"
+	cloudEventSecretSyncFailed = "dev.tekton.secret-syncer.secret.sync.failed"
+	cloudEventSecretCleaned    = "dev.tekton.secret-syncer.secret.cleaned"
+
+	cloudEventSource = "secret-syncer"
+
+	// cloudEventQueueSize bounds the events waiting to be sent. When the sink can't keep up,
+	// new events are dropped rather than slowing down reconciles.
+	cloudEventQueueSize = 1000
+	cloudEventTimeout   = 5 * time.Second
+)
+
+// cloudEvent is a CloudEvent sent in binary content mode.
+type cloudEvent struct {
+	ID      string
+	Type    string
+	Subject string
+	Time    time.Time
+	Data    cloudEventData
+}
+
+// cloudEventData is the JSON payload of the emitted CloudEvents. As with the audit log, it only
+// holds object references, never secret data.
+type cloudEventData struct {
+	Cluster     string `json:"cluster"`
+	Secret      string `json:"secret"`
+	Workload    string `json:"workload,omitempty"`
+	PipelineRun string `json:"pipelineRun,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	ContentHash string `json:"contentHash,omitempty"`
+	// SpokeUID, SpokeResourceVersion and SpokeIdentity are the auditEvent fields of the same name
+	SpokeUID             string `json:"spokeUID,omitempty"`
+	SpokeResourceVersion string `json:"spokeResourceVersion,omitempty"`
+	SpokeIdentity        string `json:"spokeIdentity,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+// cloudEventSender sends CloudEvents to an HTTP sink, such as a Knative broker URL, from a
+// background goroutine so a slow or unavailable sink never blocks a reconcile.
+type cloudEventSender struct {
+	sink   string
+	client *http.Client
+	logger *zap.SugaredLogger
+	queue  chan cloudEvent
+}
+
+// parseEndpointURL validates the URL of an HTTP endpoint, such as the CloudEvents sink, an empty
+// URL disables the feature using it.
+func parseEndpointURL(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("must be an absolute http or https URL, got %q", value)
+	}
+	return value, nil
+}
+
+func newCloudEventSender(sink string, logger *zap.SugaredLogger) *cloudEventSender {
+	return &cloudEventSender{
+		sink:   sink,
+		client: &http.Client{Timeout: cloudEventTimeout},
+		logger: logger,
+		queue:  make(chan cloudEvent, cloudEventQueueSize),
+	}
+}
+
+// run sends the queued events until the context is done.
+func (s *cloudEventSender) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.send(ctx, event); err != nil {
+				s.logger.Errorf("error sending CloudEvent %s of type %s to %s: %v", event.ID, event.Type, s.sink, err)
+			}
+		}
+	}
+}
+
+// emit queues the CloudEvent matching the sync decision, if any. It is a no-op when CloudEvents
+// are disabled.
+func (s *cloudEventSender) emit(event auditEvent) {
+	if s == nil {
+		return
+	}
+
+	var eventType string
+	switch {
+	case event.Action == auditActionSync && event.Outcome == auditOutcomeSuccess:
+		eventType = cloudEventSecretSynced
+	case event.Action == auditActionSync && event.Outcome == auditOutcomeFailure:
+		eventType = cloudEventSecretSyncFailed
+	case event.Action == auditActionDelete && event.Outcome == auditOutcomeSuccess:
+		eventType = cloudEventSecretCleaned
+	default:
+		return
+	}
+
+	ce := cloudEvent{
+		ID:      string(uuid.NewUUID()),
+		Type:    eventType,
+		Subject: event.Cluster + "/" + event.Secret,
+		Time:    time.Now(),
+		Data: cloudEventData{
+			Cluster:              event.Cluster,
+			Secret:               event.Secret,
+			Workload:             event.Workload,
+			PipelineRun:          event.PipelineRun,
+			Reason:               event.Reason,
+			ContentHash:          event.ContentHash,
+			SpokeUID:             string(event.SpokeUID),
+			SpokeResourceVersion: event.SpokeResourceVersion,
+			SpokeIdentity:        event.SpokeIdentity,
+		},
+	}
+	if event.Error != nil {
+		ce.Data.Error = event.Error.Error()
+	}
+
+	select {
+	case s.queue <- ce:
+	default:
+		s.logger.Errorf("CloudEvent queue is full, dropping %s event for secret %s", ce.Type, ce.Subject)
+	}
+}
+
+// send posts a single CloudEvent in binary content mode.
+func (s *cloudEventSender) send(ctx context.Context, event cloudEvent) error {
+	body, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.sink, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", event.ID)
+	req.Header.Set("Ce-Type", event.Type)
+	req.Header.Set("Ce-Source", cloudEventSource)
+	req.Header.Set("Ce-Subject", event.Subject)
+	req.Header.Set("Ce-Time", event.Time.UTC().Format(time.RFC3339Nano))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink answered %s", resp.Status)
+	}
+	return nil
+}
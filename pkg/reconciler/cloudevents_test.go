@@ -0,0 +1,97 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+)
+
+func TestCloudEventSender(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	payloads := make(chan cloudEventData, 10)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data := cloudEventData{}
+		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- req
+		payloads <- data
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer sink.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := newCloudEventSender(sink.URL, zap.NewNop().Sugar())
+	go sender.run(ctx)
+
+	sender.emit(auditEvent{Action: auditActionSync, Outcome: auditOutcomeUnchanged, Cluster: testClusterName, Secret: "ns/unchanged"})
+	sender.emit(auditEvent{Action: auditActionRetain, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/retained"})
+	sender.emit(auditEvent{
+		Action:      auditActionSync,
+		Outcome:     auditOutcomeSuccess,
+		Cluster:     testClusterName,
+		Secret:      "ns/synced",
+		Workload:    "ns/workload",
+		PipelineRun: "ns/pipelinerun",
+		ContentHash: "sha256:abc",
+	})
+	sender.emit(auditEvent{Action: auditActionSync, Outcome: auditOutcomeFailure, Cluster: testClusterName, Secret: "ns/failed", Error: errors.New("boom")})
+	sender.emit(auditEvent{Action: auditActionDelete, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/cleaned"})
+
+	req, data := <-requests, <-payloads
+	assert.Equal(t, "1.0", req.Header.Get("Ce-Specversion"))
+	assert.Equal(t, cloudEventSecretSynced, req.Header.Get("Ce-Type"))
+	assert.Equal(t, cloudEventSource, req.Header.Get("Ce-Source"))
+	assert.Equal(t, testClusterName+"/ns/synced", req.Header.Get("Ce-Subject"))
+	assert.Assert(t, req.Header.Get("Ce-Id") != "")
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.DeepEqual(t, cloudEventData{
+		Cluster:     testClusterName,
+		Secret:      "ns/synced",
+		Workload:    "ns/workload",
+		PipelineRun: "ns/pipelinerun",
+		ContentHash: "sha256:abc",
+	}, data)
+
+	req, data = <-requests, <-payloads
+	assert.Equal(t, cloudEventSecretSyncFailed, req.Header.Get("Ce-Type"))
+	assert.Equal(t, "boom", data.Error)
+
+	req = <-requests
+	<-payloads
+	assert.Equal(t, cloudEventSecretCleaned, req.Header.Get("Ce-Type"))
+	assert.Equal(t, 0, len(requests), "only synced, failed and cleaned decisions are emitted")
+}
+
+func TestCloudEventSenderDropsWhenFull(t *testing.T) {
+	sender := newCloudEventSender("http://sink.invalid", zap.NewNop().Sugar())
+	sender.queue = make(chan cloudEvent, 1)
+
+	event := auditEvent{Action: auditActionDelete, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/name"}
+	sender.emit(event)
+	sender.emit(event)
+	assert.Equal(t, 1, len(sender.queue))
+
+	var disabled *cloudEventSender
+	disabled.emit(event)
+}
+
+func TestParseEndpointURL(t *testing.T) {
+	for _, value := range []string{"", "http://broker.ns.svc", "https://events.example.com/hook"} {
+		sink, err := parseEndpointURL(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, value, sink)
+	}
+	for _, value := range []string{"broker.ns.svc", "ftp://events.example.com", "http://"} {
+		_, err := parseEndpointURL(value)
+		assert.ErrorContains(t, err, "must be an absolute http or https URL", value)
+	}
+}
@@ -0,0 +1,210 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// spokeClusterConfigTTL is how long the SpokeClusterConfig of a spoke cluster is remembered, so
+// its updates are picked up without reading it on every reconcile.
+const spokeClusterConfigTTL = time.Minute
+
+// spokeClusterConfigGVR is the cluster scoped SpokeClusterConfig CR,
+// config/crd-spokeclusterconfig.yaml, named after the MultiKueueCluster it augments.
+var spokeClusterConfigGVR = schema.GroupVersionResource{Group: syncerGroupName, Version: "v1alpha1", Resource: "spokeclusterconfigs"}
+
+// spokeClusterSettings is the spec of a SpokeClusterConfig, the settings of a spoke cluster
+// overriding the ones of the controller.
+type spokeClusterSettings struct {
+	// ProxyURL is the proxy the spoke API server is reached through.
+	ProxyURL string `json:"proxyURL,omitempty"`
+	// CABundle is the PEM encoded CA the spoke API server certificate is verified with, in place
+	// of the one of the kubeconfig.
+	CABundle string `json:"caBundle,omitempty"`
+	// QPS and Burst rate limit the clients of the spoke cluster, SPOKE_CLIENT_QPS and
+	// SPOKE_CLIENT_BURST when zero.
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	// ExcludedNamespaces are the spoke namespaces no secret is synced to.
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// ConflictPolicy overrides SPOKE_SECRET_CONFLICT_POLICY.
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+	// GitMirrors are the mirror hosts, by git host, the URLs of the synced .gitconfig and
+	// .git-credentials are rewritten to.
+	GitMirrors map[string]string `json:"gitMirrors,omitempty"`
+}
+
+// validate checks the settings of the SpokeClusterConfig name.
+func (s *spokeClusterSettings) validate(name string) error {
+	if s.ProxyURL != "" {
+		if u, err := url.Parse(s.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid SpokeClusterConfig %s: proxyURL %q is not an absolute URL", name, s.ProxyURL)
+		}
+	}
+	if s.CABundle != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(s.CABundle)) {
+		return fmt.Errorf("invalid SpokeClusterConfig %s: caBundle holds no PEM certificate", name)
+	}
+	if s.QPS < 0 || s.Burst < 0 {
+		return fmt.Errorf("invalid SpokeClusterConfig %s: qps and burst must not be negative, got %v/%d", name, s.QPS, s.Burst)
+	}
+	if s.ConflictPolicy != "" {
+		if _, err := parseConflictPolicy(s.ConflictPolicy); err != nil {
+			return fmt.Errorf("invalid SpokeClusterConfig %s: %w", name, err)
+		}
+	}
+	if err := validateGitMirrors(s.GitMirrors); err != nil {
+		return fmt.Errorf("invalid SpokeClusterConfig %s: %w", name, err)
+	}
+	return nil
+}
+
+// spokeClusterConfigs resolves and caches the SpokeClusterConfigs of the spoke clusters.
+type spokeClusterConfigs struct {
+	client dynamic.Interface
+	// now is overridden in tests
+	now func() time.Time
+	// fetching serializes the reads of each SpokeClusterConfig
+	fetching keyedMutex
+
+	mu        sync.Mutex
+	settings  map[string]*spokeClusterSettings
+	fetchedAt map[string]time.Time
+}
+
+func newSpokeClusterConfigs(client dynamic.Interface) *spokeClusterConfigs {
+	return &spokeClusterConfigs{
+		client:    client,
+		now:       time.Now,
+		settings:  map[string]*spokeClusterSettings{},
+		fetchedAt: map[string]time.Time{},
+	}
+}
+
+// get returns the settings of the spoke cluster, nil when it has no SpokeClusterConfig. An
+// invalid SpokeClusterConfig fails until it is fixed, rather than syncing without its settings.
+func (c *spokeClusterConfigs) get(ctx context.Context, clusterName string) (*spokeClusterSettings, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if settings, ok := c.cached(clusterName); ok {
+		return settings, nil
+	}
+	// The reads of a SpokeClusterConfig are serialized, without holding back the other ones
+	unlock, err := c.fetching.lock(ctx, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get SpokeClusterConfig %s: %w", clusterName, err)
+	}
+	defer unlock()
+	if settings, ok := c.cached(clusterName); ok {
+		return settings, nil
+	}
+
+	obj, err := c.client.Resource(spokeClusterConfigGVR).Get(ctx, clusterName, metav1.GetOptions{})
+	var settings *spokeClusterSettings
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("could not get SpokeClusterConfig %s: %w", clusterName, err)
+	default:
+		if settings, err = spokeClusterSettingsFromUnstructured(obj); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settings[clusterName] = settings
+	c.fetchedAt[clusterName] = c.now()
+	return settings, nil
+}
+
+// cached returns the settings of the spoke cluster fetched within spokeClusterConfigTTL.
+func (c *spokeClusterConfigs) cached(clusterName string) (*spokeClusterSettings, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetchedAt, ok := c.fetchedAt[clusterName]
+	if !ok || c.now().Sub(fetchedAt) >= spokeClusterConfigTTL {
+		return nil, false
+	}
+	return c.settings[clusterName], true
+}
+
+// spokeClusterSettingsFromUnstructured converts and validates the spec of a SpokeClusterConfig.
+func spokeClusterSettingsFromUnstructured(obj *unstructured.Unstructured) (*spokeClusterSettings, error) {
+	settings := &spokeClusterSettings{}
+	content, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SpokeClusterConfig %s: %w", obj.GetName(), err)
+	}
+	if ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, settings); err != nil {
+			return nil, fmt.Errorf("invalid SpokeClusterConfig %s: %w", obj.GetName(), err)
+		}
+	}
+	if err := settings.validate(obj.GetName()); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// configureSpoke applies the SpokeClusterConfig of the spoke cluster to its REST config.
+func (r *Reconciler) configureSpoke(ctx context.Context, clusterName string, config *rest.Config) error {
+	settings, err := r.spokeClusterConfigs.get(ctx, clusterName)
+	if err != nil || settings == nil {
+		return err
+	}
+	if settings.ProxyURL != "" {
+		proxyURL, _ := url.Parse(settings.ProxyURL)
+		config.Proxy = http.ProxyURL(proxyURL)
+	}
+	if settings.CABundle != "" {
+		config.TLSClientConfig.CAData = []byte(settings.CABundle)
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.Insecure = false
+	}
+	if settings.QPS > 0 {
+		config.QPS = settings.QPS
+	}
+	if settings.Burst > 0 {
+		config.Burst = settings.Burst
+	}
+	return nil
+}
+
+// spokeNamespaceExcluded reports whether the SpokeClusterConfig of the spoke cluster excludes
+// the namespace from the syncs.
+func (r *Reconciler) spokeNamespaceExcluded(ctx context.Context, clusterName, namespace string) (bool, error) {
+	settings, err := r.spokeClusterConfigs.get(ctx, clusterName)
+	if err != nil || settings == nil {
+		return false, err
+	}
+	return slices.Contains(settings.ExcludedNamespaces, namespace), nil
+}
+
+// clusterConflictPolicy returns the conflict policy of the spoke cluster, the one of its
+// SpokeClusterConfig when set. The SpokeClusterConfig was resolved earlier in the reconcile, a
+// failure to get it again falls back to the policy of the controller.
+func (r *Reconciler) clusterConflictPolicy(ctx context.Context, clusterName string) string {
+	settings, err := r.spokeClusterConfigs.get(ctx, clusterName)
+	if err != nil {
+		r.logger.Warnf("using the default conflict policy for spoke cluster %s: %v", clusterName, err)
+	}
+	if settings != nil && settings.ConflictPolicy != "" {
+		return settings.ConflictPolicy
+	}
+	return r.conflictPolicy
+}
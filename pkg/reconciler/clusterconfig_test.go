@@ -0,0 +1,200 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+func testSpokeClusterConfig(name string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetAPIVersion(spokeClusterConfigGVR.GroupVersion().String())
+	obj.SetKind("SpokeClusterConfig")
+	obj.SetName(name)
+	return obj
+}
+
+func testCABundle(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "spoke-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestSpokeClusterConfigs(t *testing.T) {
+	caBundle := testCABundle(t)
+	tests := []struct {
+		name          string
+		spec          map[string]any
+		expected      *spokeClusterSettings
+		expectedError string
+	}{
+		{
+			name: "no SpokeClusterConfig",
+		},
+		{
+			name: "every setting",
+			spec: map[string]any{
+				"proxyURL":           "http://proxy.example.com:3128",
+				"caBundle":           caBundle,
+				"qps":                int64(5),
+				"burst":              int64(10),
+				"excludedNamespaces": []any{"kube-system"},
+				"conflictPolicy":     "adopt",
+				"gitMirrors":         map[string]any{"github.com": "git-mirror.spoke.internal"},
+			},
+			expected: &spokeClusterSettings{
+				ProxyURL:           "http://proxy.example.com:3128",
+				CABundle:           caBundle,
+				QPS:                5,
+				Burst:              10,
+				ExcludedNamespaces: []string{"kube-system"},
+				ConflictPolicy:     conflictPolicyAdopt,
+				GitMirrors:         map[string]string{"github.com": "git-mirror.spoke.internal"},
+			},
+		},
+		{
+			name:          "relative proxy URL",
+			spec:          map[string]any{"proxyURL": "proxy:3128"},
+			expectedError: `invalid SpokeClusterConfig test-cluster: proxyURL "proxy:3128" is not an absolute URL`,
+		},
+		{
+			name:          "invalid CA bundle",
+			spec:          map[string]any{"caBundle": "not a certificate"},
+			expectedError: "invalid SpokeClusterConfig test-cluster: caBundle holds no PEM certificate",
+		},
+		{
+			name:          "negative rate limit",
+			spec:          map[string]any{"qps": int64(-1)},
+			expectedError: "invalid SpokeClusterConfig test-cluster: qps and burst must not be negative, got -1/0",
+		},
+		{
+			name:          "unsupported conflict policy",
+			spec:          map[string]any{"conflictPolicy": "overwrite"},
+			expectedError: `invalid SpokeClusterConfig test-cluster: unsupported conflict policy "overwrite", must be one of fail, adopt, suffix`,
+		},
+		{
+			name:          "git mirror URL",
+			spec:          map[string]any{"gitMirrors": map[string]any{"github.com": "https://git-mirror.spoke.internal"}},
+			expectedError: `invalid SpokeClusterConfig test-cluster: invalid gitMirrors github.com: https://git-mirror.spoke.internal, "https://git-mirror.spoke.internal" is not a host with an optional port`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.spec != nil {
+				objects = append(objects, testSpokeClusterConfig(testClusterName, tt.spec))
+			}
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{spokeClusterConfigGVR: "SpokeClusterConfigList"}, objects...)
+			settings, err := newSpokeClusterConfigs(client).get(context.Background(), testClusterName)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, settings)
+		})
+	}
+}
+
+func TestSpokeClusterConfigsCache(t *testing.T) {
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{spokeClusterConfigGVR: "SpokeClusterConfigList"})
+	configs := newSpokeClusterConfigs(client)
+	now := time.Now()
+	configs.now = func() time.Time { return now }
+
+	settings, err := configs.get(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, settings == nil)
+
+	_, err = client.Resource(spokeClusterConfigGVR).Create(ctx, testSpokeClusterConfig(testClusterName, map[string]any{"conflictPolicy": "suffix"}), metav1.CreateOptions{})
+	assert.NilError(t, err)
+
+	// The missing SpokeClusterConfig is remembered too
+	settings, err = configs.get(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, settings == nil)
+
+	now = now.Add(spokeClusterConfigTTL)
+	settings, err = configs.get(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Equal(t, conflictPolicySuffix, settings.ConflictPolicy)
+
+	// Without SPOKE_CLUSTER_CONFIG the clusters have no settings
+	settings, err = (*spokeClusterConfigs)(nil).get(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, settings == nil)
+}
+
+func TestSpokeClusterSettingsApplied(t *testing.T) {
+	ctx := context.Background()
+	caBundle := testCABundle(t)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{spokeClusterConfigGVR: "SpokeClusterConfigList"},
+		testSpokeClusterConfig(testClusterName, map[string]any{
+			"proxyURL":           "http://proxy.example.com:3128",
+			"caBundle":           caBundle,
+			"qps":                int64(5),
+			"excludedNamespaces": []any{"kube-system"},
+			"conflictPolicy":     "adopt",
+		}),
+	)
+	r := &Reconciler{
+		logger:              zap.NewNop().Sugar(),
+		conflictPolicy:      conflictPolicyFail,
+		spokeClusterConfigs: newSpokeClusterConfigs(client),
+	}
+
+	config := &rest.Config{Host: "https://spoke.example.com:6443", QPS: 20, Burst: 40, TLSClientConfig: rest.TLSClientConfig{CAFile: "/etc/kubeconfig/ca.crt"}}
+	assert.NilError(t, r.configureSpoke(ctx, testClusterName, config))
+	assert.Equal(t, caBundle, string(config.CAData))
+	assert.Equal(t, "", config.CAFile)
+	assert.Equal(t, float32(5), config.QPS)
+	assert.Equal(t, 40, config.Burst, "an unset burst keeps SPOKE_CLIENT_BURST")
+	proxyURL, err := config.Proxy(&http.Request{})
+	assert.NilError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+	excluded, err := r.spokeNamespaceExcluded(ctx, testClusterName, "kube-system")
+	assert.NilError(t, err)
+	assert.Assert(t, excluded)
+	excluded, err = r.spokeNamespaceExcluded(ctx, testClusterName, "test-namespace")
+	assert.NilError(t, err)
+	assert.Assert(t, !excluded)
+
+	assert.Equal(t, conflictPolicyAdopt, r.clusterConflictPolicy(ctx, testClusterName))
+	assert.Equal(t, conflictPolicyFail, r.clusterConflictPolicy(ctx, "other-cluster"))
+
+	// The other spoke clusters keep the settings of the controller
+	config = &rest.Config{Host: "https://other.example.com:6443", QPS: 20}
+	assert.NilError(t, r.configureSpoke(ctx, "other-cluster", config))
+	assert.Equal(t, float32(20), config.QPS)
+	assert.Assert(t, config.Proxy == nil)
+}
@@ -0,0 +1,153 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// busyRequeueDelay is how long a Workload waits before retrying when its spoke cluster
+	// already has the maximum number of in-flight reconciles.
+	busyRequeueDelay = time.Second
+)
+
+// clusterGuards limits the concurrent reconciles per spoke cluster and trips a circuit breaker
+// for spoke clusters which keep failing, so a slow or flapping spoke API server can't consume
+// all the reconcile workers.
+type clusterGuards struct {
+	// maxConcurrency is the number of concurrent reconciles allowed per cluster, 0 means unlimited
+	maxConcurrency int
+	// failureThreshold is the number of consecutive failures opening the circuit, 0 disables the breaker
+	failureThreshold int
+	// openDuration is how long the circuit stays open before a trial request is let through
+	openDuration time.Duration
+	// now is overridden in tests
+	now func() time.Time
+
+	mu     sync.Mutex
+	guards map[string]*clusterGuard
+}
+
+// clusterGuard is the state kept for a single spoke cluster.
+type clusterGuard struct {
+	inFlight chan struct{}
+
+	consecutiveFailures int
+	openUntil           time.Time
+	// trial is set while the single request allowed through a half-open circuit is in flight
+	trial bool
+}
+
+func newClusterGuards(maxConcurrency, failureThreshold int, openDuration time.Duration) *clusterGuards {
+	return &clusterGuards{
+		maxConcurrency:   maxConcurrency,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+		guards:           map[string]*clusterGuard{},
+	}
+}
+
+func (c *clusterGuards) get(cluster string) *clusterGuard {
+	g, ok := c.guards[cluster]
+	if !ok {
+		g = &clusterGuard{}
+		if c.maxConcurrency > 0 {
+			g.inFlight = make(chan struct{}, c.maxConcurrency)
+		}
+		c.guards[cluster] = g
+	}
+	return g
+}
+
+// acquire reserves a reconcile slot for the cluster. When the circuit is open or all slots are
+// taken it returns false and how long to wait before retrying, otherwise the returned function
+// must be called to release the slot.
+func (c *clusterGuards) acquire(cluster string) (func(), time.Duration, bool) {
+	if c == nil {
+		return func() {}, 0, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g := c.get(cluster)
+	trial := false
+	if c.failureThreshold > 0 && g.consecutiveFailures >= c.failureThreshold {
+		if remaining := g.openUntil.Sub(c.now()); remaining > 0 {
+			return nil, wait.Jitter(remaining, 0.1), false
+		}
+		// Half-open, let a single trial request through
+		if g.trial {
+			return nil, wait.Jitter(busyRequeueDelay, 1.0), false
+		}
+		trial = true
+	}
+
+	if g.inFlight != nil {
+		select {
+		case g.inFlight <- struct{}{}:
+		default:
+			return nil, wait.Jitter(busyRequeueDelay, 1.0), false
+		}
+	}
+	g.trial = g.trial || trial
+
+	release := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if trial {
+			g.trial = false
+		}
+		if g.inFlight != nil {
+			<-g.inFlight
+		}
+	}
+	return release, 0, true
+}
+
+// record tracks the outcome of a call to the spoke cluster and updates the cluster health gauge.
+// Only errors hinting at an unavailable spoke count as failures.
+func (c *clusterGuards) record(ctx context.Context, cluster string, err error) {
+	if c == nil || c.failureThreshold == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	g := c.get(cluster)
+	wasHealthy := g.consecutiveFailures < c.failureThreshold
+	if isSpokeUnavailable(err) {
+		g.consecutiveFailures++
+		if g.consecutiveFailures >= c.failureThreshold {
+			g.openUntil = c.now().Add(c.openDuration)
+		}
+	} else {
+		g.consecutiveFailures = 0
+	}
+	healthy := g.consecutiveFailures < c.failureThreshold
+	c.mu.Unlock()
+
+	if wasHealthy != healthy || err == nil {
+		recordClusterHealth(ctx, cluster, healthy)
+	}
+}
+
+// isSpokeUnavailable reports whether the error means the spoke API server couldn't serve the
+// request, as opposed to a regular answer such as NotFound or Forbidden.
+func isSpokeUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status errors.APIStatus
+	if !stderrors.As(err, &status) {
+		// Transport level failures (connection refused, TLS, deadlines) aren't API statuses
+		return true
+	}
+	return errors.IsServerTimeout(err) || errors.IsTimeout(err) || errors.IsTooManyRequests(err) ||
+		errors.IsInternalError(err) || errors.IsServiceUnavailable(err) || errors.IsUnexpectedServerError(err)
+}
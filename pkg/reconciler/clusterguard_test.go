@@ -0,0 +1,110 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClusterGuardsConcurrency(t *testing.T) {
+	guards := newClusterGuards(2, 0, 0)
+
+	release1, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok)
+	release2, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok)
+
+	_, retryAfter, ok := guards.acquire("cluster-1")
+	assert.Assert(t, !ok, "third reconcile must be rejected")
+	assert.Assert(t, retryAfter >= busyRequeueDelay)
+
+	// Other clusters have their own slots
+	release3, _, ok := guards.acquire("cluster-2")
+	assert.Assert(t, ok)
+	release3()
+
+	release1()
+	release4, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok, "released slot must be reusable")
+	release2()
+	release4()
+}
+
+func TestClusterGuardsCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guards := newClusterGuards(0, 2, time.Minute)
+	guards.now = func() time.Time { return now }
+	unavailable := errors.NewServiceUnavailable("spoke is down")
+
+	guards.record(ctx, "cluster-1", unavailable)
+	_, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok, "circuit must stay closed below the threshold")
+
+	guards.record(ctx, "cluster-1", unavailable)
+	_, retryAfter, ok := guards.acquire("cluster-1")
+	assert.Assert(t, !ok, "circuit must open at the threshold")
+	assert.Assert(t, retryAfter >= time.Minute)
+
+	// Half-open: a single trial goes through
+	now = now.Add(time.Minute + time.Second)
+	release, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok, "trial request must go through")
+	_, _, ok = guards.acquire("cluster-1")
+	assert.Assert(t, !ok, "only one trial request is allowed")
+
+	// Failing trial opens the circuit again
+	guards.record(ctx, "cluster-1", unavailable)
+	release()
+	_, _, ok = guards.acquire("cluster-1")
+	assert.Assert(t, !ok, "failed trial must reopen the circuit")
+
+	// Successful trial closes the circuit
+	now = now.Add(time.Minute + time.Second)
+	release, _, ok = guards.acquire("cluster-1")
+	assert.Assert(t, ok)
+	guards.record(ctx, "cluster-1", nil)
+	release()
+	for range 3 {
+		release, _, ok := guards.acquire("cluster-1")
+		assert.Assert(t, ok, "circuit must be closed after a successful trial")
+		release()
+	}
+}
+
+func TestNilClusterGuards(t *testing.T) {
+	var guards *clusterGuards
+	release, _, ok := guards.acquire("cluster-1")
+	assert.Assert(t, ok)
+	release()
+	guards.record(context.Background(), "cluster-1", fmt.Errorf("connection refused"))
+}
+
+func TestIsSpokeUnavailable(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "no error", err: nil, expected: false},
+		{name: "transport error", err: fmt.Errorf("dial tcp: connection refused"), expected: true},
+		{name: "service unavailable", err: errors.NewServiceUnavailable("down"), expected: true},
+		{name: "wrapped timeout", err: fmt.Errorf("wrapped: %w", errors.NewTimeoutError("slow", 1)), expected: true},
+		{name: "too many requests", err: errors.NewTooManyRequests("slow down", 1), expected: true},
+		{name: "not found", err: errors.NewNotFound(resource, "name"), expected: false},
+		{name: "forbidden", err: errors.NewForbidden(resource, "name", fmt.Errorf("no")), expected: false},
+		{name: "already exists", err: errors.NewAlreadyExists(resource, "name"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isSpokeUnavailable(tt.err))
+		})
+	}
+}
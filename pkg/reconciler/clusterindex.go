@@ -0,0 +1,64 @@
+package reconciler
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// clusterNameIndex indexes the cached Workloads by the spoke cluster they were dispatched to.
+const clusterNameIndex = "clusterName"
+
+// clusterNameIndexFunc returns the status.clusterName of a dispatched Workload the filter owns.
+func (f workloadQueueFilter) clusterNameIndexFunc(obj any) ([]string, error) {
+	workload, ok := obj.(*kueuev1beta1.Workload)
+	if !ok || !f.owned(workload) {
+		return nil, nil
+	}
+	if clusterName := ptr.Deref(workload.Status.ClusterName, ""); clusterName != "" {
+		return []string{clusterName}, nil
+	}
+	return nil, nil
+}
+
+// clusterWorkloads finds the Workloads dispatched to a spoke cluster through the
+// clusterNameIndex of the Workload informers, without listing every cached Workload. A nil
+// clusterWorkloads finds none.
+type clusterWorkloads struct {
+	indexers []cache.Indexer
+}
+
+// indexWorkloadsByCluster adds the clusterNameIndex to the Workload informers.
+func indexWorkloadsByCluster(informers []cache.SharedIndexInformer, queues workloadQueueFilter) (*clusterWorkloads, error) {
+	c := &clusterWorkloads{}
+	for _, informer := range informers {
+		if err := informer.AddIndexers(cache.Indexers{clusterNameIndex: queues.clusterNameIndexFunc}); err != nil {
+			return nil, fmt.Errorf("could not index the Workloads by cluster name: %w", err)
+		}
+		c.indexers = append(c.indexers, informer.GetIndexer())
+	}
+	return c, nil
+}
+
+// of returns the Workloads dispatched to the spoke cluster.
+func (c *clusterWorkloads) of(clusterName string) []types.NamespacedName {
+	if c == nil {
+		return nil
+	}
+	var keys []types.NamespacedName
+	for _, indexer := range c.indexers {
+		workloads, err := indexer.ByIndex(clusterNameIndex, clusterName)
+		if err != nil {
+			continue
+		}
+		for _, obj := range workloads {
+			if workload, ok := obj.(*kueuev1beta1.Workload); ok {
+				keys = append(keys, types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()})
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package reconciler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueueinformers "sigs.k8s.io/kueue/client-go/informers/externalversions"
+)
+
+func TestClusterNameIndexFunc(t *testing.T) {
+	dispatched := pipelineRunOwnedWorkload("test-namespace", "test-workload")
+	dispatched.Status.ClusterName = ptr.To(testClusterName)
+	notOwned := dispatched.DeepCopy()
+	notOwned.OwnerReferences = nil
+
+	tests := []struct {
+		name     string
+		obj      any
+		expected []string
+	}{
+		{name: "dispatched workload", obj: dispatched, expected: []string{testClusterName}},
+		{name: "pending workload", obj: pipelineRunOwnedWorkload("test-namespace", "test-workload")},
+		{name: "not owned by a PipelineRun", obj: notOwned},
+		{name: "not a workload", obj: "test-namespace/test-workload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := workloadQueueFilter{}.clusterNameIndexFunc(tt.obj)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, keys)
+		})
+	}
+}
+
+func TestClusterWorkloads(t *testing.T) {
+	informers := []cache.SharedIndexInformer{
+		kueueinformers.NewSharedInformerFactory(kueuefake.NewSimpleClientset(), 0).Kueue().V1beta1().Workloads().Informer(),
+		kueueinformers.NewSharedInformerFactoryWithOptions(kueuefake.NewSimpleClientset(), 0, kueueinformers.WithNamespace("team-a")).Kueue().V1beta1().Workloads().Informer(),
+	}
+	workloads, err := indexWorkloadsByCluster(informers, workloadQueueFilter{})
+	assert.NilError(t, err)
+
+	dispatch := func(workload *kueuev1beta1.Workload, clusterName string) *kueuev1beta1.Workload {
+		workload.Status.ClusterName = ptr.To(clusterName)
+		return workload
+	}
+	assert.NilError(t, informers[0].GetIndexer().Add(dispatch(pipelineRunOwnedWorkload("test-namespace", "workload-1"), testClusterName)))
+	assert.NilError(t, informers[0].GetIndexer().Add(dispatch(pipelineRunOwnedWorkload("test-namespace", "workload-2"), "other-cluster")))
+	assert.NilError(t, informers[1].GetIndexer().Add(dispatch(pipelineRunOwnedWorkload("team-a", "workload-3"), testClusterName)))
+
+	// The Workloads of every informer are found
+	assert.DeepEqual(t, []types.NamespacedName{
+		{Namespace: "test-namespace", Name: "workload-1"},
+		{Namespace: "team-a", Name: "workload-3"},
+	}, workloads.of(testClusterName))
+	assert.Assert(t, workloads.of("unknown-cluster") == nil)
+	assert.Assert(t, (*clusterWorkloads)(nil).of(testClusterName) == nil)
+}
@@ -0,0 +1,73 @@
+package reconciler
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// invalidSpokeConfigReason is the reason of the events recorded on the MultiKueueClusters whose
+// kubeconfig can't be resolved.
+const invalidSpokeConfigReason = "InvalidSpokeConfig"
+
+// validateSpokeConfigs resolves, concurrently and on startup, the kubeconfig of every
+// MultiKueueCluster: its Secret exists, holds the kubeconfig key and parses, and a context is
+// selected for the cluster. Nothing is sent to the spoke clusters. Each cluster gets its
+// spoke_cluster_config_valid gauge, and a warning event when invalid, so misconfigured clusters
+// are visible before a Workload is dispatched to them. It returns the number of invalid clusters.
+func (r *Reconciler) validateSpokeConfigs(ctx context.Context) int {
+	clusters, err := r.multiKueueClusters(ctx)
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters to validate their kubeconfigs: %v", err)
+		return 0
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		invalid int
+	)
+	for _, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.spokeSyncer().SpokeConfig(ctx, cluster.Name)
+			recordClusterConfigValid(ctx, cluster.Name, err == nil)
+			if err == nil {
+				return
+			}
+			r.logger.Errorf("invalid kubeconfig for MultiKueueCluster %s: %v", cluster.Name, err)
+			if r.recorder != nil {
+				r.recorder.Eventf(cluster, corev1.EventTypeWarning, invalidSpokeConfigReason, "No secret can be synced to the spoke cluster: %v", err)
+			}
+			mu.Lock()
+			invalid++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	r.logger.Infof("validated the kubeconfigs of %d MultiKueueClusters, %d invalid", len(clusters), invalid)
+	return invalid
+}
+
+// multiKueueClusters returns the MultiKueueClusters, from the cache when there is one.
+func (r *Reconciler) multiKueueClusters(ctx context.Context) ([]*kueuev1beta1.MultiKueueCluster, error) {
+	if r.multiKueueClusterLister != nil {
+		return r.multiKueueClusterLister.List(labels.Everything())
+	}
+
+	list, err := r.kueueClient.KueueV1beta1().MultiKueueClusters().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]*kueuev1beta1.MultiKueueCluster, 0, len(list.Items))
+	for i := range list.Items {
+		clusters = append(clusters, &list.Items[i])
+	}
+	return clusters, nil
+}
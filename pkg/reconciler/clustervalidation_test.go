@@ -0,0 +1,111 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/metrics"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func testKubeconfigCluster(name, secretName string) *kueuev1beta1.MultiKueueCluster {
+	return &kueuev1beta1.MultiKueueCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: kueuev1beta1.MultiKueueClusterSpec{
+			KubeConfig: kueuev1beta1.KubeConfig{LocationType: kueuev1beta1.SecretLocationType, Location: secretName},
+		},
+	}
+}
+
+func testKubeconfigSecret(name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testKueueNamespace}, Data: data}
+}
+
+func TestValidateSpokeConfigs(t *testing.T) {
+	metrics.InitForTesting()
+	tests := []struct {
+		name          string
+		cluster       *kueuev1beta1.MultiKueueCluster
+		secrets       []runtime.Object
+		expectedEvent string
+	}{
+		{
+			name:    "valid kubeconfig",
+			cluster: testKubeconfigCluster(testClusterName, testSecretName),
+			secrets: []runtime.Object{testKubeconfigSecret(testSecretName, map[string][]byte{"kubeconfig": validKubeConfigData()})},
+		},
+		{
+			name:          "missing secret",
+			cluster:       testKubeconfigCluster(testClusterName, testSecretName),
+			expectedEvent: "Warning InvalidSpokeConfig No secret can be synced to the spoke cluster: could not get kubeconfig secret kueue-system/test-kubeconfig-secret",
+		},
+		{
+			name:          "missing kubeconfig key",
+			cluster:       testKubeconfigCluster(testClusterName, testSecretName),
+			secrets:       []runtime.Object{testKubeconfigSecret(testSecretName, map[string][]byte{"config": validKubeConfigData()})},
+			expectedEvent: "Warning InvalidSpokeConfig No secret can be synced to the spoke cluster: kubeconfig secret kueue-system/test-kubeconfig-secret is missing 'kubeconfig' data key",
+		},
+		{
+			name:          "unparseable kubeconfig",
+			cluster:       testKubeconfigCluster(testClusterName, testSecretName),
+			secrets:       []runtime.Object{testKubeconfigSecret(testSecretName, map[string][]byte{"kubeconfig": []byte("{not yaml")})},
+			expectedEvent: "Warning InvalidSpokeConfig No secret can be synced to the spoke cluster: could not load kubeconfig secret kueue-system/test-kubeconfig-secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &Reconciler{
+				logger:         zap.NewNop().Sugar(),
+				hubKubeClient:  fake.NewSimpleClientset(tt.secrets...),
+				kueueClient:    kueuefake.NewSimpleClientset(tt.cluster),
+				kueueNamespace: testKueueNamespace,
+				recorder:       recorder,
+			}
+
+			invalid := r.validateSpokeConfigs(context.Background())
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if tt.expectedEvent == "" {
+				assert.Equal(t, 0, invalid)
+				assert.Equal(t, 0, len(events), "%v", events)
+				return
+			}
+			assert.Equal(t, 1, invalid)
+			assert.Equal(t, 1, len(events), "%v", events)
+			assert.Assert(t, strings.HasPrefix(events[0], tt.expectedEvent), events[0])
+		})
+	}
+}
+
+func TestValidateSpokeConfigsConcurrently(t *testing.T) {
+	metrics.InitForTesting()
+	secret := testKubeconfigSecret(testSecretName, map[string][]byte{"kubeconfig": validKubeConfigData()})
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(secret),
+		kueueClient: kueuefake.NewSimpleClientset(
+			testKubeconfigCluster("cluster-1", testSecretName),
+			testKubeconfigCluster("cluster-2", "missing-secret"),
+			testKubeconfigCluster("cluster-3", testSecretName),
+			testKubeconfigCluster("cluster-4", "missing-secret"),
+		),
+		kueueNamespace: testKueueNamespace,
+	}
+
+	// Without a recorder the invalid clusters are still counted
+	assert.Equal(t, 2, r.validateSpokeConfigs(context.Background()))
+}
@@ -0,0 +1,85 @@
+package reconciler
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// workloadEventCoalescer rate limits the enqueues of the updates of each Workload. The first
+// update is enqueued right away, the next ones within the window are delayed to its end, where
+// the workqueue folds them into a single reconcile, so a Workload is reconciled at most once per
+// window: Kueue updating its status several times while dispatching it then reconciles it twice
+// rather than once per update.
+type workloadEventCoalescer struct {
+	window       time.Duration
+	enqueue      func(any)
+	enqueueAfter func(any, time.Duration)
+	// now is overridden in tests
+	now func() time.Time
+
+	mu sync.Mutex
+	// enqueued is when the last update of each Workload was, or is to be, enqueued, by
+	// namespace/name
+	enqueued map[string]time.Time
+	swept    time.Time
+}
+
+// workloadUpdateEnqueue returns the enqueue of the Workload updates, coalesced within window. A
+// window of 0 enqueues every update right away.
+func workloadUpdateEnqueue(window time.Duration, enqueue func(any), enqueueAfter func(any, time.Duration)) func(any) {
+	if window <= 0 {
+		return enqueue
+	}
+	c := &workloadEventCoalescer{
+		window:       window,
+		enqueue:      enqueue,
+		enqueueAfter: enqueueAfter,
+		now:          time.Now,
+		enqueued:     map[string]time.Time{},
+	}
+	return c.enqueueUpdate
+}
+
+// enqueueUpdate enqueues the updated Workload, at the end of the window of its last enqueued
+// update when it is still open.
+func (c *workloadEventCoalescer) enqueueUpdate(obj any) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.enqueue(obj)
+		return
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	c.sweep(now)
+	if last, ok := c.enqueued[key]; ok && now.Sub(last) < c.window {
+		// An enqueue is already scheduled at the end of the window, or is now
+		at := last
+		if !last.After(now) {
+			at = last.Add(c.window)
+			c.enqueued[key] = at
+		}
+		c.mu.Unlock()
+		// The delaying queue keeps each key once, the updates of the window share this enqueue
+		c.enqueueAfter(obj, at.Sub(now))
+		return
+	}
+	c.enqueued[key] = now
+	c.mu.Unlock()
+	c.enqueue(obj)
+}
+
+// sweep forgets the Workloads whose window closed, at most once per window.
+func (c *workloadEventCoalescer) sweep(now time.Time) {
+	if now.Sub(c.swept) < c.window {
+		return
+	}
+	for key, last := range c.enqueued {
+		if now.Sub(last) >= c.window {
+			delete(c.enqueued, key)
+		}
+	}
+	c.swept = now
+}
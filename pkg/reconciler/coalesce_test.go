@@ -0,0 +1,55 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestWorkloadEventCoalescer(t *testing.T) {
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	other := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "other-workload", Namespace: "test-namespace"}}
+
+	// The enqueues are recorded by the delay they are made with, -1 for the immediate ones
+	var delays []time.Duration
+	now := time.Now()
+	c := &workloadEventCoalescer{
+		window:       time.Second,
+		enqueue:      func(any) { delays = append(delays, -1) },
+		enqueueAfter: func(_ any, delay time.Duration) { delays = append(delays, delay) },
+		now:          func() time.Time { return now },
+		enqueued:     map[string]time.Time{},
+	}
+	start := now
+	at := func(offset time.Duration, obj any) {
+		now = start.Add(offset)
+		c.enqueueUpdate(obj)
+	}
+
+	at(0, workload)
+	at(200*time.Millisecond, workload)
+	at(500*time.Millisecond, workload)
+	at(500*time.Millisecond, other)
+	assert.DeepEqual(t, []time.Duration{-1, 800 * time.Millisecond, 500 * time.Millisecond, -1}, delays)
+
+	// The enqueue delayed to 1s opens the next window, until 2s
+	delays = nil
+	at(1200*time.Millisecond, workload)
+	assert.DeepEqual(t, []time.Duration{800 * time.Millisecond}, delays)
+
+	delays = nil
+	at(3*time.Second, workload)
+	assert.DeepEqual(t, []time.Duration{-1}, delays)
+	assert.Equal(t, 1, len(c.enqueued), "the closed window of the other Workload is forgotten")
+}
+
+func TestWorkloadUpdateEnqueueDisabled(t *testing.T) {
+	var enqueued int
+	enqueue := workloadUpdateEnqueue(0, func(any) { enqueued++ }, func(any, time.Duration) { t.Fatal("enqueued after a delay") })
+	enqueue(&kueuev1beta1.Workload{})
+	enqueue(&kueuev1beta1.Workload{})
+	assert.Equal(t, 2, enqueued)
+}
@@ -0,0 +1,176 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tektonversioned2 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/redact"
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	completionControllerName = "spoke-completion-watcher"
+
+	// defaultCompletionCheckInterval is how often the spoke PipelineRuns of the dispatched
+	// Workloads are checked for completion.
+	defaultCompletionCheckInterval = 30 * time.Second
+)
+
+// completionWatcher is the reconciler of the second controller, which checks the spoke
+// PipelineRuns of the dispatched Workloads every interval and runs the cleanup of their secrets as
+// soon as they are done. The Finished condition of the Workloads, which Kueue reports on the hub,
+// triggers the release of the hub secrets, so the watcher only runs for the ephemeral secret
+// sources, whose spoke copies are named by the spoke PipelineRun. It shares the Reconciler of the
+// Workload controller, set up by the Workload controller constructor.
+type completionWatcher struct {
+	// name is the name of its workqueue, logger the one of the ControllerOptions, nil for the
+	// logger of the context
+	name      string
+	logger    *zap.SugaredLogger
+	r         *Reconciler
+	interval  time.Duration
+	informers []cache.SharedIndexInformer
+}
+
+var _ controller.Reconciler = (*completionWatcher)(nil)
+
+// newCompletionController creates the spoke completion watcher controller, it must be constructed
+// after the Workload controller it shares the Reconciler of.
+func newCompletionController(w *completionWatcher) func(context.Context, configmap.Watcher) *controller.Impl {
+	return func(ctx context.Context, _ configmap.Watcher) *controller.Impl {
+		logger := redact.Logger(controllerLogger(ctx, w.logger))
+		ctx = logging.WithLogger(ctx, logger)
+		if w.r == nil {
+			logger.Fatal("The spoke completion watcher must be constructed after the Workload controller")
+		}
+
+		impl := controller.NewContext(ctx, w, controller.ControllerOptions{
+			Logger:        logger,
+			WorkQueueName: w.name,
+		})
+		// The hub can't reach the spoke clusters of the pull mode, and the Finished condition of
+		// the Workloads is enough to release the hub secrets
+		if w.interval <= 0 || w.r.spokeSecretMode == spokeSecretModePull || !w.r.source().ephemeral() {
+			logger.Info("The spoke completion watcher is disabled")
+			return impl
+		}
+
+		logger.Infof("Checking the spoke PipelineRuns of the dispatched Workloads for completion every %s", w.interval)
+		for _, informer := range w.informers {
+			if _, err := informer.AddEventHandler(workloadEventHandler(w.r.queues, impl.Enqueue, impl.Enqueue)); err != nil {
+				logger.Panicf("Couldn't register Workload informer event handler: %v", err)
+			}
+		}
+		return impl
+	}
+}
+
+// Reconcile checks the spoke PipelineRun of a Workload, requeuing it every interval until the
+// PipelineRun is done. The Workloads of the buckets other replicas lead are requeued too, so the
+// replica taking over a bucket tracks them without waiting for a Workload event.
+func (w *completionWatcher) Reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		w.r.logger.Errorf("invalid Workload key %q: %v", key, err)
+		return nil
+	}
+	workload, err := pipelineRunWorkloadLister{w.r.workloadLister, w.r.queues}.Workloads(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Deleted Workloads are cleaned up by the finalizer, inactive ones don't run on the spoke and
+	// the completion of finished ones reached the hub already
+	if !workload.GetDeletionTimestamp().IsZero() || !ptr.Deref(workload.Spec.Active, true) ||
+		meta.IsStatusConditionTrue(workload.Status.Conditions, kueuev1beta1.WorkloadFinished) {
+		return nil
+	}
+	owner, err := w.r.pipelineRunOwner(ctx, workload)
+	if err != nil {
+		return err
+	}
+	if owner == nil || owner.Kind != "PipelineRun" {
+		return nil
+	}
+	clusterName := ptr.Deref(workload.Status.ClusterName, "")
+	if clusterName == "" || !w.r.isLeaderFor(types.NamespacedName{Namespace: namespace, Name: name}) {
+		return controller.NewRequeueAfter(w.interval)
+	}
+
+	release, retryAfter, ok := w.r.clusterGuards.acquire(clusterName)
+	if !ok {
+		return controller.NewRequeueAfter(max(retryAfter, w.interval))
+	}
+	defer release()
+
+	spokeKubeClient, spokeTektonClient, err := w.r.getSpokeClients(ctx, clusterName)
+	if err != nil {
+		w.r.logger.Errorf("error creating spoke clients for workload %s: %v", key, err)
+		return err
+	}
+	conditions := &syncConditions{}
+	done, err := w.r.checkCompletion(withSyncConditions(ctx, conditions), workload, owner.Name, spokeKubeClient, spokeTektonClient)
+	w.r.reportSyncConditions(ctx, workload, conditions)
+	if err != nil || done {
+		return err
+	}
+	return controller.NewRequeueAfter(w.interval)
+}
+
+// checkCompletion runs the cleanup of the Workload when its spoke PipelineRun is done past the
+// grace period of the done policy, and reports whether it was.
+func (r *Reconciler) checkCompletion(ctx context.Context, workload *kueuev1beta1.Workload, pipelineRunName string, spokeKubeClient kubernetes.Interface, spokeTektonClient tektonversioned2.Interface) (bool, error) {
+	clusterName := *workload.Status.ClusterName
+
+	spokeCtx, cancel := r.spokeContext(ctx)
+	pipelineRun, err := r.getSpokePipelineRun(spokeCtx, clusterName, spokeTektonClient, syncer.SpokeNamespace(workload), pipelineRunName)
+	cancel()
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err != nil {
+		r.logger.Errorf("error getting PipelineRun %s/%s on spoke cluster %s: %v", syncer.SpokeNamespace(workload), pipelineRunName, clusterName, err)
+		return false, err
+	}
+	if pipelineRun == nil {
+		return false, nil
+	}
+	if terminal, _ := r.done.terminal(pipelineRun, time.Now()); !terminal {
+		return false, nil
+	}
+
+	r.logger.Infof("PipelineRun %s/%s is done on spoke cluster %s, cleaning up the secrets of workload %s/%s", pipelineRun.GetNamespace(), pipelineRun.GetName(), clusterName, workload.GetNamespace(), workload.GetName())
+	return true, r.pipelineRunDone(ctx, workload, spokeKubeClient, hubPipelineRun(pipelineRun, workload))
+}
+
+// workloadFinished releases the hub secrets synced for the Workload once Kueue reports it
+// finished, the hub then knows the spoke PipelineRun is done without reading it.
+func (r *Reconciler) workloadFinished(ctx context.Context, workload *kueuev1beta1.Workload) error {
+	r.retryBudgets.clear(workload.GetNamespace() + "/" + workload.GetName())
+	r.pipelineRunPolls.clear(workload.GetNamespace() + "/" + workload.GetName())
+	for _, ref := range syncedSecretRefs(workload) {
+		if err := r.releaseHubSecret(ctx, workload, ref.hubSecretName()); err != nil {
+			r.logger.Errorf("error releasing secret %s/%s of finished workload %s/%s: %v", workload.GetNamespace(), ref.hubSecretName(), workload.GetNamespace(), workload.GetName(), err)
+			syncConditionsFrom(ctx).cleanedUp(workloadFinishedReason, "", err)
+			return err
+		}
+	}
+	syncConditionsFrom(ctx).cleanedUp(workloadFinishedReason, fmt.Sprintf("workload %s/%s is finished", workload.GetNamespace(), workload.GetName()), nil)
+	return nil
+}
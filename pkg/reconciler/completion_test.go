@@ -0,0 +1,192 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func dispatchedWorkload(modify func(*kueuev1beta1.Workload)) *kueuev1beta1.Workload {
+	workload := pipelineRunOwnedWorkload("test-namespace", "test-workload")
+	workload.OwnerReferences[0].Controller = ptr.To(true)
+	workload.Status.ClusterName = ptr.To(testClusterName)
+	if modify != nil {
+		modify(workload)
+	}
+	return workload
+}
+
+func TestCheckCompletion(t *testing.T) {
+	tests := []struct {
+		name               string
+		pipelineRun        *v1.PipelineRun
+		isPrDone           bool
+		expectedDone       bool
+		expectedFinalizers []string
+	}{
+		{
+			name:               "not created yet",
+			expectedFinalizers: []string{hubSecretFinalizer},
+		},
+		{
+			name: "running",
+			pipelineRun: &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", Annotations: map[string]string{gitAuthSecret: "git-auth"}},
+			},
+			expectedFinalizers: []string{hubSecretFinalizer},
+		},
+		{
+			name: "done",
+			pipelineRun: &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", Annotations: map[string]string{gitAuthSecret: "git-auth"}},
+			},
+			isPrDone:           true,
+			expectedDone:       true,
+			expectedFinalizers: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hubKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace", Finalizers: []string{hubSecretFinalizer}},
+			})
+			spokeTektonClient := tektonfake.NewSimpleClientset()
+			if tt.pipelineRun != nil && tt.isPrDone {
+				tt.pipelineRun.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue})
+			}
+			if tt.pipelineRun != nil {
+				spokeTektonClient = tektonfake.NewSimpleClientset(tt.pipelineRun)
+			}
+			r := &Reconciler{
+				logger:         zap.NewNop().Sugar(),
+				hubKubeClient:  hubKubeClient,
+				workloadLister: kueuev1beta1lister.NewWorkloadLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			}
+
+			done, err := r.checkCompletion(ctx, dispatchedWorkload(nil), "test-pipeline-run", fake.NewSimpleClientset(), spokeTektonClient)
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedDone, done)
+
+			secret, err := hubKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedFinalizers, secret.Finalizers)
+		})
+	}
+}
+
+func TestReconcileFinishedWorkload(t *testing.T) {
+	tests := []struct {
+		name      string
+		spokeName string
+	}{
+		{name: "synced under its name", spokeName: "git-auth"},
+		{name: "synced with the conflict suffix", spokeName: "git-auth" + conflictSecretSuffix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hubKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace", Finalizers: []string{hubSecretFinalizer}},
+			})
+			// No spoke cluster is configured, the hub secret is released without reaching it
+			r := &Reconciler{
+				logger:         zap.NewNop().Sugar(),
+				hubKubeClient:  hubKubeClient,
+				workloadLister: kueuev1beta1lister.NewWorkloadLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			}
+			workload := dispatchedWorkload(func(workload *kueuev1beta1.Workload) {
+				workload.Annotations = map[string]string{syncedSecretsAnnotation: testClusterName + "/test-namespace/" + tt.spokeName}
+				workload.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue}}
+			})
+
+			assert.NilError(t, r.reconcile(ctx, workload))
+			secret, err := hubKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, []string{}, secret.Finalizers)
+		})
+	}
+}
+
+func TestCompletionWatcherReconcile(t *testing.T) {
+	tests := []struct {
+		name            string
+		workload        *kueuev1beta1.Workload
+		leader          bool
+		expectedRequeue bool
+	}{
+		{
+			name:     "not found",
+			workload: nil,
+			leader:   true,
+		},
+		{
+			name:            "not dispatched yet",
+			workload:        dispatchedWorkload(func(w *kueuev1beta1.Workload) { w.Status.ClusterName = nil }),
+			leader:          true,
+			expectedRequeue: true,
+		},
+		{
+			name:            "bucket led by another replica",
+			workload:        dispatchedWorkload(nil),
+			expectedRequeue: true,
+		},
+		{
+			name:     "inactive",
+			workload: dispatchedWorkload(func(w *kueuev1beta1.Workload) { w.Spec.Active = ptr.To(false) }),
+			leader:   true,
+		},
+		{
+			name: "finished",
+			workload: dispatchedWorkload(func(w *kueuev1beta1.Workload) {
+				w.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue}}
+			}),
+			leader: true,
+		},
+		{
+			name:     "not controlled by a PipelineRun",
+			workload: pipelineRunOwnedWorkload("test-namespace", "test-workload"),
+			leader:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.workload != nil {
+				assert.NilError(t, indexer.Add(tt.workload))
+			}
+			r := &Reconciler{logger: zap.NewNop().Sugar(), workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer)}
+			if tt.leader {
+				r.leader = leaderFor(t, reconciler.UniversalBucket())
+			}
+			w := &completionWatcher{r: r, interval: time.Minute}
+
+			err := w.Reconcile(context.Background(), "test-namespace/test-workload")
+			if !tt.expectedRequeue {
+				assert.NilError(t, err)
+				return
+			}
+			ok, delay := controller.IsRequeueKey(err)
+			assert.Assert(t, ok, "expected a requeue, got %v", err)
+			assert.Equal(t, time.Minute, delay)
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// Sources of the hub ConfigMaps a PipelineRun references, see PIPELINERUN_CONFIGMAP_SOURCES.
+const (
+	// pipelineRunConfigMapsAnnotation syncs the ConfigMaps listed in the syncConfigMapsAnnotation.
+	pipelineRunConfigMapsAnnotation = "annotation"
+	// pipelineRunConfigMapsWorkspaces syncs the ConfigMaps bound to the workspaces of the PipelineRun.
+	pipelineRunConfigMapsWorkspaces = "workspaces"
+
+	// defaultPipelineRunConfigMapSources syncs no ConfigMap, they often hold configuration the
+	// spoke clusters provision themselves.
+	defaultPipelineRunConfigMapSources = "none"
+
+	// syncConfigMapsAnnotation lists, comma separated, the hub ConfigMaps of its namespace a
+	// PipelineRun needs on the spoke cluster, e.g. a custom CA bundle or a gitconfig.
+	syncConfigMapsAnnotation = syncerGroupName + "/configmaps"
+)
+
+// parsePipelineRunConfigMapSources validates the PIPELINERUN_CONFIGMAP_SOURCES value, a comma
+// separated list of sources, "none" disables them all.
+func parsePipelineRunConfigMapSources(value string) (map[string]bool, error) {
+	sources := map[string]bool{}
+	for _, source := range strings.Split(value, ",") {
+		switch source = strings.TrimSpace(source); source {
+		case "", "none":
+		case pipelineRunConfigMapsAnnotation, pipelineRunConfigMapsWorkspaces:
+			sources[source] = true
+		default:
+			return nil, fmt.Errorf("unsupported PipelineRun ConfigMap source %q, must be none or a list of %s, %s", source, pipelineRunConfigMapsAnnotation, pipelineRunConfigMapsWorkspaces)
+		}
+	}
+	return sources, nil
+}
+
+// pipelineRunConfigMapNames returns, by name, the hub ConfigMaps the PipelineRun references
+// through the enabled sources, and whether each must exist on the hub. The ConfigMaps listed in
+// the syncConfigMapsAnnotation must, the others may be provisioned on the spoke clusters directly.
+func (r *Reconciler) pipelineRunConfigMapNames(pipelineRun *v1.PipelineRun) map[string]bool {
+	required := map[string]bool{}
+	if r.pipelineRunConfigMapSources[pipelineRunConfigMapsWorkspaces] {
+		for _, workspace := range pipelineRun.Spec.Workspaces {
+			if workspace.ConfigMap != nil {
+				required[workspace.ConfigMap.Name] = false
+			}
+			if workspace.Projected != nil {
+				for _, source := range workspace.Projected.Sources {
+					if source.ConfigMap != nil {
+						required[source.ConfigMap.Name] = false
+					}
+				}
+			}
+		}
+	}
+	if r.pipelineRunConfigMapSources[pipelineRunConfigMapsAnnotation] {
+		for _, name := range strings.Split(pipelineRun.GetAnnotations()[syncConfigMapsAnnotation], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				required[name] = true
+			}
+		}
+	}
+	delete(required, "")
+	return required
+}
+
+// syncConfigMaps copies the hub ConfigMaps the PipelineRun references to the spoke cluster,
+// sorted by name. It returns the synced ConfigMaps and the errors of the failed ones, so a single
+// missing ConfigMap doesn't hide the others.
+func (r *Reconciler) syncConfigMaps(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) ([]syncedSecretRef, error) {
+	required := r.pipelineRunConfigMapNames(pipelineRun)
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		refs   []syncedSecretRef
+		failed syncErrors
+	)
+	for _, name := range names {
+		synced, err := r.syncConfigMap(ctx, clusterName, spokeKubeClient, pipelineRun, workload, name, required[name])
+		if err != nil {
+			r.logger.Errorf("error syncing ConfigMap %s/%s to spoke cluster %s: %v", pipelineRun.GetNamespace(), name, clusterName, err)
+			failed = append(failed, err)
+			continue
+		}
+		if synced {
+			refs = append(refs, syncedSecretRef{Cluster: clusterName, Namespace: syncer.SpokeNamespace(workload), Name: name})
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return refs, nil
+	case 1:
+		return refs, failed[0]
+	default:
+		return refs, failed
+	}
+}
+
+// syncConfigMap copies a hub ConfigMap as is to the spoke cluster. It returns false when the
+// ConfigMap isn't required and missing on the hub.
+func (r *Reconciler) syncConfigMap(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, name string, required bool) (bool, error) {
+	configMap, err := r.hubKubeClient.CoreV1().ConfigMaps(pipelineRun.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) && !required {
+		r.logger.Infof("ConfigMap %s/%s of PipelineRun %s does not exist on the hub, not syncing it", pipelineRun.GetNamespace(), name, pipelineRun.GetName())
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not get ConfigMap %s/%s: %w", pipelineRun.GetNamespace(), name, err)
+	}
+	return true, r.writeSpokeConfigMap(ctx, clusterName, spokeKubeClient, spokeConfigMap(configMap, pipelineRun, workload, r.spokePipelineRunAPIVersion(clusterName)))
+}
+
+// writeSpokeConfigMap creates the ConfigMap on the spoke cluster, or updates the existing one
+// when its content differs.
+func (r *Reconciler) writeSpokeConfigMap(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, newConfigMap *corev1.ConfigMap) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	_, err := spokeKubeClient.CoreV1().ConfigMaps(newConfigMap.Namespace).Create(spokeCtx, newConfigMap, metav1.CreateOptions{})
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err == nil {
+		r.logger.Infof("successfully created ConfigMap %s/%s on spoke cluster %s", newConfigMap.Namespace, newConfigMap.Name, clusterName)
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// An update conflicting with another writer of the ConfigMap is decided again on a fresh copy
+	updated := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := spokeKubeClient.CoreV1().ConfigMaps(newConfigMap.Namespace).Get(spokeCtx, newConfigMap.Name, metav1.GetOptions{})
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		if err != nil {
+			return err
+		}
+		if existing.GetLabels()[managedByLabel] != managedByValue && r.clusterConflictPolicy(ctx, clusterName) != conflictPolicyAdopt {
+			return syncer.Classify(fmt.Errorf("ConfigMap %s/%s on spoke cluster %s was not created by %s", newConfigMap.Namespace, newConfigMap.Name, clusterName, managedByValue), ErrSecretConflict)
+		}
+		if configMapSynced(existing, newConfigMap) {
+			return nil
+		}
+
+		modified := existing.DeepCopy()
+		modified.Data, modified.BinaryData = newConfigMap.Data, newConfigMap.BinaryData
+		if modified.Labels == nil {
+			modified.Labels = map[string]string{}
+		}
+		maps.Copy(modified.Labels, newConfigMap.Labels)
+		if modified.Annotations == nil {
+			modified.Annotations = map[string]string{}
+		}
+		maps.Copy(modified.Annotations, newConfigMap.Annotations)
+		modified.OwnerReferences = newConfigMap.OwnerReferences
+		err = writeSpokeConfigMapDelta(spokeCtx, spokeKubeClient, existing, modified)
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		if err != nil {
+			return fmt.Errorf("could not update ConfigMap %s/%s on spoke cluster %s: %w", existing.Namespace, existing.Name, clusterName, err)
+		}
+		updated = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if updated {
+		r.logger.Infof("successfully updated ConfigMap %s/%s on spoke cluster %s", newConfigMap.Namespace, newConfigMap.Name, clusterName)
+	}
+	return nil
+}
+
+// writeSpokeConfigMapDelta writes the modified copy of the existing spoke ConfigMap, with a merge
+// patch of its metadata when its content is unchanged, e.g. when a later Workload synced it again.
+func writeSpokeConfigMapDelta(ctx context.Context, spokeKubeClient kubernetes.Interface, existing, modified *corev1.ConfigMap) error {
+	if !equality.Semantic.DeepEqual(existing.Data, modified.Data) || !equality.Semantic.DeepEqual(existing.BinaryData, modified.BinaryData) {
+		_, err := spokeKubeClient.CoreV1().ConfigMaps(modified.Namespace).Update(ctx, modified, metav1.UpdateOptions{})
+		return err
+	}
+	patch, err := metadataPatch(existing, modified)
+	if err != nil || patch == nil {
+		return err
+	}
+	_, err = spokeKubeClient.CoreV1().ConfigMaps(modified.Namespace).Patch(ctx, modified.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// spokeConfigMap returns the spoke copy of a hub ConfigMap, in the spoke namespace of the
+// Workload, labeled and annotated like the spoke secrets and owned by the spoke PipelineRun, so it
+// is garbage collected with the run.
+func spokeConfigMap(configMap *corev1.ConfigMap, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, pipelineRunAPIVersion string) *corev1.ConfigMap {
+	newConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        configMap.Name,
+			Namespace:   syncer.SpokeNamespace(workload),
+			Labels:      maps.Clone(configMap.Labels),
+			Annotations: maps.Clone(configMap.Annotations),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: pipelineRunAPIVersion,
+				Kind:       "PipelineRun",
+				Name:       pipelineRun.GetName(),
+				UID:        pipelineRun.GetUID(),
+			}},
+		},
+		Data:       configMap.Data,
+		BinaryData: configMap.BinaryData,
+	}
+	if newConfigMap.Labels == nil {
+		newConfigMap.Labels = map[string]string{}
+	}
+	if newConfigMap.Annotations == nil {
+		newConfigMap.Annotations = map[string]string{}
+	}
+	newConfigMap.Labels[managedByLabel] = managedByValue
+	newConfigMap.Annotations[workloadAnnotation] = workload.GetNamespace() + "/" + workload.GetName()
+	newConfigMap.Annotations[pipelineRunAnnotation] = syncer.SpokeNamespace(workload) + "/" + pipelineRun.GetName()
+	newConfigMap.Annotations[pipelineRunUIDAnnotation] = string(pipelineRun.GetUID())
+	return newConfigMap
+}
+
+// configMapSynced reports whether the spoke ConfigMap already holds the content of the hub one,
+// for the same Workload and PipelineRun.
+func configMapSynced(existing, configMap *corev1.ConfigMap) bool {
+	return existing.GetLabels()[managedByLabel] == managedByValue &&
+		existing.GetAnnotations()[workloadAnnotation] == configMap.Annotations[workloadAnnotation] &&
+		!pipelineRunRecreated(existing, configMap) &&
+		equality.Semantic.DeepEqual(existing.Data, configMap.Data) &&
+		equality.Semantic.DeepEqual(existing.BinaryData, configMap.BinaryData)
+}
+
+// deleteConfigMapOnSpokeCluster deletes a ConfigMap synced for the Workload from the spoke
+// cluster. It is kept when a later Workload of its namespace synced it again, so a ConfigMap
+// shared by several PipelineRuns outlives the first one.
+func (r *Reconciler) deleteConfigMapOnSpokeCluster(ctx context.Context, spokeKubeClient kubernetes.Interface, ref syncedSecretRef, workloadKey string) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	existing, err := spokeKubeClient.CoreV1().ConfigMaps(ref.Namespace).Get(spokeCtx, ref.Name, metav1.GetOptions{})
+	err = spokeError(err)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Errorf("error getting ConfigMap %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+		return err
+	}
+	if owner := existing.GetAnnotations()[workloadAnnotation]; existing.GetLabels()[managedByLabel] != managedByValue || (workloadKey != "" && owner != workloadKey) {
+		r.logger.Infof("ConfigMap %s/%s on spoke cluster %s is no longer synced for workload %s, keeping it", ref.Namespace, ref.Name, ref.Cluster, workloadKey)
+		return nil
+	}
+
+	err = spokeKubeClient.CoreV1().ConfigMaps(ref.Namespace).Delete(spokeCtx, ref.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &existing.UID}})
+	err = spokeError(err)
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Errorf("error deleting ConfigMap %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+		return err
+	}
+
+	r.logger.Infof("deleted ConfigMap %s/%s on spoke cluster %s", ref.Namespace, ref.Name, ref.Cluster)
+	return nil
+}
@@ -0,0 +1,191 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestParsePipelineRunConfigMapSources(t *testing.T) {
+	for value, expected := range map[string]map[string]bool{
+		"":                         {},
+		"none":                     {},
+		"annotation":               {pipelineRunConfigMapsAnnotation: true},
+		" workspaces ,annotation,": {pipelineRunConfigMapsAnnotation: true, pipelineRunConfigMapsWorkspaces: true},
+	} {
+		sources, err := parsePipelineRunConfigMapSources(value)
+		assert.NilError(t, err, value)
+		assert.DeepEqual(t, expected, sources)
+	}
+
+	_, err := parsePipelineRunConfigMapSources("service-account")
+	assert.Error(t, err, `unsupported PipelineRun ConfigMap source "service-account", must be none or a list of annotation, workspaces`)
+}
+
+func TestSyncConfigMaps(t *testing.T) {
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-pipeline-run",
+			Namespace:   "test-namespace",
+			UID:         "spoke-pipelinerun-uid",
+			Annotations: map[string]string{syncConfigMapsAnnotation: "ca-bundle, gitconfig"},
+		},
+		Spec: v1.PipelineRunSpec{
+			Workspaces: []v1.WorkspaceBinding{
+				{Name: "maven-settings", ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "maven-settings"}}},
+				{Name: "source", EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				{Name: "certs", Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "missing-ca"}}},
+				}}},
+			},
+		},
+	}
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	configMap := func(name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Data:       map[string]string{"key": name},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		sources       map[string]bool
+		annotations   map[string]string
+		spokeObjects  []*corev1.ConfigMap
+		conflict      string
+		expectedNames []string
+		expectedError string
+	}{
+		{
+			name: "no sources",
+		},
+		{
+			name:          "annotation",
+			sources:       map[string]bool{pipelineRunConfigMapsAnnotation: true},
+			expectedNames: []string{"ca-bundle", "gitconfig"},
+		},
+		{
+			name:          "workspaces",
+			sources:       map[string]bool{pipelineRunConfigMapsWorkspaces: true},
+			expectedNames: []string{"maven-settings"},
+		},
+		{
+			name:          "every source",
+			sources:       map[string]bool{pipelineRunConfigMapsAnnotation: true, pipelineRunConfigMapsWorkspaces: true},
+			expectedNames: []string{"ca-bundle", "gitconfig", "maven-settings"},
+		},
+		{
+			name:    "stale managed copy",
+			sources: map[string]bool{pipelineRunConfigMapsAnnotation: true},
+			spokeObjects: []*corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "ca-bundle",
+					Namespace:   "test-namespace",
+					Labels:      map[string]string{managedByLabel: managedByValue},
+					Annotations: map[string]string{workloadAnnotation: "test-namespace/previous-workload"},
+				},
+				Data: map[string]string{"key": "stale"},
+			}},
+			expectedNames: []string{"ca-bundle", "gitconfig"},
+		},
+		{
+			name:          "unmanaged spoke ConfigMap",
+			sources:       map[string]bool{pipelineRunConfigMapsAnnotation: true},
+			spokeObjects:  []*corev1.ConfigMap{configMap("gitconfig")},
+			expectedError: "ConfigMap test-namespace/gitconfig on spoke cluster test-cluster was not created by secret-syncer",
+		},
+		{
+			name:          "adopted unmanaged spoke ConfigMap",
+			sources:       map[string]bool{pipelineRunConfigMapsAnnotation: true},
+			spokeObjects:  []*corev1.ConfigMap{configMap("gitconfig")},
+			conflict:      conflictPolicyAdopt,
+			expectedNames: []string{"ca-bundle", "gitconfig"},
+		},
+		{
+			name:          "missing annotation ConfigMap",
+			sources:       map[string]bool{pipelineRunConfigMapsAnnotation: true},
+			annotations:   map[string]string{syncConfigMapsAnnotation: "missing-ca"},
+			expectedError: `could not get ConfigMap test-namespace/missing-ca: configmaps "missing-ca" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			pipelineRun := pipelineRun.DeepCopy()
+			if tt.annotations != nil {
+				pipelineRun.Annotations = tt.annotations
+			}
+			spokeKubeClient := fake.NewSimpleClientset()
+			for _, obj := range tt.spokeObjects {
+				_, err := spokeKubeClient.CoreV1().ConfigMaps(obj.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+				assert.NilError(t, err)
+			}
+			r := &Reconciler{
+				logger:                      zap.NewNop().Sugar(),
+				hubKubeClient:               fake.NewSimpleClientset(configMap("ca-bundle"), configMap("gitconfig"), configMap("maven-settings")),
+				pipelineRunConfigMapSources: tt.sources,
+				conflictPolicy:              tt.conflict,
+			}
+
+			refs, err := r.syncConfigMaps(ctx, testClusterName, spokeKubeClient, pipelineRun, workload)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+
+			var names []string
+			for _, ref := range refs {
+				synced, err := spokeKubeClient.CoreV1().ConfigMaps(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.Equal(t, ref.Name, synced.Data["key"])
+				assert.Equal(t, managedByValue, synced.Labels[managedByLabel])
+				assert.Equal(t, "test-namespace/test-workload", synced.Annotations[workloadAnnotation])
+				assert.DeepEqual(t, []metav1.OwnerReference{{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Name: "test-pipeline-run", UID: "spoke-pipelinerun-uid"}}, synced.OwnerReferences)
+				names = append(names, ref.Name)
+			}
+			assert.DeepEqual(t, tt.expectedNames, names)
+		})
+	}
+}
+
+func TestDeleteConfigMapOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	managedConfigMap := func(name, workload string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{workloadAnnotation: workload},
+		}}
+	}
+	spokeKubeClient := fake.NewSimpleClientset(
+		managedConfigMap("ca-bundle", "test-namespace/test-workload"),
+		managedConfigMap("gitconfig", "test-namespace/later-workload"),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "not-managed", Namespace: "test-namespace", Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload"}}},
+	)
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+
+	for _, name := range []string{"ca-bundle", "gitconfig", "not-managed", "missing"} {
+		ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: name}
+		assert.NilError(t, r.deleteConfigMapOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload"), name)
+	}
+
+	// The ConfigMap synced again by a later Workload is kept for it
+	remaining, err := spokeKubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	names := []string{}
+	for _, configMap := range remaining.Items {
+		names = append(names, configMap.Name)
+	}
+	assert.DeepEqual(t, []string{"gitconfig", "not-managed"}, names)
+}
@@ -0,0 +1,55 @@
+package reconciler
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Conflict policies, what happens when a spoke secret not created by the controller has the name
+// of a secret to sync.
+const (
+	// conflictPolicyFail leaves the spoke secret alone and fails the sync.
+	conflictPolicyFail = "fail"
+	// conflictPolicyAdopt overwrites the spoke secret, which is managed by the controller from then on.
+	conflictPolicyAdopt = "adopt"
+	// conflictPolicySuffix syncs the secret under its name with conflictSecretSuffix appended.
+	conflictPolicySuffix = "suffix"
+
+	// conflictSecretSuffix is appended to the name of the secrets synced with the suffix policy.
+	conflictSecretSuffix = "-secret-syncer"
+
+	// secretConflictReason is the reason of the Warning event recorded on the Workloads whose
+	// secret conflicts with a spoke secret not managed by the controller.
+	secretConflictReason = "SecretConflict"
+)
+
+// parseConflictPolicy validates the SPOKE_SECRET_CONFLICT_POLICY value, empty defaults to fail.
+func parseConflictPolicy(value string) (string, error) {
+	policies := []string{conflictPolicyFail, conflictPolicyAdopt, conflictPolicySuffix}
+	switch value {
+	case "":
+		return conflictPolicyFail, nil
+	case conflictPolicyFail, conflictPolicyAdopt, conflictPolicySuffix:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported conflict policy %q, must be one of %s", value, strings.Join(policies, ", "))
+	}
+}
+
+// isManagedSpokeSecret reports whether the spoke secret was created by the controller.
+func isManagedSpokeSecret(secret *corev1.Secret) bool {
+	return secret.GetLabels()[managedByLabel] == managedByValue
+}
+
+// conflictSecret returns the secret to sync in place of the one conflicting with an unmanaged
+// spoke secret under the suffix policy, false when the secret can't be renamed anymore.
+func conflictSecret(secret *corev1.Secret) (*corev1.Secret, bool) {
+	if strings.HasSuffix(secret.Name, conflictSecretSuffix) {
+		return nil, false
+	}
+	renamed := secret.DeepCopy()
+	renamed.Name += conflictSecretSuffix
+	return renamed, true
+}
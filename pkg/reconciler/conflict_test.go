@@ -0,0 +1,147 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestCreateSecretOnSpokeClusterConflict(t *testing.T) {
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("hub-token")},
+	}
+	unmanaged := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{"app": "other"}},
+			Data:       map[string][]byte{defaultSecretDataKey: []byte("other-token")},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		policy         string
+		spokeSecrets   []*corev1.Secret
+		expectedName   string
+		expectedType   corev1.SecretType
+		expectedTokens map[string]string
+		expectConflict bool
+	}{
+		{
+			name:           "fail",
+			policy:         conflictPolicyFail,
+			spokeSecrets:   []*corev1.Secret{unmanaged()},
+			expectedTokens: map[string]string{"test-secret": "other-token"},
+			expectConflict: true,
+		},
+		{
+			name:           "adopt",
+			policy:         conflictPolicyAdopt,
+			spokeSecrets:   []*corev1.Secret{unmanaged()},
+			expectedName:   "test-secret",
+			expectedTokens: map[string]string{"test-secret": "hub-token"},
+		},
+		{
+			name:   "adopt secret of another type",
+			policy: conflictPolicyAdopt,
+			spokeSecrets: func() []*corev1.Secret {
+				basicAuth := unmanaged()
+				basicAuth.Type = corev1.SecretTypeBasicAuth
+				return []*corev1.Secret{basicAuth}
+			}(),
+			expectedName:   "test-secret",
+			expectedType:   corev1.SecretTypeOpaque,
+			expectedTokens: map[string]string{"test-secret": "hub-token"},
+		},
+		{
+			name:           "suffix",
+			policy:         conflictPolicySuffix,
+			spokeSecrets:   []*corev1.Secret{unmanaged()},
+			expectedName:   "test-secret" + conflictSecretSuffix,
+			expectedTokens: map[string]string{"test-secret": "other-token", "test-secret" + conflictSecretSuffix: "hub-token"},
+		},
+		{
+			name:   "suffixed name taken too",
+			policy: conflictPolicySuffix,
+			spokeSecrets: func() []*corev1.Secret {
+				suffixed := unmanaged()
+				suffixed.Name += conflictSecretSuffix
+				return []*corev1.Secret{unmanaged(), suffixed}
+			}(),
+			expectedTokens: map[string]string{"test-secret": "other-token", "test-secret" + conflictSecretSuffix: "other-token"},
+			expectConflict: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			spokeKubeClient := fake.NewSimpleClientset()
+			for _, secret := range tt.spokeSecrets {
+				_, err := spokeKubeClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+				assert.NilError(t, err)
+			}
+			// The type of a Secret is immutable
+			spokeKubeClient.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				secret := action.(k8stesting.UpdateAction).GetObject().(*corev1.Secret)
+				stored, err := spokeKubeClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("secrets"), secret.Namespace, secret.Name)
+				if err == nil && stored.(*corev1.Secret).Type != secret.Type {
+					return true, nil, apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Secret").GroupKind(), secret.Name, nil)
+				}
+				return false, nil, nil
+			})
+			recorder := record.NewFakeRecorder(10)
+			r := &Reconciler{
+				logger:         zap.NewNop().Sugar(),
+				hubKubeClient:  fake.NewSimpleClientset(hubSecret),
+				conflictPolicy: tt.policy,
+				recorder:       recorder,
+			}
+
+			name, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+			if tt.expectConflict {
+				assert.ErrorIs(t, err, ErrSecretConflict)
+				err = r.rejectionError(workload, err)
+				assert.Assert(t, controller.IsPermanentError(err), "expected permanent error, got %v", err)
+				event := <-recorder.Events
+				assert.Assert(t, strings.HasPrefix(event, "Warning "+secretConflictReason+" Not syncing secrets: secret test-namespace/test-secret"), event)
+			} else {
+				assert.NilError(t, err)
+				assert.Equal(t, tt.expectedName, name)
+				synced, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, name, metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.Assert(t, isManagedSpokeSecret(synced))
+				assert.Equal(t, "test-namespace/test-workload", synced.Annotations[workloadAnnotation])
+				if tt.expectedType != "" {
+					assert.Equal(t, tt.expectedType, synced.Type)
+				}
+			}
+
+			for secretName, token := range tt.expectedTokens {
+				secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, secretName, metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.Equal(t, token, string(secret.Data[defaultSecretDataKey]), secretName)
+			}
+		})
+	}
+}
@@ -2,101 +2,594 @@ package reconciler
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"os"
+	"strings"
 
-	"k8s.io/apimachinery/pkg/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/injection/sharedmain"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
 	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
 	kueueinformers "sigs.k8s.io/kueue/client-go/informers/externalversions"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+
+	workloadinformer "github.com/zakisk/secret-service/pkg/client/injection/informers/kueue/v1beta1/workload"
+	workloadreconciler "github.com/zakisk/secret-service/pkg/client/injection/reconciler/kueue/v1beta1/workload"
+	"github.com/zakisk/secret-service/pkg/redact"
+	"github.com/zakisk/secret-service/pkg/version"
 )
 
 const controllerName = "kueue-workload-controller"
 
+// ControllerOptions customize the controllers for the distributions embedding them, e.g. an
+// operator running them in its own manager. The environment variables still configure
+// everything else, and the zero ControllerOptions is the configuration of NewControllers.
+type ControllerOptions struct {
+	// Name names the Workload controller, its workqueue, the name label of its workqueue metrics
+	// and the source of its events, kueue-workload-controller when empty. The workqueue of the
+	// spoke completion watcher is prefixed with it.
+	Name string
+	// Logger replaces the logger of the context, it is scrubbed of the credential material the
+	// same way.
+	Logger *zap.SugaredLogger
+	// KubeClient, DynamicClient and KueueClient replace the hub clients created from the injected
+	// config, which the Workload informer and the metadata client of HUB_SECRET_WATCH still use.
+	// HUB_CLIENT_QPS, HUB_CLIENT_BURST and HUB_THROTTLE_MAX_DELAY don't apply to them.
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+	KueueClient   kueueversioned.Interface
+	// KueueNamespace replaces KUEUE_NAMESPACE.
+	KueueNamespace string
+	// WorkloadFilter restricts the reconciled Workloads to the ones it returns true for, on top
+	// of the queue filters. It gets the cached Workloads, and must not modify them. The Workloads
+	// with the cleanup finalizer are reconciled regardless, so their secrets are cleaned up.
+	WorkloadFilter func(*kueuev1beta1.Workload) bool
+	// KueueInformerFactory and KubeInformerFactory share the informers of the MultiKueueClusters
+	// and of the kubeconfig secrets with the embedder rather than starting new ones. They are
+	// started, and their caches synced, by the controller. KubeInformerFactory must cover
+	// KueueNamespace.
+	KueueInformerFactory kueueinformers.SharedInformerFactory
+	KubeInformerFactory  kubeinformers.SharedInformerFactory
+}
+
+// NewController returns the constructor of the Workload controller.
 func NewController() func(context.Context, configmap.Watcher) *controller.Impl {
+	return NewControllerWithOptions(ControllerOptions{})
+}
+
+// NewControllerWithOptions returns the constructor of the Workload controller customized by the
+// options.
+func NewControllerWithOptions(o ControllerOptions) func(context.Context, configmap.Watcher) *controller.Impl {
+	return newController(nil, o)
+}
+
+// NewControllers returns the constructors of the Workload controller and of the spoke completion
+// watcher, which shares its Reconciler. sharedmain runs them in order.
+func NewControllers() []injection.ControllerConstructor {
+	return NewControllersWithOptions(ControllerOptions{})
+}
+
+// NewControllersWithOptions returns the constructors of NewControllers customized by the options.
+func NewControllersWithOptions(o ControllerOptions) []injection.ControllerConstructor {
+	completion := newCompletionWatcher(o)
+	return []injection.ControllerConstructor{newController(completion, o), newCompletionController(completion)}
+}
+
+// newCompletionWatcher returns the spoke completion watcher of the options, set up by the
+// Workload controller.
+func newCompletionWatcher(o ControllerOptions) *completionWatcher {
+	w := &completionWatcher{name: completionControllerName, logger: o.Logger}
+	if o.Name != "" {
+		w.name = o.Name + "-" + completionControllerName
+	}
+	return w
+}
+
+// controllerLogger returns the logger of the ControllerOptions, the one of the context when nil.
+func controllerLogger(ctx context.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger != nil {
+		return logger
+	}
+	return logging.FromContext(ctx)
+}
+
+// newController returns the constructor of the Workload controller, which sets up the spoke
+// completion watcher when not nil.
+func newController(completion *completionWatcher, o ControllerOptions) func(context.Context, configmap.Watcher) *controller.Impl {
 	return func(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
-		logger := logging.FromContext(ctx)
+		// Every log of the controller, down to the reconciles, scrubs the credential material
+		logger := redact.Logger(controllerLogger(ctx, o.Logger))
+		ctx = logging.WithLogger(ctx, logger)
+
+		opts, err := optionsFromEnv()
+		if err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		if o.Name != "" {
+			opts.name = o.Name
+		}
+		if o.KueueNamespace != "" {
+			opts.kueueNamespace = o.KueueNamespace
+		}
+		opts.queues.workloads = o.WorkloadFilter
 
-		hubKubeClient, cfg, err := getKubeClientAndConfig()
+		var throttle *hubThrottle
+		if opts.hubThrottleMaxDelay > 0 {
+			throttle = newHubThrottle(logger, opts.hubThrottleMaxDelay)
+			recordHubThrottled(ctx, false)
+		}
+		hubKubeClient, cfg, err := getKubeClientAndConfig(ctx, opts.hubClientQPS, opts.hubClientBurst, throttle)
 		if err != nil {
 			logger.Fatalf("Failed to create Kubernetes client: %v", err)
 		}
 
-		kueueClient, err := kueueversioned.NewForConfig(cfg)
+		var (
+			hubDynamicClient dynamic.Interface        = o.DynamicClient
+			kueueClient      kueueversioned.Interface = o.KueueClient
+		)
+		if o.KubeClient != nil {
+			hubKubeClient = o.KubeClient
+		}
+		if hubDynamicClient == nil {
+			if hubDynamicClient, err = dynamic.NewForConfig(cfg); err != nil {
+				logger.Fatalf("Failed to create dynamic client: %v", err)
+			}
+		}
+		if kueueClient == nil {
+			if kueueClient, err = kueueversioned.NewForConfig(cfg); err != nil {
+				logger.Fatalf("Failed to create Kueue client: %v", err)
+			}
+		}
+		// The clients and informers are built for a single version of the Workloads, fail with
+		// the versions of the hub rather than with informers which never sync
+		workloadVersions, err := discoverWorkloadAPIVersions(hubKubeClient.Discovery())
+		if err != nil {
+			logger.Fatalf("Failed to discover the Kueue Workload API: %v", err)
+		}
+		workloadVersion, err := workloadVersions.negotiate()
+		if err != nil {
+			logger.Fatalf("Unsupported Kueue Workload API: %v", err)
+		}
+		if workloadVersions.preferred != "" && workloadVersions.preferred != workloadVersion {
+			logger.Warnf("The hub prefers the %s/%s Workloads, using %s converted by the hub API server", workloadAPIVersion.Group, workloadVersions.preferred, workloadVersion)
+		} else {
+			logger.Infof("Using the %s/%s Workloads", workloadAPIVersion.Group, workloadVersion)
+		}
+
+		leaderElectionConfig, err := sharedmain.GetLeaderElectionConfig(ctx)
 		if err != nil {
-			logger.Fatalf("Failed to create Kueue client: %v", err)
+			logger.Fatalf("Failed to load the leader election configuration: %v", err)
+		}
+		shard, err := statefulSetShard(leaderElectionConfig)
+		if err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		if shard != nil {
+			logger.Infof("Reconciling the Workloads of shard %s of %d", shard.Name(), leaderElectionConfig.Buckets)
 		}
 
-		kueueNamespace := os.Getenv("KUEUE_NAMESPACE")
-		if kueueNamespace == "" {
-			kueueNamespace = "kueue-system" // Default to standard Kueue namespace
+		logger.Infof("Starting secret-syncer %s", version.String())
+		recordBuildInfo(ctx)
+		logger.Infof("Using Kueue namespace: %s", opts.kueueNamespace)
+		logger.Infof("Using secret retain policy: %s", opts.retainPolicy)
+		if opts.dryRun {
+			logger.Warn("Dry run: the writes to the spoke clusters are validated but never persisted")
 		}
-		logger.Infof("Using Kueue namespace: %s", kueueNamespace)
 
-		kueueInformer := kueueinformers.NewSharedInformerFactory(kueueClient, 0)
-		workloadInformer := kueueInformer.Kueue().V1beta1().Workloads()
+		// The informer is started, and its cache synced, by sharedmain before the controller
+		// runs, so neither reconciles nor promotions see an empty lister
+		workloadInformer := workloadinformer.Get(ctx)
+		var workloadLister kueuev1beta1lister.WorkloadLister = workloadInformer.Lister()
 
-		r := &Reconciler{
-			logger:         logger,
-			hubKubeClient:  hubKubeClient,
-			workloadLister: workloadInformer.Lister(),
-			kueueClient:    kueueClient,
-			kueueNamespace: kueueNamespace,
+		// The injected informer watches the first namespace, the other ones get their own
+		var namespacedInformers *namespacedWorkloadInformers
+		if len(opts.watchNamespaces) > 0 {
+			if !injection.HasNamespaceScope(ctx) || injection.GetNamespaceScope(ctx) != opts.watchNamespaces[0] {
+				logger.Fatalf("WATCH_NAMESPACES requires the context to be scoped with reconciler.WithNamespaceScope")
+			}
+			logger.Infof("Watching the Workloads of namespaces %s", strings.Join(opts.watchNamespaces, ", "))
+			namespacedInformers = newNamespacedWorkloadInformers(ctx, kueueClient, opts, opts.watchNamespaces[1:])
+			listers := map[string]kueuev1beta1lister.WorkloadLister{opts.watchNamespaces[0]: workloadInformer.Lister()}
+			for namespace, lister := range namespacedInformers.listers {
+				listers[namespace] = lister
+			}
+			workloadLister = multiNamespaceWorkloadLister{listers: listers}
 		}
 
-		impl := controller.NewContext(ctx, r, controller.ControllerOptions{
+		r := newReconciler(ctx, logger, opts, hubKubeClient, hubDynamicClient, kueueClient, workloadLister)
+		r.hubThrottle = throttle
+		r.multiKueueClusterLister, r.kubeconfigSecretLister = startSpokeConfigInformers(ctx, kueueClient, hubKubeClient, opts.kueueNamespace, o.KueueInformerFactory, o.KubeInformerFactory)
+		r.features.watch(cmw, system.Namespace(), opts.featureFlagsConfigMap)
+		if opts.cloudEventsSink != "" {
+			r.cloudEvents = newCloudEventSender(opts.cloudEventsSink, logger)
+			go r.cloudEvents.run(ctx)
+		}
+		if opts.resultsAPI != "" {
+			if r.results, err = newResultsRecorder(opts.resultsAPI, opts.resultsCAFile, workloadLister, logger); err != nil {
+				logger.Fatalf("Failed to create Tekton Results recorder: %v", err)
+			}
+			r.results.owner = r.pipelineRunOwner
+			go r.results.run(ctx)
+		}
+
+		cleanup := cleanupKey(workloadLister)
+		rateLimiter := opts.rateLimiter(cleanup)
+		var rec controller.Reconciler = newWorkloadReconciler(ctx, r)
+		cleanupFirst, _ := rateLimiter.(*cleanupRateLimiter)
+		if cleanupFirst != nil {
+			rec = &cleanupFirstReconciler{Reconciler: rec, cleanup: cleanup, limiter: cleanupFirst}
+		}
+		impl := controller.NewContext(ctx, rec, controller.ControllerOptions{
 			Logger:        logger,
-			WorkQueueName: controllerName,
+			WorkQueueName: opts.name,
+			RateLimiter:   rateLimiter,
+			Concurrency:   opts.workerThreads,
 		})
 
-		if _, err := workloadInformer.Informer().AddEventHandler(controller.HandleAll(checkOwnerAndEnqueue(impl))); err != nil {
+		enqueue, enqueueAfter := impl.Enqueue, impl.EnqueueAfter
+		if cleanupFirst != nil {
+			slowLane := impl.WorkQueue().(slowLaner).SlowLane()
+			rec.(*cleanupFirstReconciler).slowLane = slowLane
+			enqueue = cleanupFirstEnqueue(impl.Enqueue, impl.EnqueueSlow)
+			enqueueAfter = cleanupFirstEnqueueAfter(impl.EnqueueAfter, slowLane)
+		}
+		enqueueUpdate := workloadUpdateEnqueue(opts.workloadEventCoalesceWindow, enqueue, enqueueAfter)
+		if _, err := workloadInformer.Informer().AddEventHandler(workloadEventHandler(r.queues, enqueue, enqueueUpdate)); err != nil {
 			logger.Panicf("Couldn't register Workload informer event handler: %v", err)
 		}
+		if namespacedInformers != nil {
+			if err := namespacedInformers.addEventHandler(workloadEventHandler(r.queues, enqueue, enqueueUpdate)); err != nil {
+				logger.Panicf("Couldn't register Workload informer event handler: %v", err)
+			}
+			namespacedInformers.run(ctx)
+		}
+
+		health := newHealthChecker()
+		health.addReadinessCheck("workload-informer", func() error {
+			if !workloadInformer.Informer().HasSynced() || (namespacedInformers != nil && !namespacedInformers.hasSynced()) {
+				return errors.New("workload informer cache is not synced")
+			}
+			return nil
+		})
+		health.addReadinessCheck("hub-api", hubAPICheck(hubKubeClient))
+		health.addReadinessCheck("kueue-workload-api", workloadAPICheck(hubKubeClient.Discovery()))
+		health.addLivenessCheck("workqueue", workqueueCheck(impl.WorkQueue()))
+		health.addLivenessCheck("reconcilers", r.tracker.check(stuckReconcileTimeout))
+		go health.serve(ctx, logger, opts.probePort)
+
+		// The pull mode doesn't connect to the spoke clusters
+		if opts.spokeSecretMode != spokeSecretModePull {
+			go r.validateSpokeConfigs(ctx)
+		}
+
+		// The secrets of the external-secrets and pull modes never count against the quotas
+		if r.quotas != nil && opts.spokeSecretMode != spokeSecretModePull && opts.spokeSecretMode != spokeSecretModeExternalSecrets {
+			go r.rebuildSecretQuotas(ctx)
+		}
+
+		// The hub can't reach the spoke clusters of the pull mode
+		if opts.selfTestNamespace != "" && opts.spokeSecretMode != spokeSecretModePull {
+			logger.Infof("Testing the secret creates in namespace %s of every spoke cluster", opts.selfTestNamespace)
+			go r.runSelfTest(ctx, newSelfTest(opts.selfTestNamespace, health))
+		}
+
+		if opts.rotationThreshold > 0 {
+			logger.Infof("Rotating the secrets of PipelineRuns running for more than %s every %s while the %s feature gate is enabled", opts.rotationThreshold, opts.rotationInterval, featureSecretRotation)
+			r.rotations = newRotationRequests()
+			go r.runSecretRotator(ctx, opts.rotationInterval, opts.rotationThreshold, impl.EnqueueKey)
+		}
+
+		if opts.chains.enabled {
+			logger.Infof("Syncing the Chains signing keys of namespace %s to spoke clusters every %s", opts.chains.namespace, opts.chains.interval)
+			go r.runChainsSigningSecretSync(ctx)
+		}
 
-		// Start the informer factory
-		go kueueInformer.Start(ctx.Done())
+		if opts.pullAPI.port > 0 {
+			go r.servePullAPI(ctx, logger, opts.pullAPI)
+		}
+
+		if opts.admissionWebhook.port > 0 {
+			go r.serveAdmissionWebhook(ctx, logger, opts.admissionWebhook)
+		}
+
+		workloadInformers := []cache.SharedIndexInformer{workloadInformer.Informer()}
+		if namespacedInformers != nil {
+			for _, informer := range namespacedInformers.informers {
+				workloadInformers = append(workloadInformers, informer)
+			}
+		}
+		if r.clusterWorkloads, err = indexWorkloadsByCluster(workloadInformers, r.queues); err != nil {
+			logger.Fatalf("Failed to index the Workloads: %v", err)
+		}
+		if completion != nil {
+			completion.r, completion.interval, completion.informers = r, opts.completionCheckInterval, workloadInformers
+		}
+
+		r.features.onChange(func() {
+			logger.Info("Feature gates changed, resyncing the active PipelineRun owned Workloads")
+			for _, informer := range workloadInformers {
+				impl.FilteredGlobalResync(configResyncFilter(r.queues), informer)
+			}
+		})
+
+		if r.syncPolicies != nil {
+			if err := r.syncPolicies.watch(ctx, opts.watchNamespaces, func(namespace string) {
+				logger.Infof("Sync policy %s changed, resyncing the active PipelineRun owned Workloads it applies to", policyName(namespace))
+				for _, informer := range workloadInformers {
+					impl.FilteredGlobalResync(syncPolicyResyncFilter(r.queues, namespace), informer)
+				}
+			}); err != nil {
+				logger.Fatalf("Failed to watch the sync policies: %v", err)
+			}
+		}
+
+		if opts.hubSecretCache {
+			logger.Infof("Caching the hub secrets matching %s", opts.hubSecretCacheSelector)
+			r.hubSecretCache = startHubSecretCache(ctx, hubKubeClient, opts.watchNamespaces, opts.hubSecretCacheSelector)
+		}
+		if opts.hubSecretWatch {
+			metadataClient, err := metadata.NewForConfig(cfg)
+			if err != nil {
+				logger.Fatalf("Failed to create metadata client: %v", err)
+			}
+			logger.Info("Syncing the updates of the hub secrets to the spoke clusters")
+			r.hubSecretUpdates = newRotationRequests()
+			if opts.hubSecretRevocation {
+				logger.Info("Deleting the spoke copies of the revoked hub secrets")
+				r.hubSecretRevocations = newHubSecretRevocations()
+			}
+			if err := r.watchHubSecrets(ctx, metadataClient, opts.watchNamespaces, workloadInformers, impl.EnqueueKey); err != nil {
+				logger.Fatalf("Failed to watch the hub secrets: %v", err)
+			}
+		}
+
+		// Every replica probes the spoke clusters, as the probes only read from them
+		if opts.spokeProbeInterval > 0 && opts.spokeSecretMode != spokeSecretModePull {
+			logger.Infof("Probing the spoke clusters every %s, up to every %s while unreachable", opts.spokeProbeInterval, max(opts.spokeProbeInterval, opts.spokeProbeMaxInterval))
+			r.spokeProbes = newSpokeProbes(opts.spokeProbeInterval, opts.spokeProbeMaxInterval)
+			go r.runSpokeProber(ctx, impl.EnqueueKey)
+		}
+
+		// The Workload informer never sees the Workloads the mutating webhook didn't stamp
+		if opts.untrackedWorkloadSweepInterval > 0 && selectsTrackedWorkloads(opts.workloadLabelSelector) {
+			logger.Infof("Labeling the untracked Workloads every %s", opts.untrackedWorkloadSweepInterval)
+			go r.runUntrackedWorkloadSweeper(ctx, opts.watchNamespaces, opts.workloadFieldSelector, opts.untrackedWorkloadSweepInterval)
+		}
+
+		// The hub can't reach the spoke clusters of the pull mode
+		if opts.orphanSweepInterval > 0 && opts.spokeSecretMode != spokeSecretModePull {
+			logger.Infof("Sweeping spoke clusters for orphaned secrets every %s", opts.orphanSweepInterval)
+			go r.runOrphanSweeper(ctx, opts.orphanSweepInterval)
+		}
 
 		return impl
 	}
 }
 
-// checkOwnerAndEnqueue only enqueues workloads which have OwnerReference kind as PipelineRun
-func checkOwnerAndEnqueue(impl *controller.Impl) func(obj any) {
-	return func(obj any) {
-		object, err := kmeta.DeletionHandlingAccessor(obj)
-		if err == nil {
-			// Check if the workload has a PipelineRun owner reference
-			for _, owner := range object.GetOwnerReferences() {
-				if owner.Kind == "PipelineRun" {
-					impl.EnqueueKey(types.NamespacedName{
-						Namespace: object.GetNamespace(),
-						Name:      object.GetName(),
-					})
-					return
-				}
+// newReconciler creates the Reconciler configured by the options, shared by the controller
+// and the secret-syncer CLI.
+func newReconciler(ctx context.Context, logger *zap.SugaredLogger, opts *options, hubKubeClient kubernetes.Interface, hubDynamicClient dynamic.Interface, kueueClient kueueversioned.Interface, workloadLister kueuev1beta1lister.WorkloadLister) *Reconciler {
+	r := &Reconciler{
+		logger:         logger,
+		hubKubeClient:  hubKubeClient,
+		workloadLister: workloadLister,
+		kueueClient:    kueueClient,
+		kueueNamespace: opts.kueueNamespace,
+		retainPolicy:   opts.retainPolicy,
+
+		hubSecretFinalizer:          opts.hubSecretFinalizer,
+		spokeClientQPS:              opts.spokeClientQPS,
+		spokeClientBurst:            opts.spokeClientBurst,
+		spokeRequestTimeout:         opts.spokeRequestTimeout,
+		kubeconfigContext:           opts.kubeconfigContext,
+		dryRun:                      opts.dryRun,
+		clusterGuards:               newClusterGuards(opts.spokeMaxConcurrency, opts.spokeCircuitFailureThreshold, opts.spokeCircuitOpenDuration),
+		tracker:                     newReconcileTracker(),
+		failures:                    newFailureTracker(opts.failureEscalationThreshold),
+		retryBudgets:                newRetryBudgets(),
+		pipelineRunPolls:            newSpokePipelineRunPolls(),
+		quotas:                      newSecretQuotas(opts.secretQuota),
+		conflictPolicy:              opts.conflictPolicy,
+		oversizePolicy:              opts.oversizePolicy,
+		secretType:                  opts.secretType,
+		secretKeyMapping:            opts.secretKeyMapping,
+		hooks:                       syncHooks,
+		recorder:                    newEventRecorder(ctx, hubKubeClient, opts.name),
+		spokeSecretMode:             opts.spokeSecretMode,
+		externalSecrets:             opts.externalSecrets,
+		externalSecretsDiscovery:    newExternalSecretsDiscovery(),
+		sealedSecrets:               opts.sealedSecrets,
+		sealedSecretsCertificates:   newSealedSecretsCertificates(),
+		spokeDiscovery:              newSpokeDiscovery(),
+		resyncs:                     newRotationRequests(),
+		spokeIdentities:             newSpokeIdentities(),
+		spokeClients:                newSpokeClientCache(),
+		tokenResyncMargin:           opts.tokenResyncMargin,
+		clockSkew:                   opts.clockSkew,
+		done:                        opts.done,
+		workloadStatus:              opts.workloadStatus,
+		statusStore:                 newStatusStore(opts.statusStore, kueueClient, hubDynamicClient),
+		hubDynamicClient:            hubDynamicClient,
+		repositorySecrets:           opts.repositorySecrets,
+		pipelineRunSecretSources:    opts.pipelineRunSecretSources,
+		pipelineRunConfigMapSources: opts.pipelineRunConfigMapSources,
+		knownHosts:                  opts.knownHosts,
+		resolverSecrets:             opts.resolverSecrets,
+		secretSyncConcurrency:       opts.secretSyncConcurrency,
+		chains:                      opts.chains,
+		queues:                      opts.queues,
+		allowedSecrets:              opts.admissionWebhook.secretSelector,
+	}
+	switch opts.secretSource {
+	case secretSourceVault:
+		r.secretSource = newVaultSecretSource(opts.vault)
+	case secretSourceAWS:
+		r.secretSource = newAWSSecretSource(opts.aws)
+	case secretSourceGCP:
+		r.secretSource = newGCPSecretSource(opts.gcp)
+	case secretSourceGitHubApp:
+		r.secretSource = newGitHubAppSecretSource(opts.githubApp, hubKubeClient)
+	}
+	if opts.queues.owners.depth > 0 {
+		r.ownerMapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(hubKubeClient.Discovery()))
+		r.intermediateOwners = newIntermediateOwners()
+	}
+	if opts.spokeClusterConfig {
+		r.spokeClusterConfigs = newSpokeClusterConfigs(hubDynamicClient)
+	}
+	if opts.secretSyncPolicy {
+		r.syncPolicies = newSecretSyncPolicies(hubDynamicClient)
+	}
+	if opts.auditLogEnabled {
+		r.auditor = newAuditor(zapcore.Lock(os.Stdout))
+	}
+	r.features = newFeatureGates(logger)
+	r.features.defaults = opts.featureGates
+	r.features.optedIn = optedInFeatures(opts, r.hooks)
+	return r
+}
+
+// newWorkloadReconciler wraps the Reconciler in the generated Workload reconciler, which reads
+// the PipelineRun owned Workloads from the lister, skips the keys of the buckets other replicas
+// lead and manages the cleanup finalizer. Kueue owns the Workload status, and the cached
+// Workloads are stripped by transformWorkload, so status updates are skipped.
+func newWorkloadReconciler(ctx context.Context, r *Reconciler) controller.Reconciler {
+	rec := workloadreconciler.NewReconciler(ctx, r.logger, r.kueueClient, pipelineRunWorkloadLister{r.workloadLister, r.queues}, r.recorder, r, controller.Options{
+		FinalizerName:     cleanupFinalizer,
+		SkipStatusUpdates: true,
+	})
+	r.leader = rec.(leaderChecker)
+	return rec
+}
+
+// workloadEventHandler enqueues the PipelineRun owned Workloads of the queues, their updates with
+// enqueueUpdate. Updates are only enqueued when they change what the reconciler acts on, Kueue
+// updating the status of busy Workloads many times during their lifetime would otherwise trigger
+// as many reconciles.
+func workloadEventHandler(queues workloadQueueFilter, enqueue, enqueueUpdate func(any)) cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj any) bool {
+			object, err := kmeta.DeletionHandlingAccessor(obj)
+			if err != nil || !queues.owned(object) {
+				return false
 			}
-		}
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			workload, ok := obj.(*kueuev1beta1.Workload)
+			return !ok || queues.matches(workload)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: enqueue,
+			UpdateFunc: func(oldObj, newObj any) {
+				oldWorkload, ok := oldObj.(*kueuev1beta1.Workload)
+				newWorkload, newOk := newObj.(*kueuev1beta1.Workload)
+				if !ok || !newOk || workloadChanged(oldWorkload, newWorkload) {
+					enqueueUpdate(newObj)
+				}
+			},
+			DeleteFunc: enqueue,
+		},
 	}
 }
 
-func getKubeClientAndConfig() (kubernetes.Interface, *rest.Config, error) {
-	cfg, err := rest.InClusterConfig()
-	if err != nil {
-		// Fallback to kubeconfig file for local development
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			kubeconfig = os.Getenv("HOME") + "/.kube/config"
-		}
-		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return nil, nil, err
+// configResyncFilter selects the Workloads resynced after a configuration change: the active
+// PipelineRun owned Workloads of the queues of the controller, dispatched to a spoke cluster and
+// neither finished nor being deleted. The other Workloads pick up the new configuration on their
+// next event.
+func configResyncFilter(queues workloadQueueFilter) func(any) bool {
+	return func(obj any) bool {
+		workload, ok := obj.(*kueuev1beta1.Workload)
+		return ok && queues.owned(workload) && queues.matches(workload) &&
+			ptr.Deref(workload.Spec.Active, true) &&
+			ptr.Deref(workload.Status.ClusterName, "") != "" &&
+			workload.GetDeletionTimestamp().IsZero() &&
+			!meta.IsStatusConditionTrue(workload.Status.Conditions, kueuev1beta1.WorkloadFinished)
+	}
+}
+
+// workloadChanged reports whether an update of a Workload needs a reconcile: its dispatch to a
+// spoke cluster, its annotations, activation, deletion or completion changed. Periodic resyncs,
+// which don't change the resource version, are always reconciled.
+func workloadChanged(oldWorkload, newWorkload *kueuev1beta1.Workload) bool {
+	if oldWorkload.ResourceVersion == newWorkload.ResourceVersion {
+		return true
+	}
+	return ptr.Deref(oldWorkload.Status.ClusterName, "") != ptr.Deref(newWorkload.Status.ClusterName, "") ||
+		!maps.Equal(oldWorkload.GetAnnotations(), newWorkload.GetAnnotations()) ||
+		ptr.Deref(oldWorkload.Spec.Active, true) != ptr.Deref(newWorkload.Spec.Active, true) ||
+		oldWorkload.GetDeletionTimestamp().IsZero() != newWorkload.GetDeletionTimestamp().IsZero() ||
+		meta.IsStatusConditionTrue(oldWorkload.Status.Conditions, kueuev1beta1.WorkloadFinished) != meta.IsStatusConditionTrue(newWorkload.Status.Conditions, kueuev1beta1.WorkloadFinished)
+}
+
+// hasPipelineRunOwner reports whether the object has an OwnerReference of kind PipelineRun.
+func hasPipelineRunOwner(object metav1.Object) bool {
+	for _, owner := range object.GetOwnerReferences() {
+		if owner.Kind == "PipelineRun" {
+			return true
 		}
 	}
+	return false
+}
+
+// startSpokeConfigInformers starts the informers caching the MultiKueueClusters and the kubeconfig
+// secrets of the Kueue namespace, so resolving the config of a spoke cluster doesn't call the hub
+// API server on every reconcile, and waits for their caches to sync. They get their own factories,
+// the injected Kueue factory narrows and strips its informers for the Workloads, unless the
+// embedders share theirs.
+func startSpokeConfigInformers(ctx context.Context, kueueClient kueueversioned.Interface, hubKubeClient kubernetes.Interface, kueueNamespace string,
+	clusterInformers kueueinformers.SharedInformerFactory, secretInformers kubeinformers.SharedInformerFactory) (kueuev1beta1lister.MultiKueueClusterLister, corev1lister.SecretLister) {
+	if clusterInformers == nil {
+		clusterInformers = kueueinformers.NewSharedInformerFactory(kueueClient, controller.GetResyncPeriod(ctx))
+	}
+	if secretInformers == nil {
+		secretInformers = kubeinformers.NewSharedInformerFactoryWithOptions(hubKubeClient, controller.GetResyncPeriod(ctx), kubeinformers.WithNamespace(kueueNamespace))
+	}
+	clusterLister := clusterInformers.Kueue().V1beta1().MultiKueueClusters().Lister()
+	secretLister := secretInformers.Core().V1().Secrets().Lister()
+
+	clusterInformers.Start(ctx.Done())
+	secretInformers.Start(ctx.Done())
+	clusterInformers.WaitForCacheSync(ctx.Done())
+	secretInformers.WaitForCacheSync(ctx.Done())
+	return clusterLister, secretLister
+}
+
+// getKubeClientAndConfig creates the hub client, rate limited to the given QPS and burst. It
+// connects to the hub cluster of the injected clients, selected by the --kubeconfig and
+// --context flags of the controller, so both share the same cluster and credentials. The
+// responses of every client created from the config are observed by the throttle when not nil.
+func getKubeClientAndConfig(ctx context.Context, qps float32, burst int, throttle *hubThrottle) (kubernetes.Interface, *rest.Config, error) {
+	injected := injection.GetConfig(ctx)
+	if injected == nil {
+		return nil, nil, errors.New("no hub REST config in the context, the controller must be started by sharedmain")
+	}
+	cfg := rest.CopyConfig(injected)
+	cfg.QPS = qps
+	cfg.Burst = burst
+	if throttle != nil {
+		cfg.Wrap(throttle.wrap)
+	}
 
 	hubKubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
@@ -0,0 +1,250 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueueinformers "sigs.k8s.io/kueue/client-go/informers/externalversions"
+)
+
+func TestWorkloadEventHandler(t *testing.T) {
+	now := metav1.Now()
+	dispatched := func(mutate func(*kueuev1beta1.Workload)) *kueuev1beta1.Workload {
+		workload := &kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-workload",
+				Namespace:       "test-namespace",
+				ResourceVersion: "2",
+				Annotations:     map[string]string{syncedSecretsAnnotation: "cluster/ns/name"},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+			},
+			Status: kueuev1beta1.WorkloadStatus{
+				ClusterName: ptr.To(testClusterName),
+				Conditions:  []metav1.Condition{{Type: kueuev1beta1.WorkloadAdmitted, Status: metav1.ConditionTrue}},
+			},
+		}
+		if mutate != nil {
+			mutate(workload)
+		}
+		return workload
+	}
+	old := dispatched(func(w *kueuev1beta1.Workload) { w.ResourceVersion = "1" })
+
+	tests := []struct {
+		name            string
+		old             *kueuev1beta1.Workload
+		new             *kueuev1beta1.Workload
+		expectedEnqueue bool
+	}{
+		{
+			name: "status noise",
+			old:  old,
+			new: dispatched(func(w *kueuev1beta1.Workload) {
+				w.Status.Conditions = append(w.Status.Conditions, metav1.Condition{Type: kueuev1beta1.WorkloadQuotaReserved, Status: metav1.ConditionTrue})
+			}),
+		},
+		{
+			name:            "periodic resync",
+			old:             old,
+			new:             dispatched(func(w *kueuev1beta1.Workload) { w.ResourceVersion = "1" }),
+			expectedEnqueue: true,
+		},
+		{
+			name:            "dispatched to a spoke cluster",
+			old:             dispatched(func(w *kueuev1beta1.Workload) { w.ResourceVersion, w.Status.ClusterName = "1", nil }),
+			new:             dispatched(nil),
+			expectedEnqueue: true,
+		},
+		{
+			name:            "annotations changed",
+			old:             old,
+			new:             dispatched(func(w *kueuev1beta1.Workload) { w.Annotations[secretsSyncedAnnotation] = "True" }),
+			expectedEnqueue: true,
+		},
+		{
+			name:            "deactivated",
+			old:             old,
+			new:             dispatched(func(w *kueuev1beta1.Workload) { w.Spec.Active = ptr.To(false) }),
+			expectedEnqueue: true,
+		},
+		{
+			name:            "deleted",
+			old:             old,
+			new:             dispatched(func(w *kueuev1beta1.Workload) { w.DeletionTimestamp = &now }),
+			expectedEnqueue: true,
+		},
+		{
+			name: "finished",
+			old:  old,
+			new: dispatched(func(w *kueuev1beta1.Workload) {
+				w.Status.Conditions = append(w.Status.Conditions, metav1.Condition{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue})
+			}),
+			expectedEnqueue: true,
+		},
+		{
+			name: "not owned by a PipelineRun",
+			old:  dispatched(func(w *kueuev1beta1.Workload) { w.ResourceVersion, w.OwnerReferences = "1", nil }),
+			new:  dispatched(func(w *kueuev1beta1.Workload) { w.OwnerReferences, w.Status.ClusterName = nil, ptr.To("other-cluster") }),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enqueued []any
+			enqueue := func(obj any) { enqueued = append(enqueued, obj) }
+			handler := workloadEventHandler(workloadQueueFilter{}, enqueue, enqueue)
+
+			handler.OnUpdate(tt.old, tt.new)
+			if !tt.expectedEnqueue {
+				assert.Equal(t, 0, len(enqueued))
+				return
+			}
+			assert.Equal(t, 1, len(enqueued))
+			assert.Equal(t, tt.new, enqueued[0])
+		})
+	}
+}
+
+func TestWorkloadEventHandlerAddAndDelete(t *testing.T) {
+	owned := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+		Name:            "test-workload",
+		Namespace:       "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+	}}
+	other := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "job-workload", Namespace: "test-namespace"}}
+	tombstone := cache.DeletedFinalStateUnknown{Key: "test-namespace/test-workload", Obj: owned}
+
+	var enqueued []any
+	enqueue := func(obj any) { enqueued = append(enqueued, obj) }
+	handler := workloadEventHandler(workloadQueueFilter{}, enqueue, enqueue)
+	handler.OnAdd(owned, true)
+	handler.OnAdd(other, true)
+	handler.OnDelete(tombstone)
+	handler.OnDelete(other)
+
+	assert.DeepEqual(t, []any{owned, tombstone}, enqueued)
+}
+
+func TestConfigResyncFilter(t *testing.T) {
+	now := metav1.Now()
+	active := func(mutate func(*kueuev1beta1.Workload)) *kueuev1beta1.Workload {
+		workload := &kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-workload",
+				Namespace:       "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+			},
+			Spec:   kueuev1beta1.WorkloadSpec{QueueName: "tekton-remote"},
+			Status: kueuev1beta1.WorkloadStatus{ClusterName: ptr.To(testClusterName)},
+		}
+		if mutate != nil {
+			mutate(workload)
+		}
+		return workload
+	}
+
+	tests := []struct {
+		name           string
+		obj            any
+		queues         workloadQueueFilter
+		expectedResync bool
+	}{
+		{
+			name:           "active PipelineRun owned Workload",
+			obj:            active(nil),
+			expectedResync: true,
+		},
+		{
+			name: "not owned by a PipelineRun",
+			obj:  active(func(w *kueuev1beta1.Workload) { w.OwnerReferences = nil }),
+		},
+		{
+			name: "deactivated",
+			obj:  active(func(w *kueuev1beta1.Workload) { w.Spec.Active = ptr.To(false) }),
+		},
+		{
+			name: "not dispatched yet",
+			obj:  active(func(w *kueuev1beta1.Workload) { w.Status.ClusterName = nil }),
+		},
+		{
+			name: "finished",
+			obj: active(func(w *kueuev1beta1.Workload) {
+				w.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue}}
+			}),
+		},
+		{
+			name: "being deleted",
+			obj:  active(func(w *kueuev1beta1.Workload) { w.DeletionTimestamp = &now }),
+		},
+		{
+			name:   "queue of another controller",
+			obj:    active(nil),
+			queues: workloadQueueFilter{localQueues: map[string]bool{"other-queue": true}},
+		},
+		{
+			name: "not a Workload",
+			obj:  cache.DeletedFinalStateUnknown{Key: "test-namespace/test-workload", Obj: active(nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedResync, configResyncFilter(tt.queues)(tt.obj))
+		})
+	}
+}
+
+func TestNewControllersWithOptions(t *testing.T) {
+	assert.Equal(t, 2, len(NewControllersWithOptions(ControllerOptions{Name: "pipelines-secret-syncer"})))
+
+	tests := []struct {
+		name         string
+		options      ControllerOptions
+		expectedName string
+	}{
+		{
+			name:         "default name",
+			expectedName: completionControllerName,
+		},
+		{
+			name:         "embedder name",
+			options:      ControllerOptions{Name: "pipelines-secret-syncer"},
+			expectedName: "pipelines-secret-syncer-" + completionControllerName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newCompletionWatcher(tt.options)
+			assert.Equal(t, tt.expectedName, w.name)
+		})
+	}
+}
+
+func TestStartSpokeConfigInformersShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kueueClient := kueuefake.NewSimpleClientset(&kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: testClusterName}})
+	hubKubeClient := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testKueueNamespace}})
+	clusterInformers := kueueinformers.NewSharedInformerFactory(kueueClient, 0)
+	secretInformers := kubeinformers.NewSharedInformerFactory(hubKubeClient, 0)
+
+	clusterLister, secretLister := startSpokeConfigInformers(ctx, kueueClient, hubKubeClient, testKueueNamespace, clusterInformers, secretInformers)
+	_, err := clusterLister.Get(testClusterName)
+	assert.NilError(t, err)
+	_, err = secretLister.Secrets(testKueueNamespace).Get(testSecretName)
+	assert.NilError(t, err)
+
+	// The informers are the ones of the shared factories, which the embedder reuses
+	assert.Assert(t, clusterInformers.Kueue().V1beta1().MultiKueueClusters().Informer().HasSynced())
+	assert.Assert(t, secretInformers.Core().V1().Secrets().Informer().HasSynced())
+}
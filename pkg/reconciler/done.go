@@ -0,0 +1,64 @@
+package reconciler
+
+import (
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
+)
+
+// donePolicy decides when a done spoke PipelineRun is terminal for the sync: its secrets are
+// then no longer synced and the cleanup of its Workload runs. PipelineRuns retried or restarted
+// in place may briefly report done, the grace period keeps their secrets in place meanwhile. The
+// zero donePolicy treats the done PipelineRuns as terminal right away.
+type donePolicy struct {
+	// ignore never treats the PipelineRuns as terminal, their secrets are only cleaned up with
+	// their Workload
+	ignore bool
+	// gracePeriod is how long after its completion a done PipelineRun is still synced
+	gracePeriod time.Duration
+	// clockSkew extends the grace period, the completion time is recorded with the clock of the
+	// spoke cluster
+	clockSkew time.Duration
+}
+
+// terminal reports whether the spoke PipelineRun is terminal at now. A done PipelineRun within
+// the grace period is not, the remaining grace period is then returned. Without a grace period
+// it is terminal right away, whatever the clock of the spoke cluster.
+func (p donePolicy) terminal(pipelineRun *v1.PipelineRun, now time.Time) (bool, time.Duration) {
+	if p.ignore || !pipelineRun.IsDone() {
+		return false, 0
+	}
+	if p.gracePeriod <= 0 {
+		return true, 0
+	}
+	if remaining := completionTime(pipelineRun).Add(p.gracePeriod + p.clockSkew).Sub(now); remaining > 0 {
+		return false, remaining
+	}
+	return true, 0
+}
+
+// completionTime returns when the PipelineRun completed, the transition of its Succeeded
+// condition when Tekton didn't record the completion time.
+func completionTime(pipelineRun *v1.PipelineRun) time.Time {
+	if pipelineRun.Status.CompletionTime != nil {
+		return pipelineRun.Status.CompletionTime.Time
+	}
+	if condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded); condition != nil {
+		return condition.LastTransitionTime.Inner.Time
+	}
+	return time.Time{}
+}
+
+// requeueWithin returns the result of a reconcile requeued after delay at the latest, the
+// failures are retried with their backoff.
+func requeueWithin(err error, delay time.Duration) error {
+	if err == nil {
+		return controller.NewRequeueAfter(delay)
+	}
+	if requeue, after := controller.IsRequeueKey(err); requeue && after > delay {
+		return controller.NewRequeueAfter(delay)
+	}
+	return err
+}
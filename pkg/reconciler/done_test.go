@@ -0,0 +1,141 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/controller"
+)
+
+func donePipelineRun(completed time.Time) *v1.PipelineRun {
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", Annotations: map[string]string{gitAuthSecret: "git-auth"}},
+	}
+	pipelineRun.Status.Conditions = duckv1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue, LastTransitionTime: apis.VolatileTime{Inner: metav1.NewTime(completed)}}}
+	return pipelineRun
+}
+
+func TestDonePolicyTerminal(t *testing.T) {
+	now := time.Now()
+	completed := donePipelineRun(now.Add(-time.Minute))
+	recorded := completed.DeepCopy()
+	recorded.Status.CompletionTime = &metav1.Time{Time: now.Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name              string
+		policy            donePolicy
+		pipelineRun       *v1.PipelineRun
+		expectedTerminal  bool
+		expectedRemaining time.Duration
+	}{
+		{
+			name:        "running",
+			pipelineRun: &v1.PipelineRun{},
+		},
+		{
+			name:             "done",
+			pipelineRun:      completed,
+			expectedTerminal: true,
+		},
+		{
+			name:              "done within the grace period",
+			policy:            donePolicy{gracePeriod: 5 * time.Minute},
+			pipelineRun:       completed,
+			expectedRemaining: 4 * time.Minute,
+		},
+		{
+			name:             "done past the grace period",
+			policy:           donePolicy{gracePeriod: 5 * time.Minute},
+			pipelineRun:      recorded,
+			expectedTerminal: true,
+		},
+		{
+			name:              "done within the skewed grace period",
+			policy:            donePolicy{gracePeriod: 5 * time.Minute, clockSkew: 6 * time.Minute},
+			pipelineRun:       recorded,
+			expectedRemaining: time.Minute,
+		},
+		{
+			name:             "done without a grace period on a skewed clock",
+			policy:           donePolicy{clockSkew: time.Minute},
+			pipelineRun:      completed,
+			expectedTerminal: true,
+		},
+		{
+			name:        "done check disabled",
+			policy:      donePolicy{ignore: true},
+			pipelineRun: completed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminal, remaining := tt.policy.terminal(tt.pipelineRun, now)
+			assert.Equal(t, tt.expectedTerminal, terminal)
+			assert.Equal(t, tt.expectedRemaining, remaining)
+		})
+	}
+}
+
+func TestRequeueWithin(t *testing.T) {
+	failure := errors.New("spoke cluster unreachable")
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "synced",
+			expected: controller.NewRequeueAfter(time.Minute),
+		},
+		{
+			name:     "requeued later",
+			err:      controller.NewRequeueAfter(time.Hour),
+			expected: controller.NewRequeueAfter(time.Minute),
+		},
+		{
+			name:     "requeued sooner",
+			err:      controller.NewRequeueAfter(time.Second),
+			expected: controller.NewRequeueAfter(time.Second),
+		},
+		{
+			name:     "failed",
+			err:      failure,
+			expected: failure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, requeueWithin(tt.err, time.Minute))
+		})
+	}
+}
+
+func TestCheckCompletionGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	hubKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace", Finalizers: []string{hubSecretFinalizer}},
+	})
+	spokeTektonClient := tektonfake.NewSimpleClientset(donePipelineRun(time.Now()))
+	r := &Reconciler{logger: zap.NewNop().Sugar(), hubKubeClient: hubKubeClient, done: donePolicy{gracePeriod: time.Hour}}
+
+	// The hub secret is kept while the PipelineRun may still be restarted
+	done, err := r.checkCompletion(ctx, dispatchedWorkload(nil), "test-pipeline-run", fake.NewSimpleClientset(), spokeTektonClient)
+	assert.NilError(t, err)
+	assert.Assert(t, !done)
+	secret, err := hubKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{hubSecretFinalizer}, secret.Finalizers)
+}
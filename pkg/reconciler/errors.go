@@ -0,0 +1,60 @@
+package reconciler
+
+import (
+	stderrors "errors"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// Classes of the errors returned by the reconciler, matched with errors.Is so embedders and tests
+// don't depend on the error messages.
+var (
+	// ErrClusterNotFound is the class of the errors of Workloads dispatched to a spoke cluster
+	// without a MultiKueueCluster.
+	ErrClusterNotFound = syncer.ErrClusterNotFound
+	// ErrSpokeUnreachable is the class of the errors of spoke API servers which couldn't serve a
+	// request, the ones counted by the circuit breaker.
+	ErrSpokeUnreachable = stderrors.New("spoke cluster unreachable")
+	// ErrSecretMissingKey is the class of the errors of hub secrets missing a required data key.
+	ErrSecretMissingKey = syncer.ErrSecretMissingKey
+	// ErrForbiddenOnSpoke is the class of the errors of requests the spoke cluster forbids the
+	// controller.
+	ErrForbiddenOnSpoke = stderrors.New("forbidden on spoke cluster")
+	// ErrQuotaExceeded is the class of the errors of secrets which would take the Workload's
+	// namespace over its secret quota.
+	ErrQuotaExceeded = stderrors.New("namespace secret quota exceeded")
+	// ErrSecretConflict is the class of the errors of secrets conflicting with a spoke secret the
+	// controller didn't create.
+	ErrSecretConflict = stderrors.New("conflicting secret on spoke cluster")
+	// ErrSpokeMissingTekton and ErrSpokeMissingSecrets are the classes of the errors of Workloads
+	// dispatched to a spoke cluster which doesn't serve the Tekton v1 PipelineRuns, or the Secrets.
+	ErrSpokeMissingTekton  = stderrors.New("spoke cluster missing Tekton Pipelines")
+	ErrSpokeMissingSecrets = stderrors.New("spoke cluster missing Secrets")
+	// ErrSecretRevoked is the class of the errors of hub secrets revoked with the
+	// revokedAnnotation, or deleted with HUB_SECRET_REVOCATION.
+	ErrSecretRevoked = stderrors.New("hub secret revoked")
+	// ErrSecretTooLarge is the class of the errors of secrets over the size limit of the Secrets,
+	// which the spoke API server would reject.
+	ErrSecretTooLarge = stderrors.New("secret too large")
+	// ErrSecretReferenceForbidden is the class of the errors of PipelineRuns pointing at
+	// credentials of an external backend outside of the ones of their namespace.
+	ErrSecretReferenceForbidden = stderrors.New("secret reference outside of the namespace")
+	// ErrSecretNotAllowed is the class of the errors of hub git-auth secrets which don't match
+	// ADMISSION_WEBHOOK_SECRET_SELECTOR.
+	ErrSecretNotAllowed = stderrors.New("secret not allowed")
+)
+
+// spokeError classifies the error of a call to a spoke API server.
+func spokeError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.IsForbidden(err):
+		return syncer.Classify(err, ErrForbiddenOnSpoke)
+	case isSpokeUnavailable(err):
+		return syncer.Classify(err, ErrSpokeUnreachable)
+	}
+	return err
+}
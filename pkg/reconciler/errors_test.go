@@ -0,0 +1,41 @@
+package reconciler
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSpokeError(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "transport error", err: fmt.Errorf("dial tcp: connection refused"), expected: ErrSpokeUnreachable},
+		{name: "service unavailable", err: errors.NewServiceUnavailable("down"), expected: ErrSpokeUnreachable},
+		{name: "forbidden", err: errors.NewForbidden(resource, "name", fmt.Errorf("no")), expected: ErrForbiddenOnSpoke},
+		{name: "not found", err: errors.NewNotFound(resource, "name")},
+		{name: "already exists", err: errors.NewAlreadyExists(resource, "name")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := spokeError(tt.err)
+			// The classified errors keep their message and API status
+			assert.Error(t, err, tt.err.Error())
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, errors.ReasonForError(err), errors.ReasonForError(tt.err))
+			for _, class := range []error{ErrSpokeUnreachable, ErrForbiddenOnSpoke} {
+				assert.Equal(t, stderrors.Is(err, class), class == tt.expected, "class %v", class)
+			}
+		})
+	}
+
+	assert.NilError(t, spokeError(nil))
+}
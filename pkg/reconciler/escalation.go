@@ -0,0 +1,241 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuescheme "sigs.k8s.io/kueue/client-go/clientset/versioned/scheme"
+)
+
+const (
+	// defaultFailureEscalationThreshold is the number of consecutive failures after which a
+	// Workload stops being retried. With the default backoff the last retries are a few seconds apart.
+	defaultFailureEscalationThreshold = 10
+
+	// syncFailedReason is the reason of the Warning event recorded on escalation.
+	syncFailedReason = "SecretSyncFailed"
+)
+
+// failureTracker counts the consecutive reconcile failures of each Workload key.
+type failureTracker struct {
+	// threshold is the number of consecutive failures escalated to permanent, 0 disables escalation
+	threshold int
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func newFailureTracker(threshold int) *failureTracker {
+	return &failureTracker{threshold: threshold, failures: map[string]int{}}
+}
+
+// fail records a failure of the key and reports whether it reached the threshold, in which
+// case the count starts over so a later Workload event gets a fresh set of retries.
+func (f *failureTracker) fail(key string) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[key]++
+	count := f.failures[key]
+	if count < f.threshold {
+		return count, false
+	}
+	delete(f.failures, key)
+	return count, true
+}
+
+func (f *failureTracker) reset(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.failures, key)
+}
+
+// newEventRecorder returns a recorder writing events for Workloads to the hub cluster, from the
+// component.
+func newEventRecorder(ctx context.Context, client kubernetes.Interface, component string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-ctx.Done()
+		broadcaster.Shutdown()
+	}()
+	return broadcaster.NewRecorder(kueuescheme.Scheme, corev1.EventSource{Component: component})
+}
+
+// retryBudgets holds the retry deadline of each Workload key: once the spoke PipelineRun timed
+// out, syncing its secrets can no longer help the run, so failed syncs aren't retried anymore.
+// A nil retryBudgets never gives up.
+type retryBudgets struct {
+	mu        sync.Mutex
+	deadlines map[string]time.Time
+}
+
+func newRetryBudgets() *retryBudgets {
+	return &retryBudgets{deadlines: map[string]time.Time{}}
+}
+
+// set records the deadline of the spoke PipelineRun of the key, PipelineRuns without a timeout,
+// or which didn't start yet, have none.
+func (b *retryBudgets) set(key string, pipelineRun *v1.PipelineRun) {
+	if b == nil {
+		return
+	}
+	deadline, ok := pipelineRunDeadline(pipelineRun)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !ok {
+		delete(b.deadlines, key)
+		return
+	}
+	b.deadlines[key] = deadline
+}
+
+// exhausted returns the deadline of the key when it passed.
+func (b *retryBudgets) exhausted(key string, now time.Time) (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	deadline, ok := b.deadlines[key]
+	return deadline, ok && now.After(deadline)
+}
+
+func (b *retryBudgets) clear(key string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.deadlines, key)
+}
+
+// pipelineRunDeadline returns when the PipelineRun times out, its start time plus its
+// spec.timeouts.pipeline. Tekton defaults the timeout, a zero timeout never expires.
+func pipelineRunDeadline(pipelineRun *v1.PipelineRun) (time.Time, bool) {
+	if pipelineRun.Status.StartTime == nil || pipelineRun.Spec.Timeouts == nil || pipelineRun.Spec.Timeouts.Pipeline == nil || pipelineRun.Spec.Timeouts.Pipeline.Duration <= 0 {
+		return time.Time{}, false
+	}
+	return pipelineRun.Status.StartTime.Add(pipelineRun.Spec.Timeouts.Pipeline.Duration), true
+}
+
+// escalate tracks the outcome of a reconcile. Once a Workload failed threshold times in a row, or
+// fails after its spoke PipelineRun timed out, a Warning event is recorded on it and the error is
+// made permanent, so the key is dropped from the workqueue instead of being retried forever.
+// Deleting Workloads are always retried, as their finalizer would otherwise never be removed.
+func (r *Reconciler) escalate(key string, err error) error {
+	if err == nil {
+		if r.failures != nil {
+			r.failures.reset(key)
+		}
+		return nil
+	}
+	if controller.IsSkipKey(err) || controller.IsPermanentError(err) {
+		return err
+	}
+	if ok, _ := controller.IsRequeueKey(err); ok {
+		return err
+	}
+
+	if deadline, ok := r.retryBudgets.exhausted(key, time.Now()); ok {
+		return r.giveUp(key, err, fmt.Sprintf("its PipelineRun timed out at %s", deadline.Format(time.RFC3339)))
+	}
+
+	if r.failures == nil || r.failures.threshold == 0 {
+		return err
+	}
+	count, escalated := r.failures.fail(key)
+	if !escalated {
+		return err
+	}
+	return r.giveUp(key, err, fmt.Sprintf("%d consecutive failures", count))
+}
+
+// giveUp records a Warning event on the Workload of the key and makes the error permanent,
+// unless the Workload is being deleted.
+func (r *Reconciler) giveUp(key string, err error, cause string) error {
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return err
+	}
+	workload, getErr := r.workloadLister.Workloads(namespace).Get(name)
+	if errors.IsNotFound(getErr) {
+		r.retryBudgets.clear(key)
+		return nil
+	}
+	if getErr != nil || workload.GetDeletionTimestamp() != nil {
+		return err
+	}
+
+	r.logger.Errorf("workload %s failed after %s, giving up until its next update: %v", key, cause, err)
+	if r.recorder != nil {
+		r.recorder.Eventf(workload, corev1.EventTypeWarning, syncFailedReason,
+			"Giving up syncing secrets after %s, retrying on the next Workload update: %v", cause, err)
+	}
+	return controller.NewPermanentError(err)
+}
+
+// rejectionReasons are the reasons of the Warning events recorded on the Workloads whose sync is
+// rejected, by error class.
+var rejectionReasons = []struct {
+	class  error
+	reason string
+}{
+	{ErrQuotaExceeded, secretQuotaExceededReason},
+	{ErrSecretConflict, secretConflictReason},
+	{ErrSpokeMissingTekton, spokeMissingTektonReason},
+	{ErrSpokeMissingSecrets, spokeMissingSecretsReason},
+	{ErrSecretRevoked, secretRevokedReason},
+	{ErrSecretTooLarge, secretTooLargeReason},
+	{ErrSecretReferenceForbidden, secretReferenceForbiddenReason},
+	{ErrSecretNotAllowed, secretNotAllowedReason},
+}
+
+// rejectionError records a Warning event on the Workload when the sync was rejected, because of
+// the quota of its namespace, a conflicting spoke secret or a spoke cluster missing an API, and
+// makes the error permanent: retrying can't help until the Workload is updated or the cause is
+// cleared.
+func (r *Reconciler) rejectionError(workload *kueuev1beta1.Workload, err error) error {
+	reason := rejectionReason(err)
+	if reason == "" {
+		return err
+	}
+	if r.recorder != nil {
+		r.recorder.Eventf(workload, corev1.EventTypeWarning, reason, "Not syncing secrets: %v", err)
+	}
+	return controller.NewPermanentError(err)
+}
+
+// rejectionReason returns the reason of the rejection class of the error, empty when the sync
+// wasn't rejected. The joined errors of a batch of syncs are only rejected when each of them is,
+// so the failures which may resolve on their own are still retried.
+func rejectionReason(err error) string {
+	var errs syncErrors
+	if stderrors.As(err, &errs) {
+		var reason string
+		for _, err := range errs {
+			if reason = rejectionReason(err); reason == "" {
+				return ""
+			}
+		}
+		return reason
+	}
+	for _, rejection := range rejectionReasons {
+		if stderrors.Is(err, rejection.class) {
+			return rejection.reason
+		}
+	}
+	return ""
+}
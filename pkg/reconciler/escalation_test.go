@@ -0,0 +1,169 @@
+package reconciler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestEscalate(t *testing.T) {
+	deleting := pipelineRunOwnedWorkload("test-namespace", "deleting")
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, workload := range []*kueuev1beta1.Workload{pipelineRunOwnedWorkload("test-namespace", "test-workload"), deleting} {
+		assert.NilError(t, indexer.Add(workload))
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+		failures:       newFailureTracker(3),
+		recorder:       recorder,
+	}
+	key := "test-namespace/test-workload"
+	errBoom := errors.New("boom")
+
+	// A success resets the count
+	assert.ErrorIs(t, r.escalate(key, errBoom), errBoom)
+	assert.ErrorIs(t, r.escalate(key, errBoom), errBoom)
+	assert.NilError(t, r.escalate(key, nil))
+
+	// Requeues and skips aren't failures
+	assert.ErrorIs(t, r.escalate(key, errBoom), errBoom)
+	assert.ErrorIs(t, r.escalate(key, errBoom), errBoom)
+	r.escalate(key, controller.NewRequeueAfter(time.Second))
+	r.escalate(key, controller.NewSkipKey(key))
+	assert.Equal(t, 0, len(recorder.Events))
+
+	err := r.escalate(key, errBoom)
+	assert.Assert(t, controller.IsPermanentError(err), "expected permanent error, got %v", err)
+	assert.Equal(t, 1, len(recorder.Events))
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning "+syncFailedReason+" Giving up syncing secrets after 3 consecutive failures"), event)
+
+	// The next update starts over
+	err = r.escalate(key, errBoom)
+	assert.Assert(t, !controller.IsPermanentError(err))
+
+	// Deleting Workloads are retried forever
+	for i := 0; i < 5; i++ {
+		err = r.escalate("test-namespace/deleting", errBoom)
+		assert.Assert(t, !controller.IsPermanentError(err))
+	}
+	assert.Equal(t, 0, len(recorder.Events))
+}
+
+func TestEscalateDisabled(t *testing.T) {
+	errBoom := errors.New("boom")
+	for _, r := range []*Reconciler{{}, {failures: newFailureTracker(0)}} {
+		for i := 0; i < 20; i++ {
+			assert.ErrorIs(t, r.escalate("test-namespace/test-workload", errBoom), errBoom)
+		}
+	}
+}
+
+func TestEscalateRetryBudget(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(pipelineRunOwnedWorkload("test-namespace", "test-workload")))
+
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+		failures:       newFailureTracker(10),
+		retryBudgets:   newRetryBudgets(),
+		recorder:       recorder,
+	}
+	key := "test-namespace/test-workload"
+	errBoom := errors.New("boom")
+
+	// Failures are retried while the PipelineRun may still run
+	r.retryBudgets.set(key, pipelineRunWithTimeout(time.Now().Add(-time.Minute), time.Hour))
+	err := r.escalate(key, errBoom)
+	assert.Assert(t, !controller.IsPermanentError(err))
+	assert.Equal(t, 0, len(recorder.Events))
+
+	// Once it timed out, the first failure gives up
+	r.retryBudgets.set(key, pipelineRunWithTimeout(time.Now().Add(-2*time.Hour), time.Hour))
+	err = r.escalate(key, errBoom)
+	assert.Assert(t, controller.IsPermanentError(err), "expected permanent error, got %v", err)
+	assert.Equal(t, 1, len(recorder.Events))
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning "+syncFailedReason+" Giving up syncing secrets after its PipelineRun timed out at"), event)
+
+	// Requeues are still honored
+	ok, _ := controller.IsRequeueKey(r.escalate(key, controller.NewRequeueAfter(time.Second)))
+	assert.Assert(t, ok)
+
+	// Deleted Workloads drop their budget
+	r.retryBudgets.set("test-namespace/deleted", pipelineRunWithTimeout(time.Now().Add(-2*time.Hour), time.Hour))
+	assert.NilError(t, r.escalate("test-namespace/deleted", errBoom))
+	_, exhausted := r.retryBudgets.exhausted("test-namespace/deleted", time.Now())
+	assert.Assert(t, !exhausted)
+}
+
+func TestPipelineRunDeadline(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		pipelineRun  *v1.PipelineRun
+		wantDeadline time.Time
+		wantOk       bool
+	}{
+		{
+			name:         "timeout from the start",
+			pipelineRun:  pipelineRunWithTimeout(start, time.Hour),
+			wantDeadline: start.Add(time.Hour),
+			wantOk:       true,
+		},
+		{
+			name:        "no timeout",
+			pipelineRun: pipelineRunWithTimeout(start, 0),
+		},
+		{
+			name:        "not started",
+			pipelineRun: &v1.PipelineRun{Spec: v1.PipelineRunSpec{Timeouts: &v1.TimeoutFields{Pipeline: &metav1.Duration{Duration: time.Hour}}}},
+		},
+		{
+			name:        "no timeouts",
+			pipelineRun: &v1.PipelineRun{Status: v1.PipelineRunStatus{PipelineRunStatusFields: v1.PipelineRunStatusFields{StartTime: &metav1.Time{Time: start}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadline, ok := pipelineRunDeadline(tt.pipelineRun)
+			assert.Equal(t, ok, tt.wantOk)
+			assert.Assert(t, deadline.Equal(tt.wantDeadline), "got %s, want %s", deadline, tt.wantDeadline)
+		})
+	}
+}
+
+func TestRetryBudgetsNil(t *testing.T) {
+	var b *retryBudgets
+	b.set("test-namespace/test-workload", pipelineRunWithTimeout(time.Now().Add(-2*time.Hour), time.Hour))
+	_, exhausted := b.exhausted("test-namespace/test-workload", time.Now())
+	assert.Assert(t, !exhausted)
+	b.clear("test-namespace/test-workload")
+}
+
+func pipelineRunWithTimeout(start time.Time, timeout time.Duration) *v1.PipelineRun {
+	return &v1.PipelineRun{
+		Spec: v1.PipelineRunSpec{Timeouts: &v1.TimeoutFields{Pipeline: &metav1.Duration{Duration: timeout}}},
+		Status: v1.PipelineRunStatus{
+			PipelineRunStatusFields: v1.PipelineRunStatusFields{StartTime: &metav1.Time{Time: start}},
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package reconciler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// tokenExpiresAtAnnotation is the expiry Pipelines-as-Code records on git-auth secrets, and
+	// expiresAtAnnotation the one recorded by the secret sources minting tokens, both RFC 3339.
+	tokenExpiresAtAnnotation = groupName + "/token-expires-at"
+	expiresAtAnnotation      = syncerGroupName + "/expires-at"
+
+	defaultTokenResyncMargin = 10 * time.Minute
+	// defaultClockSkewTolerance is how far the clocks of the hub, the spoke clusters and the
+	// token issuers are assumed to drift apart.
+	defaultClockSkewTolerance = 30 * time.Second
+)
+
+// secretExpiry returns when the token of the secret expires, from its expiry annotations or
+// the exp claim of a JWT token.
+func secretExpiry(secret *corev1.Secret) (time.Time, bool) {
+	for _, annotation := range []string{expiresAtAnnotation, tokenExpiresAtAnnotation} {
+		if value := secret.GetAnnotations()[annotation]; value != "" {
+			if expiry, err := time.Parse(time.RFC3339, value); err == nil {
+				return expiry, true
+			}
+		}
+	}
+	return jwtExpiry(secret.Data[defaultSecretDataKey])
+}
+
+// expiresSoon reports whether the token of the secret expires within the re-sync margin. The
+// clock skew tolerance widens the margin, the clock of the issuer of the token may be ahead.
+func (r *Reconciler) expiresSoon(secret *corev1.Secret) bool {
+	expiry, ok := secretExpiry(secret)
+	return ok && r.tokenResyncMargin > 0 && time.Until(expiry) <= r.tokenResyncMargin+r.clockSkew
+}
+
+// jwtExpiry returns the exp claim of a JWT, without verifying it.
+func jwtExpiry(token []byte) (time.Time, bool) {
+	parts := bytes.Split(bytes.TrimSpace(token), []byte("."))
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
+
+// resyncAfter returns how long to wait before syncing a token expiring at expiry again, false
+// when it has no known expiry or can't be refreshed in time anymore. The token is synced again
+// the clock skew tolerance earlier, so it is refreshed before a spoke or git server whose clock
+// is ahead considers it expired.
+func (r *Reconciler) resyncAfter(expiry time.Time) (time.Duration, bool) {
+	if r.tokenResyncMargin <= 0 || expiry.IsZero() {
+		return 0, false
+	}
+	delay := time.Until(expiry.Add(-r.tokenResyncMargin - r.clockSkew))
+	return delay, delay > 0
+}
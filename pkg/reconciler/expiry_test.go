@@ -0,0 +1,150 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func testJWT(exp time.Time) []byte {
+	encode := base64.RawURLEncoding.EncodeToString
+	return []byte(encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix()))) + ".c2lnbmF0dXJl")
+}
+
+func TestSecretExpiry(t *testing.T) {
+	expiry := time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		secret   *corev1.Secret
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name: "syncer annotation",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				expiresAtAnnotation:      "2026-01-01T11:00:00Z",
+				tokenExpiresAtAnnotation: "2026-01-01T12:00:00Z",
+			}}},
+			expected: expiry,
+			ok:       true,
+		},
+		{
+			name:     "pipelines-as-code annotation",
+			secret:   &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{tokenExpiresAtAnnotation: "2026-01-01T11:00:00Z"}}},
+			expected: expiry,
+			ok:       true,
+		},
+		{
+			name:     "jwt token",
+			secret:   &corev1.Secret{Data: map[string][]byte{defaultSecretDataKey: testJWT(expiry)}},
+			expected: expiry,
+			ok:       true,
+		},
+		{
+			name:   "opaque token",
+			secret: &corev1.Secret{Data: map[string][]byte{defaultSecretDataKey: []byte("ghp_token")}},
+		},
+		{
+			name:   "invalid annotation",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{tokenExpiresAtAnnotation: "tomorrow"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiry, ok := secretExpiry(tt.secret)
+			assert.Equal(t, tt.ok, ok)
+			assert.Assert(t, tt.expected.Equal(expiry), "expected %s, got %s", tt.expected, expiry)
+		})
+	}
+}
+
+func TestResyncAfter(t *testing.T) {
+	r := &Reconciler{tokenResyncMargin: 10 * time.Minute}
+
+	delay, ok := r.resyncAfter(time.Now().Add(time.Hour))
+	assert.Assert(t, ok)
+	assert.Assert(t, delay > 49*time.Minute && delay <= 50*time.Minute, "unexpected delay %s", delay)
+
+	_, ok = r.resyncAfter(time.Now().Add(5 * time.Minute))
+	assert.Assert(t, !ok, "a token that can't be refreshed in time is not re-synced")
+	_, ok = r.resyncAfter(time.Time{})
+	assert.Assert(t, !ok)
+
+	r.tokenResyncMargin = 0
+	_, ok = r.resyncAfter(time.Now().Add(time.Hour))
+	assert.Assert(t, !ok)
+}
+
+func TestClockSkewTolerance(t *testing.T) {
+	r := &Reconciler{tokenResyncMargin: 10 * time.Minute, clockSkew: 2 * time.Minute}
+
+	delay, ok := r.resyncAfter(time.Now().Add(time.Hour))
+	assert.Assert(t, ok)
+	assert.Assert(t, delay > 47*time.Minute && delay <= 48*time.Minute, "unexpected delay %s", delay)
+	_, ok = r.resyncAfter(time.Now().Add(11 * time.Minute))
+	assert.Assert(t, !ok, "a token expiring within the margin on a skewed clock is not re-synced")
+
+	expiring := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		expiresAtAnnotation: time.Now().Add(11 * time.Minute).UTC().Format(time.RFC3339),
+	}}}
+	assert.Assert(t, r.expiresSoon(expiring))
+	r.clockSkew = 0
+	assert.Assert(t, !r.expiresSoon(expiring))
+}
+
+func TestCreateSecretOnSpokeClusterRefreshesExpiringToken(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	expiring := testJWT(time.Now().Add(5 * time.Minute))
+	fresh := testJWT(time.Now().Add(time.Hour))
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{defaultSecretDataKey: fresh},
+	}
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+		Data:       map[string][]byte{defaultSecretDataKey: expiring},
+	})
+	r := &Reconciler{
+		logger:            zap.NewNop().Sugar(),
+		hubKubeClient:     fake.NewSimpleClientset(hubSecret),
+		tokenResyncMargin: 10 * time.Minute,
+	}
+
+	_, expiry, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, fresh, spokeSecret.Data[defaultSecretDataKey])
+	freshExpiry, _ := jwtExpiry(fresh)
+	assert.Assert(t, freshExpiry.Equal(expiry))
+
+	// Tokens far from their expiry synced before the checksum was recorded are left alone
+	delete(spokeSecret.Annotations, checksumAnnotation)
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Update(ctx, spokeSecret, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	hubSecret.Data = map[string][]byte{defaultSecretDataKey: testJWT(time.Now().Add(2 * time.Hour))}
+	r.hubKubeClient = fake.NewSimpleClientset(hubSecret)
+	_, expiry, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	spokeSecret, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, fresh, spokeSecret.Data[defaultSecretDataKey])
+	assert.Assert(t, freshExpiry.Equal(expiry))
+}
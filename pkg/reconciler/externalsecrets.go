@@ -0,0 +1,224 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	defaultExternalSecretsAPIVersion   = "external-secrets.io/v1"
+	defaultExternalSecretStoreKind     = "ClusterSecretStore"
+	defaultExternalSecretKeyTemplate   = "{namespace}/{name}"
+	defaultExternalSecretRefreshPeriod = "1h"
+
+	// externalSecretsDiscoveryTTL is how long the presence of the External Secrets Operator on a
+	// spoke cluster is remembered.
+	externalSecretsDiscoveryTTL = 5 * time.Minute
+)
+
+// externalSecretsOptions configures the external-secrets spoke secret mode.
+type externalSecretsOptions struct {
+	// apiVersion of the ExternalSecret resource served by the spoke clusters
+	apiVersion string
+	// storeName and storeKind reference the secret store shared by the spoke clusters
+	storeName string
+	storeKind string
+	// keyTemplate derives the remote key of a PipelineRun's credentials in the store, {namespace}
+	// and {name} are replaced by the PipelineRun namespace and the git-auth secret name.
+	keyTemplate string
+	// refreshInterval of the ExternalSecrets
+	refreshInterval string
+}
+
+func (o externalSecretsOptions) resource() schema.GroupVersionResource {
+	return schema.FromAPIVersionAndKind(o.apiVersion, "ExternalSecret").GroupVersion().WithResource("externalsecrets")
+}
+
+// externalSecretsDiscovery remembers which spoke clusters serve the ExternalSecret resource.
+type externalSecretsDiscovery struct {
+	// discovering serializes the discoveries of each spoke cluster
+	discovering keyedMutex
+
+	mu        sync.Mutex
+	installed map[string]bool
+	checkedAt map[string]time.Time
+}
+
+func newExternalSecretsDiscovery() *externalSecretsDiscovery {
+	return &externalSecretsDiscovery{installed: map[string]bool{}, checkedAt: map[string]time.Time{}}
+}
+
+// cached returns whether the spoke cluster serves the ExternalSecret resource, when it was
+// discovered within externalSecretsDiscoveryTTL.
+func (d *externalSecretsDiscovery) cached(clusterName string) (installed, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.checkedAt[clusterName]) >= externalSecretsDiscoveryTTL {
+		return false, false
+	}
+	return d.installed[clusterName], true
+}
+
+// externalSecretsInstalled reports whether the spoke cluster serves the ExternalSecret resource.
+// The discoveries of a cluster are serialized while the other clusters are discovered
+// concurrently, and a discovery is abandoned once the context is done.
+func (r *Reconciler) externalSecretsInstalled(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) (bool, error) {
+	d := r.externalSecretsDiscovery
+	if installed, ok := d.cached(clusterName); ok {
+		return installed, nil
+	}
+	unlock, err := d.discovering.lock(ctx, clusterName)
+	if err != nil {
+		return false, fmt.Errorf("could not discover the ExternalSecrets of spoke cluster %s: %w", clusterName, err)
+	}
+	defer unlock()
+	if installed, ok := d.cached(clusterName); ok {
+		return installed, nil
+	}
+
+	groupVersion := r.externalSecrets.resource().GroupVersion().String()
+	resources, err := withContext(ctx, func() (*metav1.APIResourceList, error) {
+		return spokeKubeClient.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("could not discover %s on spoke cluster %s: %w", groupVersion, clusterName, err)
+	}
+	installed := false
+	if err == nil {
+		for _, resource := range resources.APIResources {
+			if resource.Name == "externalsecrets" {
+				installed = true
+			}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.installed[clusterName] = installed
+	d.checkedAt[clusterName] = time.Now()
+	return installed, nil
+}
+
+// createExternalSecretOnSpokeCluster creates an ExternalSecret on the spoke cluster, so the
+// credentials are pulled from the shared store and never transit the hub controller. It returns
+// false when the External Secrets Operator isn't installed on the spoke, so the caller falls
+// back to copying the secret.
+func (r *Reconciler) createExternalSecretOnSpokeCluster(ctx context.Context, secretName, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) (bool, error) {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	installed, err := r.externalSecretsInstalled(spokeCtx, clusterName, spokeKubeClient)
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err != nil {
+		return false, err
+	}
+	if !installed {
+		r.logger.Infof("External Secrets Operator is not installed on spoke cluster %s, copying secret %s/%s instead", clusterName, pipelineRun.GetNamespace(), secretName)
+		return false, nil
+	}
+
+	spokeDynamicClient, err := r.spokeDynamicClient(ctx, clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "ExternalSecret created for PipelineRun dispatched to spoke cluster",
+		Cluster:     clusterName,
+		Secret:      pipelineRun.GetNamespace() + "/" + secretName,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}
+	// The store is shared by the namespaces, a PipelineRun only points at the keys of its own
+	remoteKey, err := secretReference(r.externalSecrets.keyTemplate, secretIDAnnotation, pipelineRun, secretName)
+	if err != nil {
+		r.logger.Errorf("error creating ExternalSecret %s/%s on spoke cluster %s: %v", syncer.SpokeNamespace(workload), secretName, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return false, err
+	}
+
+	externalSecret := r.newExternalSecret(secretName, remoteKey, pipelineRun, workload)
+	externalSecret.SetOwnerReferences(withPipelineRunAPIVersion(externalSecret.GetOwnerReferences(), r.spokePipelineRunAPIVersion(clusterName)))
+	created, err := spokeDynamicClient.Resource(r.externalSecrets.resource()).Namespace(syncer.SpokeNamespace(workload)).Create(spokeCtx, externalSecret, metav1.CreateOptions{})
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if errors.IsAlreadyExists(err) {
+		event.Outcome = auditOutcomeUnchanged
+	} else if err != nil {
+		r.logger.Errorf("error creating ExternalSecret %s/%s on spoke cluster %s: %v", syncer.SpokeNamespace(workload), secretName, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return false, err
+	} else {
+		event = event.withSpokeObject(created)
+		event.Outcome = auditOutcomeSuccess
+	}
+	r.recordDecision(event)
+
+	r.logger.Infof("successfully created ExternalSecret %s/%s for remote key %s on spoke cluster %s", syncer.SpokeNamespace(workload), secretName, remoteKey, clusterName)
+	return true, nil
+}
+
+// newExternalSecret returns the ExternalSecret extracting the remote key into the secret. Both
+// carry the tracking metadata, and the ExternalSecret is owned by the spoke PipelineRun.
+func (r *Reconciler) newExternalSecret(secretName, remoteKey string, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) *unstructured.Unstructured {
+	labels := map[string]any{managedByLabel: managedByValue}
+	annotations := map[string]any{
+		workloadAnnotation:    workload.GetNamespace() + "/" + workload.GetName(),
+		pipelineRunAnnotation: syncer.SpokeNamespace(workload) + "/" + pipelineRun.GetName(),
+	}
+
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": r.externalSecrets.apiVersion,
+		"kind":       "ExternalSecret",
+		"metadata": map[string]any{
+			"name":        secretName,
+			"namespace":   syncer.SpokeNamespace(workload),
+			"labels":      labels,
+			"annotations": annotations,
+			"ownerReferences": []any{map[string]any{
+				"apiVersion": v1.SchemeGroupVersion.String(),
+				"kind":       "PipelineRun",
+				"name":       pipelineRun.GetName(),
+				"uid":        string(pipelineRun.GetUID()),
+				"controller": true,
+			}},
+		},
+		"spec": map[string]any{
+			"refreshInterval": r.externalSecrets.refreshInterval,
+			"secretStoreRef": map[string]any{
+				"name": r.externalSecrets.storeName,
+				"kind": r.externalSecrets.storeKind,
+			},
+			"target": map[string]any{
+				"name":           secretName,
+				"creationPolicy": "Owner",
+				"deletionPolicy": "Delete",
+				"template": map[string]any{
+					"metadata": map[string]any{
+						"labels":      labels,
+						"annotations": annotations,
+					},
+				},
+			},
+			"dataFrom": []any{map[string]any{
+				"extract": map[string]any{"key": remoteKey},
+			}},
+		},
+	}}
+}
@@ -0,0 +1,213 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func newExternalSecretsReconciler(dynamicClient dynamic.Interface) *Reconciler {
+	return &Reconciler{
+		logger:          zap.NewNop().Sugar(),
+		hubKubeClient:   fake.NewSimpleClientset(),
+		spokeSecretMode: spokeSecretModeExternalSecrets,
+		externalSecrets: externalSecretsOptions{
+			apiVersion:      defaultExternalSecretsAPIVersion,
+			storeName:       "ci-store",
+			storeKind:       defaultExternalSecretStoreKind,
+			keyTemplate:     defaultExternalSecretKeyTemplate,
+			refreshInterval: defaultExternalSecretRefreshPeriod,
+		},
+		externalSecretsDiscovery: newExternalSecretsDiscovery(),
+		newSpokeDynamicClient: func(context.Context, string) (dynamic.Interface, error) {
+			return dynamicClient, nil
+		},
+	}
+}
+
+// spokeWithExternalSecrets returns a spoke client whose discovery serves the ExternalSecret resource.
+func spokeWithExternalSecrets() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.Resources = []*metav1.APIResourceList{{
+		GroupVersion: defaultExternalSecretsAPIVersion,
+		APIResources: []metav1.APIResource{{Name: "externalsecrets", Namespaced: true, Kind: "ExternalSecret"}},
+	}}
+	return client
+}
+
+func TestCreateExternalSecretOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	spokeKubeClient := spokeWithExternalSecrets()
+	r := newExternalSecretsReconciler(dynamicClient)
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	externalSecret, err := dynamicClient.Resource(r.externalSecrets.resource()).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, managedByValue, externalSecret.GetLabels()[managedByLabel])
+	assert.Equal(t, "test-namespace/test-workload", externalSecret.GetAnnotations()[workloadAnnotation])
+	assert.Equal(t, "spoke-uid", string(externalSecret.GetOwnerReferences()[0].UID))
+
+	store, _, _ := unstructured.NestedStringMap(externalSecret.Object, "spec", "secretStoreRef")
+	assert.DeepEqual(t, map[string]string{"name": "ci-store", "kind": "ClusterSecretStore"}, store)
+	dataFrom, _, _ := unstructured.NestedSlice(externalSecret.Object, "spec", "dataFrom")
+	key, _, _ := unstructured.NestedString(dataFrom[0].(map[string]any), "extract", "key")
+	assert.Equal(t, "test-namespace/test-secret", key)
+	targetLabels, _, _ := unstructured.NestedStringMap(externalSecret.Object, "spec", "target", "template", "metadata", "labels")
+	assert.Equal(t, managedByValue, targetLabels[managedByLabel])
+
+	// The secret data never transits the controller
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	// Creating it again is not an error
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+}
+
+func TestCreateExternalSecretWithSecretIDAnnotation(t *testing.T) {
+	tests := []struct {
+		name          string
+		secretID      string
+		expectedError string
+	}{
+		{
+			name:     "key of the namespace",
+			secretID: "test-namespace/github-token",
+		},
+		{
+			name:          "key of another namespace",
+			secretID:      "shared/github-token",
+			expectedError: `secret-syncer.tekton.dev/secret-id "shared/github-token" of PipelineRun test-namespace/test-pipeline-run is not under test-namespace/`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			pipelineRun := &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-pipeline-run",
+					Namespace:   "test-namespace",
+					Annotations: map[string]string{secretIDAnnotation: tt.secretID},
+				},
+			}
+			workload := &kueuev1beta1.Workload{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+			}
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			r := newExternalSecretsReconciler(dynamicClient)
+
+			_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeWithExternalSecrets(), pipelineRun, workload)
+			externalSecret, getErr := dynamicClient.Resource(r.externalSecrets.resource()).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				assert.Equal(t, secretReferenceForbiddenReason, rejectionReason(err))
+				assert.Assert(t, errors.IsNotFound(getErr))
+				return
+			}
+			assert.NilError(t, err)
+			assert.NilError(t, getErr)
+			dataFrom, _, _ := unstructured.NestedSlice(externalSecret.Object, "spec", "dataFrom")
+			key, _, _ := unstructured.NestedString(dataFrom[0].(map[string]any), "extract", "key")
+			assert.Equal(t, tt.secretID, key)
+		})
+	}
+}
+
+func TestCreateExternalSecretFallsBackToCopy(t *testing.T) {
+	ctx := context.Background()
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"token": []byte("secret-token")},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	// The spoke doesn't serve external-secrets.io
+	spokeKubeClient := fake.NewSimpleClientset()
+	r := newExternalSecretsReconciler(dynamicClient)
+	r.hubKubeClient = fake.NewSimpleClientset(hubSecret)
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hubSecret.Data, spokeSecret.Data)
+	_, err = dynamicClient.Resource(r.externalSecrets.resource()).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
+
+func TestDeleteExternalSecretOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	externalSecret := &unstructured.Unstructured{}
+	externalSecret.SetAPIVersion(defaultExternalSecretsAPIVersion)
+	externalSecret.SetKind("ExternalSecret")
+	externalSecret.SetNamespace("test-namespace")
+	externalSecret.SetName("test-secret")
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), externalSecret)
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+	})
+	r := newExternalSecretsReconciler(dynamicClient)
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "test"))
+	_, err := dynamicClient.Resource(r.externalSecrets.resource()).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	// Deleting an already deleted ExternalSecret is not an error
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "test"))
+}
+
+func TestParseSpokeSecretMode(t *testing.T) {
+	tests := []struct {
+		value         string
+		expected      string
+		expectedError string
+	}{
+		{value: "", expected: spokeSecretModeCopy},
+		{value: "copy", expected: spokeSecretModeCopy},
+		{value: "external-secrets", expected: spokeSecretModeExternalSecrets},
+		{value: "eso", expectedError: `unsupported spoke secret mode "eso"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mode, err := parseSpokeSecretMode(tt.value)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package reconciler
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/configmap"
+)
+
+// defaultFeatureFlagsConfigMap is the ConfigMap of the system namespace toggling the feature gates.
+const defaultFeatureFlagsConfigMap = "config-feature-flags"
+
+// Feature gates of the behaviors which ship disabled until an environment turns them on. They are
+// configured as usual, by their environment variables or registrations, and stay inactive while
+// their gate is disabled in the feature flags ConfigMap.
+const (
+	// featurePullAgent serves the secrets pulled by the spoke agents of SPOKE_SECRET_MODE=pull.
+	featurePullAgent = "pull-agent"
+	// featureSecretRotation rotates the credentials of long running PipelineRuns, see
+	// ROTATION_THRESHOLD.
+	featureSecretRotation = "secret-rotation"
+	// featurePreSyncHooks runs the pre-sync hooks registered with RegisterPreSyncHook.
+	featurePreSyncHooks = "pre-sync-hooks"
+)
+
+// defaultFeatureGates holds every known gate with its default, which is how gates set neither in
+// the ConfigMap nor by FEATURE_GATES are resolved. The gates default to disabled, configuring a
+// behavior alone doesn't turn it on.
+var defaultFeatureGates = map[string]bool{
+	featurePullAgent:      false,
+	featureSecretRotation: false,
+	featurePreSyncHooks:   false,
+}
+
+// optedInFeatures returns the gates of the behaviors the options or the registered hooks turn
+// on, with what turned them on.
+func optedInFeatures(opts *options, hooks *syncHookRegistry) map[string]string {
+	optedIn := map[string]string{}
+	if opts.spokeSecretMode == spokeSecretModePull {
+		optedIn[featurePullAgent] = "SPOKE_SECRET_MODE=" + spokeSecretModePull
+	}
+	if opts.rotationThreshold > 0 {
+		optedIn[featureSecretRotation] = "ROTATION_THRESHOLD"
+	}
+	if hooks.hasPre() {
+		optedIn[featurePreSyncHooks] = "RegisterPreSyncHook"
+	}
+	return optedIn
+}
+
+// featureGates holds the gates of the feature flags ConfigMap, updated as it changes. A nil
+// featureGates resolves every gate to its default.
+type featureGates struct {
+	logger *zap.SugaredLogger
+
+	// defaults are the gates of FEATURE_GATES, which the ConfigMap overrides
+	defaults map[string]bool
+	// optedIn are the gates of the configured behaviors, whose gates are expected on
+	optedIn map[string]string
+
+	mu      sync.RWMutex
+	enabled map[string]bool
+	// changed is called after the gates changed, nil when unset
+	changed func()
+}
+
+func newFeatureGates(logger *zap.SugaredLogger) *featureGates {
+	return &featureGates{logger: logger, enabled: map[string]bool{}}
+}
+
+// isEnabled reports whether the gate is enabled.
+func (f *featureGates) isEnabled(gate string) bool {
+	if f == nil {
+		return defaultFeatureGates[gate]
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if enabled, ok := f.enabled[gate]; ok {
+		return enabled
+	}
+	if enabled, ok := f.defaults[gate]; ok {
+		return enabled
+	}
+	return defaultFeatureGates[gate]
+}
+
+// update replaces the gates by the ones of the ConfigMap. An invalid ConfigMap is logged and the
+// previous gates are kept, so a typo doesn't turn features off.
+func (f *featureGates) update(cm *corev1.ConfigMap) {
+	enabled, err := parseFeatureGates(cm.Data)
+	if err != nil {
+		f.logger.Errorf("ignoring invalid feature flags ConfigMap %s/%s: %v", cm.Namespace, cm.Name, err)
+		return
+	}
+
+	f.mu.Lock()
+	previous, changed := f.enabled, f.changed
+	f.enabled = enabled
+	f.mu.Unlock()
+
+	gates := make([]string, 0, len(defaultFeatureGates))
+	for gate := range defaultFeatureGates {
+		gates = append(gates, fmt.Sprintf("%s=%t", gate, f.isEnabled(gate)))
+	}
+	sort.Strings(gates)
+	f.logger.Infof("Feature gates: %s", strings.Join(gates, ", "))
+	f.warnDisabled()
+
+	if changed != nil && !maps.Equal(previous, enabled) {
+		changed()
+	}
+}
+
+// warnDisabled logs the behaviors which are configured while their gate is disabled, so they
+// don't silently stay inactive.
+func (f *featureGates) warnDisabled() {
+	gates := make([]string, 0, len(f.optedIn))
+	for gate := range f.optedIn {
+		gates = append(gates, gate)
+	}
+	sort.Strings(gates)
+	for _, gate := range gates {
+		if !f.isEnabled(gate) {
+			f.logger.Warnf("%s is set but the %s feature gate is disabled, enable it in the feature flags ConfigMap or FEATURE_GATES", f.optedIn[gate], gate)
+		}
+	}
+}
+
+// onChange registers the function called after the gates changed, e.g. to resync the Workloads
+// so the new gates take effect without restarting the controller.
+func (f *featureGates) onChange(changed func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changed = changed
+}
+
+// parseFeatureGates parses the gates of the feature flags ConfigMap data, rejecting unknown gates
+// and values which aren't booleans.
+func parseFeatureGates(data map[string]string) (map[string]bool, error) {
+	enabled := make(map[string]bool, len(data))
+	for gate, value := range data {
+		if _, ok := defaultFeatureGates[gate]; !ok {
+			return nil, fmt.Errorf("unknown feature gate %q", gate)
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q of feature gate %s, must be true or false", value, gate)
+		}
+		enabled[gate] = parsed
+	}
+	return enabled, nil
+}
+
+// parseFeatureGateList parses FEATURE_GATES, a comma separated list of gate=true|false.
+func parseFeatureGateList(value string) (map[string]bool, error) {
+	data := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		gate, enabled, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid feature gate %q, must be gate=true or gate=false", pair)
+		}
+		data[strings.TrimSpace(gate)] = strings.TrimSpace(enabled)
+	}
+	return parseFeatureGates(data)
+}
+
+// watch keeps the gates up to date with the ConfigMap, which may not exist.
+func (f *featureGates) watch(cmw configmap.Watcher, namespace, name string) {
+	if dw, ok := cmw.(configmap.DefaultingWatcher); ok {
+		dw.WatchWithDefault(corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}, f.update)
+		return
+	}
+	cmw.Watch(name, f.update)
+}
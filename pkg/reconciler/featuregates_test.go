@@ -0,0 +1,138 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	zapobserver "go.uber.org/zap/zaptest/observer"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/configmap"
+)
+
+// enabledFeatureGates returns the feature gates with the given gates enabled.
+func enabledFeatureGates(gates ...string) *featureGates {
+	f := newFeatureGates(zap.NewNop().Sugar())
+	for _, gate := range gates {
+		f.enabled[gate] = true
+	}
+	return f
+}
+
+// disabledFeatureGates returns the feature gates with the given gates disabled.
+func disabledFeatureGates(gates ...string) *featureGates {
+	f := newFeatureGates(zap.NewNop().Sugar())
+	for _, gate := range gates {
+		f.enabled[gate] = false
+	}
+	return f
+}
+
+func TestFeatureGates(t *testing.T) {
+	featureFlags := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultFeatureFlagsConfigMap, Namespace: "syncer-service"}, Data: data}
+	}
+
+	var nilGates *featureGates
+	assert.Assert(t, !nilGates.isEnabled(featurePullAgent), "a nil featureGates resolves the defaults")
+
+	// Every gate ships disabled
+	f := newFeatureGates(zap.NewNop().Sugar())
+	assert.Assert(t, !f.isEnabled(featurePullAgent))
+	assert.Assert(t, !f.isEnabled(featureSecretRotation))
+	assert.Assert(t, !f.isEnabled(featurePreSyncHooks))
+
+	f.update(featureFlags(map[string]string{featurePullAgent: "true", featureSecretRotation: "false"}))
+	assert.Assert(t, f.isEnabled(featurePullAgent))
+	assert.Assert(t, !f.isEnabled(featureSecretRotation))
+
+	// Invalid ConfigMaps keep the previous gates
+	f.update(featureFlags(map[string]string{featurePullAgent: "yes please"}))
+	assert.Assert(t, f.isEnabled(featurePullAgent))
+	f.update(featureFlags(map[string]string{"pre-sync": "true"}))
+	assert.Assert(t, f.isEnabled(featurePullAgent))
+
+	// Removed gates go back to their defaults
+	f.update(featureFlags(nil))
+	assert.Assert(t, !f.isEnabled(featurePullAgent))
+}
+
+func TestFeatureGatesDefaults(t *testing.T) {
+	f := newFeatureGates(zap.NewNop().Sugar())
+	f.defaults = map[string]bool{featurePullAgent: true}
+	assert.Assert(t, f.isEnabled(featurePullAgent), "FEATURE_GATES enables the gates the ConfigMap doesn't set")
+	assert.Assert(t, !f.isEnabled(featureSecretRotation))
+
+	f.update(&corev1.ConfigMap{Data: map[string]string{featurePullAgent: "false"}})
+	assert.Assert(t, !f.isEnabled(featurePullAgent), "the ConfigMap overrides FEATURE_GATES")
+}
+
+func TestFeatureGatesWarnDisabled(t *testing.T) {
+	core, logs := zapobserver.New(zap.WarnLevel)
+	f := newFeatureGates(zap.New(core).Sugar())
+	f.optedIn = optedInFeatures(&options{spokeSecretMode: spokeSecretModePull, rotationThreshold: time.Hour}, nil)
+	assert.DeepEqual(t, map[string]string{featurePullAgent: "SPOKE_SECRET_MODE=pull", featureSecretRotation: "ROTATION_THRESHOLD"}, f.optedIn)
+
+	// Only the configured behaviors whose gate is off are warned about
+	f.update(&corev1.ConfigMap{Data: map[string]string{featurePullAgent: "true"}})
+	entries := logs.TakeAll()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "ROTATION_THRESHOLD is set but the secret-rotation feature gate is disabled, enable it in the feature flags ConfigMap or FEATURE_GATES", entries[0].Message)
+
+	f.update(&corev1.ConfigMap{Data: map[string]string{featurePullAgent: "true", featureSecretRotation: "true"}})
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestParseFeatureGateList(t *testing.T) {
+	enabled, err := parseFeatureGateList(" pull-agent=true,,secret-rotation = false ")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]bool{featurePullAgent: true, featureSecretRotation: false}, enabled)
+
+	_, err = parseFeatureGateList("pull-agent")
+	assert.ErrorContains(t, err, `invalid feature gate "pull-agent", must be gate=true or gate=false`)
+}
+
+func TestParseFeatureGates(t *testing.T) {
+	enabled, err := parseFeatureGates(map[string]string{featurePullAgent: "true", featureSecretRotation: "False"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]bool{featurePullAgent: true, featureSecretRotation: false}, enabled)
+
+	_, err = parseFeatureGates(map[string]string{"pre-sync": "true"})
+	assert.ErrorContains(t, err, `unknown feature gate "pre-sync"`)
+
+	_, err = parseFeatureGates(map[string]string{featureSecretRotation: "on"})
+	assert.ErrorContains(t, err, `invalid value "on" of feature gate secret-rotation`)
+}
+
+func TestFeatureGatesWatch(t *testing.T) {
+	cmw := configmap.NewStaticWatcher(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultFeatureFlagsConfigMap, Namespace: "syncer-service"},
+		Data:       map[string]string{featureSecretRotation: "true"},
+	})
+	f := newFeatureGates(zap.NewNop().Sugar())
+	f.watch(cmw, "syncer-service", defaultFeatureFlagsConfigMap)
+	assert.NilError(t, cmw.Start(nil))
+	assert.Assert(t, f.isEnabled(featureSecretRotation))
+}
+
+func TestFeatureGatesOnChange(t *testing.T) {
+	featureFlags := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultFeatureFlagsConfigMap, Namespace: "syncer-service"}, Data: data}
+	}
+	f := newFeatureGates(zap.NewNop().Sugar())
+	changes := 0
+	f.onChange(func() { changes++ })
+
+	f.update(featureFlags(map[string]string{featureSecretRotation: "true"}))
+	assert.Equal(t, 1, changes)
+
+	// Neither an unchanged nor an invalid ConfigMap resyncs
+	f.update(featureFlags(map[string]string{featureSecretRotation: "true"}))
+	f.update(featureFlags(map[string]string{featureSecretRotation: "on"}))
+	assert.Equal(t, 1, changes)
+
+	f.update(featureFlags(nil))
+	assert.Equal(t, 2, changes)
+}
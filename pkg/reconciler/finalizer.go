@@ -0,0 +1,380 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+const (
+	syncerGroupName = "secret-syncer.tekton.dev"
+
+	// cleanupFinalizer is added to the PipelineRun owned Workloads by the generated reconciler,
+	// so the synced secrets can be removed from the spoke cluster before the Workload goes away.
+	cleanupFinalizer = syncerGroupName + "/cleanup"
+
+	// hubSecretFinalizer is optionally added to the hub secret while the spoke PipelineRun is
+	// running, so the hub secret outlives auto-cleanup by Pipelines-as-Code.
+	hubSecretFinalizer = syncerGroupName + "/in-use"
+
+	// syncedSecretsAnnotation records the secrets synced for a Workload as a comma separated
+	// list of cluster/namespace/name entries.
+	syncedSecretsAnnotation = syncerGroupName + "/synced-secrets"
+
+	// syncedConfigMapsAnnotation records the ConfigMaps synced for a Workload, in the format of
+	// the syncedSecretsAnnotation.
+	syncedConfigMapsAnnotation = syncerGroupName + "/synced-configmaps"
+)
+
+// RetainPolicy decides what happens to synced secrets on the spoke cluster when the Workload is deleted.
+type RetainPolicy string
+
+const (
+	// RetainPolicyDelete removes the synced secrets from the spoke cluster.
+	RetainPolicyDelete RetainPolicy = "Delete"
+	// RetainPolicyRetain leaves the synced secrets on the spoke cluster, they are then only
+	// garbage collected through their owner references.
+	RetainPolicyRetain RetainPolicy = "Retain"
+)
+
+// parseRetainPolicy parses the retain policy, an empty value resolves to RetainPolicyDelete.
+func parseRetainPolicy(value string) (RetainPolicy, error) {
+	switch RetainPolicy(value) {
+	case "", RetainPolicyDelete:
+		return RetainPolicyDelete, nil
+	case RetainPolicyRetain:
+		return RetainPolicyRetain, nil
+	default:
+		return "", fmt.Errorf("unsupported retain policy %q, must be one of %s or %s", value, RetainPolicyDelete, RetainPolicyRetain)
+	}
+}
+
+// syncedSecretRef identifies a secret, or a ConfigMap, synced to a spoke cluster.
+type syncedSecretRef struct {
+	Cluster   string
+	Namespace string
+	Name      string
+}
+
+func (s syncedSecretRef) String() string {
+	return s.Cluster + "/" + s.Namespace + "/" + s.Name
+}
+
+// hubSecretName returns the name of the hub secret the spoke secret was synced from, without
+// the suffix of the conflict policy.
+func (s syncedSecretRef) hubSecretName() string {
+	return strings.TrimSuffix(s.Name, conflictSecretSuffix)
+}
+
+// syncedSecretRefs returns the secrets recorded on the Workload by the syncer.
+func syncedSecretRefs(workload *kueuev1beta1.Workload) []syncedSecretRef {
+	return parseSyncedRefs(workload.GetAnnotations()[syncedSecretsAnnotation])
+}
+
+// syncedConfigMapRefs returns the ConfigMaps recorded on the Workload by the syncer.
+func syncedConfigMapRefs(workload *kueuev1beta1.Workload) []syncedSecretRef {
+	return parseSyncedRefs(workload.GetAnnotations()[syncedConfigMapsAnnotation])
+}
+
+func parseSyncedRefs(value string) []syncedSecretRef {
+	if value == "" {
+		return nil
+	}
+
+	var refs []syncedSecretRef
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(entry, "/")
+		if len(parts) != 3 {
+			continue
+		}
+		refs = append(refs, syncedSecretRef{Cluster: parts[0], Namespace: parts[1], Name: parts[2]})
+	}
+	return refs
+}
+
+// formatSyncedSecretRefs is the inverse of parseSyncedRefs.
+func formatSyncedSecretRefs(refs []syncedSecretRef) string {
+	entries := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		entries = append(entries, ref.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// recordSynced adds the cleanup finalizer and records the synced secrets and ConfigMaps on the
+// Workload, with a single patch as the resourceVersion precondition rejects a second one.
+func (r *Reconciler) recordSynced(ctx context.Context, workload *kueuev1beta1.Workload, secrets, configMaps []syncedSecretRef) error {
+	secretRefs, secretsRecorded := appendSyncedRefs(syncedSecretRefs(workload), secrets)
+	configMapRefs, configMapsRecorded := appendSyncedRefs(syncedConfigMapRefs(workload), configMaps)
+	hasFinalizer := slices.Contains(workload.GetFinalizers(), cleanupFinalizer)
+	if hasFinalizer && secretsRecorded && configMapsRecorded {
+		return nil
+	}
+
+	annotations := map[string]any{syncedSecretsAnnotation: formatSyncedSecretRefs(secretRefs)}
+	if len(configMapRefs) > 0 {
+		annotations[syncedConfigMapsAnnotation] = formatSyncedSecretRefs(configMapRefs)
+	}
+
+	finalizers := workload.GetFinalizers()
+	if !hasFinalizer {
+		finalizers = append(slices.Clone(finalizers), cleanupFinalizer)
+	}
+
+	if err := r.patchWorkloadMetadata(ctx, workload, finalizers, annotations); err != nil {
+		return fmt.Errorf("could not add finalizer to workload %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+	}
+
+	r.logger.Infof("added finalizer %s to workload %s/%s", cleanupFinalizer, workload.GetNamespace(), workload.GetName())
+	return nil
+}
+
+// recordPartiallySynced records the secrets which synced in a batch that failed, so they are
+// cleaned up even when the Workload is deleted before a sync succeeds, and reports whether there
+// were any and they were recorded. Failing to record them is only logged, the batch is retried.
+func (r *Reconciler) recordPartiallySynced(ctx context.Context, workload *kueuev1beta1.Workload, refs []syncedSecretRef) bool {
+	if len(refs) == 0 {
+		return false
+	}
+	if err := r.recordSynced(ctx, workload, refs, nil); err != nil {
+		r.logger.Errorf("error recording the synced secrets of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		return false
+	}
+	return true
+}
+
+// appendSyncedRefs appends the synced refs missing from refs, and reports whether none was.
+func appendSyncedRefs(refs, synced []syncedSecretRef) ([]syncedSecretRef, bool) {
+	recorded := true
+	for _, ref := range synced {
+		if !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+			recorded = false
+		}
+	}
+	return refs, recorded
+}
+
+// finalize removes the synced secrets and ConfigMaps from the spoke clusters, according to the
+// retain policy of the sync policy of the Workload namespace.
+// The generated reconciler then releases the Workload by removing the cleanup finalizer.
+func (r *Reconciler) finalize(ctx context.Context, workload *kueuev1beta1.Workload) error {
+	if !slices.Contains(workload.GetFinalizers(), cleanupFinalizer) {
+		return nil
+	}
+
+	policy, err := r.syncPolicy(ctx, workload.GetNamespace())
+	if err != nil {
+		r.logger.Errorf("error resolving the sync policy of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		return err
+	}
+	if policy.retainPolicy == RetainPolicyRetain {
+		r.logger.Infof("retain policy is %s, keeping synced secrets of workload %s/%s", policy.retainPolicy, workload.GetNamespace(), workload.GetName())
+		for _, ref := range syncedSecretRefs(workload) {
+			r.recordDecision(auditEvent{
+				Action:   auditActionRetain,
+				Outcome:  auditOutcomeSuccess,
+				Reason:   "Workload deleted with the Retain policy",
+				Cluster:  ref.Cluster,
+				Secret:   ref.Namespace + "/" + ref.Name,
+				Workload: workload.GetNamespace() + "/" + workload.GetName(),
+			})
+		}
+	} else {
+		for _, ref := range syncedSecretRefs(workload) {
+			spokeKubeClient, _, err := r.getSpokeClients(ctx, ref.Cluster)
+			if err != nil {
+				r.logger.Errorf("error creating spoke clients for cluster %s: %v", ref.Cluster, err)
+				return err
+			}
+
+			if err := r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, workload.GetNamespace()+"/"+workload.GetName(), "Workload deleted"); err != nil {
+				return err
+			}
+			if err := r.deleteKnownHosts(ctx, spokeKubeClient, ref, workload.GetNamespace()+"/"+workload.GetName()); err != nil {
+				r.logger.Errorf("error deleting the known_hosts of secret %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+				return err
+			}
+		}
+		for _, ref := range syncedConfigMapRefs(workload) {
+			spokeKubeClient, _, err := r.getSpokeClients(ctx, ref.Cluster)
+			if err != nil {
+				r.logger.Errorf("error creating spoke clients for cluster %s: %v", ref.Cluster, err)
+				return err
+			}
+
+			if err := r.deleteConfigMapOnSpokeCluster(ctx, spokeKubeClient, ref, workload.GetNamespace()+"/"+workload.GetName()); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ref := range syncedSecretRefs(workload) {
+		if err := r.releaseHubSecret(ctx, workload, ref.hubSecretName()); err != nil {
+			return err
+		}
+		r.quotas.release(ref)
+	}
+
+	if err := r.removeSyncStatus(ctx, workload); err != nil {
+		r.logger.Errorf("error removing the sync status of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+	}
+	return nil
+}
+
+// patchWorkloadMetadata merge patches the finalizers and the given annotations of the Workload.
+// The cached Workload may have been stripped by the informer transform, so it must never be sent
+// back with an update; the resourceVersion precondition still rejects conflicting writes.
+func (r *Reconciler) patchWorkloadMetadata(ctx context.Context, workload *kueuev1beta1.Workload, finalizers []string, annotations map[string]any) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	metadata := map[string]any{"finalizers": finalizers}
+	if rv := workload.GetResourceVersion(); rv != "" {
+		metadata["resourceVersion"] = rv
+	}
+	if annotations != nil {
+		metadata["annotations"] = annotations
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.kueueClient.KueueV1beta1().Workloads(workload.GetNamespace()).Patch(ctx, workload.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (r *Reconciler) deleteSecretOnSpokeCluster(ctx context.Context, spokeKubeClient kubernetes.Interface, ref syncedSecretRef, workloadKey, reason string) error {
+	if err := r.deleteSpokeSecretResource(ctx, ref); err != nil {
+		r.logger.Errorf("error deleting secret resource %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+		return err
+	}
+
+	event := auditEvent{
+		Action:   auditActionDelete,
+		Outcome:  auditOutcomeSuccess,
+		Reason:   reason,
+		Cluster:  ref.Cluster,
+		Secret:   ref.Namespace + "/" + ref.Name,
+		Workload: workloadKey,
+	}
+	// The secret is read first so its UID is audited, and only that object is deleted
+	spokeCtx, cancel := r.spokeContext(ctx)
+	existing, err := spokeKubeClient.CoreV1().Secrets(ref.Namespace).Get(spokeCtx, ref.Name, metav1.GetOptions{})
+	cancel()
+	if err = spokeError(err); err == nil {
+		event = event.withSpokeObject(existing)
+		// The parts go first, a failure leaves the secret listing them for the retry
+		if err := r.deleteSecretParts(ctx, spokeKubeClient, existing, ref, workloadKey, reason); err != nil {
+			r.logger.Errorf("error deleting the parts of secret %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+			return err
+		}
+		spokeCtx, cancel := r.spokeContext(ctx)
+		err = spokeError(spokeKubeClient.CoreV1().Secrets(ref.Namespace).Delete(spokeCtx, ref.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &existing.UID}}))
+		cancel()
+	}
+	if errors.IsNotFound(err) {
+		event.Outcome = auditOutcomeUnchanged
+	} else if err != nil {
+		r.logger.Errorf("error deleting secret %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return err
+	}
+	r.recordDecision(event)
+	r.quotas.release(ref)
+
+	r.logger.Infof("deleted secret %s/%s on spoke cluster %s", ref.Namespace, ref.Name, ref.Cluster)
+	return nil
+}
+
+// ensureHubSecretFinalizer adds the in-use finalizer to the hub secret, when enabled.
+func (r *Reconciler) ensureHubSecretFinalizer(ctx context.Context, secret *corev1.Secret) error {
+	if !r.hubSecretFinalizer || slices.Contains(secret.GetFinalizers(), hubSecretFinalizer) {
+		return nil
+	}
+
+	// New finalizers can't be added to objects being deleted
+	if secret.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	secret = secret.DeepCopy()
+	secret.SetFinalizers(append(secret.GetFinalizers(), hubSecretFinalizer))
+	if _, err := r.hubKubeClient.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not add finalizer to secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	r.logger.Infof("added finalizer %s to secret %s/%s", hubSecretFinalizer, secret.Namespace, secret.Name)
+	return nil
+}
+
+// releaseHubSecret removes the in-use finalizer from the hub secret synced for the Workload, once
+// no other active Workload of the namespace synced it. It is a no-op if the secret is gone or
+// doesn't carry the finalizer, so it is safe to call even when the feature is disabled.
+func (r *Reconciler) releaseHubSecret(ctx context.Context, workload *kueuev1beta1.Workload, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	namespace := workload.GetNamespace()
+	secret, err := r.hubKubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get secret %s/%s: %w", namespace, name, err)
+	}
+
+	if !slices.Contains(secret.GetFinalizers(), hubSecretFinalizer) {
+		return nil
+	}
+	if inUse, err := r.hubSecretInUse(workload, name); err != nil || inUse {
+		return err
+	}
+
+	secret = secret.DeepCopy()
+	secret.SetFinalizers(slices.DeleteFunc(secret.GetFinalizers(), func(f string) bool { return f == hubSecretFinalizer }))
+	if _, err := r.hubKubeClient.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not remove finalizer from secret %s/%s: %w", namespace, name, err)
+	}
+
+	r.logger.Infof("removed finalizer %s from secret %s/%s", hubSecretFinalizer, namespace, name)
+	return nil
+}
+
+// hubSecretInUse reports whether a Workload of the namespace other than the released one, neither
+// deactivated nor cleaning up, synced the hub secret, whose spoke copies it may still repair.
+func (r *Reconciler) hubSecretInUse(released *kueuev1beta1.Workload, name string) (bool, error) {
+	workloads, err := r.workloadLister.Workloads(released.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		return false, fmt.Errorf("could not list the workloads of namespace %s: %w", released.GetNamespace(), err)
+	}
+	for _, workload := range workloads {
+		if workload.GetName() == released.GetName() || needsCleanup(workload) || (workload.Spec.Active != nil && !*workload.Spec.Active) {
+			continue
+		}
+		for _, ref := range syncedSecretRefs(workload) {
+			if ref.hubSecretName() == name {
+				r.logger.Infof("keeping finalizer %s of secret %s/%s, workload %s/%s still uses it", hubSecretFinalizer, released.GetNamespace(), name, workload.GetNamespace(), workload.GetName())
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,299 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestParseRetainPolicy(t *testing.T) {
+	tests := []struct {
+		value          string
+		expectedPolicy RetainPolicy
+		expectError    bool
+	}{
+		{value: "", expectedPolicy: RetainPolicyDelete},
+		{value: "Delete", expectedPolicy: RetainPolicyDelete},
+		{value: "Retain", expectedPolicy: RetainPolicyRetain},
+		{value: "retain", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			policy, err := parseRetainPolicy(tt.value)
+			if tt.expectError {
+				assert.ErrorContains(t, err, "unsupported retain policy")
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedPolicy, policy)
+		})
+	}
+}
+
+func TestSyncedSecretRefs(t *testing.T) {
+	refs := []syncedSecretRef{
+		{Cluster: "cluster-1", Namespace: "ns", Name: "secret-1"},
+		{Cluster: "cluster-2", Namespace: "ns", Name: "secret-2"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				syncedSecretsAnnotation: formatSyncedSecretRefs(refs) + ",malformed",
+			},
+		},
+	}
+
+	assert.DeepEqual(t, refs, syncedSecretRefs(workload))
+	assert.Assert(t, syncedSecretRefs(&kueuev1beta1.Workload{}) == nil)
+}
+
+func TestRecordSynced(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-workload",
+			Namespace: "test-namespace",
+		},
+	}
+	fakeKueueClient := kueuefake.NewSimpleClientset(workload)
+	r := &Reconciler{
+		logger:      zap.NewNop().Sugar(),
+		kueueClient: fakeKueueClient,
+	}
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+
+	assert.NilError(t, r.recordSynced(ctx, workload, []syncedSecretRef{ref}, nil))
+
+	updated, err := fakeKueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{cleanupFinalizer}, updated.GetFinalizers())
+	assert.DeepEqual(t, []syncedSecretRef{ref}, syncedSecretRefs(updated))
+	assert.Assert(t, len(workload.GetFinalizers()) == 0, "informer copy must not be mutated")
+
+	// Calling it again with the same secret must not issue another update
+	fakeKueueClient.ClearActions()
+	assert.NilError(t, r.recordSynced(ctx, updated, []syncedSecretRef{ref}, nil))
+	assert.Equal(t, 0, len(fakeKueueClient.Actions()))
+}
+
+func TestRecordSyncedConfigMaps(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-workload",
+			Namespace: "test-namespace",
+		},
+	}
+	fakeKueueClient := kueuefake.NewSimpleClientset(workload)
+	r := &Reconciler{
+		logger:      zap.NewNop().Sugar(),
+		kueueClient: fakeKueueClient,
+	}
+	secret := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+	configMap := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "ca-bundle"}
+
+	// The secrets and ConfigMaps are recorded with a single patch
+	assert.NilError(t, r.recordSynced(ctx, workload, []syncedSecretRef{secret}, []syncedSecretRef{configMap}))
+	assert.Equal(t, 1, len(fakeKueueClient.Actions()))
+	updated, err := fakeKueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{cleanupFinalizer}, updated.GetFinalizers())
+	assert.DeepEqual(t, []syncedSecretRef{secret}, syncedSecretRefs(updated))
+	assert.DeepEqual(t, []syncedSecretRef{configMap}, syncedConfigMapRefs(updated))
+
+	fakeKueueClient.ClearActions()
+	assert.NilError(t, r.recordSynced(ctx, updated, []syncedSecretRef{secret}, []syncedSecretRef{configMap}))
+	assert.Equal(t, 0, len(fakeKueueClient.Actions()))
+}
+
+func TestRecordPartiallySynced(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-workload",
+			Namespace: "test-namespace",
+		},
+	}
+	fakeKueueClient := kueuefake.NewSimpleClientset(workload)
+	r := &Reconciler{
+		logger:      zap.NewNop().Sugar(),
+		kueueClient: fakeKueueClient,
+	}
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+
+	// A batch failing before any secret synced records nothing
+	assert.Assert(t, !r.recordPartiallySynced(ctx, workload, nil))
+	assert.Equal(t, 0, len(fakeKueueClient.Actions()))
+
+	// The secrets synced before the failure are recorded for the cleanup
+	assert.Assert(t, r.recordPartiallySynced(ctx, workload, []syncedSecretRef{ref}))
+	updated, err := fakeKueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{cleanupFinalizer}, updated.GetFinalizers())
+	assert.DeepEqual(t, []syncedSecretRef{ref}, syncedSecretRefs(updated))
+
+	// Failing to record them only reports it
+	missing := workload.DeepCopy()
+	missing.Name = "missing-workload"
+	assert.Assert(t, !r.recordPartiallySynced(ctx, missing, []syncedSecretRef{ref}))
+}
+
+func TestFinalizeWithRetainPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := metav1.Now()
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-workload",
+			Namespace:         "test-namespace",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"other-finalizer", cleanupFinalizer},
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+			Annotations: map[string]string{
+				syncedSecretsAnnotation: "unknown-cluster/test-namespace/test-secret",
+			},
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(workload))
+	fakeKueueClient := kueuefake.NewSimpleClientset(workload)
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		hubKubeClient:  fake.NewSimpleClientset(),
+		kueueClient:    fakeKueueClient,
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+		recorder:       record.NewFakeRecorder(10),
+		tracker:        newReconcileTracker(),
+		retainPolicy:   RetainPolicyRetain,
+	}
+	rec := newWorkloadReconciler(ctx, r)
+	assert.NilError(t, rec.(reconciler.LeaderAware).Promote(reconciler.UniversalBucket(), nil))
+
+	// The spoke cluster is never contacted with the retain policy
+	assert.NilError(t, rec.Reconcile(ctx, "test-namespace/test-workload"))
+
+	updated, err := fakeKueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"other-finalizer"}, updated.GetFinalizers())
+}
+
+func TestDeleteSecretOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", UID: "6f1e3a52-9c2b-4d57-8a7e-0b3c4d5e6f70", ResourceVersion: "42"},
+	})
+	buf := &bytes.Buffer{}
+	r := &Reconciler{logger: zap.NewNop().Sugar(), auditor: newAuditor(zapcore.AddSync(buf))}
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "test"))
+	_, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	// Deleting an already deleted secret is not an error
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "test"))
+
+	// The deleted object is audited
+	events := decodeAuditEvents(t, buf)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, auditOutcomeSuccess, events[0]["outcome"])
+	assert.Equal(t, "6f1e3a52-9c2b-4d57-8a7e-0b3c4d5e6f70", events[0]["spokeUID"])
+	assert.Equal(t, "42", events[0]["spokeResourceVersion"])
+	assert.Equal(t, auditOutcomeUnchanged, events[1]["outcome"])
+	assert.Equal(t, nil, events[1]["spokeUID"])
+}
+
+func TestHubSecretFinalizer(t *testing.T) {
+	ctx := context.Background()
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+	}
+
+	tests := []struct {
+		name               string
+		hubSecretFinalizer bool
+		expectedFinalizers []string
+	}{
+		{name: "disabled", hubSecretFinalizer: false, expectedFinalizers: nil},
+		{name: "enabled", hubSecretFinalizer: true, expectedFinalizers: []string{hubSecretFinalizer}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(hubSecret)
+			r := &Reconciler{
+				logger:             zap.NewNop().Sugar(),
+				hubKubeClient:      fakeKubeClient,
+				hubSecretFinalizer: tt.hubSecretFinalizer,
+				workloadLister:     kueuev1beta1lister.NewWorkloadLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			}
+			workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+
+			assert.NilError(t, r.ensureHubSecretFinalizer(ctx, hubSecret))
+			secret, err := fakeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedFinalizers, secret.GetFinalizers())
+
+			assert.NilError(t, r.releaseHubSecret(ctx, workload, "test-secret"))
+			secret, err = fakeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.Equal(t, 0, len(secret.GetFinalizers()))
+
+			// Releasing a missing secret is not an error
+			assert.NilError(t, r.releaseHubSecret(ctx, workload, "missing-secret"))
+		})
+	}
+}
+
+func TestReleaseSharedHubSecret(t *testing.T) {
+	ctx := context.Background()
+	fakeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Finalizers: []string{hubSecretFinalizer}},
+	})
+	syncedWorkload := func(name string) *kueuev1beta1.Workload {
+		return &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test-namespace",
+			Annotations: map[string]string{syncedSecretsAnnotation: testClusterName + "/test-namespace/test-secret"},
+		}}
+	}
+	first, second := syncedWorkload("first-workload"), syncedWorkload("second-workload")
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(first))
+	assert.NilError(t, indexer.Add(second))
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		hubKubeClient:  fakeKubeClient,
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+	}
+	finalizers := func() []string {
+		secret, err := fakeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+		assert.NilError(t, err)
+		return secret.GetFinalizers()
+	}
+
+	// The second Workload still runs with the secret
+	assert.NilError(t, r.releaseHubSecret(ctx, first, "test-secret"))
+	assert.DeepEqual(t, []string{hubSecretFinalizer}, finalizers())
+
+	// The secret is released with the last Workload using it
+	finished := second.DeepCopy()
+	finished.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished, Status: metav1.ConditionTrue}}
+	assert.NilError(t, indexer.Update(finished))
+	assert.NilError(t, r.releaseHubSecret(ctx, first, "test-secret"))
+	assert.Equal(t, 0, len(finalizers()))
+}
@@ -0,0 +1,184 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// gcpSecretAnnotation records the GCP Secret Manager secret version a spoke Secret was read from.
+	gcpSecretAnnotation = syncerGroupName + "/gcp-secret"
+
+	// GCP secret IDs only allow letters, digits, dashes and underscores
+	defaultGCPSecretIDTemplate = "{namespace}-{name}"
+
+	defaultGCPMetadataHost   = "metadata.google.internal"
+	gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+	gcpTokenRefreshMargin    = time.Minute
+	gcpRequestTimeout        = 10 * time.Second
+)
+
+// gcpOptions configures the GCP Secret Manager secret source.
+type gcpOptions struct {
+	// project holding the secrets, read from the metadata server when empty
+	project string
+	// secretIDTemplate derives the secret ID of a PipelineRun's credentials, {namespace} and
+	// {name} are replaced by the PipelineRun namespace and the git-auth secret name.
+	secretIDTemplate string
+}
+
+// gcpSecretSource reads the latest version of the git credentials from GCP Secret Manager. It
+// authenticates with GKE Workload Identity, through the token of the Google service account
+// bound to the controller's Kubernetes service account.
+type gcpSecretSource struct {
+	opts   gcpOptions
+	client *http.Client
+	// metadataEndpoint and secretManagerEndpoint are overridden in tests
+	metadataEndpoint      string
+	secretManagerEndpoint string
+	// now is overridden in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func newGCPSecretSource(opts gcpOptions) *gcpSecretSource {
+	// GCE_METADATA_HOST is the variable the Google client libraries honor as well
+	metadataHost := os.Getenv("GCE_METADATA_HOST")
+	if metadataHost == "" {
+		metadataHost = defaultGCPMetadataHost
+	}
+	return &gcpSecretSource{
+		opts:                  opts,
+		client:                &http.Client{Timeout: gcpRequestTimeout},
+		metadataEndpoint:      "http://" + metadataHost + "/computeMetadata/v1",
+		secretManagerEndpoint: gcpSecretManagerEndpoint,
+		now:                   time.Now,
+	}
+}
+
+func (*gcpSecretSource) ephemeral() bool { return true }
+
+func (s *gcpSecretSource) fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get GCP access token: %w", err)
+	}
+
+	project := s.opts.project
+	if project == "" {
+		if project, err = s.metadata(ctx, "/project/project-id"); err != nil {
+			return nil, fmt.Errorf("could not get GCP project: %w", err)
+		}
+	}
+
+	secretID, err := secretReference(s.opts.secretIDTemplate, secretIDAnnotation, pipelineRun, secretName)
+	if err != nil {
+		return nil, err
+	}
+	version := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", project, secretID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.secretManagerEndpoint+"/v1/"+version+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var response struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := s.do(req, func(r io.Reader) error { return json.NewDecoder(r).Decode(&response) }); err != nil {
+		return nil, fmt.Errorf("could not access GCP secret %s: %w", version, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(response.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode GCP secret %s: %w", version, err)
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("GCP secret %s has no value", version)
+	}
+
+	data, err := secretDataFromValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode GCP secret %s: %w", version, err)
+	}
+	return ephemeralSecret(pipelineRun, secretName, gcpSecretAnnotation, version, data), nil
+}
+
+// accessToken returns a token of the Workload Identity service account, reused until shortly
+// before it expires.
+func (s *gcpSecretSource) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.now().Add(gcpTokenRefreshMargin).Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	raw, err := s.metadata(ctx, "/instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(raw), &response); err != nil {
+		return "", fmt.Errorf("could not decode token: %w", err)
+	}
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no token")
+	}
+
+	s.token = response.AccessToken
+	s.tokenExpiry = s.now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// metadata reads a value from the GKE metadata server.
+func (s *gcpSecretSource) metadata(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.metadataEndpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var value []byte
+	if err := s.do(req, func(r io.Reader) (err error) {
+		value, err = io.ReadAll(r)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// do sends the request and decodes a successful answer. GCP error bodies only carry error
+// codes and messages, never secret values.
+func (s *gcpSecretSource) do(req *http.Request, decode func(io.Reader) error) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GCP answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return decode(resp.Body)
+}
@@ -0,0 +1,79 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGCPSecretSourceFetch(t *testing.T) {
+	ctx := context.Background()
+	tokens := 0
+	metadata := http.NewServeMux()
+	metadata.HandleFunc("/computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Google", req.Header.Get("Metadata-Flavor"))
+		tokens++
+		_, _ = io.WriteString(w, `{"access_token":"gcp-token","expires_in":3599,"token_type":"Bearer"}`)
+	})
+	metadata.HandleFunc("/computeMetadata/v1/project/project-id", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "metadata-project")
+	})
+	metadataServer := httptest.NewServer(metadata)
+	defer metadataServer.Close()
+
+	secretManager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Bearer gcp-token", req.Header.Get("Authorization"))
+		values := map[string]string{
+			"/v1/projects/metadata-project/secrets/test-namespace-git-auth/versions/latest:access": `{"git-provider-token":"token"}`,
+			"/v1/projects/ci-project/secrets/test-namespace_plain/versions/latest:access":          "plain-token",
+			"/v1/projects/ci-project/secrets/test-namespace-b-git-auth/versions/latest:access":     `{"git-provider-token":"other"}`,
+		}
+		value, ok := values[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":{"code":404,"status":"NOT_FOUND"}}`)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(value))}})
+	}))
+	defer secretManager.Close()
+
+	source := newGCPSecretSource(gcpOptions{secretIDTemplate: defaultGCPSecretIDTemplate})
+	source.metadataEndpoint = metadataServer.URL + "/computeMetadata/v1"
+	source.secretManagerEndpoint = secretManager.URL
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid"},
+	}
+
+	secret, err := source.fetch(ctx, pipelineRun, "git-auth")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string][]byte{"git-provider-token": []byte("token")}, secret.Data)
+	assert.Equal(t, "projects/metadata-project/secrets/test-namespace-git-auth/versions/latest", secret.Annotations[gcpSecretAnnotation])
+	assert.Equal(t, "spoke-uid", string(secret.OwnerReferences[0].UID))
+
+	// The default template also prefixes the secrets of the namespaces starting with test-namespace-
+	source.opts.project = "ci-project"
+	pipelineRun.Annotations = map[string]string{secretIDAnnotation: "test-namespace-b-git-auth"}
+	_, err = source.fetch(ctx, pipelineRun, "git-auth")
+	assert.Assert(t, errors.Is(err, ErrSecretReferenceForbidden))
+
+	source.opts.secretIDTemplate = "{namespace}_{name}"
+	pipelineRun.Annotations = map[string]string{secretIDAnnotation: "test-namespace_plain"}
+	secret, err = source.fetch(ctx, pipelineRun, "git-auth")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string][]byte{defaultSecretDataKey: []byte("plain-token")}, secret.Data)
+	assert.Equal(t, 1, tokens, "the access token is reused until it expires")
+
+	pipelineRun.Annotations = map[string]string{secretIDAnnotation: "test-namespace_missing"}
+	_, err = source.fetch(ctx, pipelineRun, "git-auth")
+	assert.ErrorContains(t, err, "GCP answered 404 Not Found")
+}
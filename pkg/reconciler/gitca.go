@@ -0,0 +1,96 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// gitCASecretAnnotation on a PipelineRun names the hub secret of its namespace holding the CA
+	// of its internal git server, e.g. a cert-manager Certificate secret, so git on the spoke
+	// cluster trusts the server. It overrides the gitCASecret of the sync policies.
+	gitCASecretAnnotation = syncerGroupName + "/git-ca-secret"
+
+	// gitCAKey is the key of the CA certificate in the secrets issued by cert-manager, the only
+	// one synced: the private key of the certificate stays on the hub.
+	gitCAKey = "ca.crt"
+)
+
+// gitCASecretSyncs returns the sync copying the CA of the git servers of the PipelineRun to the
+// spoke cluster, named by its gitCASecretAnnotation or else by the sync policy of its namespace,
+// unless it is excluded. The secret named by the annotation must exist on the hub, the one of
+// the policy is skipped in the namespaces without it.
+func (r *Reconciler) gitCASecretSyncs(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, exclude map[string]bool) ([]secretSync, error) {
+	name, required := pipelineRun.GetAnnotations()[gitCASecretAnnotation], true
+	if name == "" {
+		policy, err := r.syncPolicy(ctx, pipelineRun.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+		name, required = policy.gitCASecret, false
+	}
+	if name == "" || exclude[name] {
+		return nil, nil
+	}
+	return []secretSync{{name: name, sync: func(ctx context.Context) (string, time.Time, error) {
+		spokeSecretName, err := r.syncGitCASecret(ctx, clusterName, spokeKubeClient, pipelineRun, workload, name, required)
+		return spokeSecretName, time.Time{}, err
+	}}}, nil
+}
+
+// syncGitCASecret copies the CA certificate of a hub secret to an Opaque spoke secret of the same
+// name, returning the name of the spoke secret, empty when a secret which isn't required is
+// missing.
+func (r *Reconciler) syncGitCASecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, name string, required bool) (string, error) {
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "git server CA of PipelineRun dispatched to spoke cluster",
+		Cluster:     clusterName,
+		Secret:      pipelineRun.GetNamespace() + "/" + name,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}
+
+	secret, err := r.hubKubeClient.CoreV1().Secrets(pipelineRun.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) && !required {
+		r.logger.Infof("git CA secret %s/%s of PipelineRun %s does not exist on the hub, not syncing it", pipelineRun.GetNamespace(), name, pipelineRun.GetName())
+		return "", nil
+	}
+	if err == nil {
+		err = revokedSecretError(secret)
+	} else {
+		err = fmt.Errorf("could not get secret %s/%s: %w", pipelineRun.GetNamespace(), name, err)
+	}
+	if err == nil {
+		err = r.disallowedHubSecretError(secret, "PipelineRun "+pipelineRun.GetName())
+	}
+	if err == nil && len(secret.Data[gitCAKey]) == 0 {
+		err = syncer.Classify(fmt.Errorf("secret %s/%s has no key %s", pipelineRun.GetNamespace(), name, gitCAKey), ErrSecretMissingKey)
+	}
+	syncConditionsFrom(ctx).fetched(pipelineRun, err)
+	if err != nil {
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", err
+	}
+
+	// A kubernetes.io/tls secret must hold the certificate and its key, the CA alone is Opaque
+	secret = secret.DeepCopy()
+	secret.Type = corev1.SecretTypeOpaque
+	secret.Data = map[string][]byte{gitCAKey: secret.Data[gitCAKey]}
+	secret.StringData = nil
+	event = event.withContent(secret)
+
+	spokeSecretName, _, err := r.writeSpokeSecret(ctx, clusterName, spokeKubeClient, workload.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload), event)
+	return spokeSecretName, err
+}
@@ -0,0 +1,143 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestSyncGitCASecret(t *testing.T) {
+	ctx := context.Background()
+	// The secrets of cert-manager Certificates hold the certificate and its key next to the CA
+	hubSecrets := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "internal-git-ca", Namespace: "test-namespace"},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte("certificate"),
+				corev1.TLSPrivateKeyKey: []byte("private-key"),
+				gitCAKey:                []byte("ca-certificate"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "no-ca", Namespace: "test-namespace"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: []byte("certificate"), corev1.TLSPrivateKeyKey: []byte("private-key")},
+		},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+
+	tests := []struct {
+		name          string
+		annotation    string
+		policy        map[string]any
+		exclude       map[string]bool
+		allowed       string
+		expectedName  string
+		expectedError string
+	}{
+		{
+			name: "not configured",
+		},
+		{
+			name:         "annotation",
+			annotation:   "internal-git-ca",
+			expectedName: "internal-git-ca",
+		},
+		{
+			name:         "policy",
+			policy:       map[string]any{"gitCASecret": "internal-git-ca"},
+			expectedName: "internal-git-ca",
+		},
+		{
+			name:         "annotation overrides the policy",
+			annotation:   "internal-git-ca",
+			policy:       map[string]any{"gitCASecret": "other-ca"},
+			expectedName: "internal-git-ca",
+		},
+		{
+			name:   "secret of the policy missing from the namespace",
+			policy: map[string]any{"gitCASecret": "other-ca"},
+		},
+		{
+			name:          "secret of the annotation missing",
+			annotation:    "other-ca",
+			expectedError: "not found",
+		},
+		{
+			name:          "secret without CA",
+			annotation:    "no-ca",
+			expectedError: "secret test-namespace/no-ca has no key ca.crt",
+		},
+		{
+			name:          "secret not allowed",
+			annotation:    "internal-git-ca",
+			allowed:       "cert-manager.io/certificate-name",
+			expectedError: "secret test-namespace/internal-git-ca named by PipelineRun test-pipeline-run is not allowed, it must match cert-manager.io/certificate-name",
+		},
+		{
+			name:       "already synced",
+			annotation: "internal-git-ca",
+			exclude:    map[string]bool{"internal-git-ca": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spokeKubeClient := fake.NewSimpleClientset()
+			r := &Reconciler{
+				logger:        zap.NewNop().Sugar(),
+				hubKubeClient: fake.NewSimpleClientset(hubSecrets...),
+			}
+			if tt.allowed != "" {
+				selector, err := labels.Parse(tt.allowed)
+				assert.NilError(t, err)
+				r.allowedSecrets = selector
+			}
+			if tt.policy != nil {
+				r.syncPolicies = newSecretSyncPolicies(newTestSyncPolicyClient(testSecretSyncPolicy("test-namespace", tt.policy)))
+			}
+			pipelineRun := &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid"},
+			}
+			if tt.annotation != "" {
+				pipelineRun.Annotations = map[string]string{gitCASecretAnnotation: tt.annotation}
+			}
+
+			syncs, err := r.gitCASecretSyncs(ctx, testClusterName, spokeKubeClient, pipelineRun, workload, tt.exclude)
+			var refs []syncedSecretRef
+			if err == nil {
+				refs, _, err = r.syncSecrets(ctx, testClusterName, pipelineRun.GetNamespace(), syncs)
+			}
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			if tt.expectedName == "" {
+				assert.Equal(t, 0, len(refs))
+				assert.Equal(t, 0, len(spokeKubeClient.Actions()))
+				return
+			}
+
+			assert.DeepEqual(t, []syncedSecretRef{{Cluster: testClusterName, Namespace: "test-namespace", Name: tt.expectedName}}, refs)
+			secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, tt.expectedName, metav1.GetOptions{})
+			assert.NilError(t, err)
+			// Only the CA is synced, the private key of the certificate stays on the hub
+			assert.Equal(t, corev1.SecretTypeOpaque, secret.Type)
+			assert.DeepEqual(t, map[string][]byte{gitCAKey: []byte("ca-certificate")}, secret.Data)
+			assert.Equal(t, managedByValue, secret.Labels[managedByLabel])
+		})
+	}
+}
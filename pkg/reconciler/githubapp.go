@@ -0,0 +1,281 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// Annotations set by Pipelines-as-Code on the PipelineRuns of GitHub App installations.
+	installationIDAnnotation = groupName + "/installation-id"
+	urlRepositoryAnnotation  = groupName + "/url-repository"
+
+	// githubInstallationAnnotation records the GitHub App installation a spoke token was minted for.
+	githubInstallationAnnotation = syncerGroupName + "/github-installation"
+
+	// defaultGitHubAppSecret is the Secret Pipelines-as-Code stores its GitHub App credentials in.
+	defaultGitHubAppSecret      = "pipelines-as-code/pipelines-as-code-secret"
+	defaultGitHubAPIURL         = "https://api.github.com"
+	defaultGitHubAppPermissions = "contents=read"
+
+	githubAppIDKey         = "github-application-id"
+	githubAppPrivateKeyKey = "github-private-key"
+
+	// The app JWT is backdated for clock drift and expires well within GitHub's 10 minute limit
+	githubAppJWTBackdate = time.Minute
+	githubAppJWTLifetime = 9 * time.Minute
+	githubRequestTimeout = 10 * time.Second
+
+	// githubTokenMinValidity is how long a cached installation token must stay valid to be
+	// synced again, so the spoke secrets keep a token for at least that long.
+	githubTokenMinValidity = 30 * time.Minute
+)
+
+// githubAppOptions configures the GitHub App secret source.
+type githubAppOptions struct {
+	// secret is the namespace/name of the Secret holding the GitHub App ID and private key
+	secret string
+	// apiURL of GitHub, or of the GitHub Enterprise Server API
+	apiURL string
+	// permissions granted to the minted tokens, as comma separated name=access pairs
+	permissions map[string]string
+	// minTokenValidity is how long a cached token must stay valid to be reused, longer than the
+	// token re-sync margin so a refresh never gets the expiring token back
+	minTokenValidity time.Duration
+}
+
+// githubAppSecretSource reads the hub git-auth Secret created by Pipelines-as-Code, and replaces
+// its token by a fresh installation token of the GitHub App, scoped to the PipelineRun's
+// repository and to read access. A compromised spoke then only leaks a token limited to one
+// repository, which expires within the hour.
+type githubAppSecretSource struct {
+	opts      githubAppOptions
+	hubClient kubernetes.Interface
+	client    *http.Client
+	// now is overridden in tests
+	now func() time.Time
+
+	// tokens caches the minted tokens by installation and repository, the PipelineRuns of a
+	// repository share a token instead of each minting one against the GitHub rate limit
+	mu     sync.Mutex
+	tokens map[githubTokenKey]githubToken
+}
+
+type githubTokenKey struct {
+	installationID string
+	repository     string
+}
+
+type githubToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+func newGitHubAppSecretSource(opts githubAppOptions, hubClient kubernetes.Interface) *githubAppSecretSource {
+	return &githubAppSecretSource{
+		opts:      opts,
+		hubClient: hubClient,
+		client:    &http.Client{Timeout: githubRequestTimeout},
+		now:       time.Now,
+		tokens:    map[githubTokenKey]githubToken{},
+	}
+}
+
+func (*githubAppSecretSource) ephemeral() bool { return true }
+
+func (s *githubAppSecretSource) fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error) {
+	hubSecret, err := hubSecretSource{client: s.hubClient}.fetch(ctx, pipelineRun, secretName)
+	if err != nil {
+		return nil, err
+	}
+	installationID := pipelineRun.GetAnnotations()[installationIDAnnotation]
+	repository := pipelineRun.GetAnnotations()[urlRepositoryAnnotation]
+	hubToken := string(hubSecret.Data[defaultSecretDataKey])
+	if installationID == "" || repository == "" || hubToken == "" {
+		// Repositories configured with webhooks and personal tokens have no installation
+		return hubSecret, nil
+	}
+
+	token, expiresAt, err := s.cachedInstallationToken(ctx, installationID, repository)
+	if err != nil {
+		return nil, fmt.Errorf("could not mint token for GitHub App installation %s: %w", installationID, err)
+	}
+
+	// The token also appears in the .git-credentials written by Pipelines-as-Code
+	data := make(map[string][]byte, len(hubSecret.Data))
+	for key, value := range hubSecret.Data {
+		data[key] = bytes.ReplaceAll(value, []byte(hubToken), []byte(token))
+	}
+	secret := ephemeralSecret(pipelineRun, secretName, githubInstallationAnnotation, installationID, data)
+	secret.Annotations[expiresAtAnnotation] = expiresAt.UTC().Format(time.RFC3339)
+	return secret, nil
+}
+
+// cachedInstallationToken returns the cached token of the installation and repository while it
+// stays valid for minTokenValidity, and mints a new one otherwise.
+func (s *githubAppSecretSource) cachedInstallationToken(ctx context.Context, installationID, repository string) (string, time.Time, error) {
+	key := githubTokenKey{installationID: installationID, repository: repository}
+	s.mu.Lock()
+	cached, ok := s.tokens[key]
+	s.mu.Unlock()
+	if ok && cached.expiresAt.Sub(s.now()) > s.opts.minTokenValidity {
+		return cached.token, cached.expiresAt, nil
+	}
+
+	token, expiresAt, err := s.installationToken(ctx, installationID, repository)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The expired tokens are dropped, the cache only holds the recently synced repositories
+	now := s.now()
+	for key, cached := range s.tokens {
+		if !cached.expiresAt.After(now) {
+			delete(s.tokens, key)
+		}
+	}
+	s.tokens[key] = githubToken{token: token, expiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+// installationToken mints an installation token scoped to the repository, and returns it with
+// its expiry.
+func (s *githubAppSecretSource) installationToken(ctx context.Context, installationID, repository string) (string, time.Time, error) {
+	jwt, err := s.appJWT(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"repositories": []string{repository},
+		"permissions":  s.opts.permissions,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	url := strings.TrimSuffix(s.opts.apiURL, "/") + "/app/installations/" + installationID + "/access_tokens"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		// GitHub error bodies only carry error messages, never tokens
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", time.Time{}, fmt.Errorf("GitHub answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	var response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", time.Time{}, err
+	}
+	if response.Token == "" {
+		return "", time.Time{}, fmt.Errorf("GitHub returned no token")
+	}
+	return response.Token, response.ExpiresAt, nil
+}
+
+// appJWT returns a JWT authenticating as the GitHub App, signed with its private key.
+func (s *githubAppSecretSource) appJWT(ctx context.Context) (string, error) {
+	namespace, name, _ := strings.Cut(s.opts.secret, "/")
+	secret, err := s.hubClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not get GitHub App secret %s: %w", s.opts.secret, err)
+	}
+	appID := strings.TrimSpace(string(secret.Data[githubAppIDKey]))
+	if appID == "" {
+		return "", syncer.Classify(fmt.Errorf("GitHub App secret %s has no %s", s.opts.secret, githubAppIDKey), ErrSecretMissingKey)
+	}
+	key, err := parseRSAPrivateKey(secret.Data[githubAppPrivateKeyKey])
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s of GitHub App secret %s: %w", githubAppPrivateKeyKey, s.opts.secret, err)
+	}
+
+	now := s.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-githubAppJWTBackdate).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key, GitHub generates
+// PKCS #1 keys.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+	return key, nil
+}
+
+// parseGitHubAppPermissions parses comma separated name=access pairs, such as contents=read.
+func parseGitHubAppPermissions(value string) (map[string]string, error) {
+	permissions := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		name, access, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || (access != "read" && access != "write") {
+			return nil, fmt.Errorf("invalid permission %q, must be name=read or name=write", pair)
+		}
+		permissions[name] = access
+	}
+	return permissions, nil
+}
+
+// validGitHubAppSecret reports whether the value is a namespace/name Secret reference.
+func validGitHubAppSecret(value string) bool {
+	namespace, name, ok := strings.Cut(value, "/")
+	return ok && namespace != "" && name != "" && !strings.Contains(name, "/")
+}
@@ -0,0 +1,88 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// gitMirrorKeys are the keys of the git-auth secrets naming the git hosts, the ones rewritten to
+// the mirrors of the spoke clusters.
+var gitMirrorKeys = []string{".gitconfig", ".git-credentials"}
+
+// gitURLPattern matches the http(s) URLs of the .gitconfig and .git-credentials files: their
+// scheme and credentials, then their host with its port.
+var gitURLPattern = regexp.MustCompile(`(https?://(?:[^@/\s"]*@)?)([^/\s"@:]+(?::[0-9]+)?)`)
+
+// validateGitMirrors checks the hosts and mirrors of the gitMirrors of a SpokeClusterConfig are
+// hosts, with an optional port.
+func validateGitMirrors(mirrors map[string]string) error {
+	for host, mirror := range mirrors {
+		for _, value := range []string{host, mirror} {
+			if u, err := url.Parse("https://" + value); value == "" || err != nil || u.Host != value || strings.Contains(value, "/") {
+				return fmt.Errorf("invalid gitMirrors %s: %s, %q is not a host with an optional port", host, mirror, value)
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteGitHosts returns the content with the hosts of its URLs replaced by their mirror, the
+// one of the host and port, then of the host alone, and whether any was replaced.
+func rewriteGitHosts(content []byte, mirrors map[string]string) ([]byte, bool) {
+	rewritten := false
+	content = gitURLPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := gitURLPattern.FindSubmatch(match)
+		host := string(groups[2])
+		mirror, ok := mirrors[host]
+		if !ok {
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				mirror, ok = mirrors[hostname]
+			}
+		}
+		if !ok {
+			return match
+		}
+		rewritten = true
+		return append(bytes.Clone(groups[1]), mirror...)
+	})
+	return content, rewritten
+}
+
+// rewriteGitMirrors returns the spoke secret with the git hosts of its .gitconfig and
+// .git-credentials replaced by the mirrors the SpokeClusterConfig of the spoke cluster sets, so
+// the PipelineRuns of disconnected spoke clusters clone through their mirror with the same
+// credentials. The secret is returned as is without mirrors.
+func (r *Reconciler) rewriteGitMirrors(ctx context.Context, clusterName string, secret *corev1.Secret) (*corev1.Secret, error) {
+	settings, err := r.spokeClusterConfigs.get(ctx, clusterName)
+	if err != nil || settings == nil || len(settings.GitMirrors) == 0 {
+		return secret, err
+	}
+
+	var rewritten *corev1.Secret
+	for _, key := range gitMirrorKeys {
+		content, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		if content, ok = rewriteGitHosts(content, settings.GitMirrors); !ok {
+			continue
+		}
+		if rewritten == nil {
+			// The data of the spoke secret is shared with the hub secret
+			rewritten = secret.DeepCopy()
+		}
+		rewritten.Data[key] = content
+	}
+	if rewritten == nil {
+		return secret, nil
+	}
+	r.logger.Debugf("rewrote the git hosts of secret %s/%s to the mirrors of spoke cluster %s", secret.Namespace, secret.Name, clusterName)
+	return rewritten, nil
+}
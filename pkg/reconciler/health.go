@@ -0,0 +1,197 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultProbePort = 8081
+
+	// hubAPICheckTTL is how long the result of a hub API reachability check is reused,
+	// so frequent probes don't add load on the hub API server.
+	hubAPICheckTTL = 10 * time.Second
+	// stuckReconcileTimeout is how long a single reconcile may run before the controller is
+	// considered stuck. Every spoke call is bounded, so a healthy reconcile is far shorter.
+	stuckReconcileTimeout = 5 * time.Minute
+)
+
+// healthChecker serves the probe endpoints of the controller. Each check returns nil when healthy.
+type healthChecker struct {
+	mu              sync.RWMutex
+	readinessChecks map[string]func() error
+	livenessChecks  map[string]func() error
+}
+
+func newHealthChecker() *healthChecker {
+	return &healthChecker{
+		readinessChecks: map[string]func() error{},
+		livenessChecks:  map[string]func() error{},
+	}
+}
+
+// addReadinessCheck registers a check which must pass for the controller to be ready.
+func (h *healthChecker) addReadinessCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readinessChecks[name] = check
+}
+
+// removeReadinessCheck unregisters the readiness check name.
+func (h *healthChecker) removeReadinessCheck(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.readinessChecks, name)
+}
+
+// addLivenessCheck registers a check whose failure means the controller must be restarted.
+func (h *healthChecker) addLivenessCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.livenessChecks[name] = check
+}
+
+// handler returns the HTTP handler serving /readyz and /healthz.
+func (h *healthChecker) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		writeCheckResults(w, h.readinessChecks)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		writeCheckResults(w, h.livenessChecks)
+	})
+	return mux
+}
+
+// writeCheckResults runs the checks and writes one line per check, answering 503 if any failed.
+func writeCheckResults(w http.ResponseWriter, checks map[string]func() error) {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	status := http.StatusOK
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&body, "[-] %s failed: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(&body, "[+] %s ok\n", name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body.String()))
+}
+
+// serve runs the probe server until the context is done.
+func (h *healthChecker) serve(ctx context.Context, logger *zap.SugaredLogger, port int) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           h.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Serving health probes on port %d", port)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("health probe server failed: %v", err)
+	}
+}
+
+// hubAPICheck checks the hub API server answers its /readyz endpoint. Results are cached for
+// hubAPICheckTTL.
+func hubAPICheck(client kubernetes.Interface) func() error {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		lastErr   error
+	)
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(checkedAt) < hubAPICheckTTL {
+			return lastErr
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		lastErr = client.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+		checkedAt = time.Now()
+		return lastErr
+	}
+}
+
+// workqueueCheck fails once the workqueue is shut down, as workers then stop processing.
+func workqueueCheck(queue interface{ ShuttingDown() bool }) func() error {
+	return func() error {
+		if queue.ShuttingDown() {
+			return errors.New("workqueue is shutting down")
+		}
+		return nil
+	}
+}
+
+// reconcileTracker tracks the reconciles in flight to detect workers stuck on a key.
+type reconcileTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]time.Time
+	// now is overridden in tests
+	now func() time.Time
+}
+
+func newReconcileTracker() *reconcileTracker {
+	return &reconcileTracker{inFlight: map[string]time.Time{}, now: time.Now}
+}
+
+// start records a reconcile of the key, the returned function must be called when it is done.
+func (t *reconcileTracker) start(key string) func() {
+	if t == nil {
+		return func() {}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight[key] = t.now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.inFlight, key)
+	}
+}
+
+// check fails when a reconcile has been running for longer than the timeout.
+func (t *reconcileTracker) check(timeout time.Duration) func() error {
+	return func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for key, startedAt := range t.inFlight {
+			if running := t.now().Sub(startedAt); running > timeout {
+				return fmt.Errorf("reconcile of %s has been running for %s", key, running.Round(time.Second))
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+package reconciler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestReadinessProbe(t *testing.T) {
+	synced := false
+	health := newHealthChecker()
+	health.addReadinessCheck("workload-informer", func() error {
+		if !synced {
+			return errors.New("not synced")
+		}
+		return nil
+	})
+	health.addReadinessCheck("always-ok", func() error { return nil })
+
+	recorder := httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "[+] always-ok ok\n[-] workload-informer failed: not synced\n", recorder.Body.String())
+
+	synced = true
+	recorder = httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "[+] always-ok ok\n[+] workload-informer ok\n", recorder.Body.String())
+}
+
+func TestLivenessProbe(t *testing.T) {
+	now := time.Now()
+	tracker := newReconcileTracker()
+	tracker.now = func() time.Time { return now }
+	health := newHealthChecker()
+	health.addLivenessCheck("reconcilers", tracker.check(time.Minute))
+
+	done := tracker.start("test-namespace/test-workload")
+	recorder := httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	now = now.Add(2 * time.Minute)
+	recorder = httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "[-] reconcilers failed: reconcile of test-namespace/test-workload has been running for 2m0s\n", recorder.Body.String())
+
+	done()
+	recorder = httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestWorkqueueCheck(t *testing.T) {
+	queue := workqueue.NewTyped[any]()
+	check := workqueueCheck(queue)
+	assert.NilError(t, check())
+
+	queue.ShutDown()
+	assert.ErrorContains(t, check(), "shutting down")
+}
@@ -0,0 +1,154 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SyncTarget is the sync of a secret to a spoke cluster a hook runs for.
+type SyncTarget struct {
+	// Cluster is the name of the MultiKueueCluster of the spoke cluster.
+	Cluster string
+	// Workload and PipelineRun are the namespace/name of the hub Workload and PipelineRun the
+	// secret is synced for.
+	Workload    string
+	PipelineRun string
+}
+
+// PreSyncHook transforms a secret before it is written to a spoke cluster, e.g. to rewrite the
+// git URLs of its .gitconfig to an in-cluster mirror. It modifies the secret in place, a deep
+// copy of the hub secret carrying the spoke namespace, labels and owners. An error fails the
+// sync of the secret, which is retried.
+type PreSyncHook func(ctx context.Context, target SyncTarget, secret *corev1.Secret) error
+
+// PostSyncHook runs once a secret was written to a spoke cluster, with the secret as sent, named
+// like the spoke secret. It must not modify the secret. An error fails the sync, the secret is
+// then written again on the retry.
+type PostSyncHook func(ctx context.Context, target SyncTarget, secret *corev1.Secret) error
+
+// namedHook is a registered hook, named in the logs and errors of its failures.
+type namedHook[T any] struct {
+	name string
+	hook T
+}
+
+// syncHookRegistry holds the hooks run around the writes of the spoke secrets, in the order they
+// were registered.
+type syncHookRegistry struct {
+	mu    sync.RWMutex
+	names map[string]bool
+	pre   []namedHook[PreSyncHook]
+	post  []namedHook[PostSyncHook]
+}
+
+func newSyncHookRegistry() *syncHookRegistry {
+	return &syncHookRegistry{names: map[string]bool{}}
+}
+
+// syncHooks are the hooks registered by the builds embedding the controller, the ones its
+// reconcilers run.
+var syncHooks = newSyncHookRegistry()
+
+// RegisterPreSyncHook registers a hook run before every secret is written to a spoke cluster,
+// including the secrets pulled by the spoke pull agent. It is meant to be called from the init
+// functions of the builds embedding the controller, before NewControllers. It panics when the
+// name is already registered or the hook is nil.
+func RegisterPreSyncHook(name string, hook PreSyncHook) {
+	syncHooks.registerPre(name, hook)
+}
+
+// RegisterPostSyncHook registers a hook run after every secret is written to a spoke cluster.
+// It panics when the name is already registered or the hook is nil.
+func RegisterPostSyncHook(name string, hook PostSyncHook) {
+	syncHooks.registerPost(name, hook)
+}
+
+func (h *syncHookRegistry) registerPre(name string, hook PreSyncHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.register(name, hook == nil)
+	h.pre = append(h.pre, namedHook[PreSyncHook]{name: name, hook: hook})
+}
+
+func (h *syncHookRegistry) registerPost(name string, hook PostSyncHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.register(name, hook == nil)
+	h.post = append(h.post, namedHook[PostSyncHook]{name: name, hook: hook})
+}
+
+// register reserves the name of a hook, h.mu is held.
+func (h *syncHookRegistry) register(name string, isNil bool) {
+	if isNil {
+		panic("reconciler: sync hook " + name + " is nil")
+	}
+	if h.names[name] {
+		panic("reconciler: sync hook " + name + " registered twice")
+	}
+	h.names[name] = true
+}
+
+// hasPre reports whether pre-sync hooks are registered.
+func (h *syncHookRegistry) hasPre() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.pre) > 0
+}
+
+// runPreSyncHooks returns the secret transformed by the pre-sync hooks while the
+// featurePreSyncHooks gate is enabled, the secret as is otherwise.
+func (r *Reconciler) runPreSyncHooks(ctx context.Context, target SyncTarget, secret *corev1.Secret) (*corev1.Secret, error) {
+	if !r.features.isEnabled(featurePreSyncHooks) {
+		return secret, nil
+	}
+	return r.hooks.runPre(ctx, target, secret)
+}
+
+// runPre returns the secret transformed by the pre-sync hooks, stopping at the first failure.
+// The hooks get a deep copy, the spoke secret shares its data with the hub secret. A nil
+// registry runs none.
+func (h *syncHookRegistry) runPre(ctx context.Context, target SyncTarget, secret *corev1.Secret) (*corev1.Secret, error) {
+	if h == nil {
+		return secret, nil
+	}
+	h.mu.RLock()
+	hooks := h.pre
+	h.mu.RUnlock()
+	if len(hooks) == 0 {
+		return secret, nil
+	}
+	secret = secret.DeepCopy()
+	for _, hook := range hooks {
+		if err := hook.hook(ctx, target, secret); err != nil {
+			return nil, fmt.Errorf("pre-sync hook %s failed for secret %s/%s: %w", hook.name, secret.Namespace, secret.Name, err)
+		}
+	}
+	return secret, nil
+}
+
+// runPost runs the post-sync hooks on the written secret, stopping at the first failure.
+func (h *syncHookRegistry) runPost(ctx context.Context, target SyncTarget, secret *corev1.Secret) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	hooks := h.post
+	h.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook.hook(ctx, target, secret); err != nil {
+			return fmt.Errorf("post-sync hook %s failed for secret %s/%s: %w", hook.name, secret.Namespace, secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// syncTarget returns the target of the hooks of the sync audited by the event.
+func syncTarget(event auditEvent) SyncTarget {
+	return SyncTarget{Cluster: event.Cluster, Workload: event.Workload, PipelineRun: event.PipelineRun}
+}
@@ -0,0 +1,118 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestSyncHooks(t *testing.T) {
+	pipelineRun := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"}}
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{".gitconfig": []byte("[url \"https://github.com/\"]")},
+	}
+	expectedTarget := SyncTarget{Cluster: testClusterName, Workload: "test-namespace/test-workload", PipelineRun: "test-namespace/test-pipeline-run"}
+	rewrite := func(_ context.Context, target SyncTarget, secret *corev1.Secret) error {
+		assert.Equal(t, expectedTarget, target)
+		secret.Data[".gitconfig"] = bytes.ReplaceAll(secret.Data[".gitconfig"], []byte("github.com"), []byte("mirror.svc"))
+		return nil
+	}
+	failure := errors.New("mirror unknown")
+
+	tests := []struct {
+		name          string
+		pre           PreSyncHook
+		post          PostSyncHook
+		disabled      bool
+		expectedError string
+		expectedData  string
+	}{
+		{
+			name:         "pre-sync hook rewrites the secret",
+			pre:          rewrite,
+			expectedData: "[url \"https://mirror.svc/\"]",
+		},
+		{
+			name:         "disabled pre-sync hooks",
+			pre:          func(context.Context, SyncTarget, *corev1.Secret) error { return failure },
+			disabled:     true,
+			expectedData: "[url \"https://github.com/\"]",
+		},
+		{
+			name:          "failed pre-sync hook",
+			pre:           func(context.Context, SyncTarget, *corev1.Secret) error { return failure },
+			expectedError: "pre-sync hook test failed for secret test-namespace/test-secret: mirror unknown",
+		},
+		{
+			name:          "failed post-sync hook",
+			pre:           rewrite,
+			post:          func(context.Context, SyncTarget, *corev1.Secret) error { return failure },
+			expectedError: "post-sync hook notify failed for secret test-namespace/test-secret: mirror unknown",
+			expectedData:  "[url \"https://mirror.svc/\"]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hooks := newSyncHookRegistry()
+			hooks.registerPre("test", tt.pre)
+			var written *corev1.Secret
+			hooks.registerPost("record", func(_ context.Context, _ SyncTarget, secret *corev1.Secret) error {
+				written = secret
+				return nil
+			})
+			if tt.post != nil {
+				hooks.registerPost("notify", tt.post)
+			}
+			spokeKubeClient := fake.NewSimpleClientset()
+			r := &Reconciler{logger: zap.NewNop().Sugar(), hubKubeClient: fake.NewSimpleClientset(hubSecret), hooks: hooks, features: enabledFeatureGates(featurePreSyncHooks)}
+			if tt.disabled {
+				r.features = disabledFeatureGates(featurePreSyncHooks)
+			}
+
+			_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+			if tt.expectedError != "" {
+				assert.ErrorIs(t, err, failure)
+				assert.Error(t, err, tt.expectedError)
+			} else {
+				assert.NilError(t, err)
+				assert.Equal(t, tt.expectedData, string(written.Data[".gitconfig"]))
+			}
+
+			spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			if tt.expectedData == "" {
+				assert.Assert(t, err != nil, "the secret is not written")
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedData, string(spokeSecret.Data[".gitconfig"]))
+			assert.Equal(t, "[url \"https://github.com/\"]", string(hubSecret.Data[".gitconfig"]), "the hub secret is left untouched")
+		})
+	}
+}
+
+func TestRegisterSyncHookTwice(t *testing.T) {
+	hooks := newSyncHookRegistry()
+	hook := func(context.Context, SyncTarget, *corev1.Secret) error { return nil }
+	hooks.registerPre("proxy", hook)
+	assert.Assert(t, panics(func() { hooks.registerPost("proxy", hook) }))
+	assert.Assert(t, panics(func() { hooks.registerPre("nil", nil) }))
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
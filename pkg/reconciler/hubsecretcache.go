@@ -0,0 +1,71 @@
+package reconciler
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/controller"
+)
+
+// defaultHubSecretCacheSelector selects the git-auth secrets Pipelines-as-Code creates for the
+// PipelineRuns it runs.
+const defaultHubSecretCacheSelector = "app.kubernetes.io/managed-by=" + groupName
+
+// hubSecretCache serves the hub secrets selected by its label selector from informers, so
+// reconciling a Workload doesn't read its git-auth secret from the hub API server.
+type hubSecretCache struct {
+	// listers of the watched namespaces, a single one of metav1.NamespaceAll when all of them
+	// are watched
+	listers map[string]corev1lister.SecretLister
+}
+
+// startHubSecretCache starts the informers of the hub secrets of the namespaces, all of them when
+// empty, matching the label selector and waits for their caches to sync.
+func startHubSecretCache(ctx context.Context, client kubernetes.Interface, namespaces []string, selector string) *hubSecretCache {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	c := &hubSecretCache{listers: make(map[string]corev1lister.SecretLister, len(namespaces))}
+	for _, namespace := range namespaces {
+		factory := kubeinformers.NewSharedInformerFactoryWithOptions(client, controller.GetResyncPeriod(ctx),
+			kubeinformers.WithNamespace(namespace),
+			kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) { options.LabelSelector = selector }))
+		c.listers[namespace] = factory.Core().V1().Secrets().Lister()
+		factory.Start(ctx.Done())
+		factory.WaitForCacheSync(ctx.Done())
+	}
+	return c
+}
+
+// get returns a copy of the cached secret, false when it isn't cached, as it doesn't match the
+// label selector, was just created or doesn't exist.
+func (c *hubSecretCache) get(namespace, name string) (*corev1.Secret, bool) {
+	if c == nil {
+		return nil, false
+	}
+	lister, ok := c.listers[namespace]
+	if !ok {
+		if lister, ok = c.listers[metav1.NamespaceAll]; !ok {
+			return nil, false
+		}
+	}
+	secret, err := lister.Secrets(namespace).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return secret.DeepCopy(), true
+}
+
+// uncached returns the source reading the hub secrets from the API server, for the syncs of the
+// updates of the hub secrets the cache may not have seen yet.
+func uncached(source secretSource) secretSource {
+	if s, ok := source.(hubSecretSource); ok {
+		s.cache = nil
+		return s
+	}
+	return source
+}
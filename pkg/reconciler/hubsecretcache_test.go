@@ -0,0 +1,101 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testHubSecret(namespace, name, token string, labels map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Data:       map[string][]byte{"token": []byte(token)},
+	}
+}
+
+func TestHubSecretCache(t *testing.T) {
+	pacLabels := map[string]string{"app.kubernetes.io/managed-by": groupName}
+	tests := []struct {
+		name          string
+		namespaces    []string
+		namespace     string
+		secretName    string
+		expectedToken string
+	}{
+		{
+			name:          "cached secret",
+			namespace:     "tenant-a",
+			secretName:    "pac-secret",
+			expectedToken: "cached",
+		},
+		{
+			name:          "cached secret of a watched namespace",
+			namespaces:    []string{"tenant-a", "tenant-b"},
+			namespace:     "tenant-a",
+			secretName:    "pac-secret",
+			expectedToken: "cached",
+		},
+		{
+			name:          "secret not matching the selector",
+			namespace:     "tenant-a",
+			secretName:    "other-secret",
+			expectedToken: "live",
+		},
+		{
+			name:          "namespace not watched",
+			namespaces:    []string{"tenant-b"},
+			namespace:     "tenant-a",
+			secretName:    "pac-secret",
+			expectedToken: "live",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cache := startHubSecretCache(ctx, fake.NewSimpleClientset(
+				testHubSecret("tenant-a", "pac-secret", "cached", pacLabels),
+				testHubSecret("tenant-a", "other-secret", "cached", nil),
+			), tt.namespaces, defaultHubSecretCacheSelector)
+
+			// The live client has other tokens, to tell where the secrets were read from
+			source := hubSecretSource{
+				client: fake.NewSimpleClientset(
+					testHubSecret("tenant-a", "pac-secret", "live", pacLabels),
+					testHubSecret("tenant-a", "other-secret", "live", nil),
+				),
+				cache: cache,
+			}
+			pipelineRun := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-plr", Namespace: tt.namespace}}
+			secret, err := source.fetch(ctx, pipelineRun, tt.secretName)
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedToken, string(secret.Data["token"]))
+
+			secret, err = uncached(source).fetch(ctx, pipelineRun, tt.secretName)
+			assert.NilError(t, err)
+			assert.Equal(t, "live", string(secret.Data["token"]))
+		})
+	}
+}
+
+func TestHubSecretCacheCopies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := startHubSecretCache(ctx, fake.NewSimpleClientset(testHubSecret("tenant-a", "pac-secret", "cached", nil)), nil, "")
+
+	secret, ok := cache.get("tenant-a", "pac-secret")
+	assert.Assert(t, ok)
+	secret.Data["token"] = []byte("changed")
+	secret, ok = cache.get("tenant-a", "pac-secret")
+	assert.Assert(t, ok)
+	assert.Equal(t, "cached", string(secret.Data["token"]))
+
+	_, ok = (*hubSecretCache)(nil).get("tenant-a", "pac-secret")
+	assert.Assert(t, !ok)
+}
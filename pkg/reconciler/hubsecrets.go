@@ -0,0 +1,166 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// hubSecretIndex indexes the cached Workloads by the namespace/name of the hub secrets synced
+// for them.
+const hubSecretIndex = "hubSecret"
+
+// hubSecretIndexFunc returns the hub secrets recorded as synced on a Workload the filter owns.
+// The hub secrets live in the namespace of the Workload, and the spoke secrets have their name
+// unless the suffix conflict policy renamed them.
+func (f workloadQueueFilter) hubSecretIndexFunc(obj any) ([]string, error) {
+	workload, ok := obj.(*kueuev1beta1.Workload)
+	if !ok || !f.owned(workload) {
+		return nil, nil
+	}
+
+	var keys []string
+	seen := map[string]bool{}
+	for _, ref := range syncedSecretRefs(workload) {
+		key := workload.Namespace + "/" + ref.hubSecretName()
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// hubSecretWatcher enqueues the Workloads a hub secret was synced for when it is updated, so the
+// update reaches the spoke clusters on their next reconcile instead of being kept until the
+// secret is rotated or expires. Only the metadata of the hub secrets is cached, the Workloads are
+// found through the hubSecretIndex of the Workload informers.
+type hubSecretWatcher struct {
+	workloads []cache.Indexer
+	updates   *rotationRequests
+	// revocations records the revoked hub secrets, nil when HUB_SECRET_REVOCATION is disabled
+	revocations *hubSecretRevocations
+	enqueue     func(types.NamespacedName)
+}
+
+// workloadsOf returns the Workloads the hub secret was synced for.
+func (w *hubSecretWatcher) workloadsOf(secret metav1.Object) []types.NamespacedName {
+	var keys []types.NamespacedName
+	for _, indexer := range w.workloads {
+		workloads, err := indexer.ByIndex(hubSecretIndex, secret.GetNamespace()+"/"+secret.GetName())
+		if err != nil {
+			continue
+		}
+		for _, obj := range workloads {
+			if workload, ok := obj.(metav1.Object); ok {
+				keys = append(keys, types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()})
+			}
+		}
+	}
+	return keys
+}
+
+// secretUpdated requests the refresh of the Workloads synced from the secret and enqueues them,
+// or their revocation when the secret was just revoked. Periodic resyncs, which don't change the
+// resource version, are ignored.
+func (w *hubSecretWatcher) secretUpdated(oldObj, newObj any) {
+	oldSecret, ok := oldObj.(metav1.Object)
+	newSecret, newOk := newObj.(metav1.Object)
+	if !ok || !newOk || oldSecret.GetResourceVersion() == newSecret.GetResourceVersion() {
+		return
+	}
+	if w.revocations != nil && hubSecretRevoked(newSecret) && !hubSecretRevoked(oldSecret) {
+		w.secretRevoked(newSecret)
+		return
+	}
+
+	for _, workloadKey := range w.workloadsOf(newSecret) {
+		w.updates.request(workloadKey.String())
+		w.enqueue(workloadKey)
+	}
+}
+
+// secretAdded requests the revocation of the Workloads synced from a secret added already
+// revoked, e.g. revoked while the controller was down and listed again on startup.
+func (w *hubSecretWatcher) secretAdded(obj any) {
+	if secret, ok := obj.(metav1.Object); ok && w.revocations != nil && hubSecretRevoked(secret) {
+		w.secretRevoked(secret)
+	}
+}
+
+// revokeListed requests the revocation of the Workloads synced from the revoked secrets of the
+// stores, once the Workload informers synced. The secrets listed on startup are added before the
+// Workloads they were synced for are cached, their revocations would be missed otherwise.
+func (w *hubSecretWatcher) revokeListed(ctx context.Context, stores []cache.Store, workloadsSynced []cache.InformerSynced) {
+	if w.revocations == nil || !cache.WaitForCacheSync(ctx.Done(), workloadsSynced...) {
+		return
+	}
+	for _, store := range stores {
+		for _, obj := range store.List() {
+			w.secretAdded(obj)
+		}
+	}
+}
+
+// secretDeleted requests the revocation of the Workloads synced from a deleted secret. A secret
+// protected by the HUB_SECRET_FINALIZER is only deleted once its spoke runs are done.
+func (w *hubSecretWatcher) secretDeleted(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if secret, ok := obj.(metav1.Object); ok && w.revocations != nil {
+		w.secretRevoked(secret)
+	}
+}
+
+// secretRevoked requests the revocation of the Workloads synced from the secret and enqueues them.
+func (w *hubSecretWatcher) secretRevoked(secret metav1.Object) {
+	for _, workloadKey := range w.workloadsOf(secret) {
+		w.revocations.request(workloadKey.String(), secret.GetName())
+		w.enqueue(workloadKey)
+	}
+}
+
+// watchHubSecrets starts the metadata informers of the hub secrets of the namespaces, all of
+// them when empty, and waits for their caches to sync. The Workload informers get the
+// hubSecretIndex.
+func (r *Reconciler) watchHubSecrets(ctx context.Context, client metadata.Interface, namespaces []string, workloadInformers []cache.SharedIndexInformer, enqueue func(types.NamespacedName)) error {
+	w := &hubSecretWatcher{updates: r.hubSecretUpdates, revocations: r.hubSecretRevocations, enqueue: enqueue}
+	for _, informer := range workloadInformers {
+		if err := informer.AddIndexers(cache.Indexers{hubSecretIndex: r.queues.hubSecretIndexFunc}); err != nil {
+			return fmt.Errorf("could not index the Workloads by hub secret: %w", err)
+		}
+		w.workloads = append(w.workloads, informer.GetIndexer())
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var (
+		stores          []cache.Store
+		workloadsSynced []cache.InformerSynced
+	)
+	for _, informer := range workloadInformers {
+		workloadsSynced = append(workloadsSynced, informer.HasSynced)
+	}
+	for _, namespace := range namespaces {
+		factory := metadatainformer.NewFilteredSharedInformerFactory(client, controller.GetResyncPeriod(ctx), namespace, nil)
+		informer := factory.ForResource(corev1.SchemeGroupVersion.WithResource("secrets")).Informer()
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{AddFunc: w.secretAdded, UpdateFunc: w.secretUpdated, DeleteFunc: w.secretDeleted}); err != nil {
+			return fmt.Errorf("could not register the hub secret event handler: %w", err)
+		}
+		factory.Start(ctx.Done())
+		factory.WaitForCacheSync(ctx.Done())
+		stores = append(stores, informer.GetStore())
+	}
+	go w.revokeListed(ctx, stores, workloadsSynced)
+	return nil
+}
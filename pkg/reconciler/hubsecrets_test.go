@@ -0,0 +1,148 @@
+package reconciler
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func syncedWorkload(name, syncedSecrets string) *kueuev1beta1.Workload {
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+		},
+	}
+	if syncedSecrets != "" {
+		workload.Annotations = map[string]string{syncedSecretsAnnotation: syncedSecrets}
+	}
+	return workload
+}
+
+func TestHubSecretIndexFunc(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          any
+		expectedKeys []string
+	}{
+		{
+			name:         "synced secrets",
+			obj:          syncedWorkload("test-workload", "spoke-1/test-namespace/git-auth,spoke-1/test-namespace/repository-token"),
+			expectedKeys: []string{"test-namespace/git-auth", "test-namespace/repository-token"},
+		},
+		{
+			name:         "suffixed spoke secret",
+			obj:          syncedWorkload("test-workload", "spoke-1/test-namespace/git-auth"+conflictSecretSuffix+",spoke-2/test-namespace/git-auth"),
+			expectedKeys: []string{"test-namespace/git-auth"},
+		},
+		{
+			name:         "spoke secrets of a target namespace",
+			obj:          syncedWorkload("test-workload", "spoke-1/remote-runs/git-auth"),
+			expectedKeys: []string{"test-namespace/git-auth"},
+		},
+		{
+			name: "nothing synced",
+			obj:  syncedWorkload("test-workload", ""),
+		},
+		{
+			name: "not owned by a PipelineRun",
+			obj: &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-workload",
+				Namespace:   "test-namespace",
+				Annotations: map[string]string{syncedSecretsAnnotation: "spoke-1/test-namespace/git-auth"},
+			}},
+		},
+		{
+			name: "not a Workload",
+			obj:  &corev1.Secret{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := workloadQueueFilter{}.hubSecretIndexFunc(tt.obj)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedKeys, keys)
+		})
+	}
+}
+
+func TestHubSecretWatcherSecretUpdated(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{hubSecretIndex: workloadQueueFilter{}.hubSecretIndexFunc})
+	for _, workload := range []*kueuev1beta1.Workload{
+		syncedWorkload("first", "spoke-1/test-namespace/git-auth"),
+		syncedWorkload("second", "spoke-2/test-namespace/git-auth"),
+		syncedWorkload("other", "spoke-1/test-namespace/other-secret"),
+	} {
+		assert.NilError(t, indexer.Add(workload))
+	}
+
+	var enqueued []string
+	w := &hubSecretWatcher{
+		workloads: []cache.Indexer{indexer},
+		updates:   newRotationRequests(),
+		enqueue:   func(key types.NamespacedName) { enqueued = append(enqueued, key.String()) },
+	}
+	secret := func(resourceVersion string) *metav1.PartialObjectMetadata {
+		return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace", ResourceVersion: resourceVersion}}
+	}
+
+	// Periodic resyncs aren't updates
+	w.secretUpdated(secret("1"), secret("1"))
+	assert.Equal(t, 0, len(enqueued))
+
+	w.secretUpdated(secret("1"), secret("2"))
+	sort.Strings(enqueued)
+	assert.DeepEqual(t, []string{"test-namespace/first", "test-namespace/second"}, enqueued)
+	assert.Assert(t, w.updates.requested("test-namespace/first"))
+	assert.Assert(t, w.updates.requested("test-namespace/second"))
+	assert.Assert(t, !w.updates.requested("test-namespace/other"))
+}
+
+func TestCreateSecretOnSpokeClusterSyncsHubSecretUpdate(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("new-token")},
+	}
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("old-token")},
+	})
+	r := &Reconciler{
+		logger:           zap.NewNop().Sugar(),
+		hubKubeClient:    fake.NewSimpleClientset(hubSecret),
+		hubSecretUpdates: newRotationRequests(),
+	}
+	spokeToken := func() string {
+		secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+		assert.NilError(t, err)
+		return string(secret.Data[defaultSecretDataKey])
+	}
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "old-token", spokeToken())
+
+	r.hubSecretUpdates.request("test-namespace/test-workload")
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "new-token", spokeToken())
+}
@@ -0,0 +1,122 @@
+package reconciler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// hubThrottleBaseDelay is the pause of the reconciles after a first throttled hub request
+	// without Retry-After, doubled on each consecutive throttling.
+	hubThrottleBaseDelay = time.Second
+
+	// defaultHubThrottleMaxDelay bounds the pause of the reconciles.
+	defaultHubThrottleMaxDelay = time.Minute
+)
+
+// hubThrottle sheds the load of the hub API server: once it answers a request of the controller
+// with 429 Too Many Requests, the reconciles of every Workload are paused until its Retry-After,
+// instead of each key backing off on its own while the other ones keep the API server busy. A
+// nil hubThrottle never pauses them.
+type hubThrottle struct {
+	logger   *zap.SugaredLogger
+	maxDelay time.Duration
+	// now is overridden in tests
+	now func() time.Time
+
+	mu sync.Mutex
+	// until is the end of the pause, and consecutive the number of throttlings since the last
+	// pause ended with a successful request.
+	until       time.Time
+	consecutive int
+	paused      bool
+}
+
+func newHubThrottle(logger *zap.SugaredLogger, maxDelay time.Duration) *hubThrottle {
+	return &hubThrottle{logger: logger, maxDelay: maxDelay, now: time.Now}
+}
+
+// wrap returns the transport of the hub clients observing their responses.
+func (h *hubThrottle) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &hubThrottleRoundTripper{next: rt, throttle: h}
+}
+
+// observe pauses the reconciles when the response of the hub API server is throttled, for its
+// Retry-After or, when the throttling goes on, for a delay doubling up to the max delay.
+func (h *hubThrottle) observe(resp *http.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		if !now.Before(h.until) {
+			h.consecutive = 0
+		}
+		return
+	}
+
+	if !now.Before(h.until) {
+		h.consecutive++
+	}
+	delay := hubThrottleBaseDelay << min(h.consecutive-1, 16)
+	delay = min(max(delay, retryAfter(resp.Header.Get("Retry-After"), now)), h.maxDelay)
+	if until := now.Add(delay); until.After(h.until) {
+		h.until = until
+	}
+	if !h.paused {
+		h.paused = true
+		h.logger.Warnf("the hub API server throttled the controller, pausing the reconciles for %s", h.until.Sub(now))
+		recordHubThrottled(context.Background(), true)
+	}
+}
+
+// delay returns how long the reconciles are still paused, zero when they aren't.
+func (h *hubThrottle) delay() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if delay := h.until.Sub(h.now()); delay > 0 {
+		return delay
+	}
+	if h.paused {
+		h.paused = false
+		h.logger.Info("resuming the reconciles paused by the hub API server throttling")
+		recordHubThrottled(context.Background(), false)
+	}
+	return 0
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date, zero when unset or
+// invalid.
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// hubThrottleRoundTripper reports the responses of the hub API server to its hubThrottle.
+type hubThrottleRoundTripper struct {
+	next     http.RoundTripper
+	throttle *hubThrottle
+}
+
+func (t *hubThrottleRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.throttle.observe(resp)
+	}
+	return resp, err
+}
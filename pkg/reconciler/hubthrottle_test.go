@@ -0,0 +1,111 @@
+package reconciler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func throttledResponse(retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Fri, 02 Jan 2026 03:04:35 GMT": 30 * time.Second,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+	} {
+		assert.Equal(t, expected, retryAfter(value, now), value)
+	}
+}
+
+func TestHubThrottle(t *testing.T) {
+	throttle := newHubThrottle(zap.NewNop().Sugar(), 10*time.Second)
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+	ok := &http.Response{StatusCode: http.StatusOK}
+
+	throttle.observe(ok)
+	assert.Equal(t, time.Duration(0), throttle.delay())
+
+	// The Retry-After of the API server is honored
+	throttle.observe(throttledResponse("3"))
+	assert.Equal(t, 3*time.Second, throttle.delay())
+
+	// The throttled responses within the pause don't count as another throttling
+	throttle.observe(throttledResponse(""))
+	assert.Equal(t, 3*time.Second, throttle.delay())
+
+	// While the throttling goes on, the pause doubles up to the max delay
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		now = now.Add(throttle.delay())
+		assert.Equal(t, time.Duration(0), throttle.delay())
+		throttle.observe(throttledResponse("1"))
+		assert.Equal(t, expected, throttle.delay())
+	}
+	now = now.Add(throttle.delay())
+	throttle.observe(throttledResponse("600"))
+	assert.Equal(t, 10*time.Second, throttle.delay(), "the Retry-After is bounded by the max delay")
+
+	// A successful request after the pause resets it
+	now = now.Add(throttle.delay())
+	throttle.observe(ok)
+	throttle.observe(throttledResponse(""))
+	assert.Equal(t, hubThrottleBaseDelay, throttle.delay())
+
+	// Without HUB_THROTTLE_MAX_DELAY the reconciles are never paused
+	assert.Equal(t, time.Duration(0), (*hubThrottle)(nil).delay())
+}
+
+func TestHubThrottleRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	throttle := newHubThrottle(zap.NewNop().Sugar(), time.Minute)
+	cfg := &rest.Config{Host: server.URL}
+	cfg.Wrap(throttle.wrap)
+	client, err := kubernetes.NewForConfig(cfg)
+	assert.NilError(t, err)
+
+	// client-go retries the throttled request, each response is observed
+	_, err = client.Discovery().ServerVersion()
+	assert.ErrorContains(t, err, "")
+	assert.Assert(t, throttle.delay() > 0)
+}
+
+func TestObserveHubThrottled(t *testing.T) {
+	throttle := newHubThrottle(zap.NewNop().Sugar(), time.Minute)
+	throttle.observe(throttledResponse("30"))
+	r := &Reconciler{logger: zap.NewNop().Sugar(), hubThrottle: throttle}
+
+	reconciled := false
+	err := r.observe(context.Background(), dispatchedWorkload(nil), func(context.Context, *kueuev1beta1.Workload) error {
+		reconciled = true
+		return nil
+	})
+	assert.Assert(t, !reconciled, "no reconcile may reach the throttled hub")
+	ok, delay := controller.IsRequeueKey(err)
+	assert.Assert(t, ok)
+	assert.Assert(t, delay >= 30*time.Second && delay <= 45*time.Second, "got %s", delay)
+}
@@ -0,0 +1,36 @@
+package reconciler
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// idempotentWrite reports whether the existing spoke secret was already written with the content
+// of the secret to sync for the same generation of the same Workload, as recorded by their
+// idempotencyKeyAnnotation and checksumAnnotation, so writing it again would change nothing the
+// Workload asked for. The secrets written before the key or the checksum was recorded, or for
+// another Workload sharing them, aren't.
+func idempotentWrite(existing, secret *corev1.Secret) bool {
+	key := secret.GetAnnotations()[idempotencyKeyAnnotation]
+	if key == "" || existing.GetAnnotations()[idempotencyKeyAnnotation] != key {
+		return false
+	}
+	checksum, ok := existing.GetAnnotations()[checksumAnnotation]
+	return ok && checksum == secretContentHash(secret)
+}
+
+// staleIdempotencyKey reports whether the existing spoke secret records an older generation of the
+// Workload of the secret to sync in its idempotencyKeyAnnotation, so the metadata repair records
+// the current one. The key of another Workload sharing the secret is left, like its
+// workloadAnnotation, so the Workloads of a namespace don't patch it in turns.
+func staleIdempotencyKey(existing, secret *corev1.Secret) bool {
+	key := secret.GetAnnotations()[idempotencyKeyAnnotation]
+	current, ok := existing.GetAnnotations()[idempotencyKeyAnnotation]
+	if key == "" || !ok || current == key {
+		return false
+	}
+	uid, _, _ := strings.Cut(key, "/")
+	currentUID, _, _ := strings.Cut(current, "/")
+	return uid == currentUID
+}
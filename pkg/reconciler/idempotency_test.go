@@ -0,0 +1,150 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRefreshSpokeSecretIdempotencyKey(t *testing.T) {
+	// The spoke secret was written for generation 1, the hub secret got a label since
+	synced := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-secret",
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload", idempotencyKeyAnnotation: "workload-uid/1"},
+		},
+		Data: map[string][]byte{defaultSecretDataKey: []byte("token")},
+	}
+	setChecksum(synced)
+
+	tests := []struct {
+		name          string
+		secret        func(*corev1.Secret)
+		rotate        bool
+		hubUpdated    bool
+		expectedVerbs []string
+		expectedKey   string
+		expectedTeam  string
+	}{
+		{
+			name:          "same generation",
+			secret:        func(secret *corev1.Secret) { delete(secret.Labels, "team") },
+			expectedVerbs: []string{"get"},
+			expectedKey:   "workload-uid/1",
+		},
+		{
+			// An event storm on the same generation writes nothing
+			name:          "same generation with drifted labels",
+			expectedVerbs: []string{"get"},
+			expectedKey:   "workload-uid/1",
+		},
+		{
+			name:          "hub update with drifted labels",
+			hubUpdated:    true,
+			expectedVerbs: []string{"get", "patch"},
+			expectedKey:   "workload-uid/1",
+			expectedTeam:  "a",
+		},
+		{
+			name: "new generation",
+			secret: func(secret *corev1.Secret) {
+				delete(secret.Labels, "team")
+				secret.Annotations[idempotencyKeyAnnotation] = "workload-uid/2"
+			},
+			expectedVerbs: []string{"get", "patch"},
+			expectedKey:   "workload-uid/2",
+		},
+		{
+			name: "another Workload",
+			secret: func(secret *corev1.Secret) {
+				delete(secret.Labels, "team")
+				secret.Annotations[idempotencyKeyAnnotation] = "other-uid/1"
+			},
+			expectedVerbs: []string{"get"},
+			expectedKey:   "workload-uid/1",
+		},
+		{
+			name: "content changed",
+			secret: func(secret *corev1.Secret) {
+				secret.Data = map[string][]byte{defaultSecretDataKey: []byte("new-token")}
+				setChecksum(secret)
+			},
+			expectedVerbs: []string{"get", "update"},
+			expectedKey:   "workload-uid/1",
+			expectedTeam:  "a",
+		},
+		{
+			name: "rotation requested",
+			secret: func(secret *corev1.Secret) {
+				secret.Data = map[string][]byte{defaultSecretDataKey: []byte("rotated-token")}
+			},
+			rotate:        true,
+			expectedVerbs: []string{"get", "update"},
+			expectedKey:   "workload-uid/1",
+			expectedTeam:  "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			spokeKubeClient := fake.NewSimpleClientset(synced.DeepCopy())
+			r := &Reconciler{logger: zap.NewNop().Sugar()}
+			secret := synced.DeepCopy()
+			secret.Labels["team"] = "a"
+			if tt.secret != nil {
+				tt.secret(secret)
+			}
+
+			_, _, err := r.refreshSpokeSecret(ctx, testClusterName, spokeKubeClient, secret, tt.rotate, tt.hubUpdated, false)
+			assert.NilError(t, err)
+			var verbs []string
+			for _, action := range spokeKubeClient.Actions() {
+				verbs = append(verbs, action.GetVerb())
+			}
+			assert.DeepEqual(t, tt.expectedVerbs, verbs)
+
+			spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedKey, spokeSecret.Annotations[idempotencyKeyAnnotation])
+			assert.Equal(t, tt.expectedTeam, spokeSecret.Labels["team"])
+		})
+	}
+}
+
+func TestIdempotentWrite(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{idempotencyKeyAnnotation: "workload-uid/1"}},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("token")},
+	}
+	written := secret.DeepCopy()
+	setChecksum(written)
+
+	tests := []struct {
+		name     string
+		existing func(*corev1.Secret)
+		expected bool
+	}{
+		{name: "same key and checksum", expected: true},
+		{name: "older generation", existing: func(s *corev1.Secret) { s.Annotations[idempotencyKeyAnnotation] = "workload-uid/0" }},
+		{name: "no key", existing: func(s *corev1.Secret) { delete(s.Annotations, idempotencyKeyAnnotation) }},
+		{name: "no checksum", existing: func(s *corev1.Secret) { delete(s.Annotations, checksumAnnotation) }},
+		{name: "other content", existing: func(s *corev1.Secret) { s.Annotations[checksumAnnotation] = "other" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := written.DeepCopy()
+			if tt.existing != nil {
+				tt.existing(existing)
+			}
+			assert.Equal(t, tt.expected, idempotentWrite(existing, secret))
+		})
+	}
+}
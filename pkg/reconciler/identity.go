@@ -0,0 +1,91 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// spokeIdentityTTL is how long the identity used on a spoke cluster is remembered, so a rotated
+// kubeconfig shows up in the audit events without reviewing it on every reconcile.
+const spokeIdentityTTL = 5 * time.Minute
+
+// spokeIdentity is the user the controller authenticates as on a spoke cluster.
+type spokeIdentity struct {
+	username  string
+	checkedAt time.Time
+}
+
+// spokeIdentities remembers the identities used on the spoke clusters, recorded with the audit
+// events of their writes. A nil spokeIdentities records none.
+type spokeIdentities struct {
+	// now is overridden in tests
+	now func() time.Time
+	// reviewing serializes the reviews of each spoke cluster
+	reviewing keyedMutex
+
+	mu         sync.Mutex
+	identities map[string]spokeIdentity
+}
+
+func newSpokeIdentities() *spokeIdentities {
+	return &spokeIdentities{now: time.Now, identities: map[string]spokeIdentity{}}
+}
+
+// resolve reviews the identity of the spoke client with a SelfSubjectReview, once per
+// spokeIdentityTTL. A failed review, e.g. on a spoke cluster older than Kubernetes 1.28, is
+// remembered too, the audit events of the cluster then have no identity until the next review.
+// The reviews of a cluster are serialized while the other clusters are reviewed concurrently.
+func (s *spokeIdentities) resolve(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) error {
+	if s == nil {
+		return nil
+	}
+	if s.reviewed(clusterName) {
+		return nil
+	}
+	unlock, err := s.reviewing.lock(ctx, clusterName)
+	if err != nil {
+		return fmt.Errorf("could not review the identity used on spoke cluster %s: %w", clusterName, err)
+	}
+	defer unlock()
+	if s.reviewed(clusterName) {
+		return nil
+	}
+
+	identity := spokeIdentity{checkedAt: s.now()}
+	review, err := spokeKubeClient.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil {
+		identity.username = review.Status.UserInfo.Username
+	}
+	s.mu.Lock()
+	s.identities[clusterName] = identity
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("could not review the identity used on spoke cluster %s: %w", clusterName, spokeError(err))
+	}
+	return nil
+}
+
+// reviewed reports whether the identity used on the spoke cluster was reviewed within
+// spokeIdentityTTL.
+func (s *spokeIdentities) reviewed(clusterName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity, ok := s.identities[clusterName]
+	return ok && s.now().Sub(identity.checkedAt) < spokeIdentityTTL
+}
+
+// get returns the identity used on the spoke cluster, empty when it isn't known.
+func (s *spokeIdentities) get(clusterName string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.identities[clusterName].username
+}
@@ -0,0 +1,59 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSpokeIdentities(t *testing.T) {
+	ctx := context.Background()
+	reviews := 0
+	username := "system:serviceaccount:kube-system:secret-syncer"
+	var reviewErr error
+	spokeKubeClient := fake.NewSimpleClientset()
+	spokeKubeClient.PrependReactor("create", "selfsubjectreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		if reviewErr != nil {
+			return true, nil, reviewErr
+		}
+		review := &authenticationv1.SelfSubjectReview{}
+		review.Status.UserInfo.Username = username
+		return true, review, nil
+	})
+	identities := newSpokeIdentities()
+	now := time.Now()
+	identities.now = func() time.Time { return now }
+
+	assert.NilError(t, identities.resolve(ctx, testClusterName, spokeKubeClient))
+	assert.Equal(t, username, identities.get(testClusterName))
+	assert.Equal(t, "", identities.get("other-cluster"))
+
+	// The identity is reviewed again once per TTL
+	assert.NilError(t, identities.resolve(ctx, testClusterName, spokeKubeClient))
+	assert.Equal(t, 1, reviews)
+	now = now.Add(spokeIdentityTTL)
+	username = "spoke-admin"
+	assert.NilError(t, identities.resolve(ctx, testClusterName, spokeKubeClient))
+	assert.Equal(t, "spoke-admin", identities.get(testClusterName))
+
+	// A failed review is remembered, without an identity
+	now = now.Add(spokeIdentityTTL)
+	reviewErr = errors.New("the server could not find the requested resource")
+	assert.ErrorContains(t, identities.resolve(ctx, testClusterName, spokeKubeClient), "could not review the identity used on spoke cluster "+testClusterName)
+	assert.Equal(t, "", identities.get(testClusterName))
+	assert.NilError(t, identities.resolve(ctx, testClusterName, spokeKubeClient))
+	assert.Equal(t, 3, reviews)
+
+	// A nil spokeIdentities records none
+	var disabled *spokeIdentities
+	assert.NilError(t, disabled.resolve(ctx, testClusterName, spokeKubeClient))
+	assert.Equal(t, "", disabled.get(testClusterName))
+}
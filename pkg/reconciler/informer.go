@@ -0,0 +1,170 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/logging"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
+	kueueinformers "sigs.k8s.io/kueue/client-go/informers/externalversions"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+
+	kueueclient "github.com/zakisk/secret-service/pkg/client/injection/client"
+	kueuefactory "github.com/zakisk/secret-service/pkg/client/injection/informers/factory"
+)
+
+// defaultWorkloadResyncJitter spreads the resyncs of the replicas, which would otherwise list and
+// reconcile every Workload at the same time after a rollout.
+const defaultWorkloadResyncJitter = 0.1
+
+func init() {
+	// Registered after the generated factory, which this package imports, so it replaces it
+	// before the injected Workload informer is created
+	injection.Default.RegisterInformerFactory(withWorkloadInformerFactory)
+}
+
+// withWorkloadInformerFactory injects a Kueue informer factory narrowing the Workloads to the
+// configured selectors and stripping them with transformWorkload, neither of which the generated
+// factory supports.
+func withWorkloadInformerFactory(ctx context.Context) context.Context {
+	opts, err := optionsFromEnv()
+	if err != nil {
+		logging.FromContext(ctx).Fatalf("Invalid configuration: %v", err)
+	}
+
+	var namespace string
+	if injection.HasNamespaceScope(ctx) {
+		namespace = injection.GetNamespaceScope(ctx)
+	}
+	return context.WithValue(ctx, kueuefactory.Key{}, newWorkloadInformerFactory(ctx, kueueclient.Get(ctx), opts, namespace))
+}
+
+// newWorkloadInformerFactory returns a Kueue informer factory narrowing the Workloads to the
+// configured selectors and the namespace, all namespaces when empty, and stripping them with
+// transformWorkload.
+func newWorkloadInformerFactory(ctx context.Context, client kueueversioned.Interface, opts *options, namespace string) kueueinformers.SharedInformerFactory {
+	informerOptions := []kueueinformers.SharedInformerOption{
+		kueueinformers.WithTransform(transformWorkload),
+		kueueinformers.WithTweakListOptions(workloadListOptions(opts.workloadLabelSelector, opts.workloadFieldSelector)),
+	}
+	if namespace != "" {
+		informerOptions = append(informerOptions, kueueinformers.WithNamespace(namespace))
+	}
+	return kueueinformers.NewSharedInformerFactoryWithOptions(client, workloadResyncPeriod(ctx, opts), informerOptions...)
+}
+
+// workloadResyncPeriod returns the resync period of the Workload informers, the configured one or
+// the one of the controller framework, jittered once per informer factory.
+func workloadResyncPeriod(ctx context.Context, opts *options) time.Duration {
+	period := opts.workloadResyncPeriod
+	if period == 0 {
+		period = controller.GetResyncPeriod(ctx)
+	}
+	// wait.Jitter jitters up to the period itself without a factor
+	if opts.workloadResyncJitter == 0 {
+		return period
+	}
+	return wait.Jitter(period, opts.workloadResyncJitter)
+}
+
+// lastAppliedConfigAnnotation is set by kubectl apply and holds a copy of the whole object.
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// transformWorkload strips the parts of a Workload the controller never reads before it is
+// cached, keeping memory bounded on hubs with tens of thousands of Workloads. Stripped Workloads
+// must never be written back with an update, see patchWorkloadMetadata.
+func transformWorkload(obj any) (any, error) {
+	workload, ok := obj.(*kueuev1beta1.Workload)
+	if !ok {
+		// e.g. cache.DeletedFinalStateUnknown
+		return obj, nil
+	}
+
+	workload.SetManagedFields(nil)
+	if _, ok := workload.Annotations[lastAppliedConfigAnnotation]; ok {
+		delete(workload.Annotations, lastAppliedConfigAnnotation)
+	}
+
+	// The pod templates are by far the largest part of a Workload
+	workload.Spec.PodSets = nil
+
+	if workload.Status.Admission != nil {
+		workload.Status.Admission.PodSetAssignments = nil
+	}
+	workload.Status.RequeueState = nil
+	workload.Status.ReclaimablePods = nil
+	workload.Status.AdmissionChecks = nil
+	workload.Status.ResourceRequests = nil
+	workload.Status.SchedulingStats = nil
+
+	return workload, nil
+}
+
+// workloadListOptions returns the tweak narrowing the Workloads watched by the informer.
+func workloadListOptions(labelSelector, fieldSelector string) func(*metav1.ListOptions) {
+	return func(options *metav1.ListOptions) {
+		if labelSelector != "" {
+			options.LabelSelector = labelSelector
+		}
+		if fieldSelector != "" {
+			options.FieldSelector = fieldSelector
+		}
+	}
+}
+
+// pipelineRunWorkloadLister only lists the PipelineRun owned Workloads of the queues, so the
+// generated reconciler neither promotes the others nor adds the cleanup finalizer to them.
+type pipelineRunWorkloadLister struct {
+	kueuev1beta1lister.WorkloadLister
+	queues workloadQueueFilter
+}
+
+func (l pipelineRunWorkloadLister) List(selector labels.Selector) ([]*kueuev1beta1.Workload, error) {
+	return pipelineRunOwnedWorkloads(l.queues)(l.WorkloadLister.List(selector))
+}
+
+func (l pipelineRunWorkloadLister) Workloads(namespace string) kueuev1beta1lister.WorkloadNamespaceLister {
+	return pipelineRunWorkloadNamespaceLister{l.WorkloadLister.Workloads(namespace), l.queues}
+}
+
+type pipelineRunWorkloadNamespaceLister struct {
+	kueuev1beta1lister.WorkloadNamespaceLister
+	queues workloadQueueFilter
+}
+
+func (l pipelineRunWorkloadNamespaceLister) List(selector labels.Selector) ([]*kueuev1beta1.Workload, error) {
+	return pipelineRunOwnedWorkloads(l.queues)(l.WorkloadNamespaceLister.List(selector))
+}
+
+func (l pipelineRunWorkloadNamespaceLister) Get(name string) (*kueuev1beta1.Workload, error) {
+	workload, err := l.WorkloadNamespaceLister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !l.queues.owned(workload) || !l.queues.matches(workload) {
+		return nil, errors.NewNotFound(kueuev1beta1.Resource("workloads"), name)
+	}
+	return workload, nil
+}
+
+func pipelineRunOwnedWorkloads(queues workloadQueueFilter) func([]*kueuev1beta1.Workload, error) ([]*kueuev1beta1.Workload, error) {
+	return func(workloads []*kueuev1beta1.Workload, err error) ([]*kueuev1beta1.Workload, error) {
+		if err != nil {
+			return nil, err
+		}
+		owned := make([]*kueuev1beta1.Workload, 0, len(workloads))
+		for _, workload := range workloads {
+			if queues.owned(workload) && queues.matches(workload) {
+				owned = append(owned, workload)
+			}
+		}
+		return owned, nil
+	}
+}
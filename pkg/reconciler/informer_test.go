@@ -0,0 +1,118 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestTransformWorkload(t *testing.T) {
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-workload",
+			Namespace: "test-namespace",
+			Annotations: map[string]string{
+				lastAppliedConfigAnnotation: "{}",
+				syncedSecretsAnnotation:     "cluster/ns/name",
+			},
+			Finalizers:      []string{cleanupFinalizer},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+			ManagedFields:   []metav1.ManagedFieldsEntry{{Manager: "kueue"}},
+		},
+		Spec: kueuev1beta1.WorkloadSpec{
+			Active:  ptr.To(true),
+			PodSets: []kueuev1beta1.PodSet{{Name: "main", Template: corev1.PodTemplateSpec{}}},
+		},
+		Status: kueuev1beta1.WorkloadStatus{
+			ClusterName: ptr.To(testClusterName),
+			Admission: &kueuev1beta1.Admission{
+				ClusterQueue:      "cluster-queue",
+				PodSetAssignments: []kueuev1beta1.PodSetAssignment{{Name: "main"}},
+			},
+			Conditions:       []metav1.Condition{{Type: kueuev1beta1.WorkloadFinished}},
+			ResourceRequests: []kueuev1beta1.PodSetRequest{{Name: "main"}},
+			AdmissionChecks:  []kueuev1beta1.AdmissionCheckState{{Name: "multikueue"}},
+		},
+	}
+
+	obj, err := transformWorkload(workload)
+	assert.NilError(t, err)
+	transformed := obj.(*kueuev1beta1.Workload)
+
+	// Everything the reconciler reads is kept
+	assert.Equal(t, "test-workload", transformed.Name)
+	assert.DeepEqual(t, map[string]string{syncedSecretsAnnotation: "cluster/ns/name"}, transformed.Annotations)
+	assert.DeepEqual(t, []string{cleanupFinalizer}, transformed.Finalizers)
+	assert.Equal(t, 1, len(transformed.OwnerReferences))
+	assert.Equal(t, true, *transformed.Spec.Active)
+	assert.Equal(t, testClusterName, *transformed.Status.ClusterName)
+	assert.Equal(t, kueuev1beta1.ClusterQueueReference("cluster-queue"), transformed.Status.Admission.ClusterQueue)
+	assert.Equal(t, 1, len(transformed.Status.Conditions))
+
+	// Bulky fields are dropped
+	assert.Assert(t, transformed.ManagedFields == nil)
+	assert.Assert(t, transformed.Spec.PodSets == nil)
+	assert.Assert(t, transformed.Status.Admission.PodSetAssignments == nil)
+	assert.Assert(t, transformed.Status.ResourceRequests == nil)
+	assert.Assert(t, transformed.Status.AdmissionChecks == nil)
+
+	// Tombstones are passed through
+	tombstone := cache.DeletedFinalStateUnknown{Key: "test-namespace/test-workload"}
+	obj, err = transformWorkload(tombstone)
+	assert.NilError(t, err)
+	assert.Equal(t, tombstone, obj)
+}
+
+func TestWorkloadListOptions(t *testing.T) {
+	options := &metav1.ListOptions{}
+	workloadListOptions("", "")(options)
+	assert.DeepEqual(t, &metav1.ListOptions{}, options)
+
+	workloadListOptions("app=tekton", "metadata.namespace!=kube-system")(options)
+	assert.Equal(t, "app=tekton", options.LabelSelector)
+	assert.Equal(t, "metadata.namespace!=kube-system", options.FieldSelector)
+}
+
+func TestWorkloadResyncPeriod(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, controller.DefaultResyncPeriod, workloadResyncPeriod(ctx, &options{}))
+	assert.Equal(t, time.Hour, workloadResyncPeriod(controller.WithResyncPeriod(ctx, time.Hour), &options{}))
+	assert.Equal(t, 5*time.Minute, workloadResyncPeriod(ctx, &options{workloadResyncPeriod: 5 * time.Minute}))
+
+	for range 10 {
+		period := workloadResyncPeriod(ctx, &options{workloadResyncPeriod: 5 * time.Minute, workloadResyncJitter: 0.5})
+		assert.Assert(t, period >= 5*time.Minute && period < 7*time.Minute+30*time.Second, period)
+	}
+}
+
+func TestPipelineRunWorkloadLister(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, indexer.Add(pipelineRunOwnedWorkload("test-namespace", "owned")))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "not-owned", Namespace: "test-namespace"}}))
+	lister := pipelineRunWorkloadLister{WorkloadLister: kueuev1beta1lister.NewWorkloadLister(indexer)}
+
+	workloads, err := lister.List(labels.Everything())
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(workloads))
+	assert.Equal(t, "owned", workloads[0].Name)
+
+	workloads, err = lister.Workloads("test-namespace").List(labels.Everything())
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(workloads))
+
+	_, err = lister.Workloads("test-namespace").Get("owned")
+	assert.NilError(t, err)
+	_, err = lister.Workloads("test-namespace").Get("not-owned")
+	assert.Assert(t, errors.IsNotFound(err), "expected not found error, got %v", err)
+}
@@ -0,0 +1,68 @@
+package reconciler
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedMutex serializes the callers of the same key, e.g. the discoveries of a spoke cluster,
+// without holding back the callers of the other keys. The zero keyedMutex is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// lock waits for the key and returns the function releasing it, or the error of the context
+// when it is done first, so a caller never waits longer than its deadline.
+func (m *keyedMutex) lock(ctx context.Context, key string) (func(), error) {
+	for {
+		m.mu.Lock()
+		held, ok := m.locks[key]
+		if !ok {
+			if m.locks == nil {
+				m.locks = map[string]chan struct{}{}
+			}
+			released := make(chan struct{})
+			m.locks[key] = released
+			m.mu.Unlock()
+			return func() {
+				m.mu.Lock()
+				delete(m.locks, key)
+				m.mu.Unlock()
+				close(released)
+			}, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// withContext returns the result of call, a request which can't be given the context such as a
+// discovery, or the error of the context when it is done first. The abandoned call completes in
+// the background and its result is dropped.
+func withContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	if ctx.Done() == nil {
+		return call()
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		value, err := call()
+		results <- result{value: value, err: err}
+	}()
+	select {
+	case result := <-results:
+		return result.value, result.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,90 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var locks keyedMutex
+	unlock, err := locks.lock(context.Background(), "cluster-a")
+	assert.NilError(t, err)
+
+	// Another key is not held back
+	unlockOther, err := locks.lock(context.Background(), "cluster-b")
+	assert.NilError(t, err)
+	unlockOther()
+
+	// The same key waits for the release, or gives up with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = locks.lock(ctx, "cluster-a")
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := locks.lock(context.Background(), "cluster-a")
+		if err == nil {
+			unlock()
+		}
+		close(acquired)
+	}()
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the released key was not acquired")
+	}
+	assert.Equal(t, len(locks.locks), 0)
+}
+
+func TestWithContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		call          func() (string, error)
+		timeout       time.Duration
+		expectedValue string
+		expectedErr   error
+	}{
+		{
+			name:          "call returns",
+			call:          func() (string, error) { return "v1.30.0", nil },
+			timeout:       time.Second,
+			expectedValue: "v1.30.0",
+		},
+		{
+			name:        "call fails",
+			call:        func() (string, error) { return "", errTestCall },
+			timeout:     time.Second,
+			expectedErr: errTestCall,
+		},
+		{
+			name: "context done first",
+			call: func() (string, error) {
+				time.Sleep(time.Second)
+				return "v1.30.0", nil
+			},
+			timeout:     10 * time.Millisecond,
+			expectedErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			value, err := withContext(ctx, tt.call)
+			if tt.expectedErr != nil {
+				assert.Assert(t, errors.Is(err, tt.expectedErr))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, value, tt.expectedValue)
+		})
+	}
+}
+
+var errTestCall = errors.New("call failed")
@@ -0,0 +1,156 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// Kinds of the SSH_KNOWN_HOSTS_SOURCE, the spoke companion is of the same kind.
+	knownHostsKindSecret    = "secret"
+	knownHostsKindConfigMap = "configmap"
+
+	// defaultKnownHostsKey is the key of the known_hosts content in the source, and in the
+	// spoke companion, where ssh and the Tekton credential initialization look for it.
+	defaultKnownHostsKey = "known_hosts"
+
+	// knownHostsSuffix names the spoke companion after the git-auth secret.
+	knownHostsSuffix = "-known-hosts"
+)
+
+// knownHostsOptions configures the companion known_hosts synced with the git-auth secrets
+// holding SSH credentials.
+type knownHostsOptions struct {
+	// kind is secret or configmap, empty disables the sync
+	kind string
+	// namespace holds the source, the namespace of the PipelineRun when empty
+	namespace string
+	name      string
+	// key holds the known_hosts content in the source
+	key string
+}
+
+// parseKnownHostsSource validates the SSH_KNOWN_HOSTS_SOURCE value, <kind>:[<namespace>/]<name>
+// where kind is secret or configmap, empty or none disables the sync.
+func parseKnownHostsSource(value string) (knownHostsOptions, error) {
+	if value == "" || value == "none" {
+		return knownHostsOptions{}, nil
+	}
+	kind, ref, ok := strings.Cut(value, ":")
+	if !ok || (kind != knownHostsKindSecret && kind != knownHostsKindConfigMap) {
+		return knownHostsOptions{}, fmt.Errorf("unsupported known_hosts source %q, must be none, %s:[<namespace>/]<name> or %s:[<namespace>/]<name>", value, knownHostsKindSecret, knownHostsKindConfigMap)
+	}
+	options := knownHostsOptions{kind: kind, name: ref}
+	if namespace, name, ok := strings.Cut(ref, "/"); ok {
+		options.namespace, options.name = namespace, name
+		if namespace == "" {
+			return knownHostsOptions{}, fmt.Errorf("known_hosts source %q has an empty namespace", value)
+		}
+	}
+	if options.name == "" || strings.Contains(options.name, "/") {
+		return knownHostsOptions{}, fmt.Errorf("known_hosts source %q has an invalid name", value)
+	}
+	return options, nil
+}
+
+// isSSHAuthSecret reports whether the git-auth secret holds SSH credentials.
+func isSSHAuthSecret(secret *corev1.Secret) bool {
+	_, ok := secret.Data[corev1.SSHAuthPrivateKey]
+	return secret.Type == corev1.SecretTypeSSHAuth || ok
+}
+
+// syncKnownHosts copies the configured known_hosts to the spoke companion of the git-auth secret,
+// so the SSH clones of the spoke PipelineRun pass the host key verification. The companion is
+// owned by the spoke PipelineRun, and removed with the git-auth secret. It is a no-op when no
+// source is configured.
+func (r *Reconciler) syncKnownHosts(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, secretName string) error {
+	if r.knownHosts.kind == "" {
+		return nil
+	}
+	namespace := r.knownHosts.namespace
+	if namespace == "" {
+		namespace = pipelineRun.GetNamespace()
+	}
+
+	var content []byte
+	switch r.knownHosts.kind {
+	case knownHostsKindSecret:
+		secret, err := r.hubKubeClient.CoreV1().Secrets(namespace).Get(ctx, r.knownHosts.name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get the known_hosts secret %s/%s: %w", namespace, r.knownHosts.name, err)
+		}
+		content = secret.Data[r.knownHosts.key]
+	default:
+		configMap, err := r.hubKubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, r.knownHosts.name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get the known_hosts ConfigMap %s/%s: %w", namespace, r.knownHosts.name, err)
+		}
+		content = []byte(configMap.Data[r.knownHosts.key])
+	}
+	if len(content) == 0 {
+		return fmt.Errorf("the known_hosts %s %s/%s has no %s key", r.knownHosts.kind, namespace, r.knownHosts.name, r.knownHosts.key)
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      secretName + knownHostsSuffix,
+		Namespace: pipelineRun.GetNamespace(),
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "PipelineRun",
+			Name:       pipelineRun.GetName(),
+			UID:        pipelineRun.GetUID(),
+		}},
+	}
+	if r.knownHosts.kind == knownHostsKindConfigMap {
+		configMap := &corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{defaultKnownHostsKey: string(content)}}
+		return r.writeSpokeConfigMap(ctx, clusterName, spokeKubeClient, spokeConfigMap(configMap, pipelineRun, workload, r.spokePipelineRunAPIVersion(clusterName)))
+	}
+
+	secret := &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: map[string][]byte{defaultKnownHostsKey: content}}
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "known_hosts of SSH git-auth secret",
+		Cluster:     clusterName,
+		Secret:      secret.Namespace + "/" + secret.Name,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}.withContent(secret)
+	_, _, err := r.writeSpokeSecret(ctx, clusterName, spokeKubeClient, workload.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload), event)
+	return err
+}
+
+// deleteKnownHosts deletes the spoke companion of a synced secret, when it has one. It is a
+// no-op when no source is configured.
+func (r *Reconciler) deleteKnownHosts(ctx context.Context, spokeKubeClient kubernetes.Interface, ref syncedSecretRef, workloadKey string) error {
+	ref.Name += knownHostsSuffix
+	switch r.knownHosts.kind {
+	case knownHostsKindConfigMap:
+		return r.deleteConfigMapOnSpokeCluster(ctx, spokeKubeClient, ref, workloadKey)
+	case knownHostsKindSecret:
+		spokeCtx, cancel := r.spokeContext(ctx)
+		existing, err := spokeKubeClient.CoreV1().Secrets(ref.Namespace).Get(spokeCtx, ref.Name, metav1.GetOptions{})
+		cancel()
+		if err = spokeError(err); errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isManagedSpokeSecret(existing) || existing.Annotations[workloadAnnotation] != workloadKey {
+			return nil
+		}
+		return r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, workloadKey, "Workload deleted")
+	default:
+		return nil
+	}
+}
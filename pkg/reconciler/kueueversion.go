@@ -0,0 +1,94 @@
+package reconciler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// workloadAPICheckTTL is how long the Workload versions served by the hub are remembered by
+// the readiness check, which notices a Kueue upgrade dropping the version of the controller.
+const workloadAPICheckTTL = time.Minute
+
+// workloadAPIVersion is the version of the Workloads the controller lists, watches and updates,
+// the one of its Kueue clients and informers.
+var workloadAPIVersion = kueuev1beta1.GroupVersion
+
+// workloadAPIVersions are the versions of the Workloads served by the hub.
+type workloadAPIVersions struct {
+	// served are the versions of the Kueue group serving the Workloads, in the order of the
+	// discovery, the preferred one first
+	served []string
+	// preferred is the version the hub prefers, the storage version of upgraded Kueue releases
+	preferred string
+}
+
+// discoverWorkloadAPIVersions discovers the versions of the Workloads served by the hub.
+func discoverWorkloadAPIVersions(client discovery.DiscoveryInterface) (workloadAPIVersions, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return workloadAPIVersions{}, fmt.Errorf("could not discover the API groups of the hub: %w", err)
+	}
+	var versions workloadAPIVersions
+	for _, group := range groups.Groups {
+		if group.Name != workloadAPIVersion.Group {
+			continue
+		}
+		for _, version := range group.Versions {
+			served, err := servesResource(client.ServerResourcesForGroupVersion, version.GroupVersion, "workloads")
+			if err != nil {
+				return workloadAPIVersions{}, fmt.Errorf("could not discover %s on the hub: %w", version.GroupVersion, err)
+			}
+			if served {
+				versions.served = append(versions.served, version.Version)
+			}
+		}
+		if slices.Contains(versions.served, group.PreferredVersion.Version) {
+			versions.preferred = group.PreferredVersion.Version
+		}
+	}
+	return versions, nil
+}
+
+// negotiate checks the hub serves the Workloads in the version of the controller. A hub
+// preferring a newer version still serves the older one, converted by its API server, until the
+// Kueue release removing it; the controller then needs a release built with the newer version.
+func (v workloadAPIVersions) negotiate() (string, error) {
+	if len(v.served) == 0 {
+		return "", fmt.Errorf("the hub doesn't serve the %s Workloads, is Kueue installed?", workloadAPIVersion.Group)
+	}
+	if !slices.Contains(v.served, workloadAPIVersion.Version) {
+		return "", fmt.Errorf("the hub serves the %s Workloads as %s, not as %s: upgrade the controller to a release supporting the Kueue release of the hub",
+			workloadAPIVersion.Group, strings.Join(v.served, ", "), workloadAPIVersion.Version)
+	}
+	return workloadAPIVersion.Version, nil
+}
+
+// workloadAPICheck checks the hub still serves the Workloads in the version of the controller.
+// Results are cached for workloadAPICheckTTL.
+func workloadAPICheck(client discovery.DiscoveryInterface) func() error {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		lastErr   error
+	)
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(checkedAt) < workloadAPICheckTTL {
+			return lastErr
+		}
+
+		versions, err := discoverWorkloadAPIVersions(client)
+		if err == nil {
+			_, err = versions.negotiate()
+		}
+		lastErr, checkedAt = err, time.Now()
+		return lastErr
+	}
+}
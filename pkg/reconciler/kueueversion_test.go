@@ -0,0 +1,81 @@
+package reconciler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var (
+	kueueV1beta1Resources  = &metav1.APIResourceList{GroupVersion: "kueue.x-k8s.io/v1beta1", APIResources: []metav1.APIResource{{Name: "workloads"}, {Name: "localqueues"}}}
+	kueueV1beta2Resources  = &metav1.APIResourceList{GroupVersion: "kueue.x-k8s.io/v1beta2", APIResources: []metav1.APIResource{{Name: "workloads"}}}
+	kueueV1alpha1Resources = &metav1.APIResourceList{GroupVersion: "kueue.x-k8s.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "cohorts"}}}
+)
+
+func TestNegotiateWorkloadAPIVersion(t *testing.T) {
+	tests := []struct {
+		name             string
+		resources        []*metav1.APIResourceList
+		expectedVersions workloadAPIVersions
+		expectedError    string
+	}{
+		{
+			name:             "v1beta1",
+			resources:        []*metav1.APIResourceList{kueueV1beta1Resources, kueueV1alpha1Resources, coreResources},
+			expectedVersions: workloadAPIVersions{served: []string{"v1beta1"}, preferred: "v1beta1"},
+		},
+		{
+			name:             "newer version preferred",
+			resources:        []*metav1.APIResourceList{kueueV1beta2Resources, kueueV1beta1Resources},
+			expectedVersions: workloadAPIVersions{served: []string{"v1beta2", "v1beta1"}, preferred: "v1beta2"},
+		},
+		{
+			name:             "v1beta1 removed",
+			resources:        []*metav1.APIResourceList{kueueV1beta2Resources},
+			expectedVersions: workloadAPIVersions{served: []string{"v1beta2"}, preferred: "v1beta2"},
+			expectedError:    "the hub serves the kueue.x-k8s.io Workloads as v1beta2, not as v1beta1: upgrade the controller to a release supporting the Kueue release of the hub",
+		},
+		{
+			name:          "kueue not installed",
+			resources:     []*metav1.APIResourceList{coreResources},
+			expectedError: "the hub doesn't serve the kueue.x-k8s.io Workloads, is Kueue installed?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: tt.resources}}
+			versions, err := discoverWorkloadAPIVersions(client)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedVersions, versions, cmp.AllowUnexported(workloadAPIVersions{}))
+
+			version, err := versions.negotiate()
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, "v1beta1", version)
+		})
+	}
+}
+
+func TestWorkloadAPICheck(t *testing.T) {
+	fake := &clienttesting.Fake{Resources: []*metav1.APIResourceList{kueueV1beta1Resources}}
+	failure := errors.New("hub unreachable")
+	fake.PrependReactor("get", "group", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, failure
+	})
+
+	check := workloadAPICheck(&fakediscovery.FakeDiscovery{Fake: fake})
+	assert.ErrorIs(t, check(), failure)
+	// The failed discovery is remembered rather than retried on every probe
+	fake.ReactionChain = fake.ReactionChain[1:]
+	assert.ErrorIs(t, check(), failure)
+}
@@ -0,0 +1,91 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+// namespaceBucket is a bucket holding all the keys of a namespace.
+type namespaceBucket string
+
+func (b namespaceBucket) Name() string { return string(b) }
+
+func (b namespaceBucket) Has(key types.NamespacedName) bool { return key.Namespace == string(b) }
+
+func pipelineRunOwnedWorkload(namespace, name string) *kueuev1beta1.Workload {
+	return &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "PipelineRun", Name: "test-pipeline-run"},
+			},
+		},
+	}
+}
+
+// leaderFor returns a leader of the bucket, standing in for the generated reconciler.
+func leaderFor(t *testing.T, b reconciler.Bucket) leaderChecker {
+	t.Helper()
+	leader := &reconciler.LeaderAwareFuncs{}
+	assert.NilError(t, leader.Promote(b, nil))
+	return leader
+}
+
+func TestPromote(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, workload := range []*kueuev1beta1.Workload{
+		pipelineRunOwnedWorkload("ns-1", "workload-1"),
+		pipelineRunOwnedWorkload("ns-1", "workload-2"),
+		pipelineRunOwnedWorkload("ns-2", "workload-3"),
+		{ObjectMeta: metav1.ObjectMeta{Name: "not-owned", Namespace: "ns-1"}},
+	} {
+		assert.NilError(t, indexer.Add(workload))
+	}
+
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+	}
+	rec := newWorkloadReconciler(context.Background(), r).(reconciler.LeaderAware)
+
+	// Like controller.Impl, only the keys of the bucket are enqueued
+	enqueued := map[types.NamespacedName]bool{}
+	assert.NilError(t, rec.Promote(namespaceBucket("ns-1"), func(b reconciler.Bucket, key types.NamespacedName) {
+		if b.Has(key) {
+			enqueued[key] = true
+		}
+	}))
+
+	assert.DeepEqual(t, map[types.NamespacedName]bool{
+		{Namespace: "ns-1", Name: "workload-1"}: true,
+		{Namespace: "ns-1", Name: "workload-2"}: true,
+	}, enqueued)
+	assert.Assert(t, r.isLeaderFor(types.NamespacedName{Namespace: "ns-1", Name: "other"}))
+	assert.Assert(t, !r.isLeaderFor(types.NamespacedName{Namespace: "ns-2", Name: "workload-3"}))
+
+	rec.Demote(namespaceBucket("ns-1"))
+	assert.Assert(t, !r.isLeaderFor(types.NamespacedName{Namespace: "ns-1", Name: "workload-1"}))
+}
+
+func TestReconcileSkipsKeysOfOtherLeaders(t *testing.T) {
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+	}
+	rec := newWorkloadReconciler(context.Background(), r)
+	assert.NilError(t, rec.(reconciler.LeaderAware).Promote(namespaceBucket("ns-1"), nil))
+
+	err := rec.Reconcile(context.Background(), "ns-2/workload")
+	assert.Assert(t, controller.IsSkipKey(err), "expected skip key error, got %v", err)
+}
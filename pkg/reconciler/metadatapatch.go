@@ -0,0 +1,80 @@
+package reconciler
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// metadataPatch returns the JSON merge patch turning the metadata of the existing spoke object
+// into the one of the updated copy: only its changed labels and annotations, null for the removed
+// ones, and its owner references when they changed. The resourceVersion precondition rejects the
+// patch when the object changed since it was read, like an update would be. It returns nil when
+// the metadata are unchanged.
+func metadataPatch(existing, updated metav1.Object) ([]byte, error) {
+	metadata := map[string]any{}
+	if labels := mapDelta(existing.GetLabels(), updated.GetLabels()); len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if annotations := mapDelta(existing.GetAnnotations(), updated.GetAnnotations()); len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	if !equality.Semantic.DeepEqual(existing.GetOwnerReferences(), updated.GetOwnerReferences()) {
+		// A merge patch replaces the lists as a whole
+		metadata["ownerReferences"] = updated.GetOwnerReferences()
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	if rv := existing.GetResourceVersion(); rv != "" {
+		metadata["resourceVersion"] = rv
+	}
+	return json.Marshal(map[string]any{"metadata": metadata})
+}
+
+// mapDelta returns the entries of updated which differ from existing, and a nil value for those
+// of existing updated no longer has.
+func mapDelta(existing, updated map[string]string) map[string]any {
+	delta := map[string]any{}
+	for key, value := range updated {
+		if current, ok := existing[key]; !ok || current != value {
+			delta[key] = value
+		}
+	}
+	for key := range existing {
+		if _, ok := updated[key]; !ok {
+			delta[key] = nil
+		}
+	}
+	return delta
+}
+
+// metadataDrifted reports whether a label or an annotation of the secret to sync is missing from,
+// or differs on, the existing spoke secret. The annotations binding it to its Workload and
+// PipelineRun are left out, a secret shared by the PipelineRuns of a namespace keeps those it was
+// synced with. Its idempotency key only drifts when it records an older generation of the same
+// Workload.
+func metadataDrifted(existing, secret *corev1.Secret) bool {
+	for key, value := range secret.Labels {
+		if current, ok := existing.Labels[key]; !ok || current != value {
+			return true
+		}
+	}
+	for key, value := range secret.Annotations {
+		switch key {
+		case workloadAnnotation, pipelineRunAnnotation, pipelineRunUIDAnnotation:
+			continue
+		case idempotencyKeyAnnotation:
+			if staleIdempotencyKey(existing, secret) {
+				return true
+			}
+			continue
+		}
+		if current, ok := existing.Annotations[key]; !ok || current != value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMetadataPatch(t *testing.T) {
+	existing := metav1.ObjectMeta{
+		ResourceVersion: "42",
+		Labels:          map[string]string{managedByLabel: managedByValue, "team": "a"},
+		Annotations:     map[string]string{workloadAnnotation: "test-namespace/test-workload", "removed": "true"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "old-uid"}},
+	}
+
+	tests := []struct {
+		name     string
+		updated  metav1.ObjectMeta
+		expected string
+	}{
+		{
+			name:    "unchanged",
+			updated: existing,
+		},
+		{
+			name: "labels and annotations",
+			updated: metav1.ObjectMeta{
+				Labels:          map[string]string{managedByLabel: managedByValue, "team": "b"},
+				Annotations:     map[string]string{workloadAnnotation: "test-namespace/other-workload"},
+				OwnerReferences: existing.OwnerReferences,
+			},
+			expected: `{"metadata":{"annotations":{"removed":null,"secret-syncer.tekton.dev/workload":"test-namespace/other-workload"},"labels":{"team":"b"},"resourceVersion":"42"}}`,
+		},
+		{
+			name: "owner references",
+			updated: metav1.ObjectMeta{
+				Labels:          existing.Labels,
+				Annotations:     existing.Annotations,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "new-uid"}},
+			},
+			expected: `{"metadata":{"ownerReferences":[{"apiVersion":"","kind":"PipelineRun","name":"test-pipeline-run","uid":"new-uid"}],"resourceVersion":"42"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := metadataPatch(&corev1.Secret{ObjectMeta: existing}, &corev1.Secret{ObjectMeta: tt.updated})
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expected, string(patch))
+		})
+	}
+}
+
+func TestRefreshSpokeSecretPatchesMetadata(t *testing.T) {
+	synced := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-secret",
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload"},
+		},
+		Data: map[string][]byte{defaultSecretDataKey: []byte("token")},
+	}
+	setChecksum(synced)
+
+	tests := []struct {
+		name             string
+		secret           func(*corev1.Secret)
+		expectedVerbs    []string
+		expectedReason   string
+		expectedLabels   map[string]string
+		expectedWorkload string
+	}{
+		{
+			name:             "unchanged",
+			expectedVerbs:    []string{"get"},
+			expectedLabels:   map[string]string{managedByLabel: managedByValue},
+			expectedWorkload: "test-namespace/test-workload",
+		},
+		{
+			name:             "label added on the hub",
+			secret:           func(secret *corev1.Secret) { secret.Labels["team"] = "a" },
+			expectedVerbs:    []string{"get", "patch"},
+			expectedReason:   "labels and annotations of hub secret synced to spoke cluster",
+			expectedLabels:   map[string]string{managedByLabel: managedByValue, "team": "a"},
+			expectedWorkload: "test-namespace/test-workload",
+		},
+		{
+			name: "synced for another Workload",
+			secret: func(secret *corev1.Secret) {
+				secret.Annotations[workloadAnnotation] = "test-namespace/other-workload"
+			},
+			expectedVerbs:    []string{"get"},
+			expectedLabels:   map[string]string{managedByLabel: managedByValue},
+			expectedWorkload: "test-namespace/test-workload",
+		},
+		{
+			name: "data changed",
+			secret: func(secret *corev1.Secret) {
+				secret.Data = map[string][]byte{defaultSecretDataKey: []byte("new-token")}
+				setChecksum(secret)
+			},
+			expectedVerbs:    []string{"get", "update"},
+			expectedReason:   "hub secret content changed, synced to spoke cluster",
+			expectedLabels:   map[string]string{managedByLabel: managedByValue},
+			expectedWorkload: "test-namespace/test-workload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			spokeKubeClient := fake.NewSimpleClientset(synced.DeepCopy())
+			r := &Reconciler{logger: zap.NewNop().Sugar()}
+			secret := synced.DeepCopy()
+			if tt.secret != nil {
+				tt.secret(secret)
+			}
+
+			_, reason, err := r.refreshSpokeSecret(ctx, testClusterName, spokeKubeClient, secret, false, false, false)
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedReason, reason)
+			var verbs []string
+			for _, action := range spokeKubeClient.Actions() {
+				verbs = append(verbs, action.GetVerb())
+				if patch, ok := action.(k8stesting.PatchAction); ok {
+					assert.Assert(t, !strings.Contains(string(patch.GetPatch()), `"data"`), "the data is not sent again")
+				}
+			}
+			assert.DeepEqual(t, tt.expectedVerbs, verbs)
+
+			spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expectedLabels, spokeSecret.Labels)
+			assert.Equal(t, tt.expectedWorkload, spokeSecret.Annotations[workloadAnnotation])
+		})
+	}
+}
+
+func TestWriteSpokeConfigMapPatchesMetadata(t *testing.T) {
+	ctx := context.Background()
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-config",
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload"},
+		},
+		Data: map[string]string{"key": "value"},
+	}
+	spokeKubeClient := fake.NewSimpleClientset(existing)
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+
+	// A later Workload of the namespace syncs the same content
+	configMap := existing.DeepCopy()
+	configMap.Annotations[workloadAnnotation] = "test-namespace/other-workload"
+	assert.NilError(t, r.writeSpokeConfigMap(ctx, testClusterName, spokeKubeClient, configMap))
+
+	var verbs []string
+	for _, action := range spokeKubeClient.Actions() {
+		verbs = append(verbs, action.GetVerb())
+	}
+	assert.DeepEqual(t, []string{"create", "get", "patch"}, verbs)
+	spokeConfigMap, err := spokeKubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "test-config", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "test-namespace/other-workload", spokeConfigMap.Annotations[workloadAnnotation])
+}
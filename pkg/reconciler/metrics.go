@@ -0,0 +1,291 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/metrics"
+
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+// Reconcile outcomes.
+const (
+	outcomeSuccess   = "success"
+	outcomeError     = "error"
+	outcomePermanent = "permanent_error"
+	outcomeRequeue   = "requeue"
+	outcomeSkip      = "skip"
+)
+
+// unknownSecretType tags the sync metrics of the decisions made without reading the secret.
+const unknownSecretType = "unknown"
+
+var (
+	clusterTagKey = tag.MustNewKey("cluster")
+	outcomeTagKey = tag.MustNewKey("outcome")
+	// namespaceTagKey is the hub namespace the secret is synced for, and secretTypeTagKey the
+	// type of the secret, so syncs can be attributed to the teams generating them.
+	namespaceTagKey  = tag.MustNewKey("namespace")
+	secretTypeTagKey = tag.MustNewKey("secret_type")
+	actionTagKey     = tag.MustNewKey("action")
+	reasonTagKey     = tag.MustNewKey("reason")
+	// versionTagKey, commitTagKey and goVersionTagKey describe the build of the controller.
+	versionTagKey   = tag.MustNewKey("version")
+	commitTagKey    = tag.MustNewKey("commit")
+	goVersionTagKey = tag.MustNewKey("go_version")
+
+	buildInfoM = stats.Int64(
+		"build_info",
+		"Always 1, the build of the running controller is in the tags",
+		stats.UnitDimensionless)
+
+	spokeClusterHealthyM = stats.Int64(
+		"spoke_cluster_healthy",
+		"Whether the circuit breaker of the spoke cluster is closed (1) or open (0)",
+		stats.UnitDimensionless)
+
+	spokeClusterReachableM = stats.Int64(
+		"spoke_cluster_reachable",
+		"Whether the last probe of the spoke cluster API server succeeded (1) or not (0)",
+		stats.UnitDimensionless)
+
+	spokeClusterConfigValidM = stats.Int64(
+		"spoke_cluster_config_valid",
+		"Whether the kubeconfig of the spoke cluster resolved on startup (1) or not (0)",
+		stats.UnitDimensionless)
+
+	hubAPIThrottledM = stats.Int64(
+		"hub_api_throttled",
+		"Whether the reconciles are paused because the hub API server throttled the controller (1) or not (0)",
+		stats.UnitDimensionless)
+
+	reconcileDurationM = stats.Float64(
+		"reconcile_duration_seconds",
+		"How long reconciling a Workload takes, by outcome",
+		stats.UnitSeconds)
+
+	secretSyncsM = stats.Int64(
+		"secret_syncs_total",
+		"Number of secret sync decisions, by hub namespace, secret type, action and outcome",
+		stats.UnitDimensionless)
+
+	secretSyncBytesM = stats.Int64(
+		"secret_sync_bytes_total",
+		"Size of the secret data written to the spoke clusters, by hub namespace and secret type",
+		stats.UnitBytes)
+
+	secretResyncsM = stats.Int64(
+		"secret_resync_total",
+		"Number of existing spoke secrets whose data was replaced, by reason",
+		stats.UnitDimensionless)
+
+	idempotentSkipsM = stats.Int64(
+		"secret_idempotent_skips_total",
+		"Number of spoke secret writes skipped as already done for the generation of their Workload",
+		stats.UnitDimensionless)
+
+	// Unlike the knative reconcile_latency view, requeues and skips aren't counted as failures,
+	// and the buckets resolve the sub-second reconciles of a healthy controller.
+	reconcileDurationBuckets = view.Distribution(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60)
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Description: spokeClusterHealthyM.Description(),
+			Measure:     spokeClusterHealthyM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{clusterTagKey},
+		},
+		&view.View{
+			Description: spokeClusterReachableM.Description(),
+			Measure:     spokeClusterReachableM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{clusterTagKey},
+		},
+		&view.View{
+			Description: spokeClusterConfigValidM.Description(),
+			Measure:     spokeClusterConfigValidM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{clusterTagKey},
+		},
+		&view.View{
+			Description: hubAPIThrottledM.Description(),
+			Measure:     hubAPIThrottledM,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Description: reconcileDurationM.Description(),
+			Measure:     reconcileDurationM,
+			Aggregation: reconcileDurationBuckets,
+			TagKeys:     []tag.Key{outcomeTagKey},
+		},
+		&view.View{
+			Description: secretSyncsM.Description(),
+			Measure:     secretSyncsM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{namespaceTagKey, secretTypeTagKey, actionTagKey, outcomeTagKey},
+		},
+		&view.View{
+			Description: secretSyncBytesM.Description(),
+			Measure:     secretSyncBytesM,
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{namespaceTagKey, secretTypeTagKey},
+		},
+		&view.View{
+			Description: secretResyncsM.Description(),
+			Measure:     secretResyncsM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{reasonTagKey},
+		},
+		&view.View{
+			Description: idempotentSkipsM.Description(),
+			Measure:     idempotentSkipsM,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Description: buildInfoM.Description(),
+			Measure:     buildInfoM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{versionTagKey, commitTagKey, goVersionTagKey},
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// recordBuildInfo sets the build info gauge, so dashboards can correlate behavior changes with
+// the deployed versions.
+func recordBuildInfo(ctx context.Context) {
+	ctx, err := tag.New(ctx,
+		tag.Upsert(versionTagKey, version.Version),
+		tag.Upsert(commitTagKey, version.Commit),
+		tag.Upsert(goVersionTagKey, version.GoVersion()))
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, buildInfoM.M(1))
+}
+
+// recordClusterHealth sets the health gauge of a spoke cluster.
+func recordClusterHealth(ctx context.Context, cluster string, healthy bool) {
+	ctx, err := tag.New(ctx, tag.Upsert(clusterTagKey, cluster))
+	if err != nil {
+		return
+	}
+
+	var value int64
+	if healthy {
+		value = 1
+	}
+	metrics.Record(ctx, spokeClusterHealthyM.M(value))
+}
+
+// recordClusterReachable sets the reachability gauge of a spoke cluster.
+func recordClusterReachable(ctx context.Context, cluster string, reachable bool) {
+	ctx, err := tag.New(ctx, tag.Upsert(clusterTagKey, cluster))
+	if err != nil {
+		return
+	}
+
+	var value int64
+	if reachable {
+		value = 1
+	}
+	metrics.Record(ctx, spokeClusterReachableM.M(value))
+}
+
+// recordClusterConfigValid sets the kubeconfig validity gauge of a spoke cluster.
+func recordClusterConfigValid(ctx context.Context, cluster string, valid bool) {
+	ctx, err := tag.New(ctx, tag.Upsert(clusterTagKey, cluster))
+	if err != nil {
+		return
+	}
+
+	var value int64
+	if valid {
+		value = 1
+	}
+	metrics.Record(ctx, spokeClusterConfigValidM.M(value))
+}
+
+// recordHubThrottled sets the throttling gauge of the hub API server.
+func recordHubThrottled(ctx context.Context, throttled bool) {
+	var value int64
+	if throttled {
+		value = 1
+	}
+	metrics.Record(ctx, hubAPIThrottledM.M(value))
+}
+
+// recordReconcile observes the duration of a reconcile under the outcome of its error.
+func recordReconcile(ctx context.Context, duration time.Duration, err error) {
+	ctx, tagErr := tag.New(ctx, tag.Upsert(outcomeTagKey, reconcileOutcome(err)))
+	if tagErr != nil {
+		return
+	}
+	metrics.Record(ctx, reconcileDurationM.M(duration.Seconds()))
+}
+
+// recordSecretSync counts the sync decision under the hub namespace of its Workload, or of the
+// secret when it has none, and its secret type, unknown for the decisions made without reading
+// the secret. The size of the secrets written to the spoke clusters is added up too.
+func recordSecretSync(ctx context.Context, event auditEvent) {
+	namespace, _, _ := strings.Cut(event.Workload, "/")
+	if namespace == "" {
+		namespace, _, _ = strings.Cut(event.Secret, "/")
+	}
+	secretType := string(event.SecretType)
+	if secretType == "" {
+		secretType = unknownSecretType
+	}
+	ctx, err := tag.New(ctx,
+		tag.Upsert(namespaceTagKey, namespace),
+		tag.Upsert(secretTypeTagKey, secretType),
+		tag.Upsert(actionTagKey, event.Action),
+		tag.Upsert(outcomeTagKey, event.Outcome))
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, secretSyncsM.M(1))
+	if event.Action == auditActionSync && event.Outcome == auditOutcomeSuccess {
+		metrics.Record(ctx, secretSyncBytesM.M(event.Size))
+	}
+}
+
+// recordSecretResync counts the refresh of an existing spoke secret under its reason.
+func recordSecretResync(ctx context.Context, reason string) {
+	ctx, err := tag.New(ctx, tag.Upsert(reasonTagKey, reason))
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, secretResyncsM.M(1))
+}
+
+// recordIdempotentSkip counts a spoke secret not written again for the same generation of its
+// Workload.
+func recordIdempotentSkip(ctx context.Context) {
+	metrics.Record(ctx, idempotentSkipsM.M(1))
+}
+
+func reconcileOutcome(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	if controller.IsSkipKey(err) {
+		return outcomeSkip
+	}
+	if ok, _ := controller.IsRequeueKey(err); ok {
+		return outcomeRequeue
+	}
+	if controller.IsPermanentError(err) {
+		return outcomePermanent
+	}
+	return outcomeError
+}
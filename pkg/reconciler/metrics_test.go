@@ -0,0 +1,107 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/metrics"
+
+	"github.com/zakisk/secret-service/pkg/version"
+)
+
+func TestReconcileOutcome(t *testing.T) {
+	tests := []struct {
+		err             error
+		expectedOutcome string
+	}{
+		{err: nil, expectedOutcome: outcomeSuccess},
+		{err: errors.New("boom"), expectedOutcome: outcomeError},
+		{err: controller.NewPermanentError(errors.New("boom")), expectedOutcome: outcomePermanent},
+		{err: controller.NewRequeueAfter(time.Second), expectedOutcome: outcomeRequeue},
+		{err: controller.NewSkipKey("ns/name"), expectedOutcome: outcomeSkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expectedOutcome, func(t *testing.T) {
+			assert.Equal(t, tt.expectedOutcome, reconcileOutcome(tt.err))
+		})
+	}
+}
+
+// viewRows returns the rows of the view tagged with the namespace, by their tags.
+func viewRows(t *testing.T, name, namespace string) map[string]view.AggregationData {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	assert.NilError(t, err)
+	data := map[string]view.AggregationData{}
+	for _, row := range rows {
+		tags := map[string]string{}
+		for _, rowTag := range row.Tags {
+			tags[rowTag.Key.Name()] = rowTag.Value
+		}
+		if tags[namespaceTagKey.Name()] != namespace {
+			continue
+		}
+		data[tags[secretTypeTagKey.Name()]+"/"+tags[actionTagKey.Name()]+"/"+tags[outcomeTagKey.Name()]] = row.Data
+	}
+	return data
+}
+
+func TestRecordSecretSync(t *testing.T) {
+	metrics.InitForTesting()
+	ctx := context.Background()
+	for _, event := range []auditEvent{
+		{Action: auditActionSync, Outcome: auditOutcomeSuccess, Workload: "team-a/workload", Secret: "team-a/git-auth", SecretType: corev1.SecretTypeBasicAuth, Size: 10},
+		{Action: auditActionSync, Outcome: auditOutcomeSuccess, Workload: "team-a/workload", Secret: "team-a/token", SecretType: corev1.SecretTypeBasicAuth, Size: 5},
+		{Action: auditActionSync, Outcome: auditOutcomeUnchanged, Workload: "team-a/workload", Secret: "team-a/git-auth", SecretType: corev1.SecretTypeBasicAuth, Size: 10},
+		{Action: auditActionSync, Outcome: auditOutcomeFailure, Workload: "team-a/workload", Secret: "team-a/missing"},
+		{Action: auditActionDelete, Outcome: auditOutcomeSuccess, Workload: "team-a/workload", Secret: "team-a/git-auth"},
+		{Action: auditActionSync, Outcome: auditOutcomeSuccess, Secret: "team-a/signing-secrets", SecretType: corev1.SecretTypeOpaque, Size: 7},
+	} {
+		recordSecretSync(ctx, event)
+	}
+
+	syncs := viewRows(t, secretSyncsM.Name(), "team-a")
+	counts := map[string]int64{}
+	for key, data := range syncs {
+		counts[key] = data.(*view.CountData).Value
+	}
+	assert.DeepEqual(t, map[string]int64{
+		"kubernetes.io/basic-auth/sync/success":   2,
+		"kubernetes.io/basic-auth/sync/unchanged": 1,
+		"unknown/sync/failure":                    1,
+		"unknown/delete/success":                  1,
+		"Opaque/sync/success":                     1,
+	}, counts)
+
+	bytes := viewRows(t, secretSyncBytesM.Name(), "team-a")
+	sums := map[string]float64{}
+	for key, data := range bytes {
+		sums[key] = data.(*view.SumData).Value
+	}
+	assert.DeepEqual(t, map[string]float64{
+		"kubernetes.io/basic-auth//": 15,
+		"Opaque//":                   7,
+	}, sums)
+}
+
+func TestRecordBuildInfo(t *testing.T) {
+	metrics.InitForTesting()
+	recordBuildInfo(context.Background())
+
+	rows, err := view.RetrieveData(buildInfoM.Name())
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(rows))
+	tags := map[string]string{}
+	for _, rowTag := range rows[0].Tags {
+		tags[rowTag.Key.Name()] = rowTag.Value
+	}
+	assert.DeepEqual(t, map[string]string{"version": version.Version, "commit": version.Commit, "go_version": version.GoVersion()}, tags)
+	assert.Equal(t, float64(1), rows[0].Data.(*view.LastValueData).Value)
+}
@@ -0,0 +1,127 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/injection"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+// parseWatchNamespaces parses the comma separated hub namespaces the controller is restricted
+// to, empty when it watches all of them.
+func parseWatchNamespaces(value string) ([]string, error) {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces, nil
+}
+
+// WithNamespaceScope scopes the injected informers to the first of the WATCH_NAMESPACES, the
+// controller watching the Workloads of the other ones itself. The context is returned unchanged
+// when the controller watches all namespaces, or when WATCH_NAMESPACES is invalid, which the
+// controller then fails on.
+func WithNamespaceScope(ctx context.Context) context.Context {
+	namespaces, err := parseWatchNamespaces(os.Getenv("WATCH_NAMESPACES"))
+	if err != nil || len(namespaces) == 0 {
+		return ctx
+	}
+	return injection.WithNamespaceScope(ctx, namespaces[0])
+}
+
+// namespacedWorkloadInformers watches the Workloads of the WATCH_NAMESPACES after the first,
+// whose Workloads are watched by the injected informer.
+type namespacedWorkloadInformers struct {
+	informers map[string]cache.SharedIndexInformer
+	listers   map[string]kueuev1beta1lister.WorkloadLister
+}
+
+// newNamespacedWorkloadInformers creates the Workload informers of the namespaces, configured like
+// the injected one.
+func newNamespacedWorkloadInformers(ctx context.Context, client kueueversioned.Interface, opts *options, namespaces []string) *namespacedWorkloadInformers {
+	n := &namespacedWorkloadInformers{
+		informers: make(map[string]cache.SharedIndexInformer, len(namespaces)),
+		listers:   make(map[string]kueuev1beta1lister.WorkloadLister, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		informer := newWorkloadInformerFactory(ctx, client, opts, namespace).Kueue().V1beta1().Workloads()
+		n.informers[namespace] = informer.Informer()
+		n.listers[namespace] = informer.Lister()
+	}
+	return n
+}
+
+// addEventHandler registers the handler on the informer of every namespace.
+func (n *namespacedWorkloadInformers) addEventHandler(handler cache.ResourceEventHandler) error {
+	for namespace, informer := range n.informers {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("could not register the Workload event handler of namespace %s: %w", namespace, err)
+		}
+	}
+	return nil
+}
+
+// run starts the informers and waits for their caches to sync.
+func (n *namespacedWorkloadInformers) run(ctx context.Context) {
+	synced := make([]cache.InformerSynced, 0, len(n.informers))
+	for _, informer := range n.informers {
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+	cache.WaitForCacheSync(ctx.Done(), synced...)
+}
+
+// hasSynced reports whether the caches of every namespace are synced.
+func (n *namespacedWorkloadInformers) hasSynced() bool {
+	for _, informer := range n.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// multiNamespaceWorkloadLister lists the Workloads of a set of namespaces, each cached by its
+// own informer. The Workloads of other namespaces are never found.
+type multiNamespaceWorkloadLister struct {
+	listers map[string]kueuev1beta1lister.WorkloadLister
+}
+
+// emptyWorkloadLister backs the namespaces outside of the multiNamespaceWorkloadLister.
+var emptyWorkloadLister = kueuev1beta1lister.NewWorkloadLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+
+func (l multiNamespaceWorkloadLister) List(selector labels.Selector) ([]*kueuev1beta1.Workload, error) {
+	var workloads []*kueuev1beta1.Workload
+	for _, lister := range l.listers {
+		listed, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, listed...)
+	}
+	return workloads, nil
+}
+
+func (l multiNamespaceWorkloadLister) Workloads(namespace string) kueuev1beta1lister.WorkloadNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.Workloads(namespace)
+	}
+	return emptyWorkloadLister.Workloads(namespace)
+}
@@ -0,0 +1,75 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/injection"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestParseWatchNamespaces(t *testing.T) {
+	for value, expected := range map[string][]string{
+		"":                     nil,
+		"ci":                   {"ci"},
+		" ci, team-a ,,ci,":    {"ci", "team-a"},
+		"team-a,team-b,team-c": {"team-a", "team-b", "team-c"},
+	} {
+		namespaces, err := parseWatchNamespaces(value)
+		assert.NilError(t, err, value)
+		assert.DeepEqual(t, expected, namespaces)
+	}
+
+	_, err := parseWatchNamespaces("ci,Team_A")
+	assert.ErrorContains(t, err, `invalid namespace "Team_A"`)
+}
+
+func TestWithNamespaceScope(t *testing.T) {
+	t.Setenv("WATCH_NAMESPACES", "")
+	assert.Assert(t, !injection.HasNamespaceScope(WithNamespaceScope(context.Background())))
+
+	t.Setenv("WATCH_NAMESPACES", "team-a,team-b")
+	ctx := WithNamespaceScope(context.Background())
+	assert.Assert(t, injection.HasNamespaceScope(ctx))
+	assert.Equal(t, "team-a", injection.GetNamespaceScope(ctx))
+
+	t.Setenv("WATCH_NAMESPACES", "Team_A")
+	assert.Assert(t, !injection.HasNamespaceScope(WithNamespaceScope(context.Background())))
+}
+
+func TestMultiNamespaceWorkloadLister(t *testing.T) {
+	lister := func(namespace string, names ...string) kueuev1beta1lister.WorkloadLister {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for _, name := range names {
+			assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}))
+		}
+		return kueuev1beta1lister.NewWorkloadLister(indexer)
+	}
+	l := multiNamespaceWorkloadLister{listers: map[string]kueuev1beta1lister.WorkloadLister{
+		"team-a": lister("team-a", "build", "test"),
+		"team-b": lister("team-b", "deploy"),
+	}}
+
+	workloads, err := l.List(labels.Everything())
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(workloads))
+
+	workload, err := l.Workloads("team-b").Get("deploy")
+	assert.NilError(t, err)
+	assert.Equal(t, "deploy", workload.Name)
+
+	_, err = l.Workloads("team-b").Get("build")
+	assert.Assert(t, errors.IsNotFound(err))
+
+	workloads, err = l.Workloads("other").List(labels.Everything())
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(workloads))
+	_, err = l.Workloads("other").Get("build")
+	assert.Assert(t, errors.IsNotFound(err))
+}
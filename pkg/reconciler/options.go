@@ -0,0 +1,671 @@
+package reconciler
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// options holds the tunables of the controller, read from the environment variables
+// set in config/deployment.yaml.
+type options struct {
+	// name is the name of the Workload controller, of its workqueue and the source of its events,
+	// set by the embedders with ControllerOptions
+	name string
+	// KUEUE_NAMESPACE: namespace holding the MultiKueue kubeconfig secrets
+	kueueNamespace string
+	// SPOKE_KUBECONFIG_CONTEXT: how the context of the kubeconfigs holding several clusters is selected
+	kubeconfigContext syncer.KubeconfigContextStrategy
+	// DRY_RUN: the writes to the spoke clusters are server-side dry-run requests
+	dryRun bool
+	// WATCH_NAMESPACES: hub namespaces the controller is restricted to, empty watches all of them
+	watchNamespaces []string
+	// WORKLOAD_LABEL_SELECTOR and WORKLOAD_FIELD_SELECTOR: narrow the Workloads watched by the informer
+	workloadLabelSelector string
+	workloadFieldSelector string
+	// WORKLOAD_LOCAL_QUEUES / WORKLOAD_CLUSTER_QUEUES: only the Workloads of these queues are
+	// reconciled. OWNER_TRAVERSAL_DEPTH / OWNER_TRAVERSAL_KINDS: the intermediate owners followed
+	// from the Workloads to their PipelineRun
+	queues workloadQueueFilter
+	// SECRET_RETAIN_POLICY: what to do with synced secrets when the Workload is deleted
+	retainPolicy RetainPolicy
+	// HUB_SECRET_FINALIZER: protect hub secrets with a finalizer while the spoke run is active
+	hubSecretFinalizer bool
+	// HUB_SECRET_WATCH: watch the hub secrets and sync their updates to the spoke clusters
+	hubSecretWatch bool
+	// HUB_SECRET_REVOCATION: delete the spoke copies of the hub secrets revoked or deleted, with
+	// HUB_SECRET_WATCH
+	hubSecretRevocation bool
+	// HUB_SECRET_CACHE and HUB_SECRET_CACHE_LABEL_SELECTOR: read the git-auth secrets matching the
+	// selector from an informer rather than from the hub API server
+	hubSecretCache         bool
+	hubSecretCacheSelector string
+	// SECRET_SOURCE: where the git credentials are read from, kubernetes (hub Secrets), vault,
+	// aws-secrets-manager, gcp-secret-manager or github-app
+	secretSource string
+	// VAULT_*: the Vault secret source
+	vault vaultOptions
+	// AWS_*: the AWS Secrets Manager secret source
+	aws awsOptions
+	// GCP_*: the GCP Secret Manager secret source
+	gcp gcpOptions
+	// GITHUB_APP_*: the GitHub App secret source
+	githubApp githubAppOptions
+	// PAC_REPOSITORY_SECRETS: also sync the git_provider.secret of the PipelineRun's Repository CR
+	repositorySecrets bool
+	// PIPELINERUN_SECRET_SOURCES: where the other secrets referenced by the PipelineRuns are found,
+	// annotation, workspaces and service-account, or none
+	pipelineRunSecretSources map[string]bool
+	// PIPELINERUN_CONFIGMAP_SOURCES: where the hub ConfigMaps referenced by the PipelineRuns are
+	// found, annotation and workspaces, or none
+	pipelineRunConfigMapSources map[string]bool
+	// SSH_KNOWN_HOSTS_SOURCE and SSH_KNOWN_HOSTS_KEY: the known_hosts synced with the SSH git-auth
+	// secrets
+	knownHosts knownHostsOptions
+	// RESOLVER_SECRETS and RESOLVERS_NAMESPACE: the resolvers whose credentials are synced
+	resolverSecrets resolverSecretsOptions
+	// SECRET_SYNC_CONCURRENCY: how many secrets of a Workload are synced at once
+	secretSyncConcurrency int
+	// SPOKE_SECRET_MODE: how the credentials are materialized on the spoke clusters, copy,
+	// external-secrets, sealed-secrets or pull
+	spokeSecretMode string
+	// EXTERNAL_SECRET*: the external-secrets spoke secret mode
+	externalSecrets externalSecretsOptions
+	// SEALED_SECRETS_*: the sealed-secrets spoke secret mode
+	sealedSecrets sealedSecretsOptions
+	// PULL_API_*: the API the spoke agents pull secrets from
+	pullAPI pullAPIOptions
+	// ADMISSION_WEBHOOK_*: the webhook validating the sync annotations of hub PipelineRuns
+	admissionWebhook admissionWebhookOptions
+	// WORKLOAD_SYNC_STATUS: where the sync state is written back on the Workloads, condition,
+	// annotation or none
+	workloadStatus string
+	// SYNC_STATUS_STORE: where the structured sync status of the Workloads is recorded, crd,
+	// annotation, memory or none
+	statusStore string
+	// TOKEN_RESYNC_MARGIN: how long before their expiry tokens are synced again, 0 disables it
+	tokenResyncMargin time.Duration
+	// CLOCK_SKEW_TOLERANCE: how far the clocks of the hub, the spoke clusters and the token
+	// issuers may drift apart
+	clockSkew time.Duration
+	// ROTATION_THRESHOLD: how long a PipelineRun runs before its synced credentials are rotated,
+	// 0 disables rotation
+	rotationThreshold time.Duration
+	// ROTATION_INTERVAL: how often the credentials of long running PipelineRuns are rotated
+	rotationInterval time.Duration
+	// CHAINS_*: the sync of the Tekton Chains signing keys to the spoke clusters
+	chains chainsOptions
+	// SPOKE_SECRET_CONFLICT_POLICY: what happens when a spoke secret not created by the controller
+	// has the name of a synced secret, fail, adopt or suffix
+	conflictPolicy string
+	// SPOKE_SECRET_OVERSIZE_POLICY: what happens to a secret over the size limit of the Secrets,
+	// reject or split
+	oversizePolicy string
+	// SPOKE_SECRET_TYPE: the type of the spoke git-auth secrets, empty keeps the one of the hub
+	// secrets
+	secretType corev1.SecretType
+	// SPOKE_SECRET_KEY_MAPPING: hub=spoke pairs renaming the keys of the spoke git-auth secrets
+	secretKeyMapping map[string]string
+	// SPOKE_CLUSTER_CONFIG: read the settings of each spoke cluster from its SpokeClusterConfig
+	spokeClusterConfig bool
+	// SECRET_SYNC_POLICY: read the settings of the hub namespaces from their SecretSyncPolicy and
+	// the ClusterSecretSyncPolicy
+	secretSyncPolicy bool
+	// NAMESPACE_SECRET_QUOTA_*: the secrets the Workloads of a hub namespace may have synced at once
+	secretQuota secretQuotaOptions
+	// ORPHAN_SWEEP_INTERVAL: how often spoke clusters are swept for orphaned secrets, 0 disables it
+	orphanSweepInterval time.Duration
+	// UNTRACKED_WORKLOAD_SWEEP_INTERVAL: how often the Workloads missing the tracking labels are
+	// labeled when WORKLOAD_LABEL_SELECTOR requires them, 0 disables it
+	untrackedWorkloadSweepInterval time.Duration
+	// COMPLETION_CHECK_INTERVAL: how often the spoke completion watcher checks the spoke
+	// PipelineRuns, 0 disables it
+	completionCheckInterval time.Duration
+	// PIPELINERUN_DONE_CHECK and PIPELINERUN_DONE_GRACE_PERIOD: whether and how long after their
+	// completion the done spoke PipelineRuns stop being synced
+	done donePolicy
+
+	// WORKER_THREADS: number of workers processing the workqueue
+	workerThreads int
+	// RATE_LIMIT_BASE_DELAY and RATE_LIMIT_MAX_DELAY: per-item exponential backoff on failures
+	rateLimitBaseDelay time.Duration
+	rateLimitMaxDelay  time.Duration
+	// RATE_LIMIT_QPS and RATE_LIMIT_BURST: overall rate of items released by the workqueue
+	rateLimitQPS   float64
+	rateLimitBurst int
+	// CLEANUP_PRIORITY: the cleanups of the deleted and finished Workloads are reconciled before
+	// the syncs waiting in the workqueue, and their retries aren't held by RATE_LIMIT_QPS
+	cleanupPriority bool
+	// WORKLOAD_EVENT_COALESCE_WINDOW: the updates of a Workload within the window of its last
+	// enqueued one are folded into a single reconcile, 0 enqueues every update
+	workloadEventCoalesceWindow time.Duration
+	// KUEUE_INFORMER_RESYNC_PERIOD and KUEUE_INFORMER_RESYNC_JITTER: how often every cached Workload
+	// is reconciled again, 0 keeps the resync period of the controller framework, jittered up to the
+	// jitter times the period
+	workloadResyncPeriod time.Duration
+	workloadResyncJitter float64
+
+	// HUB_CLIENT_QPS and HUB_CLIENT_BURST: client side rate limit of the hub clients
+	hubClientQPS   float32
+	hubClientBurst int
+	// HUB_THROTTLE_MAX_DELAY: longest pause of the reconciles while the hub API server throttles
+	// the controller, 0 disables the pauses
+	hubThrottleMaxDelay time.Duration
+	// SPOKE_CLIENT_QPS and SPOKE_CLIENT_BURST: client side rate limit of each spoke cluster's clients
+	spokeClientQPS   float32
+	spokeClientBurst int
+
+	// SPOKE_REQUEST_TIMEOUT: deadline of every single call to a spoke API server, 0 disables it
+	spokeRequestTimeout time.Duration
+
+	// FAILURE_ESCALATION_THRESHOLD: consecutive failures after which a Workload stops being retried, 0 disables it
+	failureEscalationThreshold int
+
+	// PROBE_PORT: port serving the health probes
+	probePort int
+	// SELF_TEST_NAMESPACE: spoke namespace the startup self-test dry-runs a secret create in,
+	// empty disables the self-test
+	selfTestNamespace string
+	// CONFIG_FEATURE_FLAGS_NAME: ConfigMap of the system namespace toggling the feature gates
+	featureFlagsConfigMap string
+	// FEATURE_GATES: the feature gates the ConfigMap doesn't set
+	featureGates map[string]bool
+
+	// AUDIT_LOG_ENABLED: write every sync decision to the audit log stream
+	auditLogEnabled bool
+	// CLOUDEVENTS_SINK: URL the sync lifecycle CloudEvents are sent to, empty disables them
+	cloudEventsSink string
+	// TEKTON_RESULTS_API: URL of the Tekton Results API the sync decisions are written to as
+	// Records, empty disables it
+	resultsAPI string
+	// TEKTON_RESULTS_TLS_CA_FILE: CA bundle trusted for the Tekton Results API on top of the system roots
+	resultsCAFile string
+
+	// SPOKE_MAX_CONCURRENCY: concurrent reconciles allowed per spoke cluster, 0 means unlimited
+	spokeMaxConcurrency int
+	// SPOKE_CIRCUIT_FAILURE_THRESHOLD: consecutive spoke failures opening its circuit, 0 disables the breaker
+	spokeCircuitFailureThreshold int
+	// SPOKE_CIRCUIT_OPEN_DURATION: how long an open circuit rejects reconciles before a trial
+	spokeCircuitOpenDuration time.Duration
+	// SPOKE_PROBE_INTERVAL and SPOKE_PROBE_MAX_INTERVAL: how often the spoke clusters are probed,
+	// backing off up to the max interval while unreachable, 0 disables the probes
+	spokeProbeInterval    time.Duration
+	spokeProbeMaxInterval time.Duration
+}
+
+// optionsFromEnv reads the options from the environment, falling back to the defaults
+// for unset variables.
+func optionsFromEnv() (*options, error) {
+	o := &options{name: controllerName}
+	var err error
+
+	o.kueueNamespace = os.Getenv("KUEUE_NAMESPACE")
+	if o.kueueNamespace == "" {
+		o.kueueNamespace = "kueue-system" // Default to standard Kueue namespace
+	}
+	if o.kubeconfigContext, err = syncer.ParseKubeconfigContextStrategy(os.Getenv("SPOKE_KUBECONFIG_CONTEXT")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_KUBECONFIG_CONTEXT: %w", err)
+	}
+	if o.dryRun, err = envOrDefault("DRY_RUN", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+
+	if o.watchNamespaces, err = parseWatchNamespaces(os.Getenv("WATCH_NAMESPACES")); err != nil {
+		return nil, fmt.Errorf("invalid WATCH_NAMESPACES: %w", err)
+	}
+
+	o.workloadLabelSelector = os.Getenv("WORKLOAD_LABEL_SELECTOR")
+	if _, err := labels.Parse(o.workloadLabelSelector); err != nil {
+		return nil, fmt.Errorf("invalid WORKLOAD_LABEL_SELECTOR: %w", err)
+	}
+	o.workloadFieldSelector = os.Getenv("WORKLOAD_FIELD_SELECTOR")
+	if _, err := fields.ParseSelector(o.workloadFieldSelector); err != nil {
+		return nil, fmt.Errorf("invalid WORKLOAD_FIELD_SELECTOR: %w", err)
+	}
+	if o.queues.localQueues, err = parseQueueNames(os.Getenv("WORKLOAD_LOCAL_QUEUES"), true); err != nil {
+		return nil, fmt.Errorf("invalid WORKLOAD_LOCAL_QUEUES: %w", err)
+	}
+	if o.queues.clusterQueues, err = parseQueueNames(os.Getenv("WORKLOAD_CLUSTER_QUEUES"), false); err != nil {
+		return nil, fmt.Errorf("invalid WORKLOAD_CLUSTER_QUEUES: %w", err)
+	}
+	if o.queues.owners.depth, err = envOrDefault("OWNER_TRAVERSAL_DEPTH", 0, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.queues.owners.depth < 0 || o.queues.owners.depth > maxOwnerTraversalDepth {
+		return nil, fmt.Errorf("invalid OWNER_TRAVERSAL_DEPTH: must be between 0 and %d, got %d", maxOwnerTraversalDepth, o.queues.owners.depth)
+	}
+	if o.queues.owners.kinds, err = parseOwnerKinds(os.Getenv("OWNER_TRAVERSAL_KINDS")); err != nil {
+		return nil, fmt.Errorf("invalid OWNER_TRAVERSAL_KINDS: %w", err)
+	}
+	if o.queues.owners.depth > 0 && len(o.queues.owners.kinds) == 0 {
+		return nil, fmt.Errorf("invalid OWNER_TRAVERSAL_KINDS: the kinds of the intermediate owners are required with OWNER_TRAVERSAL_DEPTH")
+	}
+
+	if o.retainPolicy, err = parseRetainPolicy(os.Getenv("SECRET_RETAIN_POLICY")); err != nil {
+		return nil, fmt.Errorf("invalid SECRET_RETAIN_POLICY: %w", err)
+	}
+	if o.statusStore, err = parseStatusStore(os.Getenv("SYNC_STATUS_STORE")); err != nil {
+		return nil, fmt.Errorf("invalid SYNC_STATUS_STORE: %w", err)
+	}
+	if o.workloadStatus, err = parseWorkloadStatusMode(os.Getenv("WORKLOAD_SYNC_STATUS")); err != nil {
+		return nil, fmt.Errorf("invalid WORKLOAD_SYNC_STATUS: %w", err)
+	}
+	if o.hubSecretFinalizer, err = envOrDefault("HUB_SECRET_FINALIZER", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.hubSecretWatch, err = envOrDefault("HUB_SECRET_WATCH", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.hubSecretRevocation, err = envOrDefault("HUB_SECRET_REVOCATION", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.hubSecretCache, err = envOrDefault("HUB_SECRET_CACHE", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	o.hubSecretCacheSelector = stringOrDefault("HUB_SECRET_CACHE_LABEL_SELECTOR", defaultHubSecretCacheSelector)
+	if _, err := labels.Parse(o.hubSecretCacheSelector); err != nil {
+		return nil, fmt.Errorf("invalid HUB_SECRET_CACHE_LABEL_SELECTOR: %w", err)
+	}
+	if o.secretSource, err = parseSecretSource(os.Getenv("SECRET_SOURCE")); err != nil {
+		return nil, fmt.Errorf("invalid SECRET_SOURCE: %w", err)
+	}
+	o.vault = vaultOptions{
+		address:      os.Getenv("VAULT_ADDR"),
+		token:        os.Getenv("VAULT_TOKEN"),
+		role:         os.Getenv("VAULT_ROLE"),
+		authMount:    stringOrDefault("VAULT_AUTH_MOUNT", defaultVaultAuthMount),
+		kvMount:      stringOrDefault("VAULT_KV_MOUNT", defaultVaultKVMount),
+		pathTemplate: stringOrDefault("VAULT_PATH_TEMPLATE", defaultVaultPathTemplate),
+	}
+	o.aws = awsOptions{
+		region:               stringOrDefault("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION")),
+		roleARN:              os.Getenv("AWS_ROLE_ARN"),
+		webIdentityTokenFile: os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		secretIDTemplate:     stringOrDefault("AWS_SECRET_ID_TEMPLATE", defaultAWSSecretIDTemplate),
+	}
+	o.gcp = gcpOptions{
+		project:          os.Getenv("GCP_PROJECT"),
+		secretIDTemplate: stringOrDefault("GCP_SECRET_ID_TEMPLATE", defaultGCPSecretIDTemplate),
+	}
+	o.githubApp = githubAppOptions{
+		secret: stringOrDefault("GITHUB_APP_SECRET", defaultGitHubAppSecret),
+		apiURL: stringOrDefault("GITHUB_API_URL", defaultGitHubAPIURL),
+	}
+	if o.githubApp.permissions, err = parseGitHubAppPermissions(stringOrDefault("GITHUB_APP_TOKEN_PERMISSIONS", defaultGitHubAppPermissions)); err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_TOKEN_PERMISSIONS: %w", err)
+	}
+	if o.repositorySecrets, err = envOrDefault("PAC_REPOSITORY_SECRETS", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.pipelineRunSecretSources, err = parsePipelineRunSecretSources(stringOrDefault("PIPELINERUN_SECRET_SOURCES", defaultPipelineRunSecretSources)); err != nil {
+		return nil, fmt.Errorf("invalid PIPELINERUN_SECRET_SOURCES: %w", err)
+	}
+	if o.pipelineRunConfigMapSources, err = parsePipelineRunConfigMapSources(stringOrDefault("PIPELINERUN_CONFIGMAP_SOURCES", defaultPipelineRunConfigMapSources)); err != nil {
+		return nil, fmt.Errorf("invalid PIPELINERUN_CONFIGMAP_SOURCES: %w", err)
+	}
+	if o.knownHosts, err = parseKnownHostsSource(os.Getenv("SSH_KNOWN_HOSTS_SOURCE")); err != nil {
+		return nil, fmt.Errorf("invalid SSH_KNOWN_HOSTS_SOURCE: %w", err)
+	}
+	o.knownHosts.key = stringOrDefault("SSH_KNOWN_HOSTS_KEY", defaultKnownHostsKey)
+	if o.resolverSecrets.resolvers, err = parseResolverSecrets(stringOrDefault("RESOLVER_SECRETS", defaultResolverSecrets)); err != nil {
+		return nil, fmt.Errorf("invalid RESOLVER_SECRETS: %w", err)
+	}
+	o.resolverSecrets.namespace = stringOrDefault("RESOLVERS_NAMESPACE", defaultResolversNamespace)
+	if o.secretSyncConcurrency, err = envOrDefault("SECRET_SYNC_CONCURRENCY", defaultSecretSyncConcurrency, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.spokeSecretMode, err = parseSpokeSecretMode(os.Getenv("SPOKE_SECRET_MODE")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_MODE: %w", err)
+	}
+	o.externalSecrets = externalSecretsOptions{
+		apiVersion:      stringOrDefault("EXTERNAL_SECRETS_API_VERSION", defaultExternalSecretsAPIVersion),
+		storeName:       os.Getenv("EXTERNAL_SECRET_STORE"),
+		storeKind:       stringOrDefault("EXTERNAL_SECRET_STORE_KIND", defaultExternalSecretStoreKind),
+		keyTemplate:     stringOrDefault("EXTERNAL_SECRET_KEY_TEMPLATE", defaultExternalSecretKeyTemplate),
+		refreshInterval: stringOrDefault("EXTERNAL_SECRET_REFRESH_INTERVAL", defaultExternalSecretRefreshPeriod),
+	}
+	o.sealedSecrets = sealedSecretsOptions{
+		controllerNamespace: stringOrDefault("SEALED_SECRETS_CONTROLLER_NAMESPACE", defaultSealedSecretsControllerNamespace),
+		controllerName:      stringOrDefault("SEALED_SECRETS_CONTROLLER_NAME", defaultSealedSecretsControllerName),
+	}
+	o.pullAPI = pullAPIOptions{
+		certFile:       os.Getenv("PULL_API_TLS_CERT_FILE"),
+		keyFile:        os.Getenv("PULL_API_TLS_KEY_FILE"),
+		agentNamespace: stringOrDefault("PULL_API_AGENT_NAMESPACE", os.Getenv("SYSTEM_NAMESPACE")),
+	}
+	if o.pullAPI.port, err = envOrDefault("PULL_API_PORT", 0, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	o.admissionWebhook = admissionWebhookOptions{
+		certFile: os.Getenv("ADMISSION_WEBHOOK_TLS_CERT_FILE"),
+		keyFile:  os.Getenv("ADMISSION_WEBHOOK_TLS_KEY_FILE"),
+	}
+	if o.admissionWebhook.port, err = envOrDefault("ADMISSION_WEBHOOK_PORT", 0, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.admissionWebhook.action, err = parseAdmissionAction(os.Getenv("ADMISSION_WEBHOOK_ACTION")); err != nil {
+		return nil, fmt.Errorf("invalid ADMISSION_WEBHOOK_ACTION: %w", err)
+	}
+	if selector := os.Getenv("ADMISSION_WEBHOOK_SECRET_SELECTOR"); selector != "" {
+		if o.admissionWebhook.secretSelector, err = labels.Parse(selector); err != nil {
+			return nil, fmt.Errorf("invalid ADMISSION_WEBHOOK_SECRET_SELECTOR: %w", err)
+		}
+	}
+	if o.tokenResyncMargin, err = envOrDefault("TOKEN_RESYNC_MARGIN", defaultTokenResyncMargin, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.clockSkew, err = envOrDefault("CLOCK_SKEW_TOLERANCE", defaultClockSkewTolerance, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.rotationThreshold, err = envOrDefault("ROTATION_THRESHOLD", time.Duration(0), time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.rotationInterval, err = envOrDefault("ROTATION_INTERVAL", defaultRotationInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	o.chains.namespace = stringOrDefault("CHAINS_NAMESPACE", defaultChainsNamespace)
+	if o.chains.enabled, err = envOrDefault("CHAINS_SIGNING_SECRETS_SYNC", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.chains.interval, err = envOrDefault("CHAINS_SIGNING_SECRETS_SYNC_INTERVAL", defaultChainsSigningSyncPeriod, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.conflictPolicy, err = parseConflictPolicy(os.Getenv("SPOKE_SECRET_CONFLICT_POLICY")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_CONFLICT_POLICY: %w", err)
+	}
+	if o.oversizePolicy, err = parseOversizePolicy(os.Getenv("SPOKE_SECRET_OVERSIZE_POLICY")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_OVERSIZE_POLICY: %w", err)
+	}
+	if o.secretType, err = parseSpokeSecretType(os.Getenv("SPOKE_SECRET_TYPE")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_TYPE: %w", err)
+	}
+	if o.secretKeyMapping, err = parseSecretKeyMapping(os.Getenv("SPOKE_SECRET_KEY_MAPPING")); err != nil {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_KEY_MAPPING: %w", err)
+	}
+	if o.spokeClusterConfig, err = envOrDefault("SPOKE_CLUSTER_CONFIG", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.secretSyncPolicy, err = envOrDefault("SECRET_SYNC_POLICY", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.secretQuota.maxCount, err = envOrDefault("NAMESPACE_SECRET_QUOTA_COUNT", 0, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.secretQuota.maxBytes, err = envOrDefault("NAMESPACE_SECRET_QUOTA_SIZE", int64(0), parseQuantityBytes); err != nil {
+		return nil, err
+	}
+	if o.orphanSweepInterval, err = envOrDefault("ORPHAN_SWEEP_INTERVAL", defaultOrphanSweepInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.untrackedWorkloadSweepInterval, err = envOrDefault("UNTRACKED_WORKLOAD_SWEEP_INTERVAL", defaultUntrackedWorkloadSweepInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.completionCheckInterval, err = envOrDefault("COMPLETION_CHECK_INTERVAL", defaultCompletionCheckInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	doneCheck, err := envOrDefault("PIPELINERUN_DONE_CHECK", true, strconv.ParseBool)
+	if err != nil {
+		return nil, err
+	}
+	o.done.ignore = !doneCheck
+	if o.done.gracePeriod, err = envOrDefault("PIPELINERUN_DONE_GRACE_PERIOD", time.Duration(0), time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.done.gracePeriod < 0 {
+		return nil, fmt.Errorf("invalid PIPELINERUN_DONE_GRACE_PERIOD: must not be negative, got %s", o.done.gracePeriod)
+	}
+	if o.clockSkew < 0 {
+		return nil, fmt.Errorf("invalid CLOCK_SKEW_TOLERANCE: must not be negative, got %s", o.clockSkew)
+	}
+	o.done.clockSkew = o.clockSkew
+	o.githubApp.minTokenValidity = max(githubTokenMinValidity, 2*(o.tokenResyncMargin+o.clockSkew))
+
+	// The defaults match workqueue.DefaultTypedControllerRateLimiter
+	if o.workerThreads, err = envOrDefault("WORKER_THREADS", 2, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.rateLimitBaseDelay, err = envOrDefault("RATE_LIMIT_BASE_DELAY", 5*time.Millisecond, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.rateLimitMaxDelay, err = envOrDefault("RATE_LIMIT_MAX_DELAY", 1000*time.Second, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.rateLimitQPS, err = envOrDefault("RATE_LIMIT_QPS", 10.0, parseFloat); err != nil {
+		return nil, err
+	}
+	if o.rateLimitBurst, err = envOrDefault("RATE_LIMIT_BURST", 100, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.cleanupPriority, err = envOrDefault("CLEANUP_PRIORITY", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.workloadEventCoalesceWindow, err = envOrDefault("WORKLOAD_EVENT_COALESCE_WINDOW", time.Second, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.workloadResyncPeriod, err = envOrDefault("KUEUE_INFORMER_RESYNC_PERIOD", time.Duration(0), time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.workloadResyncPeriod < 0 {
+		return nil, fmt.Errorf("invalid KUEUE_INFORMER_RESYNC_PERIOD: must not be negative, got %s", o.workloadResyncPeriod)
+	}
+	if o.workloadResyncJitter, err = envOrDefault("KUEUE_INFORMER_RESYNC_JITTER", defaultWorkloadResyncJitter, parseFloat); err != nil {
+		return nil, err
+	}
+	if o.workloadResyncJitter < 0 {
+		return nil, fmt.Errorf("invalid KUEUE_INFORMER_RESYNC_JITTER: must not be negative, got %v", o.workloadResyncJitter)
+	}
+
+	// client-go defaults to 5 QPS and 10 burst, which throttles as soon as many Workloads land at once
+	if o.hubClientQPS, err = envOrDefault("HUB_CLIENT_QPS", float32(50), parseFloat32); err != nil {
+		return nil, err
+	}
+	if o.hubClientBurst, err = envOrDefault("HUB_CLIENT_BURST", 100, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.hubThrottleMaxDelay, err = envOrDefault("HUB_THROTTLE_MAX_DELAY", defaultHubThrottleMaxDelay, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.spokeClientQPS, err = envOrDefault("SPOKE_CLIENT_QPS", float32(20), parseFloat32); err != nil {
+		return nil, err
+	}
+	if o.spokeClientBurst, err = envOrDefault("SPOKE_CLIENT_BURST", 40, strconv.Atoi); err != nil {
+		return nil, err
+	}
+
+	if o.spokeRequestTimeout, err = envOrDefault("SPOKE_REQUEST_TIMEOUT", 10*time.Second, time.ParseDuration); err != nil {
+		return nil, err
+	}
+
+	if o.spokeMaxConcurrency, err = envOrDefault("SPOKE_MAX_CONCURRENCY", 0, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.spokeCircuitFailureThreshold, err = envOrDefault("SPOKE_CIRCUIT_FAILURE_THRESHOLD", 5, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	if o.spokeCircuitOpenDuration, err = envOrDefault("SPOKE_CIRCUIT_OPEN_DURATION", 30*time.Second, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.spokeProbeInterval, err = envOrDefault("SPOKE_PROBE_INTERVAL", defaultSpokeProbeInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if o.spokeProbeMaxInterval, err = envOrDefault("SPOKE_PROBE_MAX_INTERVAL", defaultSpokeProbeMaxInterval, time.ParseDuration); err != nil {
+		return nil, err
+	}
+
+	if o.failureEscalationThreshold, err = envOrDefault("FAILURE_ESCALATION_THRESHOLD", defaultFailureEscalationThreshold, strconv.Atoi); err != nil {
+		return nil, err
+	}
+
+	if o.probePort, err = envOrDefault("PROBE_PORT", defaultProbePort, strconv.Atoi); err != nil {
+		return nil, err
+	}
+	o.selfTestNamespace = os.Getenv("SELF_TEST_NAMESPACE")
+	o.featureFlagsConfigMap = stringOrDefault("CONFIG_FEATURE_FLAGS_NAME", defaultFeatureFlagsConfigMap)
+	if o.featureGates, err = envOrDefault("FEATURE_GATES", map[string]bool{}, parseFeatureGateList); err != nil {
+		return nil, err
+	}
+
+	if o.auditLogEnabled, err = envOrDefault("AUDIT_LOG_ENABLED", false, strconv.ParseBool); err != nil {
+		return nil, err
+	}
+	if o.cloudEventsSink, err = parseEndpointURL(os.Getenv("CLOUDEVENTS_SINK")); err != nil {
+		return nil, fmt.Errorf("invalid CLOUDEVENTS_SINK: %w", err)
+	}
+	if o.resultsAPI, err = parseEndpointURL(os.Getenv("TEKTON_RESULTS_API")); err != nil {
+		return nil, fmt.Errorf("invalid TEKTON_RESULTS_API: %w", err)
+	}
+	o.resultsCAFile = os.Getenv("TEKTON_RESULTS_TLS_CA_FILE")
+
+	if o.workerThreads < 1 {
+		return nil, fmt.Errorf("invalid WORKER_THREADS: must be at least 1, got %d", o.workerThreads)
+	}
+	if o.rateLimitQPS <= 0 || o.rateLimitBurst < 1 {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_QPS/RATE_LIMIT_BURST: must be positive, got %v/%d", o.rateLimitQPS, o.rateLimitBurst)
+	}
+	if o.workloadEventCoalesceWindow < 0 {
+		return nil, fmt.Errorf("invalid WORKLOAD_EVENT_COALESCE_WINDOW: must not be negative, got %s", o.workloadEventCoalesceWindow)
+	}
+
+	if o.hubClientQPS <= 0 || o.hubClientBurst < 1 || o.spokeClientQPS <= 0 || o.spokeClientBurst < 1 {
+		return nil, fmt.Errorf("invalid client QPS/burst: must be positive, got hub %v/%d and spoke %v/%d", o.hubClientQPS, o.hubClientBurst, o.spokeClientQPS, o.spokeClientBurst)
+	}
+	if o.spokeMaxConcurrency < 0 || o.spokeCircuitFailureThreshold < 0 {
+		return nil, fmt.Errorf("invalid SPOKE_MAX_CONCURRENCY/SPOKE_CIRCUIT_FAILURE_THRESHOLD: must not be negative, got %d/%d", o.spokeMaxConcurrency, o.spokeCircuitFailureThreshold)
+	}
+	switch o.secretSource {
+	case secretSourceVault:
+		if o.vault.address == "" || (o.vault.token == "" && o.vault.role == "") {
+			return nil, fmt.Errorf("invalid SECRET_SOURCE: vault requires VAULT_ADDR and either VAULT_TOKEN or VAULT_ROLE")
+		}
+	case secretSourceAWS:
+		if o.aws.region == "" || o.aws.roleARN == "" || o.aws.webIdentityTokenFile == "" {
+			return nil, fmt.Errorf("invalid SECRET_SOURCE: aws-secrets-manager requires AWS_REGION, AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+	case secretSourceGitHubApp:
+		if !validGitHubAppSecret(o.githubApp.secret) {
+			return nil, fmt.Errorf("invalid GITHUB_APP_SECRET: must be namespace/name, got %q", o.githubApp.secret)
+		}
+	}
+	if o.secretSource != secretSourceKubernetes && o.hubSecretFinalizer {
+		return nil, fmt.Errorf("invalid HUB_SECRET_FINALIZER: only supported with the kubernetes secret source, got %s", o.secretSource)
+	}
+	if o.hubSecretWatch && (o.secretSource != secretSourceKubernetes || o.spokeSecretMode != spokeSecretModeCopy) {
+		return nil, fmt.Errorf("invalid HUB_SECRET_WATCH: only supported with the kubernetes secret source and the copy spoke secret mode, got %s and %s", o.secretSource, o.spokeSecretMode)
+	}
+	if o.hubSecretRevocation && !o.hubSecretWatch {
+		return nil, fmt.Errorf("invalid HUB_SECRET_REVOCATION: requires HUB_SECRET_WATCH")
+	}
+	if o.hubSecretCache && o.secretSource != secretSourceKubernetes {
+		return nil, fmt.Errorf("invalid HUB_SECRET_CACHE: only supported with the kubernetes secret source, got %s", o.secretSource)
+	}
+	if o.spokeSecretMode == spokeSecretModeExternalSecrets {
+		if o.externalSecrets.storeName == "" {
+			return nil, fmt.Errorf("invalid SPOKE_SECRET_MODE: external-secrets requires EXTERNAL_SECRET_STORE")
+		}
+		if _, err := time.ParseDuration(o.externalSecrets.refreshInterval); err != nil {
+			return nil, fmt.Errorf("invalid EXTERNAL_SECRET_REFRESH_INTERVAL: %w", err)
+		}
+	}
+	if o.spokeSecretMode == spokeSecretModePull && o.pullAPI.port <= 0 {
+		return nil, fmt.Errorf("invalid SPOKE_SECRET_MODE: pull requires PULL_API_PORT")
+	}
+	if o.pullAPI.port > 0 && (o.pullAPI.certFile == "" || o.pullAPI.keyFile == "" || o.pullAPI.agentNamespace == "") {
+		return nil, fmt.Errorf("invalid PULL_API_PORT: the pull API requires PULL_API_TLS_CERT_FILE, PULL_API_TLS_KEY_FILE and PULL_API_AGENT_NAMESPACE")
+	}
+	if o.repositorySecrets && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid PAC_REPOSITORY_SECRETS: the spoke agents of the pull SPOKE_SECRET_MODE only pull the git auth secret")
+	}
+	if (o.pipelineRunSecretSources[pipelineRunSecretsWorkspaces] || o.pipelineRunSecretSources[pipelineRunSecretsServiceAccount]) && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid PIPELINERUN_SECRET_SOURCES: the spoke agents of the pull SPOKE_SECRET_MODE only pull the git auth secret")
+	}
+	if len(o.pipelineRunConfigMapSources) > 0 && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid PIPELINERUN_CONFIGMAP_SOURCES: the spoke agents of the pull SPOKE_SECRET_MODE only pull the git auth secret")
+	}
+	if len(o.resolverSecrets.resolvers) > 0 && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid RESOLVER_SECRETS: the spoke agents of the pull SPOKE_SECRET_MODE only pull the git auth secret")
+	}
+	if o.knownHosts.kind != "" && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid SSH_KNOWN_HOSTS_SOURCE: the spoke agents of the pull SPOKE_SECRET_MODE only pull the git auth secret")
+	}
+	if o.secretSyncConcurrency <= 0 {
+		return nil, fmt.Errorf("invalid SECRET_SYNC_CONCURRENCY: must be positive, got %d", o.secretSyncConcurrency)
+	}
+	if o.admissionWebhook.port > 0 && (o.admissionWebhook.certFile == "" || o.admissionWebhook.keyFile == "") {
+		return nil, fmt.Errorf("invalid ADMISSION_WEBHOOK_PORT: the admission webhook requires ADMISSION_WEBHOOK_TLS_CERT_FILE and ADMISSION_WEBHOOK_TLS_KEY_FILE")
+	}
+	if o.chains.enabled && o.spokeSecretMode == spokeSecretModePull {
+		return nil, fmt.Errorf("invalid CHAINS_SIGNING_SECRETS_SYNC: the hub can't reach the spoke clusters of the pull SPOKE_SECRET_MODE")
+	}
+	if o.chains.enabled && o.chains.interval <= 0 {
+		return nil, fmt.Errorf("invalid CHAINS_SIGNING_SECRETS_SYNC_INTERVAL: must be positive, got %s", o.chains.interval)
+	}
+	if o.tokenResyncMargin < 0 {
+		return nil, fmt.Errorf("invalid TOKEN_RESYNC_MARGIN: must not be negative, got %s", o.tokenResyncMargin)
+	}
+	if o.rotationThreshold < 0 || (o.rotationThreshold > 0 && o.rotationInterval <= 0) {
+		return nil, fmt.Errorf("invalid ROTATION_THRESHOLD/ROTATION_INTERVAL: the threshold must not be negative and the interval must be positive, got %s/%s", o.rotationThreshold, o.rotationInterval)
+	}
+	if o.secretQuota.maxCount < 0 || o.secretQuota.maxBytes < 0 {
+		return nil, fmt.Errorf("invalid NAMESPACE_SECRET_QUOTA_COUNT/NAMESPACE_SECRET_QUOTA_SIZE: must not be negative, got %d/%d", o.secretQuota.maxCount, o.secretQuota.maxBytes)
+	}
+	if o.failureEscalationThreshold < 0 {
+		return nil, fmt.Errorf("invalid FAILURE_ESCALATION_THRESHOLD: must not be negative, got %d", o.failureEscalationThreshold)
+	}
+
+	return o, nil
+}
+
+// rateLimiter builds the workqueue rate limiter: the slowest of a per-item exponential
+// backoff and an overall token bucket. With CLEANUP_PRIORITY, the items cleanup reports as
+// cleanups only get the backoff.
+func (o *options) rateLimiter(cleanup func(item any) bool) workqueue.TypedRateLimiter[any] {
+	failures := workqueue.NewTypedItemExponentialFailureRateLimiter[any](o.rateLimitBaseDelay, o.rateLimitMaxDelay)
+	limiter := workqueue.NewTypedMaxOfRateLimiter(
+		failures,
+		&workqueue.TypedBucketRateLimiter[any]{Limiter: rate.NewLimiter(rate.Limit(o.rateLimitQPS), o.rateLimitBurst)},
+	)
+	if !o.cleanupPriority || cleanup == nil {
+		return limiter
+	}
+	return &cleanupRateLimiter{TypedRateLimiter: limiter, failures: failures, cleanup: cleanup}
+}
+
+// envOrDefault parses the environment variable name, returning def when it is unset.
+func envOrDefault[T any](name string, def T, parse func(string) (T, error)) (T, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := parse(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// stringOrDefault returns the environment variable name, or def when it is unset.
+func stringOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseFloat32(value string) (float32, error) {
+	f, err := strconv.ParseFloat(value, 32)
+	return float32(f), err
+}
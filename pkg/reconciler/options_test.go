@@ -0,0 +1,794 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectedError string
+		validate      func(*testing.T, *options)
+	}{
+		{
+			name: "defaults",
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, "kueue-system", o.kueueNamespace)
+				assert.Equal(t, controllerName, o.name)
+				assert.Equal(t, syncer.KubeconfigContextMatch, o.kubeconfigContext)
+				assert.Equal(t, RetainPolicyDelete, o.retainPolicy)
+				assert.Equal(t, false, o.hubSecretFinalizer)
+				assert.Equal(t, defaultOrphanSweepInterval, o.orphanSweepInterval)
+				assert.Equal(t, defaultCompletionCheckInterval, o.completionCheckInterval)
+				assert.Equal(t, donePolicy{clockSkew: defaultClockSkewTolerance}, o.done)
+				assert.Equal(t, defaultClockSkewTolerance, o.clockSkew)
+				assert.Equal(t, 2, o.workerThreads)
+				assert.Equal(t, 5*time.Millisecond, o.rateLimitBaseDelay)
+				assert.Equal(t, 1000*time.Second, o.rateLimitMaxDelay)
+				assert.Equal(t, 10.0, o.rateLimitQPS)
+				assert.Equal(t, 100, o.rateLimitBurst)
+				assert.Assert(t, !o.cleanupPriority)
+				assert.Equal(t, float32(50), o.hubClientQPS)
+				assert.Equal(t, 100, o.hubClientBurst)
+				assert.Equal(t, defaultHubThrottleMaxDelay, o.hubThrottleMaxDelay)
+				assert.Equal(t, float32(20), o.spokeClientQPS)
+				assert.Equal(t, 40, o.spokeClientBurst)
+				assert.Equal(t, 10*time.Second, o.spokeRequestTimeout)
+				assert.Equal(t, defaultProbePort, o.probePort)
+				assert.Equal(t, "", o.selfTestNamespace)
+				assert.Equal(t, defaultFeatureFlagsConfigMap, o.featureFlagsConfigMap)
+				assert.DeepEqual(t, map[string]bool{}, o.featureGates)
+				assert.Equal(t, defaultFailureEscalationThreshold, o.failureEscalationThreshold)
+				assert.Equal(t, false, o.auditLogEnabled)
+				assert.Equal(t, "", o.cloudEventsSink)
+				assert.Equal(t, "", o.resultsAPI)
+				assert.Equal(t, workloadStatusCondition, o.workloadStatus)
+				assert.Equal(t, statusStoreNone, o.statusStore)
+				assert.Equal(t, false, o.dryRun)
+				assert.Equal(t, defaultSpokeProbeInterval, o.spokeProbeInterval)
+				assert.Equal(t, defaultSpokeProbeMaxInterval, o.spokeProbeMaxInterval)
+				assert.Equal(t, 0, o.admissionWebhook.port)
+				assert.Equal(t, admissionActionDeny, o.admissionWebhook.action)
+				assert.Equal(t, secretSourceKubernetes, o.secretSource)
+				assert.Equal(t, defaultVaultPathTemplate, o.vault.pathTemplate)
+				assert.Equal(t, spokeSecretModeCopy, o.spokeSecretMode)
+				assert.Equal(t, defaultTokenResyncMargin, o.tokenResyncMargin)
+				assert.Equal(t, time.Duration(0), o.rotationThreshold)
+				assert.Equal(t, defaultRotationInterval, o.rotationInterval)
+				assert.DeepEqual(t, map[string]bool{pipelineRunSecretsAnnotation: true}, o.pipelineRunSecretSources)
+				assert.DeepEqual(t, map[string]bool{}, o.pipelineRunConfigMapSources)
+				assert.DeepEqual(t, knownHostsOptions{key: defaultKnownHostsKey}, o.knownHosts, cmp.AllowUnexported(knownHostsOptions{}))
+				assert.DeepEqual(t, resolverSecretsOptions{resolvers: map[string]bool{}, namespace: defaultResolversNamespace}, o.resolverSecrets, cmp.AllowUnexported(resolverSecretsOptions{}))
+				assert.Equal(t, defaultSecretSyncConcurrency, o.secretSyncConcurrency)
+				assert.Equal(t, time.Duration(0), o.workloadResyncPeriod)
+				assert.Equal(t, defaultWorkloadResyncJitter, o.workloadResyncJitter)
+				assert.Equal(t, false, o.hubSecretCache)
+				assert.Equal(t, defaultHubSecretCacheSelector, o.hubSecretCacheSelector)
+			},
+		},
+		{
+			name: "custom values",
+			env: map[string]string{
+				"KUEUE_NAMESPACE":            "custom-kueue",
+				"WATCH_NAMESPACES":           "ci, team-a",
+				"WORKLOAD_LABEL_SELECTOR":    "tekton.dev/pipelineRun",
+				"WORKLOAD_FIELD_SELECTOR":    "metadata.namespace=ci",
+				"WORKLOAD_LOCAL_QUEUES":      "remote-tekton, ci/tekton",
+				"WORKLOAD_CLUSTER_QUEUES":    "spoke-clusters",
+				"SECRET_RETAIN_POLICY":       "Retain",
+				"HUB_SECRET_FINALIZER":       "true",
+				"ORPHAN_SWEEP_INTERVAL":      "0",
+				"COMPLETION_CHECK_INTERVAL":  "1m",
+				"PIPELINERUN_SECRET_SOURCES": "workspaces, service-account",
+				"SECRET_SYNC_CONCURRENCY":    "8",
+				"WORKER_THREADS":             "16",
+				"RATE_LIMIT_BASE_DELAY":      "10ms",
+				"RATE_LIMIT_MAX_DELAY":       "5m",
+				"RATE_LIMIT_QPS":             "50.5",
+				"RATE_LIMIT_BURST":           "500",
+				"HUB_CLIENT_QPS":             "200",
+				"HUB_CLIENT_BURST":           "400",
+				"HUB_THROTTLE_MAX_DELAY":     "0",
+				"SELF_TEST_NAMESPACE":        "ci",
+				"SPOKE_CLIENT_QPS":           "12.5",
+				"SPOKE_CLIENT_BURST":         "25",
+				"SPOKE_REQUEST_TIMEOUT":      "3s",
+				"AUDIT_LOG_ENABLED":          "true",
+				"CLOUDEVENTS_SINK":           "http://broker-ingress.knative-eventing.svc.cluster.local/ci/default",
+				"TEKTON_RESULTS_API":         "https://tekton-results-api-service.tekton-pipelines.svc:8080",
+				"FEATURE_GATES":              "pull-agent=true, secret-rotation=false",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, "custom-kueue", o.kueueNamespace)
+				assert.DeepEqual(t, []string{"ci", "team-a"}, o.watchNamespaces)
+				assert.Equal(t, "tekton.dev/pipelineRun", o.workloadLabelSelector)
+				assert.Equal(t, "metadata.namespace=ci", o.workloadFieldSelector)
+				assert.DeepEqual(t, map[string]bool{"remote-tekton": true, "ci/tekton": true}, o.queues.localQueues)
+				assert.DeepEqual(t, map[string]bool{"spoke-clusters": true}, o.queues.clusterQueues)
+				assert.Equal(t, RetainPolicyRetain, o.retainPolicy)
+				assert.Equal(t, true, o.hubSecretFinalizer)
+				assert.Equal(t, time.Duration(0), o.orphanSweepInterval)
+				assert.Equal(t, time.Minute, o.completionCheckInterval)
+				assert.DeepEqual(t, map[string]bool{pipelineRunSecretsWorkspaces: true, pipelineRunSecretsServiceAccount: true}, o.pipelineRunSecretSources)
+				assert.Equal(t, 8, o.secretSyncConcurrency)
+				assert.Equal(t, 16, o.workerThreads)
+				assert.Equal(t, 10*time.Millisecond, o.rateLimitBaseDelay)
+				assert.Equal(t, 5*time.Minute, o.rateLimitMaxDelay)
+				assert.Equal(t, 50.5, o.rateLimitQPS)
+				assert.Equal(t, 500, o.rateLimitBurst)
+				assert.Equal(t, float32(200), o.hubClientQPS)
+				assert.Equal(t, 400, o.hubClientBurst)
+				assert.Equal(t, time.Duration(0), o.hubThrottleMaxDelay)
+				assert.Equal(t, "ci", o.selfTestNamespace)
+				assert.Equal(t, float32(12.5), o.spokeClientQPS)
+				assert.Equal(t, 25, o.spokeClientBurst)
+				assert.Equal(t, 3*time.Second, o.spokeRequestTimeout)
+				assert.Equal(t, true, o.auditLogEnabled)
+				assert.Equal(t, "http://broker-ingress.knative-eventing.svc.cluster.local/ci/default", o.cloudEventsSink)
+				assert.Equal(t, "https://tekton-results-api-service.tekton-pipelines.svc:8080", o.resultsAPI)
+				assert.DeepEqual(t, map[string]bool{featurePullAgent: true, featureSecretRotation: false}, o.featureGates)
+			},
+		},
+		{
+			name:          "unknown feature gate",
+			env:           map[string]string{"FEATURE_GATES": "pull-agent=true,spoke-gc=true"},
+			expectedError: `invalid FEATURE_GATES: unknown feature gate "spoke-gc"`,
+		},
+		{
+			name:          "invalid duration",
+			env:           map[string]string{"RATE_LIMIT_MAX_DELAY": "forever"},
+			expectedError: "invalid RATE_LIMIT_MAX_DELAY",
+		},
+		{
+			name: "cleanup priority",
+			env:  map[string]string{"CLEANUP_PRIORITY": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.cleanupPriority)
+			},
+		},
+		{
+			name:          "invalid cleanup priority",
+			env:           map[string]string{"CLEANUP_PRIORITY": "first"},
+			expectedError: "invalid CLEANUP_PRIORITY",
+		},
+		{
+			name:          "invalid watch namespaces",
+			env:           map[string]string{"WATCH_NAMESPACES": "ci,Team_A"},
+			expectedError: "invalid WATCH_NAMESPACES",
+		},
+		{
+			name:          "invalid label selector",
+			env:           map[string]string{"WORKLOAD_LABEL_SELECTOR": "a in (b"},
+			expectedError: "invalid WORKLOAD_LABEL_SELECTOR",
+		},
+		{
+			name:          "invalid field selector",
+			env:           map[string]string{"WORKLOAD_FIELD_SELECTOR": "metadata.name"},
+			expectedError: "invalid WORKLOAD_FIELD_SELECTOR",
+		},
+		{
+			name:          "invalid kubeconfig context strategy",
+			env:           map[string]string{"SPOKE_KUBECONFIG_CONTEXT": "first"},
+			expectedError: "invalid SPOKE_KUBECONFIG_CONTEXT",
+		},
+		{
+			name:          "invalid local queue",
+			env:           map[string]string{"WORKLOAD_LOCAL_QUEUES": "ci/Remote_Tekton"},
+			expectedError: "invalid WORKLOAD_LOCAL_QUEUES",
+		},
+		{
+			name:          "namespaced cluster queue",
+			env:           map[string]string{"WORKLOAD_CLUSTER_QUEUES": "ci/spoke-clusters"},
+			expectedError: "invalid WORKLOAD_CLUSTER_QUEUES",
+		},
+		{
+			name: "owner traversal",
+			env:  map[string]string{"OWNER_TRAVERSAL_DEPTH": "2", "OWNER_TRAVERSAL_KINDS": "TaskGroup.example.com, ConfigMap"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, 2, o.queues.owners.depth)
+				assert.DeepEqual(t, []schema.GroupKind{{Group: "example.com", Kind: "TaskGroup"}, {Kind: "ConfigMap"}}, o.queues.owners.kinds)
+			},
+		},
+		{
+			name:          "owner traversal too deep",
+			env:           map[string]string{"OWNER_TRAVERSAL_DEPTH": "6", "OWNER_TRAVERSAL_KINDS": "TaskGroup.example.com"},
+			expectedError: "invalid OWNER_TRAVERSAL_DEPTH: must be between 0 and 5, got 6",
+		},
+		{
+			name:          "owner traversal without kinds",
+			env:           map[string]string{"OWNER_TRAVERSAL_DEPTH": "1"},
+			expectedError: "invalid OWNER_TRAVERSAL_KINDS: the kinds of the intermediate owners are required with OWNER_TRAVERSAL_DEPTH",
+		},
+		{
+			name:          "PipelineRun owner kind",
+			env:           map[string]string{"OWNER_TRAVERSAL_DEPTH": "1", "OWNER_TRAVERSAL_KINDS": "PipelineRun.tekton.dev"},
+			expectedError: `invalid OWNER_TRAVERSAL_KINDS: invalid owner kind "PipelineRun.tekton.dev"`,
+		},
+		{
+			name:          "invalid PipelineRun secret source",
+			env:           map[string]string{"PIPELINERUN_SECRET_SOURCES": "annotation,params"},
+			expectedError: "invalid PIPELINERUN_SECRET_SOURCES",
+		},
+		{
+			name:          "invalid PipelineRun ConfigMap source",
+			env:           map[string]string{"PIPELINERUN_CONFIGMAP_SOURCES": "annotation,service-account"},
+			expectedError: "invalid PIPELINERUN_CONFIGMAP_SOURCES",
+		},
+		{
+			name: "SSH known_hosts",
+			env:  map[string]string{"SSH_KNOWN_HOSTS_SOURCE": "configmap:openshift-pipelines/ssh-known-hosts", "SSH_KNOWN_HOSTS_KEY": "ssh_known_hosts"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, knownHostsOptions{
+					kind:      knownHostsKindConfigMap,
+					namespace: "openshift-pipelines",
+					name:      "ssh-known-hosts",
+					key:       "ssh_known_hosts",
+				}, o.knownHosts, cmp.AllowUnexported(knownHostsOptions{}))
+			},
+		},
+		{
+			name:          "invalid SSH known_hosts source",
+			env:           map[string]string{"SSH_KNOWN_HOSTS_SOURCE": "ssh-known-hosts"},
+			expectedError: "invalid SSH_KNOWN_HOSTS_SOURCE",
+		},
+		{
+			name: "resolver secrets",
+			env:  map[string]string{"RESOLVER_SECRETS": "bundles,git", "RESOLVERS_NAMESPACE": "openshift-pipelines"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, resolverSecretsOptions{
+					resolvers: map[string]bool{resolverSecretsBundles: true, resolverSecretsGit: true},
+					namespace: "openshift-pipelines",
+				}, o.resolverSecrets, cmp.AllowUnexported(resolverSecretsOptions{}))
+			},
+		},
+		{
+			name:          "invalid resolver secrets",
+			env:           map[string]string{"RESOLVER_SECRETS": "git,hub"},
+			expectedError: "invalid RESOLVER_SECRETS",
+		},
+		{
+			name:          "no secret sync concurrency",
+			env:           map[string]string{"SECRET_SYNC_CONCURRENCY": "0"},
+			expectedError: "invalid SECRET_SYNC_CONCURRENCY",
+		},
+		{
+			name:          "invalid bool",
+			env:           map[string]string{"HUB_SECRET_FINALIZER": "maybe"},
+			expectedError: "invalid HUB_SECRET_FINALIZER",
+		},
+		{
+			name:          "no workers",
+			env:           map[string]string{"WORKER_THREADS": "0"},
+			expectedError: "invalid WORKER_THREADS: must be at least 1",
+		},
+		{
+			name:          "negative spoke client burst",
+			env:           map[string]string{"SPOKE_CLIENT_BURST": "-1"},
+			expectedError: "invalid client QPS/burst",
+		},
+		{
+			name: "vault secret source",
+			env: map[string]string{
+				"SECRET_SOURCE":       "vault",
+				"VAULT_ADDR":          "https://vault.vault.svc:8200",
+				"VAULT_ROLE":          "secret-syncer",
+				"VAULT_KV_MOUNT":      "ci",
+				"VAULT_PATH_TEMPLATE": "git/{namespace}/{name}",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, secretSourceVault, o.secretSource)
+				assert.DeepEqual(t, vaultOptions{
+					address:      "https://vault.vault.svc:8200",
+					role:         "secret-syncer",
+					authMount:    defaultVaultAuthMount,
+					kvMount:      "ci",
+					pathTemplate: "git/{namespace}/{name}",
+				}, o.vault, cmp.AllowUnexported(vaultOptions{}))
+			},
+		},
+		{
+			name:          "vault secret source without credentials",
+			env:           map[string]string{"SECRET_SOURCE": "vault", "VAULT_ADDR": "https://vault.vault.svc:8200"},
+			expectedError: "vault requires VAULT_ADDR and either VAULT_TOKEN or VAULT_ROLE",
+		},
+		{
+			name:          "vault secret source with hub finalizer",
+			env:           map[string]string{"SECRET_SOURCE": "vault", "VAULT_ADDR": "https://vault.vault.svc:8200", "VAULT_TOKEN": "t", "HUB_SECRET_FINALIZER": "true"},
+			expectedError: "invalid HUB_SECRET_FINALIZER",
+		},
+		{
+			name: "hub secret watch",
+			env:  map[string]string{"HUB_SECRET_WATCH": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.hubSecretWatch)
+			},
+		},
+		{
+			name: "hub secret revocation",
+			env:  map[string]string{"HUB_SECRET_WATCH": "true", "HUB_SECRET_REVOCATION": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.hubSecretRevocation)
+			},
+		},
+		{
+			name: "hub secret cache",
+			env:  map[string]string{"HUB_SECRET_CACHE": "true", "HUB_SECRET_CACHE_LABEL_SELECTOR": "pipelinesascode.tekton.dev/url-org=tektoncd"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.hubSecretCache)
+				assert.Equal(t, "pipelinesascode.tekton.dev/url-org=tektoncd", o.hubSecretCacheSelector)
+			},
+		},
+		{
+			name:          "invalid hub secret cache selector",
+			env:           map[string]string{"HUB_SECRET_CACHE_LABEL_SELECTOR": "a in (b"},
+			expectedError: "invalid HUB_SECRET_CACHE_LABEL_SELECTOR",
+		},
+		{
+			name:          "hub secret cache with the github app source",
+			env:           map[string]string{"HUB_SECRET_CACHE": "true", "SECRET_SOURCE": "github-app"},
+			expectedError: "invalid HUB_SECRET_CACHE: only supported with the kubernetes secret source, got github-app",
+		},
+		{
+			name:          "hub secret revocation without the watch",
+			env:           map[string]string{"HUB_SECRET_REVOCATION": "true"},
+			expectedError: "invalid HUB_SECRET_REVOCATION: requires HUB_SECRET_WATCH",
+		},
+		{
+			name:          "hub secret watch with the pull mode",
+			env:           map[string]string{"HUB_SECRET_WATCH": "true", "SPOKE_SECRET_MODE": "pull"},
+			expectedError: "invalid HUB_SECRET_WATCH: only supported with the kubernetes secret source and the copy spoke secret mode, got kubernetes and pull",
+		},
+		{
+			name: "aws secret source",
+			env: map[string]string{
+				"SECRET_SOURCE":               "aws-secrets-manager",
+				"AWS_DEFAULT_REGION":          "eu-west-1",
+				"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/secret-syncer",
+				"AWS_WEB_IDENTITY_TOKEN_FILE": "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, awsOptions{
+					region:               "eu-west-1",
+					roleARN:              "arn:aws:iam::123456789012:role/secret-syncer",
+					webIdentityTokenFile: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
+					secretIDTemplate:     defaultAWSSecretIDTemplate,
+				}, o.aws, cmp.AllowUnexported(awsOptions{}))
+			},
+		},
+		{
+			name:          "aws secret source without irsa",
+			env:           map[string]string{"SECRET_SOURCE": "aws-secrets-manager", "AWS_REGION": "eu-west-1"},
+			expectedError: "aws-secrets-manager requires AWS_REGION, AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE",
+		},
+		{
+			name: "gcp secret source",
+			env:  map[string]string{"SECRET_SOURCE": "gcp-secret-manager", "GCP_PROJECT": "ci-project"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, gcpOptions{project: "ci-project", secretIDTemplate: defaultGCPSecretIDTemplate}, o.gcp, cmp.AllowUnexported(gcpOptions{}))
+			},
+		},
+		{
+			name: "github app secret source",
+			env:  map[string]string{"SECRET_SOURCE": "github-app", "GITHUB_APP_TOKEN_PERMISSIONS": "contents=read,checks=write"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, githubAppOptions{
+					secret:           defaultGitHubAppSecret,
+					apiURL:           defaultGitHubAPIURL,
+					permissions:      map[string]string{"contents": "read", "checks": "write"},
+					minTokenValidity: githubTokenMinValidity,
+				}, o.githubApp, cmp.AllowUnexported(githubAppOptions{}))
+			},
+		},
+		{
+			name:          "github app secret source with invalid secret",
+			env:           map[string]string{"SECRET_SOURCE": "github-app", "GITHUB_APP_SECRET": "pipelines-as-code-secret"},
+			expectedError: "invalid GITHUB_APP_SECRET: must be namespace/name",
+		},
+		{
+			name:          "unknown secret source",
+			env:           map[string]string{"SECRET_SOURCE": "aws"},
+			expectedError: "invalid SECRET_SOURCE: unsupported secret source",
+		},
+		{
+			name: "external-secrets spoke secret mode",
+			env:  map[string]string{"SPOKE_SECRET_MODE": "external-secrets", "EXTERNAL_SECRET_STORE": "ci-store"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, spokeSecretModeExternalSecrets, o.spokeSecretMode)
+				assert.DeepEqual(t, externalSecretsOptions{
+					apiVersion:      defaultExternalSecretsAPIVersion,
+					storeName:       "ci-store",
+					storeKind:       defaultExternalSecretStoreKind,
+					keyTemplate:     defaultExternalSecretKeyTemplate,
+					refreshInterval: defaultExternalSecretRefreshPeriod,
+				}, o.externalSecrets, cmp.AllowUnexported(externalSecretsOptions{}))
+			},
+		},
+		{
+			name:          "external-secrets spoke secret mode without store",
+			env:           map[string]string{"SPOKE_SECRET_MODE": "external-secrets"},
+			expectedError: "external-secrets requires EXTERNAL_SECRET_STORE",
+		},
+		{
+			name: "sealed-secrets spoke secret mode",
+			env:  map[string]string{"SPOKE_SECRET_MODE": "sealed-secrets", "SEALED_SECRETS_CONTROLLER_NAMESPACE": "sealed-secrets"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, spokeSecretModeSealedSecrets, o.spokeSecretMode)
+				assert.DeepEqual(t, sealedSecretsOptions{
+					controllerNamespace: "sealed-secrets",
+					controllerName:      defaultSealedSecretsControllerName,
+				}, o.sealedSecrets, cmp.AllowUnexported(sealedSecretsOptions{}))
+			},
+		},
+		{
+			name: "pull spoke secret mode",
+			env: map[string]string{
+				"SPOKE_SECRET_MODE":      "pull",
+				"PULL_API_PORT":          "8443",
+				"PULL_API_TLS_CERT_FILE": "/etc/pull-api/tls.crt",
+				"PULL_API_TLS_KEY_FILE":  "/etc/pull-api/tls.key",
+				"SYSTEM_NAMESPACE":       "syncer-service",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, spokeSecretModePull, o.spokeSecretMode)
+				assert.DeepEqual(t, pullAPIOptions{
+					port:           8443,
+					certFile:       "/etc/pull-api/tls.crt",
+					keyFile:        "/etc/pull-api/tls.key",
+					agentNamespace: "syncer-service",
+				}, o.pullAPI, cmp.AllowUnexported(pullAPIOptions{}))
+			},
+		},
+		{
+			name: "PAC repository secrets",
+			env:  map[string]string{"PAC_REPOSITORY_SECRETS": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.repositorySecrets)
+			},
+		},
+		{
+			name: "PAC repository secrets in pull mode",
+			env: map[string]string{
+				"PAC_REPOSITORY_SECRETS": "true",
+				"SPOKE_SECRET_MODE":      "pull",
+				"PULL_API_PORT":          "8443",
+				"PULL_API_TLS_CERT_FILE": "/etc/pull-api/tls.crt",
+				"PULL_API_TLS_KEY_FILE":  "/etc/pull-api/tls.key",
+				"SYSTEM_NAMESPACE":       "syncer-service",
+			},
+			expectedError: "invalid PAC_REPOSITORY_SECRETS",
+		},
+		{
+			name: "PipelineRun ConfigMaps in pull mode",
+			env: map[string]string{
+				"PIPELINERUN_CONFIGMAP_SOURCES": "annotation",
+				"SPOKE_SECRET_MODE":             "pull",
+				"PULL_API_PORT":                 "8443",
+				"PULL_API_TLS_CERT_FILE":        "/etc/pull-api/tls.crt",
+				"PULL_API_TLS_KEY_FILE":         "/etc/pull-api/tls.key",
+				"SYSTEM_NAMESPACE":              "syncer-service",
+			},
+			expectedError: "invalid PIPELINERUN_CONFIGMAP_SOURCES",
+		},
+		{
+			name:          "invalid PAC repository secrets",
+			env:           map[string]string{"PAC_REPOSITORY_SECRETS": "sometimes"},
+			expectedError: "invalid PAC_REPOSITORY_SECRETS",
+		},
+		{
+			name: "chains signing secrets sync",
+			env:  map[string]string{"CHAINS_SIGNING_SECRETS_SYNC": "true", "CHAINS_NAMESPACE": "openshift-pipelines"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, chainsOptions{
+					enabled:   true,
+					namespace: "openshift-pipelines",
+					interval:  defaultChainsSigningSyncPeriod,
+				}, o.chains, cmp.AllowUnexported(chainsOptions{}))
+			},
+		},
+		{
+			name: "chains signing secrets sync in pull mode",
+			env: map[string]string{
+				"CHAINS_SIGNING_SECRETS_SYNC": "true",
+				"SPOKE_SECRET_MODE":           "pull",
+				"PULL_API_PORT":               "8443",
+				"PULL_API_TLS_CERT_FILE":      "/etc/pull-api/tls.crt",
+				"PULL_API_TLS_KEY_FILE":       "/etc/pull-api/tls.key",
+				"SYSTEM_NAMESPACE":            "syncer-service",
+			},
+			expectedError: "invalid CHAINS_SIGNING_SECRETS_SYNC",
+		},
+		{
+			name:          "pull spoke secret mode without pull API",
+			env:           map[string]string{"SPOKE_SECRET_MODE": "pull"},
+			expectedError: "pull requires PULL_API_PORT",
+		},
+		{
+			name:          "pull API without certificate",
+			env:           map[string]string{"PULL_API_PORT": "8443", "SYSTEM_NAMESPACE": "syncer-service"},
+			expectedError: "the pull API requires PULL_API_TLS_CERT_FILE",
+		},
+		{
+			name:          "invalid external secret refresh interval",
+			env:           map[string]string{"SPOKE_SECRET_MODE": "external-secrets", "EXTERNAL_SECRET_STORE": "ci-store", "EXTERNAL_SECRET_REFRESH_INTERVAL": "hourly"},
+			expectedError: "invalid EXTERNAL_SECRET_REFRESH_INTERVAL",
+		},
+		{
+			name:          "relative cloudevents sink",
+			env:           map[string]string{"CLOUDEVENTS_SINK": "/ci/default"},
+			expectedError: "invalid CLOUDEVENTS_SINK: must be an absolute http or https URL",
+		},
+		{
+			name: "annotation workload sync status",
+			env:  map[string]string{"WORKLOAD_SYNC_STATUS": "annotation"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, workloadStatusAnnotation, o.workloadStatus)
+			},
+		},
+		{
+			name:          "invalid workload sync status",
+			env:           map[string]string{"WORKLOAD_SYNC_STATUS": "status"},
+			expectedError: "invalid WORKLOAD_SYNC_STATUS",
+		},
+		{
+			name:          "invalid hub throttle max delay",
+			env:           map[string]string{"HUB_THROTTLE_MAX_DELAY": "long"},
+			expectedError: "invalid HUB_THROTTLE_MAX_DELAY",
+		},
+		{
+			name:          "invalid spoke probe interval",
+			env:           map[string]string{"SPOKE_PROBE_INTERVAL": "often"},
+			expectedError: "invalid SPOKE_PROBE_INTERVAL",
+		},
+		{
+			name: "dry run",
+			env:  map[string]string{"DRY_RUN": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, true, o.dryRun)
+			},
+		},
+		{
+			name:          "invalid dry run",
+			env:           map[string]string{"DRY_RUN": "maybe"},
+			expectedError: "invalid DRY_RUN",
+		},
+		{
+			name: "annotation sync status store",
+			env:  map[string]string{"SYNC_STATUS_STORE": "annotation"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, statusStoreAnnotation, o.statusStore)
+			},
+		},
+		{
+			name:          "invalid sync status store",
+			env:           map[string]string{"SYNC_STATUS_STORE": "configmap"},
+			expectedError: "invalid SYNC_STATUS_STORE",
+		},
+		{
+			name: "admission webhook",
+			env: map[string]string{
+				"ADMISSION_WEBHOOK_PORT":            "9443",
+				"ADMISSION_WEBHOOK_TLS_CERT_FILE":   "/etc/webhook/tls.crt",
+				"ADMISSION_WEBHOOK_TLS_KEY_FILE":    "/etc/webhook/tls.key",
+				"ADMISSION_WEBHOOK_ACTION":          "warn",
+				"ADMISSION_WEBHOOK_SECRET_SELECTOR": "app.kubernetes.io/managed-by=pipelinesascode.tekton.dev",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, 9443, o.admissionWebhook.port)
+				assert.Equal(t, "/etc/webhook/tls.crt", o.admissionWebhook.certFile)
+				assert.Equal(t, "/etc/webhook/tls.key", o.admissionWebhook.keyFile)
+				assert.Equal(t, admissionActionWarn, o.admissionWebhook.action)
+				assert.Equal(t, "app.kubernetes.io/managed-by=pipelinesascode.tekton.dev", o.admissionWebhook.secretSelector.String())
+			},
+		},
+		{
+			name:          "admission webhook without certificate",
+			env:           map[string]string{"ADMISSION_WEBHOOK_PORT": "9443"},
+			expectedError: "invalid ADMISSION_WEBHOOK_PORT",
+		},
+		{
+			name:          "invalid admission webhook action",
+			env:           map[string]string{"ADMISSION_WEBHOOK_ACTION": "audit"},
+			expectedError: "invalid ADMISSION_WEBHOOK_ACTION",
+		},
+		{
+			name:          "invalid admission webhook secret selector",
+			env:           map[string]string{"ADMISSION_WEBHOOK_SECRET_SELECTOR": "a=b=c"},
+			expectedError: "invalid ADMISSION_WEBHOOK_SECRET_SELECTOR",
+		},
+		{
+			name:          "relative Tekton Results API",
+			env:           map[string]string{"TEKTON_RESULTS_API": "tekton-results-api-service:8080"},
+			expectedError: "invalid TEKTON_RESULTS_API: must be an absolute http or https URL",
+		},
+		{
+			name:          "negative token resync margin",
+			env:           map[string]string{"TOKEN_RESYNC_MARGIN": "-1m"},
+			expectedError: "invalid TOKEN_RESYNC_MARGIN: must not be negative",
+		},
+		{
+			name: "clock skew tolerance",
+			env:  map[string]string{"CLOCK_SKEW_TOLERANCE": "2m", "PIPELINERUN_DONE_GRACE_PERIOD": "5m"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, 2*time.Minute, o.clockSkew)
+				assert.Equal(t, 2*time.Minute, o.done.clockSkew)
+			},
+		},
+		{
+			name:          "negative clock skew tolerance",
+			env:           map[string]string{"CLOCK_SKEW_TOLERANCE": "-1s"},
+			expectedError: "invalid CLOCK_SKEW_TOLERANCE: must not be negative, got -1s",
+		},
+		{
+			name: "done PipelineRuns",
+			env:  map[string]string{"PIPELINERUN_DONE_CHECK": "false", "PIPELINERUN_DONE_GRACE_PERIOD": "2m"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, donePolicy{ignore: true, gracePeriod: 2 * time.Minute, clockSkew: defaultClockSkewTolerance}, o.done)
+			},
+		},
+		{
+			name:          "negative done grace period",
+			env:           map[string]string{"PIPELINERUN_DONE_GRACE_PERIOD": "-1m"},
+			expectedError: "invalid PIPELINERUN_DONE_GRACE_PERIOD: must not be negative",
+		},
+		{
+			name:          "zero rotation interval",
+			env:           map[string]string{"ROTATION_THRESHOLD": "6h", "ROTATION_INTERVAL": "0"},
+			expectedError: "invalid ROTATION_THRESHOLD/ROTATION_INTERVAL",
+		},
+		{
+			name: "spoke secret conflict policy",
+			env:  map[string]string{"SPOKE_SECRET_CONFLICT_POLICY": "suffix"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, conflictPolicySuffix, o.conflictPolicy)
+			},
+		},
+		{
+			name:          "invalid spoke secret conflict policy",
+			env:           map[string]string{"SPOKE_SECRET_CONFLICT_POLICY": "overwrite"},
+			expectedError: `invalid SPOKE_SECRET_CONFLICT_POLICY: unsupported conflict policy "overwrite"`,
+		},
+		{
+			name: "spoke secret oversize policy",
+			env:  map[string]string{"SPOKE_SECRET_OVERSIZE_POLICY": "split"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, oversizePolicySplit, o.oversizePolicy)
+			},
+		},
+		{
+			name:          "invalid spoke secret oversize policy",
+			env:           map[string]string{"SPOKE_SECRET_OVERSIZE_POLICY": "truncate"},
+			expectedError: `invalid SPOKE_SECRET_OVERSIZE_POLICY: unsupported oversize policy "truncate"`,
+		},
+		{
+			name: "spoke secret type",
+			env: map[string]string{
+				"SPOKE_SECRET_TYPE":        "kubernetes.io/basic-auth",
+				"SPOKE_SECRET_KEY_MAPPING": "git-provider-token=password, git-user=username",
+			},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, corev1.SecretTypeBasicAuth, o.secretType)
+				assert.DeepEqual(t, map[string]string{"git-provider-token": "password", "git-user": "username"}, o.secretKeyMapping)
+			},
+		},
+		{
+			name:          "invalid spoke secret type",
+			env:           map[string]string{"SPOKE_SECRET_TYPE": "kubernetes.io/git"},
+			expectedError: `invalid SPOKE_SECRET_TYPE: unsupported secret type "kubernetes.io/git"`,
+		},
+		{
+			name:          "spoke secret key mapped twice",
+			env:           map[string]string{"SPOKE_SECRET_KEY_MAPPING": "token=password,git-provider-token=password"},
+			expectedError: `invalid SPOKE_SECRET_KEY_MAPPING: invalid key mapping "git-provider-token=password", the keys can only be mapped once`,
+		},
+		{
+			name: "spoke cluster configs",
+			env:  map[string]string{"SPOKE_CLUSTER_CONFIG": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.spokeClusterConfig)
+			},
+		},
+		{
+			name: "secret sync policies",
+			env:  map[string]string{"SECRET_SYNC_POLICY": "true"},
+			validate: func(t *testing.T, o *options) {
+				assert.Assert(t, o.secretSyncPolicy)
+			},
+		},
+		{
+			name: "namespace secret quota",
+			env:  map[string]string{"NAMESPACE_SECRET_QUOTA_COUNT": "20", "NAMESPACE_SECRET_QUOTA_SIZE": "1Mi"},
+			validate: func(t *testing.T, o *options) {
+				assert.DeepEqual(t, secretQuotaOptions{maxCount: 20, maxBytes: 1 << 20}, o.secretQuota, cmp.AllowUnexported(secretQuotaOptions{}))
+			},
+		},
+		{
+			name:          "invalid namespace secret quota size",
+			env:           map[string]string{"NAMESPACE_SECRET_QUOTA_SIZE": "1 megabyte"},
+			expectedError: "invalid NAMESPACE_SECRET_QUOTA_SIZE",
+		},
+		{
+			name:          "negative namespace secret quota",
+			env:           map[string]string{"NAMESPACE_SECRET_QUOTA_COUNT": "-1"},
+			expectedError: "invalid NAMESPACE_SECRET_QUOTA_COUNT/NAMESPACE_SECRET_QUOTA_SIZE: must not be negative",
+		},
+		{
+			name:          "zero qps",
+			env:           map[string]string{"RATE_LIMIT_QPS": "0"},
+			expectedError: "invalid RATE_LIMIT_QPS/RATE_LIMIT_BURST",
+		},
+		{
+			name: "workload event coalesce window",
+			env:  map[string]string{"WORKLOAD_EVENT_COALESCE_WINDOW": "0"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, time.Duration(0), o.workloadEventCoalesceWindow)
+			},
+		},
+		{
+			name:          "negative workload event coalesce window",
+			env:           map[string]string{"WORKLOAD_EVENT_COALESCE_WINDOW": "-1s"},
+			expectedError: "invalid WORKLOAD_EVENT_COALESCE_WINDOW: must not be negative, got -1s",
+		},
+		{
+			name: "kueue informer resync",
+			env:  map[string]string{"KUEUE_INFORMER_RESYNC_PERIOD": "5m", "KUEUE_INFORMER_RESYNC_JITTER": "0.5"},
+			validate: func(t *testing.T, o *options) {
+				assert.Equal(t, 5*time.Minute, o.workloadResyncPeriod)
+				assert.Equal(t, 0.5, o.workloadResyncJitter)
+			},
+		},
+		{
+			name:          "negative kueue informer resync period",
+			env:           map[string]string{"KUEUE_INFORMER_RESYNC_PERIOD": "-5m"},
+			expectedError: "invalid KUEUE_INFORMER_RESYNC_PERIOD: must not be negative, got -5m0s",
+		},
+		{
+			name:          "negative kueue informer resync jitter",
+			env:           map[string]string{"KUEUE_INFORMER_RESYNC_JITTER": "-0.1"},
+			expectedError: "invalid KUEUE_INFORMER_RESYNC_JITTER: must not be negative, got -0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			o, err := optionsFromEnv()
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			tt.validate(t, o)
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	o := &options{
+		rateLimitBaseDelay: 10 * time.Millisecond,
+		rateLimitMaxDelay:  40 * time.Millisecond,
+		rateLimitQPS:       1000,
+		rateLimitBurst:     1000,
+	}
+	limiter := o.rateLimiter(nil)
+
+	assert.Equal(t, 10*time.Millisecond, limiter.When("key"))
+	assert.Equal(t, 20*time.Millisecond, limiter.When("key"))
+	assert.Equal(t, 40*time.Millisecond, limiter.When("key"))
+	assert.Equal(t, 40*time.Millisecond, limiter.When("key"))
+	assert.Equal(t, 4, limiter.NumRequeues("key"))
+
+	limiter.Forget("key")
+	assert.Equal(t, 10*time.Millisecond, limiter.When("key"))
+}
@@ -0,0 +1,147 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// Oversize policies, what happens to a secret whose data is over the size limit of the Secrets.
+const (
+	// oversizePolicyReject doesn't write the secret and fails the sync.
+	oversizePolicyReject = "reject"
+	// oversizePolicySplit writes the keys over the limit to additional secrets, see splitSecret.
+	oversizePolicySplit = "split"
+
+	// secretTooLargeReason is the reason of the Warning event recorded on the Workloads whose
+	// secret is over the size limit of the Secrets.
+	secretTooLargeReason = "SecretTooLarge"
+
+	// secretPartsAnnotation lists, comma separated, the additional secrets holding the keys of a
+	// secret split by the split policy.
+	secretPartsAnnotation = syncerGroupName + "/parts"
+	// secretPartSuffix and the number of the part are appended to the name of the parts.
+	secretPartSuffix = "-part-"
+)
+
+// parseOversizePolicy validates the SPOKE_SECRET_OVERSIZE_POLICY value, empty defaults to reject.
+func parseOversizePolicy(value string) (string, error) {
+	switch value {
+	case "":
+		return oversizePolicyReject, nil
+	case oversizePolicyReject, oversizePolicySplit:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported oversize policy %q, must be one of %s, %s", value, oversizePolicyReject, oversizePolicySplit)
+	}
+}
+
+// secretValuesSize returns the size of the values of the secret, which the API server limits to
+// corev1.MaxSecretSize.
+func secretValuesSize(secret *corev1.Secret) int {
+	var size int
+	for _, value := range secret.Data {
+		size += len(value)
+	}
+	for _, value := range secret.StringData {
+		size += len(value)
+	}
+	return size
+}
+
+// splitSecret splits the keys of the secret, in order, between the secret and as few additional
+// secrets as possible, each within the limit. The parts are named after the secret, which lists
+// them in its secretPartsAnnotation. A single value over the limit can't be split.
+func splitSecret(secret *corev1.Secret, limit int) (*corev1.Secret, []*corev1.Secret, error) {
+	keys := make([]string, 0, len(secret.Data))
+	for key, value := range secret.Data {
+		if len(value) > limit {
+			return nil, nil, syncer.Classify(fmt.Errorf("key %s of secret %s/%s has %d bytes, over the limit of %d bytes of a Secret", key, secret.Namespace, secret.Name, len(value), limit), ErrSecretTooLarge)
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var chunks []map[string][]byte
+	size := 0
+	for _, key := range keys {
+		value := secret.Data[key]
+		if len(chunks) == 0 || size+len(value) > limit {
+			chunks = append(chunks, map[string][]byte{})
+			size = 0
+		}
+		chunks[len(chunks)-1][key] = value
+		size += len(value)
+	}
+
+	main := secret.DeepCopy()
+	main.Data = chunks[0]
+	parts := make([]*corev1.Secret, 0, len(chunks)-1)
+	names := make([]string, 0, len(chunks)-1)
+	for i, data := range chunks[1:] {
+		part := secret.DeepCopy()
+		part.Name = fmt.Sprintf("%s%s%d", secret.Name, secretPartSuffix, i+1)
+		part.Data = data
+		parts = append(parts, part)
+		names = append(names, part.Name)
+	}
+	if main.Annotations == nil {
+		main.Annotations = map[string]string{}
+	}
+	main.Annotations[secretPartsAnnotation] = strings.Join(names, ",")
+	return main, parts, nil
+}
+
+// writeOversizeSecret writes a secret over the size limit of the Secrets according to the
+// oversize policy of hubNamespace, the namespace of its Workload: rejected before it reaches the
+// spoke API server, or split with its parts written first. Only the Data of the secrets is split.
+func (r *Reconciler) writeOversizeSecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, hubNamespace string, newSecret *corev1.Secret, event auditEvent) (string, time.Time, error) {
+	size := secretValuesSize(newSecret)
+	if r.namespaceOversizePolicy(ctx, hubNamespace) != oversizePolicySplit || len(newSecret.StringData) > 0 {
+		err := syncer.Classify(fmt.Errorf("secret %s/%s has %d bytes of data, over the limit of %d bytes of a Secret", newSecret.Namespace, newSecret.Name, size, corev1.MaxSecretSize), ErrSecretTooLarge)
+		r.logger.Errorf("not syncing secret %s/%s to spoke cluster %s: %v", newSecret.Namespace, newSecret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	}
+
+	main, parts, err := splitSecret(newSecret, corev1.MaxSecretSize)
+	if err != nil {
+		r.logger.Errorf("not syncing secret %s/%s to spoke cluster %s: %v", newSecret.Namespace, newSecret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	}
+	r.logger.Infof("secret %s/%s has %d bytes of data, syncing it split in %d secrets to spoke cluster %s", newSecret.Namespace, newSecret.Name, size, len(parts)+1, clusterName)
+	for _, part := range parts {
+		partEvent := event
+		partEvent.Secret = part.Namespace + "/" + part.Name
+		if _, _, err := r.applySpokeSecret(ctx, clusterName, spokeKubeClient, hubNamespace, part, partEvent.withContent(part)); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	return r.applySpokeSecret(ctx, clusterName, spokeKubeClient, hubNamespace, main, event.withContent(main))
+}
+
+// deleteSecretParts deletes the parts of the existing spoke secret of the ref, when it was split,
+// for the same reason as the secret.
+func (r *Reconciler) deleteSecretParts(ctx context.Context, spokeKubeClient kubernetes.Interface, existing *corev1.Secret, ref syncedSecretRef, workloadKey, reason string) error {
+	if !isManagedSpokeSecret(existing) || existing.Annotations[workloadAnnotation] != workloadKey || existing.Annotations[secretPartsAnnotation] == "" {
+		return nil
+	}
+	for _, name := range strings.Split(existing.Annotations[secretPartsAnnotation], ",") {
+		part := ref
+		part.Name = name
+		if err := r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, part, workloadKey, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
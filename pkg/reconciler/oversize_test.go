@@ -0,0 +1,90 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSplitSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"},
+		Data: map[string][]byte{
+			"a": bytes.Repeat([]byte("a"), 6),
+			"b": bytes.Repeat([]byte("b"), 3),
+			"c": bytes.Repeat([]byte("c"), 5),
+			"d": bytes.Repeat([]byte("d"), 2),
+		},
+	}
+
+	main, parts, err := splitSecret(secret, 10)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string][]byte{"a": secret.Data["a"], "b": secret.Data["b"]}, main.Data)
+	assert.Equal(t, "git-auth-part-1", main.Annotations[secretPartsAnnotation])
+	assert.Equal(t, 1, len(parts))
+	assert.Equal(t, "git-auth-part-1", parts[0].Name)
+	assert.DeepEqual(t, map[string][]byte{"c": secret.Data["c"], "d": secret.Data["d"]}, parts[0].Data)
+	assert.Equal(t, 4, len(secret.Data), "the secret is left untouched")
+
+	// A single value over the limit can't be split
+	_, _, err = splitSecret(secret, 5)
+	assert.ErrorIs(t, err, ErrSecretTooLarge)
+	assert.ErrorContains(t, err, "key a of secret test-namespace/git-auth has 6 bytes, over the limit of 5 bytes of a Secret")
+}
+
+func TestWriteOversizeSecret(t *testing.T) {
+	ctx := context.Background()
+	oversize := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "ca-bundle",
+				Namespace:   "test-namespace",
+				Labels:      map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload"},
+			},
+			Data: map[string][]byte{
+				"bundle.pem": bytes.Repeat([]byte("a"), corev1.MaxSecretSize/2+1),
+				"extra.pem":  bytes.Repeat([]byte("b"), corev1.MaxSecretSize/2+1),
+			},
+		}
+	}
+	event := auditEvent{Action: auditActionSync, Cluster: testClusterName, Secret: "test-namespace/ca-bundle", Workload: "test-namespace/test-workload"}
+
+	// The reject policy fails before the spoke API server is called
+	spokeKubeClient := fake.NewSimpleClientset()
+	recorder := record.NewFakeRecorder(1)
+	r := &Reconciler{logger: zap.NewNop().Sugar(), oversizePolicy: oversizePolicyReject, recorder: recorder}
+	_, _, err := r.writeSpokeSecret(ctx, testClusterName, spokeKubeClient, "test-namespace", oversize(), event)
+	assert.ErrorIs(t, err, ErrSecretTooLarge)
+	assert.Equal(t, 0, len(spokeKubeClient.Actions()))
+	assert.ErrorContains(t, r.rejectionError(dispatchedWorkload(nil), err), "over the limit of 1048576 bytes of a Secret")
+	assert.Assert(t, strings.HasPrefix(<-recorder.Events, "Warning SecretTooLarge Not syncing secrets: secret test-namespace/ca-bundle has"))
+
+	// The split policy writes the keys over the limit to a part
+	r.oversizePolicy = oversizePolicySplit
+	name, _, err := r.writeSpokeSecret(ctx, testClusterName, spokeKubeClient, "test-namespace", oversize(), event)
+	assert.NilError(t, err)
+	assert.Equal(t, "ca-bundle", name)
+	main, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "ca-bundle", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "ca-bundle-part-1", main.Annotations[secretPartsAnnotation])
+	assert.Equal(t, 1, len(main.Data))
+	part, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "ca-bundle-part-1", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(part.Data))
+
+	// The parts are deleted with the secret, whichever path deletes it
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "ca-bundle"}
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "hub secret revoked"))
+	secrets, err := spokeKubeClient.CoreV1().Secrets("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(secrets.Items))
+}
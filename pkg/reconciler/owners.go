@@ -0,0 +1,174 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// maxOwnerTraversalDepth bounds OWNER_TRAVERSAL_DEPTH, each intermediate owner is read from
+	// the hub once per intermediateOwnerTTL.
+	maxOwnerTraversalDepth = 5
+
+	// intermediateOwnerTTL is how long the controller of an intermediate owner is remembered. The
+	// controller of an object seldom changes, an owner recreated under the same name has a new UID.
+	intermediateOwnerTTL = 5 * time.Minute
+)
+
+// ownerTraversal resolves the PipelineRun of the Workloads created by dispatchers which own them
+// through intermediate objects, themselves owned by the PipelineRun. The zero ownerTraversal
+// only accepts the Workloads owned by a PipelineRun directly.
+type ownerTraversal struct {
+	// depth is the number of intermediate owners followed from the Workload to its PipelineRun.
+	depth int
+	// kinds are the kinds of the intermediate owners followed.
+	kinds []schema.GroupKind
+}
+
+// parseOwnerKinds parses a comma separated list of Kind.group, e.g. TaskGroup.example.com, the
+// kinds of the core group have no group.
+func parseOwnerKinds(value string) ([]schema.GroupKind, error) {
+	var kinds []schema.GroupKind
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		groupKind := schema.ParseGroupKind(kind)
+		if groupKind.Kind == "" || groupKind.Kind == "PipelineRun" {
+			return nil, fmt.Errorf("invalid owner kind %q, must be the Kind.group of an intermediate owner", kind)
+		}
+		kinds = append(kinds, groupKind)
+	}
+	return kinds, nil
+}
+
+// follows reports whether the owner is an intermediate owner the traversal follows.
+func (t ownerTraversal) follows(owner *metav1.OwnerReference) bool {
+	if t.depth == 0 || owner == nil {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(t.kinds, schema.GroupKind{Group: gv.Group, Kind: owner.Kind})
+}
+
+// pipelineRunOwner returns the controller of the Workload, following its intermediate owners to
+// their PipelineRun. The last owner reached is returned when the chain doesn't lead to a
+// PipelineRun within the depth, or one of its objects no longer exists. Every lookup of the
+// PipelineRun of a Workload goes through it, so the controllers resolve the same owner; the
+// controllers of the intermediate owners are read from the intermediateOwners cache.
+func (r *Reconciler) pipelineRunOwner(ctx context.Context, workload metav1.Object) (*metav1.OwnerReference, error) {
+	owner := metav1.GetControllerOf(workload)
+	for hops := 0; owner != nil && owner.Kind != "PipelineRun"; hops++ {
+		if hops >= r.queues.owners.depth || !r.queues.owners.follows(owner) {
+			return owner, nil
+		}
+		controller, ok := r.intermediateOwners.get(owner.UID)
+		if ok {
+			owner = controller
+			continue
+		}
+		object, err := r.getOwner(ctx, workload.GetNamespace(), owner)
+		if apierrors.IsNotFound(err) {
+			return owner, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get owner %s %s of workload %s/%s: %w", owner.Kind, owner.Name, workload.GetNamespace(), workload.GetName(), err)
+		}
+		controller = metav1.GetControllerOf(object)
+		r.intermediateOwners.set(owner.UID, controller)
+		owner = controller
+	}
+	return owner, nil
+}
+
+// intermediateOwners remembers the controllers of the intermediate owners by UID for
+// intermediateOwnerTTL, so the Workloads of an owner, and the reconciles of a Workload, don't
+// read its chain from the hub again. A nil intermediateOwners remembers none.
+type intermediateOwners struct {
+	// now is overridden in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	controllers map[types.UID]intermediateOwner
+}
+
+// intermediateOwner is the controller of an intermediate owner, nil when it has none.
+type intermediateOwner struct {
+	controller *metav1.OwnerReference
+	fetchedAt  time.Time
+}
+
+func newIntermediateOwners() *intermediateOwners {
+	return &intermediateOwners{now: time.Now, controllers: map[types.UID]intermediateOwner{}}
+}
+
+func (o *intermediateOwners) get(uid types.UID) (*metav1.OwnerReference, bool) {
+	if o == nil || uid == "" {
+		return nil, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	owner, ok := o.controllers[uid]
+	if !ok || o.now().Sub(owner.fetchedAt) >= intermediateOwnerTTL {
+		return nil, false
+	}
+	return owner.controller, true
+}
+
+// set remembers the controller of the intermediate owner, and drops the expired ones.
+func (o *intermediateOwners) set(uid types.UID, controller *metav1.OwnerReference) {
+	if o == nil || uid == "" {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	for cached, owner := range o.controllers {
+		if now.Sub(owner.fetchedAt) >= intermediateOwnerTTL {
+			delete(o.controllers, cached)
+		}
+	}
+	o.controllers[uid] = intermediateOwner{controller: controller, fetchedAt: now}
+}
+
+// getOwner reads the owner from the hub, in the namespace of the owned object when the owner is
+// namespaced. An object recreated under the name of the owner is not found.
+func (r *Reconciler) getOwner(ctx context.Context, namespace string, owner *metav1.OwnerReference) (metav1.Object, error) {
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := r.ownerMapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: owner.Kind}, gv.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := r.hubDynamicClient.Resource(mapping.Resource)
+	var object metav1.Object
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		object, err = resource.Namespace(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	} else {
+		object, err = resource.Get(ctx, owner.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if owner.UID != "" && object.GetUID() != owner.UID {
+		return nil, apierrors.NewNotFound(mapping.Resource.GroupResource(), owner.Name)
+	}
+	return object, nil
+}
@@ -0,0 +1,173 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+var (
+	testTaskGroupGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "TaskGroup"}
+	testTaskGroupGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "taskgroups"}
+)
+
+func testOwnerReference(gvk schema.GroupVersionKind, name, uid string) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: name, UID: types.UID(uid), Controller: ptr.To(true)}
+}
+
+func testTaskGroup(name, uid string, owner metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(testTaskGroupGVK)
+	obj.SetName(name)
+	obj.SetNamespace("test-namespace")
+	obj.SetUID(types.UID(uid))
+	obj.SetOwnerReferences([]metav1.OwnerReference{owner})
+	return obj
+}
+
+func TestWorkloadQueueFilterOwned(t *testing.T) {
+	traversal := workloadQueueFilter{owners: ownerTraversal{depth: 1, kinds: []schema.GroupKind{testTaskGroupGVK.GroupKind()}}}
+	indirect := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+		Name:            "test-workload",
+		Namespace:       "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{testOwnerReference(testTaskGroupGVK, "test-group", "group-uid")},
+	}}
+	job := indirect.DeepCopy()
+	job.OwnerReferences = []metav1.OwnerReference{testOwnerReference(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, "test-job", "job-uid")}
+
+	assert.Assert(t, workloadQueueFilter{}.owned(pipelineRunOwnedWorkload("test-namespace", "test-workload")))
+	assert.Assert(t, !workloadQueueFilter{}.owned(indirect), "intermediate owners are only followed with OWNER_TRAVERSAL_DEPTH")
+	assert.Assert(t, traversal.owned(indirect))
+	assert.Assert(t, !traversal.owned(job))
+}
+
+func TestPipelineRunOwner(t *testing.T) {
+	pipelineRun := testOwnerReference(schema.GroupVersionKind{Group: "tekton.dev", Version: "v1", Kind: "PipelineRun"}, "test-pipeline-run", "pipelinerun-uid")
+	inner := testOwnerReference(testTaskGroupGVK, "inner-group", "inner-uid")
+	outer := testOwnerReference(testTaskGroupGVK, "outer-group", "outer-uid")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{testTaskGroupGVR: "TaskGroupList"},
+		testTaskGroup("outer-group", "outer-uid", pipelineRun),
+		testTaskGroup("inner-group", "inner-uid", outer),
+		testTaskGroup("recreated-group", "new-uid", pipelineRun),
+	)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(testTaskGroupGVK, meta.RESTScopeNamespace)
+
+	tests := []struct {
+		name     string
+		depth    int
+		owner    metav1.OwnerReference
+		expected *metav1.OwnerReference
+	}{
+		{
+			name:     "owned by the PipelineRun",
+			owner:    pipelineRun,
+			expected: &pipelineRun,
+		},
+		{
+			name:     "owned through an intermediate owner",
+			depth:    1,
+			owner:    outer,
+			expected: &pipelineRun,
+		},
+		{
+			name:     "owned through two intermediate owners",
+			depth:    2,
+			owner:    inner,
+			expected: &pipelineRun,
+		},
+		{
+			name:     "deeper than the traversal",
+			depth:    1,
+			owner:    inner,
+			expected: &outer,
+		},
+		{
+			name:     "traversal disabled",
+			owner:    outer,
+			expected: &outer,
+		},
+		{
+			name:     "deleted intermediate owner",
+			depth:    1,
+			owner:    testOwnerReference(testTaskGroupGVK, "deleted-group", "deleted-uid"),
+			expected: ptr.To(testOwnerReference(testTaskGroupGVK, "deleted-group", "deleted-uid")),
+		},
+		{
+			name:     "recreated intermediate owner",
+			depth:    1,
+			owner:    testOwnerReference(testTaskGroupGVK, "recreated-group", "old-uid"),
+			expected: ptr.To(testOwnerReference(testTaskGroupGVK, "recreated-group", "old-uid")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{
+				hubDynamicClient: client,
+				ownerMapper:      mapper,
+				queues:           workloadQueueFilter{owners: ownerTraversal{depth: tt.depth, kinds: []schema.GroupKind{testTaskGroupGVK.GroupKind()}}},
+			}
+			workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-workload",
+				Namespace:       "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{tt.owner},
+			}}
+			owner, err := r.pipelineRunOwner(context.Background(), workload)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, owner)
+		})
+	}
+}
+
+func TestPipelineRunOwnerCached(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := testOwnerReference(schema.GroupVersionKind{Group: "tekton.dev", Version: "v1", Kind: "PipelineRun"}, "test-pipeline-run", "pipelinerun-uid")
+	group := testOwnerReference(testTaskGroupGVK, "test-group", "group-uid")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{testTaskGroupGVR: "TaskGroupList"},
+		testTaskGroup("test-group", "group-uid", pipelineRun),
+	)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(testTaskGroupGVK, meta.RESTScopeNamespace)
+	owners := newIntermediateOwners()
+	now := time.Now()
+	owners.now = func() time.Time { return now }
+	r := &Reconciler{
+		hubDynamicClient:   client,
+		ownerMapper:        mapper,
+		intermediateOwners: owners,
+		queues:             workloadQueueFilter{owners: ownerTraversal{depth: 1, kinds: []schema.GroupKind{testTaskGroupGVK.GroupKind()}}},
+	}
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+		Name:            "test-workload",
+		Namespace:       "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{group},
+	}}
+
+	owner, err := r.pipelineRunOwner(ctx, workload)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &pipelineRun, owner)
+
+	// The controller of the intermediate owner is not read again from the hub
+	assert.NilError(t, client.Resource(testTaskGroupGVR).Namespace("test-namespace").Delete(ctx, "test-group", metav1.DeleteOptions{}))
+	owner, err = r.pipelineRunOwner(ctx, workload)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &pipelineRun, owner)
+
+	// Until it expires
+	now = now.Add(intermediateOwnerTTL)
+	owner, err = r.pipelineRunOwner(ctx, workload)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &group, owner)
+}
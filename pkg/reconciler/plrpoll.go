@@ -0,0 +1,57 @@
+package reconciler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// spokePipelineRunMaxPollInterval bounds the delay between the polls of a Workload waiting for
+	// its spoke PipelineRun, doubled from spokePipelineRunPollInterval on each poll.
+	spokePipelineRunMaxPollInterval = 2 * time.Minute
+
+	// spokePipelineRunMaxPolls is how many times a Workload is polled for its spoke PipelineRun,
+	// about half an hour, before it waits for its next event instead.
+	spokePipelineRunMaxPolls = 20
+)
+
+// spokePipelineRunPolls counts the polls of each Workload key waiting for its spoke PipelineRun,
+// so the polls back off and stop once MultiKueue never created it, e.g. for a spoke cluster
+// rejecting it. A nil spokePipelineRunPolls polls every spokePipelineRunPollInterval forever.
+type spokePipelineRunPolls struct {
+	mu    sync.Mutex
+	polls map[string]int
+}
+
+func newSpokePipelineRunPolls() *spokePipelineRunPolls {
+	return &spokePipelineRunPolls{polls: map[string]int{}}
+}
+
+// next returns the delay of the next poll of the key, and false once the key was polled
+// spokePipelineRunMaxPolls times, in which case its count is cleared for its next event to poll
+// it again.
+func (p *spokePipelineRunPolls) next(key string) (time.Duration, bool) {
+	if p == nil {
+		return spokePipelineRunPollInterval, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	polls := p.polls[key]
+	if polls >= spokePipelineRunMaxPolls {
+		delete(p.polls, key)
+		return 0, false
+	}
+	p.polls[key] = polls + 1
+	// The shift is bounded, the delay reaches the maximum after a few polls
+	return min(spokePipelineRunPollInterval<<min(polls, 10), spokePipelineRunMaxPollInterval), true
+}
+
+// clear forgets the polls of the key, once its spoke PipelineRun showed up or it is deleted.
+func (p *spokePipelineRunPolls) clear(key string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.polls, key)
+}
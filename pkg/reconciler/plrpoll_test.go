@@ -0,0 +1,48 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSpokePipelineRunPolls(t *testing.T) {
+	polls := newSpokePipelineRunPolls()
+
+	var delays []time.Duration
+	for range spokePipelineRunMaxPolls {
+		delay, ok := polls.next("test-namespace/test-workload")
+		assert.Assert(t, ok)
+		delays = append(delays, delay)
+	}
+	assert.DeepEqual(t, []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}, delays[:5])
+	for _, delay := range delays[5:] {
+		assert.Equal(t, spokePipelineRunMaxPollInterval, delay)
+	}
+
+	// The polls stop once the limit is reached, then start over on the next event
+	_, ok := polls.next("test-namespace/test-workload")
+	assert.Assert(t, !ok)
+	delay, ok := polls.next("test-namespace/test-workload")
+	assert.Assert(t, ok)
+	assert.Equal(t, spokePipelineRunPollInterval, delay)
+
+	// The other Workloads have their own polls
+	delay, ok = polls.next("test-namespace/other-workload")
+	assert.Assert(t, ok)
+	assert.Equal(t, spokePipelineRunPollInterval, delay)
+
+	// A found spoke PipelineRun clears them
+	polls.next("test-namespace/test-workload")
+	polls.clear("test-namespace/test-workload")
+	delay, _ = polls.next("test-namespace/test-workload")
+	assert.Equal(t, spokePipelineRunPollInterval, delay)
+
+	// A nil spokePipelineRunPolls never stops polling
+	var disabled *spokePipelineRunPolls
+	delay, ok = disabled.next("test-namespace/test-workload")
+	assert.Assert(t, ok)
+	assert.Equal(t, spokePipelineRunPollInterval, delay)
+	disabled.clear("test-namespace/test-workload")
+}
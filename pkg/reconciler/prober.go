@@ -0,0 +1,201 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// defaultSpokeProbeInterval is how often the reachable spoke clusters are probed.
+	defaultSpokeProbeInterval = 30 * time.Second
+	// defaultSpokeProbeMaxInterval bounds the backoff of the probes of an unreachable cluster.
+	defaultSpokeProbeMaxInterval = 5 * time.Minute
+)
+
+// spokeProbes caches whether the API server of each known spoke cluster answers, as found by a
+// background prober, so the reconciles of Workloads dispatched to a cluster known to be down are
+// requeued right away instead of each waiting for their spoke requests to time out. A nil
+// spokeProbes considers every spoke cluster reachable.
+type spokeProbes struct {
+	// interval is how often a reachable cluster is probed, doubled after every failed probe of
+	// an unreachable one up to maxInterval
+	interval    time.Duration
+	maxInterval time.Duration
+	// now and probe are overridden in tests
+	now   func() time.Time
+	probe func(ctx context.Context, clusterName string) error
+
+	mu     sync.Mutex
+	probes map[string]*spokeProbe
+}
+
+// spokeProbe is the outcome of the last probe of a spoke cluster.
+type spokeProbe struct {
+	reachable bool
+	// failures is the number of consecutive failed probes
+	failures int
+	// next is when the cluster is probed again
+	next time.Time
+}
+
+func newSpokeProbes(interval, maxInterval time.Duration) *spokeProbes {
+	return &spokeProbes{
+		interval:    interval,
+		maxInterval: max(interval, maxInterval),
+		now:         time.Now,
+		probes:      map[string]*spokeProbe{},
+	}
+}
+
+// down reports whether the last probe of the cluster failed, with how long to wait for its
+// next probe. Clusters not probed yet are considered reachable.
+func (p *spokeProbes) down(cluster string) (time.Duration, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	probe, ok := p.probes[cluster]
+	if !ok || probe.reachable {
+		return 0, false
+	}
+	return wait.Jitter(max(probe.next.Sub(p.now()), busyRequeueDelay), 0.1), true
+}
+
+// due reports whether the cluster must be probed.
+func (p *spokeProbes) due(cluster string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	probe, ok := p.probes[cluster]
+	return !ok || !p.now().Before(probe.next)
+}
+
+// observe records the outcome of a probe and schedules the next one, backing off exponentially
+// while the cluster stays unreachable. It returns whether the reachability of the cluster
+// changed.
+func (p *spokeProbes) observe(ctx context.Context, cluster string, err error) bool {
+	p.mu.Lock()
+	probe, ok := p.probes[cluster]
+	if !ok {
+		probe = &spokeProbe{reachable: true}
+		p.probes[cluster] = probe
+	}
+	wasReachable := probe.reachable
+	probe.reachable = !isSpokeUnavailable(err)
+	interval := p.interval
+	if probe.reachable {
+		probe.failures = 0
+	} else {
+		probe.failures++
+		for i := 1; i < probe.failures && interval < p.maxInterval; i++ {
+			interval *= 2
+		}
+		interval = min(interval, p.maxInterval)
+	}
+	probe.next = p.now().Add(interval)
+	reachable := probe.reachable
+	p.mu.Unlock()
+
+	recordClusterReachable(ctx, cluster, reachable)
+	return wasReachable != reachable
+}
+
+// retain forgets the clusters which are no longer known.
+func (p *spokeProbes) retain(clusters map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for cluster := range p.probes {
+		if !clusters[cluster] {
+			delete(p.probes, cluster)
+		}
+	}
+}
+
+// runSpokeProber probes the known spoke clusters in the background until the context is done.
+func (r *Reconciler) runSpokeProber(ctx context.Context, enqueue func(types.NamespacedName)) {
+	wait.JitterUntilWithContext(ctx, func(ctx context.Context) { r.probeSpokes(ctx, enqueue) }, r.spokeProbes.interval, 0.1, true)
+}
+
+// probeSpokes probes, concurrently, every MultiKueueCluster whose next probe is due. The
+// Workloads dispatched to a cluster which is reachable again are enqueued, rather than waiting
+// for their requeue.
+func (r *Reconciler) probeSpokes(ctx context.Context, enqueue func(types.NamespacedName)) {
+	clusters, err := r.multiKueueClusterNames(ctx)
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters for the spoke probes: %v", err)
+		return
+	}
+	r.spokeProbes.retain(clusters)
+
+	var wg sync.WaitGroup
+	for cluster := range clusters {
+		if !r.spokeProbes.due(cluster) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := r.probeSpokeCluster(ctx, cluster)
+			if stderrors.Is(err, errSpokeProbeSkipped) {
+				r.logger.Debugf("not probing spoke cluster %s: %v", cluster, err)
+				return
+			}
+			if !r.spokeProbes.observe(ctx, cluster, err) {
+				return
+			}
+			if err != nil {
+				r.logger.Warnf("spoke cluster %s is unreachable, requeuing its Workloads until it answers: %v", cluster, err)
+				return
+			}
+			workloads := r.clusterWorkloads.of(cluster)
+			r.logger.Infof("spoke cluster %s is reachable again, resyncing its %d Workloads", cluster, len(workloads))
+			for _, key := range workloads {
+				enqueue(key)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// multiKueueClusterNames returns the names of the MultiKueueClusters, from the cache when there
+// is one.
+func (r *Reconciler) multiKueueClusterNames(ctx context.Context) (map[string]bool, error) {
+	clusters, err := r.multiKueueClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, cluster := range clusters {
+		names[cluster.Name] = true
+	}
+	return names, nil
+}
+
+// errSpokeProbeSkipped is returned when the clients of a spoke cluster can't be created, e.g.
+// a missing kubeconfig. Its reconciles then fail with that error rather than being requeued.
+var errSpokeProbeSkipped = stderrors.New("no spoke clients")
+
+// probeSpokeCluster calls the /healthz endpoint of the spoke API server. Errors which are
+// regular answers of the API server, e.g. Forbidden, still mean it is reachable.
+func (r *Reconciler) probeSpokeCluster(ctx context.Context, clusterName string) error {
+	if r.spokeProbes.probe != nil {
+		return r.spokeProbes.probe(ctx, clusterName)
+	}
+
+	spokeKubeClient, _, err := r.getSpokeClients(ctx, clusterName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSpokeProbeSkipped, err)
+	}
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+	if err := spokeKubeClient.Discovery().RESTClient().Get().AbsPath("/healthz").Do(spokeCtx).Error(); err != nil {
+		return fmt.Errorf("could not probe spoke cluster %s: %w", clusterName, spokeError(err))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/metrics"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestSpokeProbesBackoff(t *testing.T) {
+	metrics.InitForTesting()
+	ctx := context.Background()
+	now := time.Now()
+	probes := newSpokeProbes(10*time.Second, time.Minute)
+	probes.now = func() time.Time { return now }
+	unavailable := errors.NewServiceUnavailable("spoke is down")
+
+	_, down := probes.down("cluster-1")
+	assert.Assert(t, !down, "clusters not probed yet are reachable")
+	assert.Assert(t, probes.due("cluster-1"))
+
+	// The interval doubles with every failed probe, up to the max interval
+	for _, expected := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		probes.observe(ctx, "cluster-1", unavailable)
+		retryAfter, down := probes.down("cluster-1")
+		assert.Assert(t, down)
+		assert.Assert(t, retryAfter >= expected && retryAfter <= expected+expected/10, "expected %s, got %s", expected, retryAfter)
+		assert.Assert(t, !probes.due("cluster-1"))
+		now = now.Add(expected)
+		assert.Assert(t, probes.due("cluster-1"))
+	}
+
+	// Regular answers of the API server mean it is reachable
+	assert.Assert(t, probes.observe(ctx, "cluster-1", errors.NewForbidden(schema.GroupResource{}, "healthz", fmt.Errorf("forbidden"))))
+	_, down = probes.down("cluster-1")
+	assert.Assert(t, !down)
+	assert.Assert(t, !probes.observe(ctx, "cluster-1", nil), "reachability didn't change")
+
+	// The next failure starts over from the interval
+	probes.observe(ctx, "cluster-1", unavailable)
+	retryAfter, _ := probes.down("cluster-1")
+	assert.Assert(t, retryAfter < 20*time.Second, "unexpected %s", retryAfter)
+
+	// Other clusters are unaffected
+	_, down = probes.down("cluster-2")
+	assert.Assert(t, !down)
+	var nilProbes *spokeProbes
+	_, down = nilProbes.down("cluster-1")
+	assert.Assert(t, !down)
+}
+
+func TestProbeSpokes(t *testing.T) {
+	metrics.InitForTesting()
+	ctx := context.Background()
+	kueueClient := kueuefake.NewSimpleClientset(
+		&kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: "spoke-up"}},
+		&kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: "spoke-down"}},
+		&kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: "spoke-unconfigured"}},
+	)
+	workloads := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{clusterNameIndex: workloadQueueFilter{}.clusterNameIndexFunc})
+	dispatched := pipelineRunOwnedWorkload("test-namespace", "dispatched-workload")
+	dispatched.Status.ClusterName = ptr.To("spoke-down")
+	assert.NilError(t, workloads.Add(dispatched))
+	r := &Reconciler{
+		logger:           zap.NewNop().Sugar(),
+		kueueClient:      kueueClient,
+		spokeProbes:      newSpokeProbes(time.Minute, time.Hour),
+		clusterWorkloads: &clusterWorkloads{indexers: []cache.Indexer{workloads}},
+	}
+	now := time.Now()
+	r.spokeProbes.now = func() time.Time { return now }
+	// The clusters are probed concurrently
+	var mu sync.Mutex
+	probed := map[string]int{}
+	spokeDown := true
+	r.spokeProbes.probe = func(_ context.Context, clusterName string) error {
+		mu.Lock()
+		probed[clusterName]++
+		mu.Unlock()
+		switch clusterName {
+		case "spoke-down":
+			if !spokeDown {
+				return nil
+			}
+			return fmt.Errorf("could not probe spoke cluster %s: %w", clusterName, errors.NewServiceUnavailable("spoke is down"))
+		case "spoke-unconfigured":
+			return fmt.Errorf("%w: kubeconfig secret not found", errSpokeProbeSkipped)
+		}
+		return nil
+	}
+	var enqueued []types.NamespacedName
+	enqueue := func(key types.NamespacedName) { enqueued = append(enqueued, key) }
+
+	r.probeSpokes(ctx, enqueue)
+	assert.DeepEqual(t, map[string]int{"spoke-up": 1, "spoke-down": 1, "spoke-unconfigured": 1}, probed)
+	_, down := r.spokeProbes.down("spoke-down")
+	assert.Assert(t, down)
+	_, down = r.spokeProbes.down("spoke-up")
+	assert.Assert(t, !down)
+
+	// The clusters are only probed again once due, the ones which couldn't be probed right away
+	r.probeSpokes(ctx, enqueue)
+	assert.DeepEqual(t, map[string]int{"spoke-up": 1, "spoke-down": 1, "spoke-unconfigured": 2}, probed)
+	assert.Assert(t, enqueued == nil)
+
+	// The Workloads dispatched to a cluster reachable again are enqueued
+	spokeDown = false
+	now = now.Add(time.Minute)
+	r.probeSpokes(ctx, enqueue)
+	_, down = r.spokeProbes.down("spoke-down")
+	assert.Assert(t, !down)
+	assert.DeepEqual(t, []types.NamespacedName{{Namespace: "test-namespace", Name: "dispatched-workload"}}, enqueued)
+
+	// Deleted clusters are forgotten
+	assert.NilError(t, kueueClient.KueueV1beta1().MultiKueueClusters().Delete(ctx, "spoke-down", metav1.DeleteOptions{}))
+	r.probeSpokes(ctx, enqueue)
+	_, down = r.spokeProbes.down("spoke-down")
+	assert.Assert(t, !down)
+}
+
+func TestReconcileUnreachableSpoke(t *testing.T) {
+	metrics.InitForTesting()
+	r := &Reconciler{logger: zap.NewNop().Sugar(), spokeProbes: newSpokeProbes(time.Minute, time.Hour)}
+	r.spokeProbes.observe(context.Background(), testClusterName, errors.NewServiceUnavailable("spoke is down"))
+	workload := pipelineRunOwnedWorkload("test-namespace", "test-workload")
+	workload.OwnerReferences[0].Controller = ptr.To(true)
+	workload.Status.ClusterName = ptr.To(testClusterName)
+
+	// Requeued until the next probe, without creating spoke clients
+	ok, delay := controller.IsRequeueKey(r.reconcile(context.Background(), workload))
+	assert.Assert(t, ok, "expected a requeue")
+	assert.Assert(t, delay >= 59*time.Second && delay <= 66*time.Second, "unexpected delay %s", delay)
+}
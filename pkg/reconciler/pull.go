@@ -0,0 +1,244 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// pullAPIPath is where the spoke agents pull the secret of a PipelineRun, they post the
+	// spoke PipelineRun and get the Secret to create for it.
+	pullAPIPath = "/v1/secrets"
+	// pullAPIAudience is the audience of the hub ServiceAccount tokens the agents authenticate with.
+	pullAPIAudience = "secret-syncer"
+
+	// maxPullRequestSize bounds the PipelineRun posted by an agent.
+	maxPullRequestSize = 1 << 20
+)
+
+// pullAPIOptions configures the API the spoke agents pull secrets from.
+type pullAPIOptions struct {
+	// port serving the API, 0 disables it
+	port int
+	// certFile and keyFile hold the TLS serving certificate
+	certFile string
+	keyFile  string
+	// agentNamespace holds the hub ServiceAccounts of the agents, each named after the
+	// MultiKueueCluster of its spoke
+	agentNamespace string
+}
+
+// pullError is an error answered to an agent with its HTTP status.
+type pullError struct {
+	status int
+	err    error
+}
+
+func (e *pullError) Error() string { return e.err.Error() }
+
+func (e *pullError) Unwrap() error { return e.err }
+
+func newPullError(status int, format string, args ...any) *pullError {
+	return &pullError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// pullHandler returns the HTTP handler serving the secrets to the spoke agents, while the
+// featurePullAgent gate is enabled.
+func (r *Reconciler) pullHandler(agentNamespace string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+pullAPIPath, func(w http.ResponseWriter, req *http.Request) {
+		if !r.features.isEnabled(featurePullAgent) {
+			http.Error(w, fmt.Sprintf("the %s feature gate is disabled", featurePullAgent), http.StatusServiceUnavailable)
+			return
+		}
+
+		secret, err := r.pullSecret(req, agentNamespace)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var pullErr *pullError
+			if errors.As(err, &pullErr) {
+				status = pullErr.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(secret)
+	})
+	return mux
+}
+
+// pullSecret authenticates the agent, checks the PipelineRun it posted runs on its spoke
+// cluster and names the git-auth secret of its hub PipelineRun, and returns the secret to
+// create for it, fetched with the metadata of the hub PipelineRun.
+func (r *Reconciler) pullSecret(req *http.Request, agentNamespace string) (*corev1.Secret, error) {
+	ctx := req.Context()
+	clusterName, err := r.authenticateAgent(ctx, req.Header.Get("Authorization"), agentNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineRun := &v1.PipelineRun{}
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxPullRequestSize)).Decode(pipelineRun); err != nil {
+		return nil, newPullError(http.StatusBadRequest, "invalid PipelineRun: %v", err)
+	}
+	secretName := pipelineRun.GetAnnotations()[gitAuthSecret]
+	if secretName == "" {
+		return nil, newPullError(http.StatusBadRequest, "PipelineRun %s/%s has no %s annotation", pipelineRun.GetNamespace(), pipelineRun.GetName(), gitAuthSecret)
+	}
+
+	workload, err := r.dispatchedWorkload(ctx, pipelineRun.GetNamespace(), pipelineRun.GetName(), clusterName)
+	if err != nil {
+		return nil, err
+	}
+	// The agent only tells which run it pulls for, the secret is the one named by the hub
+	// PipelineRun of the Workload
+	hubPipelineRun, err := r.hubPipelineRun(ctx, workload.GetNamespace(), pipelineRun.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if hubPipelineRun == nil || hubPipelineRun.GetAnnotations()[gitAuthSecret] != secretName {
+		return nil, newPullError(http.StatusForbidden, "secret %s is not the git-auth secret of PipelineRun %s/%s", secretName, pipelineRun.GetNamespace(), pipelineRun.GetName())
+	}
+	// The secret sources read the hub labels and annotations, so a spoke can't point them at the
+	// Vault paths or repositories of other runs; the spoke PipelineRun still owns the secret
+	pipelineRun.Labels = hubPipelineRun.GetLabels()
+	pipelineRun.Annotations = hubPipelineRun.GetAnnotations()
+
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "Secret pulled by the spoke cluster agent",
+		Cluster:     clusterName,
+		Secret:      pipelineRun.GetNamespace() + "/" + secretName,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}
+	secret, err := r.source().fetch(ctx, pipelineRun, secretName)
+	if err != nil {
+		r.logger.Errorf("error getting secret %s/%s pulled by spoke cluster %s: %v", pipelineRun.GetNamespace(), secretName, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		if apierrors.IsNotFound(err) {
+			return nil, newPullError(http.StatusNotFound, "secret %s/%s not found", pipelineRun.GetNamespace(), secretName)
+		}
+		return nil, err
+	}
+	if err := r.disallowedSecretError(secret); err != nil {
+		r.logger.Errorf("error serving secret %s/%s pulled by spoke cluster %s: %v", pipelineRun.GetNamespace(), secretName, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return nil, newPullError(http.StatusForbidden, "%v", err)
+	}
+	event = event.withContent(secret)
+	spokeSecret, err := r.enforceSpokeSecretType(ctx, pipelineRun.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload))
+	if err == nil {
+		spokeSecret, err = r.rewriteGitMirrors(ctx, clusterName, spokeSecret)
+	}
+	if err == nil {
+		// The agent writes the secret, only the pre-sync hooks run
+		spokeSecret, err = r.runPreSyncHooks(ctx, syncTarget(event), spokeSecret)
+	}
+	if err != nil {
+		r.logger.Errorf("error preparing secret %s/%s pulled by spoke cluster %s: %v", secret.Namespace, secret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return nil, err
+	}
+	event.Outcome = auditOutcomeSuccess
+	r.recordDecision(event)
+
+	r.logger.Infof("spoke cluster %s pulled secret %s/%s for PipelineRun %s", clusterName, secret.Namespace, secret.Name, pipelineRun.GetName())
+	return spokeSecret, nil
+}
+
+// authenticateAgent reviews the bearer token of an agent and returns the spoke cluster it
+// authenticates, the name of its ServiceAccount in the agent namespace.
+func (r *Reconciler) authenticateAgent(ctx context.Context, authorization, agentNamespace string) (string, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return "", newPullError(http.StatusUnauthorized, "missing bearer token")
+	}
+
+	review, err := r.hubKubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: []string{pullAPIAudience}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not review agent token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return "", newPullError(http.StatusUnauthorized, "invalid token: %s", review.Status.Error)
+	}
+
+	prefix := "system:serviceaccount:" + agentNamespace + ":"
+	clusterName, ok := strings.CutPrefix(review.Status.User.Username, prefix)
+	if !ok || clusterName == "" {
+		return "", newPullError(http.StatusForbidden, "%s is not a ServiceAccount of namespace %s", review.Status.User.Username, agentNamespace)
+	}
+	return clusterName, nil
+}
+
+// dispatchedWorkload returns the active Workload of the PipelineRun dispatched to the spoke
+// cluster, agents are only given the secrets of their own runs.
+func (r *Reconciler) dispatchedWorkload(ctx context.Context, namespace, pipelineRunName, clusterName string) (*kueuev1beta1.Workload, error) {
+	workloads, err := r.workloadLister.Workloads(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, workload := range workloads {
+		owner, err := r.pipelineRunOwner(ctx, workload)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil || owner.Kind != "PipelineRun" || owner.Name != pipelineRunName {
+			continue
+		}
+		if workload.GetDeletionTimestamp() != nil || (workload.Spec.Active != nil && !*workload.Spec.Active) ||
+			workload.Status.ClusterName == nil || *workload.Status.ClusterName != clusterName {
+			// A stale Workload of the PipelineRun, e.g. a requeued one, mustn't hide the active one
+			continue
+		}
+		return workload, nil
+	}
+	return nil, newPullError(http.StatusForbidden, "PipelineRun %s/%s is not dispatched to spoke cluster %s", namespace, pipelineRunName, clusterName)
+}
+
+// servePullAPI runs the pull API server until the context is done.
+func (r *Reconciler) servePullAPI(ctx context.Context, logger *zap.SugaredLogger, opts pullAPIOptions) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.port),
+		Handler:           r.pullHandler(opts.agentNamespace),
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Serving the pull API for spoke agents on port %d", opts.port)
+	if err := server.ListenAndServeTLS(opts.certFile, opts.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("pull API server failed: %v", err)
+	}
+}
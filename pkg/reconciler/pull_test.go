@@ -0,0 +1,235 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestPullHandler(t *testing.T) {
+	isController := true
+	clusterName := testClusterName
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", Controller: &isController}},
+		},
+		Status: kueuev1beta1.WorkloadStatus{ClusterName: &clusterName},
+	}))
+	// The stale Workloads of a requeued PipelineRun don't hide its active one
+	inactive := false
+	otherCluster := "other-cluster"
+	deleted := metav1.Now()
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "inactive-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", Controller: &isController}},
+		},
+		Spec:   kueuev1beta1.WorkloadSpec{Active: &inactive},
+		Status: kueuev1beta1.WorkloadStatus{ClusterName: &clusterName},
+	}))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "requeued-workload",
+			Namespace:         "test-namespace",
+			DeletionTimestamp: &deleted,
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", Controller: &isController}},
+		},
+		Status: kueuev1beta1.WorkloadStatus{ClusterName: &otherCluster},
+	}))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "pending-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", Controller: &isController}},
+		},
+	}))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "missing-secret-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "missing-secret-run", Controller: &isController}},
+		},
+		Status: kueuev1beta1.WorkloadStatus{ClusterName: &clusterName},
+	}))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "github-app-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "github-app-run", Controller: &isController}},
+		},
+		Status: kueuev1beta1.WorkloadStatus{ClusterName: &clusterName},
+	}))
+	hubPipelineRun := func(name string, annotations map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "tekton.dev/v1",
+			"kind":       "PipelineRun",
+			"metadata": map[string]any{
+				"name":        name,
+				"namespace":   "test-namespace",
+				"annotations": annotations,
+			},
+		}}
+	}
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pipelineRunGVR: "PipelineRunList"},
+		hubPipelineRun("test-pipeline-run", map[string]any{gitAuthSecret: "test-secret"}),
+		hubPipelineRun("missing-secret-run", map[string]any{gitAuthSecret: "missing"}),
+		hubPipelineRun("github-app-run", map[string]any{
+			gitAuthSecret:            "test-secret",
+			installationIDAnnotation: "4242",
+			urlRepositoryAnnotation:  "repo",
+			vaultPathAnnotation:      "secret/data/test-namespace/git",
+		}),
+	)
+	hubKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid"}},
+		},
+		Data: map[string][]byte{defaultSecretDataKey: []byte("token")},
+	})
+	usernames := map[string]string{
+		"agent-token": "system:serviceaccount:syncer-service:" + testClusterName,
+		"other-token": "system:serviceaccount:syncer-service:other-cluster",
+		"user-token":  "admin",
+	}
+	hubKubeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		assert.DeepEqual(t, []string{pullAPIAudience}, review.Spec.Audiences)
+		if username, ok := usernames[review.Spec.Token]; ok {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: username}}
+		}
+		return true, review, nil
+	})
+	r := &Reconciler{
+		logger:           zap.NewNop().Sugar(),
+		hubKubeClient:    hubKubeClient,
+		hubDynamicClient: hubDynamicClient,
+		workloadLister:   kueuev1beta1lister.NewWorkloadLister(indexer),
+		features:         enabledFeatureGates(featurePullAgent),
+	}
+	server := httptest.NewServer(r.pullHandler("syncer-service"))
+	defer server.Close()
+
+	pull := func(token string, pipelineRun *v1.PipelineRun) *http.Response {
+		body, err := json.Marshal(pipelineRun)
+		assert.NilError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+pullAPIPath, strings.NewReader(string(body)))
+		assert.NilError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	pipelineRun := func(name string, annotations map[string]string) *v1.PipelineRun {
+		return &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace", UID: "spoke-uid", Annotations: annotations}}
+	}
+	withSecret := map[string]string{gitAuthSecret: "test-secret"}
+
+	tests := []struct {
+		name           string
+		token          string
+		pipelineRun    *v1.PipelineRun
+		expectedStatus int
+	}{
+		{name: "no token", pipelineRun: pipelineRun("test-pipeline-run", withSecret), expectedStatus: http.StatusUnauthorized},
+		{name: "invalid token", token: "invalid", pipelineRun: pipelineRun("test-pipeline-run", withSecret), expectedStatus: http.StatusUnauthorized},
+		{name: "not an agent", token: "user-token", pipelineRun: pipelineRun("test-pipeline-run", withSecret), expectedStatus: http.StatusForbidden},
+		{name: "other spoke cluster", token: "other-token", pipelineRun: pipelineRun("test-pipeline-run", withSecret), expectedStatus: http.StatusForbidden},
+		{name: "unknown PipelineRun", token: "agent-token", pipelineRun: pipelineRun("other-pipeline-run", withSecret), expectedStatus: http.StatusForbidden},
+		{name: "no git auth secret", token: "agent-token", pipelineRun: pipelineRun("test-pipeline-run", nil), expectedStatus: http.StatusBadRequest},
+		{name: "other secret of the namespace", token: "agent-token", pipelineRun: pipelineRun("test-pipeline-run", map[string]string{gitAuthSecret: "other-secret"}), expectedStatus: http.StatusForbidden},
+		{name: "missing hub secret", token: "agent-token", pipelineRun: pipelineRun("missing-secret-run", map[string]string{gitAuthSecret: "missing"}), expectedStatus: http.StatusNotFound},
+		{name: "dispatched PipelineRun", token: "agent-token", pipelineRun: pipelineRun("test-pipeline-run", withSecret), expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := pull(tt.token, tt.pipelineRun)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			secret := &corev1.Secret{}
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(secret))
+			assert.Equal(t, "token", string(secret.Data[defaultSecretDataKey]))
+			assert.Equal(t, "spoke-uid", string(secret.OwnerReferences[0].UID))
+			assert.Equal(t, managedByValue, secret.Labels[managedByLabel])
+			assert.Equal(t, "test-namespace/test-workload", secret.Annotations[workloadAnnotation])
+		})
+	}
+
+	t.Run("tampered source annotations", func(t *testing.T) {
+		source := &recordingSecretSource{secret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+			Data:       map[string][]byte{defaultSecretDataKey: []byte("token")},
+		}}
+		r.secretSource = source
+		t.Cleanup(func() { r.secretSource = nil })
+
+		resp := pull("agent-token", pipelineRun("github-app-run", map[string]string{
+			gitAuthSecret:            "test-secret",
+			installationIDAnnotation: "1",
+			urlRepositoryAnnotation:  "other-repo",
+			vaultPathAnnotation:      "secret/data/other-namespace/git",
+		}))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		// The secret is fetched with the annotations of the hub PipelineRun
+		assert.Equal(t, 1, len(source.fetched))
+		assert.DeepEqual(t, map[string]string{
+			gitAuthSecret:            "test-secret",
+			installationIDAnnotation: "4242",
+			urlRepositoryAnnotation:  "repo",
+			vaultPathAnnotation:      "secret/data/test-namespace/git",
+		}, source.fetched[0].GetAnnotations())
+		assert.Equal(t, "spoke-uid", string(source.fetched[0].GetUID()))
+	})
+
+	t.Run("disabled feature gate", func(t *testing.T) {
+		r.features = disabledFeatureGates(featurePullAgent)
+		resp := pull("agent-token", pipelineRun("test-pipeline-run", withSecret))
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+// recordingSecretSource returns a copy of its secret, and records the PipelineRuns it was fetched
+// for.
+type recordingSecretSource struct {
+	secret  *corev1.Secret
+	fetched []*v1.PipelineRun
+}
+
+func (s *recordingSecretSource) fetch(_ context.Context, pipelineRun *v1.PipelineRun, _ string) (*corev1.Secret, error) {
+	s.fetched = append(s.fetched, pipelineRun.DeepCopy())
+	return s.secret.DeepCopy(), nil
+}
+
+func (*recordingSecretSource) ephemeral() bool { return false }
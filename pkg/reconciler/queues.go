@@ -0,0 +1,93 @@
+package reconciler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// workloadQueueFilter restricts the controller to the Workloads of some queues, the ones used for
+// the remote Tekton dispatch. The zero workloadQueueFilter matches every Workload.
+type workloadQueueFilter struct {
+	// localQueues are the LocalQueues of WORKLOAD_LOCAL_QUEUES, by name alone or by
+	// namespace/name.
+	localQueues map[string]bool
+	// clusterQueues are the ClusterQueues of WORKLOAD_CLUSTER_QUEUES.
+	clusterQueues map[string]bool
+	// owners are the intermediate owners of OWNER_TRAVERSAL_*, through which the Workloads
+	// are owned by their PipelineRun.
+	owners ownerTraversal
+	// workloads is the WorkloadFilter of the ControllerOptions of the embedders.
+	workloads func(*kueuev1beta1.Workload) bool
+}
+
+// owned reports whether the Workload is owned by a PipelineRun, or controlled by an intermediate
+// owner the filter follows. The PipelineRun of the intermediate owner is only resolved by the
+// reconciler.
+func (f workloadQueueFilter) owned(object metav1.Object) bool {
+	return hasPipelineRunOwner(object) || f.owners.follows(metav1.GetControllerOf(object))
+}
+
+// parseQueueNames parses a comma separated list of queue names. Names with a namespace, e.g. the
+// namespace/name of a LocalQueue, are only accepted when namespaced is true.
+func parseQueueNames(value string, namespaced bool) (map[string]bool, error) {
+	var queues map[string]bool
+	for _, queue := range strings.Split(value, ",") {
+		queue = strings.TrimSpace(queue)
+		if queue == "" {
+			continue
+		}
+		name := queue
+		if namespace, queueName, ok := strings.Cut(queue, "/"); ok {
+			if !namespaced {
+				return nil, fmt.Errorf("invalid queue %q: ClusterQueues aren't namespaced", queue)
+			}
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid namespace of queue %q: %s", queue, strings.Join(errs, ", "))
+			}
+			name = queueName
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid queue %q: %s", queue, strings.Join(errs, ", "))
+		}
+		if queues == nil {
+			queues = map[string]bool{}
+		}
+		queues[queue] = true
+	}
+	return queues, nil
+}
+
+// matches reports whether the Workload is submitted to one of the LocalQueues and admitted by one
+// of the ClusterQueues of the filter, when set, and is selected by the filter of the embedders.
+// Workloads with the cleanup finalizer always match, so the secrets synced for them are cleaned
+// up even once they were evicted from their ClusterQueue.
+func (f workloadQueueFilter) matches(workload *kueuev1beta1.Workload) bool {
+	if len(f.localQueues) == 0 && len(f.clusterQueues) == 0 && f.workloads == nil {
+		return true
+	}
+	if slices.Contains(workload.GetFinalizers(), cleanupFinalizer) {
+		return true
+	}
+
+	if f.workloads != nil && !f.workloads(workload) {
+		return false
+	}
+
+	if len(f.localQueues) > 0 {
+		queue := string(workload.Spec.QueueName)
+		if !f.localQueues[queue] && !f.localQueues[workload.GetNamespace()+"/"+queue] {
+			return false
+		}
+	}
+	if len(f.clusterQueues) > 0 {
+		if workload.Status.Admission == nil || !f.clusterQueues[string(workload.Status.Admission.ClusterQueue)] {
+			return false
+		}
+	}
+	return true
+}
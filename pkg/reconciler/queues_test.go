@@ -0,0 +1,160 @@
+package reconciler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestParseQueueNames(t *testing.T) {
+	for value, expected := range map[string]map[string]bool{
+		"":                              nil,
+		"remote-tekton":                 {"remote-tekton": true},
+		" remote-tekton, ci/tekton ,, ": {"remote-tekton": true, "ci/tekton": true},
+	} {
+		queues, err := parseQueueNames(value, true)
+		assert.NilError(t, err, value)
+		assert.DeepEqual(t, expected, queues)
+	}
+
+	_, err := parseQueueNames("Remote_Tekton", true)
+	assert.ErrorContains(t, err, `invalid queue "Remote_Tekton"`)
+	_, err = parseQueueNames("Team_A/tekton", true)
+	assert.ErrorContains(t, err, `invalid namespace of queue "Team_A/tekton"`)
+	_, err = parseQueueNames("ci/spoke-clusters", false)
+	assert.ErrorContains(t, err, "ClusterQueues aren't namespaced")
+}
+
+func queuedWorkload(localQueue, clusterQueue string, finalizers ...string) *kueuev1beta1.Workload {
+	workload := pipelineRunOwnedWorkload("ci", "test-workload")
+	workload.Finalizers = finalizers
+	workload.Spec.QueueName = kueuev1beta1.LocalQueueName(localQueue)
+	if clusterQueue != "" {
+		workload.Status.Admission = &kueuev1beta1.Admission{ClusterQueue: kueuev1beta1.ClusterQueueReference(clusterQueue)}
+	}
+	return workload
+}
+
+func TestWorkloadQueueFilterMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   workloadQueueFilter
+		workload *kueuev1beta1.Workload
+		expected bool
+	}{
+		{
+			name:     "no filter",
+			workload: queuedWorkload("", ""),
+			expected: true,
+		},
+		{
+			name:     "local queue by name",
+			filter:   workloadQueueFilter{localQueues: map[string]bool{"remote-tekton": true}},
+			workload: queuedWorkload("remote-tekton", ""),
+			expected: true,
+		},
+		{
+			name:     "local queue by namespace and name",
+			filter:   workloadQueueFilter{localQueues: map[string]bool{"ci/remote-tekton": true}},
+			workload: queuedWorkload("remote-tekton", ""),
+			expected: true,
+		},
+		{
+			name:     "local queue of another namespace",
+			filter:   workloadQueueFilter{localQueues: map[string]bool{"team-a/remote-tekton": true}},
+			workload: queuedWorkload("remote-tekton", ""),
+		},
+		{
+			name:     "other local queue",
+			filter:   workloadQueueFilter{localQueues: map[string]bool{"remote-tekton": true}},
+			workload: queuedWorkload("batch", ""),
+		},
+		{
+			name:     "admitted by the cluster queue",
+			filter:   workloadQueueFilter{clusterQueues: map[string]bool{"spoke-clusters": true}},
+			workload: queuedWorkload("batch", "spoke-clusters"),
+			expected: true,
+		},
+		{
+			name:     "not admitted yet",
+			filter:   workloadQueueFilter{clusterQueues: map[string]bool{"spoke-clusters": true}},
+			workload: queuedWorkload("batch", ""),
+		},
+		{
+			name: "local queue of another cluster queue",
+			filter: workloadQueueFilter{
+				localQueues:   map[string]bool{"remote-tekton": true},
+				clusterQueues: map[string]bool{"spoke-clusters": true},
+			},
+			workload: queuedWorkload("remote-tekton", "local-cluster"),
+		},
+		{
+			name:     "selected by the workload filter",
+			filter:   workloadQueueFilter{workloads: func(w *kueuev1beta1.Workload) bool { return w.Spec.QueueName == "remote-tekton" }},
+			workload: queuedWorkload("remote-tekton", ""),
+			expected: true,
+		},
+		{
+			name: "rejected by the workload filter",
+			filter: workloadQueueFilter{
+				localQueues: map[string]bool{"remote-tekton": true},
+				workloads:   func(*kueuev1beta1.Workload) bool { return false },
+			},
+			workload: queuedWorkload("remote-tekton", ""),
+		},
+		{
+			name:     "rejected by the workload filter with the cleanup finalizer",
+			filter:   workloadQueueFilter{workloads: func(*kueuev1beta1.Workload) bool { return false }},
+			workload: queuedWorkload("remote-tekton", "", cleanupFinalizer),
+			expected: true,
+		},
+		{
+			name:     "evicted with the cleanup finalizer",
+			filter:   workloadQueueFilter{clusterQueues: map[string]bool{"spoke-clusters": true}},
+			workload: queuedWorkload("remote-tekton", "", cleanupFinalizer),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.matches(tt.workload))
+		})
+	}
+}
+
+func TestWorkloadQueueFilterListerAndHandler(t *testing.T) {
+	filter := workloadQueueFilter{localQueues: map[string]bool{"remote-tekton": true}}
+	queued := queuedWorkload("remote-tekton", "")
+	other := queuedWorkload("batch", "")
+	other.Name = "batch-workload"
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, indexer.Add(queued))
+	assert.NilError(t, indexer.Add(other))
+	lister := pipelineRunWorkloadLister{kueuev1beta1lister.NewWorkloadLister(indexer), filter}
+
+	workloads, err := lister.Workloads("ci").List(labels.Everything())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []*kueuev1beta1.Workload{queued}, workloads)
+	_, err = lister.Workloads("ci").Get("batch-workload")
+	assert.ErrorContains(t, err, "not found")
+
+	var enqueued []any
+	enqueue := func(obj any) { enqueued = append(enqueued, obj) }
+	handler := workloadEventHandler(filter, enqueue, enqueue)
+	handler.OnAdd(queued, true)
+	handler.OnAdd(other, true)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "ci/batch-workload", Obj: other})
+	assert.DeepEqual(t, []any{queued}, enqueued)
+
+	// A Workload moved to another LocalQueue is enqueued one last time, as deleted.
+	moved := queued.DeepCopy()
+	moved.ResourceVersion, moved.Spec.QueueName = "2", "batch"
+	handler.OnUpdate(queued, moved)
+	assert.DeepEqual(t, []any{queued, queued}, enqueued)
+}
@@ -0,0 +1,211 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// secretQuotaExceededReason is the reason of the Warning event recorded on the Workloads whose
+// secrets exceed the quota of their namespace.
+const secretQuotaExceededReason = "SecretQuotaExceeded"
+
+// secretQuotaOptions configures the secrets the Workloads of a hub namespace may have synced to
+// the spoke clusters at once.
+type secretQuotaOptions struct {
+	// maxCount is the number of synced secrets, 0 means unlimited
+	maxCount int
+	// maxBytes is the total size of their data, 0 means unlimited
+	maxBytes int64
+}
+
+func (o secretQuotaOptions) enabled() bool {
+	return o.maxCount > 0 || o.maxBytes > 0
+}
+
+// parseQuantityBytes parses a size such as 512Ki or 1Mi into bytes.
+func parseQuantityBytes(value string) (int64, error) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	return quantity.Value(), nil
+}
+
+// secretQuotas tracks the secrets synced by the Workloads of each hub namespace against the
+// quota, protecting the etcd of the spoke clusters from PipelineRuns asking for many or large
+// secrets. A secret counts against the namespace of its Workload, wherever its target namespace
+// puts it on the spoke cluster. The usage is rebuilt on startup from the managed secrets of the
+// spoke clusters, see rebuildSecretQuotas. A nil secretQuotas enforces no quota.
+type secretQuotas struct {
+	opts secretQuotaOptions
+
+	mu sync.Mutex
+	// usage holds the data size of the synced secrets of each hub namespace
+	usage map[string]map[syncedSecretRef]int64
+	// namespaces holds the hub namespace each synced secret counts against
+	namespaces map[syncedSecretRef]string
+}
+
+func newSecretQuotas(opts secretQuotaOptions) *secretQuotas {
+	if !opts.enabled() {
+		return nil
+	}
+	return &secretQuotas{opts: opts, usage: map[string]map[syncedSecretRef]int64{}, namespaces: map[syncedSecretRef]string{}}
+}
+
+// reserve accounts the secret to be written to the spoke cluster against the hub namespace,
+// replacing the previous version of the same secret. It fails with ErrQuotaExceeded, accounting
+// nothing, when the namespace would go over its quota.
+func (q *secretQuotas) reserve(namespace string, ref syncedSecretRef, secret *corev1.Secret) error {
+	if q == nil {
+		return nil
+	}
+	size := secretDataSize(secret)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	secrets := q.usage[namespace]
+	count, total := len(secrets), int64(0)
+	for synced, syncedSize := range secrets {
+		if synced != ref {
+			total += syncedSize
+		}
+	}
+	if _, ok := secrets[ref]; !ok {
+		count++
+	}
+	total += size
+
+	if q.opts.maxCount > 0 && count > q.opts.maxCount {
+		return syncer.Classify(fmt.Errorf("namespace %s would have %d secrets synced to spoke clusters, over its quota of %d", namespace, count, q.opts.maxCount), ErrQuotaExceeded)
+	}
+	if q.opts.maxBytes > 0 && total > q.opts.maxBytes {
+		return syncer.Classify(fmt.Errorf("namespace %s would have %d bytes of secrets synced to spoke clusters, over its quota of %d", namespace, total, q.opts.maxBytes), ErrQuotaExceeded)
+	}
+
+	q.account(namespace, ref, size)
+	return nil
+}
+
+// account records the size of the secret against the hub namespace, moving it from the namespace
+// it counted against before. q.mu must be held.
+func (q *secretQuotas) account(namespace string, ref syncedSecretRef, size int64) {
+	if previous, ok := q.namespaces[ref]; ok && previous != namespace {
+		q.forget(previous, ref)
+	}
+	secrets := q.usage[namespace]
+	if secrets == nil {
+		secrets = map[syncedSecretRef]int64{}
+		q.usage[namespace] = secrets
+	}
+	secrets[ref] = size
+	q.namespaces[ref] = namespace
+}
+
+// restore accounts a secret found on the spoke cluster against the hub namespace, without
+// checking the quota, unless a sync accounted it already.
+func (q *secretQuotas) restore(namespace string, ref syncedSecretRef, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.namespaces[ref]; !ok {
+		q.account(namespace, ref, size)
+	}
+}
+
+// release stops accounting the secret, once removed from the spoke cluster or no longer managed.
+func (q *secretQuotas) release(ref syncedSecretRef) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if namespace, ok := q.namespaces[ref]; ok {
+		q.forget(namespace, ref)
+	}
+}
+
+// forget drops the secret from the usage of the hub namespace. q.mu must be held.
+func (q *secretQuotas) forget(namespace string, ref syncedSecretRef) {
+	delete(q.namespaces, ref)
+	delete(q.usage[namespace], ref)
+	if len(q.usage[namespace]) == 0 {
+		delete(q.usage, namespace)
+	}
+}
+
+// quotaNamespace returns the hub namespace the spoke secret counts against, the one of the
+// Workload it is synced for, else the namespace of the secret.
+func quotaNamespace(secret *corev1.Secret) string {
+	if namespace, _, ok := splitNamespacedName(secret.Annotations[workloadAnnotation]); ok {
+		return namespace
+	}
+	return secret.Namespace
+}
+
+// rebuildSecretQuotas accounts the managed secrets of the active spoke clusters, so a restarted
+// controller enforces the quotas right away rather than once every Workload was reconciled again.
+// The clusters which can't be listed are skipped, their secrets are accounted by the next syncs.
+func (r *Reconciler) rebuildSecretQuotas(ctx context.Context) {
+	clusters, err := r.multiKueueClusters(ctx)
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters to rebuild the secret quotas: %v", err)
+		return
+	}
+	restored := 0
+	for _, cluster := range clusters {
+		if !meta.IsStatusConditionTrue(cluster.Status.Conditions, kueuev1beta1.MultiKueueClusterActive) {
+			continue
+		}
+		spokeKubeClient, _, err := r.getSpokeClients(ctx, cluster.Name)
+		if err != nil {
+			r.logger.Errorf("error creating spoke clients for cluster %s to rebuild the secret quotas: %v", cluster.Name, err)
+			continue
+		}
+		count, err := r.restoreSpokeClusterQuotas(ctx, cluster.Name, spokeKubeClient)
+		if err != nil {
+			r.logger.Errorf("error listing the managed secrets of spoke cluster %s to rebuild the secret quotas: %v", cluster.Name, err)
+			continue
+		}
+		restored += count
+	}
+	r.logger.Infof("accounted %d secrets of %d MultiKueueClusters against the secret quotas", restored, len(clusters))
+}
+
+// restoreSpokeClusterQuotas accounts the managed secrets of a single spoke cluster, and returns
+// how many there are.
+func (r *Reconciler) restoreSpokeClusterQuotas(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) (int, error) {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+	secrets, err := spokeKubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(spokeCtx, metav1.ListOptions{LabelSelector: managedSecretsSelector})
+	if err != nil {
+		return 0, err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		ref := syncedSecretRef{Cluster: clusterName, Namespace: secret.Namespace, Name: secret.Name}
+		r.quotas.restore(quotaNamespace(secret), ref, secretDataSize(secret))
+	}
+	return len(secrets.Items), nil
+}
+
+// secretDataSize is the size the secret data takes in etcd, keys included.
+func secretDataSize(secret *corev1.Secret) int64 {
+	var size int64
+	for key, value := range secret.Data {
+		size += int64(len(key) + len(value))
+	}
+	for key, value := range secret.StringData {
+		size += int64(len(key) + len(value))
+	}
+	return size
+}
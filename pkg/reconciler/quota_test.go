@@ -0,0 +1,150 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestSecretQuotas(t *testing.T) {
+	secret := func(size int) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{"token": make([]byte, size-len("token"))}}
+	}
+	ref := func(cluster, namespace, name string) syncedSecretRef {
+		return syncedSecretRef{Cluster: cluster, Namespace: namespace, Name: name}
+	}
+
+	q := newSecretQuotas(secretQuotaOptions{maxCount: 2, maxBytes: 100})
+	assert.NilError(t, q.reserve("team-a", ref("cluster-1", "team-a", "secret-1"), secret(40)))
+	assert.NilError(t, q.reserve("team-a", ref("cluster-2", "team-a", "secret-2"), secret(40)))
+	// Other namespaces have their own quota
+	assert.NilError(t, q.reserve("team-b", ref("cluster-1", "team-b", "secret-1"), secret(100)))
+
+	err := q.reserve("team-a", ref("cluster-1", "team-a", "secret-3"), secret(10))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "namespace team-a would have 3 secrets synced to spoke clusters, over its quota of 2")
+
+	// Refreshing a synced secret replaces its size
+	assert.NilError(t, q.reserve("team-a", ref("cluster-1", "team-a", "secret-1"), secret(60)))
+	err = q.reserve("team-a", ref("cluster-1", "team-a", "secret-1"), secret(61))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "namespace team-a would have 101 bytes of secrets synced to spoke clusters, over its quota of 100")
+
+	q.release(ref("cluster-2", "team-a", "secret-2"))
+	assert.NilError(t, q.reserve("team-a", ref("cluster-1", "team-a", "secret-3"), secret(40)))
+
+	// The secrets redirected to another spoke namespace count against their hub namespace
+	err = q.reserve("team-a", ref("cluster-1", "execution", "secret-4"), secret(10))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.NilError(t, q.reserve("team-c", ref("cluster-1", "execution", "secret-4"), secret(100)))
+	err = q.reserve("team-c", ref("cluster-1", "execution", "secret-5"), secret(10))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	q.release(ref("cluster-1", "execution", "secret-4"))
+	assert.NilError(t, q.reserve("team-c", ref("cluster-1", "execution", "secret-5"), secret(10)))
+}
+
+func TestSecretQuotasDisabled(t *testing.T) {
+	q := newSecretQuotas(secretQuotaOptions{})
+	assert.Assert(t, q == nil)
+	for i := 0; i < 10; i++ {
+		assert.NilError(t, q.reserve("team-a", syncedSecretRef{Cluster: testClusterName, Namespace: "team-a", Name: "secret"}, &corev1.Secret{}))
+	}
+	q.release(syncedSecretRef{Cluster: testClusterName, Namespace: "team-a", Name: "secret"})
+}
+
+func TestCreateSecretOnSpokeClusterQuota(t *testing.T) {
+	ctx := context.Background()
+	hubSecrets := []*corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: "secret-1", Namespace: "test-namespace"}, Data: map[string][]byte{"token": []byte("token-1")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "secret-2", Namespace: "test-namespace"}, Data: map[string][]byte{"token": []byte("token-2")}},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(hubSecrets[0], hubSecrets[1]),
+		quotas:        newSecretQuotas(secretQuotaOptions{maxCount: 1}),
+		recorder:      recorder,
+	}
+	spokeKubeClient := fake.NewSimpleClientset()
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "secret-1", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "secret-2", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// The secret over the quota never reaches the spoke
+	_, getErr := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "secret-2", metav1.GetOptions{})
+	assert.ErrorContains(t, getErr, "not found")
+
+	err = r.rejectionError(workload, err)
+	assert.Assert(t, controller.IsPermanentError(err), "expected permanent error, got %v", err)
+	assert.Equal(t, 1, len(recorder.Events))
+	event := <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(event, "Warning "+secretQuotaExceededReason+" Not syncing secrets: namespace test-namespace would have 2 secrets"), event)
+
+	// Deleting the synced secret frees the quota
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "secret-1"}
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "PipelineRun done"))
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "secret-2", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+}
+
+func TestQuotaNamespace(t *testing.T) {
+	redirected := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "execution",
+		Annotations: map[string]string{workloadAnnotation: "team-a/test-workload"},
+	}}
+	assert.Equal(t, "team-a", quotaNamespace(redirected))
+	assert.Equal(t, "execution", quotaNamespace(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "execution"}}))
+}
+
+func TestRestoreSpokeClusterQuotas(t *testing.T) {
+	ctx := context.Background()
+	synced := managedSecret("secret-1", map[string]string{workloadAnnotation: "team-a/test-workload"})
+	synced.Data = map[string][]byte{"token": make([]byte, 45)}
+	redirected := managedSecret("secret-2", map[string]string{workloadAnnotation: "team-a/other-workload"})
+	redirected.Namespace = "execution"
+	redirected.Data = map[string][]byte{"token": make([]byte, 45)}
+	spokeKubeClient := fake.NewSimpleClientset(
+		synced,
+		redirected,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "not-managed", Namespace: "test-namespace"}, Data: map[string][]byte{"token": make([]byte, 500)}},
+	)
+	r := &Reconciler{
+		logger: zap.NewNop().Sugar(),
+		quotas: newSecretQuotas(secretQuotaOptions{maxBytes: 150}),
+	}
+
+	count, err := r.restoreSpokeClusterQuotas(ctx, testClusterName, spokeKubeClient)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, count)
+
+	// The restored secrets count against their hub namespace before any Workload is reconciled
+	third := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "secret-3"}
+	err = r.quotas.reserve("team-a", third, &corev1.Secret{Data: map[string][]byte{"token": make([]byte, 50)}})
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "namespace team-a would have 155 bytes")
+
+	// A secret accounted by a sync keeps its size
+	refreshed := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "secret-1"}
+	assert.NilError(t, r.quotas.reserve("team-a", refreshed, &corev1.Secret{Data: map[string][]byte{"token": make([]byte, 5)}}))
+	_, err = r.restoreSpokeClusterQuotas(ctx, testClusterName, spokeKubeClient)
+	assert.NilError(t, err)
+	assert.NilError(t, r.quotas.reserve("team-a", third, &corev1.Secret{Data: map[string][]byte{"token": make([]byte, 50)}}))
+}
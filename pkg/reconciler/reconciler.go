@@ -2,7 +2,9 @@ package reconciler
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -10,75 +12,263 @@ import (
 	tektonversioned2 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 
 	// "knative.dev/pkg/ptr"
 	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
 	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
 	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+
+	workloadreconciler "github.com/zakisk/secret-service/pkg/client/injection/reconciler/kueue/v1beta1/workload"
+	"github.com/zakisk/secret-service/pkg/syncer"
 )
 
 const (
 	groupName     = "pipelinesascode.tekton.dev"
-	gitAuthSecret = groupName + "/git-auth-secret"
+	gitAuthSecret = syncer.GitAuthSecretAnnotation
+
+	// managedByLabel marks the secrets created on spoke clusters by this controller.
+	managedByLabel = syncer.ManagedByLabel
+	managedByValue = syncer.ManagedByValue
+
+	// workloadAnnotation and pipelineRunAnnotation record, as namespace/name, the hub Workload
+	// and the spoke PipelineRun a synced secret was created for.
+	workloadAnnotation    = syncer.WorkloadAnnotation
+	pipelineRunAnnotation = syncer.PipelineRunAnnotation
+	// pipelineRunUIDAnnotation records the UID of the spoke PipelineRun a synced secret was
+	// created for.
+	pipelineRunUIDAnnotation = syncer.PipelineRunUIDAnnotation
+	// idempotencyKeyAnnotation records the UID and generation of the Workload a synced secret
+	// was last written for.
+	idempotencyKeyAnnotation = syncer.IdempotencyKeyAnnotation
+	// targetNamespaceAnnotation on a Workload names the namespace of the spoke cluster its
+	// PipelineRun runs in, when it isn't the namespace of the Workload.
+	targetNamespaceAnnotation = syncer.TargetNamespaceAnnotation
+
+	// spokePipelineRunPollInterval is how long a Workload dispatched to a spoke cluster first waits
+	// to be reconciled again until MultiKueue creates its PipelineRun there, see
+	// spokePipelineRunPolls.
+	spokePipelineRunPollInterval = 5 * time.Second
+
+	// unscheduledRequeueDelay is how long a Workload not dispatched to a spoke cluster yet waits,
+	// jittered, before it is reconciled again.
+	unscheduledRequeueDelay = 10 * time.Second
 )
 
-// Reconciler implements controller.Reconciler for Workload resources.
+// Reconciler implements the generated Workload reconciler interfaces.
 type Reconciler struct {
+	// leader tracks the buckets of Workload keys this replica is leader for, it is the
+	// generated reconciler wrapping this one
+	leader leaderChecker
+
 	logger         *zap.SugaredLogger
 	hubKubeClient  kubernetes.Interface
 	workloadLister kueuev1beta1lister.WorkloadLister
 	kueueClient    kueueversioned.Interface
 	kueueNamespace string
+	retainPolicy   RetainPolicy
+	// multiKueueClusterLister and kubeconfigSecretLister cache the spoke cluster configs, nil
+	// reads them from the API server
+	multiKueueClusterLister kueuev1beta1lister.MultiKueueClusterLister
+	kubeconfigSecretLister  corev1lister.SecretLister
+	// hubSecretFinalizer protects hub secrets with a finalizer while the spoke PipelineRun runs
+	hubSecretFinalizer bool
+	// spokeClientQPS and spokeClientBurst rate limit the clients of each spoke cluster
+	spokeClientQPS   float32
+	spokeClientBurst int
+	// spokeRequestTimeout bounds every call to a spoke API server, 0 means no timeout
+	spokeRequestTimeout time.Duration
+	// kubeconfigContext selects the context of the kubeconfigs holding several clusters
+	kubeconfigContext syncer.KubeconfigContextStrategy
+	// dryRun makes the writes to the spoke clusters server-side dry-run requests
+	dryRun bool
+	// clusterGuards limits concurrency and trips circuit breakers per spoke cluster
+	clusterGuards *clusterGuards
+	// spokeProbes caches the reachability of the spoke clusters, nil when they aren't probed
+	spokeProbes *spokeProbes
+	// tracker records the reconciles in flight for the liveness probe
+	tracker *reconcileTracker
+	// auditor records the sync decisions, nil when auditing is disabled
+	auditor *auditor
+	// cloudEvents emits the sync lifecycle CloudEvents, nil when no sink is configured
+	cloudEvents *cloudEventSender
+	// results writes the sync decisions to Tekton Results, nil when it is disabled
+	results *resultsRecorder
+	// secretSource provides the git credentials, nil reads them from the hub Secrets
+	secretSource secretSource
+	// allowedSecrets is matched by the hub git-auth secrets synced, ADMISSION_WEBHOOK_SECRET_SELECTOR,
+	// nil allows all
+	allowedSecrets labels.Selector
+	// failures counts the consecutive failures of each Workload, nil disables escalation
+	failures *failureTracker
+	// retryBudgets stops retrying the syncs of timed out PipelineRuns, nil retries them
+	retryBudgets *retryBudgets
+	// pipelineRunPolls backs off the polls of the Workloads waiting for their spoke PipelineRun
+	pipelineRunPolls *spokePipelineRunPolls
+	// quotas limits the secrets synced per hub namespace, nil enforces no quota
+	quotas *secretQuotas
+	// conflictPolicy is what happens when an unmanaged spoke secret has the name of a synced one
+	conflictPolicy string
+	// oversizePolicy is what happens to a secret over the size limit of the Secrets
+	oversizePolicy string
+	// secretType is the type of the spoke git-auth secrets, empty keeps the one of the hub secret
+	secretType corev1.SecretType
+	// secretKeyMapping renames the keys of the spoke git-auth secrets, by hub key
+	secretKeyMapping map[string]string
+	// spokeClusterConfigs resolves the settings of the spoke clusters, nil when they have none
+	spokeClusterConfigs *spokeClusterConfigs
+	// syncPolicies resolves the sync policies of the hub namespaces, nil when they aren't read
+	syncPolicies *secretSyncPolicies
+	// hooks are the hooks run around the writes of the spoke secrets, nil runs none
+	hooks *syncHookRegistry
+	// recorder records events on Workloads
+	recorder record.EventRecorder
+	// spokeSecretMode is how the credentials are materialized on the spoke clusters
+	spokeSecretMode          string
+	externalSecrets          externalSecretsOptions
+	externalSecretsDiscovery *externalSecretsDiscovery
+	sealedSecrets             sealedSecretsOptions
+	sealedSecretsCertificates *sealedSecretsCertificates
+	// workloadStatus is where the sync state is written back on the Workloads
+	workloadStatus string
+	// statusStore persists the structured sync status of the Workloads, nil doesn't
+	statusStore statusStore
+	// tokenResyncMargin is how long before their expiry tokens are synced again, 0 disables it
+	tokenResyncMargin time.Duration
+	// clockSkew is how far the clocks of the hub, the spoke clusters and the token issuers may
+	// drift apart, the expiries and grace periods are widened by it
+	clockSkew time.Duration
+	// done decides when the done spoke PipelineRuns are no longer synced
+	done donePolicy
+	// hubDynamicClient reads the Pipelines-as-Code Repository CRs
+	hubDynamicClient dynamic.Interface
+	// ownerMapper maps the intermediate owners of the Workloads to their resource, nil without
+	// OWNER_TRAVERSAL_DEPTH
+	ownerMapper meta.RESTMapper
+	// intermediateOwners remembers the controllers of the intermediate owners, nil reads them on
+	// every reconcile
+	intermediateOwners *intermediateOwners
+	// repositorySecrets also syncs the provider secret of the PipelineRun's Repository CR, even
+	// without the providerSecretAnnotation
+	repositorySecrets bool
+	// pipelineRunSecretSources are where the other secrets referenced by the PipelineRuns are
+	// found, none when empty
+	pipelineRunSecretSources map[string]bool
+	// pipelineRunConfigMapSources are where the hub ConfigMaps referenced by the PipelineRuns are
+	// found, none when empty
+	pipelineRunConfigMapSources map[string]bool
+	// knownHosts configures the known_hosts synced with the SSH git-auth secrets
+	knownHosts knownHostsOptions
+	// resolverSecrets configures the sync of the credentials of the remote resolutions
+	resolverSecrets resolverSecretsOptions
+	// secretSyncConcurrency is how many secrets of a Workload are synced at once, 0 syncs them
+	// one at a time
+	secretSyncConcurrency int
+	// chains configures the sync of the Tekton Chains signing keys
+	chains chainsOptions
+	// rotations records the Workloads whose credentials are due for rotation, nil disables it
+	rotations *rotationRequests
+	// spokeDiscovery remembers the APIs served by the spoke clusters, nil skips the check
+	spokeDiscovery *spokeDiscovery
+	// spokeIdentities remembers the identities used on the spoke clusters for the audit events,
+	// nil records none
+	spokeIdentities *spokeIdentities
+	// spokeClients remembers the clients of the spoke clusters, nil creates them on every reconcile
+	spokeClients *spokeClientCache
+	// clusterWorkloads finds the cached Workloads dispatched to a spoke cluster, nil finds none
+	clusterWorkloads *clusterWorkloads
+	// hubThrottle pauses the reconciles while the hub API server throttles the controller, nil
+	// never pauses them
+	hubThrottle *hubThrottle
+	// hubSecretUpdates records the Workloads whose hub secret was updated since it was synced,
+	// nil when the hub secrets aren't watched
+	hubSecretUpdates *rotationRequests
+	// hubSecretCache serves the git-auth secrets of the hub, nil reads them from the API server
+	hubSecretCache *hubSecretCache
+	// resyncs records the Workloads whose resync an operator requested with the resyncAnnotation,
+	// nil ignores the requests
+	resyncs *rotationRequests
+	// hubSecretRevocations records the Workloads whose hub secret was revoked since it was synced,
+	// nil when the revocations aren't propagated
+	hubSecretRevocations *hubSecretRevocations
+	// queues restricts the reconciled Workloads to those of some LocalQueues and ClusterQueues
+	queues workloadQueueFilter
+	// features holds the feature gates, nil resolves them to their defaults
+	features *featureGates
+	// newSpokeDynamicClient is overridden in tests
+	newSpokeDynamicClient func(ctx context.Context, clusterName string) (dynamic.Interface, error)
 }
 
 var (
-	_ controller.Reconciler  = (*Reconciler)(nil)
-	_ reconciler.LeaderAware = (*Reconciler)(nil)
+	_ workloadreconciler.Interface = (*Reconciler)(nil)
+	_ workloadreconciler.Finalizer = (*Reconciler)(nil)
 )
 
-// Promote implements reconciler.LeaderAware
-func (r *Reconciler) Promote(b reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
-	// Return nil to indicate we don't need special promotion logic
-	return nil
+// ReconcileKind syncs the secret of a PipelineRun owned Workload to its spoke cluster. The
+// generated reconciler only calls it for the Workloads of the buckets this replica leads.
+func (r *Reconciler) ReconcileKind(ctx context.Context, workload *kueuev1beta1.Workload) reconciler.Event {
+	return r.observe(ctx, workload, r.reconcile)
 }
 
-// Demote implements reconciler.LeaderAware
-func (r *Reconciler) Demote(b reconciler.Bucket) {
-	// Nothing to do on demotion
+// FinalizeKind cleans up the synced secrets of a deleted Workload, the generated reconciler
+// then removes the cleanup finalizer.
+func (r *Reconciler) FinalizeKind(ctx context.Context, workload *kueuev1beta1.Workload) reconciler.Event {
+	return r.observe(ctx, workload, func(ctx context.Context, workload *kueuev1beta1.Workload) error {
+		logging.FromContext(ctx).Infof("workload %s/%s is being deleted, cleaning up synced secrets", workload.GetNamespace(), workload.GetName())
+		r.pipelineRunPolls.clear(workload.GetNamespace() + "/" + workload.GetName())
+		return r.finalize(ctx, workload)
+	})
 }
 
-// Reconcile is the main entry point for reconciling Workload resources.
-// This function is called only for Workloads that have a PipelineRun owner reference.
-func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
-	logger := logging.FromContext(ctx)
-
-	// Parse the key
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		logger.Errorf("invalid resource key: %s", key)
-		return nil
+// observe runs a reconcile of the Workload under the liveness tracker, the failure escalation
+// and the reconcile metrics.
+func (r *Reconciler) observe(ctx context.Context, workload *kueuev1beta1.Workload, reconcile func(context.Context, *kueuev1beta1.Workload) error) error {
+	key := workload.GetNamespace() + "/" + workload.GetName()
+	// While the hub API server throttles the controller, the Workloads are requeued without a
+	// request, jittered so they don't all come back at once
+	if delay := r.hubThrottle.delay(); delay > 0 {
+		logging.FromContext(ctx).Debugf("the hub API server is throttling the controller, requeuing workload %s after %s", key, delay)
+		return controller.NewRequeueAfter(wait.Jitter(delay, 0.5))
+	}
+	defer r.tracker.start(key)()
+	// A requested rotation is only attempted once, the rotator requests it again if still due
+	defer r.rotations.done(key)
+	start := time.Now()
+	err := r.escalate(key, reconcile(ctx, workload))
+	recordReconcile(ctx, time.Since(start), err)
+	// A hub secret update is kept until it reached the spoke cluster
+	if err == nil {
+		r.hubSecretUpdates.done(key)
 	}
+	return err
+}
 
-	logger = logger.With("namespace", namespace, "workload", name)
-	logger.Debugf("reconciling workload %s/%s", namespace, name)
+// leaderChecker reports whether this replica is leader for a key, like reconciler.LeaderAwareFuncs.
+type leaderChecker interface {
+	IsLeaderFor(key types.NamespacedName) bool
+}
 
-	workload, err := r.workloadLister.Workloads(namespace).Get(name)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			logger.Debugf("workload %s/%s no longer exists, may be deleted, skipping reconciliation", namespace, name)
-			return nil
-		}
-		logger.Errorf("error getting workload %s/%s: %v", namespace, name, err)
-		return err
-	}
+// isLeaderFor reports whether this replica leads the bucket of the Workload key.
+func (r *Reconciler) isLeaderFor(key types.NamespacedName) bool {
+	return r.leader != nil && r.leader.IsLeaderFor(key)
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, workload *kueuev1beta1.Workload) (err error) {
+	namespace, name := workload.GetNamespace(), workload.GetName()
+	logger := logging.FromContext(ctx).With("namespace", namespace, "workload", name)
+	logger.Debugf("reconciling workload %s/%s", namespace, name)
 
 	if workload.Spec.Active != nil && !*workload.Spec.Active {
 		logger.Infof("workload %s/%s is not active, skipping reconciliation", namespace, name)
@@ -86,11 +276,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
 	}
 
 	if workload.Status.ClusterName == nil || *workload.Status.ClusterName == "" {
-		logger.Infof("workload %s/%s has no cluster name, skipping reconciliation", namespace, name)
-		return nil
+		// Don't rely on the update dispatching it, jittered so a burst of new Workloads
+		// isn't reconciled again all at once
+		delay := wait.Jitter(unscheduledRequeueDelay, 1.0)
+		logger.Infof("workload %s/%s has no cluster name yet, requeuing it after %s", namespace, name, delay)
+		return controller.NewRequeueAfter(delay)
 	}
 
-	ownerPipelineRunReference := metav1.GetControllerOf(workload)
+	ownerPipelineRunReference, err := r.pipelineRunOwner(ctx, workload)
+	if err != nil {
+		logger.Errorf("error resolving the owner PipelineRun of workload %s/%s: %v", namespace, name, err)
+		return err
+	}
 
 	if ownerPipelineRunReference == nil {
 		logger.Infof("workload %s/%s has no owner PipelineRun, skipping reconciliation", namespace, name)
@@ -108,66 +305,262 @@ func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
 
 	logger = logger.With("PipelineRun", ownerPipelineRunReference.Name)
 
-	spokeClusterConfig, err := r.getSpokeClusterConfig(ctx, *workload.Status.ClusterName)
+	if r.spokeSecretMode == spokeSecretModePull {
+		logger.Debugf("secrets of workload %s/%s are pulled by the agent of spoke cluster %s, skipping reconciliation", namespace, name, *workload.Status.ClusterName)
+		return nil
+	}
+
+	excluded, err := r.spokeNamespaceExcluded(ctx, *workload.Status.ClusterName, syncer.SpokeNamespace(workload))
 	if err != nil {
-		r.logger.Errorf("error getting spoke cluster config for workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		logger.Errorf("error resolving the settings of spoke cluster %s for workload %s/%s: %v", *workload.Status.ClusterName, namespace, name, err)
+		return err
+	}
+	if excluded {
+		logger.Infof("namespace %s of spoke cluster %s is excluded, skipping reconciliation of workload %s/%s", syncer.SpokeNamespace(workload), *workload.Status.ClusterName, namespace, name)
+		return nil
+	}
+
+	// Revoked credentials are pulled from the spoke clusters before anything else
+	if revoked := r.hubSecretRevocations.revoked(namespace + "/" + name); len(revoked) > 0 {
+		return r.revokeSpokeSecrets(ctx, workload, revoked)
+	}
+
+	// Kueue reports the remote completion on the hub, the hub secrets are released without
+	// reaching the spoke cluster. The ephemeral credentials are deleted from the spoke cluster
+	// once its PipelineRun is seen done.
+	if meta.IsStatusConditionTrue(workload.Status.Conditions, kueuev1beta1.WorkloadFinished) && !r.source().ephemeral() {
+		conditions := &syncConditions{}
+		err := r.workloadFinished(withSyncConditions(ctx, conditions), workload)
+		r.reportSyncConditions(ctx, workload, conditions)
 		return err
 	}
 
-	spokeKubeClient, err := kubernetes.NewForConfig(spokeClusterConfig)
+	if retryAfter, down := r.spokeProbes.down(*workload.Status.ClusterName); down {
+		logger.Infof("spoke cluster %s is unreachable, requeuing workload %s/%s after %s", *workload.Status.ClusterName, namespace, name, retryAfter)
+		return controller.NewRequeueAfter(retryAfter)
+	}
+
+	release, retryAfter, ok := r.clusterGuards.acquire(*workload.Status.ClusterName)
+	if !ok {
+		logger.Infof("spoke cluster %s is busy or its circuit is open, requeuing workload %s/%s after %s", *workload.Status.ClusterName, namespace, name, retryAfter)
+		return controller.NewRequeueAfter(retryAfter)
+	}
+	defer release()
+
+	// The Workloads dispatched to a reachable spoke cluster get their sync state and the
+	// conditions of its phases written back
+	var synced []syncedSecretRef
+	conditions := &syncConditions{}
+	ctx = withSyncConditions(ctx, conditions)
+	defer func() { r.reportSyncState(ctx, workload, synced, conditions, err) }()
+
+	spokeKubeClient, spokeTektonClient, err := r.getSpokeClients(ctx, *workload.Status.ClusterName)
 	if err != nil {
-		r.logger.Errorf("error creating spoke kube client: %v", err)
+		r.logger.Errorf("error creating spoke clients for workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		conditions.set(conditionClusterResolved, false, clusterResolveFailedReason, err.Error())
 		return err
 	}
+	conditions.set(conditionClusterResolved, true, clusterResolvedReason, fmt.Sprintf("resolved the kubeconfig of spoke cluster %s", *workload.Status.ClusterName))
+
+	// A resync requested by an operator, e.g. after fixing the spoke cluster, discovers it again
+	// and refreshes every synced secret
+	resync := r.resyncs != nil && resyncRequested(workload)
+	if resync {
+		logger.Infof("resync of workload %s/%s requested with %s=%s", namespace, name, resyncAnnotation, workload.GetAnnotations()[resyncAnnotation])
+		r.spokeDiscovery.forget(*workload.Status.ClusterName)
+		r.resyncs.request(namespace + "/" + name)
+		defer r.resyncs.done(namespace + "/" + name)
+	}
+
+	if err := r.checkSpokeCapabilities(ctx, *workload.Status.ClusterName, spokeKubeClient); err != nil {
+		r.logger.Errorf("error checking the capabilities of spoke cluster %s for workload %s/%s: %v", *workload.Status.ClusterName, workload.GetNamespace(), workload.GetName(), err)
+		conditions.set(conditionSpokeReachable, false, failureReason(err, spokeUnreachableReason), err.Error())
+		return r.rejectionError(workload, err)
+	}
+	conditions.set(conditionSpokeReachable, true, spokeReachableReason, fmt.Sprintf("spoke cluster %s is reachable", *workload.Status.ClusterName))
+
+	if err := syncer.ValidateSpokeNamespace(workload); err != nil {
+		logger.Errorf("not syncing the secrets of workload %s/%s: %v", namespace, name, err)
+		return controller.NewPermanentError(err)
+	}
 
-	spokeTektonClient, err := tektonversioned2.NewForConfig(spokeClusterConfig)
+	secretName, pipelineRun, err := r.validatePLRAndGetSecretName(ctx, spokeTektonClient, ownerPipelineRunReference.Name, syncer.SpokeNamespace(workload), *workload.Status.ClusterName)
+	r.clusterGuards.record(ctx, *workload.Status.ClusterName, err)
 	if err != nil {
-		r.logger.Errorf("error creating spoke tekton client for workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		conditions.set(conditionPLRFound, false, plrLookupFailedReason, err.Error())
 		return err
 	}
+	pipelineRun = hubPipelineRun(pipelineRun, workload)
+
+	if pipelineRun == nil {
+		conditions.set(conditionPLRFound, false, plrNotFoundReason, fmt.Sprintf("PipelineRun %s/%s not found on spoke cluster %s", syncer.SpokeNamespace(workload), ownerPipelineRunReference.Name, *workload.Status.ClusterName))
+		// The Workload status updates until the spoke PipelineRun shows up aren't enqueued, poll for it
+		delay, ok := r.pipelineRunPolls.next(namespace + "/" + name)
+		if !ok {
+			err := fmt.Errorf("PipelineRun %s/%s didn't show up on spoke cluster %s after %d polls", syncer.SpokeNamespace(workload), ownerPipelineRunReference.Name, *workload.Status.ClusterName, spokePipelineRunMaxPolls)
+			logger.Errorf("not polling workload %s/%s anymore, until its next event: %v", namespace, name, err)
+			return controller.NewPermanentError(err)
+		}
+		return controller.NewRequeueAfter(delay)
+	}
+	r.pipelineRunPolls.clear(namespace + "/" + name)
+	conditions.set(conditionPLRFound, true, plrFoundReason, fmt.Sprintf("found PipelineRun %s/%s on spoke cluster %s", syncer.SpokeNamespace(workload), ownerPipelineRunReference.Name, *workload.Status.ClusterName))
+
+	terminal, doneGrace := r.done.terminal(pipelineRun, time.Now())
+	if terminal {
+		return r.pipelineRunDone(ctx, workload, spokeKubeClient, pipelineRun)
+	}
+	if doneGrace > 0 {
+		// The done PipelineRun is checked again once its grace period is over, to clean up after it
+		defer func() { err = requeueWithin(err, doneGrace) }()
+	}
 
-	secretName, pipelineRun, err := r.validatePLRAndGetSecretName(ctx, spokeTektonClient, ownerPipelineRunReference.Name, workload.GetNamespace(), *workload.Status.ClusterName)
+	r.retryBudgets.set(namespace+"/"+name, pipelineRun)
+
+	// The secrets of the PipelineRun are collected first, then synced at once
+	var syncs []secretSync
+	if secretName != "" {
+		syncs = append(syncs, secretSync{name: secretName, sync: func(ctx context.Context) (string, time.Time, error) {
+			return r.createSecretOnSpokeCluster(ctx, secretName, *workload.Status.ClusterName, spokeKubeClient, pipelineRun, workload)
+		}})
+	}
+	repositorySyncs, err := r.repositorySecretSyncs(ctx, *workload.Status.ClusterName, spokeKubeClient, pipelineRun, workload, secretName)
+	if err != nil {
+		logger.Errorf("error getting the Repository secrets of PipelineRun %s/%s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), err)
+		return r.rejectionError(workload, err)
+	}
+	syncs = append(syncs, repositorySyncs...)
+	exclude := map[string]bool{secretName: true}
+	for _, s := range repositorySyncs {
+		exclude[s.name] = true
+	}
+	gitCASyncs, err := r.gitCASecretSyncs(ctx, *workload.Status.ClusterName, spokeKubeClient, pipelineRun, workload, exclude)
 	if err != nil {
+		logger.Errorf("error getting the git CA secret of PipelineRun %s/%s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), err)
 		return err
 	}
-	
-	if secretName == "" {
-		return nil
+	syncs = append(syncs, gitCASyncs...)
+	for _, s := range gitCASyncs {
+		exclude[s.name] = true
+	}
+	pipelineRunSyncs, err := r.pipelineRunSecretSyncs(ctx, *workload.Status.ClusterName, spokeKubeClient, pipelineRun, workload, exclude)
+	if err != nil {
+		logger.Errorf("error getting the secrets referenced by PipelineRun %s/%s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), err)
+		return err
 	}
+	syncs = append(syncs, pipelineRunSyncs...)
 
-	err = r.createSecretOnSpokeCluster(ctx, secretName, *workload.Status.ClusterName, spokeKubeClient, pipelineRun)
+	refs, expiry, err := r.syncSecrets(ctx, *workload.Status.ClusterName, syncer.SpokeNamespace(workload), syncs)
+	if err != nil {
+		logger.Errorf("error syncing the secrets of PipelineRun %s/%s to spoke cluster %s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), *workload.Status.ClusterName, err)
+		if r.recordPartiallySynced(ctx, workload, refs) {
+			synced = refs
+		}
+		// The secrets which couldn't be fetched never reached the apply
+		if !conditions.failed(conditionSecretFetched) {
+			conditions.set(conditionSecretApplied, false, failureReason(err, secretApplyFailedReason), err.Error())
+		}
+		return r.rejectionError(workload, err)
+	}
+	if len(syncs) > 0 {
+		conditions.set(conditionSecretApplied, true, secretAppliedReason, fmt.Sprintf("applied %d secrets to spoke cluster %s", len(refs), *workload.Status.ClusterName))
+	}
+	if _, gitDefault := r.resolverSecretNames(pipelineRun); gitDefault {
+		if err := r.syncGitResolverToken(ctx, *workload.Status.ClusterName, spokeKubeClient); err != nil {
+			logger.Errorf("error syncing the git resolver token of PipelineRun %s/%s to spoke cluster %s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), *workload.Status.ClusterName, err)
+			return err
+		}
+	}
+	configMapRefs, err := r.syncConfigMaps(ctx, *workload.Status.ClusterName, spokeKubeClient, pipelineRun, workload)
 	if err != nil {
-		logger.Errorf("error creating secret %s/%s on spoke cluster %s: %v", pipelineRun.GetNamespace(), secretName, *workload.Status.ClusterName, err)
+		logger.Errorf("error syncing the ConfigMaps of PipelineRun %s/%s to spoke cluster %s: %v", pipelineRun.GetNamespace(), pipelineRun.GetName(), *workload.Status.ClusterName, err)
+		return r.rejectionError(workload, err)
+	}
+	if len(refs) == 0 && len(configMapRefs) == 0 {
+		return r.recordResynced(ctx, workload, resync)
+	}
+
+	if err := r.recordSynced(ctx, workload, refs, configMapRefs); err != nil {
+		logger.Errorf("error adding finalizer to workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		return err
+	}
+	synced = refs
+	if err := r.recordResynced(ctx, workload, resync); err != nil {
+		logger.Errorf("error recording the resync of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
 		return err
 	}
 
 	logger.Infof("successfully reconciled workload %s/%s owned by PipelineRun %s",
 		workload.GetNamespace(), workload.GetName(), pipelineRun.GetName())
+
+	// Sync again before the token expires, while the spoke run may still need it
+	if delay, ok := r.resyncAfter(expiry); ok {
+		logger.Infof("token of secret %s/%s expires at %s, re-syncing in %s", pipelineRun.GetNamespace(), secretName, expiry.Format(time.RFC3339), delay)
+		return controller.NewRequeueAfter(delay)
+	}
 	return nil
 }
 
+// pipelineRunDone cleans up after the spoke PipelineRun of the Workload is done, both on the
+// reconciles of the Workload and from the spoke completion watcher.
+func (r *Reconciler) pipelineRunDone(ctx context.Context, workload *kueuev1beta1.Workload, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun) error {
+	key := workload.GetNamespace() + "/" + workload.GetName()
+	r.retryBudgets.clear(key)
+	secretName := pipelineRun.GetAnnotations()[gitAuthSecret]
+	var err error
+	if r.source().ephemeral() && secretName != "" {
+		// Credentials not backed by a hub Secret only live for the duration of the run
+		ref := syncedSecretRef{Cluster: *workload.Status.ClusterName, Namespace: syncer.SpokeNamespace(workload), Name: secretName}
+		err = r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, key, "PipelineRun done")
+	} else {
+		// The spoke run no longer needs the credentials, let the hub secret go
+		err = r.releaseHubSecret(ctx, workload, secretName)
+	}
+	syncConditionsFrom(ctx).cleanedUp(pipelineRunDoneReason, fmt.Sprintf("PipelineRun %s/%s is done", pipelineRun.GetNamespace(), pipelineRun.GetName()), err)
+	return err
+}
+
+// hubPipelineRun returns the spoke PipelineRun as seen from the hub, in the namespace of the
+// Workload, where its secrets and its other hub objects are read from. The spoke objects are
+// written to the spoke namespace of the Workload instead.
+func hubPipelineRun(pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) *v1.PipelineRun {
+	if pipelineRun == nil || pipelineRun.GetNamespace() == workload.GetNamespace() {
+		return pipelineRun
+	}
+	pipelineRun = pipelineRun.DeepCopy()
+	pipelineRun.Namespace = workload.GetNamespace()
+	return pipelineRun
+}
+
 func (r *Reconciler) validatePLRAndGetSecretName(ctx context.Context, spokeTektonClient tektonversioned2.Interface, plrName, plrNamespace, clusterName string) (string, *v1.PipelineRun, error) {
-	pipelineRun, err := spokeTektonClient.TektonV1().PipelineRuns(plrNamespace).Get(ctx, plrName, metav1.GetOptions{})
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	pipelineRun, err := r.getSpokePipelineRun(spokeCtx, clusterName, spokeTektonClient, plrNamespace, plrName)
+	err = spokeError(err)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			r.logger.Infof("PipelineRun %s/%s is not created yet on spoke cluster %s, skipping reconciliation: %v", plrNamespace, plrName, clusterName, err)
-			return "", nil, nil
-		}
 		r.logger.Errorf("error getting PipelineRun %s/%s on spoke cluster %s: %v", plrNamespace, plrName, clusterName, err)
 		return "", nil, err
 	}
+	if pipelineRun == nil {
+		r.logger.Infof("PipelineRun %s/%s is not created yet on spoke cluster %s, skipping reconciliation", plrNamespace, plrName, clusterName)
+		return "", nil, nil
+	}
 
 	r.logger.Infof("retrieved PipelineRun %s/%s successfully from spoke cluster %s", plrNamespace, plrName, clusterName)
 
-	if pipelineRun.IsDone() {
+	if terminal, _ := r.done.terminal(pipelineRun, time.Now()); terminal {
 		r.logger.Infof("PipelineRun %s/%s is done on spoke cluster %s, skipping reconciliation", plrNamespace, plrName, clusterName)
-		return "", nil, nil
+		return "", pipelineRun, nil
+	} else if pipelineRun.IsDone() {
+		r.logger.Infof("PipelineRun %s/%s is done on spoke cluster %s, still syncing it", plrNamespace, plrName, clusterName)
 	}
 
-	secretName, ok := pipelineRun.GetAnnotations()[gitAuthSecret]
+	secretName, ok := syncer.GitAuthSecret(pipelineRun)
 	if !ok {
 		r.logger.Infof("git auth secret not found for PipelineRun %s/%s on spoke cluster %s", plrNamespace, plrName, clusterName)
-		return "", nil, nil
+		// The Repository CR of the PipelineRun may still provide credentials
+		return "", pipelineRun, nil
 	}
 
 	r.logger.Infof("PipelineRun %s/%s has git auth secret %s", plrNamespace, plrName, secretName)
@@ -175,72 +568,217 @@ func (r *Reconciler) validatePLRAndGetSecretName(ctx context.Context, spokeTekto
 	return secretName, pipelineRun, nil
 }
 
-func (r *Reconciler) createSecretOnSpokeCluster(ctx context.Context, secretName string, clusterName string, spokeKubeClient *kubernetes.Clientset, pipelineRun *v1.PipelineRun) error {
-	secret, err := r.hubKubeClient.CoreV1().Secrets(pipelineRun.GetNamespace()).Get(ctx, secretName, metav1.GetOptions{})
+func (r *Reconciler) createSecretOnSpokeCluster(ctx context.Context, secretName string, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) (string, time.Time, error) {
+	if r.spokeSecretMode == spokeSecretModeExternalSecrets {
+		created, err := r.createExternalSecretOnSpokeCluster(ctx, secretName, clusterName, spokeKubeClient, pipelineRun, workload)
+		if err != nil || created {
+			return secretName, time.Time{}, err
+		}
+	}
+
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "PipelineRun dispatched to spoke cluster",
+		Cluster:     clusterName,
+		Secret:      pipelineRun.GetNamespace() + "/" + secretName,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}
+
+	source := r.source()
+	if r.hubSecretUpdates.requested(event.Workload) {
+		source = uncached(source)
+	}
+	secret, err := source.fetch(ctx, pipelineRun, secretName)
 	if err != nil {
 		r.logger.Errorf("error getting secret %s/%s for PipelineRun %s: %v", pipelineRun.GetNamespace(), secretName, pipelineRun.GetName(), err)
-		return err
+		syncConditionsFrom(ctx).fetched(pipelineRun, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	}
+	if err := revokedSecretError(secret); err != nil {
+		syncConditionsFrom(ctx).fetched(pipelineRun, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	}
+	if err := r.disallowedSecretError(secret); err != nil {
+		syncConditionsFrom(ctx).fetched(pipelineRun, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
 	}
+	syncConditionsFrom(ctx).fetched(pipelineRun, nil)
+	event = event.withContent(secret)
 
 	r.logger.Infof("retrieved secret %s/%s for PipelineRun %s successfully", pipelineRun.GetNamespace(), secretName, pipelineRun.GetName())
 
-	// Create a new secret object with only the required fields
-	newSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        secret.Name,
-			Namespace:   secret.Namespace,
-			Labels:      secret.Labels,
-			Annotations: secret.Annotations,
-		},
-		Type: secret.Type,
-		Data: secret.Data,
-	}
-
-	// Copy owner references if they exist
-	if len(secret.OwnerReferences) > 0 {
-		newSecret.OwnerReferences = make([]metav1.OwnerReference, len(secret.OwnerReferences))
-		for i, ref := range secret.OwnerReferences {
-			newSecret.OwnerReferences[i] = ref
-			// Override only the UID to point to the spoke cluster's PipelineRun
-			newSecret.OwnerReferences[i].UID = pipelineRun.GetUID()
+	if !source.ephemeral() {
+		if err := r.ensureHubSecretFinalizer(ctx, secret); err != nil {
+			r.logger.Errorf("error adding finalizer to secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			return "", time.Time{}, err
 		}
 	}
 
-	_, err = spokeKubeClient.CoreV1().Secrets(newSecret.Namespace).Create(ctx, newSecret, metav1.CreateOptions{})
-	if err != nil && !errors.IsAlreadyExists(err) {
-		r.logger.Errorf("error creating secret %s/%s: %v", newSecret.Namespace, newSecret.Name, err)
-		return err
+	spokeSecret, err := r.enforceSpokeSecretType(ctx, pipelineRun.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload))
+	if err != nil {
+		r.logger.Errorf("error enforcing the type of secret %s/%s for spoke cluster %s: %v", secret.Namespace, secret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
 	}
 
-	r.logger.Infof("successfully created secret %s/%s on spoke cluster %s", newSecret.Namespace, newSecret.Name, clusterName)
-	return nil
+	name, expiry, err := r.writeSpokeSecret(ctx, clusterName, spokeKubeClient, workload.GetNamespace(), spokeSecret, event)
+	if err != nil || !isSSHAuthSecret(secret) {
+		return name, expiry, err
+	}
+	if err := r.syncKnownHosts(ctx, clusterName, spokeKubeClient, pipelineRun, workload, name); err != nil {
+		r.logger.Errorf("error syncing the known_hosts of secret %s/%s to spoke cluster %s: %v", pipelineRun.GetNamespace(), name, clusterName, err)
+		return "", time.Time{}, err
+	}
+	return name, expiry, nil
 }
 
-// getSpokeClusterConfig retrieves the REST config for a spoke cluster.
-func (r *Reconciler) getSpokeClusterConfig(ctx context.Context, clusterName string) (*rest.Config, error) {
-	mkCluster, err := r.kueueClient.KueueV1beta1().MultiKueueClusters().Get(ctx, clusterName, metav1.GetOptions{})
+// writeSpokeSecret rewrites the git hosts of the secret to the mirrors of the spoke cluster and
+// runs the pre-sync hooks on it, writes it to the spoke cluster, then runs the post-sync hooks.
+// It returns the name of the spoke secret, which only differs from the name of newSecret when the
+// suffix conflict policy renamed it.
+func (r *Reconciler) writeSpokeSecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, hubNamespace string, newSecret *corev1.Secret, event auditEvent) (string, time.Time, error) {
+	target := syncTarget(event)
+	newSecret, err := r.rewriteGitMirrors(ctx, clusterName, newSecret)
+	if err == nil {
+		newSecret, err = r.runPreSyncHooks(ctx, target, newSecret)
+	}
+	if err != nil {
+		r.logger.Errorf("error syncing secret %s to spoke cluster %s: %v", event.Secret, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	}
+	name, expiry, err := r.applySpokeSecret(ctx, clusterName, spokeKubeClient, hubNamespace, newSecret, event)
 	if err != nil {
-		return nil, fmt.Errorf("could not find MultiKueueCluster %s: %w", clusterName, err)
+		return "", time.Time{}, err
+	}
+	written := newSecret.DeepCopy()
+	written.Name = name
+	if err := r.hooks.runPost(ctx, target, written); err != nil {
+		r.logger.Errorf("error syncing secret %s/%s to spoke cluster %s: %v", written.Namespace, written.Name, clusterName, err)
+		return "", time.Time{}, err
+	}
+	return name, expiry, nil
+}
+
+// applySpokeSecret creates the secret on the spoke cluster, or refreshes the existing one, and
+// records the audit event of the sync. The secret counts against the quota of hubNamespace, the
+// namespace of its Workload.
+func (r *Reconciler) applySpokeSecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, hubNamespace string, newSecret *corev1.Secret, event auditEvent) (string, time.Time, error) {
+	if secretValuesSize(newSecret) > corev1.MaxSecretSize {
+		return r.writeOversizeSecret(ctx, clusterName, spokeKubeClient, hubNamespace, newSecret, event)
+	}
+	newSecret.OwnerReferences = withPipelineRunAPIVersion(newSecret.OwnerReferences, r.spokePipelineRunAPIVersion(clusterName))
+	ref := syncedSecretRef{Cluster: clusterName, Namespace: newSecret.Namespace, Name: newSecret.Name}
+	if err := r.quotas.reserve(hubNamespace, ref, newSecret); err != nil {
+		r.logger.Errorf("error syncing secret %s/%s to spoke cluster %s: %v", newSecret.Namespace, newSecret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
 	}
 
-	kubeConfig := mkCluster.Spec.KubeConfig
+	if r.spokeSecretMode == spokeSecretModeSealedSecrets {
+		return newSecret.Name, time.Time{}, r.createSealedSecretOnSpokeCluster(ctx, clusterName, spokeKubeClient, newSecret, event)
+	}
 
-	switch kubeConfig.LocationType {
-	case "Secret":
-		kubeconfigSecret, err := r.hubKubeClient.CoreV1().Secrets(r.kueueNamespace).Get(ctx, kubeConfig.Location, metav1.GetOptions{})
-		if err != nil {
-			return nil, fmt.Errorf("could not get kubeconfig secret %s/%s: %w", r.kueueNamespace, kubeConfig.Location, err)
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	setChecksum(newSecret)
+	expiry, _ := secretExpiry(newSecret)
+	created, err := spokeKubeClient.CoreV1().Secrets(newSecret.Namespace).Create(spokeCtx, newSecret, metav1.CreateOptions{})
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if errors.IsAlreadyExists(err) {
+		var (
+			existing *corev1.Secret
+			reason   string
+		)
+		rotate, updated, requested := r.rotations.requested(event.Workload), r.hubSecretUpdates.requested(event.Workload), r.resyncs.requested(event.Workload)
+		if existing, reason, err = r.refreshSpokeSecret(spokeCtx, clusterName, spokeKubeClient, newSecret, rotate, updated, requested); err != nil {
+			if renamed, ok := conflictSecret(newSecret); ok && stderrors.Is(err, ErrSecretConflict) && r.clusterConflictPolicy(ctx, clusterName) == conflictPolicySuffix {
+				r.logger.Infof("%v, syncing it as %s/%s instead", err, renamed.Namespace, renamed.Name)
+				r.quotas.release(ref)
+				return r.applySpokeSecret(ctx, clusterName, spokeKubeClient, hubNamespace, renamed, event)
+			}
+			r.logger.Errorf("error refreshing secret %s/%s: %v", newSecret.Namespace, newSecret.Name, err)
+			r.quotas.release(ref)
+			event.Outcome, event.Error = auditOutcomeFailure, err
+			r.recordDecision(event)
+			return "", time.Time{}, err
 		}
-
-		kubeconfigBytes, ok := kubeconfigSecret.Data["kubeconfig"]
-		if !ok {
-			return nil, fmt.Errorf("kubeconfig secret %s/%s is missing 'kubeconfig' data key", r.kueueNamespace, kubeConfig.Location)
+		expiry, _ = secretExpiry(existing)
+		event = event.withSpokeObject(existing)
+		event.Outcome = auditOutcomeUnchanged
+		if reason != "" {
+			event.Outcome, event.Reason = auditOutcomeSuccess, reason
 		}
+	} else if err != nil {
+		r.logger.Errorf("error creating secret %s/%s: %v", newSecret.Namespace, newSecret.Name, err)
+		r.quotas.release(ref)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", time.Time{}, err
+	} else {
+		event = event.withSpokeObject(created)
+		event.Outcome = auditOutcomeSuccess
+	}
+	r.recordDecision(event)
+
+	r.logger.Infof("successfully created secret %s/%s on spoke cluster %s", newSecret.Namespace, newSecret.Name, clusterName)
+	return newSecret.Name, expiry, nil
+}
+
+// spokeContext returns the context to use for a single call to a spoke API server, so a hung
+// spoke doesn't block the reconcile worker for the default client timeout.
+func (r *Reconciler) spokeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.spokeRequestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.spokeRequestTimeout)
+}
 
-		return clientcmd.RESTConfigFromKubeConfig(kubeconfigBytes)
-	case "Path":
-		return clientcmd.BuildConfigFromFlags("", kubeConfig.Location)
-	default:
-		return nil, fmt.Errorf("unsupported kubeconfig location type: %s", kubeConfig.LocationType)
+// spokeSyncer returns the library syncing the secrets, configured like the reconciler.
+func (r *Reconciler) spokeSyncer() syncer.Syncer {
+	return syncer.New(syncer.Options{
+		HubKubeClient:           r.hubKubeClient,
+		KueueClient:             r.kueueClient,
+		KueueNamespace:          r.kueueNamespace,
+		MultiKueueClusterLister: r.multiKueueClusterLister,
+		KubeconfigSecretLister:  r.kubeconfigSecretLister,
+		SpokeClientQPS:          r.spokeClientQPS,
+		SpokeClientBurst:        r.spokeClientBurst,
+		KubeconfigContext:       r.kubeconfigContext,
+		ConfigureSpoke:          r.configureSpoke,
+		DryRun:                  r.dryRun,
+		Logger:                  r.logger,
+	})
+}
+
+// getSpokeClients returns the Kubernetes and Tekton clients for a spoke cluster, and resolves
+// the identity they use for the audit events. The identity is best effort, it never fails the sync.
+func (r *Reconciler) getSpokeClients(ctx context.Context, clusterName string) (kubernetes.Interface, tektonversioned2.Interface, error) {
+	spokeKubeClient, spokeTektonClient, err := r.cachedSpokeClients(ctx, clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+	if err := r.spokeIdentities.resolve(spokeCtx, clusterName, spokeKubeClient); err != nil {
+		r.logger.Debugf("auditing the writes to spoke cluster %s without its identity: %v", clusterName, err)
 	}
+	return spokeKubeClient, spokeTektonClient, nil
+}
+
+// getSpokeClusterConfig retrieves the REST config for a spoke cluster.
+func (r *Reconciler) getSpokeClusterConfig(ctx context.Context, clusterName string) (*rest.Config, error) {
+	return r.spokeSyncer().SpokeConfig(ctx, clusterName)
 }
@@ -2,9 +2,11 @@ package reconciler
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
@@ -17,11 +19,16 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
 	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
 	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
 	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
 )
 
 const (
@@ -62,6 +69,7 @@ func TestGetSpokeClusterConfig(t *testing.T) {
 		expectError        bool
 		errorContains      string
 		exactErrorMessage  string
+		errorIs            error
 		validateConfig     func(*testing.T, *rest.Config)
 	}{
 		{
@@ -127,6 +135,7 @@ func TestGetSpokeClusterConfig(t *testing.T) {
 			secrets:            []runtime.Object{},
 			expectError:        true,
 			errorContains:      fmt.Sprintf("could not find MultiKueueCluster %s:", testClusterName),
+			errorIs:            ErrClusterNotFound,
 		},
 		{
 			name:        "fail when secret not found",
@@ -177,6 +186,7 @@ func TestGetSpokeClusterConfig(t *testing.T) {
 			},
 			expectError:       true,
 			exactErrorMessage: fmt.Sprintf("kubeconfig secret %s/%s is missing 'kubeconfig' data key", testKueueNamespace, testSecretName),
+			errorIs:           ErrSecretMissingKey,
 		},
 		{
 			name:        "fail with unsupported location type",
@@ -368,47 +378,66 @@ func TestGetSpokeClusterConfig(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
+		for _, cached := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s cached=%t", tt.name, cached), func(t *testing.T) {
+				ctx := context.Background()
 
-			// Create fake clients with the objects
-			fakeKueueClient := kueuefake.NewSimpleClientset(tt.multiKueueClusters...)
-			fakeKubeClient := fake.NewSimpleClientset(tt.secrets...)
+				// Create fake clients with the objects
+				fakeKueueClient := kueuefake.NewSimpleClientset(tt.multiKueueClusters...)
+				fakeKubeClient := fake.NewSimpleClientset(tt.secrets...)
 
-			// Create reconciler
-			reconciler := &Reconciler{
-				logger:         zap.NewNop().Sugar(),
-				hubKubeClient:  fakeKubeClient,
-				kueueClient:    fakeKueueClient,
-				kueueNamespace: testKueueNamespace,
-			}
+				// Create reconciler
+				reconciler := &Reconciler{
+					logger:         zap.NewNop().Sugar(),
+					hubKubeClient:  fakeKubeClient,
+					kueueClient:    fakeKueueClient,
+					kueueNamespace: testKueueNamespace,
+				}
+				if cached {
+					clusters := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+					for _, obj := range tt.multiKueueClusters {
+						assert.NilError(t, clusters.Add(obj))
+					}
+					secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+					for _, obj := range tt.secrets {
+						assert.NilError(t, secrets.Add(obj))
+					}
+					reconciler.multiKueueClusterLister = kueuev1beta1lister.NewMultiKueueClusterLister(clusters)
+					reconciler.kubeconfigSecretLister = corev1lister.NewSecretLister(secrets)
+					// The caches are read instead of the API server
+					reconciler.hubKubeClient, reconciler.kueueClient = nil, nil
+				}
 
-			// Test getSpokeClusterConfig
-			config, err := reconciler.getSpokeClusterConfig(ctx, tt.clusterName)
+				// Test getSpokeClusterConfig
+				config, err := reconciler.getSpokeClusterConfig(ctx, tt.clusterName)
 
-			// Validate error expectations
-			if tt.expectError {
-				if err == nil {
-					t.Fatalf("expected error, got nil")
-				}
-				if tt.exactErrorMessage != "" {
-					if err.Error() != tt.exactErrorMessage {
-						t.Errorf("expected error %q, got: %v", tt.exactErrorMessage, err)
+				// Validate error expectations
+				if tt.expectError {
+					if err == nil {
+						t.Fatalf("expected error, got nil")
+					}
+					if tt.exactErrorMessage != "" {
+						if err.Error() != tt.exactErrorMessage {
+							t.Errorf("expected error %q, got: %v", tt.exactErrorMessage, err)
+						}
+					} else if tt.errorContains != "" {
+						if !strings.Contains(err.Error(), tt.errorContains) {
+							t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+						}
 					}
-				} else if tt.errorContains != "" {
-					if !strings.Contains(err.Error(), tt.errorContains) {
-						t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+					if tt.errorIs != nil && !stderrors.Is(err, tt.errorIs) {
+						t.Errorf("expected error to be %v, got: %v", tt.errorIs, err)
 					}
+				} else if err != nil {
+					t.Fatalf("expected no error, got: %v", err)
 				}
-			} else if err != nil {
-				t.Fatalf("expected no error, got: %v", err)
-			}
 
-			// Validate config if validation function is provided
-			if tt.validateConfig != nil && config != nil {
-				tt.validateConfig(t, config)
-			}
-		})
+				// Validate config if validation function is provided
+				if tt.validateConfig != nil && config != nil {
+					tt.validateConfig(t, config)
+				}
+			})
+		}
 	}
 }
 
@@ -554,3 +583,87 @@ func TestValidatePLRAndGetSecretName(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateSecretOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-secret",
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{"hub-label": "value"},
+			Annotations: map[string]string{"hub-annotation": "value"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid"},
+			},
+		},
+		Data: map[string][]byte{"token": []byte("secret-token")},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	spokeKubeClient := fake.NewSimpleClientset()
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(hubSecret),
+	}
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	spokeSecret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]string{"hub-label": "value", managedByLabel: managedByValue}, spokeSecret.Labels)
+	assert.Equal(t, "test-namespace/test-workload", spokeSecret.Annotations[workloadAnnotation])
+	assert.Equal(t, "test-namespace/test-pipeline-run", spokeSecret.Annotations[pipelineRunAnnotation])
+	assert.Equal(t, "value", spokeSecret.Annotations["hub-annotation"])
+	assert.Equal(t, "spoke-uid", string(spokeSecret.OwnerReferences[0].UID))
+	assert.DeepEqual(t, hubSecret.Data, spokeSecret.Data)
+	assert.Equal(t, 0, len(hubSecret.Annotations[workloadAnnotation]), "hub secret must not be mutated")
+
+	// The target namespace of the Workload redirects the spoke secret, read from the hub namespace
+	workload.Annotations = map[string]string{targetNamespaceAnnotation: "remote-runs"}
+	spokePipelineRun := pipelineRun.DeepCopy()
+	spokePipelineRun.Namespace = "remote-runs"
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, hubPipelineRun(spokePipelineRun, workload), workload)
+	assert.NilError(t, err)
+	spokeSecret, err = spokeKubeClient.CoreV1().Secrets("remote-runs").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "remote-runs/test-pipeline-run", spokeSecret.Annotations[pipelineRunAnnotation])
+	assert.Equal(t, "remote-runs", spokePipelineRun.Namespace, "spoke PipelineRun must not be mutated")
+}
+
+func TestSpokeContext(t *testing.T) {
+	ctx := context.Background()
+
+	r := &Reconciler{}
+	spokeCtx, cancel := r.spokeContext(ctx)
+	_, hasDeadline := spokeCtx.Deadline()
+	assert.Assert(t, !hasDeadline, "no deadline without a timeout")
+	cancel()
+
+	r.spokeRequestTimeout = time.Minute
+	spokeCtx, cancel = r.spokeContext(ctx)
+	deadline, hasDeadline := spokeCtx.Deadline()
+	assert.Assert(t, hasDeadline)
+	assert.Assert(t, time.Until(deadline) <= time.Minute)
+	cancel()
+	assert.ErrorIs(t, spokeCtx.Err(), context.Canceled)
+}
+
+func TestReconcileUnscheduledWorkload(t *testing.T) {
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+	workload := pipelineRunOwnedWorkload("test-namespace", "test-workload")
+
+	for range 10 {
+		ok, delay := controller.IsRequeueKey(r.reconcile(context.Background(), workload))
+		assert.Assert(t, ok, "expected a requeue")
+		assert.Assert(t, delay >= unscheduledRequeueDelay && delay < 2*unscheduledRequeueDelay, "unexpected delay %s", delay)
+	}
+
+	// Inactive Workloads aren't dispatched, don't requeue them
+	workload.Spec.Active = ptr.To(false)
+	assert.NilError(t, r.reconcile(context.Background(), workload))
+}
@@ -0,0 +1,58 @@
+package reconciler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// pipelineRunRecreated reports whether the existing spoke object was synced for an earlier
+// PipelineRun of the name of the one it is synced for now, deleted and created again since, so
+// its owner references point to the deleted run and the garbage collector would delete it from
+// under the new one. The objects synced before the UID was recorded are checked against the UID
+// of their PipelineRun owner reference.
+func pipelineRunRecreated(existing, synced metav1.Object) bool {
+	uid := synced.GetAnnotations()[pipelineRunUIDAnnotation]
+	if uid == "" || existing.GetAnnotations()[pipelineRunAnnotation] != synced.GetAnnotations()[pipelineRunAnnotation] {
+		// An object shared with the other PipelineRuns of the namespace is not rebound by them
+		return false
+	}
+	if recorded, ok := existing.GetAnnotations()[pipelineRunUIDAnnotation]; ok {
+		return recorded != uid
+	}
+	for _, ref := range pipelineRunOwnerReferences(existing) {
+		if string(ref.UID) != uid {
+			return true
+		}
+	}
+	return false
+}
+
+// reboundOwnerReferences returns the owner references of the existing spoke object with its
+// PipelineRun owner references pointing to the PipelineRun it is synced for now.
+func reboundOwnerReferences(existing, synced metav1.Object) []metav1.OwnerReference {
+	uid := types.UID(synced.GetAnnotations()[pipelineRunUIDAnnotation])
+	refs := make([]metav1.OwnerReference, len(existing.GetOwnerReferences()))
+	copy(refs, existing.GetOwnerReferences())
+	for i := range refs {
+		if isPipelineRunOwnerReference(refs[i], existing) {
+			refs[i].UID = uid
+		}
+	}
+	return refs
+}
+
+// pipelineRunOwnerReferences returns the owner references of the spoke object pointing to the
+// PipelineRun it was synced for.
+func pipelineRunOwnerReferences(object metav1.Object) []metav1.OwnerReference {
+	var refs []metav1.OwnerReference
+	for _, ref := range object.GetOwnerReferences() {
+		if isPipelineRunOwnerReference(ref, object) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+func isPipelineRunOwnerReference(ref metav1.OwnerReference, object metav1.Object) bool {
+	return ref.Kind == "PipelineRun" && object.GetNamespace()+"/"+ref.Name == object.GetAnnotations()[pipelineRunAnnotation]
+}
@@ -0,0 +1,139 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestPipelineRunRecreated(t *testing.T) {
+	synced := metav1.ObjectMeta{Namespace: "test-namespace", Annotations: map[string]string{
+		pipelineRunAnnotation:    "test-namespace/test-pipeline-run",
+		pipelineRunUIDAnnotation: "new-uid",
+	}}
+	owner := func(name, uid string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: "PipelineRun", Name: name, UID: types.UID(uid)}}
+	}
+
+	tests := []struct {
+		name     string
+		existing metav1.ObjectMeta
+		expected bool
+	}{
+		{
+			name:     "same PipelineRun",
+			existing: synced,
+		},
+		{
+			name: "recreated PipelineRun",
+			existing: metav1.ObjectMeta{Namespace: "test-namespace", Annotations: map[string]string{
+				pipelineRunAnnotation:    "test-namespace/test-pipeline-run",
+				pipelineRunUIDAnnotation: "old-uid",
+			}},
+			expected: true,
+		},
+		{
+			name: "recreated PipelineRun synced without the UID",
+			existing: metav1.ObjectMeta{
+				Namespace:       "test-namespace",
+				Annotations:     map[string]string{pipelineRunAnnotation: "test-namespace/test-pipeline-run"},
+				OwnerReferences: owner("test-pipeline-run", "old-uid"),
+			},
+			expected: true,
+		},
+		{
+			name: "synced without the UID nor an owner",
+			existing: metav1.ObjectMeta{
+				Namespace:   "test-namespace",
+				Annotations: map[string]string{pipelineRunAnnotation: "test-namespace/test-pipeline-run"},
+			},
+		},
+		{
+			name: "shared with another PipelineRun",
+			existing: metav1.ObjectMeta{
+				Namespace: "test-namespace",
+				Annotations: map[string]string{
+					pipelineRunAnnotation:    "test-namespace/other-pipeline-run",
+					pipelineRunUIDAnnotation: "other-uid",
+				},
+				OwnerReferences: owner("other-pipeline-run", "other-uid"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, pipelineRunRecreated(&corev1.Secret{ObjectMeta: tt.existing}, &corev1.Secret{ObjectMeta: synced}))
+		})
+	}
+}
+
+func TestCreateSecretOnSpokeClusterRebindsRecreatedPipelineRun(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "new-uid"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid"}},
+		},
+		Data: map[string][]byte{defaultSecretDataKey: []byte("token")},
+	}
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "test-namespace",
+			Labels:    map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{
+				workloadAnnotation:       "test-namespace/test-workload",
+				pipelineRunAnnotation:    "test-namespace/test-pipeline-run",
+				pipelineRunUIDAnnotation: "old-uid",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Name: "test-pipeline-run", UID: "old-uid"},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "other-owner", UID: "configmap-uid"},
+			},
+		},
+		Data: map[string][]byte{defaultSecretDataKey: []byte("token")},
+	})
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(hubSecret),
+	}
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "new-uid", secret.Annotations[pipelineRunUIDAnnotation])
+	assert.DeepEqual(t, []metav1.OwnerReference{
+		{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Name: "test-pipeline-run", UID: "new-uid"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "other-owner", UID: "configmap-uid"},
+	}, secret.OwnerReferences)
+}
+
+func TestConfigMapSyncedRecreatedPipelineRun(t *testing.T) {
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"}}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "test-namespace"}, Data: map[string]string{"key": "value"}}
+	run := func(uid string) *v1.PipelineRun {
+		return &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: types.UID(uid)}}
+	}
+
+	existing := spokeConfigMap(configMap, run("old-uid"), workload, "tekton.dev/v1")
+	assert.Assert(t, configMapSynced(existing, spokeConfigMap(configMap, run("old-uid"), workload, "tekton.dev/v1")))
+	assert.Assert(t, !configMapSynced(existing, spokeConfigMap(configMap, run("new-uid"), workload, "tekton.dev/v1")))
+}
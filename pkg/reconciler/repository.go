@@ -0,0 +1,182 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// repositoryLabel is set by Pipelines-as-Code on PipelineRuns to the name of their Repository CR.
+	repositoryLabel = groupName + "/repository"
+
+	// providerSecretAnnotation asks for the provider secrets of the PipelineRun's Repository CR,
+	// webhook secret included, to be synced for tasks calling back to the provider.
+	providerSecretAnnotation = syncerGroupName + "/sync-provider-secret"
+
+	// defaultRepositorySecretKey is the key Pipelines-as-Code reads the provider token from when
+	// the Repository's git_provider.secret has none.
+	defaultRepositorySecretKey = "provider.token"
+
+	// defaultRepositoryWebhookSecretKey is the key Pipelines-as-Code reads the webhook secret from
+	// when the Repository's git_provider.webhook_secret has none.
+	defaultRepositoryWebhookSecretKey = "webhook.secret"
+)
+
+// repositoryGVR is the Pipelines-as-Code Repository CR.
+var repositoryGVR = schema.GroupVersionResource{Group: groupName, Version: "v1alpha1", Resource: "repositories"}
+
+// providerSecretRequested reports whether the PipelineRun asks for its provider secrets with the
+// providerSecretAnnotation.
+func providerSecretRequested(pipelineRun *v1.PipelineRun) bool {
+	requested, _ := strconv.ParseBool(pipelineRun.GetAnnotations()[providerSecretAnnotation])
+	return requested
+}
+
+// repositorySecretKeys returns the keys of each Secret referenced by the git_provider of the
+// Repository CR the PipelineRun was created for: the provider token, and the webhook secret when
+// webhook is set. It is empty when there is none.
+func (r *Reconciler) repositorySecretKeys(ctx context.Context, pipelineRun *v1.PipelineRun, webhook bool) (map[string][]string, error) {
+	repositoryName := pipelineRun.GetLabels()[repositoryLabel]
+	if repositoryName == "" {
+		return nil, nil
+	}
+
+	repository, err := r.hubDynamicClient.Resource(repositoryGVR).Namespace(pipelineRun.GetNamespace()).Get(ctx, repositoryName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		r.logger.Infof("Repository %s/%s of PipelineRun %s does not exist", pipelineRun.GetNamespace(), repositoryName, pipelineRun.GetName())
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get Repository %s/%s: %w", pipelineRun.GetNamespace(), repositoryName, err)
+	}
+
+	keys := map[string][]string{}
+	name, key, err := repositorySecretField(repository, "secret", "", defaultRepositorySecretKey)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		keys[name] = append(keys[name], key)
+	}
+	if webhook {
+		// Pipelines-as-Code reads the webhook secret from the provider secret unless told otherwise
+		webhookName, webhookKey, err := repositorySecretField(repository, "webhook_secret", name, defaultRepositoryWebhookSecretKey)
+		if err != nil {
+			return nil, err
+		}
+		if webhookName != "" {
+			keys[webhookName] = append(keys[webhookName], webhookKey)
+		}
+	}
+	return keys, nil
+}
+
+// repositorySecretField returns the name and key of a secret reference of the Repository's
+// git_provider, falling back to the given defaults.
+func repositorySecretField(repository *unstructured.Unstructured, field, defaultName, defaultKey string) (string, string, error) {
+	name, _, err := unstructured.NestedString(repository.Object, "spec", "git_provider", field, "name")
+	if err != nil {
+		return "", "", fmt.Errorf("invalid git_provider.%s of Repository %s/%s: %w", field, repository.GetNamespace(), repository.GetName(), err)
+	}
+	key, _, err := unstructured.NestedString(repository.Object, "spec", "git_provider", field, "key")
+	if err != nil {
+		return "", "", fmt.Errorf("invalid git_provider.%s of Repository %s/%s: %w", field, repository.GetNamespace(), repository.GetName(), err)
+	}
+	if name == "" {
+		name = defaultName
+	}
+	if key == "" {
+		key = defaultKey
+	}
+	return name, key, nil
+}
+
+// repositorySecretSyncs returns the syncs copying the provider secrets referenced by the
+// Repository CR of the PipelineRun to the spoke cluster, covering webhook based Pipelines-as-Code
+// installs. Only the referenced keys are copied, so the webhook secret often stored next to the
+// provider token stays on the hub unless the PipelineRun asks for it. The git auth secret is
+// skipped, it is synced on its own.
+func (r *Reconciler) repositorySecretSyncs(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, gitAuthSecretName string) ([]secretSync, error) {
+	requested := providerSecretRequested(pipelineRun)
+	if !r.repositorySecrets && !requested {
+		return nil, nil
+	}
+
+	keys, err := r.repositorySecretKeys(ctx, pipelineRun, requested)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		if name != gitAuthSecretName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	syncs := make([]secretSync, 0, len(names))
+	for _, name := range names {
+		syncs = append(syncs, secretSync{name: name, sync: func(ctx context.Context) (string, time.Time, error) {
+			spokeSecretName, err := r.syncRepositorySecret(ctx, clusterName, spokeKubeClient, pipelineRun, workload, name, keys[name])
+			return spokeSecretName, time.Time{}, err
+		}})
+	}
+	return syncs, nil
+}
+
+// syncRepositorySecret copies the given keys of a single provider secret to the spoke cluster,
+// returning the name of the spoke secret.
+func (r *Reconciler) syncRepositorySecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload, name string, keys []string) (string, error) {
+	event := auditEvent{
+		Action:      auditActionSync,
+		Reason:      "Repository provider secret of PipelineRun dispatched to spoke cluster",
+		Cluster:     clusterName,
+		Secret:      pipelineRun.GetNamespace() + "/" + name,
+		Workload:    workload.GetNamespace() + "/" + workload.GetName(),
+		PipelineRun: pipelineRun.GetNamespace() + "/" + pipelineRun.GetName(),
+	}
+
+	secret, err := r.hubKubeClient.CoreV1().Secrets(pipelineRun.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		err = revokedSecretError(secret)
+	} else {
+		err = fmt.Errorf("could not get secret %s/%s: %w", pipelineRun.GetNamespace(), name, err)
+	}
+	if err != nil {
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return "", err
+	}
+
+	data := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			err := syncer.Classify(fmt.Errorf("secret %s/%s has no key %s", pipelineRun.GetNamespace(), name, key), ErrSecretMissingKey)
+			event.Outcome, event.Error = auditOutcomeFailure, err
+			r.recordDecision(event)
+			return "", err
+		}
+		data[key] = secret.Data[key]
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = data
+	secret.StringData = nil
+	event = event.withContent(secret)
+
+	spokeSecretName, _, err := r.writeSpokeSecret(ctx, clusterName, spokeKubeClient, workload.GetNamespace(), syncer.SpokeSecret(secret, pipelineRun, workload), event)
+	return spokeSecretName, err
+}
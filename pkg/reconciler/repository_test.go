@@ -0,0 +1,198 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func repository(name string, gitProviderSecret, webhookSecret map[string]any) *unstructured.Unstructured {
+	gitProvider := map[string]any{"secret": gitProviderSecret}
+	if webhookSecret != nil {
+		gitProvider["webhook_secret"] = webhookSecret
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": repositoryGVR.GroupVersion().String(),
+		"kind":       "Repository",
+		"metadata":   map[string]any{"name": name, "namespace": "test-namespace"},
+		"spec": map[string]any{
+			"url":          "https://gitlab.example.com/org/repo",
+			"git_provider": gitProvider,
+		},
+	}}
+}
+
+func TestSyncRepositorySecrets(t *testing.T) {
+	ctx := context.Background()
+	hubSecrets := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gitlab-webhook-config", Namespace: "test-namespace"},
+			Data: map[string][]byte{
+				"provider.token": []byte("glpat-token"),
+				"webhook.secret": []byte("webhook-secret"),
+				"custom.token":   []byte("custom-token"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gitlab-webhook-secret", Namespace: "test-namespace"},
+			Data:       map[string][]byte{"secret": []byte("other-webhook-secret")},
+		},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	withRepository := map[string]string{repositoryLabel: "test-repo"}
+	requested := map[string]string{providerSecretAnnotation: "true"}
+	providerSecret := map[string]any{"name": "gitlab-webhook-config"}
+
+	tests := []struct {
+		name              string
+		repositorySecrets bool
+		labels            map[string]string
+		annotations       map[string]string
+		gitAuthSecret     string
+		repositories      []runtime.Object
+		expectedData      map[string]map[string][]byte
+		expectedError     string
+	}{
+		{
+			name:         "disabled and not requested",
+			labels:       withRepository,
+			repositories: []runtime.Object{repository("test-repo", providerSecret, nil)},
+		},
+		{
+			name:              "PipelineRun without repository label",
+			repositorySecrets: true,
+		},
+		{
+			name:              "repository gone",
+			repositorySecrets: true,
+			labels:            withRepository,
+		},
+		{
+			name:              "repository without git provider secret",
+			repositorySecrets: true,
+			labels:            withRepository,
+			repositories:      []runtime.Object{repository("test-repo", map[string]any{}, nil)},
+		},
+		{
+			name:              "default provider token key",
+			repositorySecrets: true,
+			labels:            withRepository,
+			repositories:      []runtime.Object{repository("test-repo", providerSecret, nil)},
+			expectedData: map[string]map[string][]byte{
+				"gitlab-webhook-config": {"provider.token": []byte("glpat-token")},
+			},
+		},
+		{
+			name:              "custom key",
+			repositorySecrets: true,
+			labels:            withRepository,
+			repositories:      []runtime.Object{repository("test-repo", map[string]any{"name": "gitlab-webhook-config", "key": "custom.token"}, nil)},
+			expectedData: map[string]map[string][]byte{
+				"gitlab-webhook-config": {"custom.token": []byte("custom-token")},
+			},
+		},
+		{
+			name:         "requested by annotation",
+			labels:       withRepository,
+			annotations:  requested,
+			repositories: []runtime.Object{repository("test-repo", providerSecret, nil)},
+			expectedData: map[string]map[string][]byte{
+				"gitlab-webhook-config": {"provider.token": []byte("glpat-token"), "webhook.secret": []byte("webhook-secret")},
+			},
+		},
+		{
+			name:         "requested with separate webhook secret",
+			labels:       withRepository,
+			annotations:  requested,
+			repositories: []runtime.Object{repository("test-repo", providerSecret, map[string]any{"name": "gitlab-webhook-secret", "key": "secret"})},
+			expectedData: map[string]map[string][]byte{
+				"gitlab-webhook-config": {"provider.token": []byte("glpat-token")},
+				"gitlab-webhook-secret": {"secret": []byte("other-webhook-secret")},
+			},
+		},
+		{
+			name:         "not requested with invalid annotation",
+			labels:       withRepository,
+			annotations:  map[string]string{providerSecretAnnotation: "please"},
+			repositories: []runtime.Object{repository("test-repo", providerSecret, nil)},
+		},
+		{
+			name:              "already synced as the git auth secret",
+			repositorySecrets: true,
+			labels:            withRepository,
+			gitAuthSecret:     "gitlab-webhook-config",
+			repositories:      []runtime.Object{repository("test-repo", providerSecret, nil)},
+		},
+		{
+			name:              "missing key",
+			repositorySecrets: true,
+			labels:            withRepository,
+			repositories:      []runtime.Object{repository("test-repo", map[string]any{"name": "gitlab-webhook-config", "key": "missing"}, nil)},
+			expectedError:     "has no key missing",
+		},
+		{
+			name:          "missing webhook secret",
+			labels:        withRepository,
+			annotations:   requested,
+			repositories:  []runtime.Object{repository("test-repo", providerSecret, map[string]any{"name": "missing"})},
+			expectedError: "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spokeKubeClient := fake.NewSimpleClientset()
+			r := &Reconciler{
+				logger:            zap.NewNop().Sugar(),
+				hubKubeClient:     fake.NewSimpleClientset(hubSecrets...),
+				hubDynamicClient:  dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), tt.repositories...),
+				repositorySecrets: tt.repositorySecrets,
+			}
+			pipelineRun := &v1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-pipeline-run",
+					Namespace:   "test-namespace",
+					UID:         "spoke-uid",
+					Labels:      tt.labels,
+					Annotations: tt.annotations,
+				},
+			}
+
+			syncs, err := r.repositorySecretSyncs(ctx, testClusterName, spokeKubeClient, pipelineRun, workload, tt.gitAuthSecret)
+			var refs []syncedSecretRef
+			if err == nil {
+				refs, _, err = r.syncSecrets(ctx, testClusterName, pipelineRun.GetNamespace(), syncs)
+			}
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, len(tt.expectedData), len(refs))
+			if len(tt.expectedData) == 0 {
+				assert.Equal(t, 0, len(spokeKubeClient.Actions()))
+				return
+			}
+
+			for _, ref := range refs {
+				assert.Equal(t, testClusterName, ref.Cluster)
+				secret, err := spokeKubeClient.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+				assert.NilError(t, err)
+				assert.DeepEqual(t, tt.expectedData[ref.Name], secret.Data)
+				assert.Equal(t, managedByValue, secret.Labels[managedByLabel])
+			}
+		})
+	}
+}
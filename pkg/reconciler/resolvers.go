@@ -0,0 +1,195 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Resolvers whose credentials are synced, see RESOLVER_SECRETS.
+const (
+	// resolverSecretsBundles syncs the registry credentials of the bundles resolver, named by its
+	// secret param.
+	resolverSecretsBundles = "bundles"
+	// resolverSecretsGit syncs the tokens of the git resolver, named by its token and gitToken
+	// params, and the default API token of its git-resolver-config.
+	resolverSecretsGit = "git"
+
+	// defaultResolverSecrets syncs none, the spoke clusters usually have their own credentials.
+	defaultResolverSecrets = "none"
+
+	// defaultResolversNamespace is where Tekton runs its resolvers.
+	defaultResolversNamespace = "tekton-pipelines-resolvers"
+
+	// gitResolverConfig is the ConfigMap of the git resolver in the resolvers namespace, and the
+	// keys of its default API token.
+	gitResolverConfig              = "git-resolver-config"
+	gitResolverTokenNameKey        = "api-token-secret-name"
+	gitResolverTokenNamespaceKey   = "api-token-secret-namespace"
+	gitResolverParamRepo           = "repo"
+	gitResolverParamToken          = "token"
+	gitResolverParamGitToken       = "gitToken"
+	bundlesResolverParamSecretName = "secret"
+)
+
+// resolverSecretsOptions configures the sync of the resolver credentials.
+type resolverSecretsOptions struct {
+	// resolvers are the resolvers whose credentials are synced, none when empty
+	resolvers map[string]bool
+	// namespace is where Tekton runs its resolvers, on the hub and on the spoke clusters
+	namespace string
+}
+
+// parseResolverSecrets validates the RESOLVER_SECRETS value, a comma separated list of
+// resolvers, "none" disables them all.
+func parseResolverSecrets(value string) (map[string]bool, error) {
+	resolvers := map[string]bool{}
+	for _, resolver := range strings.Split(value, ",") {
+		switch resolver = strings.TrimSpace(resolver); resolver {
+		case "", "none":
+		case resolverSecretsBundles, resolverSecretsGit:
+			resolvers[resolver] = true
+		default:
+			return nil, fmt.Errorf("unsupported resolver %q, must be none or a list of %s, %s", resolver, resolverSecretsBundles, resolverSecretsGit)
+		}
+	}
+	return resolvers, nil
+}
+
+// resolverRefs returns the remote resolutions of the PipelineRun, of its Pipeline and of the
+// Tasks of its embedded Pipeline. The Tasks of a remote Pipeline are only known once resolved.
+func resolverRefs(pipelineRun *v1.PipelineRun) []v1.ResolverRef {
+	var refs []v1.ResolverRef
+	if ref := pipelineRun.Spec.PipelineRef; ref != nil && ref.Resolver != "" {
+		refs = append(refs, ref.ResolverRef)
+	}
+	if spec := pipelineRun.Spec.PipelineSpec; spec != nil {
+		for _, task := range append(append([]v1.PipelineTask(nil), spec.Tasks...), spec.Finally...) {
+			if task.TaskRef != nil && task.TaskRef.Resolver != "" {
+				refs = append(refs, task.TaskRef.ResolverRef)
+			}
+		}
+	}
+	return refs
+}
+
+// resolverSecretNames returns the secrets of the namespace of the PipelineRun its remote
+// resolutions need, and whether a git resolution falls back to the default API token.
+func (r *Reconciler) resolverSecretNames(pipelineRun *v1.PipelineRun) ([]string, bool) {
+	var (
+		names      []string
+		gitDefault bool
+	)
+	for _, ref := range resolverRefs(pipelineRun) {
+		params := map[string]string{}
+		for _, param := range ref.Params {
+			// Params substituted by the PipelineRun are only known at resolution time
+			if value := param.Value.StringVal; value != "" && !strings.Contains(value, "$(") {
+				params[param.Name] = value
+			}
+		}
+		switch {
+		case ref.Resolver == "bundles" && r.resolverSecrets.resolvers[resolverSecretsBundles]:
+			if name := params[bundlesResolverParamSecretName]; name != "" {
+				names = append(names, name)
+			}
+		case ref.Resolver == "git" && r.resolverSecrets.resolvers[resolverSecretsGit]:
+			for _, param := range []string{gitResolverParamToken, gitResolverParamGitToken} {
+				if name := params[param]; name != "" {
+					names = append(names, name)
+				}
+			}
+			if _, ok := params[gitResolverParamRepo]; ok && params[gitResolverParamToken] == "" {
+				gitDefault = true
+			}
+		}
+	}
+	return names, gitDefault
+}
+
+// syncGitResolverToken copies the default API token of the git resolver, set in its
+// git-resolver-config, to the spoke cluster. The token is shared by the runs of every namespace,
+// so it is neither owned by a PipelineRun nor recorded on the Workload: it stays on the spoke
+// cluster, refreshed by the next syncs, until the cluster is cleaned up. A spoke token the
+// controller didn't create is left alone.
+func (r *Reconciler) syncGitResolverToken(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) error {
+	namespace := r.resolverSecrets.namespace
+	config, err := r.hubKubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, gitResolverConfig, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get ConfigMap %s/%s: %w", namespace, gitResolverConfig, err)
+	}
+	name := config.Data[gitResolverTokenNameKey]
+	if name == "" {
+		return nil
+	}
+	if ns := config.Data[gitResolverTokenNamespaceKey]; ns != "" {
+		namespace = ns
+	}
+
+	hubSecret, err := r.hubKubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get the git resolver token %s/%s: %w", namespace, name, err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hubSecret.Name,
+			Namespace: hubSecret.Namespace,
+			Labels:    map[string]string{managedByLabel: managedByValue},
+		},
+		Type: hubSecret.Type,
+		Data: hubSecret.Data,
+	}
+
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	_, err = spokeKubeClient.CoreV1().Secrets(namespace).Create(spokeCtx, secret, metav1.CreateOptions{})
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err == nil {
+		r.logger.Infof("successfully created the git resolver token %s/%s on spoke cluster %s", namespace, name, clusterName)
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// An update conflicting with another writer of the token is decided again on a fresh copy
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := spokeKubeClient.CoreV1().Secrets(namespace).Get(spokeCtx, name, metav1.GetOptions{})
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		if err != nil {
+			return err
+		}
+		if !isManagedSpokeSecret(existing) {
+			r.logger.Debugf("git resolver token %s/%s on spoke cluster %s was not created by %s, keeping it", namespace, name, clusterName, managedByValue)
+			return nil
+		}
+		if equality.Semantic.DeepEqual(existing.Data, secret.Data) {
+			return nil
+		}
+		existing = existing.DeepCopy()
+		existing.Data = maps.Clone(secret.Data)
+		_, err = spokeKubeClient.CoreV1().Secrets(namespace).Update(spokeCtx, existing, metav1.UpdateOptions{})
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		if err != nil {
+			return fmt.Errorf("could not update the git resolver token %s/%s on spoke cluster %s: %w", namespace, name, clusterName, err)
+		}
+		r.logger.Infof("successfully updated the git resolver token %s/%s on spoke cluster %s", namespace, name, clusterName)
+		return nil
+	})
+}
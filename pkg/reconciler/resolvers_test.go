@@ -0,0 +1,162 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseResolverSecrets(t *testing.T) {
+	for value, expected := range map[string]map[string]bool{
+		"":              {},
+		"none":          {},
+		"git":           {resolverSecretsGit: true},
+		" bundles,git ": {resolverSecretsBundles: true, resolverSecretsGit: true},
+	} {
+		resolvers, err := parseResolverSecrets(value)
+		assert.NilError(t, err, value)
+		assert.DeepEqual(t, expected, resolvers)
+	}
+
+	_, err := parseResolverSecrets("hub")
+	assert.Error(t, err, `unsupported resolver "hub", must be none or a list of bundles, git`)
+}
+
+func TestResolverSecretNames(t *testing.T) {
+	resolverRef := func(resolver string, params map[string]string) v1.ResolverRef {
+		ref := v1.ResolverRef{Resolver: v1.ResolverName(resolver)}
+		for name, value := range params {
+			ref.Params = append(ref.Params, v1.Param{Name: name, Value: *v1.NewStructuredValues(value)})
+		}
+		return ref
+	}
+
+	tests := []struct {
+		name               string
+		resolvers          map[string]bool
+		spec               v1.PipelineRunSpec
+		expectedNames      []string
+		expectedGitDefault bool
+	}{
+		{
+			name:      "no remote resolution",
+			resolvers: map[string]bool{resolverSecretsBundles: true, resolverSecretsGit: true},
+			spec:      v1.PipelineRunSpec{PipelineRef: &v1.PipelineRef{Name: "build"}},
+		},
+		{
+			name:      "bundle secret",
+			resolvers: map[string]bool{resolverSecretsBundles: true},
+			spec: v1.PipelineRunSpec{PipelineRef: &v1.PipelineRef{ResolverRef: resolverRef("bundles", map[string]string{
+				"bundle": "quay.io/org/pipelines:v1", "name": "build", "kind": "pipeline", "secret": "quay-pull",
+			})}},
+			expectedNames: []string{"quay-pull"},
+		},
+		{
+			name:      "resolver not enabled",
+			resolvers: map[string]bool{resolverSecretsGit: true},
+			spec: v1.PipelineRunSpec{PipelineRef: &v1.PipelineRef{ResolverRef: resolverRef("bundles", map[string]string{
+				"bundle": "quay.io/org/pipelines:v1", "secret": "quay-pull",
+			})}},
+		},
+		{
+			name:      "git tokens of embedded Pipeline tasks",
+			resolvers: map[string]bool{resolverSecretsGit: true},
+			spec: v1.PipelineRunSpec{PipelineSpec: &v1.PipelineSpec{
+				Tasks: []v1.PipelineTask{
+					{Name: "clone", TaskRef: &v1.TaskRef{ResolverRef: resolverRef("git", map[string]string{
+						"url": "https://github.com/org/tasks", "pathInRepo": "clone.yaml", "gitToken": "github-clone-token",
+					})}},
+					{Name: "lint", TaskRef: &v1.TaskRef{Name: "lint"}},
+				},
+				Finally: []v1.PipelineTask{
+					{Name: "notify", TaskRef: &v1.TaskRef{ResolverRef: resolverRef("git", map[string]string{
+						"org": "org", "repo": "tasks", "pathInRepo": "notify.yaml", "token": "github-api-token",
+					})}},
+				},
+			}},
+			expectedNames: []string{"github-clone-token", "github-api-token"},
+		},
+		{
+			name:      "git API default token",
+			resolvers: map[string]bool{resolverSecretsGit: true},
+			spec: v1.PipelineRunSpec{PipelineRef: &v1.PipelineRef{ResolverRef: resolverRef("git", map[string]string{
+				"org": "org", "repo": "pipelines", "pathInRepo": "build.yaml",
+			})}},
+			expectedGitDefault: true,
+		},
+		{
+			name:      "substituted secret",
+			resolvers: map[string]bool{resolverSecretsBundles: true},
+			spec: v1.PipelineRunSpec{PipelineRef: &v1.PipelineRef{ResolverRef: resolverRef("bundles", map[string]string{
+				"bundle": "quay.io/org/pipelines:v1", "secret": "$(params.pull-secret)",
+			})}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{resolverSecrets: resolverSecretsOptions{resolvers: tt.resolvers, namespace: defaultResolversNamespace}}
+			names, gitDefault := r.resolverSecretNames(&v1.PipelineRun{Spec: tt.spec})
+			assert.DeepEqual(t, tt.expectedNames, names)
+			assert.Equal(t, tt.expectedGitDefault, gitDefault)
+		})
+	}
+}
+
+func TestSyncGitResolverToken(t *testing.T) {
+	ctx := context.Background()
+	hubKubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: gitResolverConfig, Namespace: defaultResolversNamespace},
+			Data:       map[string]string{gitResolverTokenNameKey: "github-token", "api-token-secret-key": "token"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: defaultResolversNamespace},
+			Data:       map[string][]byte{"token": []byte("v1")},
+		},
+	)
+	spokeKubeClient := fake.NewSimpleClientset()
+	r := &Reconciler{
+		logger:          zap.NewNop().Sugar(),
+		hubKubeClient:   hubKubeClient,
+		resolverSecrets: resolverSecretsOptions{resolvers: map[string]bool{resolverSecretsGit: true}, namespace: defaultResolversNamespace},
+	}
+
+	assert.NilError(t, r.syncGitResolverToken(ctx, testClusterName, spokeKubeClient))
+	synced, err := spokeKubeClient.CoreV1().Secrets(defaultResolversNamespace).Get(ctx, "github-token", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "v1", string(synced.Data["token"]))
+	assert.Equal(t, managedByValue, synced.Labels[managedByLabel])
+	assert.Equal(t, "", synced.Annotations[workloadAnnotation], "the shared token must never be swept as an orphan")
+
+	// The token is refreshed when it changes on the hub
+	hubSecret, err := hubKubeClient.CoreV1().Secrets(defaultResolversNamespace).Get(ctx, "github-token", metav1.GetOptions{})
+	assert.NilError(t, err)
+	hubSecret.Data["token"] = []byte("v2")
+	_, err = hubKubeClient.CoreV1().Secrets(defaultResolversNamespace).Update(ctx, hubSecret, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	assert.NilError(t, r.syncGitResolverToken(ctx, testClusterName, spokeKubeClient))
+	synced, err = spokeKubeClient.CoreV1().Secrets(defaultResolversNamespace).Get(ctx, "github-token", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "v2", string(synced.Data["token"]))
+
+	// The tokens provisioned on the spoke clusters are kept
+	provisioned := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: defaultResolversNamespace},
+		Data:       map[string][]byte{"token": []byte("spoke")},
+	})
+	assert.NilError(t, r.syncGitResolverToken(ctx, testClusterName, provisioned))
+	synced, err = provisioned.CoreV1().Secrets(defaultResolversNamespace).Get(ctx, "github-token", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "spoke", string(synced.Data["token"]))
+
+	// Without git-resolver-config there is no default token
+	r.hubKubeClient = fake.NewSimpleClientset()
+	assert.NilError(t, r.syncGitResolverToken(ctx, testClusterName, fake.NewSimpleClientset()))
+}
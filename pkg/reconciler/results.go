@@ -0,0 +1,223 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/cache"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+const (
+	// resultsRecordType is the type of the Records written for the sync decisions, next to the
+	// PipelineRun and TaskRun Records of the Result.
+	resultsRecordType = "secret-syncer.tekton.dev/v1.SecretSync"
+
+	// resultsQueueSize bounds the Records waiting to be written. When the Results API can't keep
+	// up, new Records are dropped rather than slowing down reconciles.
+	resultsQueueSize = 1000
+	resultsTimeout   = 5 * time.Second
+)
+
+// resultsRecord is a Record to create under the Result of a PipelineRun.
+type resultsRecord struct {
+	// Parent is the Result, <namespace>/results/<name>
+	Parent string
+	ID     string
+	Data   resultsRecordData
+}
+
+// resultsRecordData is the JSON payload of the Records. As with the audit log, it only holds
+// object references, never secret data.
+type resultsRecordData struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Outcome     string    `json:"outcome"`
+	Reason      string    `json:"reason,omitempty"`
+	Cluster     string    `json:"cluster"`
+	Secret      string    `json:"secret"`
+	Workload    string    `json:"workload,omitempty"`
+	PipelineRun string    `json:"pipelineRun,omitempty"`
+	ContentHash string    `json:"contentHash,omitempty"`
+	// SpokeUID, SpokeResourceVersion and SpokeIdentity are the auditEvent fields of the same name
+	SpokeUID             string `json:"spokeUID,omitempty"`
+	SpokeResourceVersion string `json:"spokeResourceVersion,omitempty"`
+	SpokeIdentity        string `json:"spokeIdentity,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+// resultsRecorder writes the sync decisions of PipelineRuns as Records into Tekton Results, from a
+// background goroutine so a slow or unavailable Results API never blocks a reconcile.
+type resultsRecorder struct {
+	api            string
+	client         *http.Client
+	logger         *zap.SugaredLogger
+	workloadLister kueuev1beta1lister.WorkloadLister
+	// owner resolves the PipelineRun owning a Workload, its controller when nil
+	owner func(ctx context.Context, workload metav1.Object) (*metav1.OwnerReference, error)
+	queue chan resultsRecord
+	// tokenPath is overridden in tests
+	tokenPath string
+}
+
+// newResultsRecorder returns a recorder writing to the Results API, trusting the CA bundle of
+// caFile on top of the system roots when set.
+func newResultsRecorder(api, caFile string, workloadLister kueuev1beta1lister.WorkloadLister, logger *zap.SugaredLogger) (*resultsRecorder, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Tekton Results CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in Tekton Results CA bundle %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &resultsRecorder{
+		api:            strings.TrimSuffix(api, "/"),
+		client:         &http.Client{Timeout: resultsTimeout, Transport: transport},
+		logger:         logger,
+		workloadLister: workloadLister,
+		queue:          make(chan resultsRecord, resultsQueueSize),
+		tokenPath:      serviceAccountTokenPath,
+	}, nil
+}
+
+// run writes the queued Records until the context is done.
+func (r *resultsRecorder) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record := <-r.queue:
+			if err := r.send(ctx, record); err != nil {
+				r.logger.Errorf("error writing Tekton Results Record %s/records/%s: %v", record.Parent, record.ID, err)
+			}
+		}
+	}
+}
+
+// emit queues a Record of the sync decision under the Result of the Workload's PipelineRun. It
+// is a no-op when Tekton Results is disabled, or the decision isn't tied to a Workload.
+func (r *resultsRecorder) emit(event auditEvent) {
+	if r == nil || event.Workload == "" {
+		return
+	}
+
+	parent, ok := r.result(event.Workload)
+	if !ok {
+		r.logger.Debugf("no PipelineRun Result for workload %s, not recording %s of secret %s", event.Workload, event.Action, event.Secret)
+		return
+	}
+
+	record := resultsRecord{
+		Parent: parent,
+		ID:     string(uuid.NewUUID()),
+		Data: resultsRecordData{
+			Time:                 time.Now(),
+			Action:               event.Action,
+			Outcome:              event.Outcome,
+			Reason:               event.Reason,
+			Cluster:              event.Cluster,
+			Secret:               event.Secret,
+			Workload:             event.Workload,
+			PipelineRun:          event.PipelineRun,
+			ContentHash:          event.ContentHash,
+			SpokeUID:             string(event.SpokeUID),
+			SpokeResourceVersion: event.SpokeResourceVersion,
+			SpokeIdentity:        event.SpokeIdentity,
+		},
+	}
+	if event.Error != nil {
+		record.Data.Error = event.Error.Error()
+	}
+
+	select {
+	case r.queue <- record:
+	default:
+		r.logger.Errorf("Tekton Results queue is full, dropping %s Record for secret %s", record.Data.Action, record.Data.Secret)
+	}
+}
+
+// result returns the Result of the hub PipelineRun owning the Workload. The Results watcher names
+// the Result of a PipelineRun after its UID, which the owner reference of the Workload holds. The
+// owner was resolved by the reconcile emitting the event, it is read back from the cache.
+func (r *resultsRecorder) result(workloadKey string) (string, bool) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(workloadKey)
+	if err != nil {
+		return "", false
+	}
+	workload, err := r.workloadLister.Workloads(namespace).Get(name)
+	if err != nil {
+		return "", false
+	}
+	owner := metav1.GetControllerOf(workload)
+	if r.owner != nil {
+		if owner, err = r.owner(context.Background(), workload); err != nil {
+			return "", false
+		}
+	}
+	if owner == nil || owner.Kind != "PipelineRun" || owner.UID == "" {
+		return "", false
+	}
+	return namespace + "/results/" + string(owner.UID), true
+}
+
+// send creates a single Record through the REST API of Tekton Results, authenticated as the
+// controller's service account.
+func (r *resultsRecorder) send(ctx context.Context, record resultsRecord) error {
+	value, err := json.Marshal(record.Data)
+	if err != nil {
+		return err
+	}
+	// The data value is a protobuf bytes field, base64 encoded by json.Marshal
+	body, err := json.Marshal(map[string]any{
+		"name": record.Parent + "/records/" + record.ID,
+		"data": map[string]any{"type": resultsRecordType, "value": value},
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := os.ReadFile(r.tokenPath)
+	if err != nil {
+		return fmt.Errorf("could not read service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.api+"/apis/results.tekton.dev/v1alpha2/parents/"+record.Parent+"/records", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("result %s does not exist", record.Parent)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the Results API answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+type resultsRequest struct {
+	path          string
+	authorization string
+	name          string
+	recordType    string
+	data          resultsRecordData
+}
+
+func TestResultsRecorder(t *testing.T) {
+	requests := make(chan resultsRequest, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		record := struct {
+			Name string `json:"name"`
+			Data struct {
+				Type  string `json:"type"`
+				Value []byte `json:"value"`
+			} `json:"data"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data := resultsRecordData{}
+		if err := json.Unmarshal(record.Data.Value, &data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- resultsRequest{
+			path:          req.URL.Path,
+			authorization: req.Header.Get("Authorization"),
+			name:          record.Name,
+			recordType:    record.Data.Type,
+			data:          data,
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer api.Close()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-workload",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid", Controller: ptr.Bool(true)},
+			},
+		},
+	}))
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "not-owned", Namespace: "test-namespace"}}))
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.NilError(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder, err := newResultsRecorder(api.URL+"/", "", kueuev1beta1lister.NewWorkloadLister(indexer), zap.NewNop().Sugar())
+	assert.NilError(t, err)
+	recorder.tokenPath = tokenPath
+	go recorder.run(ctx)
+
+	// Decisions not tied to a PipelineRun owned Workload have no Result to go to
+	recorder.emit(auditEvent{Action: auditActionDelete, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/orphan"})
+	recorder.emit(auditEvent{Action: auditActionSync, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/not-owned", Workload: "test-namespace/not-owned"})
+	recorder.emit(auditEvent{Action: auditActionSync, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/gone", Workload: "test-namespace/gone"})
+	recorder.emit(auditEvent{
+		Action:      auditActionSync,
+		Outcome:     auditOutcomeFailure,
+		Reason:      "PipelineRun dispatched to spoke cluster",
+		Cluster:     testClusterName,
+		Secret:      "test-namespace/git-auth",
+		Workload:    "test-namespace/test-workload",
+		PipelineRun: "test-namespace/test-pipeline-run",
+		ContentHash: "sha256:abc",
+		Error:       errors.New("boom"),
+	})
+
+	req := <-requests
+	assert.Equal(t, "/apis/results.tekton.dev/v1alpha2/parents/test-namespace/results/hub-uid/records", req.path)
+	assert.Equal(t, "Bearer sa-token", req.authorization)
+	assert.Assert(t, strings.HasPrefix(req.name, "test-namespace/results/hub-uid/records/"), req.name)
+	assert.Equal(t, resultsRecordType, req.recordType)
+	assert.Assert(t, !req.data.Time.IsZero())
+	req.data.Time = req.data.Time.UTC()
+	assert.DeepEqual(t, resultsRecordData{
+		Time:        req.data.Time,
+		Action:      auditActionSync,
+		Outcome:     auditOutcomeFailure,
+		Reason:      "PipelineRun dispatched to spoke cluster",
+		Cluster:     testClusterName,
+		Secret:      "test-namespace/git-auth",
+		Workload:    "test-namespace/test-workload",
+		PipelineRun: "test-namespace/test-pipeline-run",
+		ContentHash: "sha256:abc",
+		Error:       "boom",
+	}, req.data)
+	assert.Equal(t, 0, len(requests), "only decisions of PipelineRun owned Workloads are recorded")
+}
+
+func TestResultsRecorderMissingResult(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer api.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.NilError(t, os.WriteFile(tokenPath, []byte("sa-token"), 0o600))
+	recorder, err := newResultsRecorder(api.URL, "", nil, zap.NewNop().Sugar())
+	assert.NilError(t, err)
+	recorder.tokenPath = tokenPath
+
+	err = recorder.send(context.Background(), resultsRecord{Parent: "test-namespace/results/hub-uid", ID: "id"})
+	assert.ErrorContains(t, err, "result test-namespace/results/hub-uid does not exist")
+}
+
+func TestResultsRecorderDropsWhenFull(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, indexer.Add(&kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid", Controller: ptr.Bool(true)}},
+		},
+	}))
+	recorder, err := newResultsRecorder("http://results.invalid", "", kueuev1beta1lister.NewWorkloadLister(indexer), zap.NewNop().Sugar())
+	assert.NilError(t, err)
+	recorder.queue = make(chan resultsRecord, 1)
+
+	event := auditEvent{Action: auditActionDelete, Outcome: auditOutcomeSuccess, Cluster: testClusterName, Secret: "ns/name", Workload: "test-namespace/test-workload"}
+	recorder.emit(event)
+	recorder.emit(event)
+	assert.Equal(t, 1, len(recorder.queue))
+
+	var disabled *resultsRecorder
+	disabled.emit(event)
+}
+
+func TestNewResultsRecorderCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NilError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+	_, err := newResultsRecorder("https://tekton-results-api-service.tekton-pipelines.svc:8080", caFile, nil, zap.NewNop().Sugar())
+	assert.ErrorContains(t, err, "no certificates found")
+
+	_, err = newResultsRecorder("https://tekton-results-api-service.tekton-pipelines.svc:8080", filepath.Join(t.TempDir(), "missing"), nil, zap.NewNop().Sugar())
+	assert.ErrorContains(t, err, "could not read Tekton Results CA bundle")
+}
@@ -0,0 +1,47 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+const (
+	// resyncAnnotation is set by an operator on a Workload, to any new value such as a timestamp,
+	// to force a resync of its secrets, e.g. after fixing a problem on the spoke cluster.
+	resyncAnnotation = syncerGroupName + "/resync"
+
+	// resyncedAnnotation records the value of the resyncAnnotation handled last, so a request
+	// only forces a single resync.
+	resyncedAnnotation = syncerGroupName + "/resynced"
+)
+
+// resyncRequested reports whether the Workload carries a resync request not handled yet.
+func resyncRequested(workload *kueuev1beta1.Workload) bool {
+	annotations := workload.GetAnnotations()
+	value := annotations[resyncAnnotation]
+	return value != "" && value != annotations[resyncedAnnotation]
+}
+
+// recordResynced records on the Workload that its resync request was handled, when it had one.
+func (r *Reconciler) recordResynced(ctx context.Context, workload *kueuev1beta1.Workload, resync bool) error {
+	if !resync {
+		return nil
+	}
+	value := workload.GetAnnotations()[resyncAnnotation]
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{
+		resyncedAnnotation: value,
+	}}})
+	if err != nil {
+		return err
+	}
+	if _, err := r.kueueClient.KueueV1beta1().Workloads(workload.GetNamespace()).Patch(ctx, workload.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("could not record the resync %s: %w", value, err)
+	}
+	r.logger.Infof("resynced workload %s/%s as requested with %s=%s", workload.GetNamespace(), workload.GetName(), resyncAnnotation, value)
+	return nil
+}
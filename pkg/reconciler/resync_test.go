@@ -0,0 +1,95 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestResyncRequested(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "no request"},
+		{name: "new request", annotations: map[string]string{resyncAnnotation: "2026-10-14T10:00:00Z"}, expected: true},
+		{name: "handled request", annotations: map[string]string{resyncAnnotation: "2026-10-14T10:00:00Z", resyncedAnnotation: "2026-10-14T10:00:00Z"}},
+		{name: "request after a handled one", annotations: map[string]string{resyncAnnotation: "2026-10-14T11:00:00Z", resyncedAnnotation: "2026-10-14T10:00:00Z"}, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			assert.Equal(t, tt.expected, resyncRequested(workload))
+		})
+	}
+}
+
+func TestRecordResynced(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test-workload",
+		Namespace:   "test-namespace",
+		Annotations: map[string]string{resyncAnnotation: "2026-10-14T10:00:00Z"},
+	}}
+	kueueClient := kueuefake.NewSimpleClientset(workload)
+	r := &Reconciler{logger: zap.NewNop().Sugar(), kueueClient: kueueClient}
+
+	// Without a request the Workload isn't patched
+	assert.NilError(t, r.recordResynced(ctx, workload, false))
+	assert.Equal(t, 0, len(kueueClient.Actions()))
+
+	assert.NilError(t, r.recordResynced(ctx, workload, true))
+	patched, err := kueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, !resyncRequested(patched))
+}
+
+func TestCreateSecretOnSpokeClusterResyncs(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("hub-token")},
+	}
+	// The spoke secret was edited by hand, its checksum still matches the hub secret
+	spokeSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("hub-token")},
+	}
+	setChecksum(spokeSecret)
+	spokeSecret.Data = map[string][]byte{defaultSecretDataKey: []byte("edited-token")}
+	spokeKubeClient := fake.NewSimpleClientset(spokeSecret)
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(hubSecret),
+		resyncs:       newRotationRequests(),
+	}
+	spokeToken := func() string {
+		secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+		assert.NilError(t, err)
+		return string(secret.Data[defaultSecretDataKey])
+	}
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "edited-token", spokeToken())
+
+	r.resyncs.request("test-namespace/test-workload")
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "hub-token", spokeToken())
+}
@@ -0,0 +1,134 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// revokedAnnotation set to "true" on a hub secret revokes it: it is no longer synced, and
+	// with HUB_SECRET_REVOCATION its spoke copies are deleted right away.
+	revokedAnnotation = syncerGroupName + "/revoked"
+
+	// secretRevokedReason is the reason of the Warning event recorded on the Workloads whose
+	// spoke secrets were deleted after their hub secret was revoked.
+	secretRevokedReason = "SecretRevoked"
+)
+
+// hubSecretRevoked reports whether the hub secret was revoked with the revokedAnnotation.
+func hubSecretRevoked(secret metav1.Object) bool {
+	return secret.GetAnnotations()[revokedAnnotation] == "true"
+}
+
+// revokedSecretError returns the error of syncing a revoked hub secret, nil when it isn't.
+func revokedSecretError(secret *corev1.Secret) error {
+	if !hubSecretRevoked(secret) {
+		return nil
+	}
+	return syncer.Classify(fmt.Errorf("secret %s/%s is revoked", secret.Namespace, secret.Name), ErrSecretRevoked)
+}
+
+// hubSecretRevocations records, by Workload, the hub secrets revoked since they were synced.
+type hubSecretRevocations struct {
+	mu      sync.Mutex
+	secrets map[string][]string
+}
+
+func newHubSecretRevocations() *hubSecretRevocations {
+	return &hubSecretRevocations{secrets: map[string][]string{}}
+}
+
+func (h *hubSecretRevocations) request(key, secretName string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !slices.Contains(h.secrets[key], secretName) {
+		h.secrets[key] = append(h.secrets[key], secretName)
+	}
+}
+
+// revoked returns the hub secrets of the Workload revoked since they were synced.
+func (h *hubSecretRevocations) revoked(key string) []string {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.secrets[key])
+}
+
+func (h *hubSecretRevocations) done(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.secrets, key)
+}
+
+// revokedRefs returns the spoke copies of the revoked hub secrets synced for the Workload.
+func revokedRefs(workload *kueuev1beta1.Workload, secretNames []string) []syncedSecretRef {
+	var refs []syncedSecretRef
+	for _, ref := range syncedSecretRefs(workload) {
+		if slices.Contains(secretNames, ref.hubSecretName()) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// revokeSpokeSecrets deletes the spoke copies of the revoked hub secrets of the Workload, and
+// stops syncing it: its Workload gets a SecretRevoked Warning event and is dropped from the
+// workqueue until its next update. The revocation is kept, and retried, until every copy is gone.
+func (r *Reconciler) revokeSpokeSecrets(ctx context.Context, workload *kueuev1beta1.Workload, secretNames []string) error {
+	key := workload.GetNamespace() + "/" + workload.GetName()
+	var revoked []string
+	for _, ref := range revokedRefs(workload, secretNames) {
+		spokeKubeClient, _, err := r.getSpokeClients(ctx, ref.Cluster)
+		if stderrors.Is(err, ErrClusterNotFound) {
+			// The copies of a removed spoke cluster can't be reached, nor count against the quota
+			r.logger.Warnf("spoke cluster %s of the revoked secret %s/%s no longer exists: %v", ref.Cluster, ref.Namespace, ref.Name, err)
+			r.quotas.release(ref)
+			continue
+		}
+		if err != nil {
+			r.logger.Errorf("error creating spoke clients for cluster %s: %v", ref.Cluster, err)
+			return err
+		}
+		if err := r.revokeSpokeSecret(ctx, spokeKubeClient, ref, key); err != nil {
+			return err
+		}
+		revoked = append(revoked, ref.Cluster+"/"+ref.Namespace+"/"+ref.Name)
+	}
+	r.hubSecretRevocations.done(key)
+
+	r.logger.Warnf("hub secrets %s of workload %s were revoked, deleted their spoke copies %s", strings.Join(secretNames, ", "), key, strings.Join(revoked, ", "))
+	err := syncer.Classify(fmt.Errorf("hub secrets %s of namespace %s were revoked", strings.Join(secretNames, ", "), workload.GetNamespace()), ErrSecretRevoked)
+	return r.rejectionError(workload, err)
+}
+
+// revokeSpokeSecret deletes the spoke copy of a revoked hub secret, with its known_hosts
+// companion, and releases their quota reservations.
+func (r *Reconciler) revokeSpokeSecret(ctx context.Context, spokeKubeClient kubernetes.Interface, ref syncedSecretRef, workloadKey string) error {
+	if err := r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, workloadKey, "hub secret revoked"); err != nil {
+		return err
+	}
+	if err := r.deleteKnownHosts(ctx, spokeKubeClient, ref, workloadKey); err != nil {
+		r.logger.Errorf("error deleting the known_hosts of secret %s/%s on spoke cluster %s: %v", ref.Namespace, ref.Name, ref.Cluster, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestHubSecretWatcherSecretRevoked(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{hubSecretIndex: workloadQueueFilter{}.hubSecretIndexFunc})
+	for _, workload := range []*kueuev1beta1.Workload{
+		syncedWorkload("first", "spoke-1/test-namespace/git-auth"),
+		syncedWorkload("second", "spoke-2/remote-runs/git-auth"),
+		syncedWorkload("other", "spoke-1/test-namespace/other-secret"),
+	} {
+		assert.NilError(t, indexer.Add(workload))
+	}
+	secret := func(resourceVersion string, revoked bool) *metav1.PartialObjectMetadata {
+		obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace", ResourceVersion: resourceVersion}}
+		if revoked {
+			obj.Annotations = map[string]string{revokedAnnotation: "true"}
+		}
+		return obj
+	}
+
+	tests := []struct {
+		name            string
+		revocations     *hubSecretRevocations
+		event           func(w *hubSecretWatcher)
+		expectedRevoked bool
+		expectedUpdated bool
+	}{
+		{
+			name:            "revoked",
+			revocations:     newHubSecretRevocations(),
+			event:           func(w *hubSecretWatcher) { w.secretUpdated(secret("1", false), secret("2", true)) },
+			expectedRevoked: true,
+		},
+		{
+			name:            "updated after its revocation",
+			revocations:     newHubSecretRevocations(),
+			event:           func(w *hubSecretWatcher) { w.secretUpdated(secret("2", true), secret("3", true)) },
+			expectedUpdated: true,
+		},
+		{
+			name:            "deleted",
+			revocations:     newHubSecretRevocations(),
+			event:           func(w *hubSecretWatcher) { w.secretDeleted(secret("2", false)) },
+			expectedRevoked: true,
+		},
+		{
+			name:        "deleted while unwatched",
+			revocations: newHubSecretRevocations(),
+			event: func(w *hubSecretWatcher) {
+				w.secretDeleted(cache.DeletedFinalStateUnknown{Key: "test-namespace/git-auth", Obj: secret("2", false)})
+			},
+			expectedRevoked: true,
+		},
+		{
+			name:            "added revoked",
+			revocations:     newHubSecretRevocations(),
+			event:           func(w *hubSecretWatcher) { w.secretAdded(secret("2", true)) },
+			expectedRevoked: true,
+		},
+		{
+			name:        "added",
+			revocations: newHubSecretRevocations(),
+			event:       func(w *hubSecretWatcher) { w.secretAdded(secret("2", false)) },
+		},
+		{
+			name:        "listed on startup",
+			revocations: newHubSecretRevocations(),
+			event: func(w *hubSecretWatcher) {
+				store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+				assert.NilError(t, store.Add(secret("2", true)))
+				w.revokeListed(context.Background(), []cache.Store{store}, []cache.InformerSynced{func() bool { return true }})
+			},
+			expectedRevoked: true,
+		},
+		{
+			name:            "revoked without HUB_SECRET_REVOCATION",
+			event:           func(w *hubSecretWatcher) { w.secretUpdated(secret("1", false), secret("2", true)) },
+			expectedUpdated: true,
+		},
+		{
+			name:  "added revoked without HUB_SECRET_REVOCATION",
+			event: func(w *hubSecretWatcher) { w.secretAdded(secret("2", true)) },
+		},
+		{
+			name:  "deleted without HUB_SECRET_REVOCATION",
+			event: func(w *hubSecretWatcher) { w.secretDeleted(secret("2", false)) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enqueued []string
+			w := &hubSecretWatcher{
+				workloads:   []cache.Indexer{indexer},
+				updates:     newRotationRequests(),
+				revocations: tt.revocations,
+				enqueue:     func(key types.NamespacedName) { enqueued = append(enqueued, key.String()) },
+			}
+			tt.event(w)
+
+			if !tt.expectedRevoked && !tt.expectedUpdated {
+				assert.Equal(t, 0, len(enqueued))
+				return
+			}
+			sort.Strings(enqueued)
+			assert.DeepEqual(t, []string{"test-namespace/first", "test-namespace/second"}, enqueued)
+			for _, key := range enqueued {
+				assert.Equal(t, tt.expectedUpdated, w.updates.requested(key), key)
+				if tt.expectedRevoked {
+					assert.DeepEqual(t, []string{"git-auth"}, tt.revocations.revoked(key))
+				} else {
+					assert.Equal(t, 0, len(tt.revocations.revoked(key)))
+				}
+			}
+			assert.Equal(t, 0, len(tt.revocations.revoked("test-namespace/other")))
+		})
+	}
+}
+
+func TestHubSecretRevocations(t *testing.T) {
+	revocations := newHubSecretRevocations()
+	revocations.request("test-namespace/test-workload", "git-auth")
+	revocations.request("test-namespace/test-workload", "git-auth")
+	revocations.request("test-namespace/test-workload", "repository-token")
+	assert.DeepEqual(t, []string{"git-auth", "repository-token"}, revocations.revoked("test-namespace/test-workload"))
+
+	revocations.done("test-namespace/test-workload")
+	assert.Equal(t, 0, len(revocations.revoked("test-namespace/test-workload")))
+
+	// Without HUB_SECRET_REVOCATION nothing is revoked
+	var disabled *hubSecretRevocations
+	disabled.request("test-namespace/test-workload", "git-auth")
+	assert.Equal(t, 0, len(disabled.revoked("test-namespace/test-workload")))
+	disabled.done("test-namespace/test-workload")
+}
+
+func TestRevokedSecretError(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"}}
+	assert.NilError(t, revokedSecretError(secret))
+
+	secret.Annotations = map[string]string{revokedAnnotation: "false"}
+	assert.NilError(t, revokedSecretError(secret))
+
+	secret.Annotations[revokedAnnotation] = "true"
+	err := revokedSecretError(secret)
+	assert.Error(t, err, "secret test-namespace/git-auth is revoked")
+	assert.Assert(t, errors.Is(err, ErrSecretRevoked))
+	assert.Equal(t, secretRevokedReason, rejectionReason(err))
+}
+
+func TestRevokedRefs(t *testing.T) {
+	workload := syncedWorkload("test-workload", "spoke-1/test-namespace/git-auth"+conflictSecretSuffix+",spoke-2/remote-runs/git-auth,spoke-1/test-namespace/repository-token")
+	assert.DeepEqual(t, []syncedSecretRef{
+		{Cluster: "spoke-1", Namespace: "test-namespace", Name: "git-auth" + conflictSecretSuffix},
+		{Cluster: "spoke-2", Namespace: "remote-runs", Name: "git-auth"},
+	}, revokedRefs(workload, []string{"git-auth"}))
+	assert.Equal(t, 0, len(revokedRefs(workload, []string{"other-secret"})))
+}
+
+func TestRevokeSpokeSecret(t *testing.T) {
+	ctx := context.Background()
+	spokeKubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:        "git-auth" + knownHostsSuffix,
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{workloadAnnotation: "test-namespace/test-workload"},
+		}},
+	)
+	r := &Reconciler{
+		logger:     zap.NewNop().Sugar(),
+		knownHosts: knownHostsOptions{kind: knownHostsKindConfigMap, name: "ssh-known-hosts"},
+		quotas:     newSecretQuotas(secretQuotaOptions{maxCount: 1}),
+	}
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"}
+	assert.NilError(t, r.quotas.reserve("test-namespace", ref, &corev1.Secret{}))
+
+	assert.NilError(t, r.revokeSpokeSecret(ctx, spokeKubeClient, ref, "test-namespace/test-workload"))
+	_, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.Assert(t, apierrors.IsNotFound(err))
+	_, err = spokeKubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "git-auth"+knownHostsSuffix, metav1.GetOptions{})
+	assert.Assert(t, apierrors.IsNotFound(err))
+	// The revoked copy no longer counts against the quota
+	assert.NilError(t, r.quotas.reserve("test-namespace", syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "other-secret"}, &corev1.Secret{}))
+
+	// Revoking the copy again is not an error
+	assert.NilError(t, r.revokeSpokeSecret(ctx, spokeKubeClient, ref, "test-namespace/test-workload"))
+}
+
+func TestRevokeSpokeSecretsRejectsWorkload(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	revocations := newHubSecretRevocations()
+	revocations.request("test-namespace/test-workload", "git-auth")
+	r := &Reconciler{logger: zap.NewNop().Sugar(), recorder: recorder, hubSecretRevocations: revocations}
+
+	// Nothing left to delete, the spoke copies were already gone
+	err := r.revokeSpokeSecrets(context.Background(), syncedWorkload("test-workload", ""), []string{"git-auth"})
+	assert.Assert(t, errors.Is(err, ErrSecretRevoked))
+	assert.Assert(t, controller.IsPermanentError(err))
+	assert.Equal(t, "Warning SecretRevoked Not syncing secrets: hub secrets git-auth of namespace test-namespace were revoked", <-recorder.Events)
+	assert.Equal(t, 0, len(revocations.revoked("test-namespace/test-workload")))
+}
+
+func TestRevokeSpokeSecretsRemovedCluster(t *testing.T) {
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"}
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		recorder:       record.NewFakeRecorder(10),
+		hubKubeClient:  fake.NewSimpleClientset(),
+		kueueClient:    kueuefake.NewSimpleClientset(),
+		kueueNamespace: testKueueNamespace,
+		quotas:         newSecretQuotas(secretQuotaOptions{maxCount: 1}),
+	}
+	assert.NilError(t, r.quotas.reserve("test-namespace", ref, &corev1.Secret{}))
+
+	// The copies of the removed spoke cluster are given up, and their quota released
+	err := r.revokeSpokeSecrets(context.Background(), syncedWorkload("test-workload", ref.String()), []string{"git-auth"})
+	assert.Assert(t, errors.Is(err, ErrSecretRevoked))
+	assert.NilError(t, r.quotas.reserve("test-namespace", syncedSecretRef{Cluster: "other-cluster", Namespace: "test-namespace", Name: "git-auth"}, &corev1.Secret{}))
+}
@@ -0,0 +1,231 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// defaultRotationInterval is how often the credentials of long running PipelineRuns are rotated.
+const defaultRotationInterval = 30 * time.Minute
+
+// rotationRequests records the Workloads whose synced credentials must be rotated on their
+// next reconcile, or refreshed after their hub secret was updated.
+type rotationRequests struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func newRotationRequests() *rotationRequests {
+	return &rotationRequests{keys: map[string]struct{}{}}
+}
+
+func (r *rotationRequests) request(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key] = struct{}{}
+}
+
+func (r *rotationRequests) requested(key string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.keys[key]
+	return ok
+}
+
+func (r *rotationRequests) done(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, key)
+}
+
+// runSecretRotator periodically requests the rotation of the credentials of long running
+// PipelineRuns until the context is done.
+func (r *Reconciler) runSecretRotator(ctx context.Context, interval, threshold time.Duration, enqueue func(types.NamespacedName)) {
+	wait.JitterUntilWithContext(ctx, func(context.Context) {
+		r.requestRotations(threshold, enqueue)
+	}, interval, 0.1, false)
+}
+
+// requestRotations enqueues the Workloads led by this replica which were admitted more than
+// threshold ago and still have synced secrets, so their next reconcile fetches new material
+// from the secret source. Nothing is rotated while the featureSecretRotation gate is disabled.
+func (r *Reconciler) requestRotations(threshold time.Duration, enqueue func(types.NamespacedName)) {
+	if !r.features.isEnabled(featureSecretRotation) {
+		return
+	}
+
+	workloads, err := r.workloadLister.List(labels.Everything())
+	if err != nil {
+		r.logger.Errorf("error listing workloads for secret rotation: %v", err)
+		return
+	}
+
+	for _, workload := range workloads {
+		key := types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()}
+		if workload.GetDeletionTimestamp() != nil || len(syncedSecretRefs(workload)) == 0 || !r.isLeaderFor(key) {
+			continue
+		}
+		admitted := apimeta.FindStatusCondition(workload.Status.Conditions, kueuev1beta1.WorkloadAdmitted)
+		if admitted == nil || admitted.Status != metav1.ConditionTrue || time.Since(admitted.LastTransitionTime.Time) < threshold {
+			continue
+		}
+
+		r.logger.Debugf("requesting rotation of the secrets of workload %s", key)
+		r.rotations.request(key.String())
+		enqueue(key)
+	}
+}
+
+// refreshSpokeSecret replaces the data of the existing spoke secret by the freshly fetched one
+// when its token expires within the re-sync margin, when a rotation was requested, when the hub
+// secret was updated, when an operator requested a resync of the Workload, when the checksum
+// of the spoke secret doesn't match the hub secret anymore, or when it was synced for a deleted
+// PipelineRun of the same name, whose owner references are then moved to the new one. The labels
+// and annotations of the hub secret missing from an unchanged spoke secret are synced too. It
+// returns the spoke secret, as left by the refresh, and why it was refreshed, empty when it
+// wasn't. A spoke secret the controller didn't create fails with ErrSecretConflict, unless the
+// conflict policy adopts it. An update conflicting with another writer of the spoke secret, e.g.
+// Pipelines as Code or a controller annotating it, is decided again on a fresh copy.
+func (r *Reconciler) refreshSpokeSecret(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, secret *corev1.Secret, rotate, hubUpdated, requested bool) (*corev1.Secret, string, error) {
+	var (
+		spokeSecret    *corev1.Secret
+		reason, resync string
+	)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		reason, resync = "", ""
+		existing, err := spokeKubeClient.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		if err != nil {
+			return err
+		}
+
+		spokeSecret = existing
+		switch checksum, ok := existing.GetAnnotations()[checksumAnnotation]; {
+		case !isManagedSpokeSecret(existing) && r.clusterConflictPolicy(ctx, clusterName) != conflictPolicyAdopt:
+			return syncer.Classify(fmt.Errorf("secret %s/%s on spoke cluster %s was not created by %s", secret.Namespace, secret.Name, clusterName, managedByValue), ErrSecretConflict)
+		case !isManagedSpokeSecret(existing):
+			reason, resync = "unmanaged secret adopted on spoke cluster", resyncReasonAdopted
+		case pipelineRunRecreated(existing, secret):
+			reason, resync = "secret of deleted PipelineRun bound to the recreated one on spoke cluster", resyncReasonRecreated
+		case idempotentWrite(existing, secret) && !rotate && !hubUpdated && !requested && !r.expiresSoon(existing):
+			// Already written for this generation of the Workload, e.g. by a retry or another
+			// event of a storm; the metadata are repaired on a hub update or a new generation
+			recordIdempotentSkip(ctx)
+			return nil
+		case secretContentHash(existing) == secretContentHash(secret) && !metadataDrifted(existing, secret):
+			// The secret source has no new material
+			return nil
+		case secretContentHash(existing) == secretContentHash(secret):
+			reason, resync = "labels and annotations of hub secret synced to spoke cluster", resyncReasonMetadata
+		case r.expiresSoon(existing):
+			reason, resync = "token close to expiry refreshed on spoke cluster", resyncReasonExpiry
+		case rotate:
+			reason, resync = "credentials of long running PipelineRun rotated on spoke cluster", resyncReasonRotation
+		case hubUpdated:
+			reason, resync = "hub secret update synced to spoke cluster", resyncReasonHubUpdate
+		case requested:
+			reason, resync = "resync requested on the Workload synced to spoke cluster", resyncReasonRequested
+		// The sources minting credentials return new ones on every fetch, only the hub Secrets are
+		// verified. The secrets synced before the checksum was recorded aren't.
+		case ok && !r.source().ephemeral() && checksum != secretContentHash(secret):
+			reason, resync = "hub secret content changed, synced to spoke cluster", resyncReasonContentChanged
+		default:
+			return nil
+		}
+
+		adopt := !isManagedSpokeSecret(existing)
+		updated := existing.DeepCopy()
+		updated.Data = secret.Data
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		maps.Copy(updated.Labels, secret.Labels)
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		maps.Copy(updated.Annotations, secret.Annotations)
+		if resync == resyncReasonRecreated {
+			updated.OwnerReferences = reboundOwnerReferences(existing, secret)
+		}
+		if adopt {
+			updated.Type = secret.Type
+			updated.Labels = secret.Labels
+			updated.OwnerReferences = secret.OwnerReferences
+		}
+		if existing.Type != updated.Type {
+			// The type of a Secret is immutable, the adopted secret is replaced
+			spokeSecret, err = replaceSpokeSecret(ctx, spokeKubeClient, existing, updated)
+		} else {
+			spokeSecret, err = writeSpokeSecretDelta(ctx, spokeKubeClient, existing, updated)
+		}
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resync != "" {
+		recordSecretResync(ctx, resync)
+	}
+	return spokeSecret, reason, nil
+}
+
+// replaceSpokeSecret deletes the existing spoke secret and creates the updated copy in its place,
+// for the updates the API server refuses, such as a change of type. The deletion is preconditioned
+// on the existing secret, so a secret changed meanwhile conflicts and is decided again.
+func replaceSpokeSecret(ctx context.Context, spokeKubeClient kubernetes.Interface, existing, updated *corev1.Secret) (*corev1.Secret, error) {
+	uid, resourceVersion := existing.GetUID(), existing.GetResourceVersion()
+	err := spokeKubeClient.CoreV1().Secrets(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+	replacement := updated.DeepCopy()
+	replacement.UID, replacement.ResourceVersion = "", ""
+	replacement.CreationTimestamp = metav1.Time{}
+	replacement.ManagedFields = nil
+	return spokeKubeClient.CoreV1().Secrets(replacement.Namespace).Create(ctx, replacement, metav1.CreateOptions{})
+}
+
+// writeSpokeSecretDelta writes the updated copy of the existing spoke secret, with a merge patch
+// of its metadata when its content is unchanged, so the data isn't sent again nor recorded in the
+// audit log of the spoke API server.
+func writeSpokeSecretDelta(ctx context.Context, spokeKubeClient kubernetes.Interface, existing, updated *corev1.Secret) (*corev1.Secret, error) {
+	if !equality.Semantic.DeepEqual(existing.Data, updated.Data) {
+		return spokeKubeClient.CoreV1().Secrets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	}
+	patch, err := metadataPatch(existing, updated)
+	if err != nil || patch == nil {
+		return existing, err
+	}
+	return spokeKubeClient.CoreV1().Secrets(updated.Namespace).Patch(ctx, updated.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+}
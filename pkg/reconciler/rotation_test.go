@@ -0,0 +1,175 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestRequestRotations(t *testing.T) {
+	workload := func(name string, admittedAgo time.Duration, synced bool) *kueuev1beta1.Workload {
+		w := &kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Status: kueuev1beta1.WorkloadStatus{Conditions: []metav1.Condition{{
+				Type:               kueuev1beta1.WorkloadAdmitted,
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-admittedAgo)),
+			}}},
+		}
+		if synced {
+			w.Annotations = map[string]string{syncedSecretsAnnotation: testClusterName + "/test-namespace/git-auth"}
+		}
+		return w
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, w := range []*kueuev1beta1.Workload{
+		workload("long-running", 7*time.Hour, true),
+		workload("recent", time.Hour, true),
+		workload("not-synced", 7*time.Hour, false),
+	} {
+		assert.NilError(t, indexer.Add(w))
+	}
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		workloadLister: kueuev1beta1lister.NewWorkloadLister(indexer),
+		rotations:      newRotationRequests(),
+		features:       enabledFeatureGates(featureSecretRotation),
+	}
+
+	var enqueued []types.NamespacedName
+	enqueue := func(key types.NamespacedName) { enqueued = append(enqueued, key) }
+
+	// Only the leader requests rotations
+	r.requestRotations(6*time.Hour, enqueue)
+	assert.Equal(t, 0, len(enqueued))
+
+	// Nor does it while the feature gate is disabled
+	r.leader = leaderFor(t, reconciler.UniversalBucket())
+	r.features = disabledFeatureGates(featureSecretRotation)
+	r.requestRotations(6*time.Hour, enqueue)
+	assert.Equal(t, 0, len(enqueued))
+
+	r.features = enabledFeatureGates(featureSecretRotation)
+	r.requestRotations(6*time.Hour, enqueue)
+	assert.DeepEqual(t, []types.NamespacedName{{Namespace: "test-namespace", Name: "long-running"}}, enqueued)
+	assert.Assert(t, r.rotations.requested("test-namespace/long-running"))
+	assert.Assert(t, !r.rotations.requested("test-namespace/recent"))
+}
+
+func TestCreateSecretOnSpokeClusterRotates(t *testing.T) {
+	ctx := context.Background()
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("new-token")},
+	}
+	spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+		Data:       map[string][]byte{defaultSecretDataKey: []byte("old-token")},
+	})
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(hubSecret),
+		rotations:     newRotationRequests(),
+	}
+	spokeToken := func() string {
+		secret, err := spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+		assert.NilError(t, err)
+		return string(secret.Data[defaultSecretDataKey])
+	}
+
+	// Without a rotation request the existing secret is kept
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "old-token", spokeToken())
+
+	r.rotations.request("test-namespace/test-workload")
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+	assert.Equal(t, "new-token", spokeToken())
+}
+
+func TestRefreshSpokeSecretRetriesConflicts(t *testing.T) {
+	tests := []struct {
+		name          string
+		conflicts     int
+		expectedError bool
+	}{
+		{
+			name:      "concurrent writer",
+			conflicts: 1,
+		},
+		{
+			name:          "conflicting until the retries are exhausted",
+			conflicts:     100,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			spokeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+				Data:       map[string][]byte{defaultSecretDataKey: []byte("old-token")},
+			})
+			// Another writer annotates the spoke secret between each read and update
+			conflicts := 0
+			spokeKubeClient.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if conflicts == tt.conflicts {
+					return false, nil, nil
+				}
+				conflicts++
+				obj, err := spokeKubeClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("secrets"), "test-namespace", "test-secret")
+				assert.NilError(t, err)
+				annotated := obj.(*corev1.Secret).DeepCopy()
+				annotated.Annotations = map[string]string{"pipelinesascode.tekton.dev/state": "started"}
+				assert.NilError(t, spokeKubeClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("secrets"), annotated, "test-namespace"))
+				return true, nil, apierrors.NewConflict(corev1.Resource("secrets"), "test-secret", errors.New("the object has been modified"))
+			})
+			r := &Reconciler{logger: zap.NewNop().Sugar()}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace", Labels: map[string]string{managedByLabel: managedByValue}},
+				Data:       map[string][]byte{defaultSecretDataKey: []byte("new-token")},
+			}
+
+			refreshed, reason, err := r.refreshSpokeSecret(ctx, testClusterName, spokeKubeClient, secret, true, false, false)
+			if tt.expectedError {
+				assert.Assert(t, apierrors.IsConflict(err))
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, "credentials of long running PipelineRun rotated on spoke cluster", reason)
+			assert.Equal(t, "new-token", string(refreshed.Data[defaultSecretDataKey]))
+			assert.Equal(t, "started", refreshed.Annotations["pipelinesascode.tekton.dev/state"], "the update of the other writer must be kept")
+		})
+	}
+}
+
+func TestNilRotationRequests(t *testing.T) {
+	var r *rotationRequests
+	r.request("test-namespace/test-workload")
+	r.done("test-namespace/test-workload")
+	assert.Assert(t, !r.requested("test-namespace/test-workload"))
+}
@@ -0,0 +1,230 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultSealedSecretsControllerNamespace = "kube-system"
+	defaultSealedSecretsControllerName      = "sealed-secrets-controller"
+
+	// sealedSecretsCertificateTTL is how long the sealing certificate of a spoke cluster is
+	// reused, the sealed-secrets controller renews its keys every 30 days by default.
+	sealedSecretsCertificateTTL = time.Hour
+)
+
+var sealedSecretsResource = schema.GroupVersionResource{Group: "bitnami.com", Version: "v1alpha1", Resource: "sealedsecrets"}
+
+// sealedSecretsOptions configures the sealed-secrets spoke secret mode.
+type sealedSecretsOptions struct {
+	// controllerNamespace and controllerName locate the sealed-secrets controller Service on
+	// the spoke clusters, which serves their sealing certificate
+	controllerNamespace string
+	controllerName      string
+}
+
+// sealedSecretsCertificates caches the sealing public key of each spoke cluster.
+type sealedSecretsCertificates struct {
+	// fetching serializes the certificate reads of each spoke cluster
+	fetching keyedMutex
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt map[string]time.Time
+}
+
+func newSealedSecretsCertificates() *sealedSecretsCertificates {
+	return &sealedSecretsCertificates{keys: map[string]*rsa.PublicKey{}, fetchedAt: map[string]time.Time{}}
+}
+
+// sealingKey returns the public key of the spoke cluster's sealed-secrets controller, read
+// from its certificate through the API server's service proxy.
+func (r *Reconciler) sealingKey(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) (*rsa.PublicKey, error) {
+	c := r.sealedSecretsCertificates
+	if key, ok := c.cached(clusterName); ok {
+		return key, nil
+	}
+	// The reads of a spoke cluster are serialized, a slow spoke doesn't hold back the other ones
+	unlock, err := c.fetching.lock(ctx, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the sealing certificate of spoke cluster %s: %w", clusterName, err)
+	}
+	defer unlock()
+	if key, ok := c.cached(clusterName); ok {
+		return key, nil
+	}
+
+	opts := r.sealedSecrets
+	raw, err := spokeKubeClient.CoreV1().Services(opts.controllerNamespace).ProxyGet("http", opts.controllerName, "", "/v1/cert.pem", nil).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the sealing certificate of spoke cluster %s from %s/%s: %w", clusterName, opts.controllerNamespace, opts.controllerName, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("sealing certificate of spoke cluster %s is not PEM encoded", clusterName)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the sealing certificate of spoke cluster %s: %w", clusterName, err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sealing certificate of spoke cluster %s has no RSA public key", clusterName)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[clusterName] = key
+	c.fetchedAt[clusterName] = time.Now()
+	return key, nil
+}
+
+// cached returns the sealing key of the spoke cluster fetched within sealedSecretsCertificateTTL.
+func (c *sealedSecretsCertificates) cached(clusterName string) (*rsa.PublicKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetchedAt[clusterName]) < sealedSecretsCertificateTTL {
+		return c.keys[clusterName], true
+	}
+	return nil, false
+}
+
+// createSealedSecretOnSpokeCluster creates a SealedSecret on the spoke cluster in place of the
+// secret, with every value encrypted for the spoke's sealed-secrets controller, so the
+// credentials only leave the hub controller encrypted.
+func (r *Reconciler) createSealedSecretOnSpokeCluster(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, secret *corev1.Secret, event auditEvent) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	// Any failure is audited, the secret is never copied unsealed
+	key, err := r.sealingKey(spokeCtx, clusterName, spokeKubeClient)
+	r.clusterGuards.record(ctx, clusterName, err)
+	var sealedSecret *unstructured.Unstructured
+	if err == nil {
+		sealedSecret, err = newSealedSecret(rand.Reader, key, secret)
+	}
+	var spokeDynamicClient dynamic.Interface
+	if err == nil {
+		spokeDynamicClient, err = r.spokeDynamicClient(ctx, clusterName)
+	}
+	var created *unstructured.Unstructured
+	if err == nil {
+		created, err = spokeDynamicClient.Resource(sealedSecretsResource).Namespace(secret.Namespace).Create(spokeCtx, sealedSecret, metav1.CreateOptions{})
+		err = spokeError(err)
+		r.clusterGuards.record(ctx, clusterName, err)
+	}
+
+	event.Reason = "SealedSecret created for PipelineRun dispatched to spoke cluster"
+	if errors.IsAlreadyExists(err) {
+		event.Outcome = auditOutcomeUnchanged
+	} else if err != nil {
+		r.logger.Errorf("error creating SealedSecret %s/%s on spoke cluster %s: %v", secret.Namespace, secret.Name, clusterName, err)
+		event.Outcome, event.Error = auditOutcomeFailure, err
+		r.recordDecision(event)
+		return err
+	} else {
+		event = event.withSpokeObject(created)
+		event.Outcome = auditOutcomeSuccess
+	}
+	r.recordDecision(event)
+
+	r.logger.Infof("successfully created SealedSecret %s/%s on spoke cluster %s", secret.Namespace, secret.Name, clusterName)
+	return nil
+}
+
+// newSealedSecret returns the strict scoped SealedSecret the spoke's sealed-secrets controller
+// unseals into the secret. The owner references and tracking metadata of the secret are kept.
+func newSealedSecret(rnd io.Reader, key *rsa.PublicKey, secret *corev1.Secret) (*unstructured.Unstructured, error) {
+	// Strict scope binds the values to the namespace and name of the secret
+	label := []byte(secret.Namespace + "/" + secret.Name)
+	encryptedData := make(map[string]any, len(secret.Data))
+	for name, value := range secret.Data {
+		ciphertext, err := hybridEncrypt(rnd, key, value, label)
+		if err != nil {
+			return nil, fmt.Errorf("could not seal key %s: %w", name, err)
+		}
+		encryptedData[name] = base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	templateMetadata := map[string]any{}
+	if len(secret.Labels) > 0 {
+		templateMetadata["labels"] = stringMapToAny(secret.Labels)
+	}
+	if len(secret.Annotations) > 0 {
+		templateMetadata["annotations"] = stringMapToAny(secret.Annotations)
+	}
+
+	sealedSecret := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": sealedSecretsResource.GroupVersion().String(),
+		"kind":       "SealedSecret",
+		"spec": map[string]any{
+			"encryptedData": encryptedData,
+			"template": map[string]any{
+				"type":     string(secret.Type),
+				"metadata": templateMetadata,
+			},
+		},
+	}}
+	sealedSecret.SetName(secret.Name)
+	sealedSecret.SetNamespace(secret.Namespace)
+	sealedSecret.SetLabels(secret.Labels)
+	sealedSecret.SetAnnotations(secret.Annotations)
+	sealedSecret.SetOwnerReferences(secret.OwnerReferences)
+	return sealedSecret, nil
+}
+
+// hybridEncrypt encrypts the plaintext the way kubeseal does: a random AES-256-GCM session key
+// encrypts the plaintext, and is itself encrypted with RSA-OAEP, the output being the 2 bytes
+// length of the encrypted session key, the encrypted session key and the AES ciphertext.
+func hybridEncrypt(rnd io.Reader, key *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := io.ReadFull(rnd, sessionKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rnd, key, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := binary.BigEndian.AppendUint16(nil, uint16(len(encryptedKey)))
+	ciphertext = append(ciphertext, encryptedKey...)
+	// The session key is only ever used once, so a zero nonce is safe
+	return aead.Seal(ciphertext, make([]byte, aead.NonceSize()), plaintext, nil), nil
+}
+
+func stringMapToAny(values map[string]string) map[string]any {
+	result := make(map[string]any, len(values))
+	for k, v := range values {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// proxyResponse is the answer of a proxied request in tests, the fake clientset drops the
+// errors of proxy reactors.
+type proxyResponse struct {
+	body []byte
+	err  error
+}
+
+func (r proxyResponse) DoRaw(context.Context) ([]byte, error) { return r.body, r.err }
+
+func (r proxyResponse) Stream(context.Context) (io.ReadCloser, error) { return nil, r.err }
+
+// spokeWithSealedSecrets returns a spoke client whose sealed-secrets controller serves a
+// certificate of the key.
+func spokeWithSealedSecrets(t *testing.T, key *rsa.PrivateKey) *fake.Clientset {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+
+	client := fake.NewSimpleClientset()
+	client.PrependProxyReactor("services", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		assert.Equal(t, "kube-system", proxy.GetNamespace())
+		assert.Equal(t, "sealed-secrets-controller", proxy.GetName())
+		assert.Equal(t, "/v1/cert.pem", proxy.GetPath())
+		return true, proxyResponse{body: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}, nil
+	})
+	return client
+}
+
+// hybridDecrypt is the inverse of hybridEncrypt, as implemented by the sealed-secrets controller.
+func hybridDecrypt(t *testing.T, key *rsa.PrivateKey, ciphertext, label []byte) []byte {
+	keyLength := int(binary.BigEndian.Uint16(ciphertext))
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext[2:2+keyLength], label)
+	assert.NilError(t, err)
+	block, err := aes.NewCipher(sessionKey)
+	assert.NilError(t, err)
+	aead, err := cipher.NewGCM(block)
+	assert.NilError(t, err)
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), ciphertext[2+keyLength:], nil)
+	assert.NilError(t, err)
+	return plaintext
+}
+
+func TestCreateSealedSecretOnSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid"}},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"git-provider-token": []byte("super-secret-token")},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace", UID: "spoke-uid"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	spokeKubeClient := spokeWithSealedSecrets(t, key)
+	r := &Reconciler{
+		logger:          zap.NewNop().Sugar(),
+		hubKubeClient:   fake.NewSimpleClientset(hubSecret),
+		spokeSecretMode: spokeSecretModeSealedSecrets,
+		sealedSecrets: sealedSecretsOptions{
+			controllerNamespace: defaultSealedSecretsControllerNamespace,
+			controllerName:      defaultSealedSecretsControllerName,
+		},
+		sealedSecretsCertificates: newSealedSecretsCertificates(),
+		newSpokeDynamicClient: func(context.Context, string) (dynamic.Interface, error) {
+			return dynamicClient, nil
+		},
+	}
+
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	// The plaintext secret is never created on the spoke
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	sealedSecret, err := dynamicClient.Resource(sealedSecretsResource).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "spoke-uid", string(sealedSecret.GetOwnerReferences()[0].UID))
+	assert.Equal(t, managedByValue, sealedSecret.GetLabels()[managedByLabel])
+	templateAnnotations, _, _ := unstructured.NestedStringMap(sealedSecret.Object, "spec", "template", "metadata", "annotations")
+	assert.Equal(t, "test-namespace/test-workload", templateAnnotations[workloadAnnotation])
+
+	encrypted, _, _ := unstructured.NestedString(sealedSecret.Object, "spec", "encryptedData", "git-provider-token")
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	assert.NilError(t, err)
+	assert.Equal(t, "super-secret-token", string(hybridDecrypt(t, key, ciphertext, []byte("test-namespace/test-secret"))))
+
+	// Creating it again is not an error
+	_, _, err = r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.NilError(t, err)
+
+	ref := syncedSecretRef{Cluster: testClusterName, Namespace: "test-namespace", Name: "test-secret"}
+	assert.NilError(t, r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, "test-namespace/test-workload", "test"))
+	_, err = dynamicClient.Resource(sealedSecretsResource).Namespace("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
+
+func TestSealingKeyPerCluster(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	r := &Reconciler{
+		sealedSecrets: sealedSecretsOptions{
+			controllerNamespace: defaultSealedSecretsControllerNamespace,
+			controllerName:      defaultSealedSecretsControllerName,
+		},
+		sealedSecretsCertificates: newSealedSecretsCertificates(),
+	}
+
+	// A spoke cluster whose controller doesn't answer
+	blocked, release := make(chan struct{}), make(chan struct{})
+	slowSpoke := fake.NewSimpleClientset()
+	slowSpoke.PrependProxyReactor("services", func(k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		close(blocked)
+		<-release
+		return true, proxyResponse{err: errors.NewServiceUnavailable("no endpoints")}, nil
+	})
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		_, _ = r.sealingKey(context.Background(), "slow-cluster", slowSpoke)
+	}()
+	<-blocked
+
+	// The other spoke clusters get their key meanwhile
+	spokeKubeClient := spokeWithSealedSecrets(t, key)
+	sealingKey, err := r.sealingKey(context.Background(), testClusterName, spokeKubeClient)
+	assert.NilError(t, err)
+	assert.Assert(t, key.PublicKey.Equal(sealingKey))
+
+	// The key is cached
+	spokeKubeClient.ClearActions()
+	_, err = r.sealingKey(context.Background(), testClusterName, spokeKubeClient)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(spokeKubeClient.Actions()))
+
+	// The callers of the slow spoke cluster give up with their context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = r.sealingKey(ctx, "slow-cluster", slowSpoke)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(release)
+	<-slowDone
+}
+
+func TestCreateSealedSecretWithoutController(t *testing.T) {
+	ctx := context.Background()
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"git-provider-token": []byte("super-secret-token")},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	spokeKubeClient := fake.NewSimpleClientset()
+	spokeKubeClient.PrependProxyReactor("services", func(k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		return true, proxyResponse{err: errors.NewNotFound(corev1.Resource("services"), "sealed-secrets-controller")}, nil
+	})
+	r := &Reconciler{
+		logger:                    zap.NewNop().Sugar(),
+		hubKubeClient:             fake.NewSimpleClientset(hubSecret),
+		spokeSecretMode:           spokeSecretModeSealedSecrets,
+		sealedSecrets:             sealedSecretsOptions{controllerNamespace: "kube-system", controllerName: "sealed-secrets-controller"},
+		sealedSecretsCertificates: newSealedSecretsCertificates(),
+	}
+
+	_, _, err := r.createSecretOnSpokeCluster(ctx, "test-secret", testClusterName, spokeKubeClient, pipelineRun, workload)
+	assert.ErrorContains(t, err, "could not get the sealing certificate of spoke cluster")
+
+	// The secret is never copied unsealed
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "test-secret", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
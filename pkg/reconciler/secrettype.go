@@ -0,0 +1,110 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// secretTypeKeys are the spoke secret types which can be enforced, and the keys the API server
+// requires in their data: all of them, but only one for basic-auth.
+var secretTypeKeys = map[corev1.SecretType][]string{
+	corev1.SecretTypeOpaque:           nil,
+	corev1.SecretTypeBasicAuth:        {corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey},
+	corev1.SecretTypeSSHAuth:          {corev1.SSHAuthPrivateKey},
+	corev1.SecretTypeTLS:              {corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+	corev1.SecretTypeDockerConfigJson: {corev1.DockerConfigJsonKey},
+}
+
+// parseSpokeSecretType validates the SPOKE_SECRET_TYPE value, empty keeps the type of the hub
+// secrets.
+func parseSpokeSecretType(value string) (corev1.SecretType, error) {
+	secretType := corev1.SecretType(value)
+	if _, ok := secretTypeKeys[secretType]; value != "" && !ok {
+		types := make([]string, 0, len(secretTypeKeys))
+		for secretType := range secretTypeKeys {
+			types = append(types, string(secretType))
+		}
+		slices.Sort(types)
+		return "", fmt.Errorf("unsupported secret type %q, must be one of %s", value, strings.Join(types, ", "))
+	}
+	return secretType, nil
+}
+
+// parseSecretKeyMapping parses comma separated hub=spoke pairs of secret keys, such as
+// git-provider-token=password.
+func parseSecretKeyMapping(value string) (map[string]string, error) {
+	mapping := map[string]string{}
+	targets := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || len(validation.IsConfigMapKey(from)) > 0 || len(validation.IsConfigMapKey(to)) > 0 {
+			return nil, fmt.Errorf("invalid key mapping %q, must be hub-key=spoke-key", pair)
+		}
+		if _, ok := mapping[from]; ok || targets[to] {
+			return nil, fmt.Errorf("invalid key mapping %q, the keys can only be mapped once", pair)
+		}
+		mapping[from], targets[to] = to, true
+	}
+	return mapping, nil
+}
+
+// enforceSecretType returns the spoke secret with its keys renamed by the key mapping and the
+// enforced type, the type of the hub secret when empty. The keys missing from the mapping are
+// kept. It fails when the data lacks the keys the API server requires for the type.
+func enforceSecretType(secret *corev1.Secret, secretType corev1.SecretType, keyMapping map[string]string) (*corev1.Secret, error) {
+	if secretType == "" && len(keyMapping) == 0 {
+		return secret, nil
+	}
+	secret = secret.DeepCopy()
+	if len(keyMapping) > 0 {
+		data := make(map[string][]byte, len(secret.Data))
+		for key, value := range secret.Data {
+			if _, mapped := keyMapping[key]; !mapped {
+				data[key] = value
+			}
+		}
+		// The mapped keys take precedence over the hub keys of the same name
+		for from, to := range keyMapping {
+			if value, ok := secret.Data[from]; ok {
+				data[to] = value
+			}
+		}
+		secret.Data = data
+	}
+	if secretType == "" || secretType == secret.Type {
+		return secret, nil
+	}
+
+	required := secretTypeKeys[secretType]
+	present := 0
+	for _, key := range required {
+		if _, ok := secret.Data[key]; ok {
+			present++
+		}
+	}
+	if present < len(required) && (secretType != corev1.SecretTypeBasicAuth || present == 0) {
+		return nil, fmt.Errorf("secret %s/%s can't be synced as %s, it has the keys %s but requires %s: map them with the key mapping", secret.Namespace, secret.Name, secretType, strings.Join(slices.Sorted(maps.Keys(secret.Data)), ", "), strings.Join(required, ", "))
+	}
+	secret.Type = secretType
+	return secret, nil
+}
+
+// enforceSpokeSecretType applies the secret type and the key mapping of the sync policy of the
+// hub namespace to the spoke secret.
+func (r *Reconciler) enforceSpokeSecretType(ctx context.Context, namespace string, secret *corev1.Secret) (*corev1.Secret, error) {
+	policy, err := r.syncPolicy(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return enforceSecretType(secret, policy.secretType, policy.keyMapping)
+}
@@ -0,0 +1,104 @@
+package reconciler
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnforceSecretType(t *testing.T) {
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"},
+		Type:       corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"git-provider-token": []byte("token"),
+			"password":           []byte("stale"),
+			".gitconfig":         []byte("[credential]"),
+		},
+	}
+
+	tests := []struct {
+		name          string
+		secretType    corev1.SecretType
+		keyMapping    map[string]string
+		expectedType  corev1.SecretType
+		expectedData  map[string]string
+		expectedError string
+	}{
+		{
+			name:         "hub type and keys",
+			expectedType: corev1.SecretTypeOpaque,
+			expectedData: map[string]string{"git-provider-token": "token", "password": "stale", ".gitconfig": "[credential]"},
+		},
+		{
+			name:         "basic-auth with mapped keys",
+			secretType:   corev1.SecretTypeBasicAuth,
+			keyMapping:   map[string]string{"git-provider-token": "password", "git-user": "username"},
+			expectedType: corev1.SecretTypeBasicAuth,
+			expectedData: map[string]string{"password": "token", ".gitconfig": "[credential]"},
+		},
+		{
+			name:         "keys mapped without a type",
+			keyMapping:   map[string]string{".gitconfig": "gitconfig"},
+			expectedType: corev1.SecretTypeOpaque,
+			expectedData: map[string]string{"git-provider-token": "token", "password": "stale", "gitconfig": "[credential]"},
+		},
+		{
+			name:          "required keys missing",
+			secretType:    corev1.SecretTypeSSHAuth,
+			expectedError: "secret test-namespace/git-auth can't be synced as kubernetes.io/ssh-auth, it has the keys .gitconfig, git-provider-token, password but requires ssh-privatekey: map them with the key mapping",
+		},
+		{
+			name:          "tls requires both keys",
+			secretType:    corev1.SecretTypeTLS,
+			keyMapping:    map[string]string{"git-provider-token": "tls.key"},
+			expectedError: "secret test-namespace/git-auth can't be synced as kubernetes.io/tls, it has the keys .gitconfig, password, tls.key but requires tls.crt, tls.key: map them with the key mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := enforceSecretType(hubSecret, tt.secretType, tt.keyMapping)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedType, secret.Type)
+			data := map[string]string{}
+			for key, value := range secret.Data {
+				data[key] = string(value)
+			}
+			assert.DeepEqual(t, tt.expectedData, data)
+			assert.Equal(t, "stale", string(hubSecret.Data["password"]), "the hub secret is left untouched")
+		})
+	}
+}
+
+func TestParseSecretKeyMapping(t *testing.T) {
+	tests := []struct {
+		value         string
+		expected      map[string]string
+		expectedError string
+	}{
+		{value: "", expected: map[string]string{}},
+		{value: "git-provider-token=password,git-user=username", expected: map[string]string{"git-provider-token": "password", "git-user": "username"}},
+		{value: "password", expectedError: `invalid key mapping "password", must be hub-key=spoke-key`},
+		{value: "token=pass word", expectedError: `invalid key mapping "token=pass word", must be hub-key=spoke-key`},
+		{value: "token=password,token=username", expectedError: `invalid key mapping "token=username", the keys can only be mapped once`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mapping, err := parseSecretKeyMapping(tt.value)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, mapping)
+		})
+	}
+}
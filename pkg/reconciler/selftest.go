@@ -0,0 +1,177 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// selfTestRetryInterval is how often the spoke clusters which failed the self-test are
+	// tested again, so fixing their RBAC or kubeconfig makes the controller ready without a restart,
+	// and the MultiKueueClusters are listed again to test the ones added since.
+	selfTestRetryInterval = time.Minute
+
+	// selfTestSecretPrefix prefixes the names generated for the dry-run secrets of the self-test.
+	selfTestSecretPrefix = "secret-syncer-self-test-"
+)
+
+// selfTest checks, on startup, that the secrets can be synced to every MultiKueueCluster: its
+// kubeconfig and SpokeClusterConfig resolve, and a secret can be created in the self-test
+// namespace, with a dry-run create which persists nothing. Each cluster gets a readiness check,
+// so RBAC and kubeconfig problems surface before the first Workload is dispatched to it.
+type selfTest struct {
+	namespace string
+	health    *healthChecker
+
+	mu sync.Mutex
+	// ran is set once every cluster was tested, listErr when the clusters couldn't be listed
+	ran     bool
+	listErr error
+	results map[string]error
+}
+
+// newSelfTest registers the readiness check of the self-test, failing until it ran.
+func newSelfTest(namespace string, health *healthChecker) *selfTest {
+	s := &selfTest{namespace: namespace, health: health, results: map[string]error{}}
+	health.addReadinessCheck("spoke-self-test", s.check)
+	return s
+}
+
+// check fails until every cluster was tested.
+func (s *selfTest) check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.listErr != nil:
+		return s.listErr
+	case !s.ran:
+		return errors.New("the spoke clusters are not tested yet")
+	}
+	return nil
+}
+
+// record sets the result of the self-test of a cluster, registering its readiness check the
+// first time.
+func (s *selfTest) record(clusterName string, err error) {
+	s.mu.Lock()
+	_, known := s.results[clusterName]
+	s.results[clusterName] = err
+	s.mu.Unlock()
+	if !known {
+		s.health.addReadinessCheck("spoke-self-test/"+clusterName, func() error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.results[clusterName]
+		})
+	}
+}
+
+// prune forgets the results of the clusters which are gone, unregistering their readiness checks.
+func (s *selfTest) prune(clusters map[string]bool) {
+	s.mu.Lock()
+	var gone []string
+	for clusterName := range s.results {
+		if !clusters[clusterName] {
+			delete(s.results, clusterName)
+			gone = append(gone, clusterName)
+		}
+	}
+	s.mu.Unlock()
+	for _, clusterName := range gone {
+		s.health.removeReadinessCheck("spoke-self-test/" + clusterName)
+	}
+}
+
+// passed reports whether the cluster passed the self-test already.
+func (s *selfTest) passed(clusterName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err, ok := s.results[clusterName]
+	return ok && err == nil
+}
+
+// runSelfTest tests the spoke clusters every selfTestRetryInterval until the context is done,
+// the failed and the added ones, as the passed ones aren't tested again.
+func (r *Reconciler) runSelfTest(ctx context.Context, test *selfTest) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		r.selfTestSpokes(ctx, test)
+	}, selfTestRetryInterval)
+}
+
+// selfTestSpokes tests, concurrently, the MultiKueueClusters which didn't pass the self-test
+// yet, and reports whether they all passed. The results of the deleted clusters are dropped.
+func (r *Reconciler) selfTestSpokes(ctx context.Context, test *selfTest) bool {
+	clusters, err := r.multiKueueClusterNames(ctx)
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters for the self-test: %v", err)
+		test.mu.Lock()
+		test.listErr = err
+		test.mu.Unlock()
+		return false
+	}
+	test.prune(clusters)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		passed = true
+	)
+	for cluster := range clusters {
+		if test.passed(cluster) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := r.selfTestSpoke(ctx, cluster, test.namespace)
+			test.record(cluster, err)
+			if err != nil {
+				r.logger.Errorf("spoke cluster %s failed the self-test, retrying in %s: %v", cluster, selfTestRetryInterval, err)
+				mu.Lock()
+				passed = false
+				mu.Unlock()
+				return
+			}
+			r.logger.Infof("spoke cluster %s passed the self-test", cluster)
+		}()
+	}
+	wg.Wait()
+
+	test.mu.Lock()
+	test.ran, test.listErr = true, nil
+	test.mu.Unlock()
+	return passed
+}
+
+// selfTestSpoke resolves the clients of the spoke cluster, then dry-runs the create of a secret
+// in the namespace.
+func (r *Reconciler) selfTestSpoke(ctx context.Context, clusterName, namespace string) error {
+	spokeKubeClient, _, err := r.getSpokeClients(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+	return r.dryRunSecretCreate(ctx, clusterName, spokeKubeClient, namespace)
+}
+
+// dryRunSecretCreate checks a secret can be created in the namespace of the spoke cluster,
+// without persisting it.
+func (r *Reconciler) dryRunSecretCreate(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, namespace string) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{GenerateName: selfTestSecretPrefix, Namespace: namespace}}
+	_, err := spokeKubeClient.CoreV1().Secrets(namespace).Create(spokeCtx, secret, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	err = spokeError(err)
+	r.clusterGuards.record(ctx, clusterName, err)
+	if err != nil {
+		return fmt.Errorf("could not create a secret in namespace %s of spoke cluster %s: %w", namespace, clusterName, err)
+	}
+	return nil
+}
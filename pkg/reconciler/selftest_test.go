@@ -0,0 +1,96 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/metrics"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func readiness(health *healthChecker) (int, string) {
+	recorder := httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestSelfTestSpokes(t *testing.T) {
+	metrics.InitForTesting()
+	ctx := context.Background()
+	r := &Reconciler{
+		logger:        zap.NewNop().Sugar(),
+		hubKubeClient: fake.NewSimpleClientset(),
+		kueueClient:   kueuefake.NewSimpleClientset(&kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: testClusterName}}),
+	}
+	health := newHealthChecker()
+	test := newSelfTest("ci", health)
+
+	code, body := readiness(health)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "[-] spoke-self-test failed: the spoke clusters are not tested yet\n", body)
+
+	// The MultiKueueCluster has no kubeconfig, its readiness check fails until it passes
+	assert.Assert(t, !r.selfTestSpokes(ctx, test))
+	code, body = readiness(health)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Assert(t, !test.passed(testClusterName))
+	assert.Assert(t, strings.HasPrefix(body, "[+] spoke-self-test ok\n[-] spoke-self-test/"+testClusterName+" failed: "), body)
+
+	test.record(testClusterName, nil)
+	code, body = readiness(health)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[+] spoke-self-test ok\n[+] spoke-self-test/"+testClusterName+" ok\n", body)
+
+	// The clusters which passed aren't tested again
+	assert.Assert(t, r.selfTestSpokes(ctx, test))
+
+	// The deleted clusters are dropped, the added ones tested
+	assert.NilError(t, r.kueueClient.KueueV1beta1().MultiKueueClusters().Delete(ctx, testClusterName, metav1.DeleteOptions{}))
+	_, err := r.kueueClient.KueueV1beta1().MultiKueueClusters().Create(ctx, &kueuev1beta1.MultiKueueCluster{ObjectMeta: metav1.ObjectMeta{Name: "added-cluster"}}, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, !r.selfTestSpokes(ctx, test))
+	assert.Assert(t, !test.passed(testClusterName))
+	code, body = readiness(health)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Assert(t, strings.HasPrefix(body, "[+] spoke-self-test ok\n[-] spoke-self-test/added-cluster failed: "), body)
+	assert.Assert(t, !strings.Contains(body, "spoke-self-test/"+testClusterName), body)
+}
+
+func TestDryRunSecretCreate(t *testing.T) {
+	ctx := context.Background()
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+
+	spokeKubeClient := fake.NewSimpleClientset()
+	var options metav1.CreateOptions
+	spokeKubeClient.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateActionImpl)
+		options = create.GetCreateOptions()
+		secret := create.GetObject().(*corev1.Secret)
+		assert.Equal(t, selfTestSecretPrefix, secret.GenerateName)
+		return true, secret, nil
+	})
+	assert.NilError(t, r.dryRunSecretCreate(ctx, testClusterName, spokeKubeClient, "ci"))
+	assert.DeepEqual(t, []string{metav1.DryRunAll}, options.DryRun)
+
+	forbidden := fake.NewSimpleClientset()
+	forbidden.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", fmt.Errorf("not allowed"))
+	})
+	err := r.dryRunSecretCreate(ctx, testClusterName, forbidden, "ci")
+	assert.ErrorContains(t, err, "could not create a secret in namespace ci of spoke cluster "+testClusterName)
+	assert.Assert(t, errors.IsForbidden(err))
+}
@@ -0,0 +1,25 @@
+package reconciler
+
+import (
+	"fmt"
+	"os"
+
+	"knative.dev/pkg/leaderelection"
+	"knative.dev/pkg/reconciler"
+)
+
+// statefulSetShard returns the bucket of the Workload keys this replica owns when running as a
+// StatefulSet, nil when the controller runs as a Deployment. Knative assigns the bucket of the pod
+// ordinal when STATEFUL_CONTROLLER_ORDINAL is set, but silently falls back to Lease based leader
+// election of every bucket when the ordinal doesn't fit the buckets of the leader election config,
+// which would have that replica reconcile the Workloads of the other ones as well.
+func statefulSetShard(cfg *leaderelection.Config) (reconciler.Bucket, error) {
+	if os.Getenv("STATEFUL_CONTROLLER_ORDINAL") == "" {
+		return nil, nil
+	}
+	bucket, _, err := leaderelection.NewStatefulSetBucketAndSet(int(cfg.Buckets))
+	if err != nil {
+		return nil, fmt.Errorf("invalid StatefulSet sharding with %d buckets: %w", cfg.Buckets, err)
+	}
+	return bucket, nil
+}
@@ -0,0 +1,91 @@
+package reconciler
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/leaderelection"
+)
+
+func TestStatefulSetShard(t *testing.T) {
+	tests := []struct {
+		name        string
+		ordinal     string
+		serviceName string
+		buckets     uint32
+		wantShard   bool
+		wantErr     string
+	}{
+		{
+			name:    "deployment",
+			buckets: 3,
+		},
+		{
+			name:        "ordinal within the buckets",
+			ordinal:     "workload-controller-2",
+			serviceName: "workload-controller",
+			buckets:     3,
+			wantShard:   true,
+		},
+		{
+			name:        "ordinal out of the buckets",
+			ordinal:     "workload-controller-3",
+			serviceName: "workload-controller",
+			buckets:     3,
+			wantErr:     "invalid StatefulSet sharding with 3 buckets: ordinal 3 is out of range [0, 3)",
+		},
+		{
+			name:        "invalid ordinal",
+			ordinal:     "workload-controller",
+			serviceName: "workload-controller",
+			buckets:     1,
+			wantErr:     "invalid StatefulSet sharding",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SYSTEM_NAMESPACE", "syncer-service")
+			t.Setenv("STATEFUL_CONTROLLER_ORDINAL", tt.ordinal)
+			t.Setenv("STATEFUL_SERVICE_NAME", tt.serviceName)
+
+			shard, err := statefulSetShard(&leaderelection.Config{Buckets: tt.buckets})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, shard != nil, tt.wantShard)
+		})
+	}
+}
+
+func TestStatefulSetShardsPartitionKeys(t *testing.T) {
+	t.Setenv("SYSTEM_NAMESPACE", "syncer-service")
+	t.Setenv("STATEFUL_SERVICE_NAME", "workload-controller")
+	cfg := &leaderelection.Config{Buckets: 3}
+
+	keys := []types.NamespacedName{
+		{Namespace: "team-a", Name: "workload-1"},
+		{Namespace: "team-a", Name: "workload-2"},
+		{Namespace: "team-b", Name: "workload-1"},
+		{Namespace: "team-c", Name: "workload-3"},
+		{Namespace: "team-d", Name: "workload-4"},
+	}
+	owners := make(map[types.NamespacedName]int, len(keys))
+	for ordinal := range int(cfg.Buckets) {
+		t.Setenv("STATEFUL_CONTROLLER_ORDINAL", fmt.Sprintf("workload-controller-%d", ordinal))
+		shard, err := statefulSetShard(cfg)
+		assert.NilError(t, err)
+		for _, key := range keys {
+			if shard.Has(key) {
+				owners[key]++
+			}
+		}
+	}
+	for _, key := range keys {
+		assert.Equal(t, owners[key], 1, "Workload %s must be owned by exactly one replica", key)
+	}
+}
@@ -0,0 +1,181 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+// Secret sources configured with SECRET_SOURCE.
+const (
+	secretSourceKubernetes = "kubernetes"
+	secretSourceVault      = "vault"
+	secretSourceAWS        = "aws-secrets-manager"
+	secretSourceGCP        = "gcp-secret-manager"
+	secretSourceGitHubApp  = "github-app"
+)
+
+const (
+	// secretIDAnnotation on a PipelineRun overrides the cloud secret manager secret its git
+	// credentials are read from.
+	secretIDAnnotation = syncerGroupName + "/secret-id"
+
+	// defaultSecretDataKey holds secret manager values which aren't JSON objects, it is the
+	// key Pipelines-as-Code stores the git token under.
+	defaultSecretDataKey = "git-provider-token"
+)
+
+// secretReferenceForbiddenReason is the reason of the Warning event recorded on the Workloads
+// whose PipelineRun points at the credentials of another namespace.
+const secretReferenceForbiddenReason = "SecretReferenceForbidden"
+
+// secretSource fetches the git credentials to materialize on the spoke cluster for a PipelineRun.
+type secretSource interface {
+	// fetch returns the secret named by the PipelineRun's git-auth-secret annotation.
+	fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error)
+	// ephemeral reports whether the spoke copies only live for the duration of the run. Their
+	// source isn't a hub Secret, so they are deleted as soon as the PipelineRun is done.
+	ephemeral() bool
+}
+
+// hubSecretSource reads the git credentials from the hub Secret created by Pipelines-as-Code, from
+// the cache when it has it.
+type hubSecretSource struct {
+	client kubernetes.Interface
+	cache  *hubSecretCache
+}
+
+func (s hubSecretSource) fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error) {
+	if secret, ok := s.cache.get(pipelineRun.GetNamespace(), secretName); ok {
+		return secret, nil
+	}
+	return s.client.CoreV1().Secrets(pipelineRun.GetNamespace()).Get(ctx, secretName, metav1.GetOptions{})
+}
+
+func (hubSecretSource) ephemeral() bool { return false }
+
+// source returns the configured secret source, the hub Secrets by default.
+func (r *Reconciler) source() secretSource {
+	if r.secretSource != nil {
+		return r.secretSource
+	}
+	return hubSecretSource{client: r.hubKubeClient, cache: r.hubSecretCache}
+}
+
+// parseSecretSource validates the SECRET_SOURCE value, empty defaults to kubernetes.
+func parseSecretSource(value string) (string, error) {
+	switch value {
+	case "":
+		return secretSourceKubernetes, nil
+	case secretSourceKubernetes, secretSourceVault, secretSourceAWS, secretSourceGCP, secretSourceGitHubApp:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported secret source %q, must be one of %s", value,
+			strings.Join([]string{secretSourceKubernetes, secretSourceVault, secretSourceAWS, secretSourceGCP, secretSourceGitHubApp}, ", "))
+	}
+}
+
+// ephemeralSecret returns the Secret to materialize on the spoke for credentials read from an
+// external backend. It is owned by the spoke PipelineRun, so it never outlives the run, and
+// annotated with where its data was read from.
+func ephemeralSecret(pipelineRun *v1.PipelineRun, secretName, sourceAnnotation, sourceRef string, data map[string][]byte) *corev1.Secret {
+	isController := true
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secretName,
+			Namespace:   pipelineRun.GetNamespace(),
+			Annotations: map[string]string{sourceAnnotation: sourceRef},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1.SchemeGroupVersion.String(),
+				Kind:       "PipelineRun",
+				Name:       pipelineRun.GetName(),
+				UID:        pipelineRun.GetUID(),
+				Controller: &isController,
+			}},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+// secretDataFromMap converts the key/values of an external secret to Secret data, non string
+// values are JSON encoded.
+func secretDataFromMap(values map[string]any) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(values))
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			data[key] = []byte(str)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode key %s: %w", key, err)
+		}
+		data[key] = encoded
+	}
+	return data, nil
+}
+
+// secretDataFromValue converts a single secret value, as stored by cloud secret managers, to
+// Secret data. A JSON object is split into keys, any other value is stored under
+// defaultSecretDataKey.
+func secretDataFromValue(value []byte) (map[string][]byte, error) {
+	values := map[string]any{}
+	if err := json.Unmarshal(value, &values); err == nil && len(values) > 0 {
+		return secretDataFromMap(values)
+	}
+	return map[string][]byte{defaultSecretDataKey: value}, nil
+}
+
+// expandSecretTemplate replaces {namespace} and {name} in the template by the PipelineRun
+// namespace and the git-auth secret name.
+func expandSecretTemplate(template string, pipelineRun *v1.PipelineRun, secretName string) string {
+	return strings.NewReplacer("{namespace}", pipelineRun.GetNamespace(), "{name}", secretName).Replace(template)
+}
+
+// secretReference returns the reference of the PipelineRun's credentials in an external backend,
+// the template expanded or the override of the annotation. An override is only honored under the
+// prefix the template gives the namespace of the PipelineRun, e.g. team-a/ for {namespace}/{name},
+// so a tenant can't read the credentials of another namespace.
+func secretReference(template, annotation string, pipelineRun *v1.PipelineRun, secretName string) (string, error) {
+	override := pipelineRun.GetAnnotations()[annotation]
+	if override == "" {
+		return expandSecretTemplate(template, pipelineRun, secretName), nil
+	}
+	prefix, ok := namespacePrefix(template, pipelineRun)
+	if !ok {
+		return "", syncer.Classify(fmt.Errorf("%s of PipelineRun %s/%s can't be honored, the template %s doesn't scope the references to a namespace",
+			annotation, pipelineRun.GetNamespace(), pipelineRun.GetName(), template), ErrSecretReferenceForbidden)
+	}
+	rest, ok := strings.CutPrefix(override, prefix)
+	if !ok || slices.ContainsFunc(strings.Split(rest, "/"), func(segment string) bool { return segment == "" || segment == "." || segment == ".." }) {
+		return "", syncer.Classify(fmt.Errorf("%s %q of PipelineRun %s/%s is not under %s",
+			annotation, override, pipelineRun.GetNamespace(), pipelineRun.GetName(), prefix), ErrSecretReferenceForbidden)
+	}
+	return override, nil
+}
+
+// namespacePrefix returns the template expanded up to its {name}, where the references of the
+// namespace of the PipelineRun start. There is none when the template doesn't put the namespace
+// there, or it isn't followed by a character namespace names can't hold, as team-a- would also
+// prefix the references of team-a-b.
+func namespacePrefix(template string, pipelineRun *v1.PipelineRun) (string, bool) {
+	before, _, ok := strings.Cut(template, "{name}")
+	if !ok {
+		return "", false
+	}
+	_, after, ok := strings.Cut(before, "{namespace}")
+	if !ok || after == "" || strings.ContainsAny(after[:1], "abcdefghijklmnopqrstuvwxyz0123456789-") {
+		return "", false
+	}
+	return expandSecretTemplate(before, pipelineRun, ""), true
+}
@@ -0,0 +1,115 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	tektonversioned2 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// spokeClientSet is the clients of a spoke cluster, created from the version of its REST config.
+type spokeClientSet struct {
+	version string
+	kube    kubernetes.Interface
+	tekton  tektonversioned2.Interface
+}
+
+// spokeClientCache remembers the clients of the spoke clusters. The REST configs of the spoke
+// clusters set a proxy and wrap the transport, which client-go never shares between clients, so
+// clients created on every reconcile would each open their own connections to the spoke API
+// server. A nil spokeClientCache creates the clients on every call.
+type spokeClientCache struct {
+	mu      sync.Mutex
+	clients map[string]spokeClientSet
+}
+
+func newSpokeClientCache() *spokeClientCache {
+	return &spokeClientCache{clients: map[string]spokeClientSet{}}
+}
+
+// get returns the clients of the spoke cluster created for the config version, ok false when
+// there are none, e.g. once the kubeconfig or the SpokeClusterConfig of the cluster changed.
+func (c *spokeClientCache) get(clusterName, version string) (spokeClientSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clients, ok := c.clients[clusterName]
+	return clients, ok && clients.version == version
+}
+
+func (c *spokeClientCache) set(clusterName string, clients spokeClientSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients[clusterName] = clients
+}
+
+// forget drops the clients of the spoke cluster, e.g. once its config can't be resolved anymore.
+func (c *spokeClientCache) forget(clusterName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, clusterName)
+}
+
+// cachedSpokeClients returns the clients of the spoke cluster, created again when its REST config
+// changed since they were cached.
+func (r *Reconciler) cachedSpokeClients(ctx context.Context, clusterName string) (kubernetes.Interface, tektonversioned2.Interface, error) {
+	if r.spokeClients == nil {
+		return r.spokeSyncer().SpokeClients(ctx, clusterName)
+	}
+	config, err := r.getSpokeClusterConfig(ctx, clusterName)
+	if err != nil {
+		r.spokeClients.forget(clusterName)
+		return nil, nil, err
+	}
+	version, err := r.spokeConfigVersion(ctx, clusterName, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if clients, ok := r.spokeClients.get(clusterName, version); ok {
+		return clients.kube, clients.tekton, nil
+	}
+
+	clients := spokeClientSet{version: version}
+	if clients.kube, err = kubernetes.NewForConfig(config); err != nil {
+		return nil, nil, fmt.Errorf("could not create kube client for spoke cluster %s: %w", clusterName, err)
+	}
+	if clients.tekton, err = tektonversioned2.NewForConfig(config); err != nil {
+		return nil, nil, fmt.Errorf("could not create tekton client for spoke cluster %s: %w", clusterName, err)
+	}
+	r.spokeClients.set(clusterName, clients)
+	return clients.kube, clients.tekton, nil
+}
+
+// spokeConfigVersion returns the digest of the REST config of the spoke cluster: its server, its
+// credentials and the settings of its SpokeClusterConfig, whose proxy can't be read back from
+// the config.
+func (r *Reconciler) spokeConfigVersion(ctx context.Context, clusterName string, config *rest.Config) (string, error) {
+	settings, err := r.spokeClusterConfigs.get(ctx, clusterName)
+	if err != nil {
+		return "", err
+	}
+	proxyURL := ""
+	if settings != nil {
+		proxyURL = settings.ProxyURL
+	}
+	fields := []string{
+		config.Host, config.APIPath, config.ServerName, proxyURL,
+		config.Username, config.Password, config.BearerToken, config.BearerTokenFile, config.Impersonate.UserName,
+		config.CAFile, config.CertFile, config.KeyFile, string(config.CAData), string(config.CertData), string(config.KeyData),
+		fmt.Sprint(config.Insecure, config.QPS, config.Burst, config.Timeout),
+	}
+	if config.ExecProvider != nil {
+		fields = append(fields, config.ExecProvider.Command, strings.Join(config.ExecProvider.Args, " "))
+	}
+	digest := sha256.New()
+	for _, field := range fields {
+		digest.Write([]byte(field))
+		digest.Write([]byte{0})
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
@@ -0,0 +1,78 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestCachedSpokeClients(t *testing.T) {
+	ctx := context.Background()
+	cluster := &kueuev1beta1.MultiKueueCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+		Spec: kueuev1beta1.MultiKueueClusterSpec{
+			KubeConfig: kueuev1beta1.KubeConfig{LocationType: kueuev1beta1.SecretLocationType, Location: testSecretName},
+		},
+	}
+	kubeconfigSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testKueueNamespace},
+		Data:       map[string][]byte{"kubeconfig": validKubeConfigData()},
+	}
+	hubKubeClient := fake.NewSimpleClientset(kubeconfigSecret)
+	kueueClient := kueuefake.NewSimpleClientset(cluster)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{spokeClusterConfigGVR: "SpokeClusterConfigList"})
+	configs := newSpokeClusterConfigs(dynamicClient)
+	now := time.Now()
+	configs.now = func() time.Time { return now }
+	r := &Reconciler{
+		logger:              zap.NewNop().Sugar(),
+		hubKubeClient:       hubKubeClient,
+		kueueClient:         kueueClient,
+		kueueNamespace:      testKueueNamespace,
+		spokeClusterConfigs: configs,
+		spokeClients:        newSpokeClientCache(),
+	}
+
+	kubeClient, tektonClient, err := r.cachedSpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+
+	// The clients are shared while the config of the spoke cluster is unchanged
+	cachedKubeClient, cachedTektonClient, err := r.cachedSpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, cachedKubeClient == kubeClient)
+	assert.Assert(t, cachedTektonClient == tektonClient)
+
+	// A proxy set by the SpokeClusterConfig creates them again
+	_, err = dynamicClient.Resource(spokeClusterConfigGVR).Create(ctx, testSpokeClusterConfig(testClusterName, map[string]any{"proxyURL": "http://proxy.example.com:3128"}), metav1.CreateOptions{})
+	assert.NilError(t, err)
+	now = now.Add(spokeClusterConfigTTL)
+	proxiedKubeClient, _, err := r.cachedSpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, proxiedKubeClient != kubeClient)
+
+	// So does a rotated kubeconfig
+	kubeconfigSecret.Data["kubeconfig"] = bytes.ReplaceAll(validKubeConfigData(), []byte("test-token"), []byte("rotated-token"))
+	_, err = hubKubeClient.CoreV1().Secrets(testKueueNamespace).Update(ctx, kubeconfigSecret, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	rotatedKubeClient, _, err := r.cachedSpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+	assert.Assert(t, rotatedKubeClient != proxiedKubeClient)
+
+	// The clients of a removed spoke cluster are dropped
+	assert.NilError(t, kueueClient.KueueV1beta1().MultiKueueClusters().Delete(ctx, testClusterName, metav1.DeleteOptions{}))
+	_, _, err = r.cachedSpokeClients(ctx, testClusterName)
+	assert.ErrorIs(t, err, ErrClusterNotFound)
+	assert.Equal(t, len(r.spokeClients.clients), 0)
+}
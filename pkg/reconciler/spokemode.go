@@ -0,0 +1,89 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Modes of materializing the credentials on spoke clusters, configured with SPOKE_SECRET_MODE.
+const (
+	spokeSecretModeCopy            = "copy"
+	spokeSecretModeExternalSecrets = "external-secrets"
+	spokeSecretModeSealedSecrets   = "sealed-secrets"
+	// spokeSecretModePull leaves the spoke secrets to the agents pulling them from the pull API
+	spokeSecretModePull = "pull"
+)
+
+// spokeSecretResource returns the resource the spoke secrets are generated from in the
+// configured spoke secret mode, false when the controller creates the secrets itself.
+func (r *Reconciler) spokeSecretResource() (schema.GroupVersionResource, bool) {
+	switch r.spokeSecretMode {
+	case spokeSecretModeExternalSecrets:
+		return r.externalSecrets.resource(), true
+	case spokeSecretModeSealedSecrets:
+		return sealedSecretsResource, true
+	default:
+		return schema.GroupVersionResource{}, false
+	}
+}
+
+// deleteSpokeSecretResource deletes the ExternalSecret or SealedSecret of a synced secret, so
+// its operator doesn't recreate the secret. It is a no-op in the copy mode.
+func (r *Reconciler) deleteSpokeSecretResource(ctx context.Context, ref syncedSecretRef) error {
+	resource, ok := r.spokeSecretResource()
+	if !ok {
+		return nil
+	}
+
+	spokeDynamicClient, err := r.spokeDynamicClient(ctx, ref.Cluster)
+	if err != nil {
+		return err
+	}
+
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	err = spokeDynamicClient.Resource(resource).Namespace(ref.Namespace).Delete(spokeCtx, ref.Name, metav1.DeleteOptions{})
+	// NotFound also covers spoke clusters without the operator, or secrets copied as a fallback
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("could not delete %s %s/%s on spoke cluster %s: %w", resource.Resource, ref.Namespace, ref.Name, ref.Cluster, spokeError(err))
+	}
+	return nil
+}
+
+// spokeDynamicClient creates a dynamic client for a spoke cluster.
+func (r *Reconciler) spokeDynamicClient(ctx context.Context, clusterName string) (dynamic.Interface, error) {
+	if r.newSpokeDynamicClient != nil {
+		return r.newSpokeDynamicClient(ctx, clusterName)
+	}
+
+	spokeClusterConfig, err := r.getSpokeClusterConfig(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(spokeClusterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client for spoke cluster %s: %w", clusterName, err)
+	}
+	return client, nil
+}
+
+// parseSpokeSecretMode validates the SPOKE_SECRET_MODE value, empty defaults to copy.
+func parseSpokeSecretMode(value string) (string, error) {
+	modes := []string{spokeSecretModeCopy, spokeSecretModeExternalSecrets, spokeSecretModeSealedSecrets, spokeSecretModePull}
+	switch value {
+	case "":
+		return spokeSecretModeCopy, nil
+	case spokeSecretModeCopy, spokeSecretModeExternalSecrets, spokeSecretModeSealedSecrets, spokeSecretModePull:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported spoke secret mode %q, must be one of %s", value, strings.Join(modes, ", "))
+	}
+}
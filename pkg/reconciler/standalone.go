@@ -0,0 +1,245 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/redact"
+)
+
+// Standalone runs the operations of the controller once, outside of it, for operators debugging
+// stuck dispatches with the secret-syncer CLI and for the controllers embedding the sync. It is
+// configured by the same environment variables and SecretSyncerConfig as the controller, and acts
+// as the leader of every Workload.
+type Standalone struct {
+	r *Reconciler
+	// reconciler is the generated Workload reconciler wrapping r
+	reconciler controller.Reconciler
+	// workloads backs the lister of the reconciler with live reads
+	workloads cache.Indexer
+	// namespaces are the namespaces of WATCH_NAMESPACES, every namespace when empty
+	namespaces []string
+	// listOptions selects the Workloads of WORKLOAD_LABEL_SELECTOR and WORKLOAD_FIELD_SELECTOR
+	listOptions func(*metav1.ListOptions)
+}
+
+// WorkloadStatus is the sync status of a PipelineRun owned Workload.
+type WorkloadStatus struct {
+	// Workload and PipelineRun are the namespace/name of the Workload and its owner PipelineRun.
+	Workload    string
+	PipelineRun string
+	// Cluster is the spoke cluster the Workload is dispatched to, empty until it is.
+	Cluster string
+	// SyncedSecrets are the cluster/namespace/name of the secrets synced for the Workload.
+	SyncedSecrets []string
+	// Finalizer reports whether the Workload has the cleanup finalizer.
+	Finalizer bool
+	// Deleting reports whether the Workload is being deleted.
+	Deleting bool
+}
+
+// NewStandalone returns a Standalone using the hub cluster of the config.
+func NewStandalone(ctx context.Context, logger *zap.SugaredLogger, cfg *rest.Config) (*Standalone, error) {
+	if _, err := ApplySecretSyncerConfig(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return newStandalone(ctx, logger, cfg)
+}
+
+// GCOnce reconciles the Workloads against the hub state once, then sweeps every active spoke
+// cluster for orphaned secrets, like the orphan sweeper of the controller does, for the gc-once
+// mode of the controller run by a CronJob. Unlike NewStandalone, it doesn't apply the
+// SecretSyncerConfig, which the controller applied already. It fails when a Workload couldn't be
+// reconciled or a spoke cluster couldn't be swept, after the others.
+func GCOnce(ctx context.Context, logger *zap.SugaredLogger, cfg *rest.Config) error {
+	s, err := newStandalone(ctx, logger, cfg)
+	if err != nil {
+		return err
+	}
+	synced, syncErr := s.syncWorkloads(ctx)
+	logger.Infof("Reconciled %d Workloads against the hub", synced)
+	if s.r.spokeSecretMode == spokeSecretModePull {
+		logger.Info("The pull mode doesn't connect to the spoke clusters, not sweeping them")
+		return syncErr
+	}
+	swept, err := s.r.sweepSpokeClusters(ctx)
+	logger.Infof("Swept %d spoke clusters for orphaned secrets", swept)
+	return stderrors.Join(syncErr, err)
+}
+
+// syncWorkloads reconciles the Workloads resynced after a configuration change once, the active
+// PipelineRun owned ones dispatched to a spoke cluster, and returns how many were. Their spoke
+// secrets are updated to the hub secrets, or deleted when they no longer apply. The Workloads
+// which couldn't be reconciled are reported together, after the others.
+func (s *Standalone) syncWorkloads(ctx context.Context) (int, error) {
+	namespaces := s.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	filter := configResyncFilter(s.r.queues)
+
+	synced := 0
+	var errs []error
+	for _, namespace := range namespaces {
+		options := metav1.ListOptions{}
+		if s.listOptions != nil {
+			s.listOptions(&options)
+		}
+		workloads, err := s.r.kueueClient.KueueV1beta1().Workloads(namespace).List(ctx, options)
+		if err != nil {
+			return synced, fmt.Errorf("could not list workloads: %w", err)
+		}
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			if !filter(workload) {
+				continue
+			}
+			if err := s.SyncWorkload(ctx, workload); err != nil {
+				s.r.logger.Errorf("error reconciling workload %s/%s: %v", workload.Namespace, workload.Name, err)
+				errs = append(errs, fmt.Errorf("could not reconcile workload %s/%s: %w", workload.Namespace, workload.Name, err))
+				continue
+			}
+			synced++
+		}
+	}
+	return synced, stderrors.Join(errs...)
+}
+
+// newStandalone returns a Standalone configured by the environment.
+func newStandalone(ctx context.Context, logger *zap.SugaredLogger, cfg *rest.Config) (*Standalone, error) {
+	opts, err := optionsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger = redact.Logger(logger)
+
+	cfg = rest.CopyConfig(cfg)
+	cfg.QPS = opts.hubClientQPS
+	cfg.Burst = opts.hubClientBurst
+	hubKubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Kubernetes client: %w", err)
+	}
+	hubDynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	kueueClient, err := kueueversioned.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Kueue client: %w", err)
+	}
+
+	workloads := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r := newReconciler(ctx, logger, opts, hubKubeClient, hubDynamicClient, kueueClient, kueuev1beta1lister.NewWorkloadLister(workloads))
+	// There is no feature flags ConfigMap to wait for, only FEATURE_GATES applies
+	r.features.warnDisabled()
+	rec := newWorkloadReconciler(ctx, r)
+	// There is no other replica to share the Workloads with
+	if err := rec.(reconciler.LeaderAware).Promote(reconciler.UniversalBucket(), nil); err != nil {
+		return nil, err
+	}
+	return &Standalone{
+		r:           r,
+		reconciler:  rec,
+		workloads:   workloads,
+		namespaces:  opts.watchNamespaces,
+		listOptions: workloadListOptions(opts.workloadLabelSelector, opts.workloadFieldSelector),
+	}, nil
+}
+
+// Sync reconciles the Workload once, syncing its secret to its spoke cluster.
+func (s *Standalone) Sync(ctx context.Context, namespace, name string) error {
+	workload, err := s.r.kueueClient.KueueV1beta1().Workloads(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get workload %s/%s: %w", namespace, name, err)
+	}
+	return s.SyncWorkload(ctx, workload)
+}
+
+// SyncWorkload reconciles the Workload once, as read by the caller, e.g. from its own informer,
+// syncing its secret to its spoke cluster with the code of the controller.
+func (s *Standalone) SyncWorkload(ctx context.Context, workload *kueuev1beta1.Workload) error {
+	if err := s.workloads.Add(workload); err != nil {
+		return err
+	}
+
+	err := s.reconciler.Reconcile(ctx, workload.Namespace+"/"+workload.Name)
+	// A requeue is how the controller schedules the next sync, the sync itself succeeded
+	if ok, delay := controller.IsRequeueKey(err); ok {
+		s.r.logger.Infof("workload %s/%s would be synced again in %s", workload.Namespace, workload.Name, delay)
+		return nil
+	}
+	return err
+}
+
+// Status returns the sync status of the PipelineRun owned Workloads of the namespace, all
+// namespaces when empty.
+func (s *Standalone) Status(ctx context.Context, namespace string) ([]WorkloadStatus, error) {
+	workloads, err := s.r.kueueClient.KueueV1beta1().Workloads(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list workloads: %w", err)
+	}
+
+	var statuses []WorkloadStatus
+	for i := range workloads.Items {
+		workload := &workloads.Items[i]
+		owner, err := s.r.pipelineRunOwner(ctx, workload)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil || owner.Kind != "PipelineRun" {
+			continue
+		}
+
+		status := WorkloadStatus{
+			Workload:    workload.Namespace + "/" + workload.Name,
+			PipelineRun: workload.Namespace + "/" + owner.Name,
+			Deleting:    workload.GetDeletionTimestamp() != nil,
+		}
+		if workload.Status.ClusterName != nil {
+			status.Cluster = *workload.Status.ClusterName
+		}
+		for _, ref := range syncedSecretRefs(workload) {
+			status.SyncedSecrets = append(status.SyncedSecrets, ref.String())
+		}
+		for _, finalizer := range workload.GetFinalizers() {
+			if finalizer == cleanupFinalizer {
+				status.Finalizer = true
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// GC deletes the orphaned secrets of the spoke cluster, like the orphan sweeper does.
+func (s *Standalone) GC(ctx context.Context, clusterName string) error {
+	spokeKubeClient, spokeTektonClient, err := s.r.getSpokeClients(ctx, clusterName)
+	if err != nil {
+		return fmt.Errorf("could not create spoke clients for cluster %s: %w", clusterName, err)
+	}
+	return s.r.sweepSpokeCluster(ctx, clusterName, spokeKubeClient, spokeTektonClient)
+}
+
+// CleanupCluster deletes every secret and ConfigMap the controller created on the spoke cluster,
+// before its MultiKueueCluster is deleted, and returns how many secrets were deleted.
+func (s *Standalone) CleanupCluster(ctx context.Context, clusterName string) (int, error) {
+	spokeKubeClient, _, err := s.r.getSpokeClients(ctx, clusterName)
+	if err != nil {
+		return 0, fmt.Errorf("could not create spoke clients for cluster %s: %w", clusterName, err)
+	}
+	return s.r.cleanupSpokeCluster(ctx, clusterName, spokeKubeClient)
+}
@@ -0,0 +1,145 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestStandaloneStatus(t *testing.T) {
+	isController := true
+	clusterName := testClusterName
+	kueueClient := kueuefake.NewSimpleClientset(
+		&kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "synced",
+				Namespace:       "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "synced-run", Controller: &isController}},
+				Finalizers:      []string{cleanupFinalizer},
+				Annotations:     map[string]string{syncedSecretsAnnotation: testClusterName + "/test-namespace/git-auth"},
+			},
+			Status: kueuev1beta1.WorkloadStatus{ClusterName: &clusterName},
+		},
+		&kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "pending",
+				Namespace:       "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "pending-run", Controller: &isController}},
+			},
+		},
+		&kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-a-pipelinerun", Namespace: "test-namespace"},
+		},
+	)
+	s := &Standalone{r: &Reconciler{logger: zap.NewNop().Sugar(), kueueClient: kueueClient}}
+
+	statuses, err := s.Status(context.Background(), "test-namespace")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []WorkloadStatus{
+		{Workload: "test-namespace/pending", PipelineRun: "test-namespace/pending-run"},
+		{
+			Workload:      "test-namespace/synced",
+			PipelineRun:   "test-namespace/synced-run",
+			Cluster:       testClusterName,
+			SyncedSecrets: []string{testClusterName + "/test-namespace/git-auth"},
+			Finalizer:     true,
+		},
+	}, statuses)
+}
+
+func TestStandaloneSyncMissingWorkload(t *testing.T) {
+	workloads := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	s := &Standalone{
+		r: &Reconciler{
+			logger:         zap.NewNop().Sugar(),
+			kueueClient:    kueuefake.NewSimpleClientset(),
+			workloadLister: kueuev1beta1lister.NewWorkloadLister(workloads),
+		},
+		workloads: workloads,
+	}
+
+	err := s.Sync(context.Background(), "test-namespace", "missing")
+	assert.ErrorContains(t, err, "could not get workload test-namespace/missing")
+}
+
+func TestStandaloneSyncWorkload(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		expectedErr string
+	}{
+		{name: "synced"},
+		{name: "synced again later", err: controller.NewRequeueAfter(time.Minute)},
+		{name: "failed", err: errTestCall, expectedErr: errTestCall.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workloads := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			s := &Standalone{
+				r:          &Reconciler{logger: zap.NewNop().Sugar()},
+				reconciler: reconcileResult{tt.err},
+				workloads:  workloads,
+			}
+
+			err := s.SyncWorkload(context.Background(), dispatchedWorkload(nil))
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			// The reconciler reads the Workload of the caller from its lister
+			_, exists, err := workloads.GetByKey("test-namespace/test-workload")
+			assert.NilError(t, err)
+			assert.Assert(t, exists)
+		})
+	}
+}
+
+func TestStandaloneSyncWorkloads(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedSynced int
+		expectedErr    string
+	}{
+		{name: "reconciled", expectedSynced: 1},
+		{name: "failed", err: errTestCall, expectedErr: "could not reconcile workload test-namespace/test-workload: " + errTestCall.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kueueClient := kueuefake.NewSimpleClientset(
+				dispatchedWorkload(nil),
+				dispatchedWorkload(func(workload *kueuev1beta1.Workload) { workload.Name = "pending"; workload.Status.ClusterName = nil }),
+				dispatchedWorkload(func(workload *kueuev1beta1.Workload) { workload.Namespace = "other-namespace" }),
+			)
+			workloads := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			s := &Standalone{
+				r:          &Reconciler{logger: zap.NewNop().Sugar(), kueueClient: kueueClient},
+				reconciler: reconcileResult{tt.err},
+				workloads:  workloads,
+				namespaces: []string{"test-namespace"},
+			}
+
+			synced, err := s.syncWorkloads(context.Background())
+			if tt.expectedErr != "" {
+				assert.Error(t, err, tt.expectedErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.Equal(t, tt.expectedSynced, synced)
+			// Only the dispatched Workload of the watched namespace is reconciled
+			assert.DeepEqual(t, []string{"test-namespace/test-workload"}, workloads.ListKeys())
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueapply "sigs.k8s.io/kueue/client-go/applyconfiguration/kueue/v1beta1"
+)
+
+// Where the sync state of a Workload is written back.
+const (
+	// workloadStatusCondition writes the secretsSyncedCondition into the Workload status.
+	workloadStatusCondition = "condition"
+	// workloadStatusAnnotation writes the secretsSynced annotations, for clusters where
+	// controllers other than Kueue must not write the Workload status.
+	workloadStatusAnnotation = "annotation"
+	// workloadStatusNone doesn't write the sync state back.
+	workloadStatusNone = "none"
+)
+
+const (
+	// secretsSyncedCondition is the Workload condition reflecting whether the secrets of its
+	// PipelineRun are synced to the spoke cluster.
+	secretsSyncedCondition = "SecretsSynced"
+
+	secretsSyncedReasonSynced     = "Synced"
+	secretsSyncedReasonSyncFailed = "SyncFailed"
+	// secretsSyncedReasonPending is the reason of the recorded status of a Workload not synced
+	// yet, whose conditions tell the phase it is in
+	secretsSyncedReasonPending = "Pending"
+
+	// secretsSyncedAnnotation and secretsSyncedMessageAnnotation hold the status and message of
+	// the secretsSyncedCondition in the annotation write-back mode.
+	secretsSyncedAnnotation        = syncerGroupName + "/secrets-synced"
+	secretsSyncedMessageAnnotation = syncerGroupName + "/secrets-synced-message"
+
+	// statusFieldManager owns the secretsSyncedCondition in the Workload status, next to the
+	// conditions owned by Kueue.
+	statusFieldManager = "secret-syncer"
+)
+
+// parseWorkloadStatusMode parses the write-back mode, an empty value resolves to workloadStatusCondition.
+func parseWorkloadStatusMode(value string) (string, error) {
+	switch value {
+	case "":
+		return workloadStatusCondition, nil
+	case workloadStatusCondition, workloadStatusAnnotation, workloadStatusNone:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported mode %q, must be one of %s, %s or %s", value, workloadStatusCondition, workloadStatusAnnotation, workloadStatusNone)
+	}
+}
+
+// reportSyncState writes the outcome of a reconcile back to the Workload, and records it in the
+// status store with the conditions of its phases: the secrets synced, or the error blocking them.
+// Requeues without a sync, e.g. a busy spoke cluster, only record the conditions. The write-back
+// is best effort, a failure is logged and never fails the reconcile.
+func (r *Reconciler) reportSyncState(ctx context.Context, workload *kueuev1beta1.Workload, synced []syncedSecretRef, conditions *syncConditions, err error) {
+	if r.workloadStatus == workloadStatusNone && r.statusStore == nil {
+		return
+	}
+
+	requeue, _ := controller.IsRequeueKey(err)
+	var (
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	)
+	switch {
+	case len(synced) > 0 && (err == nil || requeue):
+		names := make([]string, 0, len(synced))
+		for _, ref := range synced {
+			names = append(names, ref.Namespace+"/"+ref.Name)
+		}
+		status, reason = metav1.ConditionTrue, secretsSyncedReasonSynced
+		message = fmt.Sprintf("synced %s to spoke cluster %s", strings.Join(names, ", "), synced[0].Cluster)
+	case err != nil && !requeue:
+		status, reason, message = metav1.ConditionFalse, secretsSyncedReasonSyncFailed, err.Error()
+		// Rejected syncs carry the reason of their Warning event, e.g. SpokeMissingTekton
+		if rejection := rejectionReason(err); rejection != "" {
+			reason = rejection
+		}
+	default:
+		r.reportSyncConditions(ctx, workload, conditions)
+		return
+	}
+
+	var reportErr error
+	switch r.workloadStatus {
+	case workloadStatusNone:
+	case workloadStatusAnnotation:
+		reportErr = r.annotateSyncState(ctx, workload, status, message)
+	default:
+		reportErr = r.applySyncCondition(ctx, workload, status, reason, message)
+	}
+	if reportErr != nil {
+		r.logger.Errorf("error reporting the sync state of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), reportErr)
+	}
+
+	record := &syncStatus{
+		Cluster:            ptr.Deref(workload.Status.ClusterName, ""),
+		Synced:             status == metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: workload.GetGeneration(),
+	}
+	for _, ref := range synced {
+		record.Secrets = append(record.Secrets, syncedSecretStatus{Namespace: ref.Namespace, Name: ref.Name})
+	}
+	record.Conditions = conditions.list()
+	if err := r.recordSyncStatus(ctx, workload, record); err != nil {
+		r.logger.Errorf("error recording the sync status of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+	}
+}
+
+// reportSyncConditions records the conditions of a reconcile without a sync outcome, e.g. a
+// cleanup or a PipelineRun not on the spoke cluster yet, in the status store. The outcome of the
+// last sync is kept, a Workload never synced is recorded as pending. Failures are logged.
+func (r *Reconciler) reportSyncConditions(ctx context.Context, workload *kueuev1beta1.Workload, conditions *syncConditions) {
+	recorded := conditions.list()
+	if r.statusStore == nil || len(recorded) == 0 {
+		return
+	}
+	previous, err := r.statusStore.get(ctx, workload)
+	if err == nil {
+		record := &syncStatus{Cluster: ptr.Deref(workload.Status.ClusterName, ""), Reason: secretsSyncedReasonPending, ObservedGeneration: workload.GetGeneration()}
+		if previous != nil {
+			record = previous.DeepCopy()
+		}
+		record.Conditions = recorded
+		err = r.putSyncStatus(ctx, workload, previous, record)
+	}
+	if err != nil {
+		r.logger.Errorf("error recording the sync conditions of workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+	}
+}
+
+// applySyncCondition server-side applies the secretsSyncedCondition, so only this condition is
+// owned by the syncer and the ones of Kueue are left untouched. It is a no-op when unchanged.
+func (r *Reconciler) applySyncCondition(ctx context.Context, workload *kueuev1beta1.Workload, status metav1.ConditionStatus, reason, message string) error {
+	transition := metav1.Now()
+	if existing := meta.FindStatusCondition(workload.Status.Conditions, secretsSyncedCondition); existing != nil {
+		if existing.Status == status && existing.Reason == reason && existing.Message == message {
+			return nil
+		}
+		if existing.Status == status {
+			transition = existing.LastTransitionTime
+		}
+	}
+
+	apply := kueueapply.Workload(workload.GetName(), workload.GetNamespace()).
+		WithStatus(kueueapply.WorkloadStatus().WithConditions(metav1apply.Condition().
+			WithType(secretsSyncedCondition).
+			WithStatus(status).
+			WithReason(reason).
+			WithMessage(message).
+			WithObservedGeneration(workload.GetGeneration()).
+			WithLastTransitionTime(transition)))
+	if _, err := r.kueueClient.KueueV1beta1().Workloads(workload.GetNamespace()).ApplyStatus(ctx, apply, metav1.ApplyOptions{FieldManager: statusFieldManager, Force: true}); err != nil {
+		return fmt.Errorf("could not apply condition %s: %w", secretsSyncedCondition, err)
+	}
+	return nil
+}
+
+// annotateSyncState merge patches the secretsSynced annotations. It is a no-op when unchanged.
+func (r *Reconciler) annotateSyncState(ctx context.Context, workload *kueuev1beta1.Workload, status metav1.ConditionStatus, message string) error {
+	annotations := workload.GetAnnotations()
+	if annotations[secretsSyncedAnnotation] == string(status) && annotations[secretsSyncedMessageAnnotation] == message {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{
+		secretsSyncedAnnotation:        string(status),
+		secretsSyncedMessageAnnotation: message,
+	}}})
+	if err != nil {
+		return err
+	}
+	if _, err := r.kueueClient.KueueV1beta1().Workloads(workload.GetNamespace()).Patch(ctx, workload.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("could not annotate the sync state: %w", err)
+	}
+	return nil
+}
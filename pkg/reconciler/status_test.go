@@ -0,0 +1,205 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clienttesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+func TestParseWorkloadStatusMode(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":           workloadStatusCondition,
+		"condition":  workloadStatusCondition,
+		"annotation": workloadStatusAnnotation,
+		"none":       workloadStatusNone,
+	} {
+		mode, err := parseWorkloadStatusMode(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, expected, mode)
+	}
+
+	_, err := parseWorkloadStatusMode("status")
+	assert.ErrorContains(t, err, `unsupported mode "status"`)
+}
+
+func TestReportSyncState(t *testing.T) {
+	synced := []syncedSecretRef{
+		{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"},
+		{Cluster: testClusterName, Namespace: "test-namespace", Name: "gitlab-webhook-config"},
+	}
+	syncedMessage := "synced test-namespace/git-auth, test-namespace/gitlab-webhook-config to spoke cluster " + testClusterName
+	lastTransition := metav1.NewTime(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name              string
+		mode              string
+		conditions        []metav1.Condition
+		annotations       map[string]string
+		synced            []syncedSecretRef
+		err               error
+		expectedCondition *metav1.Condition
+		expectedAnnotated map[string]string
+		expectedWrite     bool
+	}{
+		{
+			name:              "synced",
+			mode:              workloadStatusCondition,
+			synced:            synced,
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionTrue, Reason: secretsSyncedReasonSynced, Message: syncedMessage},
+			expectedWrite:     true,
+		},
+		{
+			name:              "synced with a token resync",
+			mode:              workloadStatusCondition,
+			synced:            synced[:1],
+			err:               controller.NewRequeueAfter(time.Minute),
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionTrue, Reason: secretsSyncedReasonSynced, Message: "synced test-namespace/git-auth to spoke cluster " + testClusterName},
+			expectedWrite:     true,
+		},
+		{
+			name:              "failed",
+			mode:              workloadStatusCondition,
+			err:               errors.New("secret test-namespace/git-auth not found"),
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionFalse, Reason: secretsSyncedReasonSyncFailed, Message: "secret test-namespace/git-auth not found"},
+			expectedWrite:     true,
+		},
+		{
+			name:              "rejected",
+			mode:              workloadStatusCondition,
+			err:               controller.NewPermanentError(syncer.Classify(errors.New("spoke cluster spoke-1 doesn't serve the tekton.dev/v1 PipelineRuns"), ErrSpokeMissingTekton)),
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionFalse, Reason: spokeMissingTektonReason, Message: "spoke cluster spoke-1 doesn't serve the tekton.dev/v1 PipelineRuns"},
+			expectedWrite:     true,
+		},
+		{
+			name: "failed after being synced",
+			mode: workloadStatusCondition,
+			conditions: []metav1.Condition{
+				{Type: secretsSyncedCondition, Status: metav1.ConditionTrue, Reason: secretsSyncedReasonSynced, Message: syncedMessage, LastTransitionTime: lastTransition},
+			},
+			err:               errors.New("boom"),
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionFalse, Reason: secretsSyncedReasonSyncFailed, Message: "boom"},
+			expectedWrite:     true,
+		},
+		{
+			name: "failing differently keeps the transition time",
+			mode: workloadStatusCondition,
+			conditions: []metav1.Condition{
+				{Type: secretsSyncedCondition, Status: metav1.ConditionFalse, Reason: secretsSyncedReasonSyncFailed, Message: "boom", LastTransitionTime: lastTransition},
+			},
+			err:               errors.New("bang"),
+			expectedCondition: &metav1.Condition{Type: secretsSyncedCondition, Status: metav1.ConditionFalse, Reason: secretsSyncedReasonSyncFailed, Message: "bang", LastTransitionTime: lastTransition},
+			expectedWrite:     true,
+		},
+		{
+			name: "unchanged",
+			mode: workloadStatusCondition,
+			conditions: []metav1.Condition{
+				{Type: secretsSyncedCondition, Status: metav1.ConditionTrue, Reason: secretsSyncedReasonSynced, Message: syncedMessage, LastTransitionTime: lastTransition},
+			},
+			synced: synced,
+		},
+		{
+			name: "requeued without a sync",
+			mode: workloadStatusCondition,
+			err:  controller.NewRequeueAfter(time.Second),
+		},
+		{
+			name: "nothing to sync",
+			mode: workloadStatusCondition,
+		},
+		{
+			name:              "synced with the annotation mode",
+			mode:              workloadStatusAnnotation,
+			synced:            synced,
+			expectedAnnotated: map[string]string{secretsSyncedAnnotation: "True", secretsSyncedMessageAnnotation: syncedMessage},
+			expectedWrite:     true,
+		},
+		{
+			name:              "failed with the annotation mode",
+			mode:              workloadStatusAnnotation,
+			annotations:       map[string]string{secretsSyncedAnnotation: "True", secretsSyncedMessageAnnotation: syncedMessage},
+			err:               errors.New("boom"),
+			expectedAnnotated: map[string]string{secretsSyncedAnnotation: "False", secretsSyncedMessageAnnotation: "boom"},
+			expectedWrite:     true,
+		},
+		{
+			name:        "unchanged with the annotation mode",
+			mode:        workloadStatusAnnotation,
+			annotations: map[string]string{secretsSyncedAnnotation: "True", secretsSyncedMessageAnnotation: syncedMessage},
+			synced:      synced,
+		},
+		{
+			name:   "disabled",
+			mode:   workloadStatusNone,
+			synced: synced,
+			err:    errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			workload := &kueuev1beta1.Workload{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace", Generation: 3, Annotations: tt.annotations},
+				Status:     kueuev1beta1.WorkloadStatus{Conditions: tt.conditions},
+			}
+			kueueClient := kueuefake.NewSimpleClientset(workload)
+			r := &Reconciler{
+				logger:         zap.NewNop().Sugar(),
+				kueueClient:    kueueClient,
+				workloadStatus: tt.mode,
+			}
+
+			r.reportSyncState(ctx, workload, tt.synced, nil, tt.err)
+
+			// The fake clientset can't apply, the written patches are checked instead
+			var patches []clienttesting.PatchAction
+			for _, action := range kueueClient.Actions() {
+				if patch, ok := action.(clienttesting.PatchAction); ok {
+					patches = append(patches, patch)
+				}
+			}
+			if !tt.expectedWrite {
+				assert.Equal(t, 0, len(patches))
+				return
+			}
+			assert.Equal(t, 1, len(patches))
+
+			got := &kueuev1beta1.Workload{}
+			assert.NilError(t, json.Unmarshal(patches[0].GetPatch(), got))
+			if tt.expectedAnnotated != nil {
+				assert.Equal(t, types.MergePatchType, patches[0].GetPatchType())
+				assert.DeepEqual(t, tt.expectedAnnotated, got.Annotations)
+				return
+			}
+
+			assert.Equal(t, types.ApplyPatchType, patches[0].GetPatchType())
+			assert.Equal(t, "status", patches[0].GetSubresource())
+			assert.Equal(t, 1, len(got.Status.Conditions), "only the syncer condition is applied")
+			condition := got.Status.Conditions[0]
+			assert.Equal(t, secretsSyncedCondition, condition.Type)
+			assert.Equal(t, int64(3), condition.ObservedGeneration)
+			if tt.expectedCondition.LastTransitionTime.IsZero() {
+				assert.Assert(t, !condition.LastTransitionTime.Equal(&lastTransition))
+			} else {
+				assert.Assert(t, condition.LastTransitionTime.Equal(&tt.expectedCondition.LastTransitionTime))
+			}
+			assert.Equal(t, tt.expectedCondition.Status, condition.Status)
+			assert.Equal(t, tt.expectedCondition.Reason, condition.Reason)
+			assert.Equal(t, tt.expectedCondition.Message, condition.Message)
+		})
+	}
+}
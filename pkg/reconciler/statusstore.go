@@ -0,0 +1,300 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
+)
+
+// Backends of the status store, where the structured sync status of the Workloads is persisted.
+const (
+	// statusStoreCRD records it in a SecretSyncStatus named after the Workload, owned by it.
+	statusStoreCRD = "crd"
+	// statusStoreAnnotation records it as JSON in the syncStatusAnnotation of the Workload, for
+	// clusters where no extra CRD can be installed.
+	statusStoreAnnotation = "annotation"
+	// statusStoreMemory keeps it in the controller, lost on restarts and on leader changes.
+	statusStoreMemory = "memory"
+	// statusStoreNone doesn't record it.
+	statusStoreNone = "none"
+)
+
+// syncStatusAnnotation holds the syncStatus of a Workload with the annotation status store.
+const syncStatusAnnotation = syncerGroupName + "/sync-status"
+
+// syncStatusGVR is the SecretSyncStatus CR of the crd status store, config/crd-secretsyncstatus.yaml.
+var syncStatusGVR = schema.GroupVersionResource{Group: syncerGroupName, Version: "v1alpha1", Resource: "secretsyncstatuses"}
+
+// syncStatus is the structured outcome of the last reported sync of a Workload.
+type syncStatus struct {
+	// Cluster is the spoke cluster the Workload was dispatched to.
+	Cluster string `json:"cluster,omitempty"`
+	// Synced is true once the secrets are on the spoke cluster, false when their sync failed.
+	Synced bool `json:"synced"`
+	// Reason is the reason of the secretsSyncedCondition.
+	Reason string `json:"reason"`
+	// Message lists the synced secrets, or holds the error blocking them.
+	Message string `json:"message,omitempty"`
+	// Secrets are the spoke secrets synced for the Workload.
+	Secrets []syncedSecretStatus `json:"secrets,omitempty"`
+	// ObservedGeneration is the generation of the Workload the status was reported for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is when Synced last changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Conditions are the outcomes of the phases of the last syncs, see syncconditions.go.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// syncedSecretStatus is a secret synced to the spoke cluster of the Workload.
+type syncedSecretStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// statusStore persists the syncStatus of the Workloads.
+type statusStore interface {
+	// get returns the status of the Workload, nil when none was recorded.
+	get(ctx context.Context, workload *kueuev1beta1.Workload) (*syncStatus, error)
+	// put records the status of the Workload.
+	put(ctx context.Context, workload *kueuev1beta1.Workload, status *syncStatus) error
+	// remove drops the status of the Workload.
+	remove(ctx context.Context, workload *kueuev1beta1.Workload) error
+}
+
+// parseStatusStore validates the SYNC_STATUS_STORE value, empty defaults to none.
+func parseStatusStore(value string) (string, error) {
+	switch value {
+	case "":
+		return statusStoreNone, nil
+	case statusStoreCRD, statusStoreAnnotation, statusStoreMemory, statusStoreNone:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported status store %q, must be one of %s, %s, %s or %s", value, statusStoreCRD, statusStoreAnnotation, statusStoreMemory, statusStoreNone)
+	}
+}
+
+// newStatusStore returns the status store of the backend, nil for none.
+func newStatusStore(backend string, kueueClient kueueversioned.Interface, hubDynamicClient dynamic.Interface) statusStore {
+	switch backend {
+	case statusStoreCRD:
+		return &crdStatusStore{client: hubDynamicClient}
+	case statusStoreAnnotation:
+		return &annotationStatusStore{client: kueueClient}
+	case statusStoreMemory:
+		return newMemoryStatusStore()
+	default:
+		return nil
+	}
+}
+
+// recordSyncStatus records the status in the status store, keeping the transition time of the
+// previous status when Synced didn't change. It is a no-op without a status store or when the
+// status is unchanged.
+func (r *Reconciler) recordSyncStatus(ctx context.Context, workload *kueuev1beta1.Workload, status *syncStatus) error {
+	if r.statusStore == nil {
+		return nil
+	}
+	previous, err := r.statusStore.get(ctx, workload)
+	if err != nil {
+		return err
+	}
+	status.LastTransitionTime = metav1.Now()
+	if previous != nil && previous.Synced == status.Synced {
+		status.LastTransitionTime = previous.LastTransitionTime
+	}
+	return r.putSyncStatus(ctx, workload, previous, status)
+}
+
+// putSyncStatus records the status, its conditions merged into the ones of the previous status.
+// It is a no-op when the status is unchanged.
+func (r *Reconciler) putSyncStatus(ctx context.Context, workload *kueuev1beta1.Workload, previous, status *syncStatus) error {
+	var conditions []metav1.Condition
+	if previous != nil {
+		conditions = previous.Conditions
+	}
+	status.Conditions = mergeConditions(conditions, status.Conditions, workload.GetGeneration())
+	if previous != nil && equality.Semantic.DeepEqual(previous, status) {
+		return nil
+	}
+	return r.statusStore.put(ctx, workload, status)
+}
+
+// removeSyncStatus drops the status of a deleted Workload from the status store.
+func (r *Reconciler) removeSyncStatus(ctx context.Context, workload *kueuev1beta1.Workload) error {
+	if r.statusStore == nil {
+		return nil
+	}
+	return r.statusStore.remove(ctx, workload)
+}
+
+// memoryStatusStore keeps the statuses in a map, by Workload.
+type memoryStatusStore struct {
+	mu       sync.Mutex
+	statuses map[types.NamespacedName]*syncStatus
+}
+
+func newMemoryStatusStore() *memoryStatusStore {
+	return &memoryStatusStore{statuses: map[types.NamespacedName]*syncStatus{}}
+}
+
+func (s *memoryStatusStore) get(_ context.Context, workload *kueuev1beta1.Workload) (*syncStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, ok := s.statuses[workloadKey(workload)]
+	if !ok {
+		return nil, nil
+	}
+	return status.DeepCopy(), nil
+}
+
+func (s *memoryStatusStore) put(_ context.Context, workload *kueuev1beta1.Workload, status *syncStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[workloadKey(workload)] = status.DeepCopy()
+	return nil
+}
+
+func (s *memoryStatusStore) remove(_ context.Context, workload *kueuev1beta1.Workload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.statuses, workloadKey(workload))
+	return nil
+}
+
+// annotationStatusStore records the statuses in the syncStatusAnnotation of the Workloads.
+type annotationStatusStore struct {
+	client kueueversioned.Interface
+}
+
+func (s *annotationStatusStore) get(_ context.Context, workload *kueuev1beta1.Workload) (*syncStatus, error) {
+	value, ok := workload.GetAnnotations()[syncStatusAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	status := &syncStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		// Overwritten by the next put
+		return nil, nil
+	}
+	return status, nil
+}
+
+// put merge patches the syncStatusAnnotation.
+func (s *annotationStatusStore) put(ctx context.Context, workload *kueuev1beta1.Workload, status *syncStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{syncStatusAnnotation: string(value)}}})
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.KueueV1beta1().Workloads(workload.GetNamespace()).Patch(ctx, workload.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("could not annotate the sync status: %w", err)
+	}
+	return nil
+}
+
+// remove is a no-op, the annotation goes away with the Workload.
+func (s *annotationStatusStore) remove(context.Context, *kueuev1beta1.Workload) error {
+	return nil
+}
+
+// crdStatusStore records the statuses in SecretSyncStatuses named after their Workload. They are
+// owned by the Workload, so they are garbage collected with it.
+type crdStatusStore struct {
+	client dynamic.Interface
+}
+
+func (s *crdStatusStore) get(ctx context.Context, workload *kueuev1beta1.Workload) (*syncStatus, error) {
+	obj, err := s.client.Resource(syncStatusGVR).Namespace(workload.GetNamespace()).Get(ctx, workload.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get SecretSyncStatus %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+	}
+	return syncStatusFromUnstructured(obj)
+}
+
+func (s *crdStatusStore) put(ctx context.Context, workload *kueuev1beta1.Workload, status *syncStatus) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+	resource := s.client.Resource(syncStatusGVR).Namespace(workload.GetNamespace())
+
+	existing, err := resource.Get(ctx, workload.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		obj := &unstructured.Unstructured{Object: map[string]any{"status": content}}
+		obj.SetAPIVersion(syncStatusGVR.GroupVersion().String())
+		obj.SetKind("SecretSyncStatus")
+		obj.SetName(workload.GetName())
+		obj.SetNamespace(workload.GetNamespace())
+		obj.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: kueuev1beta1.GroupVersion.String(),
+			Kind:       "Workload",
+			Name:       workload.GetName(),
+			UID:        workload.GetUID(),
+		}})
+		if _, err := resource.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create SecretSyncStatus %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get SecretSyncStatus %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+	}
+
+	existing = existing.DeepCopy()
+	existing.Object["status"] = content
+	if _, err := resource.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not update SecretSyncStatus %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+	}
+	return nil
+}
+
+func (s *crdStatusStore) remove(ctx context.Context, workload *kueuev1beta1.Workload) error {
+	err := s.client.Resource(syncStatusGVR).Namespace(workload.GetNamespace()).Delete(ctx, workload.GetName(), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("could not delete SecretSyncStatus %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+	}
+	return nil
+}
+
+// syncStatusFromUnstructured converts the status of a SecretSyncStatus.
+func syncStatusFromUnstructured(obj *unstructured.Unstructured) (*syncStatus, error) {
+	content, ok, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil || !ok {
+		return nil, err
+	}
+	status := &syncStatus{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, status); err != nil {
+		return nil, fmt.Errorf("invalid SecretSyncStatus %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return status, nil
+}
+
+// DeepCopy returns a copy of the status.
+func (s *syncStatus) DeepCopy() *syncStatus {
+	out := *s
+	out.Secrets = append([]syncedSecretStatus(nil), s.Secrets...)
+	out.Conditions = append([]metav1.Condition(nil), s.Conditions...)
+	return &out
+}
+
+func workloadKey(workload *kueuev1beta1.Workload) types.NamespacedName {
+	return types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()}
+}
@@ -0,0 +1,197 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestParseStatusStore(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":           statusStoreNone,
+		"crd":        statusStoreCRD,
+		"annotation": statusStoreAnnotation,
+		"memory":     statusStoreMemory,
+		"none":       statusStoreNone,
+	} {
+		backend, err := parseStatusStore(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, expected, backend)
+	}
+
+	_, err := parseStatusStore("configmap")
+	assert.Error(t, err, `unsupported status store "configmap", must be one of crd, annotation, memory or none`)
+}
+
+func TestStatusStores(t *testing.T) {
+	for _, backend := range []string{statusStoreCRD, statusStoreAnnotation, statusStoreMemory} {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			workload := &kueuev1beta1.Workload{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace", UID: "workload-uid", Generation: 2},
+				Status:     kueuev1beta1.WorkloadStatus{ClusterName: ptr.To(testClusterName)},
+			}
+			kueueClient := kueuefake.NewSimpleClientset(workload)
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{syncStatusGVR: "SecretSyncStatusList"})
+			r := &Reconciler{logger: zap.NewNop().Sugar(), statusStore: newStatusStore(backend, kueueClient, dynamicClient)}
+			// The annotation store reads the status from the Workload, as cached by the informer
+			current := func() *kueuev1beta1.Workload {
+				current, err := kueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+				assert.NilError(t, err)
+				return current
+			}
+			writes := func() int {
+				var writes int
+				for _, action := range append(kueueClient.Actions(), dynamicClient.Actions()...) {
+					if action.GetVerb() != "get" {
+						writes++
+					}
+				}
+				return writes
+			}
+
+			status, err := r.statusStore.get(ctx, workload)
+			assert.NilError(t, err)
+			assert.Assert(t, status == nil)
+
+			synced := metav1.NewTime(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC))
+			assert.NilError(t, r.statusStore.put(ctx, current(), &syncStatus{
+				Cluster:            testClusterName,
+				Synced:             true,
+				Reason:             secretsSyncedReasonSynced,
+				Message:            "synced test-namespace/git-auth to spoke cluster " + testClusterName,
+				Secrets:            []syncedSecretStatus{{Namespace: "test-namespace", Name: "git-auth"}},
+				ObservedGeneration: 2,
+				LastTransitionTime: synced,
+			}))
+			status, err = r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Assert(t, status != nil)
+			assert.Equal(t, true, status.Synced)
+			assert.DeepEqual(t, []syncedSecretStatus{{Namespace: "test-namespace", Name: "git-auth"}}, status.Secrets)
+			assert.Assert(t, synced.Equal(&status.LastTransitionTime))
+
+			// Unchanged statuses aren't written again, the transition time stays the same while
+			// Synced doesn't change
+			before := writes()
+			unchanged := status.DeepCopy()
+			unchanged.LastTransitionTime = metav1.Time{}
+			assert.NilError(t, r.recordSyncStatus(ctx, current(), unchanged))
+			assert.Equal(t, before, writes())
+
+			assert.NilError(t, r.recordSyncStatus(ctx, current(), &syncStatus{
+				Cluster:            testClusterName,
+				Synced:             true,
+				Reason:             secretsSyncedReasonSynced,
+				Message:            "synced test-namespace/git-auth, test-namespace/webhook to spoke cluster " + testClusterName,
+				Secrets:            []syncedSecretStatus{{Namespace: "test-namespace", Name: "git-auth"}, {Namespace: "test-namespace", Name: "webhook"}},
+				ObservedGeneration: 2,
+			}))
+			status, err = r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Equal(t, 2, len(status.Secrets))
+			assert.Assert(t, synced.Equal(&status.LastTransitionTime))
+
+			assert.NilError(t, r.recordSyncStatus(ctx, current(), &syncStatus{
+				Cluster: testClusterName,
+				Reason:  secretsSyncedReasonSyncFailed,
+				Message: "secret test-namespace/git-auth not found",
+			}))
+			status, err = r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Equal(t, false, status.Synced)
+			assert.Equal(t, "secret test-namespace/git-auth not found", status.Message)
+			assert.Assert(t, status.LastTransitionTime.After(synced.Time))
+
+			assert.NilError(t, r.removeSyncStatus(ctx, current()))
+			if backend != statusStoreAnnotation {
+				status, err = r.statusStore.get(ctx, current())
+				assert.NilError(t, err)
+				assert.Assert(t, status == nil)
+			}
+		})
+	}
+}
+
+func TestCRDStatusStoreOwnedByWorkload(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace", UID: "workload-uid"}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{syncStatusGVR: "SecretSyncStatusList"})
+	store := &crdStatusStore{client: dynamicClient}
+
+	assert.NilError(t, store.put(ctx, workload, &syncStatus{Synced: true, Reason: secretsSyncedReasonSynced}))
+	obj, err := dynamicClient.Resource(syncStatusGVR).Namespace("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "SecretSyncStatus", obj.GetKind())
+	assert.DeepEqual(t, []metav1.OwnerReference{{APIVersion: "kueue.x-k8s.io/v1beta1", Kind: "Workload", Name: "test-workload", UID: "workload-uid"}}, obj.GetOwnerReferences())
+}
+
+func TestSyncStatusConditions(t *testing.T) {
+	for _, backend := range []string{statusStoreCRD, statusStoreAnnotation, statusStoreMemory} {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			workload := &kueuev1beta1.Workload{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace", UID: "workload-uid", Generation: 3},
+				Status:     kueuev1beta1.WorkloadStatus{ClusterName: ptr.To(testClusterName)},
+			}
+			kueueClient := kueuefake.NewSimpleClientset(workload)
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{syncStatusGVR: "SecretSyncStatusList"})
+			r := &Reconciler{logger: zap.NewNop().Sugar(), workloadStatus: workloadStatusNone, statusStore: newStatusStore(backend, kueueClient, dynamicClient)}
+			current := func() *kueuev1beta1.Workload {
+				current, err := kueueClient.KueueV1beta1().Workloads("test-namespace").Get(ctx, "test-workload", metav1.GetOptions{})
+				assert.NilError(t, err)
+				return current
+			}
+
+			// A PipelineRun not on the spoke cluster yet records a pending status
+			conditions := &syncConditions{}
+			conditions.set(conditionClusterResolved, true, clusterResolvedReason, "resolved")
+			conditions.set(conditionPLRFound, false, plrNotFoundReason, "not found")
+			r.reportSyncConditions(ctx, current(), conditions)
+			status, err := r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Assert(t, status != nil)
+			assert.Equal(t, secretsSyncedReasonPending, status.Reason)
+			assert.Equal(t, false, status.Synced)
+			found := meta.FindStatusCondition(status.Conditions, conditionPLRFound)
+			assert.Assert(t, found != nil)
+			assert.Equal(t, metav1.ConditionFalse, found.Status)
+			assert.Equal(t, plrNotFoundReason, found.Reason)
+			assert.Equal(t, int64(3), found.ObservedGeneration)
+
+			// The sync merges its conditions into the recorded ones
+			conditions = &syncConditions{}
+			conditions.set(conditionPLRFound, true, plrFoundReason, "found")
+			conditions.set(conditionSecretApplied, true, secretAppliedReason, "applied")
+			r.reportSyncState(ctx, current(), []syncedSecretRef{{Cluster: testClusterName, Namespace: "test-namespace", Name: "git-auth"}}, conditions, nil)
+			status, err = r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Equal(t, true, status.Synced)
+			assert.Assert(t, meta.IsStatusConditionTrue(status.Conditions, conditionClusterResolved))
+			assert.Assert(t, meta.IsStatusConditionTrue(status.Conditions, conditionPLRFound))
+			assert.Assert(t, meta.IsStatusConditionTrue(status.Conditions, conditionSecretApplied))
+
+			// The cleanup keeps the outcome of the sync
+			conditions = &syncConditions{}
+			conditions.cleanedUp(pipelineRunDoneReason, "done", nil)
+			r.reportSyncConditions(ctx, current(), conditions)
+			status, err = r.statusStore.get(ctx, current())
+			assert.NilError(t, err)
+			assert.Equal(t, true, status.Synced)
+			assert.Equal(t, secretsSyncedReasonSynced, status.Reason)
+			assert.Equal(t, 4, len(status.Conditions))
+			assert.Equal(t, pipelineRunDoneReason, meta.FindStatusCondition(status.Conditions, conditionCleanedUp).Reason)
+		})
+	}
+}
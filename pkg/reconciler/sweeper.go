@@ -0,0 +1,216 @@
+package reconciler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tektonversioned2 "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// defaultOrphanSweepInterval is how often spoke clusters are swept for orphaned secrets.
+const defaultOrphanSweepInterval = 10 * time.Minute
+
+// managedSecretsSelector selects the secrets and ConfigMaps created on spoke clusters by this
+// controller.
+var managedSecretsSelector = labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue}).String()
+
+// runOrphanSweeper periodically sweeps all active spoke clusters until the context is done.
+func (r *Reconciler) runOrphanSweeper(ctx context.Context, interval time.Duration) {
+	wait.JitterUntilWithContext(ctx, r.sweepOrphanedSecrets, interval, 0.1, true)
+}
+
+// sweepOrphanedSecrets deletes, on every active spoke cluster, the managed secrets and ConfigMaps
+// whose Workload or PipelineRun no longer exists. This catches secrets leaked while the controller was down.
+func (r *Reconciler) sweepOrphanedSecrets(ctx context.Context) {
+	_, _ = r.sweepSpokeClusters(ctx)
+}
+
+// sweepSpokeClusters sweeps every active spoke cluster for orphaned secrets, and returns how many
+// were swept and the errors of the ones which couldn't be, which are logged too.
+func (r *Reconciler) sweepSpokeClusters(ctx context.Context) (int, error) {
+	clusters, err := r.kueueClient.KueueV1beta1().MultiKueueClusters().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.logger.Errorf("error listing MultiKueueClusters for orphan sweep: %v", err)
+		return 0, fmt.Errorf("could not list MultiKueueClusters: %w", err)
+	}
+
+	swept := 0
+	var errs []error
+	for _, cluster := range clusters.Items {
+		if !meta.IsStatusConditionTrue(cluster.Status.Conditions, kueuev1beta1.MultiKueueClusterActive) {
+			r.logger.Debugf("MultiKueueCluster %s is not active, skipping orphan sweep", cluster.Name)
+			continue
+		}
+
+		spokeKubeClient, spokeTektonClient, err := r.getSpokeClients(ctx, cluster.Name)
+		if err != nil {
+			r.logger.Errorf("error creating spoke clients for cluster %s: %v", cluster.Name, err)
+			errs = append(errs, fmt.Errorf("could not create spoke clients for cluster %s: %w", cluster.Name, err))
+			continue
+		}
+
+		if err := r.sweepSpokeCluster(ctx, cluster.Name, spokeKubeClient, spokeTektonClient); err != nil {
+			r.logger.Errorf("error sweeping spoke cluster %s: %v", cluster.Name, err)
+			errs = append(errs, fmt.Errorf("could not sweep spoke cluster %s: %w", cluster.Name, err))
+			continue
+		}
+		swept++
+	}
+	return swept, stderrors.Join(errs...)
+}
+
+// sweepSpokeCluster deletes the orphaned managed secrets and ConfigMaps of a single spoke cluster.
+// The objects which couldn't be checked or deleted are reported together, after the others.
+func (r *Reconciler) sweepSpokeCluster(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface, spokeTektonClient tektonversioned2.Interface) error {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	secrets, err := spokeKubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(spokeCtx, metav1.ListOptions{LabelSelector: managedSecretsSelector})
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		orphaned, err := r.isOrphaned(ctx, clusterName, spokeTektonClient, secret)
+		if err != nil {
+			r.logger.Errorf("error checking whether secret %s/%s on spoke cluster %s is orphaned: %v", secret.Namespace, secret.Name, clusterName, err)
+			errs = append(errs, fmt.Errorf("could not check secret %s/%s: %w", secret.Namespace, secret.Name, err))
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+
+		r.logger.Infof("secret %s/%s on spoke cluster %s is orphaned, deleting it", secret.Namespace, secret.Name, clusterName)
+		ref := syncedSecretRef{Cluster: clusterName, Namespace: secret.Namespace, Name: secret.Name}
+		if err := r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, secret.Annotations[workloadAnnotation], "orphaned secret swept"); err != nil {
+			errs = append(errs, fmt.Errorf("could not delete secret %s/%s: %w", secret.Namespace, secret.Name, err))
+		}
+	}
+
+	spokeCtx, cancel = r.spokeContext(ctx)
+	configMaps, err := spokeKubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(spokeCtx, metav1.ListOptions{LabelSelector: managedSecretsSelector})
+	cancel()
+	if err != nil {
+		return stderrors.Join(append(errs, err)...)
+	}
+
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		orphaned, err := r.isOrphaned(ctx, clusterName, spokeTektonClient, configMap)
+		if err != nil {
+			r.logger.Errorf("error checking whether ConfigMap %s/%s on spoke cluster %s is orphaned: %v", configMap.Namespace, configMap.Name, clusterName, err)
+			errs = append(errs, fmt.Errorf("could not check ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err))
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+
+		r.logger.Infof("ConfigMap %s/%s on spoke cluster %s is orphaned, deleting it", configMap.Namespace, configMap.Name, clusterName)
+		ref := syncedSecretRef{Cluster: clusterName, Namespace: configMap.Namespace, Name: configMap.Name}
+		if err := r.deleteConfigMapOnSpokeCluster(ctx, spokeKubeClient, ref, configMap.Annotations[workloadAnnotation]); err != nil {
+			errs = append(errs, fmt.Errorf("could not delete ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// isOrphaned reports whether the hub Workload or the spoke PipelineRun a managed secret or
+// ConfigMap was created for is gone. Objects without tracking annotations are never considered
+// orphaned.
+func (r *Reconciler) isOrphaned(ctx context.Context, clusterName string, spokeTektonClient tektonversioned2.Interface, obj metav1.Object) (bool, error) {
+	workloadNamespace, workloadName, ok := splitNamespacedName(obj.GetAnnotations()[workloadAnnotation])
+	if !ok {
+		return false, nil
+	}
+
+	// Only the leader for the Workload key decides, so replicas don't race on the same secrets
+	if !r.isLeaderFor(types.NamespacedName{Namespace: workloadNamespace, Name: workloadName}) {
+		return false, nil
+	}
+
+	// Always confirm with a live read, a stale or unsynced cache must never cause a deletion
+	_, err := r.kueueClient.KueueV1beta1().Workloads(workloadNamespace).Get(ctx, workloadName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	plrNamespace, plrName, ok := splitNamespacedName(obj.GetAnnotations()[pipelineRunAnnotation])
+	if !ok {
+		return false, nil
+	}
+
+	spokeCtx, cancel := r.spokeContext(ctx)
+	defer cancel()
+
+	pipelineRun, err := r.getSpokePipelineRun(spokeCtx, clusterName, spokeTektonClient, plrNamespace, plrName)
+	if err != nil {
+		return false, err
+	}
+	return pipelineRun == nil, nil
+}
+
+// splitNamespacedName splits a namespace/name string.
+func splitNamespacedName(value string) (string, string, bool) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", "", false
+	}
+	return namespace, name, true
+}
+
+// cleanupSpokeCluster deletes every managed secret and ConfigMap of a spoke cluster being
+// decommissioned, whether or not its Workload is still running, and returns how many secrets
+// were deleted. The objects which couldn't be deleted are reported together.
+func (r *Reconciler) cleanupSpokeCluster(ctx context.Context, clusterName string, spokeKubeClient kubernetes.Interface) (int, error) {
+	spokeCtx, cancel := r.spokeContext(ctx)
+	secrets, err := spokeKubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(spokeCtx, metav1.ListOptions{LabelSelector: managedSecretsSelector})
+	cancel()
+	if err != nil {
+		return 0, spokeError(err)
+	}
+
+	deleted := 0
+	var errs []error
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		ref := syncedSecretRef{Cluster: clusterName, Namespace: secret.Namespace, Name: secret.Name}
+		if err := r.deleteSecretOnSpokeCluster(ctx, spokeKubeClient, ref, secret.Annotations[workloadAnnotation], "spoke cluster decommissioned"); err != nil {
+			errs = append(errs, fmt.Errorf("could not delete secret %s/%s: %w", secret.Namespace, secret.Name, err))
+			continue
+		}
+		deleted++
+	}
+
+	spokeCtx, cancel = r.spokeContext(ctx)
+	configMaps, err := spokeKubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(spokeCtx, metav1.ListOptions{LabelSelector: managedSecretsSelector})
+	cancel()
+	if err != nil {
+		return deleted, stderrors.Join(append(errs, spokeError(err))...)
+	}
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		ref := syncedSecretRef{Cluster: clusterName, Namespace: configMap.Namespace, Name: configMap.Name}
+		if err := r.deleteConfigMapOnSpokeCluster(ctx, spokeKubeClient, ref, ""); err != nil {
+			errs = append(errs, fmt.Errorf("could not delete ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err))
+		}
+	}
+	return deleted, stderrors.Join(errs...)
+}
@@ -0,0 +1,181 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/reconciler"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func managedSecret(name string, annotations map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestSweepSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Namespace: "test-namespace"},
+	}
+	pipelineRun := &v1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: "test-namespace"},
+	}
+
+	spokeSecrets := []runtime.Object{
+		managedSecret("in-use", map[string]string{
+			workloadAnnotation:    "test-namespace/test-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}),
+		managedSecret("workload-gone", map[string]string{
+			workloadAnnotation:    "test-namespace/deleted-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}),
+		managedSecret("pipelinerun-gone", map[string]string{
+			workloadAnnotation:    "test-namespace/test-workload",
+			pipelineRunAnnotation: "test-namespace/deleted-pipeline-run",
+		}),
+		managedSecret("untracked", nil),
+		&corev1.ConfigMap{ObjectMeta: managedSecret("configmap-in-use", map[string]string{
+			workloadAnnotation:    "test-namespace/test-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}).ObjectMeta},
+		&corev1.ConfigMap{ObjectMeta: managedSecret("configmap-workload-gone", map[string]string{
+			workloadAnnotation:    "test-namespace/deleted-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}).ObjectMeta},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "not-managed",
+				Namespace: "test-namespace",
+				Annotations: map[string]string{
+					workloadAnnotation: "test-namespace/deleted-workload",
+				},
+			},
+		},
+	}
+
+	spokeKubeClient := fake.NewSimpleClientset(spokeSecrets...)
+	r := &Reconciler{
+		logger:      zap.NewNop().Sugar(),
+		kueueClient: kueuefake.NewSimpleClientset(workload),
+	}
+	r.leader = leaderFor(t, reconciler.UniversalBucket())
+
+	assert.NilError(t, r.sweepSpokeCluster(ctx, testClusterName, spokeKubeClient, tektonfake.NewSimpleClientset(pipelineRun)))
+
+	remaining, err := spokeKubeClient.CoreV1().Secrets("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	names := []string{}
+	for _, secret := range remaining.Items {
+		names = append(names, secret.Name)
+	}
+	assert.DeepEqual(t, []string{"in-use", "not-managed", "untracked"}, names)
+
+	configMaps, err := spokeKubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(configMaps.Items))
+	assert.Equal(t, "configmap-in-use", configMaps.Items[0].Name)
+}
+
+func TestSweepSpokeClusterErrors(t *testing.T) {
+	ctx := context.Background()
+	spokeKubeClient := fake.NewSimpleClientset(
+		managedSecret("workload-gone", map[string]string{
+			workloadAnnotation:    "test-namespace/deleted-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}),
+		managedSecret("other-workload-gone", map[string]string{
+			workloadAnnotation:    "test-namespace/other-deleted-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}),
+	)
+	spokeKubeClient.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.DeleteAction).GetName() == "workload-gone" {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	r := &Reconciler{
+		logger:      zap.NewNop().Sugar(),
+		kueueClient: kueuefake.NewSimpleClientset(),
+	}
+	r.leader = leaderFor(t, reconciler.UniversalBucket())
+
+	// The failed deletion is reported after the other orphans are deleted
+	err := r.sweepSpokeCluster(ctx, testClusterName, spokeKubeClient, tektonfake.NewSimpleClientset())
+	assert.ErrorContains(t, err, "could not delete secret test-namespace/workload-gone")
+	remaining, err := spokeKubeClient.CoreV1().Secrets("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(remaining.Items))
+	assert.Equal(t, "workload-gone", remaining.Items[0].Name)
+}
+
+func TestSweepSpokeClusters(t *testing.T) {
+	active := testKubeconfigCluster("active-cluster", "missing-secret")
+	active.Status.Conditions = []metav1.Condition{{Type: kueuev1beta1.MultiKueueClusterActive, Status: metav1.ConditionTrue}}
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		hubKubeClient:  fake.NewSimpleClientset(),
+		kueueClient:    kueuefake.NewSimpleClientset(active, testKubeconfigCluster("inactive-cluster", "missing-secret")),
+		kueueNamespace: testKueueNamespace,
+	}
+
+	// The inactive cluster is skipped, the active one fails
+	swept, err := r.sweepSpokeClusters(context.Background())
+	assert.Equal(t, 0, swept)
+	assert.ErrorContains(t, err, "could not create spoke clients for cluster active-cluster")
+	assert.Assert(t, !strings.Contains(err.Error(), "inactive-cluster"), err.Error())
+}
+
+func TestCleanupSpokeCluster(t *testing.T) {
+	ctx := context.Background()
+	spokeKubeClient := fake.NewSimpleClientset(
+		managedSecret("in-use", map[string]string{
+			workloadAnnotation:    "test-namespace/test-workload",
+			pipelineRunAnnotation: "test-namespace/test-pipeline-run",
+		}),
+		managedSecret("untracked", nil),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "not-managed", Namespace: "test-namespace"}},
+	)
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+
+	deleted, err := r.cleanupSpokeCluster(ctx, testClusterName, spokeKubeClient)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	remaining, err := spokeKubeClient.CoreV1().Secrets("test-namespace").List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(remaining.Items))
+	assert.Equal(t, "not-managed", remaining.Items[0].Name)
+}
+
+func TestSplitNamespacedName(t *testing.T) {
+	namespace, name, ok := splitNamespacedName("ns/name")
+	assert.Assert(t, ok)
+	assert.Equal(t, "ns", namespace)
+	assert.Equal(t, "name", name)
+
+	for _, value := range []string{"", "name", "/name", "ns/"} {
+		_, _, ok := splitNamespacedName(value)
+		assert.Assert(t, !ok, value)
+	}
+}
@@ -0,0 +1,144 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The phases of a sync, each recorded as a condition of the syncStatus of the Workload, so the
+// phase a sync is stuck in can be queried by its reason.
+const (
+	// conditionClusterResolved reports whether the kubeconfig of the spoke cluster was resolved.
+	conditionClusterResolved = "ClusterResolved"
+	// conditionSpokeReachable reports whether the spoke API server answered and serves what the sync needs.
+	conditionSpokeReachable = "SpokeReachable"
+	// conditionPLRFound reports whether the PipelineRun of the Workload exists on the spoke cluster.
+	conditionPLRFound = "PLRFound"
+	// conditionSecretFetched reports whether the secrets of the PipelineRun were read from their source.
+	conditionSecretFetched = "SecretFetched"
+	// conditionSecretApplied reports whether the secrets were written to the spoke cluster.
+	conditionSecretApplied = "SecretApplied"
+	// conditionCleanedUp reports whether the secrets were cleaned up after the PipelineRun.
+	conditionCleanedUp = "CleanedUp"
+)
+
+// The reasons of the phase conditions. The rejected phases get the reason of their rejection
+// instead, e.g. SpokeMissingTekton.
+const (
+	clusterResolvedReason      = "Resolved"
+	clusterResolveFailedReason = "ResolveFailed"
+	spokeReachableReason       = "Reachable"
+	spokeUnreachableReason     = "Unreachable"
+	plrFoundReason             = "Found"
+	plrNotFoundReason          = "NotFound"
+	plrLookupFailedReason      = "LookupFailed"
+	secretFetchedReason        = "Fetched"
+	secretFetchFailedReason    = "FetchFailed"
+	secretAppliedReason        = "Applied"
+	secretApplyFailedReason    = "ApplyFailed"
+	pipelineRunDoneReason      = "PipelineRunDone"
+	workloadFinishedReason     = "WorkloadFinished"
+	cleanupFailedReason        = "CleanupFailed"
+)
+
+// syncConditionsKey carries the syncConditions of a reconcile in its context.
+type syncConditionsKey struct{}
+
+// syncConditions collects the phase conditions of a reconcile, set concurrently by the syncs of
+// its secrets. A nil syncConditions ignores them.
+type syncConditions struct {
+	mu         sync.Mutex
+	conditions []metav1.Condition
+}
+
+// withSyncConditions returns the context of a reconcile recording its phases in conditions.
+func withSyncConditions(ctx context.Context, conditions *syncConditions) context.Context {
+	return context.WithValue(ctx, syncConditionsKey{}, conditions)
+}
+
+// syncConditionsFrom returns the syncConditions of the reconcile, nil outside of one.
+func syncConditionsFrom(ctx context.Context) *syncConditions {
+	conditions, _ := ctx.Value(syncConditionsKey{}).(*syncConditions)
+	return conditions
+}
+
+// set records the outcome of the phase. A phase failing for one secret stays failed when it
+// succeeds for another.
+func (c *syncConditions) set(conditionType string, ok bool, reason, message string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := metav1.ConditionTrue
+	if !ok {
+		status = metav1.ConditionFalse
+	} else if meta.IsStatusConditionFalse(c.conditions, conditionType) {
+		return
+	}
+	meta.SetStatusCondition(&c.conditions, metav1.Condition{Type: conditionType, Status: status, Reason: reason, Message: message})
+}
+
+// fetched records the outcome of reading a secret of the PipelineRun from its source.
+func (c *syncConditions) fetched(pipelineRun *v1.PipelineRun, err error) {
+	if err != nil {
+		c.set(conditionSecretFetched, false, failureReason(err, secretFetchFailedReason), err.Error())
+		return
+	}
+	c.set(conditionSecretFetched, true, secretFetchedReason, fmt.Sprintf("fetched the secrets of PipelineRun %s/%s", pipelineRun.GetNamespace(), pipelineRun.GetName()))
+}
+
+// cleanedUp records the outcome of the cleanup of the secrets after the PipelineRun, for the reason.
+func (c *syncConditions) cleanedUp(reason, message string, err error) {
+	if err != nil {
+		c.set(conditionCleanedUp, false, cleanupFailedReason, err.Error())
+		return
+	}
+	c.set(conditionCleanedUp, true, reason, message)
+}
+
+// failed reports whether the phase was recorded as failed.
+func (c *syncConditions) failed(conditionType string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return meta.IsStatusConditionFalse(c.conditions, conditionType)
+}
+
+// list returns the recorded conditions.
+func (c *syncConditions) list() []metav1.Condition {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]metav1.Condition(nil), c.conditions...)
+}
+
+// failureReason returns the reason of the rejection of the error, e.g. SpokeMissingTekton, or
+// the reason of the phase when it wasn't rejected.
+func failureReason(err error, reason string) string {
+	if rejection := rejectionReason(err); rejection != "" {
+		return rejection
+	}
+	return reason
+}
+
+// mergeConditions returns the previous conditions updated with the recorded ones, keeping the
+// transition time of the ones which didn't change status.
+func mergeConditions(previous, recorded []metav1.Condition, generation int64) []metav1.Condition {
+	merged := append([]metav1.Condition(nil), previous...)
+	for _, condition := range recorded {
+		condition.ObservedGeneration = generation
+		meta.SetStatusCondition(&merged, condition)
+	}
+	return merged
+}
@@ -0,0 +1,95 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncConditions(t *testing.T) {
+	pipelineRun := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-plr", Namespace: "test-namespace"}}
+	tests := []struct {
+		name           string
+		errs           []error
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "fetched",
+			errs:           []error{nil},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: secretFetchedReason,
+		},
+		{
+			name:           "fetch failed",
+			errs:           []error{errors.New("secret test-namespace/git-auth not found")},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: secretFetchFailedReason,
+		},
+		{
+			name:           "failed for one of the secrets",
+			errs:           []error{errors.New("secret test-namespace/git-auth not found"), nil},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: secretFetchFailedReason,
+		},
+		{
+			name:           "rejected",
+			errs:           []error{fmt.Errorf("secret test-namespace/git-auth is revoked: %w", ErrSecretRevoked)},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: secretRevokedReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := &syncConditions{}
+			ctx := withSyncConditions(context.Background(), conditions)
+			for _, err := range tt.errs {
+				syncConditionsFrom(ctx).fetched(pipelineRun, err)
+			}
+			condition := meta.FindStatusCondition(conditions.list(), conditionSecretFetched)
+			assert.Assert(t, condition != nil)
+			assert.Equal(t, tt.expectedStatus, condition.Status)
+			assert.Equal(t, tt.expectedReason, condition.Reason)
+			assert.Equal(t, tt.expectedStatus == metav1.ConditionFalse, conditions.failed(conditionSecretFetched))
+		})
+	}
+}
+
+func TestSyncConditionsOutsideOfAReconcile(t *testing.T) {
+	conditions := syncConditionsFrom(context.Background())
+	assert.Assert(t, conditions == nil)
+	conditions.set(conditionPLRFound, true, plrFoundReason, "found")
+	conditions.cleanedUp(pipelineRunDoneReason, "done", nil)
+	assert.Assert(t, !conditions.failed(conditionPLRFound))
+	assert.Assert(t, conditions.list() == nil)
+}
+
+func TestMergeConditions(t *testing.T) {
+	transition := metav1.NewTime(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC))
+	previous := []metav1.Condition{
+		{Type: conditionPLRFound, Status: metav1.ConditionTrue, Reason: plrFoundReason, ObservedGeneration: 1, LastTransitionTime: transition},
+		{Type: conditionSecretApplied, Status: metav1.ConditionTrue, Reason: secretAppliedReason, ObservedGeneration: 1, LastTransitionTime: transition},
+	}
+	merged := mergeConditions(previous, []metav1.Condition{
+		{Type: conditionPLRFound, Status: metav1.ConditionTrue, Reason: plrFoundReason, Message: "found again"},
+		{Type: conditionSecretApplied, Status: metav1.ConditionFalse, Reason: secretApplyFailedReason},
+	}, 2)
+
+	found := meta.FindStatusCondition(merged, conditionPLRFound)
+	assert.Equal(t, "found again", found.Message)
+	assert.Equal(t, int64(2), found.ObservedGeneration)
+	assert.Assert(t, transition.Equal(&found.LastTransitionTime))
+	applied := meta.FindStatusCondition(merged, conditionSecretApplied)
+	assert.Equal(t, secretApplyFailedReason, applied.Reason)
+	assert.Assert(t, applied.LastTransitionTime.After(transition.Time))
+	// The previous conditions are left untouched
+	assert.Equal(t, metav1.ConditionTrue, previous[1].Status)
+}
@@ -0,0 +1,277 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// secretSyncerConfigGVR is the cluster scoped SecretSyncerConfig CR,
+// config/crd-secretsyncerconfig.yaml.
+var secretSyncerConfigGVR = schema.GroupVersionResource{Group: syncerGroupName, Version: "v1alpha1", Resource: "secretsyncerconfigs"}
+
+// settingNamePattern matches the names of the environment variables a SecretSyncerConfig sets.
+var settingNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// unsupportedSettings are the environment variables a SecretSyncerConfig can't set: the ones
+// locating it, and the ones of each pod.
+var unsupportedSettings = []string{
+	"SECRET_SYNCER_CONFIG",
+	"HUB_KUBECONFIG_CONTEXT",
+	"KUBECONFIG",
+	"SYSTEM_NAMESPACE",
+	"POD_NAME",
+	"STATEFUL_CONTROLLER_ORDINAL",
+	"STATEFUL_SERVICE_NAME",
+}
+
+// secretSyncerConfigSpec is the spec of a SecretSyncerConfig, the configuration of the controller
+// managed as a resource rather than as the environment of its pods.
+type secretSyncerConfigSpec struct {
+	// KueueNamespace sets KUEUE_NAMESPACE.
+	KueueNamespace string `json:"kueueNamespace,omitempty"`
+	// WatchNamespaces sets WATCH_NAMESPACES.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// SecretSource sets SECRET_SOURCE.
+	SecretSource string `json:"secretSource,omitempty"`
+	// SpokeSecretMode sets SPOKE_SECRET_MODE.
+	SpokeSecretMode string `json:"spokeSecretMode,omitempty"`
+	// SecretRetainPolicy sets SECRET_RETAIN_POLICY.
+	SecretRetainPolicy string `json:"secretRetainPolicy,omitempty"`
+	// DryRun sets DRY_RUN.
+	DryRun *bool `json:"dryRun,omitempty"`
+	// WorkerThreads sets WORKER_THREADS.
+	WorkerThreads *int `json:"workerThreads,omitempty"`
+	// SpokeClientQPS sets SPOKE_CLIENT_QPS.
+	SpokeClientQPS *float64 `json:"spokeClientQPS,omitempty"`
+	// SpokeClientBurst sets SPOKE_CLIENT_BURST.
+	SpokeClientBurst *int `json:"spokeClientBurst,omitempty"`
+	// SpokeRequestTimeout sets SPOKE_REQUEST_TIMEOUT.
+	SpokeRequestTimeout *metav1.Duration `json:"spokeRequestTimeout,omitempty"`
+	// Settings are the other environment variables of the controller, by name, e.g.
+	// PIPELINERUN_SECRET_SOURCES.
+	Settings map[string]string `json:"settings,omitempty"`
+	// FeatureGates set FEATURE_GATES.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// validate checks the spec of the SecretSyncerConfig name. The values are checked when the
+// options are read, like the ones of the environment.
+func (s *secretSyncerConfigSpec) validate(name string) error {
+	for setting := range s.Settings {
+		if !settingNamePattern.MatchString(setting) {
+			return fmt.Errorf("invalid SecretSyncerConfig %s: setting %q is not an environment variable name", name, setting)
+		}
+		if slices.Contains(unsupportedSettings, setting) {
+			return fmt.Errorf("invalid SecretSyncerConfig %s: setting %s can only be set in the environment of the pods", name, setting)
+		}
+	}
+	for setting, field := range s.typedSettings() {
+		if _, ok := s.Settings[setting]; ok {
+			return fmt.Errorf("invalid SecretSyncerConfig %s: %s is set by both settings and %s", name, setting, field.name)
+		}
+	}
+	for gate := range s.FeatureGates {
+		if _, ok := defaultFeatureGates[gate]; !ok {
+			return fmt.Errorf("invalid SecretSyncerConfig %s: unknown feature gate %q", name, gate)
+		}
+	}
+	return nil
+}
+
+// typedSetting is the value of an environment variable set by a field of the spec, rather than
+// by its settings.
+type typedSetting struct {
+	name  string
+	value string
+}
+
+// typedSettings returns the environment variables set by the fields of the spec, by name.
+func (s *secretSyncerConfigSpec) typedSettings() map[string]typedSetting {
+	settings := map[string]typedSetting{}
+	set := func(setting, field, value string) {
+		if value != "" {
+			settings[setting] = typedSetting{name: field, value: value}
+		}
+	}
+	set("KUEUE_NAMESPACE", "kueueNamespace", s.KueueNamespace)
+	set("WATCH_NAMESPACES", "watchNamespaces", strings.Join(s.WatchNamespaces, ","))
+	set("SECRET_SOURCE", "secretSource", s.SecretSource)
+	set("SPOKE_SECRET_MODE", "spokeSecretMode", s.SpokeSecretMode)
+	set("SECRET_RETAIN_POLICY", "secretRetainPolicy", s.SecretRetainPolicy)
+	if s.DryRun != nil {
+		set("DRY_RUN", "dryRun", strconv.FormatBool(*s.DryRun))
+	}
+	if s.WorkerThreads != nil {
+		set("WORKER_THREADS", "workerThreads", strconv.Itoa(*s.WorkerThreads))
+	}
+	if s.SpokeClientQPS != nil {
+		set("SPOKE_CLIENT_QPS", "spokeClientQPS", strconv.FormatFloat(*s.SpokeClientQPS, 'f', -1, 64))
+	}
+	if s.SpokeClientBurst != nil {
+		set("SPOKE_CLIENT_BURST", "spokeClientBurst", strconv.Itoa(*s.SpokeClientBurst))
+	}
+	if s.SpokeRequestTimeout != nil {
+		set("SPOKE_REQUEST_TIMEOUT", "spokeRequestTimeout", s.SpokeRequestTimeout.Duration.String())
+	}
+	if len(s.FeatureGates) > 0 {
+		gates := make([]string, 0, len(s.FeatureGates))
+		for gate, enabled := range s.FeatureGates {
+			gates = append(gates, gate+"="+strconv.FormatBool(enabled))
+		}
+		sort.Strings(gates)
+		set("FEATURE_GATES", "featureGates", strings.Join(gates, ","))
+	}
+	return settings
+}
+
+// environment returns the environment variables the spec sets.
+func (s *secretSyncerConfigSpec) environment() map[string]string {
+	typed := s.typedSettings()
+	env := make(map[string]string, len(s.Settings)+len(typed))
+	for name, value := range s.Settings {
+		env[name] = value
+	}
+	for name, setting := range typed {
+		env[name] = setting.value
+	}
+	return env
+}
+
+// AppliedSecretSyncerConfig is a SecretSyncerConfig applied by ApplySecretSyncerConfig.
+type AppliedSecretSyncerConfig struct {
+	// Name is the name of the SecretSyncerConfig.
+	Name string
+	// Settings are the names of the environment variables it set.
+	Settings []string
+	// generation is the generation of the SecretSyncerConfig when it was applied.
+	generation int64
+}
+
+// ApplySecretSyncerConfig sets the environment variables of the SecretSyncerConfig named by
+// SECRET_SYNCER_CONFIG, read from the hub cluster of the config, in place of the ones of the
+// process, and returns it. It is a no-op returning nil when SECRET_SYNCER_CONFIG is unset. It must
+// run before the controllers are constructed, the variables it sets can still be overridden
+// afterwards, e.g. by flags.
+func ApplySecretSyncerConfig(ctx context.Context, cfg *rest.Config) (*AppliedSecretSyncerConfig, error) {
+	name := os.Getenv("SECRET_SYNCER_CONFIG")
+	if name == "" {
+		return nil, nil
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	env, generation, err := secretSyncerConfigEnvironment(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := &AppliedSecretSyncerConfig{Name: name, generation: generation}
+	for name, value := range env {
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("could not set %s: %w", name, err)
+		}
+		applied.Settings = append(applied.Settings, name)
+	}
+	sort.Strings(applied.Settings)
+	return applied, nil
+}
+
+// Watch watches the applied SecretSyncerConfig until the context is done, and calls changed once
+// its spec changed or it was deleted, for the controller to restart with the new settings, which
+// are only read on startup. It is a no-op on a nil AppliedSecretSyncerConfig.
+func (a *AppliedSecretSyncerConfig) Watch(ctx context.Context, cfg *rest.Config, changed func()) error {
+	if a == nil {
+		return nil
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	return a.watch(ctx, client, changed)
+}
+
+// watch is Watch with the dynamic client of the hub cluster.
+func (a *AppliedSecretSyncerConfig) watch(ctx context.Context, client dynamic.Interface, changed func()) error {
+	var once sync.Once
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { a.configChanged(obj, false, &once, changed) },
+		UpdateFunc: func(_, obj any) { a.configChanged(obj, false, &once, changed) },
+		DeleteFunc: func(obj any) { a.configChanged(obj, true, &once, changed) },
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", a.Name).String()
+	})
+	if _, err := factory.ForResource(secretSyncerConfigGVR).Informer().AddEventHandler(handler); err != nil {
+		return fmt.Errorf("could not register the %s event handler: %w", secretSyncerConfigGVR.Resource, err)
+	}
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	return nil
+}
+
+// configChanged calls changed once when the applied SecretSyncerConfig was deleted or its spec
+// changed, the generation only changing with the spec, not with the labels or annotations.
+func (a *AppliedSecretSyncerConfig) configChanged(obj any, deleted bool, once *sync.Once, changed func()) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	config, ok := obj.(metav1.Object)
+	if !ok || config.GetName() != a.Name {
+		return
+	}
+	if deleted || config.GetGeneration() != a.generation {
+		once.Do(changed)
+	}
+}
+
+// secretSyncerConfigEnvironment returns the environment variables the SecretSyncerConfig sets and
+// its generation. A missing SecretSyncerConfig fails, rather than running the controller with the
+// defaults.
+func secretSyncerConfigEnvironment(ctx context.Context, client dynamic.Interface, name string) (map[string]string, int64, error) {
+	obj, err := client.Resource(secretSyncerConfigGVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not get SecretSyncerConfig %s: %w", name, err)
+	}
+	spec, err := secretSyncerConfigSpecFromUnstructured(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	return spec.environment(), obj.GetGeneration(), nil
+}
+
+// secretSyncerConfigSpecFromUnstructured converts and validates the spec of a SecretSyncerConfig.
+func secretSyncerConfigSpecFromUnstructured(obj *unstructured.Unstructured) (*secretSyncerConfigSpec, error) {
+	spec := &secretSyncerConfigSpec{}
+	content, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SecretSyncerConfig %s: %w", obj.GetName(), err)
+	}
+	if ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, spec); err != nil {
+			return nil, fmt.Errorf("invalid SecretSyncerConfig %s: %w", obj.GetName(), err)
+		}
+	}
+	if err := spec.validate(obj.GetName()); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
@@ -0,0 +1,199 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+func testSecretSyncerConfig(name string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetAPIVersion(secretSyncerConfigGVR.GroupVersion().String())
+	obj.SetKind("SecretSyncerConfig")
+	obj.SetName(name)
+	return obj
+}
+
+func TestSecretSyncerConfigEnvironment(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          map[string]any
+		expected      map[string]string
+		expectedError string
+	}{
+		{
+			name:          "no SecretSyncerConfig",
+			expectedError: `could not get SecretSyncerConfig default: secretsyncerconfigs.secret-syncer.tekton.dev "default" not found`,
+		},
+		{
+			name:     "empty spec",
+			spec:     map[string]any{},
+			expected: map[string]string{},
+		},
+		{
+			name: "settings and feature gates",
+			spec: map[string]any{
+				"settings":     map[string]any{"KUEUE_NAMESPACE": "openshift-kueue", "SPOKE_CLIENT_QPS": "10"},
+				"featureGates": map[string]any{featureSecretRotation: false, featurePullAgent: true},
+			},
+			expected: map[string]string{
+				"KUEUE_NAMESPACE":  "openshift-kueue",
+				"SPOKE_CLIENT_QPS": "10",
+				"FEATURE_GATES":    "pull-agent=true,secret-rotation=false",
+			},
+		},
+		{
+			name: "typed settings",
+			spec: map[string]any{
+				"kueueNamespace":      "openshift-kueue",
+				"watchNamespaces":     []any{"team-a", "team-b"},
+				"secretSource":        "vault",
+				"spokeSecretMode":     "pull",
+				"secretRetainPolicy":  "Retain",
+				"dryRun":              true,
+				"workerThreads":       int64(16),
+				"spokeClientQPS":      12.5,
+				"spokeClientBurst":    int64(25),
+				"spokeRequestTimeout": "3s",
+				"settings":            map[string]any{"HUB_SECRET_WATCH": "true"},
+			},
+			expected: map[string]string{
+				"KUEUE_NAMESPACE":       "openshift-kueue",
+				"WATCH_NAMESPACES":      "team-a,team-b",
+				"SECRET_SOURCE":         "vault",
+				"SPOKE_SECRET_MODE":     "pull",
+				"SECRET_RETAIN_POLICY":  "Retain",
+				"DRY_RUN":               "true",
+				"WORKER_THREADS":        "16",
+				"SPOKE_CLIENT_QPS":      "12.5",
+				"SPOKE_CLIENT_BURST":    "25",
+				"SPOKE_REQUEST_TIMEOUT": "3s",
+				"HUB_SECRET_WATCH":      "true",
+			},
+		},
+		{
+			name: "typed setting set twice",
+			spec: map[string]any{
+				"kueueNamespace": "openshift-kueue",
+				"settings":       map[string]any{"KUEUE_NAMESPACE": "kueue-system"},
+			},
+			expectedError: "invalid SecretSyncerConfig default: KUEUE_NAMESPACE is set by both settings and kueueNamespace",
+		},
+		{
+			name:          "not an environment variable name",
+			spec:          map[string]any{"settings": map[string]any{"kueueNamespace": "openshift-kueue"}},
+			expectedError: `invalid SecretSyncerConfig default: setting "kueueNamespace" is not an environment variable name`,
+		},
+		{
+			name:          "setting of the pods",
+			spec:          map[string]any{"settings": map[string]any{"STATEFUL_CONTROLLER_ORDINAL": "0"}},
+			expectedError: "invalid SecretSyncerConfig default: setting STATEFUL_CONTROLLER_ORDINAL can only be set in the environment of the pods",
+		},
+		{
+			name: "feature gates set twice",
+			spec: map[string]any{
+				"settings":     map[string]any{"FEATURE_GATES": "pull-agent=true"},
+				"featureGates": map[string]any{featurePullAgent: true},
+			},
+			expectedError: "invalid SecretSyncerConfig default: FEATURE_GATES is set by both settings and featureGates",
+		},
+		{
+			name:          "unknown feature gate",
+			spec:          map[string]any{"featureGates": map[string]any{"spoke-gc": true}},
+			expectedError: `invalid SecretSyncerConfig default: unknown feature gate "spoke-gc"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.spec != nil {
+				objects = append(objects, testSecretSyncerConfig("default", tt.spec))
+			}
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{secretSyncerConfigGVR: "SecretSyncerConfigList"}, objects...)
+			env, _, err := secretSyncerConfigEnvironment(context.Background(), client, "default")
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, env)
+		})
+	}
+}
+
+func TestApplySecretSyncerConfigUnset(t *testing.T) {
+	t.Setenv("SECRET_SYNCER_CONFIG", "")
+	// Nothing is read from the hub without SECRET_SYNCER_CONFIG
+	applied, err := ApplySecretSyncerConfig(context.Background(), &rest.Config{Host: "https://hub.invalid"})
+	assert.NilError(t, err)
+	assert.Assert(t, applied == nil)
+	// Nor watched
+	assert.NilError(t, applied.Watch(context.Background(), &rest.Config{Host: "https://hub.invalid"}, func() { t.Fatal("unexpected change") }))
+}
+
+func TestAppliedSecretSyncerConfigWatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   func(*unstructured.Unstructured)
+		delete   bool
+		expected bool
+	}{
+		{
+			name:     "spec changed",
+			update:   func(obj *unstructured.Unstructured) { obj.SetGeneration(2) },
+			expected: true,
+		},
+		{
+			name:   "labels changed",
+			update: func(obj *unstructured.Unstructured) { obj.SetLabels(map[string]string{"team": "platform"}) },
+		},
+		{
+			name:     "deleted",
+			delete:   true,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			config := testSecretSyncerConfig("default", map[string]any{"kueueNamespace": "openshift-kueue"})
+			config.SetGeneration(1)
+			other := testSecretSyncerConfig("other", map[string]any{})
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{secretSyncerConfigGVR: "SecretSyncerConfigList"}, config, other)
+
+			changed := make(chan struct{}, 2)
+			applied := &AppliedSecretSyncerConfig{Name: "default", generation: 1}
+			assert.NilError(t, applied.watch(ctx, client, func() { changed <- struct{}{} }))
+
+			// The other SecretSyncerConfigs are ignored
+			other.SetGeneration(5)
+			_, err := client.Resource(secretSyncerConfigGVR).Update(ctx, other, metav1.UpdateOptions{})
+			assert.NilError(t, err)
+			if tt.delete {
+				err = client.Resource(secretSyncerConfigGVR).Delete(ctx, "default", metav1.DeleteOptions{})
+			} else {
+				tt.update(config)
+				_, err = client.Resource(secretSyncerConfigGVR).Update(ctx, config, metav1.UpdateOptions{})
+			}
+			assert.NilError(t, err)
+
+			select {
+			case <-changed:
+				assert.Assert(t, tt.expected, "unexpected change")
+			case <-time.After(200 * time.Millisecond):
+				assert.Assert(t, !tt.expected, "change not seen")
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+const (
+	// secretSyncPolicyTTL is how long the sync policies are remembered without reading them on every
+	// reconcile. The watched policies are forgotten as soon as they change, the TTL only bounds how
+	// long a missed event is.
+	secretSyncPolicyTTL = time.Minute
+
+	// secretSyncPolicyName is the name of the policies read: the ClusterSecretSyncPolicy holding
+	// the defaults of the hub, and the SecretSyncPolicy of each namespace overriding them.
+	secretSyncPolicyName = "default"
+
+	// The fields of the policies, which the ClusterSecretSyncPolicy may lock.
+	syncPolicyFieldRetainPolicy   = "retainPolicy"
+	syncPolicyFieldOversizePolicy = "oversizePolicy"
+	syncPolicyFieldSecretType     = "secretType"
+	syncPolicyFieldKeyMapping     = "keyMapping"
+	syncPolicyFieldGitCASecret    = "gitCASecret"
+)
+
+var (
+	// secretSyncPolicyGVR is the namespaced SecretSyncPolicy CR, config/crd-secretsyncpolicy.yaml.
+	secretSyncPolicyGVR = schema.GroupVersionResource{Group: syncerGroupName, Version: "v1alpha1", Resource: "secretsyncpolicies"}
+	// clusterSecretSyncPolicyGVR is the cluster scoped ClusterSecretSyncPolicy CR.
+	clusterSecretSyncPolicyGVR = schema.GroupVersionResource{Group: syncerGroupName, Version: "v1alpha1", Resource: "clustersecretsyncpolicies"}
+)
+
+// secretSyncPolicySpec is the spec of a SecretSyncPolicy or of a ClusterSecretSyncPolicy, the
+// settings of the syncs of a hub namespace overriding the ones of the controller.
+type secretSyncPolicySpec struct {
+	// RetainPolicy overrides SECRET_RETAIN_POLICY.
+	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
+	// OversizePolicy overrides SPOKE_SECRET_OVERSIZE_POLICY.
+	OversizePolicy string `json:"oversizePolicy,omitempty"`
+	// SecretType overrides SPOKE_SECRET_TYPE.
+	SecretType corev1.SecretType `json:"secretType,omitempty"`
+	// KeyMapping overrides SPOKE_SECRET_KEY_MAPPING, the spoke keys by hub key.
+	KeyMapping map[string]string `json:"keyMapping,omitempty"`
+	// GitCASecret names the hub secret of each namespace holding the CA of its git servers, see
+	// gitCASecretAnnotation.
+	GitCASecret string `json:"gitCASecret,omitempty"`
+	// LockedFields, only read from the ClusterSecretSyncPolicy, are the fields the
+	// SecretSyncPolicies of the namespaces can't override.
+	LockedFields []string `json:"lockedFields,omitempty"`
+}
+
+// validate checks the spec of the policy kind/name.
+func (s *secretSyncPolicySpec) validate(kind, name string) error {
+	if s.RetainPolicy != "" {
+		if _, err := parseRetainPolicy(string(s.RetainPolicy)); err != nil {
+			return fmt.Errorf("invalid %s %s: %w", kind, name, err)
+		}
+	}
+	if s.OversizePolicy != "" {
+		if _, err := parseOversizePolicy(s.OversizePolicy); err != nil {
+			return fmt.Errorf("invalid %s %s: %w", kind, name, err)
+		}
+	}
+	if s.SecretType != "" {
+		if _, err := parseSpokeSecretType(string(s.SecretType)); err != nil {
+			return fmt.Errorf("invalid %s %s: %w", kind, name, err)
+		}
+	}
+	if len(s.KeyMapping) > 0 {
+		pairs := make([]string, 0, len(s.KeyMapping))
+		for from, to := range s.KeyMapping {
+			pairs = append(pairs, from+"="+to)
+		}
+		if _, err := parseSecretKeyMapping(strings.Join(pairs, ",")); err != nil {
+			return fmt.Errorf("invalid %s %s: %w", kind, name, err)
+		}
+	}
+	if s.GitCASecret != "" {
+		if errs := validation.IsDNS1123Subdomain(s.GitCASecret); len(errs) > 0 {
+			return fmt.Errorf("invalid %s %s: invalid git CA secret name %q: %s", kind, name, s.GitCASecret, strings.Join(errs, ", "))
+		}
+	}
+	fields := []string{syncPolicyFieldRetainPolicy, syncPolicyFieldOversizePolicy, syncPolicyFieldSecretType, syncPolicyFieldKeyMapping, syncPolicyFieldGitCASecret}
+	for _, field := range s.LockedFields {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("invalid %s %s: unsupported locked field %q, must be one of %s", kind, name, field, strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// syncPolicy is the resolved policy of a hub namespace.
+type syncPolicy struct {
+	retainPolicy   RetainPolicy
+	oversizePolicy string
+	secretType     corev1.SecretType
+	keyMapping     map[string]string
+	gitCASecret    string
+}
+
+// secretSyncPolicies resolves and caches the sync policies of the hub namespaces.
+type secretSyncPolicies struct {
+	client dynamic.Interface
+	// now is overridden in tests
+	now func() time.Time
+	// fetching serializes the reads of the policy of each namespace, without holding back the
+	// other namespaces
+	fetching keyedMutex
+
+	mu sync.Mutex
+	// specs and fetchedAt are keyed by namespace, the ClusterSecretSyncPolicy by the empty one
+	specs     map[string]*secretSyncPolicySpec
+	fetchedAt map[string]time.Time
+}
+
+func newSecretSyncPolicies(client dynamic.Interface) *secretSyncPolicies {
+	return &secretSyncPolicies{
+		client:    client,
+		now:       time.Now,
+		specs:     map[string]*secretSyncPolicySpec{},
+		fetchedAt: map[string]time.Time{},
+	}
+}
+
+// resolve returns the policy of the namespace: the settings of its SecretSyncPolicy which the
+// ClusterSecretSyncPolicy doesn't lock, then the ones of the ClusterSecretSyncPolicy, then the
+// defaults. An invalid policy fails until it is fixed, rather than syncing without it.
+func (p *secretSyncPolicies) resolve(ctx context.Context, namespace string, defaults syncPolicy) (syncPolicy, error) {
+	if p == nil {
+		return defaults, nil
+	}
+	clusterSpec, err := p.get(ctx, "")
+	if err != nil {
+		return syncPolicy{}, err
+	}
+	namespaceSpec, err := p.get(ctx, namespace)
+	if err != nil {
+		return syncPolicy{}, err
+	}
+
+	policy := defaults
+	var locked []string
+	if clusterSpec != nil {
+		policy = clusterSpec.apply(policy, nil)
+		locked = clusterSpec.LockedFields
+	}
+	if namespaceSpec != nil {
+		policy = namespaceSpec.apply(policy, locked)
+	}
+	return policy, nil
+}
+
+// apply overrides the policy with the settings of the spec which aren't locked.
+func (s *secretSyncPolicySpec) apply(policy syncPolicy, locked []string) syncPolicy {
+	if s.RetainPolicy != "" && !slices.Contains(locked, syncPolicyFieldRetainPolicy) {
+		policy.retainPolicy = s.RetainPolicy
+	}
+	if s.OversizePolicy != "" && !slices.Contains(locked, syncPolicyFieldOversizePolicy) {
+		policy.oversizePolicy = s.OversizePolicy
+	}
+	if s.SecretType != "" && !slices.Contains(locked, syncPolicyFieldSecretType) {
+		policy.secretType = s.SecretType
+	}
+	// A mapping replaces the one of the defaults rather than being merged with it
+	if len(s.KeyMapping) > 0 && !slices.Contains(locked, syncPolicyFieldKeyMapping) {
+		policy.keyMapping = s.KeyMapping
+	}
+	if s.GitCASecret != "" && !slices.Contains(locked, syncPolicyFieldGitCASecret) {
+		policy.gitCASecret = s.GitCASecret
+	}
+	return policy
+}
+
+// get returns the spec of the SecretSyncPolicy of the namespace, or of the
+// ClusterSecretSyncPolicy for the empty namespace, nil when there is none.
+func (p *secretSyncPolicies) get(ctx context.Context, namespace string) (*secretSyncPolicySpec, error) {
+	if spec, ok := p.cached(namespace); ok {
+		return spec, nil
+	}
+	unlock, err := p.fetching.lock(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the sync policy %s: %w", policyName(namespace), err)
+	}
+	defer unlock()
+	if spec, ok := p.cached(namespace); ok {
+		return spec, nil
+	}
+
+	kind, resource := "SecretSyncPolicy", p.client.Resource(secretSyncPolicyGVR).Namespace(namespace)
+	if namespace == "" {
+		kind, resource = "ClusterSecretSyncPolicy", p.client.Resource(clusterSecretSyncPolicyGVR)
+	}
+	obj, err := resource.Get(ctx, secretSyncPolicyName, metav1.GetOptions{})
+	var spec *secretSyncPolicySpec
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("could not get %s %s: %w", kind, policyName(namespace), err)
+	default:
+		if spec, err = secretSyncPolicySpecFromUnstructured(kind, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.specs[namespace] = spec
+	p.fetchedAt[namespace] = p.now()
+	return spec, nil
+}
+
+// cached returns the spec of the policy of the namespace fetched within secretSyncPolicyTTL.
+func (p *secretSyncPolicies) cached(namespace string) (*secretSyncPolicySpec, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fetchedAt, ok := p.fetchedAt[namespace]
+	if !ok || p.now().Sub(fetchedAt) >= secretSyncPolicyTTL {
+		return nil, false
+	}
+	return p.specs[namespace], true
+}
+
+// forget drops the cached spec of the policy of the namespace, the ClusterSecretSyncPolicy for
+// the empty one, so the next reconcile reads it again.
+func (p *secretSyncPolicies) forget(namespace string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.specs, namespace)
+	delete(p.fetchedAt, namespace)
+}
+
+// watch starts the informers of the SecretSyncPolicies of the namespaces, all of them when empty,
+// and of the ClusterSecretSyncPolicy, and waits for their caches to sync. A policy changing is
+// forgotten, then changed is called with its namespace, empty for the ClusterSecretSyncPolicy.
+func (p *secretSyncPolicies) watch(ctx context.Context, namespaces []string, changed func(namespace string)) error {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	handler := cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			// The policies listed on startup are read by the first reconciles
+			if !isInInitialList {
+				p.policyChanged(obj, changed)
+			}
+		},
+		UpdateFunc: func(_, obj any) { p.policyChanged(obj, changed) },
+		DeleteFunc: func(obj any) { p.policyChanged(obj, changed) },
+	}
+
+	watched := map[schema.GroupVersionResource][]string{
+		clusterSecretSyncPolicyGVR: {metav1.NamespaceAll},
+		secretSyncPolicyGVR:        namespaces,
+	}
+	for gvr, namespaces := range watched {
+		for _, namespace := range namespaces {
+			factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(p.client, controller.GetResyncPeriod(ctx), namespace, func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secretSyncPolicyName).String()
+			})
+			if _, err := factory.ForResource(gvr).Informer().AddEventHandler(handler); err != nil {
+				return fmt.Errorf("could not register the %s event handler: %w", gvr.Resource, err)
+			}
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+		}
+	}
+	return nil
+}
+
+// policyChanged forgets the changed policy and calls changed with its namespace.
+func (p *secretSyncPolicies) policyChanged(obj any, changed func(namespace string)) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	policy, ok := obj.(metav1.Object)
+	if !ok || policy.GetName() != secretSyncPolicyName {
+		return
+	}
+	p.forget(policy.GetNamespace())
+	changed(policy.GetNamespace())
+}
+
+// syncPolicyResyncFilter selects the Workloads resynced after the sync policy of the namespace
+// changed, the ones of configResyncFilter in the namespace, of every namespace for the empty one.
+func syncPolicyResyncFilter(queues workloadQueueFilter, namespace string) func(any) bool {
+	filter := configResyncFilter(queues)
+	return func(obj any) bool {
+		workload, ok := obj.(*kueuev1beta1.Workload)
+		return ok && (namespace == "" || workload.Namespace == namespace) && filter(obj)
+	}
+}
+
+// policyName returns the name of the policy of the namespace, as namespace/name when namespaced.
+func policyName(namespace string) string {
+	if namespace == "" {
+		return secretSyncPolicyName
+	}
+	return namespace + "/" + secretSyncPolicyName
+}
+
+// secretSyncPolicySpecFromUnstructured converts and validates the spec of a sync policy.
+func secretSyncPolicySpecFromUnstructured(kind string, obj *unstructured.Unstructured) (*secretSyncPolicySpec, error) {
+	name := policyName(obj.GetNamespace())
+	spec := &secretSyncPolicySpec{}
+	content, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", kind, name, err)
+	}
+	if ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, spec); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", kind, name, err)
+		}
+	}
+	if err := spec.validate(kind, name); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// syncPolicy returns the policy of the hub namespace, the settings of the controller when the
+// sync policies aren't read.
+func (r *Reconciler) syncPolicy(ctx context.Context, namespace string) (syncPolicy, error) {
+	return r.syncPolicies.resolve(ctx, namespace, syncPolicy{
+		retainPolicy:   r.retainPolicy,
+		oversizePolicy: r.oversizePolicy,
+		secretType:     r.secretType,
+		keyMapping:     r.secretKeyMapping,
+	})
+}
+
+// namespaceOversizePolicy returns the oversize policy of the hub namespace. A failure to resolve
+// its sync policy falls back to the policy of the controller, which rejects the secret unless
+// it splits them.
+func (r *Reconciler) namespaceOversizePolicy(ctx context.Context, namespace string) string {
+	policy, err := r.syncPolicy(ctx, namespace)
+	if err != nil {
+		r.logger.Warnf("using the default oversize policy for namespace %s: %v", namespace, err)
+		return r.oversizePolicy
+	}
+	return policy.oversizePolicy
+}
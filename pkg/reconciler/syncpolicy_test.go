@@ -0,0 +1,266 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func testSecretSyncPolicy(namespace string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetAPIVersion(secretSyncPolicyGVR.GroupVersion().String())
+	obj.SetKind("SecretSyncPolicy")
+	if namespace == "" {
+		obj.SetKind("ClusterSecretSyncPolicy")
+	}
+	obj.SetName(secretSyncPolicyName)
+	obj.SetNamespace(namespace)
+	return obj
+}
+
+func newTestSyncPolicyClient(objects ...runtime.Object) dynamic.Interface {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		secretSyncPolicyGVR:        "SecretSyncPolicyList",
+		clusterSecretSyncPolicyGVR: "ClusterSecretSyncPolicyList",
+	}, objects...)
+}
+
+func TestSecretSyncPolicies(t *testing.T) {
+	defaults := syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicyReject}
+	tests := []struct {
+		name          string
+		clusterSpec   map[string]any
+		namespaceSpec map[string]any
+		expected      syncPolicy
+		expectedError string
+	}{
+		{
+			name:     "no policy",
+			expected: defaults,
+		},
+		{
+			name:        "cluster policy",
+			clusterSpec: map[string]any{"retainPolicy": "Retain"},
+			expected:    syncPolicy{retainPolicy: RetainPolicyRetain, oversizePolicy: oversizePolicyReject},
+		},
+		{
+			name:          "namespace policy overrides the cluster policy",
+			clusterSpec:   map[string]any{"retainPolicy": "Retain", "oversizePolicy": "split"},
+			namespaceSpec: map[string]any{"retainPolicy": "Delete"},
+			expected:      syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicySplit},
+		},
+		{
+			name:          "locked field",
+			clusterSpec:   map[string]any{"retainPolicy": "Retain", "lockedFields": []any{"retainPolicy"}},
+			namespaceSpec: map[string]any{"retainPolicy": "Delete", "oversizePolicy": "split"},
+			expected:      syncPolicy{retainPolicy: RetainPolicyRetain, oversizePolicy: oversizePolicySplit},
+		},
+		{
+			name:          "locked fields of a namespace policy are ignored",
+			namespaceSpec: map[string]any{"oversizePolicy": "split", "lockedFields": []any{"oversizePolicy"}},
+			expected:      syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicySplit},
+		},
+		{
+			name:          "secret type",
+			clusterSpec:   map[string]any{"secretType": "kubernetes.io/basic-auth", "lockedFields": []any{"secretType"}},
+			namespaceSpec: map[string]any{"secretType": "Opaque", "keyMapping": map[string]any{"git-provider-token": "password"}},
+			expected: syncPolicy{
+				retainPolicy:   RetainPolicyDelete,
+				oversizePolicy: oversizePolicyReject,
+				secretType:     corev1.SecretTypeBasicAuth,
+				keyMapping:     map[string]string{"git-provider-token": "password"},
+			},
+		},
+		{
+			name:          "invalid secret type",
+			namespaceSpec: map[string]any{"secretType": "kubernetes.io/git"},
+			expectedError: `invalid SecretSyncPolicy test-namespace/default: unsupported secret type "kubernetes.io/git", must be one of Opaque, kubernetes.io/basic-auth, kubernetes.io/dockerconfigjson, kubernetes.io/ssh-auth, kubernetes.io/tls`,
+		},
+		{
+			name:          "git CA secret",
+			clusterSpec:   map[string]any{"gitCASecret": "internal-git-ca"},
+			namespaceSpec: map[string]any{"gitCASecret": "team-git-ca"},
+			expected:      syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicyReject, gitCASecret: "team-git-ca"},
+		},
+		{
+			name:          "invalid git CA secret",
+			namespaceSpec: map[string]any{"gitCASecret": "Internal_CA"},
+			expectedError: `invalid SecretSyncPolicy test-namespace/default: invalid git CA secret name "Internal_CA": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+		},
+		{
+			name:          "invalid namespace policy",
+			namespaceSpec: map[string]any{"retainPolicy": "Keep"},
+			expectedError: `invalid SecretSyncPolicy test-namespace/default: unsupported retain policy "Keep", must be one of Delete or Retain`,
+		},
+		{
+			name:          "unsupported locked field",
+			clusterSpec:   map[string]any{"lockedFields": []any{"proxyURL"}},
+			expectedError: `invalid ClusterSecretSyncPolicy default: unsupported locked field "proxyURL", must be one of retainPolicy, oversizePolicy, secretType, keyMapping, gitCASecret`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.clusterSpec != nil {
+				objects = append(objects, testSecretSyncPolicy("", tt.clusterSpec))
+			}
+			if tt.namespaceSpec != nil {
+				objects = append(objects, testSecretSyncPolicy("test-namespace", tt.namespaceSpec))
+			}
+			policy, err := newSecretSyncPolicies(newTestSyncPolicyClient(objects...)).resolve(context.Background(), "test-namespace", defaults)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tt.expected, policy, cmp.AllowUnexported(syncPolicy{}))
+		})
+	}
+}
+
+func TestSecretSyncPoliciesCache(t *testing.T) {
+	ctx := context.Background()
+	client := newTestSyncPolicyClient()
+	policies := newSecretSyncPolicies(client)
+	now := time.Now()
+	policies.now = func() time.Time { return now }
+	defaults := syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicyReject}
+
+	policy, err := policies.resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, defaults, policy, cmp.AllowUnexported(syncPolicy{}))
+
+	_, err = client.Resource(secretSyncPolicyGVR).Namespace("test-namespace").Create(ctx, testSecretSyncPolicy("test-namespace", map[string]any{"retainPolicy": "Retain"}), metav1.CreateOptions{})
+	assert.NilError(t, err)
+
+	// The missing SecretSyncPolicy is remembered too
+	policy, err = policies.resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.Equal(t, RetainPolicyDelete, policy.retainPolicy)
+
+	now = now.Add(secretSyncPolicyTTL)
+	policy, err = policies.resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.Equal(t, RetainPolicyRetain, policy.retainPolicy)
+
+	// Without SECRET_SYNC_POLICY the settings of the controller apply
+	policy, err = (*secretSyncPolicies)(nil).resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, defaults, policy, cmp.AllowUnexported(syncPolicy{}))
+}
+
+func TestSecretSyncPoliciesWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newTestSyncPolicyClient(testSecretSyncPolicy("test-namespace", map[string]any{"retainPolicy": "Retain"}))
+	policies := newSecretSyncPolicies(client)
+	defaults := syncPolicy{retainPolicy: RetainPolicyDelete, oversizePolicy: oversizePolicyReject}
+	changed := make(chan string, 10)
+
+	assert.NilError(t, policies.watch(ctx, nil, func(namespace string) { changed <- namespace }))
+	policy, err := policies.resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.Equal(t, RetainPolicyRetain, policy.retainPolicy)
+
+	// An update applies right away, without waiting for the TTL
+	updated := testSecretSyncPolicy("test-namespace", map[string]any{"retainPolicy": "Delete"})
+	_, err = client.Resource(secretSyncPolicyGVR).Namespace("test-namespace").Update(ctx, updated, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "test-namespace", <-changed)
+	policy, err = policies.resolve(ctx, "test-namespace", defaults)
+	assert.NilError(t, err)
+	assert.Equal(t, RetainPolicyDelete, policy.retainPolicy)
+
+	// The ClusterSecretSyncPolicy applies to every namespace
+	_, err = client.Resource(clusterSecretSyncPolicyGVR).Create(ctx, testSecretSyncPolicy("", map[string]any{"oversizePolicy": "split"}), metav1.CreateOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, "", <-changed)
+
+	// The policies of other names aren't read
+	other := testSecretSyncPolicy("test-namespace", nil)
+	other.SetName("other")
+	_, err = client.Resource(secretSyncPolicyGVR).Namespace("test-namespace").Create(ctx, other, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	assert.NilError(t, client.Resource(secretSyncPolicyGVR).Namespace("test-namespace").Delete(ctx, secretSyncPolicyName, metav1.DeleteOptions{}))
+	assert.Equal(t, "test-namespace", <-changed)
+	assert.Equal(t, 0, len(changed))
+}
+
+func TestSyncPolicyResyncFilter(t *testing.T) {
+	workload := func(namespace string) *kueuev1beta1.Workload {
+		return &kueuev1beta1.Workload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-workload",
+				Namespace:       namespace,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run"}},
+			},
+			Status: kueuev1beta1.WorkloadStatus{ClusterName: ptr.To(testClusterName)},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		namespace      string
+		obj            any
+		expectedResync bool
+	}{
+		{name: "namespace of the policy", namespace: "test-namespace", obj: workload("test-namespace"), expectedResync: true},
+		{name: "other namespace", namespace: "test-namespace", obj: workload("other-namespace")},
+		{name: "cluster policy", obj: workload("other-namespace"), expectedResync: true},
+		{name: "not a Workload", obj: &corev1.Secret{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedResync, syncPolicyResyncFilter(workloadQueueFilter{}, tt.namespace)(tt.obj))
+		})
+	}
+}
+
+func TestSyncPolicyApplied(t *testing.T) {
+	ctx := context.Background()
+	r := &Reconciler{
+		logger:         zap.NewNop().Sugar(),
+		hubKubeClient:  fake.NewSimpleClientset(),
+		retainPolicy:   RetainPolicyDelete,
+		oversizePolicy: oversizePolicyReject,
+		syncPolicies: newSecretSyncPolicies(newTestSyncPolicyClient(
+			testSecretSyncPolicy("test-namespace", map[string]any{"retainPolicy": "Retain", "oversizePolicy": "split"}),
+			testSecretSyncPolicy("invalid-namespace", map[string]any{"oversizePolicy": "truncate"}),
+		)),
+	}
+
+	assert.Equal(t, oversizePolicySplit, r.namespaceOversizePolicy(ctx, "test-namespace"))
+	assert.Equal(t, oversizePolicyReject, r.namespaceOversizePolicy(ctx, "other-namespace"))
+	assert.Equal(t, oversizePolicyReject, r.namespaceOversizePolicy(ctx, "invalid-namespace"), "an invalid policy falls back to the controller's")
+
+	// The spoke cluster is never contacted with the retain policy of the namespace
+	now := metav1.Now()
+	workload := &kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+		Name:              "test-workload",
+		Namespace:         "test-namespace",
+		DeletionTimestamp: &now,
+		Finalizers:        []string{cleanupFinalizer},
+		Annotations:       map[string]string{syncedSecretsAnnotation: "unknown-cluster/test-namespace/test-secret"},
+	}}
+	assert.NilError(t, r.finalize(ctx, workload))
+
+	// The cleanup fails until the invalid policy is fixed
+	workload.Namespace = "invalid-namespace"
+	assert.ErrorContains(t, r.finalize(ctx, workload), `invalid SecretSyncPolicy invalid-namespace/default: unsupported oversize policy "truncate"`)
+}
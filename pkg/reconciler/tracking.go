@@ -0,0 +1,97 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// defaultUntrackedWorkloadSweepInterval is how often the Workloads missing the tracking labels
+// are labeled, when the Workload informer only watches the tracked ones.
+const defaultUntrackedWorkloadSweepInterval = 5 * time.Minute
+
+// untrackedWorkloadsSelector selects the Workloads the mutating webhook didn't stamp, e.g. the
+// ones created before it was installed or while it was unavailable.
+var untrackedWorkloadsSelector = "!" + trackedLabel
+
+// selectsTrackedWorkloads reports whether the Workload label selector requires the tracking label,
+// in which case the Workloads the webhook didn't stamp are never seen by the Workload informer.
+func selectsTrackedWorkloads(selector string) bool {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return false
+	}
+	requirements, _ := parsed.Requirements()
+	for _, requirement := range requirements {
+		if requirement.Key() == trackedLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// runUntrackedWorkloadSweeper periodically stamps the tracking labels on the untracked Workloads
+// of the namespaces until the context is done.
+func (r *Reconciler) runUntrackedWorkloadSweeper(ctx context.Context, namespaces []string, fieldSelector string, interval time.Duration) {
+	wait.JitterUntilWithContext(ctx, func(ctx context.Context) {
+		_, _ = r.labelUntrackedWorkloads(ctx, namespaces, fieldSelector)
+	}, interval, 0.1, true)
+}
+
+// labelUntrackedWorkloads stamps the tracking labels of the mutating webhook on the PipelineRun
+// owned Workloads of the namespaces missing them, every namespace when empty, so the Workload
+// informer narrowed to the tracked ones picks them up. It returns how many were labeled and the
+// errors of the ones which couldn't be, which are logged too.
+func (r *Reconciler) labelUntrackedWorkloads(ctx context.Context, namespaces []string, fieldSelector string) (int, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	labeled := 0
+	var errs []error
+	for _, namespace := range namespaces {
+		// The watch cache of the API server is recent enough, the next sweep catches up
+		workloads, err := r.kueueClient.KueueV1beta1().Workloads(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector:   untrackedWorkloadsSelector,
+			FieldSelector:   fieldSelector,
+			ResourceVersion: "0",
+		})
+		if err != nil {
+			r.logger.Errorf("error listing the untracked Workloads: %v", err)
+			errs = append(errs, fmt.Errorf("could not list workloads: %w", err))
+			continue
+		}
+
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			stamped := r.trackingLabels(ctx, workload)
+			if stamped == nil {
+				continue
+			}
+			patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": stamped}})
+			if err != nil {
+				return labeled, fmt.Errorf("could not build the label patch of workload %s/%s: %w", workload.Namespace, workload.Name, err)
+			}
+			_, err = r.kueueClient.KueueV1beta1().Workloads(workload.Namespace).Patch(ctx, workload.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				r.logger.Errorf("error labeling the untracked Workload %s/%s: %v", workload.Namespace, workload.Name, err)
+				errs = append(errs, fmt.Errorf("could not label workload %s/%s: %w", workload.Namespace, workload.Name, err))
+				continue
+			}
+			r.logger.Infof("Stamped the tracking labels on the untracked Workload %s/%s", workload.Namespace, workload.Name)
+			labeled++
+		}
+	}
+	return labeled, stderrors.Join(errs...)
+}
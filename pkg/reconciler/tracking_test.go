@@ -0,0 +1,84 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+func TestSelectsTrackedWorkloads(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected bool
+	}{
+		{selector: ""},
+		{selector: "kueue.x-k8s.io/queue-name=default"},
+		{selector: trackedLabel + "=true", expected: true},
+		{selector: "team=a," + trackedLabel, expected: true},
+		{selector: "invalid selector ("},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			assert.Equal(t, tt.expected, selectsTrackedWorkloads(tt.selector))
+		})
+	}
+}
+
+func TestLabelUntrackedWorkloads(t *testing.T) {
+	pipelineRun := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "tekton.dev/v1",
+		"kind":       "PipelineRun",
+		"metadata": map[string]any{
+			"name":        "test-pipeline-run",
+			"namespace":   "test-namespace",
+			"annotations": map[string]any{gitAuthSecret: "pac-gitauth-abcde"},
+		},
+	}}
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pipelineRunGVR: "PipelineRunList"}, pipelineRun)
+	kueueClient := kueuefake.NewSimpleClientset(
+		dispatchedWorkload(nil),
+		dispatchedWorkload(func(workload *kueuev1beta1.Workload) {
+			workload.Name = "tracked"
+			workload.Labels = map[string]string{trackedLabel: "true"}
+		}),
+		&kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{
+			Name:            "job",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: "test-job", Controller: ptr.To(true)}},
+		}},
+	)
+	r := &Reconciler{logger: zap.NewNop().Sugar(), kueueClient: kueueClient, hubDynamicClient: hubDynamicClient}
+
+	labeled, err := r.labelUntrackedWorkloads(context.Background(), []string{"test-namespace"}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, labeled)
+
+	workload, err := kueueClient.KueueV1beta1().Workloads("test-namespace").Get(context.Background(), "test-workload", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]string{
+		trackedLabel:         "true",
+		sourceNamespaceLabel: "test-namespace",
+		gitAuthSecretLabel:   "pac-gitauth-abcde",
+	}, workload.Labels)
+	// The other Workloads are left alone
+	job, err := kueueClient.KueueV1beta1().Workloads("test-namespace").Get(context.Background(), "job", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, job.Labels == nil)
+
+	// The labeled Workload isn't listed again
+	labeled, err = r.labelUntrackedWorkloads(context.Background(), nil, "")
+	assert.NilError(t, err)
+	assert.Equal(t, 0, labeled)
+}
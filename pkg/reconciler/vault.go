@@ -0,0 +1,181 @@
+package reconciler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// vaultPathAnnotation on a PipelineRun overrides the Vault path its git credentials are read from.
+	vaultPathAnnotation = syncerGroupName + "/vault-path"
+
+	defaultVaultAuthMount    = "kubernetes"
+	defaultVaultKVMount      = "secret"
+	defaultVaultPathTemplate = "{namespace}/{name}"
+
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	vaultRequestTimeout     = 10 * time.Second
+)
+
+// vaultOptions configures the Vault secret source.
+type vaultOptions struct {
+	// address of the Vault server, e.g. https://vault.vault.svc:8200
+	address string
+	// token authenticates to Vault directly. When empty, the controller logs in with its
+	// service account through the Kubernetes auth method at authMount with role.
+	token     string
+	role      string
+	authMount string
+	// kvMount is the mount of the KV version 2 secrets engine holding the credentials
+	kvMount string
+	// pathTemplate derives the path of a PipelineRun's credentials in kvMount, {namespace}
+	// and {name} are replaced by the PipelineRun namespace and the git-auth secret name.
+	pathTemplate string
+}
+
+// vaultSecretSource reads the git credentials from a Vault KV version 2 secrets engine. The
+// spoke copies are owned by the spoke PipelineRun, so they never outlive the run.
+type vaultSecretSource struct {
+	opts   vaultOptions
+	client *http.Client
+	// tokenPath is overridden in tests
+	tokenPath string
+	// now is overridden in tests
+	now func() time.Time
+
+	mu          sync.Mutex
+	loginToken  string
+	loginExpiry time.Time
+}
+
+func newVaultSecretSource(opts vaultOptions) *vaultSecretSource {
+	return &vaultSecretSource{
+		opts:      opts,
+		client:    &http.Client{Timeout: vaultRequestTimeout},
+		tokenPath: serviceAccountTokenPath,
+		now:       time.Now,
+	}
+}
+
+func (*vaultSecretSource) ephemeral() bool { return true }
+
+// path returns the path of the PipelineRun's credentials, relative to the KV mount. The
+// vaultPathAnnotation only points at the paths of the namespace of the PipelineRun.
+func (s *vaultSecretSource) path(pipelineRun *v1.PipelineRun, secretName string) (string, error) {
+	path, err := secretReference(s.opts.pathTemplate, vaultPathAnnotation, pipelineRun, secretName)
+	return strings.Trim(path, "/"), err
+}
+
+func (s *vaultSecretSource) fetch(ctx context.Context, pipelineRun *v1.PipelineRun, secretName string) (*corev1.Secret, error) {
+	token, err := s.vaultToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not authenticate to vault: %w", err)
+	}
+
+	path, err := s.path(pipelineRun, secretName)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/v1/"+s.opts.kvMount+"/data/"+path, token, nil, &response); err != nil {
+		return nil, fmt.Errorf("could not read vault secret %s/%s: %w", s.opts.kvMount, path, err)
+	}
+	if len(response.Data.Data) == 0 {
+		return nil, fmt.Errorf("vault secret %s/%s has no data", s.opts.kvMount, path)
+	}
+
+	data, err := secretDataFromMap(response.Data.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode vault secret %s/%s: %w", s.opts.kvMount, path, err)
+	}
+	return ephemeralSecret(pipelineRun, secretName, vaultPathAnnotation, s.opts.kvMount+"/"+path, data), nil
+}
+
+// vaultToken returns the configured token, or logs in with the Kubernetes auth method. Login
+// tokens are reused until shortly before their lease expires.
+func (s *vaultSecretSource) vaultToken(ctx context.Context) (string, error) {
+	if s.opts.token != "" {
+		return s.opts.token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loginToken != "" && s.now().Before(s.loginExpiry) {
+		return s.loginToken, nil
+	}
+
+	jwt, err := os.ReadFile(s.tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read service account token: %w", err)
+	}
+	login := map[string]string{"role": s.opts.role, "jwt": strings.TrimSpace(string(jwt))}
+	var response struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/v1/auth/"+s.opts.authMount+"/login", "", login, &response); err != nil {
+		return "", err
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login with role %s returned no token", s.opts.role)
+	}
+
+	// Renew by logging in again once 80% of the lease is used
+	lease := time.Duration(response.Auth.LeaseDuration) * time.Second
+	s.loginToken = response.Auth.ClientToken
+	s.loginExpiry = s.now().Add(lease * 4 / 5)
+	return s.loginToken, nil
+}
+
+// do sends a request to the Vault API and decodes its JSON answer into out.
+func (s *vaultSecretSource) do(ctx context.Context, method, path, token string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.opts.address, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Vault error bodies only carry error messages, never secret data
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return fmt.Errorf("vault answered %s: %s", resp.Status, strings.Join(vaultErr.Errors, ", "))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,376 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// admissionWebhookPath is where the API server posts the AdmissionReviews of hub PipelineRuns.
+	admissionWebhookPath = "/validate/pipelineruns"
+	// mutatingWebhookPath is where the API server posts the AdmissionReviews of new Workloads.
+	mutatingWebhookPath = "/mutate/workloads"
+
+	// maxAdmissionReviewSize bounds the AdmissionReview posted by the API server, the largest
+	// object the API server stores is 1.5MiB and the review may hold it twice.
+	maxAdmissionReviewSize = 4 << 20
+)
+
+// Labels stamped by the mutating webhook on the Workloads owned by a PipelineRun, so
+// WORKLOAD_LABEL_SELECTOR can narrow the informer to them.
+const (
+	// trackedLabel marks the Workloads owned by a PipelineRun.
+	trackedLabel = syncerGroupName + "/tracked"
+	// sourceNamespaceLabel holds the namespace of the PipelineRun the secrets are read from.
+	sourceNamespaceLabel = syncerGroupName + "/source-namespace"
+	// gitAuthSecretLabel holds the git-auth secret of the PipelineRun, when it is a valid label value.
+	gitAuthSecretLabel = syncerGroupName + "/git-auth-secret"
+)
+
+// secretNotAllowedReason is the reason of the Warning event recorded on the Workloads whose
+// git-auth secret doesn't match ADMISSION_WEBHOOK_SECRET_SELECTOR.
+const secretNotAllowedReason = "SecretNotAllowed"
+
+// pipelineRunGVR is the Tekton PipelineRun, read from the hub by the mutating webhook.
+var pipelineRunGVR = schema.GroupVersionResource{Group: "tekton.dev", Version: "v1", Resource: "pipelineruns"}
+
+// Actions taken on a hub PipelineRun referencing a missing or disallowed secret.
+const (
+	admissionActionDeny = "deny"
+	admissionActionWarn = "warn"
+)
+
+// admissionWebhookOptions configures the webhooks validating the sync annotations of the hub
+// PipelineRuns and stamping the tracking labels on Workloads.
+type admissionWebhookOptions struct {
+	// port serving the webhook, 0 disables it
+	port int
+	// certFile and keyFile hold the TLS serving certificate
+	certFile string
+	keyFile  string
+	// action is taken on invalid PipelineRuns, deny rejects them and warn only returns warnings
+	action string
+	// secretSelector is matched by the secrets the PipelineRuns may reference, nil allows all
+	secretSelector labels.Selector
+}
+
+// parseAdmissionAction parses the action on invalid PipelineRuns, an empty value resolves to admissionActionDeny.
+func parseAdmissionAction(value string) (string, error) {
+	switch value {
+	case "":
+		return admissionActionDeny, nil
+	case admissionActionDeny, admissionActionWarn:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported action %q, must be one of %s or %s", value, admissionActionDeny, admissionActionWarn)
+	}
+}
+
+// admissionHandler returns the HTTP handler validating hub PipelineRuns before they are
+// dispatched, and stamping the tracking labels on new Workloads.
+func (r *Reconciler) admissionHandler(opts admissionWebhookOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST "+admissionWebhookPath, reviewHandler(func(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		return r.admit(ctx, req, opts)
+	}))
+	mux.Handle("POST "+mutatingWebhookPath, reviewHandler(r.mutateWorkload))
+	return mux
+}
+
+// reviewHandler answers the AdmissionReviews posted by the API server with the response of review.
+func reviewHandler(review func(context.Context, *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		admissionReview := &admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(io.LimitReader(req.Body, maxAdmissionReviewSize)).Decode(admissionReview); err != nil || admissionReview.Request == nil {
+			http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		admissionReview.Response = review(req.Context(), admissionReview.Request)
+		admissionReview.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(admissionReview)
+	})
+}
+
+// admit reviews a single PipelineRun. PipelineRuns which can't be decoded are left to the
+// validation of Tekton.
+func (r *Reconciler) admit(ctx context.Context, req *admissionv1.AdmissionRequest, opts admissionWebhookOptions) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	pipelineRun := &v1.PipelineRun{}
+	if err := json.Unmarshal(req.Object.Raw, pipelineRun); err != nil {
+		r.logger.Debugf("could not decode PipelineRun %s/%s under admission: %v", req.Namespace, req.Name, err)
+		return response
+	}
+	if pipelineRun.Namespace == "" {
+		pipelineRun.Namespace = req.Namespace
+	}
+
+	violations, err := r.reviewPipelineRun(ctx, pipelineRun, opts.secretSelector)
+	if err != nil {
+		// Never block PipelineRuns on the controller's own failures
+		r.logger.Errorf("error reviewing PipelineRun %s/%s: %v", pipelineRun.Namespace, pipelineRun.Name, err)
+		response.Warnings = []string{fmt.Sprintf("secret-syncer could not verify the sync annotations: %v", err)}
+		return response
+	}
+	if len(violations) == 0 {
+		return response
+	}
+
+	if opts.action == admissionActionWarn {
+		response.Warnings = violations
+		return response
+	}
+	message := violations[0]
+	for _, violation := range violations[1:] {
+		message += "; " + violation
+	}
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Reason:  metav1.StatusReasonInvalid,
+		Code:    http.StatusUnprocessableEntity,
+		Message: message,
+	}
+	return response
+}
+
+// reviewPipelineRun returns the problems with the sync annotations of the PipelineRun, which
+// would only surface once it is dispatched to a spoke cluster.
+func (r *Reconciler) reviewPipelineRun(ctx context.Context, pipelineRun *v1.PipelineRun, secretSelector labels.Selector) ([]string, error) {
+	var violations []string
+	annotations := pipelineRun.GetAnnotations()
+
+	if value, ok := annotations[providerSecretAnnotation]; ok {
+		if _, err := strconv.ParseBool(value); err != nil {
+			violations = append(violations, fmt.Sprintf("annotation %s must be true or false, got %q", providerSecretAnnotation, value))
+		}
+	}
+
+	// Only the kubernetes secret source reads the git-auth secret from the hub, the secrets of
+	// the other annotations are always hub secrets
+	var names, secretAnnotations []string
+	if name := annotations[gitAuthSecret]; name != "" && r.secretSource == nil {
+		names, secretAnnotations = append(names, name), append(secretAnnotations, gitAuthSecret)
+	}
+	if r.pipelineRunSecretSources[pipelineRunSecretsAnnotation] {
+		for _, name := range strings.Split(annotations[syncSecretsAnnotation], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names, secretAnnotations = append(names, name), append(secretAnnotations, syncSecretsAnnotation)
+			}
+		}
+	}
+	if name := annotations[gitCASecretAnnotation]; name != "" {
+		names, secretAnnotations = append(names, name), append(secretAnnotations, gitCASecretAnnotation)
+	}
+	for i, name := range names {
+		violation, err := r.reviewHubSecret(ctx, pipelineRun.Namespace, name, secretAnnotations[i], secretSelector)
+		if err != nil {
+			return nil, err
+		}
+		if violation != "" {
+			violations = append(violations, violation)
+		}
+	}
+
+	if r.pipelineRunConfigMapSources[pipelineRunConfigMapsAnnotation] {
+		for _, name := range strings.Split(annotations[syncConfigMapsAnnotation], ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			_, err := r.hubKubeClient.CoreV1().ConfigMaps(pipelineRun.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				violations = append(violations, fmt.Sprintf("configmap %s/%s named by annotation %s does not exist", pipelineRun.Namespace, name, syncConfigMapsAnnotation))
+			} else if err != nil {
+				return nil, fmt.Errorf("could not get configmap %s/%s: %w", pipelineRun.Namespace, name, err)
+			}
+		}
+	}
+	return violations, nil
+}
+
+// reviewHubSecret returns the problem with the hub secret named by the annotation, empty when it
+// exists and matches the secret selector.
+func (r *Reconciler) reviewHubSecret(ctx context.Context, namespace, name, annotation string, secretSelector labels.Selector) (string, error) {
+	secret, err := r.hubKubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Sprintf("secret %s/%s named by annotation %s does not exist", namespace, name, annotation), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get secret %s/%s: %w", namespace, name, err)
+	}
+	if secretSelector != nil && !secretSelector.Matches(labels.Set(secret.GetLabels())) {
+		return fmt.Sprintf("secret %s/%s named by annotation %s is not allowed, it must match %s", namespace, name, annotation, secretSelector), nil
+	}
+	return "", nil
+}
+
+// mutateWorkload stamps the tracking labels on a Workload owned by a PipelineRun. Other Workloads,
+// and the ones which can't be decoded, are admitted unchanged.
+func (r *Reconciler) mutateWorkload(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	workload := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+		r.logger.Debugf("could not decode Workload %s/%s under admission: %v", req.Namespace, req.Name, err)
+		return response
+	}
+	if workload.Namespace == "" {
+		workload.Namespace = req.Namespace
+	}
+	stamped := r.trackingLabels(ctx, workload)
+	if stamped == nil {
+		return response
+	}
+
+	patch, err := labelsPatch(workload.GetLabels(), stamped)
+	if err != nil {
+		r.logger.Errorf("error building the label patch of Workload %s/%s: %v", workload.Namespace, workload.Name, err)
+		return response
+	}
+	if patch != nil {
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch, response.PatchType = patch, &patchType
+	}
+	return response
+}
+
+// disallowedSecretError returns the error of syncing a hub git-auth secret which doesn't match
+// the secret selector of the admission webhook, nil when it does or there is no selector. The
+// webhook fails open and only sees the PipelineRuns of Pipelines as Code, so the selector is
+// enforced when syncing too. The secrets of the other sources aren't hub Secrets, they are allowed.
+func (r *Reconciler) disallowedSecretError(secret *corev1.Secret) error {
+	if r.secretSource != nil {
+		return nil
+	}
+	return r.disallowedHubSecretError(secret, "annotation "+gitAuthSecret)
+}
+
+// disallowedHubSecretError returns the error of syncing a hub secret named by the reference, e.g.
+// an annotation of the PipelineRun, which doesn't match the secret selector of the admission
+// webhook, nil when it does or there is no selector.
+func (r *Reconciler) disallowedHubSecretError(secret *corev1.Secret, reference string) error {
+	if r.allowedSecrets == nil || r.allowedSecrets.Matches(labels.Set(secret.GetLabels())) {
+		return nil
+	}
+	return syncer.Classify(fmt.Errorf("secret %s/%s named by %s is not allowed, it must match %s", secret.Namespace, secret.Name, reference, r.allowedSecrets), ErrSecretNotAllowed)
+}
+
+// trackingLabels returns the tracking labels of a Workload owned by a PipelineRun, nil for the
+// other Workloads and the ones whose owner can't be resolved.
+func (r *Reconciler) trackingLabels(ctx context.Context, workload metav1.Object) map[string]string {
+	owner, err := r.pipelineRunOwner(ctx, workload)
+	if err != nil {
+		// The Workload is left untracked, the reconciler resolves its owner again
+		r.logger.Errorf("error resolving the owner of Workload %s/%s: %v", workload.GetNamespace(), workload.GetName(), err)
+		return nil
+	}
+	if owner == nil || owner.Kind != "PipelineRun" {
+		return nil
+	}
+
+	stamped := map[string]string{
+		trackedLabel:         "true",
+		sourceNamespaceLabel: workload.GetNamespace(),
+	}
+	secretName, err := r.pipelineRunGitAuthSecret(ctx, workload.GetNamespace(), owner.Name)
+	if err != nil {
+		// The Workload is still tracked, the reconciler reads the secret from the spoke PipelineRun
+		r.logger.Errorf("error getting the git-auth secret of PipelineRun %s/%s: %v", workload.GetNamespace(), owner.Name, err)
+	}
+	if secretName != "" && len(validation.IsValidLabelValue(secretName)) == 0 {
+		stamped[gitAuthSecretLabel] = secretName
+	}
+	return stamped
+}
+
+// pipelineRunGitAuthSecret returns the git-auth secret named by the hub PipelineRun, empty when
+// the PipelineRun names none or doesn't exist.
+func (r *Reconciler) pipelineRunGitAuthSecret(ctx context.Context, namespace, name string) (string, error) {
+	pipelineRun, err := r.hubPipelineRun(ctx, namespace, name)
+	if err != nil || pipelineRun == nil {
+		return "", err
+	}
+	return pipelineRun.GetAnnotations()[gitAuthSecret], nil
+}
+
+// hubPipelineRun returns the metadata of the hub PipelineRun, nil when it doesn't exist.
+func (r *Reconciler) hubPipelineRun(ctx context.Context, namespace, name string) (metav1.Object, error) {
+	pipelineRun, err := r.hubDynamicClient.Resource(pipelineRunGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get PipelineRun %s/%s: %w", namespace, name, err)
+	}
+	return pipelineRun, nil
+}
+
+// labelsPatch returns the JSON patch setting the stamped labels, nil when they are all set already.
+func labelsPatch(existing, stamped map[string]string) ([]byte, error) {
+	if existing == nil {
+		return json.Marshal([]map[string]any{{"op": "add", "path": "/metadata/labels", "value": stamped}})
+	}
+
+	keys := make([]string, 0, len(stamped))
+	for key, value := range stamped {
+		if existing[key] != value {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Strings(keys)
+	operations := make([]map[string]any, 0, len(keys))
+	for _, key := range keys {
+		path := "/metadata/labels/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+		operations = append(operations, map[string]any{"op": "add", "path": path, "value": stamped[key]})
+	}
+	return json.Marshal(operations)
+}
+
+// serveAdmissionWebhook serves the webhooks validating hub PipelineRuns and stamping Workloads
+// until the context is done.
+func (r *Reconciler) serveAdmissionWebhook(ctx context.Context, logger *zap.SugaredLogger, opts admissionWebhookOptions) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.port),
+		Handler:           r.admissionHandler(opts),
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Serving the PipelineRun and Workload admission webhooks on port %d", opts.port)
+	if err := server.ListenAndServeTLS(opts.certFile, opts.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("admission webhook server failed: %v", err)
+	}
+}
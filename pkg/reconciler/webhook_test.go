@@ -0,0 +1,366 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+func TestParseAdmissionAction(t *testing.T) {
+	for value, expected := range map[string]string{"": admissionActionDeny, "deny": admissionActionDeny, "warn": admissionActionWarn} {
+		action, err := parseAdmissionAction(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, expected, action)
+	}
+
+	_, err := parseAdmissionAction("audit")
+	assert.ErrorContains(t, err, `unsupported action "audit"`)
+}
+
+func TestAdmissionWebhook(t *testing.T) {
+	hubKubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pac-gitauth-abcde", Namespace: "test-namespace", Labels: map[string]string{"app.kubernetes.io/managed-by": "pipelinesascode.tekton.dev"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin-token", Namespace: "test-namespace"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "gitconfig", Namespace: "test-namespace"}},
+	)
+	hubKubeClient.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.GetAction).GetName() == "unreachable" {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	pacSecrets, err := labels.Parse("app.kubernetes.io/managed-by=pipelinesascode.tekton.dev")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name             string
+		action           string
+		secretSource     secretSource
+		disabledSources  bool
+		annotations      map[string]string
+		object           []byte
+		expectedAllowed  bool
+		expectedMessage  string
+		expectedWarnings []string
+	}{
+		{
+			name:            "no sync annotations",
+			expectedAllowed: true,
+		},
+		{
+			name:            "existing allowed secret",
+			annotations:     map[string]string{gitAuthSecret: "pac-gitauth-abcde", providerSecretAnnotation: "true"},
+			expectedAllowed: true,
+		},
+		{
+			name:            "missing secret",
+			annotations:     map[string]string{gitAuthSecret: "missing"},
+			expectedMessage: "secret test-namespace/missing named by annotation pipelinesascode.tekton.dev/git-auth-secret does not exist",
+		},
+		{
+			name:            "disallowed secret",
+			annotations:     map[string]string{gitAuthSecret: "cluster-admin-token"},
+			expectedMessage: "secret test-namespace/cluster-admin-token named by annotation pipelinesascode.tekton.dev/git-auth-secret is not allowed, it must match app.kubernetes.io/managed-by=pipelinesascode.tekton.dev",
+		},
+		{
+			name:            "invalid provider secret annotation",
+			annotations:     map[string]string{gitAuthSecret: "missing", providerSecretAnnotation: "please"},
+			expectedMessage: `annotation secret-syncer.tekton.dev/sync-provider-secret must be true or false, got "please"; secret test-namespace/missing named by annotation pipelinesascode.tekton.dev/git-auth-secret does not exist`,
+		},
+		{
+			name:             "missing secret with the warn action",
+			action:           admissionActionWarn,
+			annotations:      map[string]string{gitAuthSecret: "missing"},
+			expectedAllowed:  true,
+			expectedWarnings: []string{"secret test-namespace/missing named by annotation pipelinesascode.tekton.dev/git-auth-secret does not exist"},
+		},
+		{
+			name:            "secret read from an external source",
+			secretSource:    newVaultSecretSource(vaultOptions{}),
+			annotations:     map[string]string{gitAuthSecret: "missing"},
+			expectedAllowed: true,
+		},
+		{
+			name:            "allowed sync annotations",
+			annotations:     map[string]string{syncSecretsAnnotation: "pac-gitauth-abcde", syncConfigMapsAnnotation: "gitconfig", gitCASecretAnnotation: "pac-gitauth-abcde"},
+			expectedAllowed: true,
+		},
+		{
+			name:            "missing and disallowed sync secrets",
+			annotations:     map[string]string{syncSecretsAnnotation: "pac-gitauth-abcde, missing, cluster-admin-token"},
+			expectedMessage: "secret test-namespace/missing named by annotation secret-syncer.tekton.dev/sync-secrets does not exist; secret test-namespace/cluster-admin-token named by annotation secret-syncer.tekton.dev/sync-secrets is not allowed, it must match app.kubernetes.io/managed-by=pipelinesascode.tekton.dev",
+		},
+		{
+			name:            "missing configmap",
+			annotations:     map[string]string{syncConfigMapsAnnotation: "gitconfig,missing"},
+			expectedMessage: "configmap test-namespace/missing named by annotation secret-syncer.tekton.dev/configmaps does not exist",
+		},
+		{
+			name:            "disallowed git CA secret",
+			annotations:     map[string]string{gitCASecretAnnotation: "cluster-admin-token"},
+			expectedMessage: "secret test-namespace/cluster-admin-token named by annotation secret-syncer.tekton.dev/git-ca-secret is not allowed, it must match app.kubernetes.io/managed-by=pipelinesascode.tekton.dev",
+		},
+		{
+			name:            "hub secrets with an external source",
+			secretSource:    newVaultSecretSource(vaultOptions{}),
+			annotations:     map[string]string{gitAuthSecret: "missing", syncSecretsAnnotation: "missing"},
+			expectedMessage: "secret test-namespace/missing named by annotation secret-syncer.tekton.dev/sync-secrets does not exist",
+		},
+		{
+			name:            "disabled annotation sources",
+			disabledSources: true,
+			annotations:     map[string]string{syncSecretsAnnotation: "missing", syncConfigMapsAnnotation: "missing"},
+			expectedAllowed: true,
+		},
+		{
+			name:             "hub API failure",
+			annotations:      map[string]string{gitAuthSecret: "unreachable"},
+			expectedAllowed:  true,
+			expectedWarnings: []string{"secret-syncer could not verify the sync annotations: could not get secret test-namespace/unreachable: connection refused"},
+		},
+		{
+			name:            "undecodable PipelineRun",
+			object:          []byte(`{"spec": "not an object"}`),
+			expectedAllowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{
+				logger:        zap.NewNop().Sugar(),
+				hubKubeClient: hubKubeClient,
+				secretSource:  tt.secretSource,
+			}
+			if !tt.disabledSources {
+				r.pipelineRunSecretSources = map[string]bool{pipelineRunSecretsAnnotation: true}
+				r.pipelineRunConfigMapSources = map[string]bool{pipelineRunConfigMapsAnnotation: true}
+			}
+			action := tt.action
+			if action == "" {
+				action = admissionActionDeny
+			}
+			server := httptest.NewServer(r.admissionHandler(admissionWebhookOptions{action: action, secretSelector: pacSecrets}))
+			defer server.Close()
+
+			object := tt.object
+			if object == nil {
+				object, err = json.Marshal(&v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Annotations: tt.annotations}})
+				assert.NilError(t, err)
+			}
+			body, err := json.Marshal(&admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "review-uid",
+					Namespace: "test-namespace",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: object},
+				},
+			})
+			assert.NilError(t, err)
+
+			resp, err := http.Post(server.URL+admissionWebhookPath, "application/json", strings.NewReader(string(body)))
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			review := &admissionv1.AdmissionReview{}
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(review))
+			assert.Equal(t, "admission.k8s.io/v1", review.APIVersion)
+			assert.Assert(t, review.Request == nil)
+			assert.Equal(t, "review-uid", string(review.Response.UID))
+			assert.Equal(t, tt.expectedAllowed, review.Response.Allowed)
+			assert.DeepEqual(t, tt.expectedWarnings, review.Response.Warnings)
+			if tt.expectedAllowed {
+				assert.Assert(t, review.Response.Result == nil)
+				return
+			}
+			assert.Equal(t, int32(http.StatusUnprocessableEntity), review.Response.Result.Code)
+			assert.Equal(t, tt.expectedMessage, review.Response.Result.Message)
+		})
+	}
+}
+
+func TestAdmissionWebhookInvalidReview(t *testing.T) {
+	r := &Reconciler{logger: zap.NewNop().Sugar()}
+	server := httptest.NewServer(r.admissionHandler(admissionWebhookOptions{action: admissionActionDeny}))
+	defer server.Close()
+
+	for _, body := range []string{"not json", "{}"} {
+		resp, err := http.Post(server.URL+admissionWebhookPath, "application/json", strings.NewReader(body))
+		assert.NilError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+}
+
+func TestMutateWorkload(t *testing.T) {
+	pipelineRun := func(name, secretName string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "tekton.dev/v1",
+			"kind":       "PipelineRun",
+			"metadata": map[string]any{
+				"name":        name,
+				"namespace":   "test-namespace",
+				"annotations": map[string]any{gitAuthSecret: secretName},
+			},
+		}}
+	}
+	hubDynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pipelineRunGVR: "PipelineRunList"},
+		pipelineRun("test-pipeline-run", "pac-gitauth-abcde"),
+		pipelineRun("long-secret-run", strings.Repeat("a", 64)),
+	)
+	owner := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+	}
+
+	tests := []struct {
+		name            string
+		labels          map[string]string
+		owners          []metav1.OwnerReference
+		object          []byte
+		expectedPatch   []map[string]any
+		expectedNoPatch bool
+	}{
+		{
+			name:   "owned by a PipelineRun",
+			owners: owner("PipelineRun", "test-pipeline-run"),
+			expectedPatch: []map[string]any{{"op": "add", "path": "/metadata/labels", "value": map[string]any{
+				trackedLabel:         "true",
+				sourceNamespaceLabel: "test-namespace",
+				gitAuthSecretLabel:   "pac-gitauth-abcde",
+			}}},
+		},
+		{
+			name:   "with existing labels",
+			labels: map[string]string{"kueue.x-k8s.io/job-uid": "uid", trackedLabel: "true"},
+			owners: owner("PipelineRun", "test-pipeline-run"),
+			expectedPatch: []map[string]any{
+				{"op": "add", "path": "/metadata/labels/secret-syncer.tekton.dev~1git-auth-secret", "value": "pac-gitauth-abcde"},
+				{"op": "add", "path": "/metadata/labels/secret-syncer.tekton.dev~1source-namespace", "value": "test-namespace"},
+			},
+		},
+		{
+			name:            "already stamped",
+			labels:          map[string]string{trackedLabel: "true", sourceNamespaceLabel: "test-namespace", gitAuthSecretLabel: "pac-gitauth-abcde"},
+			owners:          owner("PipelineRun", "test-pipeline-run"),
+			expectedNoPatch: true,
+		},
+		{
+			name:   "secret name too long for a label",
+			owners: owner("PipelineRun", "long-secret-run"),
+			expectedPatch: []map[string]any{{"op": "add", "path": "/metadata/labels", "value": map[string]any{
+				trackedLabel:         "true",
+				sourceNamespaceLabel: "test-namespace",
+			}}},
+		},
+		{
+			name:   "missing hub PipelineRun",
+			owners: owner("PipelineRun", "missing"),
+			expectedPatch: []map[string]any{{"op": "add", "path": "/metadata/labels", "value": map[string]any{
+				trackedLabel:         "true",
+				sourceNamespaceLabel: "test-namespace",
+			}}},
+		},
+		{
+			name:            "owned by a Job",
+			owners:          owner("Job", "test-job"),
+			expectedNoPatch: true,
+		},
+		{
+			name:            "not owned",
+			expectedNoPatch: true,
+		},
+		{
+			name:            "undecodable Workload",
+			object:          []byte(`{"metadata": "not an object"}`),
+			expectedNoPatch: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{
+				logger:           zap.NewNop().Sugar(),
+				hubDynamicClient: hubDynamicClient,
+			}
+			server := httptest.NewServer(r.admissionHandler(admissionWebhookOptions{action: admissionActionDeny}))
+			defer server.Close()
+
+			object := tt.object
+			if object == nil {
+				var err error
+				object, err = json.Marshal(&kueuev1beta1.Workload{ObjectMeta: metav1.ObjectMeta{Name: "test-workload", Labels: tt.labels, OwnerReferences: tt.owners}})
+				assert.NilError(t, err)
+			}
+			body, err := json.Marshal(&admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "review-uid",
+					Namespace: "test-namespace",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: object},
+				},
+			})
+			assert.NilError(t, err)
+
+			resp, err := http.Post(server.URL+mutatingWebhookPath, "application/json", strings.NewReader(string(body)))
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			review := &admissionv1.AdmissionReview{}
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(review))
+			assert.Equal(t, "review-uid", string(review.Response.UID))
+			assert.Assert(t, review.Response.Allowed)
+			if tt.expectedNoPatch {
+				assert.Assert(t, review.Response.Patch == nil)
+				assert.Assert(t, review.Response.PatchType == nil)
+				return
+			}
+			assert.Equal(t, admissionv1.PatchTypeJSONPatch, *review.Response.PatchType)
+			var patch []map[string]any
+			assert.NilError(t, json.Unmarshal(review.Response.Patch, &patch))
+			assert.DeepEqual(t, tt.expectedPatch, patch)
+		})
+	}
+}
+
+func TestDisallowedSecretError(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"app.kubernetes.io/managed-by": "pipelinesascode.tekton.dev"})
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"}}
+
+	// Every secret is allowed without a selector
+	assert.NilError(t, (&Reconciler{}).disallowedSecretError(secret))
+	// And with another secret source
+	assert.NilError(t, (&Reconciler{allowedSecrets: selector, secretSource: hubSecretSource{}}).disallowedSecretError(secret))
+
+	r := &Reconciler{allowedSecrets: selector}
+	err := r.disallowedSecretError(secret)
+	assert.Error(t, err, "secret test-namespace/git-auth named by annotation pipelinesascode.tekton.dev/git-auth-secret is not allowed, it must match app.kubernetes.io/managed-by=pipelinesascode.tekton.dev")
+	assert.Assert(t, errors.Is(err, ErrSecretNotAllowed))
+	assert.Equal(t, secretNotAllowedReason, rejectionReason(err))
+
+	secret.Labels = map[string]string{"app.kubernetes.io/managed-by": "pipelinesascode.tekton.dev"}
+	assert.NilError(t, r.disallowedSecretError(secret))
+}
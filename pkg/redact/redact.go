@@ -0,0 +1,143 @@
+// Package redact scrubs the credential material from the logs of the secret-syncer binaries.
+// Whatever the syncer reads, secret data, kubeconfigs, tokens, may end up in an error message,
+// so every logger of the binaries goes through Logger.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// redacted replaces the credential material scrubbed from the logs.
+const redacted = "[REDACTED]"
+
+// secretPatterns match the credential shaped values of log messages and fields, with the
+// replacement keeping their non secret prefix.
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// PEM private keys, e.g. the client key of a kubeconfig or an ssh-privatekey
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`), redacted},
+	// Byte slices formatted with %v, e.g. the data of a secret
+	{regexp.MustCompile(`\[(?:\d{1,3} )+\d{1,3}\]`), redacted},
+	// Credential keys of kubeconfigs, JSON or YAML documents and query strings
+	{regexp.MustCompile(`(?i)("?\b(?:client-key-data|token|id-token|refresh-token|access-token|password|client-secret|api-key)"?\s*[:=]\s*)"?(?:\[REDACTED\]|[^\s",}&\[\]]+)"?`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}" + redacted},
+	// JSON web tokens, e.g. ServiceAccount tokens
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), redacted},
+	// GitHub tokens
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`), redacted},
+	// Passwords of the URLs with user info
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + redacted + "@"},
+}
+
+// String scrubs the credential shaped values from a log message or an error message.
+func String(message string) string {
+	for _, p := range secretPatterns {
+		message = p.pattern.ReplaceAllString(message, p.replacement)
+	}
+	return message
+}
+
+// Logger returns the logger scrubbing the credential material from the messages and the fields
+// of its entries: the secret data, the errors, and the strings shaped like credentials. It is a
+// no-op on a redacting logger.
+func Logger(logger *zap.SugaredLogger) *zap.SugaredLogger {
+	if _, ok := logger.Desugar().Core().(redactingCore); ok {
+		return logger
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core { return redactingCore{core} }))
+}
+
+// redactingCore redacts the entries before the wrapped core writes them.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{c.Core.With(redactFields(fields))}
+}
+
+// Check leaves the decision to the wrapped core, e.g. its sampler or the level of each core of a
+// tee, and only writes the entries it accepts, redacted.
+func (c redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(entry, nil) != nil {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = String(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+// redactFields returns the fields with their credential material redacted.
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactedFields := make([]zapcore.Field, 0, len(fields))
+	for _, field := range fields {
+		redactedFields = append(redactedFields, redactField(field))
+	}
+	return redactedFields
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	// The secrets are Stringers too, their data is dropped whatever the field type
+	switch value := field.Interface.(type) {
+	case map[string][]byte:
+		return zap.Any(field.Key, redactedKeys(value))
+	case *corev1.Secret:
+		return zap.Any(field.Key, redactedSecret(value))
+	case corev1.Secret:
+		return zap.Any(field.Key, redactedSecret(&value))
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = String(field.String)
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		return zap.String(field.Key, redacted)
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			return zap.String(field.Key, String(err.Error()))
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok {
+			return zap.String(field.Key, String(stringer.String()))
+		}
+	case zapcore.ReflectType:
+		// The values logged with zap.Any can't be inspected, they are logged formatted
+		return zap.String(field.Key, String(fmt.Sprintf("%+v", field.Interface)))
+	}
+	return field
+}
+
+// redactedKeys returns the keys of the secret data, with their values redacted.
+func redactedKeys[V any](data map[string]V) map[string]string {
+	keys := make(map[string]string, len(data))
+	for key := range data {
+		keys[key] = redacted
+	}
+	return keys
+}
+
+// redactedSecret returns the secret, with its data redacted.
+func redactedSecret(secret *corev1.Secret) *corev1.Secret {
+	if secret == nil {
+		return nil
+	}
+	redactedSecret := secret.DeepCopy()
+	redactedSecret.Data = nil
+	redactedSecret.StringData = redactedKeys(secret.StringData)
+	for key := range secret.Data {
+		redactedSecret.StringData[key] = redacted
+	}
+	// kubectl apply keeps the whole secret in its annotation
+	delete(redactedSecret.Annotations, corev1.LastAppliedConfigAnnotation)
+	return redactedSecret
+}
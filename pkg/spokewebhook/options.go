@@ -0,0 +1,69 @@
+package spokewebhook
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPort     = 9443
+	defaultCertFile = "/etc/webhook/tls.crt"
+	defaultKeyFile  = "/etc/webhook/tls.key"
+)
+
+// Options holds the configuration of the webhook, read from the environment variables set in
+// config/spoke-webhook.yaml.
+type Options struct {
+	// WEBHOOK_PORT: port serving the webhook
+	Port int
+	// TLS_CERT_FILE and TLS_KEY_FILE: the TLS serving certificate
+	CertFile string
+	KeyFile  string
+	// ALLOWED_USERNAMES: comma separated users which may always edit and delete the managed
+	// secrets, the user of the kubeconfig of the hub controller or the agent ServiceAccount
+	AllowedUsernames []string
+	// ALLOWED_GROUPS: comma separated groups which may always edit and delete the managed secrets
+	AllowedGroups []string
+}
+
+// OptionsFromEnv reads the options from the environment, falling back to the defaults for
+// unset variables.
+func OptionsFromEnv() (*Options, error) {
+	o := &Options{
+		Port:             defaultPort,
+		CertFile:         os.Getenv("TLS_CERT_FILE"),
+		KeyFile:          os.Getenv("TLS_KEY_FILE"),
+		AllowedUsernames: splitList(os.Getenv("ALLOWED_USERNAMES")),
+		AllowedGroups:    splitList(os.Getenv("ALLOWED_GROUPS")),
+	}
+	if o.CertFile == "" {
+		o.CertFile = defaultCertFile
+	}
+	if o.KeyFile == "" {
+		o.KeyFile = defaultKeyFile
+	}
+	if value := os.Getenv("WEBHOOK_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid WEBHOOK_PORT: must be a port number, got %q", value)
+		}
+		o.Port = port
+	}
+	if len(o.AllowedUsernames) == 0 && len(o.AllowedGroups) == 0 {
+		return nil, fmt.Errorf("invalid ALLOWED_USERNAMES: the user syncing the secrets must be allowed, set ALLOWED_USERNAMES or ALLOWED_GROUPS")
+	}
+	return o, nil
+}
+
+// splitList splits a comma separated list, dropping the empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
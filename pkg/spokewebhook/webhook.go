@@ -0,0 +1,194 @@
+// Package spokewebhook implements the validating webhook deployed on the spoke clusters: it
+// protects the secrets synced by the hub controller, or pulled by the agent, from being edited
+// or deleted by the spoke users while the PipelineRun they were synced for is running.
+package spokewebhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zakisk/secret-service/pkg/redact"
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+const (
+	// secretsPath is where the API server posts the AdmissionReviews of the managed secrets.
+	secretsPath = "/validate/secrets"
+
+	// maxAdmissionReviewSize bounds the AdmissionReview posted by the API server, the largest
+	// object the API server stores is 1.5MiB and the review may hold it twice.
+	maxAdmissionReviewSize = 4 << 20
+)
+
+// systemUsernames are the Kubernetes controllers which always may delete the managed secrets:
+// the garbage collector removing them with their PipelineRun, and the namespace controller.
+var systemUsernames = []string{
+	"system:serviceaccount:kube-system:generic-garbage-collector",
+	"system:serviceaccount:kube-system:namespace-controller",
+}
+
+// Webhook validates the updates and deletes of the managed secrets of a spoke cluster.
+type Webhook struct {
+	logger       *zap.SugaredLogger
+	tektonClient tektonversioned.Interface
+
+	port             int
+	certFile         string
+	keyFile          string
+	allowedUsernames []string
+	allowedGroups    []string
+}
+
+// New returns the webhook of the spoke cluster of the Tekton client.
+func New(logger *zap.SugaredLogger, opts *Options, tektonClient tektonversioned.Interface) *Webhook {
+	return &Webhook{
+		logger:           redact.Logger(logger),
+		tektonClient:     tektonClient,
+		port:             opts.Port,
+		certFile:         opts.CertFile,
+		keyFile:          opts.KeyFile,
+		allowedUsernames: append(slices.Clone(opts.AllowedUsernames), systemUsernames...),
+		allowedGroups:    opts.AllowedGroups,
+	}
+}
+
+// Handler returns the HTTP handler answering the AdmissionReviews of the managed secrets.
+func (w *Webhook) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+secretsPath, func(rw http.ResponseWriter, req *http.Request) {
+		admissionReview := &admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(io.LimitReader(req.Body, maxAdmissionReviewSize)).Decode(admissionReview); err != nil || admissionReview.Request == nil {
+			http.Error(rw, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		admissionReview.Response = w.review(req.Context(), admissionReview.Request)
+		admissionReview.Request = nil
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(admissionReview)
+	})
+	return mux
+}
+
+// review denies the update or delete of a managed secret while the PipelineRun it was synced
+// for is running, unless the request comes from an allowed user. Secrets which can't be
+// decoded, and the ones whose PipelineRun can't be read, are admitted, a webhook failure never
+// blocks the spoke cluster.
+func (w *Webhook) review(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation != admissionv1.Update && req.Operation != admissionv1.Delete {
+		return response
+	}
+	if w.allowed(req.UserInfo.Username, req.UserInfo.Groups) {
+		return response
+	}
+
+	secret := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.OldObject.Raw, secret); err != nil {
+		w.logger.Debugf("could not decode secret %s/%s under admission: %v", req.Namespace, req.Name, err)
+		return response
+	}
+	if secret.Namespace == "" {
+		secret.Namespace = req.Namespace
+	}
+	if secret.GetLabels()[syncer.ManagedByLabel] != syncer.ManagedByValue {
+		return response
+	}
+	namespace, name, ok := pipelineRunOf(secret)
+	if !ok {
+		return response
+	}
+
+	running, err := w.pipelineRunRunning(ctx, namespace, name)
+	if err != nil {
+		w.logger.Errorf("error getting PipelineRun %s/%s of secret %s/%s: %v", namespace, name, secret.Namespace, secret.Name, err)
+		response.Warnings = []string{fmt.Sprintf("secret-syncer could not verify PipelineRun %s/%s is done: %v", namespace, name, err)}
+		return response
+	}
+	if !running {
+		return response
+	}
+
+	operation := "updated"
+	if req.Operation == admissionv1.Delete {
+		operation = "deleted"
+	}
+	w.logger.Infof("denied user %s: secret %s/%s can't be %s while PipelineRun %s/%s is running", req.UserInfo.Username, secret.Namespace, secret.Name, operation, namespace, name)
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Reason:  metav1.StatusReasonForbidden,
+		Code:    http.StatusForbidden,
+		Message: fmt.Sprintf("secret %s/%s is managed by secret-syncer for PipelineRun %s/%s, it can't be %s until the PipelineRun is done", secret.Namespace, secret.Name, namespace, name, operation),
+	}
+	return response
+}
+
+// allowed reports whether the user may always edit and delete the managed secrets.
+func (w *Webhook) allowed(username string, groups []string) bool {
+	if slices.Contains(w.allowedUsernames, username) {
+		return true
+	}
+	return slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(w.allowedGroups, group) })
+}
+
+// pipelineRunOf returns the PipelineRun the secret was synced for, recorded in its
+// PipelineRunAnnotation, else its controller in the namespace of the secret.
+func pipelineRunOf(secret *metav1.PartialObjectMetadata) (string, string, bool) {
+	if namespace, name, ok := strings.Cut(secret.GetAnnotations()[syncer.PipelineRunAnnotation], "/"); ok && namespace != "" && name != "" {
+		return namespace, name, true
+	}
+	if owner := metav1.GetControllerOf(secret); owner != nil && owner.Kind == "PipelineRun" {
+		return secret.Namespace, owner.Name, true
+	}
+	return "", "", false
+}
+
+// pipelineRunRunning reports whether the PipelineRun exists, isn't done and isn't being deleted.
+func (w *Webhook) pipelineRunRunning(ctx context.Context, namespace, name string) (bool, error) {
+	pipelineRun, err := w.tektonClient.TektonV1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !pipelineRun.IsDone() && pipelineRun.GetDeletionTimestamp() == nil, nil
+}
+
+// Run serves the webhook until the context is done.
+func (w *Webhook) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", w.port),
+		Handler:           w.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	w.logger.Infof("Serving the managed secrets webhook on port %d", w.port)
+	if err := server.ListenAndServeTLS(w.certFile, w.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("webhook server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package spokewebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"gotest.tools/v3/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/zakisk/secret-service/pkg/syncer"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("ALLOWED_USERNAMES", "system:serviceaccount:secret-syncer:hub-controller, ")
+	opts, err := OptionsFromEnv()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &Options{
+		Port:             defaultPort,
+		CertFile:         defaultCertFile,
+		KeyFile:          defaultKeyFile,
+		AllowedUsernames: []string{"system:serviceaccount:secret-syncer:hub-controller"},
+	}, opts)
+
+	t.Setenv("WEBHOOK_PORT", "0")
+	_, err = OptionsFromEnv()
+	assert.ErrorContains(t, err, `invalid WEBHOOK_PORT: must be a port number, got "0"`)
+
+	t.Setenv("WEBHOOK_PORT", "")
+	t.Setenv("ALLOWED_USERNAMES", "")
+	_, err = OptionsFromEnv()
+	assert.ErrorContains(t, err, "invalid ALLOWED_USERNAMES")
+}
+
+func TestReview(t *testing.T) {
+	done := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "done", Namespace: "test-namespace"}}
+	done.Status.Status = duckv1.Status{Conditions: duckv1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse}}}
+	tektonClient := tektonfake.NewSimpleClientset(
+		&v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "test-namespace"}},
+		done,
+	)
+	tektonClient.PrependReactor("get", "pipelineruns", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.GetAction).GetName() == "unreachable" {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	w := New(zap.NewNop().Sugar(), &Options{AllowedUsernames: []string{"hub-controller"}, AllowedGroups: []string{"system:masters"}}, tektonClient)
+
+	managed := map[string]string{syncer.ManagedByLabel: syncer.ManagedByValue}
+	tests := []struct {
+		name             string
+		operation        admissionv1.Operation
+		user             authenticationv1.UserInfo
+		secret           metav1.ObjectMeta
+		expectedAllowed  bool
+		expectedMessage  string
+		expectedWarnings []string
+	}{
+		{
+			name:            "update while the PipelineRun is running",
+			operation:       admissionv1.Update,
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/running"}},
+			expectedMessage: "secret test-namespace/git-auth is managed by secret-syncer for PipelineRun test-namespace/running, it can't be updated until the PipelineRun is done",
+		},
+		{
+			name:            "delete of a secret owned by a running PipelineRun",
+			operation:       admissionv1.Delete,
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "running", Controller: ptr.To(true)}}},
+			expectedMessage: "secret test-namespace/git-auth is managed by secret-syncer for PipelineRun test-namespace/running, it can't be deleted until the PipelineRun is done",
+		},
+		{
+			name:            "allowed user",
+			operation:       admissionv1.Update,
+			user:            authenticationv1.UserInfo{Username: "hub-controller"},
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/running"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "allowed group",
+			operation:       admissionv1.Delete,
+			user:            authenticationv1.UserInfo{Username: "admin", Groups: []string{"system:authenticated", "system:masters"}},
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/running"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "garbage collector",
+			operation:       admissionv1.Delete,
+			user:            authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:generic-garbage-collector"},
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/running"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "done PipelineRun",
+			operation:       admissionv1.Delete,
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/done"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "deleted PipelineRun",
+			operation:       admissionv1.Delete,
+			secret:          metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/deleted"}},
+			expectedAllowed: true,
+		},
+		{
+			name:            "unmanaged secret",
+			operation:       admissionv1.Delete,
+			secret:          metav1.ObjectMeta{Name: "git-auth", Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/running"}},
+			expectedAllowed: true,
+		},
+		{
+			name:             "unreadable PipelineRun",
+			operation:        admissionv1.Delete,
+			secret:           metav1.ObjectMeta{Name: "git-auth", Labels: managed, Annotations: map[string]string{syncer.PipelineRunAnnotation: "test-namespace/unreachable"}},
+			expectedAllowed:  true,
+			expectedWarnings: []string{"secret-syncer could not verify PipelineRun test-namespace/unreachable is done: connection refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(&corev1.Secret{ObjectMeta: tt.secret})
+			assert.NilError(t, err)
+			body, err := json.Marshal(&admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "review-uid",
+					Namespace: "test-namespace",
+					Name:      tt.secret.Name,
+					Operation: tt.operation,
+					UserInfo:  tt.user,
+					OldObject: runtime.RawExtension{Raw: raw},
+				},
+			})
+			assert.NilError(t, err)
+
+			recorder := httptest.NewRecorder()
+			w.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, secretsPath, bytes.NewReader(body)))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			review := &admissionv1.AdmissionReview{}
+			assert.NilError(t, json.NewDecoder(recorder.Body).Decode(review))
+			assert.Equal(t, "review-uid", string(review.Response.UID))
+			assert.Equal(t, tt.expectedAllowed, review.Response.Allowed)
+			assert.DeepEqual(t, tt.expectedWarnings, review.Response.Warnings)
+			if !tt.expectedAllowed {
+				assert.Equal(t, tt.expectedMessage, review.Response.Result.Message)
+				assert.Equal(t, int32(http.StatusForbidden), review.Response.Result.Code)
+			}
+		})
+	}
+}
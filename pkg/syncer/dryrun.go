@@ -0,0 +1,33 @@
+package syncer
+
+import (
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// dryRunRoundTripper turns the writes of a client into server-side dry-run requests, validated
+// and admitted by the API server but never persisted. Reads go through unchanged.
+type dryRunRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		req = req.Clone(req.Context())
+		query := req.URL.Query()
+		query.Set("dryRun", metav1.DryRunAll)
+		req.URL.RawQuery = query.Encode()
+	}
+	return t.next.RoundTrip(req)
+}
+
+// withDryRun makes the writes of the clients created from the config dry-run requests.
+func withDryRun(config *rest.Config) *rest.Config {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &dryRunRoundTripper{next: rt}
+	})
+	return config
+}
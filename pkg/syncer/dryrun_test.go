@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestWithDryRun(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests[req.Method] = req.URL.Query().Get("dryRun")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"git-auth","namespace":"test-namespace"}}`))
+	}))
+	defer server.Close()
+
+	client, err := kubernetes.NewForConfig(withDryRun(&rest.Config{Host: server.URL}))
+	assert.NilError(t, err)
+	ctx := context.Background()
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "test-namespace"}}
+
+	_, err = client.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.NilError(t, err)
+	_, err = client.CoreV1().Secrets("test-namespace").Create(ctx, secret, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	_, err = client.CoreV1().Secrets("test-namespace").Update(ctx, secret, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+	err = client.CoreV1().Secrets("test-namespace").Delete(ctx, "git-auth", metav1.DeleteOptions{})
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, map[string]string{
+		http.MethodGet:    "",
+		http.MethodPost:   metav1.DryRunAll,
+		http.MethodPut:    metav1.DryRunAll,
+		http.MethodDelete: metav1.DryRunAll,
+	}, requests)
+}
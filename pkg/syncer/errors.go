@@ -0,0 +1,38 @@
+package syncer
+
+import (
+	"errors"
+)
+
+// Classes of the sync errors, matched with errors.Is. The errors keep their own message, the
+// classes only tell what went wrong.
+var (
+	// ErrClusterNotFound is the class of the errors of Workloads dispatched to a spoke cluster
+	// without a MultiKueueCluster.
+	ErrClusterNotFound = errors.New("spoke cluster not found")
+	// ErrSecretMissingKey is the class of the errors of secrets missing a required data key.
+	ErrSecretMissingKey = errors.New("secret is missing a key")
+)
+
+// classifiedError is an error matching its class with errors.Is.
+type classifiedError struct {
+	err   error
+	class error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.class}
+}
+
+// Classify returns the error, with its message unchanged, also matching the class with errors.Is.
+// A nil error stays nil.
+func Classify(err, class error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: class}
+}
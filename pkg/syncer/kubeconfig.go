@@ -0,0 +1,89 @@
+package syncer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigContextStrategy selects the context of a MultiKueue kubeconfig holding several
+// clusters.
+type KubeconfigContextStrategy string
+
+const (
+	// KubeconfigContextMatch selects the context named after the MultiKueueCluster, else the
+	// context of the cluster named after it, and falls back to the current context when none
+	// matches. It is the default.
+	KubeconfigContextMatch KubeconfigContextStrategy = "match"
+	// KubeconfigContextStrict selects the context like KubeconfigContextMatch, but fails when
+	// none of the contexts of a kubeconfig with several of them matches.
+	KubeconfigContextStrict KubeconfigContextStrategy = "strict"
+	// KubeconfigContextCurrent always selects the current context, like kubectl does.
+	KubeconfigContextCurrent KubeconfigContextStrategy = "current-context"
+)
+
+// ParseKubeconfigContextStrategy validates a KubeconfigContextStrategy, empty defaults to
+// KubeconfigContextMatch.
+func ParseKubeconfigContextStrategy(value string) (KubeconfigContextStrategy, error) {
+	switch strategy := KubeconfigContextStrategy(value); strategy {
+	case "":
+		return KubeconfigContextMatch, nil
+	case KubeconfigContextMatch, KubeconfigContextStrict, KubeconfigContextCurrent:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unsupported kubeconfig context strategy %q, must be one of %s, %s, %s", value, KubeconfigContextMatch, KubeconfigContextStrict, KubeconfigContextCurrent)
+	}
+}
+
+// restConfigFromKubeconfig returns the config of the context the strategy selects for the
+// cluster.
+func restConfigFromKubeconfig(kubeconfig *clientcmdapi.Config, clusterName string, strategy KubeconfigContextStrategy) (*rest.Config, error) {
+	contextName, err := kubeconfigContext(kubeconfig, clusterName, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.NewNonInteractiveClientConfig(*kubeconfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+}
+
+// kubeconfigContext returns the name of the context the strategy selects for the cluster. The
+// only context of a kubeconfig is always selected.
+func kubeconfigContext(kubeconfig *clientcmdapi.Config, clusterName string, strategy KubeconfigContextStrategy) (string, error) {
+	if strategy == KubeconfigContextCurrent {
+		return kubeconfig.CurrentContext, nil
+	}
+	if len(kubeconfig.Contexts) == 1 {
+		for name := range kubeconfig.Contexts {
+			return name, nil
+		}
+	}
+	if _, ok := kubeconfig.Contexts[clusterName]; ok {
+		return clusterName, nil
+	}
+
+	var matches []string
+	for name, context := range kubeconfig.Contexts {
+		if context.Cluster == clusterName {
+			matches = append(matches, name)
+		}
+	}
+	switch {
+	case slices.Contains(matches, kubeconfig.CurrentContext):
+		return kubeconfig.CurrentContext, nil
+	case len(matches) > 0:
+		slices.Sort(matches)
+		return matches[0], nil
+	case strategy == KubeconfigContextStrict:
+		contexts := make([]string, 0, len(kubeconfig.Contexts))
+		for name := range kubeconfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		slices.Sort(contexts)
+		return "", fmt.Errorf("none of the kubeconfig contexts %s is named after cluster %s or uses a cluster of that name", strings.Join(contexts, ", "), clusterName)
+	default:
+		return kubeconfig.CurrentContext, nil
+	}
+}
@@ -0,0 +1,125 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+)
+
+// fleetKubeconfig holds the contexts of several spoke clusters, the current one of another
+// cluster.
+const fleetKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: spoke-east
+  cluster:
+    server: https://spoke-east.example.com:6443
+- name: spoke-west
+  cluster:
+    server: https://spoke-west.example.com:6443
+- name: management
+  cluster:
+    server: https://management.example.com:6443
+contexts:
+- name: spoke-east
+  context:
+    cluster: spoke-east
+- name: admin@west
+  context:
+    cluster: spoke-west
+- name: management
+  context:
+    cluster: management
+current-context: management
+`
+
+func TestSpokeConfigKubeconfigContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		clusterName   string
+		strategy      KubeconfigContextStrategy
+		expectedHost  string
+		expectedError string
+	}{
+		{
+			name:         "context named after the cluster",
+			clusterName:  "spoke-east",
+			expectedHost: "https://spoke-east.example.com:6443",
+		},
+		{
+			name:         "context of the cluster",
+			clusterName:  "spoke-west",
+			strategy:     KubeconfigContextMatch,
+			expectedHost: "https://spoke-west.example.com:6443",
+		},
+		{
+			name:         "no match falls back to the current context",
+			clusterName:  "spoke-north",
+			strategy:     KubeconfigContextMatch,
+			expectedHost: "https://management.example.com:6443",
+		},
+		{
+			name:          "no match with the strict strategy",
+			clusterName:   "spoke-north",
+			strategy:      KubeconfigContextStrict,
+			expectedError: "none of the kubeconfig contexts admin@west, management, spoke-east is named after cluster spoke-north or uses a cluster of that name",
+		},
+		{
+			name:         "current context",
+			clusterName:  "spoke-east",
+			strategy:     KubeconfigContextCurrent,
+			expectedHost: "https://management.example.com:6443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &kueuev1beta1.MultiKueueCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.clusterName},
+				Spec: kueuev1beta1.MultiKueueClusterSpec{KubeConfig: kueuev1beta1.KubeConfig{
+					LocationType: kueuev1beta1.SecretLocationType,
+					Location:     "fleet-kubeconfig",
+				}},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "fleet-kubeconfig", Namespace: "kueue-system"},
+				Data:       map[string][]byte{"kubeconfig": []byte(fleetKubeconfig)},
+			}
+			s := New(Options{
+				HubKubeClient:     fake.NewSimpleClientset(secret),
+				KueueClient:       kueuefake.NewSimpleClientset(cluster),
+				KubeconfigContext: tt.strategy,
+			})
+
+			config, err := s.SpokeConfig(context.Background(), tt.clusterName)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tt.expectedHost, config.Host)
+		})
+	}
+}
+
+func TestParseKubeconfigContextStrategy(t *testing.T) {
+	for value, expected := range map[string]KubeconfigContextStrategy{
+		"":                KubeconfigContextMatch,
+		"match":           KubeconfigContextMatch,
+		"strict":          KubeconfigContextStrict,
+		"current-context": KubeconfigContextCurrent,
+	} {
+		strategy, err := ParseKubeconfigContextStrategy(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, expected, strategy)
+	}
+
+	_, err := ParseKubeconfigContextStrategy("first")
+	assert.Error(t, err, `unsupported kubeconfig context strategy "first", must be one of match, strict, current-context`)
+}
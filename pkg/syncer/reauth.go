@@ -0,0 +1,93 @@
+package syncer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+)
+
+// reauthRoundTripper handles the rotation of the kubeconfig of a spoke cluster: when the spoke
+// API server rejects the credentials with a 401, the kubeconfig is read again from the API server,
+// bypassing the informer caches which may not have seen the rotated secret yet, and the request
+// is retried once with it. The later requests of the clients use the refreshed credentials.
+type reauthRoundTripper struct {
+	clusterName string
+	logger      *zap.SugaredLogger
+	// refresh resolves the transport of the spoke cluster from its kubeconfig read again
+	refresh func(ctx context.Context) (http.RoundTripper, error)
+
+	next http.RoundTripper
+
+	mu sync.Mutex
+	// refreshed is the transport of the refreshed kubeconfig, nil until a request was rejected
+	refreshed http.RoundTripper
+}
+
+func (t *reauthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	refreshed := t.refreshed
+	t.mu.Unlock()
+	if refreshed != nil {
+		return refreshed.RoundTrip(withoutCredentials(req))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// A request whose body was consumed can't be sent again
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.logger.Infof("spoke cluster %s rejected the credentials of its kubeconfig, retrying with the kubeconfig read again", t.clusterName)
+	refreshed, refreshErr := t.refresh(req.Context())
+	if refreshErr != nil {
+		t.logger.Errorf("error reading the kubeconfig of spoke cluster %s again: %v", t.clusterName, refreshErr)
+		return resp, nil
+	}
+	retry := withoutCredentials(req)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	t.mu.Lock()
+	t.refreshed = refreshed
+	t.mu.Unlock()
+	return refreshed.RoundTrip(retry)
+}
+
+// withoutCredentials returns a copy of the request without the credentials the clients set from
+// the original kubeconfig, so the refreshed transport sets its own.
+func withoutCredentials(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	return req
+}
+
+// withReauth retries the requests of the clients created from the config rejected with a 401
+// once, with the kubeconfig of the spoke cluster read again from the API server.
+func (s *syncer) withReauth(config *rest.Config, clusterName string) *rest.Config {
+	// The informer caches are bypassed, they lag behind a rotated kubeconfig secret
+	direct := &syncer{opts: s.opts}
+	direct.opts.MultiKueueClusterLister, direct.opts.KubeconfigSecretLister = nil, nil
+	refresh := func(ctx context.Context) (http.RoundTripper, error) {
+		config, err := direct.configuredSpokeConfig(ctx, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		return rest.TransportFor(config)
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &reauthRoundTripper{clusterName: clusterName, logger: s.opts.Logger, refresh: refresh, next: rt}
+	})
+	return config
+}
@@ -0,0 +1,95 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+func TestSpokeClientsReauthenticate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		tokens []string
+	)
+	// The credentials of a kubeconfig are only sent over TLS
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, req.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if req.Header.Get("Authorization") != "Bearer rotated-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"Unauthorized","code":401}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"git-auth","namespace":"test-namespace"}}`))
+	}))
+	defer server.Close()
+
+	kubeconfigSecret := func(token string) *corev1.Secret {
+		secret := testKubeconfigSecret.DeepCopy()
+		secret.Data["kubeconfig"] = []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+contexts:
+- name: test-cluster
+  context:
+    cluster: test-cluster
+    user: test-user
+users:
+- name: test-user
+  user:
+    token: %s
+current-context: test-cluster
+`, server.URL, token))
+		return secret
+	}
+	// The cache still holds the kubeconfig from before the rotation
+	clusters := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, clusters.Add(testMultiKueueCluster))
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, secrets.Add(kubeconfigSecret("expired-token")))
+	s := New(Options{
+		HubKubeClient:           fake.NewSimpleClientset(kubeconfigSecret("rotated-token")),
+		KueueClient:             kueuefake.NewSimpleClientset(testMultiKueueCluster),
+		MultiKueueClusterLister: kueuev1beta1lister.NewMultiKueueClusterLister(clusters),
+		KubeconfigSecretLister:  corev1lister.NewSecretLister(secrets),
+	})
+
+	ctx := context.Background()
+	spokeKubeClient, _, err := s.SpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.NilError(t, err)
+	// The later requests use the rotated kubeconfig right away
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"Bearer expired-token", "Bearer rotated-token", "Bearer rotated-token"}, tokens)
+
+	// A kubeconfig still rejected after it was read again fails the request
+	s = New(Options{
+		HubKubeClient: fake.NewSimpleClientset(kubeconfigSecret("revoked-token")),
+		KueueClient:   kueuefake.NewSimpleClientset(testMultiKueueCluster),
+	})
+	spokeKubeClient, _, err = s.SpokeClients(ctx, testClusterName)
+	assert.NilError(t, err)
+	_, err = spokeKubeClient.CoreV1().Secrets("test-namespace").Get(ctx, "git-auth", metav1.GetOptions{})
+	assert.Assert(t, errors.IsUnauthorized(err), err)
+}
@@ -0,0 +1,298 @@
+// Package syncer resolves the spoke clusters of the PipelineRuns dispatched by Kueue MultiKueue
+// and builds the copies of their git credentials. It holds the steps of the secret-syncer
+// controller shared with the other controllers embedding them, the sync of a Workload itself runs
+// through the Standalone of the reconciler package, with the code of the controller.
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueueversioned "sigs.k8s.io/kueue/client-go/clientset/versioned"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+
+	"github.com/zakisk/secret-service/pkg/redact"
+)
+
+const (
+	// GitAuthSecretAnnotation on a PipelineRun names the secret Pipelines-as-Code created on the
+	// hub for it.
+	GitAuthSecretAnnotation = "pipelinesascode.tekton.dev/git-auth-secret"
+
+	// ManagedByLabel marks the secrets created on spoke clusters, with the ManagedByValue value.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "secret-syncer"
+
+	// WorkloadAnnotation and PipelineRunAnnotation record, as namespace/name, the hub Workload
+	// and the spoke PipelineRun a synced secret was created for.
+	WorkloadAnnotation    = "secret-syncer.tekton.dev/workload"
+	PipelineRunAnnotation = "secret-syncer.tekton.dev/pipelinerun"
+	// PipelineRunUIDAnnotation records the UID of the spoke PipelineRun a synced secret was
+	// created for, so a secret left by a deleted PipelineRun of the same name is told apart.
+	PipelineRunUIDAnnotation = "secret-syncer.tekton.dev/pipelinerun-uid"
+	// IdempotencyKeyAnnotation records the IdempotencyKey of the Workload a synced secret was last
+	// written for, so a retried write of the same generation is told apart from a new one.
+	IdempotencyKeyAnnotation = "secret-syncer.tekton.dev/idempotency-key"
+
+	// TargetNamespaceAnnotation on a Workload, set by the dispatcher, names the namespace of the
+	// spoke cluster its PipelineRun runs in, when it isn't the namespace of the Workload.
+	TargetNamespaceAnnotation = "secret-syncer.tekton.dev/target-namespace"
+)
+
+// Options configures a Syncer.
+type Options struct {
+	// HubKubeClient reads the MultiKueue kubeconfig secrets and the git auth secrets.
+	HubKubeClient kubernetes.Interface
+	// KueueClient reads the MultiKueueClusters.
+	KueueClient kueueversioned.Interface
+	// KueueNamespace holds the MultiKueue kubeconfig secrets, kueue-system when empty.
+	KueueNamespace string
+	// MultiKueueClusterLister and KubeconfigSecretLister, when set, resolve the spoke cluster
+	// configs from informer caches rather than the API server. KubeconfigSecretLister must cache
+	// the secrets of the KueueNamespace.
+	MultiKueueClusterLister kueuev1beta1lister.MultiKueueClusterLister
+	KubeconfigSecretLister  corev1lister.SecretLister
+	// SpokeClientQPS and SpokeClientBurst rate limit the clients of each spoke cluster, the
+	// client-go defaults when zero.
+	SpokeClientQPS   float32
+	SpokeClientBurst int
+	// KubeconfigContext selects the context of the kubeconfigs holding several clusters,
+	// KubeconfigContextMatch when empty.
+	KubeconfigContext KubeconfigContextStrategy
+	// ConfigureSpoke, when set, adjusts the REST config of a spoke cluster once it is resolved,
+	// e.g. with the settings of the cluster.
+	ConfigureSpoke func(ctx context.Context, clusterName string, config *rest.Config) error
+	// DryRun sends the writes to the spoke clusters as server-side dry-run requests, so they are
+	// validated but never persisted.
+	DryRun bool
+	// Logger logs the spoke cluster resolution, nothing is logged when nil.
+	Logger *zap.SugaredLogger
+}
+
+// Syncer resolves the spoke clusters the PipelineRuns are dispatched to.
+type Syncer interface {
+	// SpokeConfig resolves the REST config of a spoke cluster from its MultiKueueCluster,
+	// rate limited and adjusted by the options. The requests of its clients rejected with a 401
+	// are retried once with the kubeconfig read again.
+	SpokeConfig(ctx context.Context, clusterName string) (*rest.Config, error)
+	// SpokeClients creates the Kubernetes and Tekton clients of a spoke cluster.
+	SpokeClients(ctx context.Context, clusterName string) (kubernetes.Interface, tektonversioned.Interface, error)
+}
+
+type syncer struct {
+	opts Options
+}
+
+// New returns a Syncer configured by the options.
+func New(opts Options) Syncer {
+	if opts.KueueNamespace == "" {
+		opts.KueueNamespace = "kueue-system"
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop().Sugar()
+	}
+	opts.Logger = redact.Logger(opts.Logger)
+	return &syncer{opts: opts}
+}
+
+func (s *syncer) SpokeConfig(ctx context.Context, clusterName string) (*rest.Config, error) {
+	config, err := s.configuredSpokeConfig(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return s.withReauth(config, clusterName), nil
+}
+
+// configuredSpokeConfig resolves the REST config of a spoke cluster, rate limited and adjusted by
+// the options.
+func (s *syncer) configuredSpokeConfig(ctx context.Context, clusterName string) (*rest.Config, error) {
+	config, err := s.spokeConfig(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	config.QPS = s.opts.SpokeClientQPS
+	config.Burst = s.opts.SpokeClientBurst
+	if s.opts.ConfigureSpoke != nil {
+		if err := s.opts.ConfigureSpoke(ctx, clusterName, config); err != nil {
+			return nil, err
+		}
+	}
+	if !s.opts.DryRun {
+		return config, nil
+	}
+	return withDryRun(config), nil
+}
+
+// spokeConfig resolves the REST config of a spoke cluster from the kubeconfig of its
+// MultiKueueCluster.
+func (s *syncer) spokeConfig(ctx context.Context, clusterName string) (*rest.Config, error) {
+	mkCluster, err := s.multiKueueCluster(ctx, clusterName)
+	if errors.IsNotFound(err) {
+		return nil, Classify(fmt.Errorf("could not find MultiKueueCluster %s: %w", clusterName, err), ErrClusterNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find MultiKueueCluster %s: %w", clusterName, err)
+	}
+
+	kubeConfig := mkCluster.Spec.KubeConfig
+
+	switch kubeConfig.LocationType {
+	case "Secret":
+		kubeconfigSecret, err := s.kubeconfigSecret(ctx, kubeConfig.Location)
+		if err != nil {
+			return nil, fmt.Errorf("could not get kubeconfig secret %s/%s: %w", s.opts.KueueNamespace, kubeConfig.Location, err)
+		}
+
+		kubeconfigBytes, ok := kubeconfigSecret.Data["kubeconfig"]
+		if !ok {
+			return nil, Classify(fmt.Errorf("kubeconfig secret %s/%s is missing 'kubeconfig' data key", s.opts.KueueNamespace, kubeConfig.Location), ErrSecretMissingKey)
+		}
+
+		kubeconfig, err := clientcmd.Load(kubeconfigBytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not load kubeconfig secret %s/%s: %w", s.opts.KueueNamespace, kubeConfig.Location, err)
+		}
+		return restConfigFromKubeconfig(kubeconfig, clusterName, s.opts.KubeconfigContext)
+	case "Path":
+		kubeconfig, err := clientcmd.LoadFromFile(kubeConfig.Location)
+		if err != nil {
+			return nil, fmt.Errorf("could not load kubeconfig %s: %w", kubeConfig.Location, err)
+		}
+		return restConfigFromKubeconfig(kubeconfig, clusterName, s.opts.KubeconfigContext)
+	default:
+		return nil, fmt.Errorf("unsupported kubeconfig location type: %s", kubeConfig.LocationType)
+	}
+}
+
+// multiKueueCluster returns the MultiKueueCluster, from the cache when there is one.
+func (s *syncer) multiKueueCluster(ctx context.Context, name string) (*kueuev1beta1.MultiKueueCluster, error) {
+	if s.opts.MultiKueueClusterLister != nil {
+		return s.opts.MultiKueueClusterLister.Get(name)
+	}
+	return s.opts.KueueClient.KueueV1beta1().MultiKueueClusters().Get(ctx, name, metav1.GetOptions{})
+}
+
+// kubeconfigSecret returns the kubeconfig secret of the KueueNamespace, from the cache when there is one.
+func (s *syncer) kubeconfigSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	if s.opts.KubeconfigSecretLister != nil {
+		return s.opts.KubeconfigSecretLister.Secrets(s.opts.KueueNamespace).Get(name)
+	}
+	return s.opts.HubKubeClient.CoreV1().Secrets(s.opts.KueueNamespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (s *syncer) SpokeClients(ctx context.Context, clusterName string) (kubernetes.Interface, tektonversioned.Interface, error) {
+	spokeClusterConfig, err := s.SpokeConfig(ctx, clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spokeKubeClient, err := kubernetes.NewForConfig(spokeClusterConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create kube client for spoke cluster %s: %w", clusterName, err)
+	}
+
+	spokeTektonClient, err := tektonversioned.NewForConfig(spokeClusterConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create tekton client for spoke cluster %s: %w", clusterName, err)
+	}
+
+	return spokeKubeClient, spokeTektonClient, nil
+}
+
+// SpokePipelineRun returns the PipelineRun of the spoke cluster, nil when it is not created yet.
+func SpokePipelineRun(ctx context.Context, spokeTektonClient tektonversioned.Interface, namespace, name string) (*v1.PipelineRun, error) {
+	pipelineRun, err := spokeTektonClient.TektonV1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pipelineRun, nil
+}
+
+// GitAuthSecret returns the name of the git auth secret of the PipelineRun.
+func GitAuthSecret(pipelineRun *v1.PipelineRun) (string, bool) {
+	secretName, ok := pipelineRun.GetAnnotations()[GitAuthSecretAnnotation]
+	return secretName, ok
+}
+
+// SpokeNamespace returns the namespace of the spoke cluster the PipelineRun of the Workload runs
+// in, the one of its TargetNamespaceAnnotation, else the namespace of the Workload.
+func SpokeNamespace(workload *kueuev1beta1.Workload) string {
+	if namespace := workload.GetAnnotations()[TargetNamespaceAnnotation]; namespace != "" {
+		return namespace
+	}
+	return workload.GetNamespace()
+}
+
+// ValidateSpokeNamespace checks the TargetNamespaceAnnotation of the Workload is a namespace name.
+func ValidateSpokeNamespace(workload *kueuev1beta1.Workload) error {
+	namespace, ok := workload.GetAnnotations()[TargetNamespaceAnnotation]
+	if !ok {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid %s annotation %q of workload %s/%s: %s", TargetNamespaceAnnotation, namespace, workload.GetNamespace(), workload.GetName(), strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// IdempotencyKey returns the key of the writes of the secrets synced for the Workload, its UID and
+// generation: the writes for the same generation of a Workload are the same.
+func IdempotencyKey(workload *kueuev1beta1.Workload) string {
+	return string(workload.GetUID()) + "/" + strconv.FormatInt(workload.GetGeneration(), 10)
+}
+
+// SpokeSecret returns the copy of the secret to create on the spoke cluster for the
+// PipelineRun, in the spoke namespace of the Workload, owned by the spoke PipelineRun and
+// annotated with the Workload and the PipelineRun it was synced for.
+func SpokeSecret(secret *corev1.Secret, pipelineRun *v1.PipelineRun, workload *kueuev1beta1.Workload) *corev1.Secret {
+	// Create a new secret object with only the required fields
+	newSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Namespace:   SpokeNamespace(workload),
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+	for k, v := range secret.Labels {
+		newSecret.Labels[k] = v
+	}
+	for k, v := range secret.Annotations {
+		newSecret.Annotations[k] = v
+	}
+	newSecret.Labels[ManagedByLabel] = ManagedByValue
+	newSecret.Annotations[WorkloadAnnotation] = workload.GetNamespace() + "/" + workload.GetName()
+	newSecret.Annotations[PipelineRunAnnotation] = SpokeNamespace(workload) + "/" + pipelineRun.GetName()
+	newSecret.Annotations[PipelineRunUIDAnnotation] = string(pipelineRun.GetUID())
+	newSecret.Annotations[IdempotencyKeyAnnotation] = IdempotencyKey(workload)
+
+	// Copy owner references if they exist
+	if len(secret.OwnerReferences) > 0 {
+		newSecret.OwnerReferences = make([]metav1.OwnerReference, len(secret.OwnerReferences))
+		for i, ref := range secret.OwnerReferences {
+			newSecret.OwnerReferences[i] = ref
+			// Override only the UID to point to the spoke cluster's PipelineRun
+			newSecret.OwnerReferences[i].UID = pipelineRun.GetUID()
+		}
+	}
+	return newSecret
+}
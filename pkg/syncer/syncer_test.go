@@ -0,0 +1,182 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	kueuev1beta1 "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	kueuefake "sigs.k8s.io/kueue/client-go/clientset/versioned/fake"
+	kueuev1beta1lister "sigs.k8s.io/kueue/client-go/listers/kueue/v1beta1"
+)
+
+const testClusterName = "test-cluster"
+
+func testWorkload(clusterName string) *kueuev1beta1.Workload {
+	isController := true
+	workload := &kueuev1beta1.Workload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-workload",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", Controller: &isController}},
+		},
+	}
+	if clusterName != "" {
+		workload.Status.ClusterName = &clusterName
+	}
+	return workload
+}
+
+func TestSpokeSecret(t *testing.T) {
+	hubSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "git-auth",
+			Namespace:       "test-namespace",
+			Labels:          map[string]string{"app": "pac"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "PipelineRun", Name: "test-pipeline-run", UID: "hub-uid"}},
+		},
+		Data: map[string][]byte{"git-provider-token": []byte("token")},
+	}
+	targetWorkload := testWorkload(testClusterName)
+	targetWorkload.Annotations = map[string]string{TargetNamespaceAnnotation: "remote-runs"}
+
+	tests := []struct {
+		name           string
+		workload       *kueuev1beta1.Workload
+		spokeNamespace string
+	}{
+		{
+			name:           "namespace of the Workload",
+			workload:       testWorkload(testClusterName),
+			spokeNamespace: "test-namespace",
+		},
+		{
+			name:           "target namespace",
+			workload:       targetWorkload,
+			spokeNamespace: "remote-runs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelineRun := &v1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "test-pipeline-run", Namespace: tt.spokeNamespace, UID: "spoke-uid"}}
+
+			secret := SpokeSecret(hubSecret, pipelineRun, tt.workload)
+			assert.Equal(t, "git-auth", secret.Name)
+			assert.Equal(t, tt.spokeNamespace, secret.Namespace)
+			assert.Equal(t, "token", string(secret.Data["git-provider-token"]))
+			assert.Equal(t, "pac", secret.Labels["app"])
+			assert.Equal(t, ManagedByValue, secret.Labels[ManagedByLabel])
+			assert.Equal(t, "test-namespace/test-workload", secret.Annotations[WorkloadAnnotation])
+			assert.Equal(t, tt.spokeNamespace+"/test-pipeline-run", secret.Annotations[PipelineRunAnnotation])
+			assert.Equal(t, "spoke-uid", secret.Annotations[PipelineRunUIDAnnotation])
+			assert.Equal(t, IdempotencyKey(tt.workload), secret.Annotations[IdempotencyKeyAnnotation])
+			assert.Equal(t, "spoke-uid", string(secret.OwnerReferences[0].UID))
+			// The hub secret is left as it is
+			assert.Equal(t, "hub-uid", string(hubSecret.OwnerReferences[0].UID))
+			assert.Equal(t, "", hubSecret.Labels[ManagedByLabel])
+		})
+	}
+}
+
+func TestSpokeNamespace(t *testing.T) {
+	workload := testWorkload(testClusterName)
+	assert.Equal(t, "test-namespace", SpokeNamespace(workload))
+	assert.NilError(t, ValidateSpokeNamespace(workload))
+
+	workload.Annotations = map[string]string{TargetNamespaceAnnotation: "remote-runs"}
+	assert.Equal(t, "remote-runs", SpokeNamespace(workload))
+	assert.NilError(t, ValidateSpokeNamespace(workload))
+
+	workload.Annotations[TargetNamespaceAnnotation] = "Remote_Runs"
+	assert.ErrorContains(t, ValidateSpokeNamespace(workload), `invalid secret-syncer.tekton.dev/target-namespace annotation "Remote_Runs" of workload test-namespace/test-workload`)
+}
+
+var (
+	testMultiKueueCluster = &kueuev1beta1.MultiKueueCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+		Spec: kueuev1beta1.MultiKueueClusterSpec{KubeConfig: kueuev1beta1.KubeConfig{
+			LocationType: kueuev1beta1.SecretLocationType,
+			Location:     "test-cluster-kubeconfig",
+		}},
+	}
+	testKubeconfigSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-kubeconfig", Namespace: "kueue-system"},
+		Data: map[string][]byte{"kubeconfig": []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test-cluster
+  cluster:
+    server: https://test-cluster.example.com:6443
+contexts:
+- name: test-cluster
+  context:
+    cluster: test-cluster
+current-context: test-cluster
+`)},
+	}
+)
+
+func TestSpokeConfig(t *testing.T) {
+	kueueClient := kueuefake.NewSimpleClientset(testMultiKueueCluster)
+	hubKubeClient := fake.NewSimpleClientset(testKubeconfigSecret)
+	s := New(Options{HubKubeClient: hubKubeClient, KueueClient: kueueClient})
+
+	config, err := s.SpokeConfig(context.Background(), testClusterName)
+	assert.NilError(t, err)
+	assert.Equal(t, "https://test-cluster.example.com:6443", config.Host)
+
+	// The config is rate limited and adjusted by the options
+	s = New(Options{HubKubeClient: hubKubeClient, KueueClient: kueueClient, SpokeClientQPS: 20, SpokeClientBurst: 40,
+		ConfigureSpoke: func(_ context.Context, clusterName string, config *rest.Config) error {
+			assert.Equal(t, testClusterName, clusterName)
+			config.QPS = 5
+			return nil
+		},
+	})
+	config, err = s.SpokeConfig(context.Background(), testClusterName)
+	assert.NilError(t, err)
+	assert.Equal(t, float32(5), config.QPS)
+	assert.Equal(t, 40, config.Burst)
+
+	_, err = s.SpokeConfig(context.Background(), "other-cluster")
+	assert.ErrorContains(t, err, "could not find MultiKueueCluster other-cluster")
+	assert.ErrorIs(t, err, ErrClusterNotFound)
+
+	noKubeconfig := testKubeconfigSecret.DeepCopy()
+	noKubeconfig.Data = map[string][]byte{"config": testKubeconfigSecret.Data["kubeconfig"]}
+	s = New(Options{HubKubeClient: fake.NewSimpleClientset(noKubeconfig), KueueClient: kueueClient})
+	_, err = s.SpokeConfig(context.Background(), testClusterName)
+	assert.Error(t, err, "kubeconfig secret kueue-system/test-cluster-kubeconfig is missing 'kubeconfig' data key")
+	assert.ErrorIs(t, err, ErrSecretMissingKey)
+}
+
+func TestSpokeConfigFromListers(t *testing.T) {
+	clusters := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NilError(t, clusters.Add(testMultiKueueCluster))
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NilError(t, secrets.Add(testKubeconfigSecret))
+	// Without clients, any call to the API server would panic
+	s := New(Options{
+		MultiKueueClusterLister: kueuev1beta1lister.NewMultiKueueClusterLister(clusters),
+		KubeconfigSecretLister:  corev1lister.NewSecretLister(secrets),
+	})
+
+	config, err := s.SpokeConfig(context.Background(), testClusterName)
+	assert.NilError(t, err)
+	assert.Equal(t, "https://test-cluster.example.com:6443", config.Host)
+
+	_, err = s.SpokeConfig(context.Background(), "other-cluster")
+	assert.ErrorContains(t, err, "could not find MultiKueueCluster other-cluster")
+
+	assert.NilError(t, secrets.Delete(testKubeconfigSecret))
+	_, err = s.SpokeConfig(context.Background(), testClusterName)
+	assert.ErrorContains(t, err, "could not get kubeconfig secret kueue-system/test-cluster-kubeconfig")
+}
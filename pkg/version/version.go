@@ -0,0 +1,46 @@
+// Package version holds the build information of the secret-syncer binaries, set at build time
+// with -ldflags "-X github.com/zakisk/secret-service/pkg/version.Version=...", see the Makefile.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Version is the release of the build, devel for the builds without -ldflags.
+	Version = "devel"
+	// Commit is the git commit of the build, read from the Go build info when not set.
+	Commit = ""
+	// BuildDate is when the binary was built, in RFC 3339.
+	BuildDate = ""
+)
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	Commit = "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				Commit = setting.Value
+			}
+		}
+	}
+}
+
+// GoVersion is the Go release the binary was built with.
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// String describes the build, as printed by --version.
+func String() string {
+	date := BuildDate
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s with %s)", Version, Commit, date, GoVersion())
+}
@@ -0,0 +1,19 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestString(t *testing.T) {
+	version, commit, buildDate := Version, Commit, BuildDate
+	t.Cleanup(func() { Version, Commit, BuildDate = version, commit, buildDate })
+
+	Version, Commit, BuildDate = "v0.4.0", "0123abc", "2026-01-01T10:00:00Z"
+	assert.Equal(t, "v0.4.0 (commit 0123abc, built 2026-01-01T10:00:00Z with "+runtime.Version()+")", String())
+
+	BuildDate = ""
+	assert.Equal(t, "v0.4.0 (commit 0123abc, built unknown with "+runtime.Version()+")", String())
+}